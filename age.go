@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// age v1 file format (https://age-encryption.org/v1) with X25519 recipients
+
+const (
+	ageVersionLine = "age-encryption.org/v1"
+	ageX25519Label = "age-encryption.org/v1/X25519"
+	ageChunkSize   = 64 * 1024
+	ageFileKeySize = 16
+)
+
+// ageB64 is the unpadded base64 encoding used in age headers
+var ageB64 = base64.RawStdEncoding
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// bech32Polymod computes the BIP 173 checksum state
+func bech32Polymod(values []byte) uint32 {
+	generator := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := range generator {
+			if (top>>i)&1 == 1 {
+				chk ^= generator[i]
+			}
+		}
+	}
+	return chk
+}
+
+// bech32HRPExpand prepares the human readable part for checksumming
+func bech32HRPExpand(hrp string) []byte {
+	out := make([]byte, 0, 2*len(hrp)+1)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]>>5)
+	}
+	out = append(out, 0)
+	for i := 0; i < len(hrp); i++ {
+		out = append(out, hrp[i]&31)
+	}
+	return out
+}
+
+// convertBits regroups data between bit widths, as bech32 payloads require
+func convertBits(data []byte, from, to uint, pad bool) ([]byte, error) {
+	var acc, bits uint
+	var out []byte
+	maxv := uint(1)<<to - 1
+	for _, b := range data {
+		if uint(b)>>from != 0 {
+			return nil, errors.New("invalid data range")
+		}
+		acc = acc<<from | uint(b)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(to-bits)&maxv))
+		}
+	} else if bits >= from || acc<<(to-bits)&maxv != 0 {
+		return nil, errors.New("invalid padding")
+	}
+	return out, nil
+}
+
+// bech32Encode encodes data with the given human readable part
+func bech32Encode(hrp string, data []byte) string {
+	values, _ := convertBits(data, 8, 5, true)
+	polymod := bech32Polymod(append(append(bech32HRPExpand(hrp), values...), 0, 0, 0, 0, 0, 0)) ^ 1
+	var sb strings.Builder
+	sb.WriteString(hrp + "1")
+	for _, v := range values {
+		sb.WriteByte(bech32Charset[v])
+	}
+	for i := 0; i < 6; i++ {
+		sb.WriteByte(bech32Charset[polymod>>(5*(5-i))&31])
+	}
+	return sb.String()
+}
+
+// bech32Decode returns the human readable part and data of a bech32 string
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case")
+	}
+	s = strings.ToLower(s)
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 || pos+7 > len(s) {
+		return "", nil, errors.New("invalid separator position")
+	}
+	hrp := s[:pos]
+	var values []byte
+	for i := pos + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("invalid character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("invalid checksum")
+	}
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	return hrp, data, err
+}
+
+// parseAgeRecipient decodes an age1... X25519 public key
+func parseAgeRecipient(s string) (*ecdh.PublicKey, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+	}
+	if hrp != "age" {
+		return nil, fmt.Errorf("invalid age recipient %q: unexpected prefix %q", s, hrp)
+	}
+	key, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age recipient %q: %w", s, err)
+	}
+	return key, nil
+}
+
+// ageWrapFileKey builds the X25519 recipient stanza for one recipient
+func ageWrapFileKey(recipient *ecdh.PublicKey, fileKey []byte) (string, error) {
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return "", err
+	}
+	share := ephemeral.PublicKey().Bytes()
+	salt := append(append([]byte{}, share...), recipient.Bytes()...)
+	wrapKey, err := hkdf.Key(sha256.New, shared, salt, ageX25519Label, chachaKeySize)
+	if err != nil {
+		return "", err
+	}
+	body := chachaPolySeal(wrapKey, make([]byte, chachaNonceSize), fileKey, nil)
+	return fmt.Sprintf("-> X25519 %s\n%s\n", ageB64.EncodeToString(share), ageB64.EncodeToString(body)), nil
+}
+
+// ageWriter encrypts a stream to age recipients
+type ageWriter struct {
+	w       io.Writer
+	key     []byte
+	buf     []byte
+	counter uint64
+	err     error
+}
+
+// NewAgeWriter writes the age header for recipients to w and returns a writer
+// that encrypts the payload. Close must be called to write the final chunk.
+func NewAgeWriter(w io.Writer, recipients []*ecdh.PublicKey) (io.WriteCloser, error) {
+	fileKey := make([]byte, ageFileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.WriteString(ageVersionLine + "\n")
+	for _, recipient := range recipients {
+		stanza, err := ageWrapFileKey(recipient, fileKey)
+		if err != nil {
+			return nil, err
+		}
+		header.WriteString(stanza)
+	}
+	header.WriteString("---")
+	macKey, err := hkdf.Key(sha256.New, fileKey, nil, "header", 32)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header.Bytes())
+	header.WriteString(" " + ageB64.EncodeToString(mac.Sum(nil)) + "\n")
+
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header.Write(nonce)
+	payloadKey, err := hkdf.Key(sha256.New, fileKey, nonce, "payload", chachaKeySize)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(header.Bytes()); err != nil {
+		return nil, err
+	}
+	return &ageWriter{w: w, key: payloadKey}, nil
+}
+
+// ageChunkNonce is the STREAM nonce: an 11-byte big-endian counter and a last-chunk flag
+func ageChunkNonce(counter uint64, last bool) []byte {
+	nonce := make([]byte, chachaNonceSize)
+	for i := 0; i < 8; i++ {
+		nonce[10-i] = byte(counter >> (8 * i))
+	}
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// sealChunk encrypts and writes one payload chunk
+func (a *ageWriter) sealChunk(chunk []byte, last bool) error {
+	sealed := chachaPolySeal(a.key, ageChunkNonce(a.counter, last), chunk, nil)
+	a.counter++
+	_, err := a.w.Write(sealed)
+	return err
+}
+
+func (a *ageWriter) Write(p []byte) (int, error) {
+	if a.err != nil {
+		return 0, a.err
+	}
+	a.buf = append(a.buf, p...)
+	// Keep at least one byte buffered so the final chunk is never empty
+	for len(a.buf) > ageChunkSize {
+		if a.err = a.sealChunk(a.buf[:ageChunkSize], false); a.err != nil {
+			return 0, a.err
+		}
+		a.buf = a.buf[ageChunkSize:]
+	}
+	return len(p), nil
+}
+
+func (a *ageWriter) Close() error {
+	if a.err != nil {
+		return a.err
+	}
+	a.err = errors.New("age: write after close")
+	return a.sealChunk(a.buf, true)
+}
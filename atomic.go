@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// atomicFile is written next to its destination and renamed into place on
+// Commit, so a full disk or a crash leaves the previous file (or none)
+// rather than a truncated one
+type atomicFile struct {
+	*os.File
+	path    string
+	backups int // Rotated copies of the previous version to keep
+}
+
+// createAtomic starts writing path through <path>.tmp
+func createAtomic(path string, perm os.FileMode) (*atomicFile, error) {
+	f, err := os.OpenFile(path+".tmp", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, path: path}, nil
+}
+
+// Commit syncs the file to disk, rotates the backups and moves the file into
+// place, then syncs the directory so the rename survives a crash too
+func (f *atomicFile) Commit() error {
+	err := f.Sync()
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && f.backups > 0 {
+		err = rotateBackups(f.path, f.backups)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	syncDir(filepath.Dir(f.path))
+	return nil
+}
+
+// Abort removes the unfinished file
+func (f *atomicFile) Abort() {
+	if f == nil {
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// writeFileAtomic writes data to path without ever leaving it half-written,
+// keeping the given number of backups of the version it replaces
+func writeFileAtomic(path string, data []byte, perm os.FileMode, backups int) error {
+	f, err := createAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	f.backups = backups
+	if _, err := f.Write(data); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Commit()
+}
+
+// backupPath names the nth backup of path, <path>.1 being the newest
+func backupPath(path string, n int) string {
+	return path + "." + strconv.Itoa(n)
+}
+
+// isBackup reports whether name is a backup of path
+func isBackup(name, path string) bool {
+	suffix, ok := strings.CutPrefix(name, path+".")
+	n, err := strconv.Atoi(suffix)
+	return ok && err == nil && n > 0 && suffix[0] != '0'
+}
+
+// rotateBackups shifts <path>.1 … <path>.<keep-1> up by one, dropping the
+// oldest, and makes the current file <path>.1 while leaving it in place
+func rotateBackups(path string, keep int) error {
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err := os.Remove(backupPath(path, keep)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to rotate backups: %w", err)
+	}
+	for n := keep - 1; n >= 1; n-- {
+		if err := os.Rename(backupPath(path, n), backupPath(path, n+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to rotate backups: %w", err)
+		}
+	}
+	// A hard link costs no space; file systems without them get a copy
+	if os.Link(path, backupPath(path, 1)) == nil {
+		return nil
+	}
+	if err := copyFile(path, backupPath(path, 1)); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	return nil
+}
+
+// copyFile copies a file's contents and syncs the copy to disk
+func copyFile(from, to string) error {
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(target, source)
+	if err == nil {
+		err = target.Sync()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(to)
+	}
+	return err
+}
+
+// syncDir flushes a directory's entries to disk; Windows cannot open
+// directories for that, and NTFS journals renames itself
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
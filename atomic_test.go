@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.json")
+	if err := writeFileAtomic(path, []byte("{}\n"), 0644, 0); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{}\n" {
+		t.Errorf("Unexpected contents: %q", data)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Expected the temporary file to be gone")
+	}
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "db.json"), nil, 0644, 0); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+func TestBackupRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+	for _, version := range []string{"1", "2", "3", "4"} {
+		if err := writeFileAtomic(path, []byte(version), 0644, 2); err != nil {
+			t.Fatalf("Write %s failed: %v", version, err)
+		}
+	}
+	for name, want := range map[string]string{path: "4", backupPath(path, 1): "3", backupPath(path, 2): "2"} {
+		if data, _ := os.ReadFile(name); string(data) != want {
+			t.Errorf("Expected %s to hold version %s, got %q", name, want, data)
+		}
+	}
+	if _, err := os.Stat(backupPath(path, 3)); !os.IsNotExist(err) {
+		t.Error("Expected only two backups to be kept")
+	}
+	if !isBackup(backupPath(path, 2), path) || isBackup(path+".tmp", path) || isBackup(path+".01", path) {
+		t.Error("isBackup does not match backups exactly")
+	}
+}
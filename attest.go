@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// in-toto and SLSA type identifiers
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	attestBuildType     = "https://github.com/stl3/hashculate/attest@v1"
+	defaultBuilderID    = "https://github.com/stl3/hashculate"
+)
+
+// InTotoSubject is an artifact covered by an attestation
+type InTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// InTotoStatement is an in-toto v1 attestation statement
+type InTotoStatement struct {
+	Type          string          `json:"_type"`
+	Subject       []InTotoSubject `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     any             `json:"predicate"`
+}
+
+// slsaProvenance is the SLSA v1 provenance predicate describing the hashing run
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType          string            `json:"buildType"`
+		ExternalParameters map[string]string `json:"externalParameters"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId,omitempty"`
+			StartedOn    string `json:"startedOn"`
+			FinishedOn   string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// AttestOptions controls the predicate of a generated statement
+type AttestOptions struct {
+	BuilderID     string
+	PredicateType string // custom predicate type, used with PredicatePath
+	PredicatePath string // JSON file used as the predicate instead of SLSA provenance
+	StartedOn     time.Time
+	FinishedOn    time.Time
+}
+
+// BuildStatement creates an in-toto statement whose subjects are the hashed files
+func BuildStatement(results []*HashResult, opts AttestOptions) (*InTotoStatement, error) {
+	statement := &InTotoStatement{Type: inTotoStatementType}
+	for _, result := range results {
+		statement.Subject = append(statement.Subject, InTotoSubject{
+			Name:   result.Filename,
+			Digest: map[string]string{string(result.Algorithm): result.Hash},
+		})
+	}
+
+	if opts.PredicatePath != "" {
+		data, err := os.ReadFile(opts.PredicatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read predicate: %w", err)
+		}
+		var predicate any
+		if err := json.Unmarshal(data, &predicate); err != nil {
+			return nil, fmt.Errorf("invalid predicate JSON: %w", err)
+		}
+		if opts.PredicateType == "" {
+			return nil, fmt.Errorf("a predicate type is required with a custom predicate")
+		}
+		statement.PredicateType = opts.PredicateType
+		statement.Predicate = predicate
+		return statement, nil
+	}
+
+	provenance := &slsaProvenance{}
+	provenance.BuildDefinition.BuildType = attestBuildType
+	provenance.BuildDefinition.ExternalParameters = ciParameters()
+	provenance.RunDetails.Builder.ID = opts.BuilderID
+	if provenance.RunDetails.Builder.ID == "" {
+		provenance.RunDetails.Builder.ID = defaultBuilderID
+	}
+	provenance.RunDetails.Metadata.InvocationID = ciInvocationID()
+	provenance.RunDetails.Metadata.StartedOn = opts.StartedOn.UTC().Format(time.RFC3339)
+	provenance.RunDetails.Metadata.FinishedOn = opts.FinishedOn.UTC().Format(time.RFC3339)
+	statement.PredicateType = slsaProvenanceType
+	statement.Predicate = provenance
+	return statement, nil
+}
+
+// ciParameters records the source revision when running under GitHub Actions
+func ciParameters() map[string]string {
+	params := map[string]string{}
+	for key, env := range map[string]string{
+		"repository": "GITHUB_REPOSITORY",
+		"ref":        "GITHUB_REF",
+		"sha":        "GITHUB_SHA",
+		"workflow":   "GITHUB_WORKFLOW_REF",
+	} {
+		if value := os.Getenv(env); value != "" {
+			params[key] = value
+		}
+	}
+	return params
+}
+
+// ciInvocationID links the attestation to the GitHub Actions run that produced it
+func ciInvocationID() string {
+	server, repo, run := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID")
+	if server == "" || repo == "" || run == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s/attempts/%s", server, repo, run, os.Getenv("GITHUB_RUN_ATTEMPT"))
+}
+
+// WriteStatement writes a statement as indented JSON, encrypted when recipients are set
+func WriteStatement(path string, statement *InTotoStatement, recipients *EncryptRecipients) error {
+	data, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode attestation: %w", err)
+	}
+	if err := WriteEncryptedFile(path, append(data, '\n'), recipients); err != nil {
+		return fmt.Errorf("failed to write attestation: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBuildStatement(t *testing.T) {
+	results := []*HashResult{{Algorithm: SHA256, Hash: "abc123", Filename: "app.tar.gz", FileSize: 42}}
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	statement, err := BuildStatement(results, AttestOptions{StartedOn: now, FinishedOn: now})
+	if err != nil {
+		t.Fatalf("BuildStatement failed: %v", err)
+	}
+	if statement.Type != inTotoStatementType || statement.PredicateType != slsaProvenanceType {
+		t.Errorf("Unexpected statement types %s / %s", statement.Type, statement.PredicateType)
+	}
+	if len(statement.Subject) != 1 || statement.Subject[0].Digest["sha256"] != "abc123" {
+		t.Errorf("Unexpected subjects: %+v", statement.Subject)
+	}
+
+	path := filepath.Join(t.TempDir(), "provenance.json")
+	if err := WriteStatement(path, statement, nil); err != nil {
+		t.Fatalf("WriteStatement failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Attestation is not valid JSON: %v", err)
+	}
+	builder := decoded["predicate"].(map[string]any)["runDetails"].(map[string]any)["builder"].(map[string]any)
+	if builder["id"] != defaultBuilderID {
+		t.Errorf("Expected default builder ID, got %v", builder["id"])
+	}
+
+	// A custom predicate requires a predicate type
+	predicatePath := filepath.Join(t.TempDir(), "predicate.json")
+	os.WriteFile(predicatePath, []byte(`{"result":"passed"}`), 0644)
+	if _, err := BuildStatement(results, AttestOptions{PredicatePath: predicatePath}); err == nil {
+		t.Error("Expected error for custom predicate without type")
+	}
+	statement, err = BuildStatement(results, AttestOptions{PredicatePath: predicatePath, PredicateType: "https://example.com/test/v1"})
+	if err != nil || statement.PredicateType != "https://example.com/test/v1" {
+		t.Errorf("Custom predicate not applied (err: %v)", err)
+	}
+}
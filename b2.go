@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// b2API is the Backblaze B2 native API, replaced by -endpoint in tests
+const b2API = "https://api.backblazeb2.com"
+
+// b2Session is an authorized B2 account and the bucket being read
+type b2Session struct {
+	apiURL      string
+	downloadURL string
+	token       string
+	bucketID    string
+}
+
+// authorizeB2 signs in with B2_APPLICATION_KEY_ID and B2_APPLICATION_KEY and
+// looks up the bucket's ID
+func (b *cloudBucket) authorizeB2() error {
+	req, err := http.NewRequest("GET", b.base.String()+"/b2api/v2/b2_authorize_account", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(os.Getenv("B2_APPLICATION_KEY_ID"), os.Getenv("B2_APPLICATION_KEY"))
+	var account struct {
+		AccountID          string `json:"accountId"`
+		AuthorizationToken string `json:"authorizationToken"`
+		APIURL             string `json:"apiUrl"`
+		DownloadURL        string `json:"downloadUrl"`
+		Allowed            struct {
+			BucketID   string `json:"bucketId"`
+			BucketName string `json:"bucketName"`
+		} `json:"allowed"`
+	}
+	if err := b.b2Do(req, &account); err != nil {
+		return fmt.Errorf("failed to authorize with B2: %w", err)
+	}
+	b.b2 = &b2Session{apiURL: account.APIURL, downloadURL: account.DownloadURL, token: account.AuthorizationToken}
+	if account.Allowed.BucketName == b.name {
+		b.b2.bucketID = account.Allowed.BucketID
+		return nil
+	}
+	var listed struct {
+		Buckets []struct {
+			BucketID string `json:"bucketId"`
+		} `json:"buckets"`
+	}
+	if err := b.b2Call("b2_list_buckets", map[string]any{"accountId": account.AccountID, "bucketName": b.name}, &listed); err != nil {
+		return err
+	}
+	if len(listed.Buckets) == 0 {
+		return fmt.Errorf("no B2 bucket named %s", b.name)
+	}
+	b.b2.bucketID = listed.Buckets[0].BucketID
+	return nil
+}
+
+// b2Call posts a request to a B2 API operation and decodes the response into out
+func (b *cloudBucket) b2Call(operation string, body, out any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", b.b2.apiURL+"/b2api/v2/"+operation, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", b.b2.token)
+	if err := b.b2Do(req, out); err != nil {
+		return fmt.Errorf("%s: %w", operation, err)
+	}
+	return nil
+}
+
+// b2Do sends a B2 request and decodes its JSON response, or its error message
+func (b *cloudBucket) b2Do(req *http.Request, out any) error {
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&failure) == nil && failure.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, failure.Message)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// listB2 lists the current versions of the files under prefix with their stored SHA-1
+func (b *cloudBucket) listB2(prefix string) ([]cloudObject, error) {
+	if err := b.authorizeB2(); err != nil {
+		return nil, err
+	}
+	var objects []cloudObject
+	start := ""
+	for {
+		var page struct {
+			Files []struct {
+				FileName        string            `json:"fileName"`
+				ContentLength   int64             `json:"contentLength"`
+				ContentSHA1     string            `json:"contentSha1"`
+				UploadTimestamp int64             `json:"uploadTimestamp"`
+				Action          string            `json:"action"`
+				FileInfo        map[string]string `json:"fileInfo"`
+			} `json:"files"`
+			NextFileName *string `json:"nextFileName"`
+		}
+		request := map[string]any{"bucketId": b.b2.bucketID, "prefix": prefix, "maxFileCount": 1000}
+		if start != "" {
+			request["startFileName"] = start
+		}
+		if err := b.b2Call("b2_list_file_names", request, &page); err != nil {
+			return nil, err
+		}
+		for _, f := range page.Files {
+			if f.Action != "" && f.Action != "upload" {
+				continue
+			}
+			object := cloudObject{Key: f.FileName, Size: f.ContentLength, Modified: time.UnixMilli(f.UploadTimestamp).UTC()}
+			// Large files are stored in parts with a SHA-1 each, and B2 keeps no
+			// whole-file SHA-1 for them; uploaders record it as large_file_sha1
+			sha := strings.TrimPrefix(f.ContentSHA1, "unverified:")
+			if sha == "" || sha == "none" {
+				object.Large, sha = true, f.FileInfo["large_file_sha1"]
+			}
+			object.SHA1 = strings.ToLower(sha)
+			objects = append(objects, object)
+		}
+		if page.NextFileName == nil {
+			return objects, nil
+		}
+		start = *page.NextFileName
+	}
+}
+
+// openB2 streams a file through the B2 download URL
+func (b *cloudBucket) openB2(key string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", b.b2.downloadURL+"/file/"+b.name+"/"+awsURIEncode(key, false), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", b.b2.token)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("downloading %s returned %s", key, resp.Status)
+	}
+	return resp.Body, nil
+}
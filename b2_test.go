@@ -0,0 +1,99 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyB2Objects(t *testing.T) {
+	sha1Hex := func(s string) string { return fmt.Sprintf("%x", sha1.Sum([]byte(s))) }
+	type file struct {
+		data, contentSHA1, largeSHA1 string
+	}
+	files := map[string]file{
+		"backup/a.txt":     {data: "alpha", contentSHA1: sha1Hex("alpha")},
+		"backup/big.bin":   {data: "big file", contentSHA1: "none", largeSHA1: sha1Hex("big file")},
+		"backup/huge.bin":  {data: "huge file", contentSHA1: "none"},
+		"backup/stale.txt": {data: "stale", contentSHA1: "unverified:" + sha1Hex("fresh")},
+	}
+	names := []string{"backup/a.txt", "backup/big.bin", "backup/huge.bin", "backup/stale.txt"}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/file/archive/") {
+			fmt.Fprint(w, files[strings.TrimPrefix(r.URL.Path, "/file/archive/")].data)
+			return
+		}
+		var request map[string]any
+		json.NewDecoder(r.Body).Decode(&request)
+		switch r.URL.Path {
+		case "/b2api/v2/b2_authorize_account":
+			if user, password, _ := r.BasicAuth(); user != "key-id" || password != "key" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"message":"invalid key"}`)
+				return
+			}
+			fmt.Fprintf(w, `{"accountId":"acct","authorizationToken":"token","apiUrl":%q,"downloadUrl":%q}`, server.URL, server.URL)
+		case "/b2api/v2/b2_list_buckets":
+			fmt.Fprint(w, `{"buckets":[{"bucketId":"id1"}]}`)
+		case "/b2api/v2/b2_list_file_names":
+			// Two files per page, to follow nextFileName
+			start := 0
+			for i, name := range names {
+				if name == request["startFileName"] {
+					start = i
+				}
+			}
+			var page []map[string]any
+			for _, name := range names[start:min(start+2, len(names))] {
+				f := files[name]
+				page = append(page, map[string]any{"fileName": name, "contentLength": len(f.data), "contentSha1": f.contentSHA1,
+					"uploadTimestamp": int64(1700000000000), "action": "upload", "fileInfo": map[string]string{"large_file_sha1": f.largeSHA1}})
+			}
+			response := map[string]any{"files": page, "nextFileName": nil}
+			if start+2 < len(names) {
+				response["nextFileName"] = names[start+2]
+			}
+			json.NewEncoder(w).Encode(response)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("B2_APPLICATION_KEY_ID", "key-id")
+	t.Setenv("B2_APPLICATION_KEY", "key")
+	bucket, prefix, err := openCloudBucket("b2://archive/backup", server.URL, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []ManifestEntry
+	for _, name := range names {
+		entries = append(entries, ManifestEntry{Path: strings.TrimPrefix(name, prefix),
+			Checksums: map[HashAlgorithm]string{SHA256: fmt.Sprintf("%x", sha256.Sum256([]byte(files[name].data)))}})
+	}
+	results, err := VerifyCloudObjects(bucket, prefix, entries, 2, nil, func(CloudCheck) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, fmt.Sprintf("%s %s %s", r.Path, r.Status, r.Stored))
+	}
+	want := "a.txt OK verified, big.bin OK verified, huge.bin OK absent, stale.txt FAILED "
+	if strings.Join(got, ", ") != want {
+		t.Errorf("results = %q, want %q", strings.Join(got, ", "), want)
+	}
+
+	t.Setenv("B2_APPLICATION_KEY", "wrong")
+	bucket, _, _ = openCloudBucket("b2://archive/backup", server.URL, "", "")
+	if _, err := VerifyCloudObjects(bucket, prefix, entries, 2, nil, func(CloudCheck) {}); err == nil || !strings.Contains(err.Error(), "invalid key") {
+		t.Errorf("wrong key: err = %v", err)
+	}
+}
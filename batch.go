@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileHashResult is the outcome of hashing one file of a batch: its result,
+// or the error that stopped it
+type FileHashResult struct {
+	Path   string
+	Result *HashResult
+	Err    error
+}
+
+// CalculateFileHashes hashes each file in turn, carrying on past those that
+// fail, and returns one result per path in the order given
+func (hc *HashCalculator) CalculateFileHashes(paths []string, algorithm HashAlgorithm) []FileHashResult {
+	hc.Warm.start(paths)
+	results := make([]FileHashResult, len(paths))
+	for i, path := range paths {
+		results[i].Path = path
+		results[i].Result, results[i].Err = hc.CalculateFileHash(path, algorithm, nil)
+	}
+	return results
+}
+
+// expandGlobs replaces shell-style patterns among args with the files they
+// match, in lexical order, for shells such as cmd.exe that pass them on
+// unexpanded. Like a shell, it keeps a pattern that matches nothing, which
+// then fails as a missing file; URLs and names of existing files are kept too.
+func expandGlobs(args []string) ([]string, error) {
+	var expanded []string
+	for _, arg := range args {
+		if isURL(arg) || !strings.ContainsAny(arg, "*?[") {
+			expanded = append(expanded, arg)
+			continue
+		}
+		if _, err := os.Lstat(arg); err == nil {
+			expanded = append(expanded, arg)
+			continue
+		}
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", arg, err)
+		}
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// batchOutput writes the results of a batch as each file finishes, so trees
+// of any size stream out: a text block per file and a closing count, or the
+// elements of a JSON array. show gives the digest as displayed, which
+// -truncate, -uri and -multihash change.
+type batchOutput struct {
+	w      io.Writer
+	json   bool
+	show   func(*HashResult) HashResult
+	files  int
+	failed int
+}
+
+// batchJSONFailure is the -output json entry of a file that could not be hashed
+type batchJSONFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// Write adds the result of the next file
+func (o *batchOutput) Write(r FileHashResult) error {
+	o.files++
+	if r.Err != nil {
+		o.failed++
+	}
+	if o.json {
+		return o.writeJSON(r)
+	}
+	w := o.w
+	fmt.Fprintln(w, "="+strings.Repeat("=", 50))
+	if r.Err != nil {
+		fmt.Fprintf(w, "File: %s\n", outputPath(r.Path))
+		_, err := fmt.Fprintf(w, "Error: %v\n", r.Err)
+		return err
+	}
+	shown := o.show(r.Result)
+	fmt.Fprintf(w, "File: %s\n", r.Result.Filename)
+	if r.Result.Path != "" && r.Result.Path != r.Result.Filename {
+		fmt.Fprintf(w, "Path: %s\n", outputPath(r.Result.Path))
+	}
+	fmt.Fprintf(w, "Size: %s\n", formatBytes(r.Result.FileSize))
+	fmt.Fprintf(w, "Algorithm: %s\n", getAlgorithmName(r.Result.Algorithm))
+	_, err := fmt.Fprintf(w, "Hash: %s\n", shown.Hash)
+	if shown.UUID != "" {
+		_, err = fmt.Fprintf(w, "UUID: %s\n", shown.UUID)
+	}
+	return err
+}
+
+// writeJSON writes one element of the array, indented as a whole encoded array would be
+func (o *batchOutput) writeJSON(r FileHashResult) error {
+	var entry any
+	if r.Err != nil {
+		entry = batchJSONFailure{File: outputPath(r.Path), Error: r.Err.Error()}
+	} else {
+		shown := o.show(r.Result)
+		entry = jsonReport(&shown, nil)
+	}
+	data, err := json.MarshalIndent(entry, "  ", "  ")
+	if err != nil {
+		return err
+	}
+	separator := ",\n  "
+	if o.files == 1 {
+		separator = "[\n  "
+	}
+	_, err = fmt.Fprintf(o.w, "%s%s", separator, data)
+	return err
+}
+
+// Close ends the output once every file is done
+func (o *batchOutput) Close() error {
+	if o.json {
+		end := "\n]\n"
+		if o.files == 0 {
+			end = "[]\n"
+		}
+		_, err := io.WriteString(o.w, end)
+		return err
+	}
+	if o.files > 0 {
+		fmt.Fprintln(o.w, "="+strings.Repeat("=", 50))
+		fmt.Fprintln(o.w)
+	}
+	fmt.Fprintf(o.w, "Hashed %d of %d file(s)", o.files-o.failed, o.files)
+	if o.failed > 0 {
+		fmt.Fprintf(o.w, ", %d failed", o.failed)
+	}
+	_, err := fmt.Fprintln(o.w)
+	return err
+}
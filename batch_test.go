@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCalculateFileHashes(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.iso"), filepath.Join(dir, "b.iso")
+	os.WriteFile(first, []byte("a"), 0644)
+	os.WriteFile(second, []byte("b"), 0644)
+	missing := filepath.Join(dir, "missing.bin")
+
+	results := NewHashCalculator().CalculateFileHashes([]string{first, missing, second}, SHA256)
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Err != nil {
+		t.Fatalf("Results = %+v, want the missing file alone to fail", results)
+	}
+	if results[0].Result.Hash != "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb" || results[1].Path != missing {
+		t.Errorf("Results out of order: %+v", results)
+	}
+}
+
+func TestBatchOutput(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "a.iso"), filepath.Join(dir, "b.iso")
+	os.WriteFile(first, []byte("a"), 0644)
+	os.WriteFile(second, []byte("b"), 0644)
+	missing := filepath.Join(dir, "missing.bin")
+
+	calc := NewHashCalculator()
+	var results []FileHashResult
+	for _, path := range []string{first, missing, second} {
+		r := FileHashResult{Path: path}
+		r.Result, r.Err = calc.CalculateFileHash(path, SHA256, nil)
+		results = append(results, r)
+	}
+
+	var text strings.Builder
+	out := &batchOutput{w: &text, show: func(r *HashResult) HashResult { return *r }}
+	for _, r := range results {
+		out.Write(r)
+	}
+	out.Close()
+	if !strings.Contains(text.String(), "Error: failed to open file") || !strings.HasSuffix(text.String(), "Hashed 2 of 3 file(s), 1 failed\n") {
+		t.Errorf("Unexpected batch output:\n%s", text.String())
+	}
+
+	// Streamed elements must read back as the array a single encode would give
+	var streamed, encoded strings.Builder
+	out = &batchOutput{w: &streamed, json: true, show: out.show}
+	var entries []any
+	for _, r := range results {
+		out.Write(r)
+		if r.Err != nil {
+			entries = append(entries, batchJSONFailure{File: r.Path, Error: r.Err.Error()})
+		} else {
+			entries = append(entries, jsonReport(r.Result, nil))
+		}
+	}
+	out.Close()
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(entries)
+	if streamed.String() != encoded.String() {
+		t.Errorf("Streamed JSON:\n%s\nwant:\n%s", streamed.String(), encoded.String())
+	}
+	if out.files != 3 || out.failed != 1 {
+		t.Errorf("Counted %d file(s), %d failed; want 3 and 1", out.files, out.failed)
+	}
+}
+
+func TestExpandGlobs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.iso", "a.iso", "notes.txt", "odd[1].iso"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	got, err := expandGlobs([]string{
+		filepath.Join(dir, "*.iso"),
+		filepath.Join(dir, "notes.txt"),
+		filepath.Join(dir, "odd[1].iso"), // an existing name is not a pattern
+		filepath.Join(dir, "*.bin"),      // no match stays, to fail as missing
+		"https://example.com/*.iso",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "a.iso"), filepath.Join(dir, "b.iso"), filepath.Join(dir, "odd[1].iso"),
+		filepath.Join(dir, "notes.txt"),
+		filepath.Join(dir, "odd[1].iso"),
+		filepath.Join(dir, "*.bin"),
+		"https://example.com/*.iso",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expandGlobs = %q, want %q", got, want)
+	}
+}
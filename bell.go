@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// bellFlag removes -bell from a command's arguments, so every command can
+// ring when it finishes without declaring the flag itself
+func bellFlag(args []string) ([]string, bool) {
+	var rest []string
+	bell := false
+	for i, arg := range args {
+		if arg == "--" {
+			return append(rest, args[i:]...), bell
+		}
+		if arg == "-bell" || arg == "--bell" || arg == "-bell=true" || arg == "--bell=true" {
+			bell = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+	return rest, bell
+}
+
+// ringBell rings the terminal bell once when an operation finished and three
+// times when it failed. Without a terminal, as in a background job whose
+// output goes to a file, the system sound is played instead.
+func ringBell(failed bool) {
+	rings := 1
+	if failed {
+		rings = 3
+	}
+	for _, f := range []*os.File{os.Stderr, os.Stdout} {
+		if !isTerminal(f) {
+			continue
+		}
+		for i := 0; i < rings; i++ {
+			if i > 0 {
+				// Terminals merge bells that arrive together
+				time.Sleep(200 * time.Millisecond)
+			}
+			fmt.Fprint(f, "\a")
+		}
+		return
+	}
+	playSystemSound(failed)
+}
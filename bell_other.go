@@ -0,0 +1,48 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// systemSound is a player and its arguments for success and failure sounds
+type systemSound struct {
+	player           string
+	success, failure []string
+}
+
+// systemSounds are tried in order until a player and its sound file exist
+var systemSounds = map[string][]systemSound{
+	"darwin": {
+		{"afplay", []string{"/System/Library/Sounds/Glass.aiff"}, []string{"/System/Library/Sounds/Basso.aiff"}},
+	},
+	"linux": {
+		{"paplay", []string{"/usr/share/sounds/freedesktop/stereo/complete.oga"}, []string{"/usr/share/sounds/freedesktop/stereo/dialog-error.oga"}},
+		{"canberra-gtk-play", []string{"-i", "complete"}, []string{"-i", "dialog-error"}},
+	},
+}
+
+// playSystemSound plays the desktop's completion or error sound. Nothing is
+// played where no player is installed.
+func playSystemSound(failed bool) {
+	for _, sound := range systemSounds[runtime.GOOS] {
+		args := sound.success
+		if failed {
+			args = sound.failure
+		}
+		if _, err := exec.LookPath(sound.player); err != nil {
+			continue
+		}
+		if last := args[len(args)-1]; filepath.IsAbs(last) {
+			if _, err := os.Stat(last); err != nil {
+				continue
+			}
+		}
+		exec.Command(sound.player, args...).Run()
+		return
+	}
+}
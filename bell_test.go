@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBellFlag(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		rest string
+		bell bool
+	}{
+		{[]string{"-bell", "verify", "a.txt"}, "[verify a.txt]", true},
+		{[]string{"-recursive", "--bell=true", "dir"}, "[-recursive dir]", true},
+		{[]string{"-recursive", "dir"}, "[-recursive dir]", false},
+		{[]string{"run", "--", "-bell"}, "[run -- -bell]", false},
+	} {
+		rest, bell := bellFlag(tc.args)
+		if fmt.Sprint(rest) != tc.rest || bell != tc.bell {
+			t.Errorf("bellFlag(%q) = %v, %v; want %s, %v", tc.args, rest, bell, tc.rest, tc.bell)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+var procMessageBeep = syscall.NewLazyDLL("user32.dll").NewProc("MessageBeep")
+
+// playSystemSound plays the Windows notification or error sound
+func playSystemSound(failed bool) {
+	const mbIconAsterisk, mbIconHand = 0x40, 0x10
+	sound := uintptr(mbIconAsterisk)
+	if failed {
+		sound = mbIconHand
+	}
+	procMessageBeep.Call(sound)
+}
@@ -0,0 +1,50 @@
+// Example use of libhashculate:
+//
+//   go build -buildmode=c-shared -o libhashculate.so ./capi
+//   cc -o example capi/example/example.c -I. -L. -lhashculate
+//   LD_LIBRARY_PATH=. ./example <file>
+#include <stdio.h>
+#include "libhashculate.h"
+
+static void on_progress(double progress, void *user_data) {
+	fprintf(stderr, "\r%s: %3.0f%%", (const char *)user_data, progress * 100);
+}
+
+static long long read_file(void *user_data, char *buf, long long len) {
+	FILE *f = user_data;
+	size_t n = fread(buf, 1, (size_t)len, f);
+	return ferror(f) ? -1 : (long long)n;
+}
+
+int main(int argc, char **argv) {
+	if (argc != 2) {
+		fprintf(stderr, "usage: %s <file>\n", argv[0]);
+		return 1;
+	}
+	char *err = NULL;
+	char *json = hashculate_hash_file(argv[1], "sha256,md5", "json", on_progress, argv[1], &err);
+	fprintf(stderr, "\n");
+	if (!json) {
+		fprintf(stderr, "error: %s\n", err);
+		hashculate_free(err);
+		return 1;
+	}
+	printf("%s\n", json);
+	hashculate_free(json);
+
+	FILE *f = fopen(argv[1], "rb");
+	if (!f) {
+		perror(argv[1]);
+		return 1;
+	}
+	char *text = hashculate_hash_stream(read_file, f, argv[1], -1, "sha256", "text", NULL, NULL, &err);
+	fclose(f);
+	if (!text) {
+		fprintf(stderr, "error: %s\n", err);
+		hashculate_free(err);
+		return 1;
+	}
+	printf("%s\n", text);
+	hashculate_free(text);
+	return 0;
+}
@@ -0,0 +1,168 @@
+//go:build cgo
+
+// Command capi builds libhashculate, a C shared library exposing the hasher
+// package with the CLI's output formats:
+//
+//	go build -buildmode=c-shared -o libhashculate.so ./capi
+//
+// Results and errors are strings allocated by the library and released with
+// hashculate_free.
+package main
+
+/*
+#include <stdlib.h>
+
+// hashculate_progress_fn receives the fraction hashed so far, between 0 and 1
+typedef void (*hashculate_progress_fn)(double progress, void *user_data);
+
+// hashculate_read_fn fills buf with up to len bytes and returns the count,
+// 0 at end of stream or -1 on error
+typedef long long (*hashculate_read_fn)(void *user_data, char *buf, long long len);
+
+static void call_progress(hashculate_progress_fn fn, double progress, void *user_data) {
+	if (fn) {
+		fn(progress, user_data);
+	}
+}
+
+static long long call_read(hashculate_read_fn fn, void *user_data, char *buf, long long len) {
+	return fn(user_data, buf, len);
+}
+*/
+import "C"
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"hashculate/hasher"
+)
+
+// callbackReader reads from a hashculate_read_fn
+type callbackReader struct {
+	read     C.hashculate_read_fn
+	userData unsafe.Pointer
+}
+
+func (r *callbackReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n := C.call_read(r.read, r.userData, (*C.char)(unsafe.Pointer(&p[0])), C.longlong(len(p)))
+	switch {
+	case n < 0:
+		return 0, errors.New("read callback failed")
+	case n == 0:
+		return 0, io.EOF
+	}
+	return int(n), nil
+}
+
+// hash streams r and renders the digests in format: hash (one digest per
+// line), text (the CLI description) or json (the -output json document, an
+// array for several algorithms)
+func hash(r io.Reader, name string, size int64, algorithms, format string, progress C.hashculate_progress_fn, userData unsafe.Pointer) (string, error) {
+	if algorithms == "" {
+		algorithms = "sha256"
+	}
+	var algs []hasher.Algorithm
+	for _, name := range strings.Split(algorithms, ",") {
+		alg, err := hasher.Parse(strings.TrimSpace(name))
+		if err != nil {
+			return "", err
+		}
+		algs = append(algs, alg)
+	}
+	digests, n, err := hasher.HashReader(r, algs, 0, size, func(p float64) {
+		C.call_progress(progress, C.double(p), userData)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	switch format {
+	case "", "hash":
+		var lines []string
+		for _, digest := range digests {
+			lines = append(lines, digest.Hash)
+		}
+		return strings.Join(lines, "\n"), nil
+	case "text":
+		var lines []string
+		for _, digest := range digests {
+			lines = append(lines, hasher.Describe(name, n, digest.Algorithm, digest.Hash))
+		}
+		return strings.Join(lines, "\n"), nil
+	case "json":
+		reports := make([]hasher.Report, len(digests))
+		for i, digest := range digests {
+			reports[i] = hasher.Report{File: name, Size: n, Algorithm: digest.Algorithm, Hash: digest.Hash}
+		}
+		var data []byte
+		if len(reports) == 1 {
+			data, err = json.MarshalIndent(reports[0], "", "  ")
+		} else {
+			data, err = json.MarshalIndent(reports, "", "  ")
+		}
+		return string(data), err
+	default:
+		return "", errors.New("unsupported format: " + format + ". Supported: hash, text, json")
+	}
+}
+
+// result returns output as a C string, or NULL with *errOut set on failure
+func result(output string, err error, errOut **C.char) *C.char {
+	if err != nil {
+		if errOut != nil {
+			*errOut = C.CString(err.Error())
+		}
+		return nil
+	}
+	return C.CString(output)
+}
+
+// hashculate_hash_file hashes the file at path with comma-separated
+// algorithms (NULL for sha256) and returns it rendered in format (NULL for hash)
+//
+//export hashculate_hash_file
+func hashculate_hash_file(path, algorithms, format *C.char, progress C.hashculate_progress_fn, userData unsafe.Pointer, errOut **C.char) *C.char {
+	filename := C.GoString(path)
+	file, err := os.Open(filename)
+	if err != nil {
+		return result("", err, errOut)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return result("", err, errOut)
+	}
+	output, err := hash(file, filepath.Base(filename), info.Size(), C.GoString(algorithms), C.GoString(format), progress, userData)
+	return result(output, err, errOut)
+}
+
+// hashculate_hash_stream hashes the bytes returned by read. name labels the
+// text and json output and size (-1 when unknown) drives progress.
+//
+//export hashculate_hash_stream
+func hashculate_hash_stream(read C.hashculate_read_fn, readData unsafe.Pointer, name *C.char, size C.longlong, algorithms, format *C.char, progress C.hashculate_progress_fn, userData unsafe.Pointer, errOut **C.char) *C.char {
+	if read == nil {
+		return result("", errors.New("read callback is required"), errOut)
+	}
+	reader := &callbackReader{read: read, userData: readData}
+	output, err := hash(reader, C.GoString(name), int64(size), C.GoString(algorithms), C.GoString(format), progress, userData)
+	return result(output, err, errOut)
+}
+
+// hashculate_free releases a string returned by the library
+//
+//export hashculate_free
+func hashculate_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
+
+func main() {}
@@ -0,0 +1,105 @@
+//go:build cgo
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hashculate/hasher"
+)
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download.bin")
+	os.WriteFile(path, []byte("hello world"), 0644)
+
+	r := testHashFile(path, "", "", true)
+	if r.Null || r.Output != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" || r.Err != "" {
+		t.Errorf("Unexpected default result: %+v", r)
+	}
+	if r.ProgressCalls == 0 || r.Progress != 1 {
+		t.Errorf("Expected progress to reach 1, got %v after %d calls", r.Progress, r.ProgressCalls)
+	}
+
+	r = testHashFile(path, "sha256, md5", "text", true)
+	lines := strings.Split(r.Output, "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "5eb63bbbe01eeed093cb22bb8f5acdc3") || !strings.Contains(lines[0], `"download.bin"`) {
+		t.Errorf("Unexpected text result: %q", r.Output)
+	}
+
+	r = testHashFile(path, "md5", "json", true)
+	if !strings.HasPrefix(r.Output, "{") || !strings.Contains(r.Output, `"hash": "5eb63bbbe01eeed093cb22bb8f5acdc3"`) {
+		t.Errorf("Unexpected JSON result: %s", r.Output)
+	}
+	if r = testHashFile(path, "sha256,md5", "json", true); !strings.HasPrefix(r.Output, "[") {
+		t.Errorf("Expected an array for several algorithms: %s", r.Output)
+	}
+}
+
+func TestHashFileErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download.bin")
+	os.WriteFile(path, []byte("hello world"), 0644)
+
+	for _, tc := range []struct {
+		name, path, algorithms, format, want string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing"), "", "", "no such file"},
+		{"unknown algorithm", path, "crc32", "", "crc32"},
+		{"unknown format", path, "", "xml", "unsupported format: xml"},
+	} {
+		r := testHashFile(tc.path, tc.algorithms, tc.format, true)
+		if !r.Null || r.Output != "" || !strings.Contains(r.Err, tc.want) {
+			t.Errorf("%s: expected NULL and an error containing %q, got %+v", tc.name, tc.want, r)
+		}
+		// Callers may pass NULL when they do not want the message
+		if r := testHashFile(tc.path, tc.algorithms, tc.format, false); !r.Null || r.Err != "" {
+			t.Errorf("%s: unexpected result without an error pointer: %+v", tc.name, r)
+		}
+	}
+}
+
+func TestHashStream(t *testing.T) {
+	// Several buffers' worth, returned in short reads
+	data := bytes.Repeat([]byte("0123456789abcdef"), hasher.DefaultChunkSize/8+3)
+	sum := sha256.Sum256(data)
+	want := hex.EncodeToString(sum[:])
+
+	for _, chunk := range []int64{0, 4093} {
+		r := testHashStream(testSource{Data: data, Chunk: chunk}, "stream.bin", int64(len(data)), "sha256", "")
+		if r.Null || r.Output != want {
+			t.Errorf("chunk %d: expected %s, got %+v", chunk, want, r)
+		}
+		if r.MaxRequest != hasher.DefaultChunkSize {
+			t.Errorf("chunk %d: expected reads of at most %d bytes, got %d", chunk, hasher.DefaultChunkSize, r.MaxRequest)
+		}
+		if r.Progress != 1 {
+			t.Errorf("chunk %d: expected progress to reach 1, got %v", chunk, r.Progress)
+		}
+	}
+
+	r := testHashStream(testSource{Data: []byte("hello world")}, "download.bin", -1, "md5", "text")
+	if !strings.Contains(r.Output, `"download.bin", with size of 11 bytes`) {
+		t.Errorf("Unexpected text result for an unknown size: %q", r.Output)
+	}
+
+	if r := testHashStream(testSource{}, "empty", 0, "sha256", ""); r.Output != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("Unexpected empty stream result: %+v", r)
+	}
+}
+
+func TestHashStreamErrors(t *testing.T) {
+	r := testHashStream(testSource{Data: []byte("hello"), Fail: true}, "stream", 5, "sha256", "")
+	if !r.Null || !strings.Contains(r.Err, "read callback failed") {
+		t.Errorf("Expected a failed read to be reported, got %+v", r)
+	}
+	if r := testHashStreamNoReader(); !r.Null || r.Err != "read callback is required" {
+		t.Errorf("Expected a missing read callback to be reported, got %+v", r)
+	}
+	// hashculate_free accepts NULL, as free does
+	hashculate_free(nil)
+}
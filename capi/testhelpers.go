@@ -0,0 +1,152 @@
+//go:build cgo
+
+package main
+
+// Test files cannot use cgo, so main_test.go drives the exported functions
+// through these helpers, with C callbacks reading from a buffer in C memory.
+
+/*
+#include <stdlib.h>
+#include <string.h>
+
+typedef struct {
+	const char *data;
+	long long len;
+	long long pos;
+	long long chunk;      // largest read to return, 0 for the whole request
+	long long max_request; // largest len passed to the read callback
+	int fail;              // return -1 instead of the first chunk
+	double progress;       // last progress reported
+	int progress_calls;
+} test_source;
+
+static long long test_read(void *user_data, char *buf, long long len) {
+	test_source *src = user_data;
+	if (len > src->max_request) {
+		src->max_request = len;
+	}
+	if (src->fail) {
+		return -1;
+	}
+	long long n = src->len - src->pos;
+	if (n > len) {
+		n = len;
+	}
+	if (src->chunk > 0 && n > src->chunk) {
+		n = src->chunk;
+	}
+	memcpy(buf, src->data + src->pos, n);
+	src->pos += n;
+	return n;
+}
+
+static void test_progress(double progress, void *user_data) {
+	test_source *src = user_data;
+	src->progress = progress;
+	src->progress_calls++;
+}
+
+// Go can only take the address of a static function through C
+static void *test_read_fn(void) { return (void *)test_read; }
+static void *test_progress_fn(void) { return (void *)test_progress; }
+*/
+import "C"
+
+import "unsafe"
+
+// callResult is what an exported function returned
+type callResult struct {
+	Output        string
+	Err           string
+	Null          bool    // NULL was returned
+	MaxRequest    int64   // largest buffer the read callback was asked to fill
+	Progress      float64 // last progress reported
+	ProgressCalls int
+}
+
+// testSource describes the stream passed to hashculate_hash_stream
+type testSource struct {
+	Data  []byte
+	Chunk int64 // largest read to return, 0 for the whole request
+	Fail  bool  // fail the first read
+}
+
+// takeResult copies and frees the strings returned by a call
+func takeResult(output, errOut *C.char) callResult {
+	var r callResult
+	if output == nil {
+		r.Null = true
+	} else {
+		r.Output = C.GoString(output)
+		hashculate_free(output)
+	}
+	if errOut != nil {
+		r.Err = C.GoString(errOut)
+		hashculate_free(errOut)
+	}
+	return r
+}
+
+// cStrings converts strings to C, with "" as NULL, and returns a function freeing them
+func cStrings(values ...string) ([]*C.char, func()) {
+	out := make([]*C.char, len(values))
+	for i, value := range values {
+		if value != "" {
+			out[i] = C.CString(value)
+		}
+	}
+	return out, func() {
+		for _, s := range out {
+			C.free(unsafe.Pointer(s))
+		}
+	}
+}
+
+// testHashFile calls hashculate_hash_file, optionally without an error pointer
+func testHashFile(path, algorithms, format string, withErr bool) callResult {
+	args, free := cStrings(path, algorithms, format)
+	defer free()
+	src := (*C.test_source)(C.calloc(1, C.sizeof_test_source))
+	defer C.free(unsafe.Pointer(src))
+
+	var errOut *C.char
+	errPtr := &errOut
+	if !withErr {
+		errPtr = nil
+	}
+	output := hashculate_hash_file(args[0], args[1], args[2], (*[0]byte)(C.test_progress_fn()), unsafe.Pointer(src), errPtr)
+	r := takeResult(output, errOut)
+	r.Progress, r.ProgressCalls = float64(src.progress), int(src.progress_calls)
+	return r
+}
+
+// testHashStream calls hashculate_hash_stream with a read callback over source
+func testHashStream(source testSource, name string, size int64, algorithms, format string) callResult {
+	args, free := cStrings(name, algorithms, format)
+	defer free()
+	src := (*C.test_source)(C.calloc(1, C.sizeof_test_source))
+	defer C.free(unsafe.Pointer(src))
+	if len(source.Data) > 0 {
+		src.data = (*C.char)(C.CBytes(source.Data))
+		defer C.free(unsafe.Pointer(src.data))
+	}
+	src.len = C.longlong(len(source.Data))
+	src.chunk = C.longlong(source.Chunk)
+	if source.Fail {
+		src.fail = 1
+	}
+
+	var errOut *C.char
+	output := hashculate_hash_stream((*[0]byte)(C.test_read_fn()), unsafe.Pointer(src), args[0], C.longlong(size), args[1], args[2], (*[0]byte)(C.test_progress_fn()), unsafe.Pointer(src), &errOut)
+	r := takeResult(output, errOut)
+	r.MaxRequest = int64(src.max_request)
+	r.Progress, r.ProgressCalls = float64(src.progress), int(src.progress_calls)
+	return r
+}
+
+// testHashStreamNoReader calls hashculate_hash_stream without a read callback
+func testHashStreamNoReader() callResult {
+	var errOut *C.char
+	output := hashculate_hash_stream(nil, nil, nil, -1, nil, nil, nil, nil, &errOut)
+	return takeResult(output, errOut)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// ChaCha20-Poly1305 (RFC 8439), which age requires and the standard library
+// does not export
+
+const (
+	chachaKeySize   = 32
+	chachaNonceSize = 12
+	poly1305TagSize = 16
+)
+
+// chachaBlock computes one 64-byte ChaCha20 keystream block
+func chachaBlock(key *[8]uint32, counter uint32, nonce *[3]uint32, out *[64]byte) {
+	state := [16]uint32{
+		0x61707865, 0x3320646e, 0x79622d32, 0x6b206574,
+		key[0], key[1], key[2], key[3], key[4], key[5], key[6], key[7],
+		counter, nonce[0], nonce[1], nonce[2],
+	}
+	x := state
+	quarter := func(a, b, c, d int) {
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+		x[a] += x[b]
+		x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+		x[c] += x[d]
+		x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+	}
+	for i := 0; i < 10; i++ {
+		quarter(0, 4, 8, 12)
+		quarter(1, 5, 9, 13)
+		quarter(2, 6, 10, 14)
+		quarter(3, 7, 11, 15)
+		quarter(0, 5, 10, 15)
+		quarter(1, 6, 11, 12)
+		quarter(2, 7, 8, 13)
+		quarter(3, 4, 9, 14)
+	}
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[4*i:], x[i]+state[i])
+	}
+}
+
+// chachaXOR encrypts or decrypts src into dst starting at the given block counter
+func chachaXOR(key, nonce []byte, counter uint32, dst, src []byte) {
+	var k [8]uint32
+	var n [3]uint32
+	for i := range k {
+		k[i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	for i := range n {
+		n[i] = binary.LittleEndian.Uint32(nonce[4*i:])
+	}
+	var block [64]byte
+	for len(src) > 0 {
+		chachaBlock(&k, counter, &n, &block)
+		counter++
+		m := min(len(src), 64)
+		subtle.XORBytes(dst[:m], src[:m], block[:m])
+		dst, src = dst[m:], src[m:]
+	}
+}
+
+// poly1305 computes the one-time authenticator of msg under a 32-byte key
+func poly1305(key []byte, msg []byte) [poly1305TagSize]byte {
+	r0 := binary.LittleEndian.Uint64(key[0:]) & 0x0ffffffc0fffffff
+	r1 := binary.LittleEndian.Uint64(key[8:]) & 0x0ffffffc0ffffffc
+	s0 := binary.LittleEndian.Uint64(key[16:])
+	s1 := binary.LittleEndian.Uint64(key[24:])
+
+	var h0, h1, h2 uint64
+	for len(msg) > 0 {
+		var block [16]byte
+		var hibit uint64 = 1
+		n := copy(block[:], msg)
+		if n < 16 {
+			block[n] = 1
+			hibit = 0
+		}
+		msg = msg[n:]
+
+		var c uint64
+		h0, c = bits.Add64(h0, binary.LittleEndian.Uint64(block[0:]), 0)
+		h1, c = bits.Add64(h1, binary.LittleEndian.Uint64(block[8:]), c)
+		h2 += c + hibit
+
+		// h * r, where h2 is small and r is clamped, so partial products fit
+		h0r0hi, h0r0lo := bits.Mul64(h0, r0)
+		h1r0hi, h1r0lo := bits.Mul64(h1, r0)
+		h0r1hi, h0r1lo := bits.Mul64(h0, r1)
+		h1r1hi, h1r1lo := bits.Mul64(h1, r1)
+		h2r0 := h2 * r0
+		h2r1 := h2 * r1
+
+		t0 := h0r0lo
+		t1, c := bits.Add64(h1r0lo, h0r1lo, 0)
+		t2 := h1r0hi + h0r1hi + c
+		t1, c = bits.Add64(t1, h0r0hi, 0)
+		t2, c2 := bits.Add64(t2, h1r1lo, c)
+		t3 := h1r1hi + c2
+		t2, c = bits.Add64(t2, h2r0, 0)
+		t3 += h2r1 + c
+
+		// Reduce modulo 2^130 - 5: h = low 130 bits + 5 * (t >> 130)
+		h0, h1, h2 = t0, t1, t2&3
+		cc0, cc1 := t2&^3, t3
+		h0, c = bits.Add64(h0, cc0, 0)
+		h1, c = bits.Add64(h1, cc1, c)
+		h2 += c
+		cc0 = cc0>>2 | cc1<<62
+		cc1 >>= 2
+		h0, c = bits.Add64(h0, cc0, 0)
+		h1, c = bits.Add64(h1, cc1, c)
+		h2 += c
+	}
+
+	// Final reduction: subtract p if h >= p
+	g0, b := bits.Sub64(h0, 0xfffffffffffffffb, 0)
+	g1, b := bits.Sub64(h1, 0xffffffffffffffff, b)
+	_, b = bits.Sub64(h2, 3, b)
+	if b == 0 {
+		h0, h1 = g0, g1
+	}
+	var c uint64
+	h0, c = bits.Add64(h0, s0, 0)
+	h1, _ = bits.Add64(h1, s1, c)
+
+	var tag [poly1305TagSize]byte
+	binary.LittleEndian.PutUint64(tag[0:], h0)
+	binary.LittleEndian.PutUint64(tag[8:], h1)
+	return tag
+}
+
+// chachaPolyMAC authenticates additional data and ciphertext as RFC 8439 section 2.8 specifies
+func chachaPolyMAC(key, nonce, ciphertext, additionalData []byte) [poly1305TagSize]byte {
+	var polyKey [64]byte
+	chachaXOR(key, nonce, 0, polyKey[:], polyKey[:])
+	pad := func(b []byte) []byte { return append(b, make([]byte, (16-len(b)%16)%16)...) }
+	data := pad(append([]byte(nil), additionalData...))
+	data = pad(append(data, ciphertext...))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(additionalData)))
+	data = binary.LittleEndian.AppendUint64(data, uint64(len(ciphertext)))
+	return poly1305(polyKey[:32], data)
+}
+
+// chachaPolySeal encrypts and authenticates plaintext
+func chachaPolySeal(key, nonce, plaintext, additionalData []byte) []byte {
+	out := make([]byte, len(plaintext), len(plaintext)+poly1305TagSize)
+	chachaXOR(key, nonce, 1, out, plaintext)
+	tag := chachaPolyMAC(key, nonce, out, additionalData)
+	return append(out, tag[:]...)
+}
+
+// chachaPolyOpen authenticates and decrypts ciphertext
+func chachaPolyOpen(key, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(ciphertext) < poly1305TagSize {
+		return nil, errors.New("chacha20poly1305: ciphertext too short")
+	}
+	body, tag := ciphertext[:len(ciphertext)-poly1305TagSize], ciphertext[len(ciphertext)-poly1305TagSize:]
+	expected := chachaPolyMAC(key, nonce, body, additionalData)
+	if subtle.ConstantTimeCompare(expected[:], tag) != 1 {
+		return nil, errors.New("chacha20poly1305: message authentication failed")
+	}
+	out := make([]byte, len(body))
+	chachaXOR(key, nonce, 1, out, body)
+	return out, nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ChainEntry is a single file result recorded in a chain record
+type ChainEntry struct {
+	File      string        `json:"file"`
+	Path      string        `json:"path,omitempty"`
+	Size      int64         `json:"size"`
+	Algorithm HashAlgorithm `json:"algorithm"`
+	Hash      string        `json:"hash"`
+}
+
+// ChainRecord is one link of a tamper-evident, append-only log of scan reports.
+// Each record carries the digest of the record before it, so editing, removing
+// or reordering earlier records breaks every link that follows. The optional
+// timestamp is an RFC 3161 response covering the record digest.
+type ChainRecord struct {
+	Seq       int64        `json:"seq"`
+	Time      string       `json:"time"`
+	Prev      string       `json:"prev"`
+	Results   []ChainEntry `json:"results"`
+	Report    *ChainReport `json:"report,omitempty"` // A verification report, written with -report worm
+	Digest    string       `json:"digest"`
+	Timestamp []byte       `json:"timestamp,omitempty"`
+}
+
+// computeDigest returns the SHA-256 of the record encoded without digest and timestamp
+func (cr *ChainRecord) computeDigest() (string, error) {
+	unsigned := *cr
+	unsigned.Digest = ""
+	unsigned.Timestamp = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode chain record: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readChain loads all records from a chain log, or from the objects of an
+// s3:// chain; a missing log is an empty chain
+func readChain(path string) ([]ChainRecord, error) {
+	if strings.HasPrefix(path, "s3://") {
+		return readS3Chain(path)
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open chain log: %w", err)
+	}
+	defer file.Close()
+
+	var records []ChainRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record ChainRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("chain log line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chain log: %w", err)
+	}
+	return records, nil
+}
+
+// verifyRecords checks the digest of every record and the links between them
+func verifyRecords(records []ChainRecord) error {
+	prev := ""
+	for i := range records {
+		record := &records[i]
+		if record.Seq != int64(i+1) {
+			return fmt.Errorf("record %d: unexpected sequence number %d", i+1, record.Seq)
+		}
+		if record.Prev != prev {
+			return fmt.Errorf("record %d: previous digest does not match record %d", record.Seq, record.Seq-1)
+		}
+		digest, err := record.computeDigest()
+		if err != nil {
+			return err
+		}
+		if digest != record.Digest {
+			return fmt.Errorf("record %d: digest mismatch, record has been modified", record.Seq)
+		}
+		if len(record.Timestamp) > 0 {
+			token, err := ParseTimestampResponse(record.Timestamp)
+			if err != nil {
+				return fmt.Errorf("record %d: %w", record.Seq, err)
+			}
+			raw, _ := hex.DecodeString(record.Digest)
+			if err := token.VerifyDigest(SHA256, raw); err != nil {
+				return fmt.Errorf("record %d: %w", record.Seq, err)
+			}
+		}
+		prev = record.Digest
+	}
+	return nil
+}
+
+// VerifyChain verifies a chain log and returns the number of records it contains
+func VerifyChain(path string) (int, error) {
+	records, err := readChain(path)
+	if err != nil {
+		return 0, err
+	}
+	if err := verifyRecords(records); err != nil {
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// AppendChainRecord appends the results as a new record linked to the last one.
+// The existing chain is verified first so a broken log is never extended. When
+// tsaURL is set the record digest is timestamped by that TSA.
+func AppendChainRecord(path string, results []*HashResult, tsaURL string) (*ChainRecord, error) {
+	record := &ChainRecord{}
+	for _, result := range results {
+		record.Results = append(record.Results, ChainEntry{
+			File:      result.Filename,
+			Path:      result.Path,
+			Size:      result.FileSize,
+			Algorithm: result.Algorithm,
+			Hash:      result.Hash,
+		})
+	}
+	if err := appendChain(path, record, tsaURL); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// appendChain links record to the last record of the log at path, or of
+// the s3:// chain, and appends it
+func appendChain(path string, record *ChainRecord, tsaURL string) error {
+	var s3Chain *s3ChainTarget
+	var last *ChainRecord
+	if strings.HasPrefix(path, "s3://") {
+		var err error
+		if s3Chain, err = openS3Chain(path); err != nil {
+			return err
+		}
+		if last, err = s3Chain.last(); err != nil {
+			return err
+		}
+	} else {
+		records, err := readChain(path)
+		if err != nil {
+			return err
+		}
+		if err := verifyRecords(records); err != nil {
+			return fmt.Errorf("refusing to extend broken chain: %w", err)
+		}
+		if len(records) > 0 {
+			last = &records[len(records)-1]
+		}
+	}
+	record.Seq = 1
+	record.Time = time.Now().UTC().Format(time.RFC3339)
+	if last != nil {
+		record.Seq, record.Prev = last.Seq+1, last.Digest
+	}
+	var err error
+	if record.Digest, err = record.computeDigest(); err != nil {
+		return err
+	}
+	if tsaURL != "" {
+		raw, _ := hex.DecodeString(record.Digest)
+		token, err := RequestTimestamp(tsaURL, SHA256, raw)
+		if err != nil {
+			return fmt.Errorf("failed to timestamp chain record: %w", err)
+		}
+		record.Timestamp = token.Raw
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode chain record: %w", err)
+	}
+	if s3Chain != nil {
+		return s3Chain.put(record, data)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open chain log: %w", err)
+	}
+	defer file.Close()
+	if err := appendLine(file, data); err != nil {
+		return fmt.Errorf("failed to write chain log: %w", err)
+	}
+	return file.Sync()
+}
+
+// runVerifyChain implements the verify-chain command
+func runVerifyChain(args []string) int {
+	fs := flag.NewFlagSet("verify-chain", flag.ExitOnError)
+	logFlags := registerLogSinkFlags(fs)
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("Usage: hashculate verify-chain <chain-log|s3://bucket/prefix/>")
+		return 1
+	}
+	sink, err := logFlags.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer sink.Close()
+
+	count, err := VerifyChain(positional[0])
+	if err != nil {
+		sink.Emit(logError, "verify.failed", err.Error(), map[string]any{"chain": positional[0]})
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	sink.Emit(logInfo, "scan.summary", fmt.Sprintf("chain verified: %d records", count), map[string]any{"chain": positional[0], "records": count})
+	fmt.Printf("Chain OK: %d records verified\n", count)
+	return 0
+}
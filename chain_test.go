@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChainAppendAndVerify(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "chain.log")
+	result := &HashResult{Algorithm: SHA256, Hash: "abc123", Filename: "file.bin", FileSize: 42}
+
+	for i := 1; i <= 3; i++ {
+		record, err := AppendChainRecord(logPath, []*HashResult{result}, "")
+		if err != nil {
+			t.Fatalf("Append %d failed: %v", i, err)
+		}
+		if record.Seq != int64(i) {
+			t.Errorf("Expected sequence %d, got %d", i, record.Seq)
+		}
+	}
+
+	count, err := VerifyChain(logPath)
+	if err != nil {
+		t.Fatalf("Verify failed on untouched chain: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 records, got %d", count)
+	}
+
+	// Tamper with the hash recorded in the first report
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read chain log: %v", err)
+	}
+	tampered := strings.Replace(string(data), "abc123", "abc124", 1)
+	if err := os.WriteFile(logPath, []byte(tampered), 0644); err != nil {
+		t.Fatalf("Failed to write chain log: %v", err)
+	}
+
+	if _, err := VerifyChain(logPath); err == nil {
+		t.Error("Expected verification failure for tampered chain, but got none")
+	}
+	if _, err := AppendChainRecord(logPath, []*HashResult{result}, ""); err == nil {
+		t.Error("Expected append to a broken chain to fail, but it succeeded")
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"hashculate/hasher"
+)
+
+// defaultSegmentSize is how much of a log one checkpoint covers at most
+const defaultSegmentSize = 1 << 20
+
+// Checkpoint is a signed record covering one segment of an append-only log.
+// Cumulative chains the segment to every checkpoint before it, so rewriting or
+// truncating data that was already checkpointed is detected on verification,
+// and forging a record needs the signing key.
+type Checkpoint struct {
+	Seq        int64  `json:"seq"`
+	Time       string `json:"time"`
+	Offset     int64  `json:"offset"`
+	Length     int64  `json:"length"`
+	Segment    string `json:"segment"`
+	Cumulative string `json:"cumulative"`
+	Signature  []byte `json:"signature"`
+}
+
+// message returns the bytes a checkpoint's signature covers
+func (cp Checkpoint) message() []byte {
+	cp.Signature = nil
+	data, _ := json.Marshal(cp)
+	return data
+}
+
+// cumulativeHash extends the previous cumulative hash with a segment ending at end
+func cumulativeHash(prev, segment string, end int64) string {
+	if prev == "" {
+		prev = strings.Repeat("0", 64)
+	}
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s %s %d\n", prev, segment, end))
+	return hex.EncodeToString(sum[:])
+}
+
+// readCheckpoints loads a checkpoint file; a missing file has no checkpoints
+func readCheckpoints(path string) ([]Checkpoint, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoints: %w", err)
+	}
+	defer file.Close()
+
+	var checkpoints []Checkpoint
+	scanner := bufio.NewScanner(file)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var cp Checkpoint
+		if err := json.Unmarshal(scanner.Bytes(), &cp); err != nil {
+			return nil, fmt.Errorf("checkpoints line %d: %w", line, err)
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read checkpoints: %w", err)
+	}
+	return checkpoints, nil
+}
+
+// verifyCheckpointChain checks the signature, position and cumulative hash of
+// every checkpoint without reading the log
+func verifyCheckpointChain(checkpoints []Checkpoint, key ed25519.PublicKey) error {
+	prev, end := "", int64(0)
+	for i, cp := range checkpoints {
+		switch {
+		case cp.Seq != int64(i+1):
+			return fmt.Errorf("checkpoint %d: unexpected sequence number %d", i+1, cp.Seq)
+		case !ed25519.Verify(key, cp.message(), cp.Signature):
+			return fmt.Errorf("checkpoint %d: bad signature", cp.Seq)
+		case cp.Offset != end:
+			return fmt.Errorf("checkpoint %d: starts at %d, previous segment ended at %d", cp.Seq, cp.Offset, end)
+		case cp.Cumulative != cumulativeHash(prev, cp.Segment, cp.Offset+cp.Length):
+			return fmt.Errorf("checkpoint %d: cumulative hash does not chain to checkpoint %d", cp.Seq, cp.Seq-1)
+		}
+		prev, end = cp.Cumulative, cp.Offset+cp.Length
+	}
+	return nil
+}
+
+// hashSegment hashes length bytes of r with SHA-256
+func hashSegment(r io.Reader, length int64) (string, int64, error) {
+	digests, n, err := hasher.HashReader(io.LimitReader(r, length), []HashAlgorithm{SHA256}, 0, length, nil)
+	if err != nil {
+		return "", n, err
+	}
+	return digests[0].Hash, n, nil
+}
+
+// AppendCheckpoints signs checkpoints for the data appended to a log since its
+// last checkpoint, one per segmentSize bytes. The existing checkpoints and the
+// last checkpointed segment are verified first, so a log that was already
+// tampered with is not vouched for.
+func AppendCheckpoints(logPath, checkpointPath string, key ed25519.PrivateKey, segmentSize int64) ([]Checkpoint, error) {
+	checkpoints, err := readCheckpoints(checkpointPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyCheckpointChain(checkpoints, key.Public().(ed25519.PublicKey)); err != nil {
+		return nil, fmt.Errorf("refusing to extend broken checkpoints: %w", err)
+	}
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	prev, end := "", int64(0)
+	if len(checkpoints) > 0 {
+		last := checkpoints[len(checkpoints)-1]
+		prev, end = last.Cumulative, last.Offset+last.Length
+		if _, err := file.Seek(last.Offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		segment, n, err := hashSegment(file, last.Length)
+		if err != nil {
+			return nil, err
+		}
+		if n < last.Length {
+			return nil, fmt.Errorf("log was truncated to %d bytes, checkpoint %d ends at %d", last.Offset+n, last.Seq, end)
+		}
+		if segment != last.Segment {
+			return nil, fmt.Errorf("checkpoint %d: segment at %d was rewritten", last.Seq, last.Offset)
+		}
+	}
+
+	out, err := os.OpenFile(checkpointPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open checkpoints: %w", err)
+	}
+	defer out.Close()
+	var added []Checkpoint
+	for {
+		segment, n, err := hashSegment(file, segmentSize)
+		if err != nil {
+			return added, err
+		}
+		if n == 0 {
+			return added, nil
+		}
+		cp := Checkpoint{
+			Seq:     int64(len(checkpoints) + len(added) + 1),
+			Time:    time.Now().UTC().Format(time.RFC3339),
+			Offset:  end,
+			Length:  n,
+			Segment: segment,
+		}
+		end += n
+		cp.Cumulative = cumulativeHash(prev, segment, end)
+		cp.Signature = ed25519.Sign(key, cp.message())
+		prev = cp.Cumulative
+		line, _ := json.Marshal(cp)
+		if err := appendLine(out, line); err != nil {
+			return added, fmt.Errorf("failed to write checkpoint: %w", err)
+		}
+		added = append(added, cp)
+	}
+}
+
+// CheckpointVerification is the result of checking a log against its checkpoints
+type CheckpointVerification struct {
+	Checkpoints int
+	Verified    int64 // Bytes covered by valid checkpoints
+	Unchecked   int64 // Bytes appended after the last checkpoint
+}
+
+// VerifyCheckpoints checks every checkpoint's signature and chain and hashes
+// the log segment it covers
+func VerifyCheckpoints(logPath string, checkpoints []Checkpoint, key ed25519.PublicKey) (*CheckpointVerification, error) {
+	if err := verifyCheckpointChain(checkpoints, key); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log: %w", err)
+	}
+	defer file.Close()
+
+	result := &CheckpointVerification{Checkpoints: len(checkpoints)}
+	for _, cp := range checkpoints {
+		segment, n, err := hashSegment(file, cp.Length)
+		if err != nil {
+			return result, err
+		}
+		if n < cp.Length {
+			return result, fmt.Errorf("log was truncated to %d bytes, checkpoint %d ends at %d", cp.Offset+n, cp.Seq, cp.Offset+cp.Length)
+		}
+		if segment != cp.Segment {
+			return result, fmt.Errorf("checkpoint %d: bytes %d-%d were rewritten", cp.Seq, cp.Offset, cp.Offset+cp.Length)
+		}
+		result.Verified += n
+	}
+	if info, err := file.Stat(); err == nil {
+		result.Unchecked = info.Size() - result.Verified
+	}
+	return result, nil
+}
+
+// writeSigningKey creates an Ed25519 key pair as PEM files at path and path.pub
+func writeSigningKey(path string) error {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(private)
+	keyFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = pem.Encode(keyFile, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	der, _ = x509.MarshalPKIXPublicKey(public)
+	return os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644)
+}
+
+// loadPEMKey reads an Ed25519 private or public key from a PEM file
+func loadPEMKey(path string) (any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unexpected PEM block %s", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	switch key.(type) {
+	case ed25519.PrivateKey, ed25519.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+}
+
+// runCheckpoint implements the checkpoint command
+func runCheckpoint(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate checkpoint keygen <key.pem>")
+		fmt.Println("       hashculate checkpoint append <log> -key <key.pem> [-checkpoints <file>] [-segment <bytes>]")
+		fmt.Println("       hashculate checkpoint verify <log> -key <key.pem.pub> [-checkpoints <file>]")
+		return 1
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	fs := flag.NewFlagSet("checkpoint "+args[0], flag.ExitOnError)
+	keyPath := fs.String("key", "", "Ed25519 private key (append) or public key (verify) in PEM")
+	checkpointPath := fs.String("checkpoints", "", "Checkpoint file [default: <log>.checkpoints]")
+	segmentSize := fs.Int64("segment", defaultSegmentSize, "Bytes covered by each checkpoint at most")
+	positional := parseFlags(fs, args[1:])
+	if len(positional) != 1 {
+		return usage()
+	}
+
+	if args[0] == "keygen" {
+		if err := writeSigningKey(positional[0]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Signing key written to %s, public key to %s.pub\n", positional[0], positional[0])
+		return 0
+	}
+	if *keyPath == "" || *segmentSize <= 0 {
+		return usage()
+	}
+	if *checkpointPath == "" {
+		*checkpointPath = positional[0] + ".checkpoints"
+	}
+	key, err := loadPEMKey(*keyPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "append":
+		private, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			fmt.Println("Error: append needs the private key")
+			return 1
+		}
+		added, err := AppendCheckpoints(positional[0], *checkpointPath, private, *segmentSize)
+		for _, cp := range added {
+			fmt.Printf("Checkpoint %d: bytes %d-%d, segment %s\n", cp.Seq, cp.Offset, cp.Offset+cp.Length, cp.Segment)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if len(added) == 0 {
+			fmt.Println("No new data since the last checkpoint")
+		}
+		return 0
+
+	case "verify":
+		public, ok := key.(ed25519.PublicKey)
+		if !ok {
+			public = key.(ed25519.PrivateKey).Public().(ed25519.PublicKey)
+		}
+		checkpoints, err := readCheckpoints(*checkpointPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		result, err := VerifyCheckpoints(positional[0], checkpoints, public)
+		if err != nil {
+			fmt.Printf("FAILED: %v\n", err)
+			return 1
+		}
+		fmt.Printf("OK: %d checkpoint(s) cover %d bytes", result.Checkpoints, result.Verified)
+		if result.Unchecked > 0 {
+			fmt.Printf("; %d bytes appended since are not checkpointed yet", result.Unchecked)
+		}
+		fmt.Println()
+		return 0
+	}
+	return usage()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpoints(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "app.log")
+	checkpointPath := logPath + ".checkpoints"
+	if err := writeSigningKey(filepath.Join(dir, "key.pem")); err != nil {
+		t.Fatal(err)
+	}
+	private, _ := loadPEMKey(filepath.Join(dir, "key.pem"))
+	public, _ := loadPEMKey(filepath.Join(dir, "key.pem.pub"))
+	key := private.(ed25519.PrivateKey)
+
+	os.WriteFile(logPath, []byte(strings.Repeat("event\n", 10)), 0644)
+	if added, err := AppendCheckpoints(logPath, checkpointPath, key, 25); err != nil || len(added) != 3 {
+		t.Fatalf("first append added %d checkpoints: %v", len(added), err)
+	}
+	f, _ := os.OpenFile(logPath, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("late event\n")
+	f.Close()
+	if added, err := AppendCheckpoints(logPath, checkpointPath, key, 25); err != nil || len(added) != 1 || added[0].Offset != 60 {
+		t.Fatalf("second append: %+v, %v", added, err)
+	}
+
+	checkpoints, _ := readCheckpoints(checkpointPath)
+	result, err := VerifyCheckpoints(logPath, checkpoints, public.(ed25519.PublicKey))
+	if err != nil || result.Verified != 71 || result.Unchecked != 0 {
+		t.Fatalf("untouched log: %+v, %v", result, err)
+	}
+
+	// Rewriting earlier data, truncating the log and forging a record are all detected
+	data, _ := os.ReadFile(logPath)
+	os.WriteFile(logPath, []byte(strings.Replace(string(data), "event", "EVENT", 1)), 0644)
+	if _, err := VerifyCheckpoints(logPath, checkpoints, public.(ed25519.PublicKey)); err == nil || !strings.Contains(err.Error(), "rewritten") {
+		t.Errorf("rewrite not detected: %v", err)
+	}
+	os.WriteFile(logPath, data[:40], 0644)
+	if _, err := VerifyCheckpoints(logPath, checkpoints, public.(ed25519.PublicKey)); err == nil || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("truncation not detected: %v", err)
+	}
+	os.WriteFile(logPath, data, 0644)
+	checkpoints[1].Segment = checkpoints[0].Segment
+	if _, err := VerifyCheckpoints(logPath, checkpoints, public.(ed25519.PublicKey)); err == nil || !strings.Contains(err.Error(), "signature") {
+		t.Errorf("forged checkpoint not detected: %v", err)
+	}
+}
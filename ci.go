@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// problemMatcher is a GitHub Actions problem matcher for the plain output
+// of ci verify-artifacts, so other CI systems' parsers can use the same lines
+var problemMatcher = map[string]any{
+	"problemMatcher": []map[string]any{{
+		"owner": "hashculate",
+		"pattern": []map[string]any{{
+			"regexp":   `^(.+?): (error|warning): (.+)$`,
+			"file":     1,
+			"severity": 2,
+			"message":  3,
+		}},
+	}},
+}
+
+// artifactProblems describes each failing status of an artifact check
+var artifactProblems = map[string]string{
+	"FAILED":      "Checksum mismatch",
+	"MISSING":     "Artifact missing",
+	"UNLISTED":    "Artifact not in manifest",
+	"UNSUPPORTED": "No supported checksum",
+}
+
+// VerifyArtifacts checks the files matching the glob patterns against the
+// manifest. A file may be listed relative to the manifest's directory, as
+// given, or by its base name. Listed files that would match a pattern but do
+// not exist are reported as MISSING, and matching files the manifest does not
+// list as UNLISTED. The manifest itself is skipped, and without patterns every
+// listed file is checked.
+func VerifyArtifacts(manifestPath string, globs []string, calculator *HashCalculator) ([]SBOMCheckResult, error) {
+	entries, err := LoadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Dir(manifestPath)
+	listed := map[string]ManifestEntry{}
+	for _, entry := range entries {
+		listed[manifestKey(entry.Path)] = entry
+	}
+	matches := func(file string) bool {
+		for _, glob := range globs {
+			if ok, _ := filepath.Match(glob, file); ok {
+				return true
+			}
+		}
+		return len(globs) == 0
+	}
+
+	var files []string
+	for _, glob := range globs {
+		found, err := filepath.Glob(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %w", glob, err)
+		}
+		for _, file := range found {
+			if filepath.Clean(file) == filepath.Clean(manifestPath) {
+				continue
+			}
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				files = append(files, file)
+			}
+		}
+	}
+
+	var checks []SBOMCheckResult
+	var verify []ManifestEntry
+	used := map[string]bool{}
+	seen := map[string]bool{}
+	for _, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		var key string
+		for _, candidate := range []string{filepath.ToSlash(mustRel(base, file)), filepath.ToSlash(file), filepath.Base(file)} {
+			if _, ok := listed[manifestKey(candidate)]; ok {
+				key = manifestKey(candidate)
+				break
+			}
+		}
+		if key == "" {
+			checks = append(checks, SBOMCheckResult{Path: file, Status: "UNLISTED"})
+			continue
+		}
+		used[key] = true
+		verify = append(verify, ManifestEntry{Path: file, Checksums: listed[key].Checksums})
+	}
+	for _, entry := range entries {
+		file := filepath.Join(base, filepath.FromSlash(manifestKey(entry.Path)))
+		if used[manifestKey(entry.Path)] || !matches(file) {
+			continue
+		}
+		verify = append(verify, ManifestEntry{Path: file, Checksums: entry.Checksums})
+	}
+	checks = append(checks, VerifySBOM(verify, "", calculator)...)
+	sort.SliceStable(checks, func(i, j int) bool { return checks[i].Path < checks[j].Path })
+	return checks, nil
+}
+
+// mustRel returns path relative to base, or path itself when it has none
+func mustRel(base, path string) string {
+	if rel, err := filepath.Rel(base, path); err == nil {
+		return rel
+	}
+	return path
+}
+
+// artifactMessage explains why an artifact did not verify
+func artifactMessage(check SBOMCheckResult) string {
+	switch check.Status {
+	case "FAILED":
+		if check.Err != nil {
+			return check.Err.Error()
+		}
+		return fmt.Sprintf("expected %s %s, got %s", getAlgorithmName(check.Algorithm), check.Expected, check.Actual)
+	case "MISSING":
+		return "listed in the manifest but not found"
+	case "UNLISTED":
+		return "matches the glob but is not listed in the manifest"
+	}
+	return "the manifest has no MD5, SHA-1, SHA-256 or SHA-512 checksum for it"
+}
+
+// writeArtifactProblem prints a failed check as a GitHub Actions annotation
+// or as a `file: error: message` line
+func writeArtifactProblem(w io.Writer, check SBOMCheckResult, format string) {
+	message := artifactMessage(check)
+	if format == "github" {
+		data := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+		property := strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+		fmt.Fprintf(w, "::error file=%s,title=%s::%s\n", property.Replace(filepath.ToSlash(check.Path)), property.Replace(artifactProblems[check.Status]), data.Replace(message))
+		return
+	}
+	fmt.Fprintf(w, "%s: error: %s: %s\n", filepath.ToSlash(check.Path), strings.ToLower(artifactProblems[check.Status]), message)
+}
+
+// runCI implements the ci command
+func runCI(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate ci verify-artifacts -manifest <checksums.txt> [-glob 'dist/*'] [-format auto|github|plain]")
+		fmt.Println("       hashculate ci problem-matcher")
+		return 1
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	fs := flag.NewFlagSet("ci "+args[0], flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "Checksum manifest, hashdeep file, hashculate database or SBOM")
+	globs := fs.String("glob", "", "Comma-separated glob patterns of the artifacts [default: every file the manifest lists]")
+	format := fs.String("format", "auto", "Problem output: github annotations, plain file: error: lines, or auto (github under GitHub Actions)")
+	positional := parseFlags(fs, args[1:])
+
+	switch args[0] {
+	case "problem-matcher":
+		if len(positional) != 0 {
+			return usage()
+		}
+		data, _ := json.MarshalIndent(problemMatcher, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	case "verify-artifacts":
+		if len(positional) != 0 || *manifestPath == "" {
+			return usage()
+		}
+	default:
+		return usage()
+	}
+	switch *format {
+	case "auto":
+		*format = "plain"
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			*format = "github"
+		}
+	case "github", "plain":
+	default:
+		fmt.Printf("Error: unsupported format: %s. Supported: auto, github, plain\n", *format)
+		return 1
+	}
+
+	var patterns []string
+	for _, glob := range strings.Split(*globs, ",") {
+		if glob = strings.TrimSpace(glob); glob != "" {
+			patterns = append(patterns, glob)
+		}
+	}
+	checks, err := VerifyArtifacts(*manifestPath, patterns, NewHashCalculator())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(checks) == 0 {
+		fmt.Println("Error: no artifacts matched")
+		return 1
+	}
+	problems := 0
+	for _, check := range checks {
+		if check.Status != "OK" {
+			writeArtifactProblem(os.Stdout, check, *format)
+			problems++
+		}
+	}
+	if problems > 0 {
+		fmt.Printf("%d of %d artifact(s) failed verification against %s\n", problems, len(checks), *manifestPath)
+		return 1
+	}
+	fmt.Printf("Verified %d artifact(s) against %s\n", len(checks), *manifestPath)
+	return 0
+}
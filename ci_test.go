@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyArtifacts(t *testing.T) {
+	dist := filepath.Join(t.TempDir(), "dist")
+	os.MkdirAll(dist, 0755)
+	var manifest strings.Builder
+	for _, name := range []string{"app-linux.tar.gz", "app-darwin.tar.gz", "app-windows.zip"} {
+		os.WriteFile(filepath.Join(dist, name), []byte(name), 0644)
+		fmt.Fprintf(&manifest, "%x  %s\n", sha256.Sum256([]byte(name)), name)
+	}
+	manifestPath := filepath.Join(dist, "checksums.txt")
+	os.WriteFile(manifestPath, []byte(manifest.String()), 0644)
+
+	checks, err := VerifyArtifacts(manifestPath, []string{filepath.Join(dist, "*")}, NewHashCalculator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 3 {
+		t.Fatalf("expected three artifacts without the manifest, got %+v", checks)
+	}
+
+	os.WriteFile(filepath.Join(dist, "app-linux.tar.gz"), []byte("tampered"), 0644)
+	os.Remove(filepath.Join(dist, "app-darwin.tar.gz"))
+	os.WriteFile(filepath.Join(dist, "app-freebsd.tar.gz"), []byte("new"), 0644)
+	if checks, err = VerifyArtifacts(manifestPath, []string{filepath.Join(dist, "*.tar.gz")}, NewHashCalculator()); err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, check := range checks {
+		statuses[filepath.Base(check.Path)] = check.Status
+	}
+	if fmt.Sprint(statuses) != "map[app-darwin.tar.gz:MISSING app-freebsd.tar.gz:UNLISTED app-linux.tar.gz:FAILED]" {
+		t.Errorf("unexpected statuses: %v", statuses)
+	}
+
+	var out strings.Builder
+	writeArtifactProblem(&out, SBOMCheckResult{Path: "dist/a,b.zip", Status: "MISSING"}, "github")
+	if out.String() != "::error file=dist/a%2Cb.zip,title=Artifact missing::listed in the manifest but not found\n" {
+		t.Errorf("unexpected annotation: %q", out.String())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// parseChunker parses an `ipfs add` chunker specification; only fixed-size chunking is supported
+func parseChunker(spec string) (int, error) {
+	size, ok := strings.CutPrefix(spec, "size-")
+	if !ok {
+		return 0, fmt.Errorf("unsupported chunker: %s. Supported: size-<bytes>", spec)
+	}
+	n, err := strconv.Atoi(size)
+	if err != nil || n <= 0 || n > 1024*1024 {
+		return 0, fmt.Errorf("invalid chunk size in %s (1 to 1048576 bytes)", spec)
+	}
+	return n, nil
+}
+
+// ComputeCID returns the IPFS CID `ipfs add` would assign to a file
+func ComputeCID(path string, chunkSize, version int) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	dag := hasher.NewUnixFS(chunkSize, version)
+	if _, err := io.Copy(dag, file); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return hasher.FormatCID(dag.Sum(nil)), nil
+}
+
+// runCID implements the cid command
+func runCID(args []string) int {
+	fs := flag.NewFlagSet("cid", flag.ExitOnError)
+	version := fs.Int("cid-version", 1, "CID version (0 or 1)")
+	chunker := fs.String("chunker", fmt.Sprintf("size-%d", hasher.DefaultIPFSChunkSize), "Chunking algorithm (size-<bytes>)")
+	positional := parseFlags(fs, args)
+	if len(positional) == 0 {
+		fmt.Println("Usage: hashculate cid [-cid-version 0|1] [-chunker size-<bytes>] <file|dir>...")
+		return 1
+	}
+	if *version != 0 && *version != 1 {
+		fmt.Printf("Error: unsupported CID version: %d\n", *version)
+		return 1
+	}
+	chunkSize, err := parseChunker(*chunker)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	status := 0
+	for _, root := range positional {
+		files, err := listFiles(root)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			status = 1
+			continue
+		}
+		for _, path := range files {
+			cid, err := ComputeCID(path, chunkSize, *version)
+			if err != nil {
+				fmt.Printf("Error: %s: %v\n", path, err)
+				status = 1
+				continue
+			}
+			fmt.Printf("%s  %s\n", cid, path)
+		}
+	}
+	return status
+}
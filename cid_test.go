@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"hashculate/hasher"
+)
+
+func TestComputeCID(t *testing.T) {
+	dir := t.TempDir()
+	hello := filepath.Join(dir, "hello.txt")
+	empty := filepath.Join(dir, "empty.txt")
+	os.WriteFile(hello, []byte("hello world"), 0644)
+	os.WriteFile(empty, nil, 0644)
+
+	// CIDs assigned by ipfs add
+	tests := []struct {
+		path    string
+		version int
+		want    string
+	}{
+		{hello, 0, "Qmf412jQZiuVUtdgnB36FXFX7xg5V6KEbSJ4dpQuhkLyfD"},
+		{empty, 0, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{hello, 1, "bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e"},
+		{empty, 1, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+	}
+	for _, tt := range tests {
+		cid, err := ComputeCID(tt.path, hasher.DefaultIPFSChunkSize, tt.version)
+		if err != nil {
+			t.Fatalf("Failed to compute CID: %v", err)
+		}
+		if cid != tt.want {
+			t.Errorf("CIDv%d of %s = %s, want %s", tt.version, filepath.Base(tt.path), cid, tt.want)
+		}
+	}
+
+	result, _ := NewHashCalculator().CalculateFileHash(hello, CIDV1, nil)
+	if result.Hash != tests[2].want {
+		t.Errorf("-a cidv1 = %s, want %s", result.Hash, tests[2].want)
+	}
+
+	// More chunks than fit in one node need a second level of dag-pb nodes
+	large := filepath.Join(dir, "large.bin")
+	os.WriteFile(large, bytes.Repeat([]byte("x"), 200), 0644)
+	multi, _ := ComputeCID(large, 1, 1)
+	single, _ := ComputeCID(large, 256, 1)
+	if !strings.HasPrefix(multi, "bafybei") || !strings.HasPrefix(single, "bafkrei") || multi == single {
+		t.Errorf("Unexpected CIDs for chunked file: %s, %s", multi, single)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// cloneCache remembers digests by where a file's data lies on disk, so a
+// clone (APFS, Btrfs or XFS reflink) or hard link of a file already hashed
+// is not read again. Files whose extents the file system does not report
+// are always read.
+type cloneCache struct {
+	mu      sync.Mutex
+	digests map[string]map[HashAlgorithm]*HashResult
+	Reused  int   // Files whose digests were taken from a clone
+	Skipped int64 // Bytes not read because of that
+}
+
+// newCloneCache creates an empty cache
+func newCloneCache() *cloneCache {
+	return &cloneCache{digests: map[string]map[HashAlgorithm]*HashResult{}}
+}
+
+// key identifies the data of a file of the given size by its device and
+// physical extents, or is empty when they are unknown
+func (c *cloneCache) key(f *os.File, size int64) string {
+	if c == nil || size <= 0 {
+		return ""
+	}
+	extents, err := physicalExtents(f)
+	if err != nil || extents == "" {
+		return ""
+	}
+	return fmt.Sprintf("%d %s", size, extents)
+}
+
+// get returns copies of the digests recorded for key, when there is one for
+// every algorithm
+func (c *cloneCache) get(key string, algorithms []HashAlgorithm) ([]*HashResult, bool) {
+	if key == "" {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	recorded := c.digests[key]
+	results := make([]*HashResult, len(algorithms))
+	for i, alg := range algorithms {
+		result, ok := recorded[alg]
+		if !ok {
+			return nil, false
+		}
+		copied := *result
+		results[i] = &copied
+	}
+	c.Reused++
+	c.Skipped += results[0].FileSize
+	return results, true
+}
+
+// put records the digests of the data behind key
+func (c *cloneCache) put(key string, results []*HashResult) {
+	if key == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.digests[key] == nil {
+		c.digests[key] = map[HashAlgorithm]*HashResult{}
+	}
+	for _, result := range results {
+		c.digests[key][result.Algorithm] = result
+	}
+}
+
+// Print reports how much reading the cache saved
+func (c *cloneCache) Print() {
+	if c != nil && c.Reused > 0 {
+		fmt.Fprintf(os.Stderr, "%d clone(s) or hard link(s) of files already hashed were not read again (%s)\n", c.Reused, markdownSize(c.Skipped))
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// fLog2PhysExt is F_LOG2PHYS_EXT, which maps a file offset to its device offset
+const fLog2PhysExt = 65
+
+// physicalExtents describes where a file's data lies on its device, as
+// reported by F_LOG2PHYS_EXT. APFS clones share these until either copy is
+// changed.
+func physicalExtents(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d", info.Sys().(*syscall.Stat_t).Dev)
+	for offset := int64(0); offset < info.Size(); {
+		// struct log2phys, packed to 4 bytes: flags, contiguous bytes, device offset
+		var l2p [20]byte
+		binary.NativeEndian.PutUint64(l2p[4:], uint64(info.Size()-offset))
+		binary.NativeEndian.PutUint64(l2p[12:], uint64(offset))
+		if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fLog2PhysExt, uintptr(unsafe.Pointer(&l2p[0]))); errno != 0 {
+			return "", errno
+		}
+		contiguous, device := int64(binary.NativeEndian.Uint64(l2p[4:])), int64(binary.NativeEndian.Uint64(l2p[12:]))
+		if contiguous <= 0 || device < 0 {
+			return "", nil
+		}
+		fmt.Fprintf(&b, " %d+%d@%d", offset, contiguous, device)
+		offset += contiguous
+	}
+	return b.String(), nil
+}
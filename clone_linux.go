@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	fsIocFiemap      = 0xC020660B // FS_IOC_FIEMAP
+	fiemapFlagSync   = 0x1        // FIEMAP_FLAG_SYNC: write out delayed allocations first
+	fiemapExtentLast = 0x1        // FIEMAP_EXTENT_LAST
+	fiemapBatch      = 64         // Extents requested per call
+
+	// Extents without a physical location of their own: unknown, delayed,
+	// encoded, encrypted, unaligned, inline and tail-packed data
+	fiemapExtentUnplaced = 0x2 | 0x4 | 0x8 | 0x80 | 0x100 | 0x200 | 0x400
+)
+
+// physicalExtents describes where a file's data lies on its device, as
+// reported by FIEMAP, or is empty when some of it has no fixed place
+func physicalExtents(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d", info.Sys().(*syscall.Stat_t).Dev)
+
+	// struct fiemap followed by its extents, 8-byte aligned
+	words := make([]uint64, (32+56*fiemapBatch)/8)
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(&words[0])), len(words)*8)
+	for start := uint64(0); ; {
+		clear(buf)
+		binary.NativeEndian.PutUint64(buf[0:], start)
+		binary.NativeEndian.PutUint64(buf[8:], ^uint64(0)-start)
+		binary.NativeEndian.PutUint32(buf[16:], fiemapFlagSync)
+		binary.NativeEndian.PutUint32(buf[24:], fiemapBatch)
+		if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), fsIocFiemap, uintptr(unsafe.Pointer(&buf[0]))); errno != 0 {
+			return "", errno
+		}
+		mapped := int(binary.NativeEndian.Uint32(buf[20:]))
+		if mapped == 0 {
+			return b.String(), nil
+		}
+		for i := range mapped {
+			extent := buf[32+56*i:]
+			logical, physical, length := binary.NativeEndian.Uint64(extent[0:]), binary.NativeEndian.Uint64(extent[8:]), binary.NativeEndian.Uint64(extent[16:])
+			flags := binary.NativeEndian.Uint32(extent[40:])
+			if flags&fiemapExtentUnplaced != 0 {
+				return "", nil
+			}
+			fmt.Fprintf(&b, " %d+%d@%d", logical, length, physical)
+			if flags&fiemapExtentLast != 0 {
+				return b.String(), nil
+			}
+			start = logical + length
+		}
+	}
+}
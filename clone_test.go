@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCloneCache(t *testing.T) {
+	dir := t.TempDir()
+	original := filepath.Join(dir, "original.bin")
+	os.WriteFile(original, []byte("the same data"), 0644)
+	os.WriteFile(filepath.Join(dir, "copy.bin"), []byte("the same data"), 0644)
+	if err := os.Link(original, filepath.Join(dir, "link.bin")); err != nil {
+		t.Skipf("Hard links are not available: %v", err)
+	}
+	f, _ := os.Open(original)
+	extents, err := physicalExtents(f)
+	f.Close()
+	if err != nil || extents == "" {
+		t.Skipf("The file system does not report extents: %v", err)
+	}
+
+	calc := NewHashCalculator()
+	calc.Clones = newCloneCache()
+	var digests []string
+	for _, name := range []string{"original.bin", "copy.bin", "link.bin"} {
+		results, err := calc.CalculateFileDigests(filepath.Join(dir, name), []HashAlgorithm{SHA256}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if results[0].Basename != name {
+			t.Errorf("Expected the result to name %s, got %s", name, results[0].Basename)
+		}
+		digests = append(digests, results[0].Hash)
+	}
+	if digests[0] != digests[1] || digests[0] != digests[2] {
+		t.Errorf("Expected equal digests, got %v", digests)
+	}
+	// The copy has its own data on disk; only the hard link shares it
+	if calc.Clones.Reused != 1 || calc.Clones.Skipped != int64(len("the same data")) {
+		t.Errorf("Expected only the hard link to be taken from the cache, got %d file(s), %d bytes", calc.Clones.Reused, calc.Clones.Skipped)
+	}
+	if _, ok := calc.Clones.get(calc.Clones.key(mustOpen(t, original), 13), []HashAlgorithm{SHA512}); ok {
+		t.Error("Expected no digests for an algorithm that was not computed")
+	}
+}
+
+func mustOpen(t *testing.T, path string) *os.File {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
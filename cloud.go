@@ -0,0 +1,510 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cloudObject is one object listed under a bucket prefix
+type cloudObject struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+	SHA1     string // stored by B2, which checks uploads against it
+	Large    bool   // a B2 large file, stored in parts
+}
+
+// CloudCheck is the result for one object and the state of the SHA-1 a B2
+// bucket stores for it: verified, absent (a large file uploaded without
+// large_file_sha1), or empty for other stores and journaled objects
+type CloudCheck struct {
+	SBOMCheckResult
+	Stored string
+}
+
+// cloudBucket lists and streams the objects of an S3, Cloud Storage or B2 bucket
+type cloudBucket struct {
+	provider string // s3, gcs or b2
+	name     string
+	base     url.URL
+	region   string
+	creds    awsCredentials
+	token    string
+	client   *http.Client
+	b2       *b2Session
+}
+
+// openCloudBucket parses s3://, gs:// and b2://bucket/prefix. endpoint
+// replaces the provider's API host, for MinIO, other S3-compatible stores or
+// the Cloud Storage emulator; $AWS_ENDPOINT_URL_S3 and $AWS_ENDPOINT_URL
+// are used for s3:// when it is empty.
+func openCloudBucket(target, endpoint, region, token string) (*cloudBucket, string, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Host == "" || (u.Scheme != "s3" && u.Scheme != "gs" && u.Scheme != "b2") {
+		return nil, "", fmt.Errorf("expected s3://, gs:// or b2://bucket/prefix, got %q", target)
+	}
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	b := &cloudBucket{name: u.Host, token: token, client: &http.Client{Transport: fetchTransport}}
+	api, apiPath := "", ""
+	switch u.Scheme {
+	case "gs":
+		b.provider, api, apiPath = "gcs", "https://storage.googleapis.com", "/storage/v1/b/"+u.Host+"/o"
+	case "b2":
+		b.provider, api = "b2", b2API
+	}
+	if b.provider != "" {
+		if endpoint == "" {
+			endpoint = api
+		}
+		base, err := url.Parse(endpoint)
+		if err != nil || base.Host == "" {
+			return nil, "", fmt.Errorf("invalid endpoint %q", endpoint)
+		}
+		b.base = *base
+		b.base.Path = strings.TrimSuffix(base.Path, "/") + apiPath
+		return b, prefix, nil
+	}
+	b.provider, b.creds = "s3", awsCredentialsFromEnv()
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint == "" {
+			endpoint = os.Getenv(name)
+		}
+	}
+	if b.region = region; b.region == "" {
+		b.region = awsRegion()
+	}
+	if b.base, err = s3Endpoint(u.Host, endpoint, b.region); err != nil {
+		return nil, "", err
+	}
+	return b, prefix, nil
+}
+
+// get sends an authenticated GET for u
+func (b *cloudBucket) get(u url.URL) (*http.Response, error) {
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.provider == "s3" {
+		b.creds.signV4(req, b.region, time.Now())
+	} else if b.token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", u.Redacted(), resp.Status)
+	}
+	return resp, nil
+}
+
+// List returns every object whose key starts with prefix, following pages
+func (b *cloudBucket) List(prefix string) ([]cloudObject, error) {
+	if b.provider == "b2" {
+		objects, err := b.listB2(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", b.name, err)
+		}
+		return objects, nil
+	}
+	var objects []cloudObject
+	page := ""
+	for {
+		u := b.base
+		query := url.Values{"prefix": {prefix}}
+		if b.provider == "s3" {
+			query.Set("list-type", "2")
+			if page != "" {
+				query.Set("continuation-token", page)
+			}
+		} else if page != "" {
+			query.Set("pageToken", page)
+		}
+		u.RawQuery = query.Encode()
+		resp, err := b.get(u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", b.name, err)
+		}
+		var listed []cloudObject
+		if b.provider == "s3" {
+			listed, page, err = decodeS3Listing(resp.Body)
+		} else {
+			listed, page, err = decodeGCSListing(resp.Body)
+		}
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", b.name, err)
+		}
+		objects = append(objects, listed...)
+		if page == "" {
+			return objects, nil
+		}
+	}
+}
+
+// Open streams the content of an object
+func (b *cloudBucket) Open(key string) (io.ReadCloser, error) {
+	if b.provider == "b2" {
+		return b.openB2(key)
+	}
+	u := b.base
+	if b.provider == "s3" {
+		u.Path += key
+	} else {
+		u.Path += "/" + key
+		u.RawPath = strings.TrimSuffix(b.base.EscapedPath(), "/") + "/" + url.PathEscape(key)
+		u.RawQuery = "alt=media"
+	}
+	resp, err := b.get(u)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// decodeS3Listing reads a ListObjectsV2 page and its continuation token
+func decodeS3Listing(r io.Reader) ([]cloudObject, string, error) {
+	var result struct {
+		IsTruncated           bool
+		NextContinuationToken string
+		Contents              []struct {
+			Key          string
+			Size         int64
+			LastModified time.Time
+		}
+	}
+	if err := xml.NewDecoder(r).Decode(&result); err != nil {
+		return nil, "", err
+	}
+	var objects []cloudObject
+	for _, c := range result.Contents {
+		objects = append(objects, cloudObject{Key: c.Key, Size: c.Size, Modified: c.LastModified})
+	}
+	if !result.IsTruncated {
+		return objects, "", nil
+	}
+	return objects, result.NextContinuationToken, nil
+}
+
+// decodeGCSListing reads a Cloud Storage objects.list page and its page token
+func decodeGCSListing(r io.Reader) ([]cloudObject, string, error) {
+	var result struct {
+		NextPageToken string `json:"nextPageToken"`
+		Items         []struct {
+			Name    string    `json:"name"`
+			Size    string    `json:"size"`
+			Updated time.Time `json:"updated"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&result); err != nil {
+		return nil, "", err
+	}
+	var objects []cloudObject
+	for _, item := range result.Items {
+		size, _ := strconv.ParseInt(item.Size, 10, 64)
+		objects = append(objects, cloudObject{Key: item.Name, Size: size, Modified: item.Updated})
+	}
+	return objects, result.NextPageToken, nil
+}
+
+// VerifyCloudObjects streams every object under prefix with jobs workers and
+// checks it against the strongest checksum the manifest lists for its path
+// relative to prefix. Objects the journal recorded unchanged are not
+// downloaded again. Each result is passed to report as it finishes, and all
+// are returned sorted by path, with UNLISTED for objects the manifest lacks.
+func VerifyCloudObjects(bucket *cloudBucket, prefix string, entries []ManifestEntry, jobs int, journal *ScanJournal, report func(CloudCheck)) ([]CloudCheck, error) {
+	objects, err := bucket.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+	listed := map[string]cloudObject{}
+	for _, object := range objects {
+		if !strings.HasSuffix(object.Key, "/") {
+			listed[strings.TrimPrefix(object.Key, prefix)] = object
+		}
+	}
+
+	var mu sync.Mutex
+	var results []CloudCheck
+	finish := func(check CloudCheck) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, check)
+		report(check)
+	}
+
+	type job struct {
+		check  CloudCheck
+		object cloudObject
+	}
+	queue := make(chan job)
+	var wg sync.WaitGroup
+	for range max(jobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			calculator := NewHashCalculator()
+			for j := range queue {
+				// Each download holds a connection, which counts against the open file limit
+				acquireFile()
+				finish(verifyCloudObject(bucket, calculator, j.check, j.object, journal, &mu))
+				releaseFile()
+			}
+		}()
+	}
+
+	for _, entry := range entries {
+		key := manifestKey(entry.Path)
+		check := CloudCheck{SBOMCheckResult: SBOMCheckResult{Path: key, Status: "UNSUPPORTED"}}
+		for _, alg := range algorithmStrength {
+			if expected, ok := entry.Checksums[alg]; ok {
+				check.Algorithm, check.Expected = alg, strings.ToLower(expected)
+				break
+			}
+		}
+		object, ok := listed[key]
+		delete(listed, key)
+		switch {
+		case !ok:
+			check.Status = "MISSING"
+			finish(check)
+		case check.Algorithm == "":
+			finish(check)
+		default:
+			queue <- job{check, object}
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	for key := range listed {
+		finish(CloudCheck{SBOMCheckResult: SBOMCheckResult{Path: key, Status: "UNLISTED"}})
+	}
+	sort.Slice(results, func(i, k int) bool { return results[i].Path < results[k].Path })
+	return results, nil
+}
+
+// verifyCloudObject hashes one object, or takes its digest from the journal,
+// and records it in the journal under mu. Objects with a stored SHA-1 are
+// checked against it as well.
+func verifyCloudObject(bucket *cloudBucket, calculator *HashCalculator, check CloudCheck, object cloudObject, journal *ScanJournal, mu *sync.Mutex) CloudCheck {
+	algorithms := []HashAlgorithm{check.Algorithm}
+	digest := ""
+	if journal != nil {
+		mu.Lock()
+		entry, ok := journal.Unchanged(object.Key, object.Size, object.Modified, algorithms)
+		mu.Unlock()
+		digest = entry.Hashes[check.Algorithm]
+		if !ok {
+			digest = ""
+		}
+	}
+	if digest == "" {
+		body, err := bucket.Open(object.Key)
+		if err != nil {
+			check.Status, check.Err = "FAILED", err
+			return check
+		}
+		hashed := algorithms
+		if object.SHA1 != "" && check.Algorithm != SHA1 {
+			hashed = append(hashed, SHA1)
+		}
+		results, err := calculator.CalculateReaderDigests(body, object.Key, object.Size, hashed, nil)
+		body.Close()
+		if err != nil {
+			check.Status, check.Err = "FAILED", fmt.Errorf("failed to read %s: %w", object.Key, err)
+			return check
+		}
+		hashes := map[HashAlgorithm]string{}
+		for _, result := range results {
+			hashes[result.Algorithm] = result.Hash
+		}
+		digest = hashes[check.Algorithm]
+		switch {
+		case object.SHA1 != "" && hashes[SHA1] != object.SHA1:
+			check.Status, check.Actual, check.Err = "FAILED", digest, fmt.Errorf("the SHA-1 stored for the object is %s, but its data hashes to %s", object.SHA1, hashes[SHA1])
+			return check
+		case object.SHA1 != "":
+			check.Stored = "verified"
+		case object.Large:
+			check.Stored = "absent"
+		}
+		if journal != nil {
+			mu.Lock()
+			err = journal.Record(DBEntry{Path: object.Key, Size: object.Size, Modified: object.Modified.UTC(), Hashes: hashes})
+			mu.Unlock()
+			if err != nil {
+				check.Status, check.Err = "FAILED", err
+				return check
+			}
+		}
+	}
+	check.Actual, check.Status = digest, "OK"
+	if digest != check.Expected {
+		check.Status = "FAILED"
+	}
+	return check
+}
+
+// runCloud implements the cloud command
+func runCloud(args []string) int {
+	usage := "Usage: hashculate cloud verify <s3|gs|b2://bucket/prefix> -manifest <file> [-jobs <n>] [-resume <journal>] [-strict] [-report html <out.html>]"
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Println(usage)
+		return 1
+	}
+	fs := flag.NewFlagSet("cloud verify", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "Checksum file or manifest with paths relative to the prefix")
+	jobs := fs.Int("jobs", 4, "Objects to download and hash at once")
+	resume := fs.String("resume", "", "Journal of verified objects, to resume an interrupted run")
+	strict := fs.Bool("strict", false, "Fail when the prefix holds objects the manifest does not list")
+	quiet := fs.Bool("quiet", false, "Only print objects that did not verify")
+	endpoint := fs.String("endpoint", "", "S3-compatible (MinIO, Ceph, Wasabi, B2), Cloud Storage or B2 API endpoint")
+	region := fs.String("region", "", "S3 region to sign requests for (default $AWS_REGION or us-east-1)")
+	token := fs.String("token", "", "OAuth access token for Cloud Storage")
+	fs.BoolVar(&deterministic, "deterministic", false, "Leave the generation time and absolute paths out of reports")
+	logFlags := registerLogSinkFlags(fs)
+	report, args, err := splitReportArgs(args[1:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || *manifestPath == "" {
+		fmt.Println(usage)
+		return 1
+	}
+	sink, err := logFlags.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer sink.Close()
+
+	bucket, prefix, err := openCloudBucket(positional[0], *endpoint, *region, *token)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	entries, err := LoadManifest(*manifestPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	var journal *ScanJournal
+	if *resume != "" {
+		if journal, err = OpenScanJournal(*resume); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if n := journal.Resumed(); n > 0 {
+			fmt.Printf("Resuming: %d objects already verified\n", n)
+		}
+	}
+
+	counts := map[string]int{}
+	transferFailed := false
+	results, err := VerifyCloudObjects(bucket, prefix, entries, *jobs, journal, func(check CloudCheck) {
+		counts[check.Status]++
+		if check.Stored == "absent" {
+			counts["unstored"]++
+		}
+		transferFailed = transferFailed || check.Err != nil
+		if check.Status == "FAILED" || check.Status == "MISSING" {
+			sink.Emit(logError, "verify.failed", fmt.Sprintf("%s: %s", check.Path, check.Status), map[string]any{
+				"bucket": positional[0], "path": check.Path, "status": check.Status,
+				"algorithm": string(check.Algorithm), "expected": check.Expected, "actual": check.Actual,
+			})
+		}
+		if *quiet && (check.Status == "OK" || check.Status == "UNLISTED" && !*strict) {
+			return
+		}
+		switch {
+		case check.Err != nil:
+			fmt.Printf("%s: FAILED (%v)\n", check.Path, check.Err)
+		case check.Status == "FAILED":
+			fmt.Printf("%s: FAILED %s expected %s, got %s\n", check.Path, getAlgorithmName(check.Algorithm), check.Expected, check.Actual)
+		case check.Status == "UNSUPPORTED":
+			fmt.Printf("%s: UNSUPPORTED (no md5, sha1, sha256 or sha512 checksum)\n", check.Path)
+		case check.Status == "UNLISTED":
+			fmt.Printf("%s: UNLISTED (not in the manifest)\n", check.Path)
+		case check.Stored == "absent":
+			fmt.Printf("%s: %s (large file without a stored SHA-1)\n", check.Path, check.Status)
+		default:
+			fmt.Printf("%s: %s\n", check.Path, check.Status)
+		}
+	})
+	if journal != nil {
+		journal.Close(err == nil && !transferFailed)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	if report != nil {
+		var rows []ReportRow
+		for _, check := range results {
+			row := ReportRow{Path: check.Path, Status: check.Status, Expected: check.Expected, Actual: check.Actual}
+			if check.Algorithm != "" {
+				row.Algorithm = getAlgorithmName(check.Algorithm)
+			}
+			if check.Err != nil {
+				row.Detail = check.Err.Error()
+			}
+			rows = append(rows, row)
+		}
+		err := report.write(VerificationReport{
+			Title:     "Verification of " + positional[0],
+			Manifest:  outputPath(*manifestPath),
+			Root:      positional[0],
+			Generated: outputTime(time.Now()),
+			Rows:      rows,
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Println()
+	summary := fmt.Sprintf("%d OK, %d mismatched, %d missing, %d unlisted, %d unsupported",
+		counts["OK"], counts["FAILED"], counts["MISSING"], counts["UNLISTED"], counts["UNSUPPORTED"])
+	fmt.Println(summary)
+	if counts["unstored"] > 0 {
+		fmt.Printf("%d large files have no stored SHA-1 to check\n", counts["unstored"])
+	}
+	failed := counts["FAILED"] > 0 || counts["MISSING"] > 0 || (*strict && counts["UNLISTED"] > 0)
+	level := logInfo
+	if failed {
+		level = logError
+	}
+	sink.Emit(level, "scan.summary", "cloud verify: "+summary, map[string]any{
+		"bucket": positional[0], "ok": counts["OK"], "failed": counts["FAILED"], "missing": counts["MISSING"],
+		"unlisted": counts["UNLISTED"], "unsupported": counts["UNSUPPORTED"],
+	})
+	if failed {
+		if transferFailed && *resume != "" {
+			fmt.Printf("Rerun with -resume %s to retry only the objects that could not be read\n", *resume)
+		}
+		return 1
+	}
+	return 0
+}
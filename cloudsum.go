@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// cloudChecksumHeaders are the object checksum headers of storage providers
+// and the hashes they are computed with. Values are base64; CRCs big-endian.
+var cloudChecksumHeaders = []struct {
+	header  string
+	newHash func() hash.Hash
+}{
+	{"X-Amz-Checksum-Sha256", sha256.New},
+	{"X-Amz-Checksum-Sha1", sha1.New},
+	{"X-Amz-Checksum-Crc32c", newCRC32C},
+	{"X-Amz-Checksum-Crc32", func() hash.Hash { return crc32.NewIEEE() }},
+	{"Content-Md5", md5.New},
+	{"X-Ms-Blob-Content-Md5", md5.New},
+}
+
+// googHashes are the members of x-goog-hash
+var googHashes = map[string]func() hash.Hash{"md5": md5.New, "crc32c": newCRC32C}
+
+// newCRC32C creates a CRC-32C (Castagnoli) hash, as S3 and Cloud Storage use
+func newCRC32C() hash.Hash {
+	return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+}
+
+// cloudChecksum is a whole-object checksum a storage provider sent with a
+// response, hashed alongside the body
+type cloudChecksum struct {
+	name string // header, and member for x-goog-hash
+	want []byte
+	hash hash.Hash
+}
+
+// Write hashes body data
+func (c *cloudChecksum) Write(p []byte) (int, error) {
+	return c.hash.Write(p)
+}
+
+// check compares the body hashed so far with the provider's checksum
+func (c *cloudChecksum) check() error {
+	if got := c.hash.Sum(nil); !bytes.Equal(got, c.want) {
+		return fmt.Errorf("body does not match %s: got %s, want %s", c.name,
+			base64.StdEncoding.EncodeToString(got), base64.StdEncoding.EncodeToString(c.want))
+	}
+	return nil
+}
+
+// cloudChecksums collects the checksums in the response headers that cover
+// the whole object. S3 composite checksums of multipart uploads, written as
+// `<base64>-<parts>`, cover the parts and are skipped, as are values that are
+// not base64. Cloud Storage hashes the stored object, which a transcoded
+// response no longer matches, so its hashes are skipped then.
+func cloudChecksums(header http.Header) []*cloudChecksum {
+	var checksums []*cloudChecksum
+	add := func(name, value string, newHash func() hash.Hash) {
+		want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+		if err == nil && len(want) == newHash().Size() {
+			checksums = append(checksums, &cloudChecksum{name: name, want: want, hash: newHash()})
+		}
+	}
+	for _, h := range cloudChecksumHeaders {
+		if value := header.Get(h.header); value != "" {
+			add(strings.ToLower(h.header), value, h.newHash)
+		}
+	}
+	if stored := header.Get("X-Goog-Stored-Content-Encoding"); stored != "" && stored != header.Get("Content-Encoding") {
+		return checksums
+	}
+	for _, field := range header.Values("X-Goog-Hash") {
+		for _, member := range strings.Split(field, ",") {
+			name, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+			if newHash := googHashes[name]; ok && newHash != nil {
+				add("x-goog-hash "+name, value, newHash)
+			}
+		}
+	}
+	return checksums
+}
+
+// storedChecksums are the checksum properties each object store keeps, and
+// the headers it returns them in. Cloud Storage computes CRC32C for every
+// object and MD5 for all but composite ones; Azure keeps the Content-MD5
+// the uploader set, which blobs uploaded in blocks usually lack.
+var storedChecksums = map[string]map[string][]string{
+	"gcs":   {"crc32c": {"x-goog-hash crc32c"}, "md5": {"x-goog-hash md5"}},
+	"azure": {"md5": {"content-md5", "x-ms-blob-content-md5"}},
+}
+
+// cloudProvider names the object store serving u, or "" for other servers
+func cloudProvider(u *url.URL) string {
+	host := u.Hostname()
+	switch {
+	case host == "storage.googleapis.com" || strings.HasSuffix(host, ".storage.googleapis.com"):
+		return "gcs"
+	case strings.HasSuffix(host, ".blob.core.windows.net"):
+		return "azure"
+	}
+	return ""
+}
+
+// storedChecksumStatus reports each stored checksum property of provider as
+// verified when one of its headers matched the body, absent when the
+// response has none of them, and unchecked when they were skipped, as for a
+// composite checksum or a decompressed body
+func storedChecksumStatus(provider string, header http.Header, verified []string) map[string]string {
+	if storedChecksums[provider] == nil {
+		return nil
+	}
+	status := map[string]string{}
+	for property, headers := range storedChecksums[provider] {
+		status[property] = "absent"
+		for _, name := range headers {
+			if sent(header, name) && status[property] == "absent" {
+				status[property] = "unchecked"
+			}
+			for _, v := range verified {
+				if v == name {
+					status[property] = "verified"
+				}
+			}
+		}
+	}
+	return status
+}
+
+// sent reports whether the response carries a checksum header, given by its
+// name as cloudChecksums records it
+func sent(header http.Header, name string) bool {
+	if member, ok := strings.CutPrefix(name, "x-goog-hash "); ok {
+		for _, field := range header.Values("X-Goog-Hash") {
+			if strings.Contains(field, member+"=") {
+				return true
+			}
+		}
+		return false
+	}
+	return header.Get(name) != ""
+}
+
+// gcsObjectURL maps gs://bucket/object to the Cloud Storage download URL
+func gcsObjectURL(u *url.URL) url.URL {
+	return url.URL{Scheme: "https", Host: "storage.googleapis.com", Path: "/" + u.Host + u.Path}
+}
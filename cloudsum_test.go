@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCloudChecksums(t *testing.T) {
+	body := []byte("object body")
+	b64 := base64.StdEncoding.EncodeToString
+	sha := sha256.Sum256(body)
+	sum := md5.Sum(body)
+	crc := binary.BigEndian.AppendUint32(nil, crc32.Checksum(body, crc32.MakeTable(crc32.Castagnoli)))
+	headers := map[string]map[string]string{
+		"/s3":        {"X-Amz-Checksum-Sha256": b64(sha[:])},
+		"/multipart": {"X-Amz-Checksum-Sha256": b64(sha[:]) + "-3", "X-Amz-Checksum-Type": "COMPOSITE"},
+		"/gcs":       {"X-Goog-Hash": "crc32c=" + b64(crc) + ",md5=" + b64(sum[:])},
+		"/corrupted": {"Content-MD5": b64(make([]byte, 16))},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for k, v := range headers[r.URL.Path] {
+			w.Header().Set(k, v)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	for path, want := range map[string]string{
+		"/s3":        "[x-amz-checksum-sha256]",
+		"/multipart": "[]",
+		"/gcs":       "[x-goog-hash crc32c x-goog-hash md5]",
+	} {
+		_, source, err := NewHashCalculator().FetchURLDigests(server.URL+path, RemoteCredentials{}, []HashAlgorithm{SHA256}, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if fmt.Sprint(source.ProviderChecksums) != want {
+			t.Errorf("%s: verified %v, want %s", path, source.ProviderChecksums, want)
+		}
+	}
+
+	_, _, err := NewHashCalculator().FetchURLDigests(server.URL+"/corrupted", RemoteCredentials{}, []HashAlgorithm{SHA256}, nil)
+	if err == nil || !strings.Contains(err.Error(), "does not match content-md5") {
+		t.Errorf("expected a content-md5 mismatch, got %v", err)
+	}
+
+	// Cloud objects report each stored checksum property, flagging missing ones
+	u, _ := url.Parse("gs://releases/v1/app.tar.gz")
+	if object := gcsObjectURL(u); object.String() != "https://storage.googleapis.com/releases/v1/app.tar.gz" || cloudProvider(&object) != "gcs" {
+		t.Errorf("unexpected object URL %s", object.String())
+	}
+	header := http.Header{"X-Goog-Hash": {"crc32c=AAAAAA=="}}
+	status := storedChecksumStatus("gcs", header, []string{"x-goog-hash crc32c"})
+	if fmt.Sprint(status) != "map[crc32c:verified md5:absent]" {
+		t.Errorf("unexpected stored checksums %v", status)
+	}
+	if status := storedChecksumStatus("gcs", header, nil); status["crc32c"] != "unchecked" {
+		t.Errorf("skipped checksum not reported as unchecked: %v", status)
+	}
+	if status := storedChecksumStatus("", header, []string{"content-md5"}); status != nil {
+		t.Errorf("stored checksums reported for a plain server: %v", status)
+	}
+}
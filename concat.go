@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// partSuffix matches the numbered suffix of a split file: .001, .part1, .part01
+var partSuffix = regexp.MustCompile(`(?i)(\.part|\.)(\d+)$`)
+
+// ConcatPart is one piece of a file hashed with -concat
+type ConcatPart struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// naturalLess orders names with numbers compared by value, so part2 sorts before part10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		i, j := 0, 0
+		if isDigit(a[0]) && isDigit(b[0]) {
+			for i < len(a) && isDigit(a[i]) {
+				i++
+			}
+			for j < len(b) && isDigit(b[j]) {
+				j++
+			}
+			x, _ := strconv.ParseUint(a[:i], 10, 64)
+			y, _ := strconv.ParseUint(b[:j], 10, 64)
+			if x != y {
+				return x < y
+			}
+		} else {
+			if a[0] != b[0] {
+				return a[0] < b[0]
+			}
+			i, j = 1, 1
+		}
+		a, b = a[i:], b[j:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// expandParts turns -concat arguments into the ordered list of parts. Several
+// arguments are used in the order given; a single glob pattern is expanded in
+// natural order; and a single numbered part such as file.001 or file.part1 is
+// followed by the next numbers for as long as those files exist.
+func expandParts(args []string) ([]string, error) {
+	if len(args) > 1 {
+		return args, nil
+	}
+	if strings.ContainsAny(args[0], "*?[") {
+		parts, err := filepath.Glob(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if len(parts) == 0 {
+			return nil, fmt.Errorf("no files match %s", args[0])
+		}
+		sort.Slice(parts, func(i, j int) bool { return naturalLess(parts[i], parts[j]) })
+		return parts, nil
+	}
+	m := partSuffix.FindStringSubmatchIndex(args[0])
+	if m == nil {
+		return nil, fmt.Errorf("%s is not a numbered part (such as file.001 or file.part1); list the parts or give a pattern", args[0])
+	}
+	prefix, digits := args[0][:m[3]], args[0][m[4]:]
+	n, _ := strconv.Atoi(digits)
+	parts := []string{args[0]}
+	for {
+		n++
+		next := fmt.Sprintf("%s%0*d", prefix, len(digits), n)
+		if _, err := os.Stat(next); err != nil {
+			break
+		}
+		parts = append(parts, next)
+	}
+	return parts, nil
+}
+
+// joinedName is the name of the file the parts were split from
+func joinedName(first string) string {
+	if m := partSuffix.FindStringIndex(first); m != nil && m[0] > 0 {
+		return first[:m[0]]
+	}
+	return first
+}
+
+// ConcatFiles hashes the parts of a split file as one stream, without joining them on disk
+func (hc *HashCalculator) ConcatFiles(parts []string, algorithm HashAlgorithm, progressCallback func(float64)) (*HashResult, error) {
+	var total int64
+	files := make([]ConcatPart, len(parts))
+	readers := make([]io.Reader, len(parts))
+	for i, part := range parts {
+		file, err := hc.openInput(part)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open part: %w", err)
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file info: %w", err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("%s is not a regular file", part)
+		}
+		files[i] = ConcatPart{Name: hc.Paths.name(part, info.Name()), Size: info.Size()}
+		readers[i] = file
+		total += info.Size()
+	}
+
+	joined := joinedName(filepath.Clean(parts[0]))
+	results, err := hc.CalculateReaderDigests(io.MultiReader(readers...), hc.Paths.name(joined, filepath.Base(joined)), total, []HashAlgorithm{algorithm}, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+	result := results[0]
+	result.Path, result.Basename = joined, filepath.Base(joined)
+	result.Parts = files
+	result.Description = fmt.Sprintf("%s It was read from %d parts.", result.Description, len(parts))
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConcatFiles(t *testing.T) {
+	dir := t.TempDir()
+	whole := []byte(strings.Repeat("split archive data ", 1000))
+	for i := 0; i < 11; i++ {
+		part := whole[i*len(whole)/11 : (i+1)*len(whole)/11]
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("backup.tar.part%d", i+1)), part, 0644)
+	}
+	want := fmt.Sprintf("%x", sha256.Sum256(whole))
+
+	// The first part finds the rest, and a pattern sorts part10 after part9
+	for _, arg := range []string{"backup.tar.part1", "backup.tar.part*"} {
+		parts, err := expandParts([]string{filepath.Join(dir, arg)})
+		if err != nil || len(parts) != 11 || filepath.Base(parts[10]) != "backup.tar.part11" {
+			t.Fatalf("%s: expanded to %v: %v", arg, parts, err)
+		}
+		result, err := NewHashCalculator().ConcatFiles(parts, SHA256, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Hash != want || result.FileSize != int64(len(whole)) || result.Filename != "backup.tar" || len(result.Parts) != 11 {
+			t.Errorf("%s: got %s (%d bytes, %s, %d parts), want %s", arg, result.Hash, result.FileSize, result.Filename, len(result.Parts), want)
+		}
+	}
+
+	if _, err := expandParts([]string{filepath.Join(dir, "backup.tar")}); err == nil {
+		t.Error("expected an error for a single file without a part number")
+	}
+	if !naturalLess("disk.001", "disk.002") || naturalLess("a.part10", "a.part9") {
+		t.Error("unexpected natural order")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// hashPool hashes files on several goroutines at once and hands each result
+// to emit in the order the files were added, so output does not depend on
+// which file finishes first
+type hashPool struct {
+	ctx     context.Context
+	queue   chan func()
+	pending chan chan FileHashResult
+	workers sync.WaitGroup
+	emitted chan struct{}
+}
+
+// newHashPool starts jobs workers, or one per CPU when jobs is 0. emit is
+// called on a single goroutine.
+func newHashPool(ctx context.Context, jobs int, emit func(FileHashResult)) *hashPool {
+	if jobs <= 0 {
+		jobs = runtime.GOMAXPROCS(0)
+	}
+	p := &hashPool{
+		ctx:   ctx,
+		queue: make(chan func()),
+		// Finished results wait here for the ones before them; the bound
+		// keeps a slow file from letting the rest of a tree pile up
+		pending: make(chan chan FileHashResult, jobs*2),
+		emitted: make(chan struct{}),
+	}
+	for range jobs {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for task := range p.queue {
+				task()
+			}
+		}()
+	}
+	go func() {
+		defer close(p.emitted)
+		for done := range p.pending {
+			emit(<-done)
+		}
+	}()
+	return p
+}
+
+// Add queues path for hashing by work. Once ctx is cancelled, files not yet
+// started fail with its error instead.
+func (p *hashPool) Add(path string, work func(path string) FileHashResult) {
+	done := make(chan FileHashResult, 1)
+	p.pending <- done
+	p.queue <- func() {
+		if err := p.ctx.Err(); err != nil {
+			done <- FileHashResult{Path: path, Err: err}
+			return
+		}
+		done <- work(path)
+	}
+}
+
+// Wait returns once every file added has been hashed and emitted
+func (p *hashPool) Wait() {
+	close(p.queue)
+	p.workers.Wait()
+	close(p.pending)
+	<-p.emitted
+}
+
+// CalculateConcurrent hashes paths on hc.Jobs workers at once and returns one
+// result per path, in the order given
+func (hc *HashCalculator) CalculateConcurrent(ctx context.Context, paths []string, algorithm HashAlgorithm) []FileHashResult {
+	results := make([]FileHashResult, 0, len(paths))
+	pool := newHashPool(ctx, hc.Jobs, func(r FileHashResult) {
+		results = append(results, r)
+	})
+	for _, path := range paths {
+		pool.Add(path, func(path string) FileHashResult {
+			result, err := hc.CalculateFileHash(path, algorithm, nil)
+			return FileHashResult{Path: path, Result: result, Err: err}
+		})
+	}
+	pool.Wait()
+	return results
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCalculateConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for i := range 20 {
+		path := filepath.Join(dir, fmt.Sprintf("file%02d", i))
+		if err := os.WriteFile(path, []byte(fmt.Sprintf("content %d", i)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	paths = append(paths, filepath.Join(dir, "missing"))
+
+	hc := NewHashCalculator()
+	hc.Jobs = 4
+	results := hc.CalculateConcurrent(context.Background(), paths, SHA256)
+	if len(results) != len(paths) {
+		t.Fatalf("Got %d results for %d files", len(results), len(paths))
+	}
+	for i, r := range results[:20] {
+		want, err := NewHashCalculator().CalculateFileHash(paths[i], SHA256, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Path != paths[i] || r.Err != nil || r.Result.Hash != want.Hash {
+			t.Errorf("Result %d is for %s (%v), want %s with %s", i, r.Path, r.Err, paths[i], want.Hash)
+		}
+	}
+	if last := results[20]; last.Err == nil {
+		t.Error("A missing file should fail")
+	}
+
+	// Files not started by the time the context is cancelled fail with its error
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, r := range hc.CalculateConcurrent(ctx, paths, SHA256) {
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Fatalf("%s: got %v after cancelling, want %v", r.Path, r.Err, context.Canceled)
+		}
+	}
+}
+
+func TestHashPoolKeepsOrder(t *testing.T) {
+	var emitted []string
+	pool := newHashPool(context.Background(), 8, func(r FileHashResult) {
+		emitted = append(emitted, r.Path)
+	})
+	for i := range 50 {
+		// Later files finish first, yet come out in the order they were added
+		pool.Add(fmt.Sprint(i), func(path string) FileHashResult {
+			time.Sleep(time.Duration(50-i) * 100 * time.Microsecond)
+			return FileHashResult{Path: path}
+		})
+	}
+	pool.Wait()
+	for i, path := range emitted {
+		if path != fmt.Sprint(i) {
+			t.Fatalf("Result %d is for file %s", i, path)
+		}
+	}
+	if len(emitted) != 50 {
+		t.Errorf("Emitted %d results, want 50", len(emitted))
+	}
+}
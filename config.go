@@ -0,0 +1,419 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// configSetting is one effective setting with where its value came from
+type configSetting struct {
+	Key    string
+	Value  string
+	Source string // flag, env <VAR>, file, file (<inherited key>) or default
+}
+
+// configKinds maps a config file kind to the top-level keys that identify it
+var configKinds = []struct {
+	name string
+	keys []string
+}{
+	{"fim", []string{"database", "groups", "retention"}},
+	{"serve", []string{"tenants", "listen", "tls-cert", "client-ca"}},
+	{"rules", []string{"rules"}},
+	{"case", []string{"case"}},
+}
+
+// fimInherited names the top-level fim setting each group setting defaults to
+var fimInherited = map[string]string{
+	"algorithms": "algorithm", "interval": "interval", "exclude": "ignore",
+	"alert": "alert", "permissions": "permissions", "labels": "labels",
+}
+
+// detectConfigKind names the kind of a parsed config file by its top-level keys
+func detectConfigKind(raw any) string {
+	top, _ := raw.(map[string]any)
+	for _, kind := range configKinds {
+		for _, key := range kind.keys {
+			if _, ok := top[key]; ok {
+				return kind.name
+			}
+		}
+	}
+	return ""
+}
+
+// jsonFieldName returns the name a struct field has in config files, or "" when it has none
+func jsonFieldName(field reflect.StructField) string {
+	if !field.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// unknownConfigKeys lists the keys of a parsed config value that no field of
+// t takes, as paths like groups[1].intervall. Like the decoder, field names
+// match regardless of case.
+func unknownConfigKeys(value any, t reflect.Type, path string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	join := func(key string) string {
+		if path == "" {
+			return key
+		}
+		return path + "." + key
+	}
+	var unknown []string
+	switch v := value.(type) {
+	case map[string]any:
+		if t.Kind() != reflect.Struct {
+			return nil
+		}
+		fields := map[string]reflect.Type{}
+		for i := range t.NumField() {
+			if name := jsonFieldName(t.Field(i)); name != "" {
+				fields[strings.ToLower(name)] = t.Field(i).Type
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if fieldType, ok := fields[strings.ToLower(key)]; ok {
+				unknown = append(unknown, unknownConfigKeys(v[key], fieldType, join(key))...)
+			} else {
+				unknown = append(unknown, join(key))
+			}
+		}
+	case []any:
+		if t.Kind() == reflect.Slice {
+			for i, item := range v {
+				unknown = append(unknown, unknownConfigKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	}
+	return unknown
+}
+
+// flattenConfig lists the non-empty settings of an effective configuration
+// in field order, with nested keys like groups[0].alert.log-sink
+func flattenConfig(v reflect.Value, path string) []configSetting {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	var settings []configSetting
+	switch {
+	case v.Kind() == reflect.Struct:
+		for i := range v.NumField() {
+			if name := jsonFieldName(v.Type().Field(i)); name != "" {
+				key := name
+				if path != "" {
+					key = path + "." + name
+				}
+				settings = append(settings, flattenConfig(v.Field(i), key)...)
+			}
+		}
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Struct:
+		for i := range v.Len() {
+			settings = append(settings, flattenConfig(v.Index(i), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+	case v.Kind() == reflect.Slice:
+		if v.Len() > 0 {
+			var items []string
+			for i := range v.Len() {
+				items = append(items, fmt.Sprint(v.Index(i).Interface()))
+			}
+			settings = append(settings, configSetting{Key: path, Value: "[" + strings.Join(items, ", ") + "]"})
+		}
+	case !v.IsZero():
+		settings = append(settings, configSetting{Key: path, Value: fmt.Sprint(v.Interface())})
+	}
+	return settings
+}
+
+// configKeyPart matches one key of a setting path and its optional index
+var configKeyPart = regexp.MustCompile(`^([^\[]+)(?:\[(\d+)\])?$`)
+
+// lookupConfigKey reports whether a parsed config file sets the key path
+func lookupConfigKey(raw any, key string) bool {
+	for _, part := range strings.Split(key, ".") {
+		m := configKeyPart.FindStringSubmatch(part)
+		object, ok := raw.(map[string]any)
+		if m == nil || !ok {
+			return false
+		}
+		found := false
+		for name, value := range object {
+			if strings.EqualFold(name, m[1]) {
+				raw, found = value, true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+		if m[2] != "" {
+			list, _ := raw.([]any)
+			i, _ := strconv.Atoi(m[2])
+			if i >= len(list) {
+				return false
+			}
+			raw = list[i]
+		}
+	}
+	return true
+}
+
+// fimGroupKey matches the group index and setting of a key like groups[1].alert.log-sink
+var fimGroupKey = regexp.MustCompile(`^groups\[(\d+)\]\.([^.\[]+)`)
+
+// fimSettingSource says where an effective fim setting came from. Top-level
+// paths form the first group, which shifts the groups of the file by one.
+func fimSettingSource(raw any, key string) string {
+	m := fimGroupKey.FindStringSubmatch(key)
+	if m == nil {
+		if lookupConfigKey(raw, key) {
+			return "file"
+		}
+		return "default"
+	}
+	group, _ := strconv.Atoi(m[1])
+	if lookupConfigKey(raw, "paths") {
+		group--
+	}
+	switch {
+	case group >= 0 && lookupConfigKey(raw, fmt.Sprintf("groups[%d]%s", group, strings.TrimPrefix(key, "groups["+m[1]+"]"))):
+		return "file"
+	case group < 0 && m[2] == "paths":
+		return "file (paths)"
+	}
+	if inherited := fimInherited[m[2]]; inherited != "" && lookupConfigKey(raw, inherited) {
+		return "file (" + inherited + ")"
+	}
+	return "default"
+}
+
+// redactSetting hides the values of secrets
+func redactSetting(key, value string) string {
+	lower := strings.ToLower(key)
+	if value != "" && (strings.Contains(lower, "token") || strings.Contains(lower, "password")) {
+		return "<redacted>"
+	}
+	return value
+}
+
+// flagSettings lists every flag of a command with where its value came from.
+// The flags are parsed the way the command parses them.
+func flagSettings(fs *flag.FlagSet, args []string) ([]configSetting, []string, error) {
+	fs.SetOutput(os.Stdout)
+	parseArgs(fs, args)
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if err := applyEnv(fs, fs.Name()); err != nil {
+		return nil, nil, err
+	}
+	var settings []configSetting
+	known := map[string]bool{}
+	fs.VisitAll(func(f *flag.Flag) {
+		source := "default"
+		if given[f.Name] {
+			source = "flag"
+		} else if _, ok := os.LookupEnv(envName(fs.Name(), f.Name)); ok {
+			source = "env " + envName(fs.Name(), f.Name)
+		}
+		known[envName(fs.Name(), f.Name)] = true
+		settings = append(settings, configSetting{Key: "-" + f.Name, Value: redactSetting(f.Name, f.Value.String()), Source: source})
+	})
+	// Variables meant for the command that match none of its flags are typos
+	var unknown []string
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		if strings.HasPrefix(name, envName(fs.Name(), "")+"_") && !known[name] {
+			unknown = append(unknown, "environment: "+name)
+		}
+	}
+	sort.Strings(unknown)
+	return settings, unknown, nil
+}
+
+// printSettings prints settings in aligned columns
+func printSettings(title string, settings []configSetting) {
+	fmt.Println(title)
+	keyWidth, valueWidth := 0, 0
+	for _, s := range settings {
+		keyWidth, valueWidth = max(keyWidth, len(s.Key)), max(valueWidth, len(s.Value))
+	}
+	for _, s := range settings {
+		fmt.Printf("  %-*s  %-*s  %s\n", keyWidth, s.Key, valueWidth, s.Value, s.Source)
+	}
+}
+
+// checkConfig validates a config file of the given kind and returns its
+// effective settings and unknown keys. For serve -config, serve holds the
+// parsed flags that override settings, and flags where they came from.
+func checkConfig(path, kind string, serve *serveFlags, flags map[string]configSetting) ([]configSetting, []string, error) {
+	var raw any = map[string]any{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read config: %w", err)
+		}
+		if raw, err = parseYAML(data); err != nil {
+			return nil, nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	if kind == "" {
+		if kind = detectConfigKind(raw); kind == "" {
+			return nil, nil, fmt.Errorf("%s: cannot tell the kind of config file; use -kind fim|serve|rules|case", path)
+		}
+	}
+
+	var effective any
+	var err error
+	source := func(key string) string {
+		if lookupConfigKey(raw, key) {
+			return "file"
+		}
+		return "default"
+	}
+	var unknown []string
+	switch kind {
+	case "fim":
+		unknown = unknownConfigKeys(raw, reflect.TypeFor[FIMConfig](), "")
+		effective, err = LoadFIMConfig(path)
+		source = func(key string) string { return fimSettingSource(raw, key) }
+	case "serve":
+		unknown = unknownConfigKeys(raw, reflect.TypeFor[ServeConfig](), "")
+		if serve == nil {
+			effective, err = LoadServeConfig(path)
+		} else {
+			// The flags take the place of the settings they are named after
+			effective, err = serve.config()
+			fileSource := source
+			source = func(key string) string {
+				if setting, ok := flags["-"+key]; ok && setting.Source != "default" {
+					return setting.Source
+				}
+				return fileSource(key)
+			}
+		}
+	case "rules":
+		unknown = unknownConfigKeys(raw, reflect.TypeFor[RoutingRules](), "")
+		effective, err = LoadRoutingRules(path)
+	case "case":
+		// Case files may hold other documents; only the case block is checked
+		top, _ := raw.(map[string]any)
+		unknown = unknownConfigKeys(top["case"], reflect.TypeFor[CaseInfo](), "case")
+		var info CaseInfo
+		info, err = LoadCaseInfo(path)
+		effective = struct {
+			Case CaseInfo `json:"case"`
+		}{info}
+	default:
+		return nil, nil, fmt.Errorf("unknown config kind %q. Supported: fim, serve, rules, case", kind)
+	}
+	if err != nil {
+		return nil, unknown, err
+	}
+	settings := flattenConfig(reflect.ValueOf(effective), "")
+	for i := range settings {
+		settings[i].Value = redactSetting(settings[i].Key, settings[i].Value)
+		settings[i].Source = source(settings[i].Key)
+	}
+	return settings, unknown, nil
+}
+
+// runConfig implements the config command
+func runConfig(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate config check fim|serve [<command flags>...]")
+		fmt.Println("       hashculate config check <config.yaml> [-kind fim|serve|rules|case]")
+		return 1
+	}
+	if len(args) < 2 || args[0] != "check" {
+		return usage()
+	}
+
+	var unknown []string
+	var flagRows []configSetting
+	var flags map[string]configSetting
+	var serve *serveFlags
+	configPath, kind := "", ""
+	switch target := args[1]; target {
+	case "fim", "serve":
+		var fs *flag.FlagSet
+		if target == "serve" {
+			fs, serve = newServeFlags()
+		} else {
+			fs, _ = newFIMFlags()
+		}
+		rows, unknownEnv, err := flagSettings(fs, args[2:])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		flagRows, unknown, kind = rows, unknownEnv, target
+		flags = map[string]configSetting{}
+		for _, row := range rows {
+			flags[row.Key] = row
+		}
+		configPath = fs.Lookup("config").Value.String()
+	default:
+		fs := flag.NewFlagSet("config check", flag.ExitOnError)
+		kindFlag := fs.String("kind", "", "Kind of config file: fim, serve, rules or case [default: from its keys]")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 1 {
+			return usage()
+		}
+		configPath, kind = positional[0], *kindFlag
+	}
+
+	fileRows, fileUnknown, err := checkConfig(configPath, kind, serve, flags)
+	for _, key := range fileUnknown {
+		unknown = append(unknown, configPath+": "+key)
+	}
+	if flagRows != nil {
+		printSettings(fmt.Sprintf("Flags (%s):", kind), flagRows)
+	}
+	if err == nil {
+		title := "Settings"
+		if configPath != "" {
+			title += " (" + configPath + ")"
+		}
+		printSettings(title+":", fileRows)
+	}
+	if len(unknown) > 0 {
+		fmt.Println("Unknown keys:")
+		for _, key := range unknown {
+			fmt.Printf("  %s\n", key)
+		}
+	}
+	switch {
+	case err != nil:
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	case len(unknown) > 0:
+		fmt.Printf("Error: %d unknown key(s)\n", len(unknown))
+		return 1
+	}
+	fmt.Println("Configuration OK")
+	return 0
+}
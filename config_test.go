@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "fim.yaml")
+	os.WriteFile(path, []byte(`database: /var/lib/fim.json
+interval: 10m
+paths: [/etc]
+alert:
+  log-sink: syslog
+  log-token: secret
+groups:
+  - name: bin
+    paths: [/usr/bin]
+    intervall: 1h
+    alert:
+      log-sink: syslog
+      log-target: udp://siem:514
+      lvl: warn
+`), 0644)
+
+	settings, unknown, err := checkConfig(path, "", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"groups[0].alert.lvl", "groups[0].intervall"}; !reflect.DeepEqual(unknown, want) {
+		t.Errorf("unknown = %v, want %v", unknown, want)
+	}
+	sources := map[string]string{}
+	for _, s := range settings {
+		sources[s.Key] = s.Value + " | " + s.Source
+	}
+	for key, want := range map[string]string{
+		"interval":                   "10m | file",
+		"algorithm":                  "sha256 | default",
+		"alert.log-token":            "<redacted> | file",
+		"groups[0].name":             "default | default",
+		"groups[0].paths":            "[/etc] | file (paths)",
+		"groups[0].interval":         "10m | file (interval)",
+		"groups[1].paths":            "[/usr/bin] | file",
+		"groups[1].alert.log-target": "udp://siem:514 | file",
+		"groups[0].alert.log-token":  "<redacted> | file (alert)",
+	} {
+		if sources[key] != want {
+			t.Errorf("%s = %q, want %q", key, sources[key], want)
+		}
+	}
+
+	os.WriteFile(path, []byte("rules:\n  - pattern: \"*\"\n    algorithms: [sha3]\n"), 0644)
+	if _, _, err := checkConfig(path, "", nil, nil); err == nil || !strings.Contains(err.Error(), "sha3") {
+		t.Errorf("Expected the invalid algorithm to be reported, got %v", err)
+	}
+}
+
+func TestFlagSettings(t *testing.T) {
+	t.Setenv("HASHCULATE_SERVE_LISTEN", ":9000")
+	t.Setenv("HASHCULATE_SERVE_LISTN", ":9001")
+	fs, serve := newServeFlags()
+	settings, unknown, err := flagSettings(fs, []string{"-tls-cert", "cert.pem"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]string{}
+	for _, s := range settings {
+		sources[s.Key] = s.Source
+	}
+	if sources["-tls-cert"] != "flag" || sources["-listen"] != "env HASHCULATE_SERVE_LISTEN" || sources["-drain-timeout"] != "default" {
+		t.Errorf("Sources = %v", sources)
+	}
+	if *serve.listen != ":9000" {
+		t.Errorf("-listen = %q, want the environment's value", *serve.listen)
+	}
+	if len(unknown) != 1 || unknown[0] != "environment: HASHCULATE_SERVE_LISTN" {
+		t.Errorf("unknown = %v", unknown)
+	}
+}
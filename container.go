@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// envPrefix starts the environment variables that stand in for flags
+const envPrefix = "HASHCULATE_"
+
+// envName returns the environment variable for a command's flag, e.g.
+// HASHCULATE_SERVE_LISTEN for serve -listen
+func envName(command, name string) string {
+	key := strings.TrimSpace(command + " " + name)
+	return envPrefix + strings.ToUpper(strings.NewReplacer("-", "_", " ", "_").Replace(key))
+}
+
+// applyEnv sets flags that were not given on the command line from the
+// environment, so containers can be configured without arguments or files
+func applyEnv(fs *flag.FlagSet, command string) error {
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value, ok := os.LookupEnv(envName(command, f.Name))
+		if !ok || given[f.Name] || err != nil {
+			return
+		}
+		if setErr := fs.Set(f.Name, value); setErr != nil {
+			err = fmt.Errorf("%s: %w", envName(command, f.Name), setErr)
+		}
+	})
+	return err
+}
+
+// isTerminal reports whether f is a terminal that can redraw a progress line
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// healthStatus is the state a daemon reports on /healthz
+type healthStatus struct {
+	mu     sync.Mutex
+	failed map[string]error
+}
+
+// Set records the outcome of the named unit of work
+func (h *healthStatus) Set(name string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.failed == nil {
+		h.failed = map[string]error{}
+	}
+	if err == nil {
+		delete(h.failed, name)
+	} else {
+		h.failed[name] = err
+	}
+}
+
+// ServeHTTP answers 200 while nothing has failed and 503 with the errors otherwise
+func (h *healthStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.failed) == 0 {
+		fmt.Fprintln(w, "ok")
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	for name, err := range h.failed {
+		fmt.Fprintf(w, "%s: %v\n", name, err)
+	}
+}
+
+// runHealth implements the health command, a probe for images without curl
+func runHealth(args []string) int {
+	fs := flag.NewFlagSet("health", flag.ExitOnError)
+	timeout := fs.Duration("timeout", 5*time.Second, "How long to wait for an answer")
+	positional := parseFlags(fs, args)
+	if len(positional) > 1 {
+		fmt.Println("Usage: hashculate health [-timeout 5s] [url]")
+		return 1
+	}
+	url := "http://localhost:8080/healthz"
+	if len(positional) == 1 {
+		url = positional[0]
+	}
+
+	client := &http.Client{Timeout: *timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Printf("Error: %s answered %s\n", url, resp.Status)
+		return 1
+	}
+	return 0
+}
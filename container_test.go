@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainerConfig(t *testing.T) {
+	fs := flag.NewFlagSet("db add", flag.ContinueOnError)
+	journal := fs.String("journal", "", "")
+	algorithms := fs.String("a", "sha256", "")
+	dryRun := fs.Bool("dry-run", false, "")
+	t.Setenv("HASHCULATE_DB_ADD_JOURNAL", "/state/db.journal")
+	t.Setenv("HASHCULATE_DB_ADD_A", "md5")
+	t.Setenv("HASHCULATE_DB_ADD_DRY_RUN", "true")
+	if positional := parseFlags(fs, []string{"-a", "sha1", "db.json"}); len(positional) != 1 {
+		t.Fatalf("unexpected positional arguments: %v", positional)
+	}
+	// The command line wins over the environment
+	if *journal != "/state/db.journal" || *algorithms != "sha1" || !*dryRun {
+		t.Errorf("unexpected flags: journal=%q a=%q dry-run=%v", *journal, *algorithms, *dryRun)
+	}
+	t.Setenv("HASHCULATE_DB_ADD_DRY_RUN", "maybe")
+	if err := applyEnv(flag.NewFlagSet("db add", flag.ContinueOnError), "db add"); err != nil {
+		t.Errorf("unknown flags should be ignored: %v", err)
+	}
+	fs = flag.NewFlagSet("db add", flag.ContinueOnError)
+	fs.Bool("dry-run", false, "")
+	if err := applyEnv(fs, "db add"); err == nil {
+		t.Error("expected an error for an invalid boolean")
+	}
+
+	f, _ := os.Create(filepath.Join(t.TempDir(), "log"))
+	defer f.Close()
+	if isTerminal(f) {
+		t.Error("a regular file is not a terminal")
+	}
+
+	health := &healthStatus{}
+	health.Set("group etc", errors.New("permission denied"))
+	rec := httptest.NewRecorder()
+	health.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != "group etc: permission denied\n" {
+		t.Errorf("unexpected failing health: %d %q", rec.Code, rec.Body.String())
+	}
+	health.Set("group etc", nil)
+	rec = httptest.NewRecorder()
+	health.ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected a healthy monitor, got %d", rec.Code)
+	}
+}
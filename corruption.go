@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ByteRange is a half-open range of file offsets
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// CorruptionReport is the block-level comparison of a known-good and a damaged copy
+type CorruptionReport struct {
+	BlockSize   int64
+	GoodSize    int64
+	BadSize     int64
+	Blocks      int64
+	BadBlocks   int64
+	Ranges      []ByteRange
+	BytesInDiff int64
+}
+
+// LocateCorruption hashes both readers block by block and returns the ranges
+// of blocks whose hashes differ, merging adjacent blocks. Bytes present in only
+// one copy count as differing.
+func LocateCorruption(good, bad io.Reader, blockSize int64) (*CorruptionReport, error) {
+	report := &CorruptionReport{BlockSize: blockSize}
+	goodBlock, badBlock := make([]byte, blockSize), make([]byte, blockSize)
+	for offset := int64(0); ; offset += blockSize {
+		g, err := readBlock(good, goodBlock)
+		if err != nil {
+			return nil, fmt.Errorf("reading known-good copy: %w", err)
+		}
+		b, err := readBlock(bad, badBlock)
+		if err != nil {
+			return nil, fmt.Errorf("reading damaged copy: %w", err)
+		}
+		if g == 0 && b == 0 {
+			break
+		}
+		report.GoodSize += int64(g)
+		report.BadSize += int64(b)
+		report.Blocks++
+		if g == b && sha256.Sum256(goodBlock[:g]) == sha256.Sum256(badBlock[:b]) {
+			continue
+		}
+
+		report.BadBlocks++
+		end := offset + int64(max(g, b))
+		report.BytesInDiff += end - offset
+		if n := len(report.Ranges); n > 0 && report.Ranges[n-1].End == offset {
+			report.Ranges[n-1].End = end
+		} else {
+			report.Ranges = append(report.Ranges, ByteRange{Start: offset, End: end})
+		}
+	}
+	return report, nil
+}
+
+// readBlock fills block as far as the reader allows
+func readBlock(r io.Reader, block []byte) (int, error) {
+	n, err := io.ReadFull(r, block)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+	return n, err
+}
+
+// Localized reports whether the damage is confined to one range covering at
+// most a hundredth of the file
+func (r *CorruptionReport) Localized() bool {
+	return len(r.Ranges) == 1 && r.BytesInDiff*100 <= max(r.GoodSize, r.BadSize)
+}
+
+// runLocateCorruption implements the locate-corruption command
+func runLocateCorruption(args []string) int {
+	fs := flag.NewFlagSet("locate-corruption", flag.ExitOnError)
+	blockKB := fs.Int("block", 4, "Block size in KB")
+	limit := fs.Int("limit", 50, "Print at most this many ranges (0 for all)")
+	positional := parseFlags(fs, args)
+	if len(positional) != 2 || *blockKB <= 0 {
+		fmt.Println("Usage: hashculate locate-corruption <good> <bad> [-block <KB>] [-limit <n>]")
+		return 1
+	}
+
+	var files [2]*os.File
+	for i, path := range positional {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		files[i] = f
+	}
+	report, err := LocateCorruption(files[0], files[1], int64(*blockKB)*1024)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Block size: %d bytes\n", report.BlockSize)
+	fmt.Printf("Good: %s (%d bytes)\n", positional[0], report.GoodSize)
+	fmt.Printf("Bad:  %s (%d bytes)\n", positional[1], report.BadSize)
+	if len(report.Ranges) == 0 {
+		fmt.Println()
+		fmt.Println("The files are identical")
+		return 0
+	}
+
+	fmt.Println()
+	fmt.Println("Differing ranges:")
+	for i, r := range report.Ranges {
+		if *limit > 0 && i == *limit {
+			fmt.Printf("  ... %d more\n", len(report.Ranges)-i)
+			break
+		}
+		first, last := r.Start/report.BlockSize, (r.End-1)/report.BlockSize
+		blocks := fmt.Sprintf("block %d", first)
+		if last > first {
+			blocks = fmt.Sprintf("blocks %d-%d", first, last)
+		}
+		fmt.Printf("  0x%08x-0x%08x  %s, %s\n", r.Start, r.End-1, markdownSize(r.End-r.Start), blocks)
+	}
+
+	fmt.Println()
+	fmt.Printf("%d range(s), %d of %d blocks differ (%s, %.2f%%)\n", len(report.Ranges), report.BadBlocks,
+		report.Blocks, markdownSize(report.BytesInDiff), float64(report.BadBlocks)*100/float64(report.Blocks))
+	switch {
+	case report.BadSize < report.GoodSize:
+		fmt.Printf("The damaged copy is truncated by %d bytes\n", report.GoodSize-report.BadSize)
+	case report.BadSize > report.GoodSize:
+		fmt.Printf("The damaged copy has %d extra bytes\n", report.BadSize-report.GoodSize)
+	}
+	if report.Localized() {
+		fmt.Println("The corruption is localized")
+	} else {
+		fmt.Println("The corruption is spread across the file")
+	}
+	return 1
+}
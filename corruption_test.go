@@ -0,0 +1,37 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLocateCorruption(t *testing.T) {
+	good := bytes.Repeat([]byte("0123456789abcdef"), 1024) // 16 blocks of 1 KiB
+	bad := append([]byte(nil), good...)
+	bad[100] = 'X'
+	bad[5*1024+1] = 'X'
+	bad[6*1024+2] = 'X'
+	bad = bad[:15*1024+512]
+
+	report, err := LocateCorruption(bytes.NewReader(good), bytes.NewReader(bad), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ByteRange{{0, 1024}, {5 * 1024, 7 * 1024}, {15 * 1024, 16 * 1024}}
+	if len(report.Ranges) != len(want) {
+		t.Fatalf("expected ranges %v, got %v", want, report.Ranges)
+	}
+	for i := range want {
+		if report.Ranges[i] != want[i] {
+			t.Errorf("range %d: expected %v, got %v", i, want[i], report.Ranges[i])
+		}
+	}
+	if report.Blocks != 16 || report.BadBlocks != 4 || report.BadSize != int64(len(bad)) || report.Localized() {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	report, _ = LocateCorruption(bytes.NewReader(good), bytes.NewReader(good), 1024)
+	if len(report.Ranges) != 0 {
+		t.Errorf("identical copies reported as different: %v", report.Ranges)
+	}
+}
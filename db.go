@@ -0,0 +1,646 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBEntry is the recorded state of one file in the hash database
+type DBEntry struct {
+	Path     string                   `json:"path"`
+	Size     int64                    `json:"size"`
+	Modified time.Time                `json:"modified,omitzero"`
+	Hashes   map[HashAlgorithm]string `json:"hashes"`
+	Recorded time.Time                `json:"recorded,omitzero"`
+	Rule     string                   `json:"rule,omitempty"`   // Routing rule pattern that chose the algorithms
+	Meta     *FileMeta                `json:"meta,omitempty"`   // Permissions, with db add -permissions
+	Label    string                   `json:"label,omitempty"`  // Security label, with db add -labels
+	Deleted  time.Time                `json:"deleted,omitzero"` // When a retired file was found missing
+}
+
+// HashDB is a database of file hashes kept in a JSON file
+type HashDB struct {
+	path    string
+	entries map[string]*DBEntry
+	deleted map[string]*DBEntry // Retired entries of deleted files, kept until they expire
+
+	Backups    int            // Copies of the previous version Save keeps as <path>.1 (newest) to <path>.<n>
+	Parameters *RunParameters // Settings of the last run that added to it
+}
+
+// hashDBFile is the on-disk layout of the database
+type hashDBFile struct {
+	Version    int            `json:"version"`
+	Parameters *RunParameters `json:"parameters,omitempty"`
+	Entries    []DBEntry      `json:"entries"`
+	Deleted    []DBEntry      `json:"deleted,omitempty"`
+}
+
+// OpenHashDB loads a hash database, starting empty when the file does not exist
+func OpenHashDB(path string) (*HashDB, error) {
+	db := &HashDB{path: path, entries: map[string]*DBEntry{}, deleted: map[string]*DBEntry{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return db, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hash database: %w", err)
+	}
+	var file hashDBFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid hash database %s: %w", path, err)
+	}
+	for i := range file.Entries {
+		db.entries[file.Entries[i].Path] = &file.Entries[i]
+	}
+	for i := range file.Deleted {
+		db.deleted[file.Deleted[i].Path] = &file.Deleted[i]
+	}
+	db.Parameters = file.Parameters
+	return db, nil
+}
+
+// Save writes the database atomically, rotating its backups
+func (db *HashDB) Save() error {
+	data, err := json.MarshalIndent(hashDBFile{Version: 1, Parameters: db.Parameters, Entries: db.Entries(), Deleted: db.Deleted()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode hash database: %w", err)
+	}
+	if err := writeFileAtomic(db.path, append(data, '\n'), 0644, db.Backups); err != nil {
+		if isDiskFull(err) {
+			return fmt.Errorf("failed to write hash database, %s is unchanged: %w", db.path, err)
+		}
+		return fmt.Errorf("failed to write hash database: %w", err)
+	}
+	return nil
+}
+
+// SetParameters records the settings of a run adding to the database and
+// returns where they differ from those of the run before
+func (db *HashDB) SetParameters(params *RunParameters) []string {
+	var drift []string
+	if db.Parameters != nil {
+		drift = db.Parameters.Drift(params)
+	}
+	db.Parameters = params
+	return drift
+}
+
+// Entries returns all entries ordered by path
+func (db *HashDB) Entries() []DBEntry {
+	entries := make([]DBEntry, 0, len(db.entries))
+	for _, entry := range db.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// Get returns the entry recorded for path
+func (db *HashDB) Get(path string) (DBEntry, bool) {
+	entry, ok := db.entries[dbKey(path)]
+	if !ok {
+		return DBEntry{}, false
+	}
+	return *entry, true
+}
+
+// Put adds or replaces an entry
+func (db *HashDB) Put(entry DBEntry) {
+	entry.Path = dbKey(entry.Path)
+	entry.Deleted = time.Time{}
+	db.entries[entry.Path] = &entry
+	delete(db.deleted, entry.Path)
+}
+
+// Delete removes the entry for path
+func (db *HashDB) Delete(path string) {
+	delete(db.entries, dbKey(path))
+	delete(db.deleted, dbKey(path))
+}
+
+// dbKey normalizes a path so entries match across platforms
+func dbKey(path string) string {
+	return filepath.ToSlash(filepath.Clean(path))
+}
+
+// HashFileEntry hashes a file with every algorithm in one pass and describes it as a database entry
+func HashFileEntry(calc *HashCalculator, path string, algorithms []HashAlgorithm) (DBEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return DBEntry{}, err
+	}
+	results, err := calc.CalculateFileDigests(path, algorithms, nil)
+	if err != nil {
+		return DBEntry{}, err
+	}
+	entry := DBEntry{Path: dbKey(path), Size: results[0].FileSize, Modified: info.ModTime().UTC(), Hashes: map[HashAlgorithm]string{}, Recorded: time.Now().UTC()}
+	for _, result := range results {
+		entry.Hashes[result.Algorithm] = result.Hash
+	}
+	return entry, nil
+}
+
+// dbAlgorithms lists the algorithms used by any entry, strongest first
+func dbAlgorithms(entries []DBEntry) []HashAlgorithm {
+	var algorithms []HashAlgorithm
+	for _, alg := range algorithmStrength {
+		for _, entry := range entries {
+			if entry.Hashes[alg] != "" {
+				algorithms = append(algorithms, alg)
+				break
+			}
+		}
+	}
+	return algorithms
+}
+
+// hashdeepAlgorithms are the hashdeep column names for the algorithms both tools support
+var hashdeepAlgorithms = []HashAlgorithm{MD5, SHA1, SHA256}
+
+// Export writes the database as csv, ndjson or hashdeep
+func (db *HashDB) Export(w io.Writer, format string) error {
+	entries := db.Entries()
+	switch format {
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "csv":
+		algorithms := dbAlgorithms(entries)
+		writer := csv.NewWriter(w)
+		header := []string{"path", "size", "modified"}
+		routed := false
+		for _, entry := range entries {
+			routed = routed || entry.Rule != ""
+		}
+		if routed {
+			header = append(header, "rule")
+		}
+		for _, alg := range algorithms {
+			header = append(header, string(alg))
+		}
+		writer.Write(header)
+		for _, entry := range entries {
+			modified := ""
+			if !entry.Modified.IsZero() {
+				modified = entry.Modified.Format(time.RFC3339)
+			}
+			row := []string{entry.Path, strconv.FormatInt(entry.Size, 10), modified}
+			if routed {
+				row = append(row, entry.Rule)
+			}
+			for _, alg := range algorithms {
+				row = append(row, entry.Hashes[alg])
+			}
+			writer.Write(row)
+		}
+		writer.Flush()
+		return writer.Error()
+
+	case "hashdeep":
+		// hashdeep needs every hash on every line, so only algorithms all entries share are used
+		var algorithms []HashAlgorithm
+		for _, alg := range hashdeepAlgorithms {
+			shared := len(entries) > 0
+			for _, entry := range entries {
+				shared = shared && entry.Hashes[alg] != ""
+			}
+			if shared {
+				algorithms = append(algorithms, alg)
+			}
+		}
+		if len(algorithms) == 0 && len(entries) > 0 {
+			return fmt.Errorf("hashdeep export needs md5, sha1 or sha256 hashes recorded for every file")
+		}
+		columns := []string{"size"}
+		for _, alg := range algorithms {
+			columns = append(columns, string(alg))
+		}
+		columns = append(columns, "filename")
+		fmt.Fprintln(w, "%%%% HASHDEEP-1.0")
+		fmt.Fprintf(w, "%%%%%%%% %s\n", strings.Join(columns, ","))
+		fmt.Fprintln(w, "## Exported by hashculate")
+		fmt.Fprintln(w, "##")
+		for _, entry := range entries {
+			fields := []string{strconv.FormatInt(entry.Size, 10)}
+			for _, alg := range algorithms {
+				fields = append(fields, entry.Hashes[alg])
+			}
+			fmt.Fprintln(w, strings.Join(append(fields, entry.Path), ","))
+		}
+		return nil
+
+	case "parquet":
+		routed := false
+		for _, entry := range entries {
+			routed = routed || entry.Rule != ""
+		}
+		writer, err := NewParquetWriter(w, dbAlgorithms(entries), routed)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := writer.Write(entry); err != nil {
+				return err
+			}
+		}
+		return writer.Close()
+	}
+	return fmt.Errorf("unsupported format: %s. Supported: csv, ndjson, hashdeep, parquet", format)
+}
+
+// Import merges entries from csv, ndjson or hashdeep data, returning how many were read
+func (db *HashDB) Import(r io.Reader, format string) (int, error) {
+	count := 0
+	switch format {
+	case "ndjson":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var entry DBEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Path == "" {
+				return count, fmt.Errorf("line %d: invalid entry", line)
+			}
+			db.Put(entry)
+			count++
+		}
+		return count, scanner.Err()
+
+	case "csv":
+		reader := csv.NewReader(r)
+		header, err := reader.Read()
+		if err != nil {
+			return 0, fmt.Errorf("missing CSV header: %w", err)
+		}
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, ok := columns["path"]; !ok {
+			return 0, fmt.Errorf("CSV header has no path column")
+		}
+		for {
+			row, err := reader.Read()
+			if err == io.EOF {
+				return count, nil
+			}
+			if err != nil {
+				return count, err
+			}
+			entry := DBEntry{Path: row[columns["path"]], Hashes: map[HashAlgorithm]string{}}
+			if i, ok := columns["size"]; ok {
+				entry.Size, _ = strconv.ParseInt(row[i], 10, 64)
+			}
+			if i, ok := columns["modified"]; ok && row[i] != "" {
+				entry.Modified, _ = time.Parse(time.RFC3339, row[i])
+			}
+			if i, ok := columns["rule"]; ok {
+				entry.Rule = row[i]
+			}
+			for _, alg := range algorithmStrength {
+				if i, ok := columns[string(alg)]; ok && row[i] != "" {
+					entry.Hashes[alg] = strings.ToLower(row[i])
+				}
+			}
+			db.Put(entry)
+			count++
+		}
+
+	case "hashdeep":
+		scanner := bufio.NewScanner(r)
+		var columns []string
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimRight(scanner.Text(), "\r")
+			if spec, ok := strings.CutPrefix(text, "%%%% "); ok {
+				if !strings.HasPrefix(spec, "HASHDEEP") {
+					columns = strings.Split(spec, ",")
+				}
+				continue
+			}
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			if columns == nil {
+				return count, fmt.Errorf("not a hashdeep file: missing header")
+			}
+			// The filename is last and may itself contain commas
+			fields := strings.SplitN(text, ",", len(columns))
+			if len(fields) != len(columns) {
+				return count, fmt.Errorf("line %d: expected %d fields", line, len(columns))
+			}
+			entry := DBEntry{Hashes: map[HashAlgorithm]string{}}
+			for i, column := range columns {
+				switch column {
+				case "size":
+					entry.Size, _ = strconv.ParseInt(fields[i], 10, 64)
+				case "filename":
+					entry.Path = fields[i]
+				default:
+					if alg, err := parseAlgorithm(column); err == nil {
+						entry.Hashes[alg] = strings.ToLower(fields[i])
+					}
+				}
+			}
+			db.Put(entry)
+			count++
+		}
+		return count, scanner.Err()
+	}
+	return 0, fmt.Errorf("unsupported format: %s. Supported: csv, ndjson, hashdeep", format)
+}
+
+// parseAlgorithmList parses a comma-separated list of algorithms
+func parseAlgorithmList(list string) ([]HashAlgorithm, error) {
+	var algorithms []HashAlgorithm
+	for _, name := range strings.Split(list, ",") {
+		alg, err := parseAlgorithm(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		algorithms = append(algorithms, alg)
+	}
+	return algorithms, nil
+}
+
+// runDB implements the db command
+func runDB(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate db add <db.json> <file|dir>... [-a sha256,md5] [-rules <rules.yaml>]")
+		fmt.Println("           [-permissions] [-labels] [-journal <path>] [-control <socket>] [-clones] [-warm-cache] [-backups <n>] [-record-host]")
+		fmt.Println("       hashculate db export <db.json> [-format csv|ndjson|hashdeep|parquet] [-encrypt-to <recipients>]")
+		fmt.Println("       hashculate db import <db.json> <file> [-format csv|ndjson|hashdeep] [-backups <n>]")
+		fmt.Println("       hashculate db vacuum <db.json> [-expire 30d] [-keep <n>] [-missing] [-dry-run] [-backups <n>]")
+		fmt.Println("       hashculate db diff -from <snap1.json> -to <snap2.json> [-filter \"<query>\"] [-output json]")
+		return 1
+	}
+	if len(args) > 0 && args[0] == "diff" {
+		return runDBDiff(args[1:])
+	}
+	if len(args) < 2 {
+		return usage()
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("db "+action, flag.ExitOnError)
+	format := fs.String("format", "ndjson", "Export format: csv, ndjson, hashdeep, parquet; import format: csv, ndjson, hashdeep")
+	algorithmList := fs.String("a", "sha256", "Comma-separated algorithms for db add")
+	journalPath := fs.String("journal", "", "Journal of finished files for resuming db add [default: <db.json>.journal]")
+	controlPath := fs.String("control", "", "Unix socket accepting pause, resume, stop and status commands during db add")
+	rulesFile := fs.String("rules", "", "YAML rules choosing algorithms by file pattern for db add (-a covers unmatched files)")
+	permissions := fs.Bool("permissions", false, "db add: record each file's mode, owner, group, ACL and capabilities")
+	labels := fs.Bool("labels", false, "db add: record each file's SELinux or Smack security label (Linux)")
+	encryptTo := fs.String("encrypt-to", "", "Encrypt the export to age or PGP recipients (comma-separated)")
+	expire := fs.String("expire", "30d", "db vacuum: drop entries of files deleted longer ago than this")
+	keep := fs.Int("keep", 0, "db vacuum: keep only the newest N snapshots (0 leaves them alone)")
+	missing := fs.Bool("missing", false, "db vacuum: retire entries whose files no longer exist on this machine")
+	dryRun := fs.Bool("dry-run", false, "db vacuum: report what would be removed without changing anything")
+	clones := fs.Bool("clones", false, "db add: hash files that share their data on disk (clones, hard links) once")
+	warmCache := fs.Bool("warm-cache", false, "db add: read files into the page cache a little ahead of hashing them")
+	backups := fs.Int("backups", 0, "Keep this many copies of the previous database as <db.json>.1 … when saving")
+	recordHost := fs.Bool("record-host", false, "db add: record the hostname in the database's parameters")
+	positional := parseFlags(fs, args[1:])
+	if len(positional) == 0 {
+		return usage()
+	}
+	db, err := OpenHashDB(positional[0])
+	if err == nil && *backups < 0 {
+		err = fmt.Errorf("-backups must not be negative")
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	db.Backups = *backups
+
+	switch action {
+	case "add":
+		algorithms, err := parseAlgorithmList(*algorithmList)
+		if err != nil || len(positional) < 2 {
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return usage()
+		}
+		var rules *RoutingRules
+		if *rulesFile != "" {
+			if rules, err = LoadRoutingRules(*rulesFile); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+		}
+		if *journalPath == "" {
+			*journalPath = positional[0] + ".journal"
+		}
+		journal, err := OpenScanJournal(*journalPath)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if journal.Resumed() > 0 {
+			fmt.Printf("Resuming: %d file(s) already hashed according to %s\n", journal.Resumed(), *journalPath)
+		}
+		control := NewScanControl()
+		control.HandleSignals()
+		if *controlPath != "" {
+			listener, err := control.Listen(*controlPath)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			defer os.Remove(*controlPath)
+			defer listener.Close()
+		}
+
+		calc := NewHashCalculator()
+		if *clones {
+			calc.Clones = newCloneCache()
+		}
+		if *warmCache {
+			calc.Warm = newCacheWarmer()
+			defer calc.Warm.stop()
+		}
+		params := newRunParameters(algorithms, calc.ChunkSize, *recordHost)
+		if *rulesFile != "" {
+			params.Options = append(params.Options, "rules="+*rulesFile)
+		}
+		if *permissions {
+			params.Options = append(params.Options, "permissions")
+		}
+		if *labels {
+			params.Options = append(params.Options, "labels")
+		}
+		for _, drift := range db.SetParameters(params) {
+			fmt.Printf("Settings drift since the last run: %s\n", drift)
+		}
+		added, resumed := 0, 0
+		for _, root := range positional[1:] {
+			files, err := listFiles(root)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			calc.Warm.start(files)
+			for _, path := range files {
+				paused := func() {
+					control.SetStatus(fmt.Sprintf("%d file(s) done", added))
+					fmt.Printf("Paused after %d file(s)\n", added)
+				}
+				if !control.Between(paused) {
+					journal.Close(false)
+					fmt.Printf("Stopped after %d file(s); run the same command to resume from %s\n", added, *journalPath)
+					return 1
+				}
+				control.SetStatus(fmt.Sprintf("%d file(s) done, hashing %s", added, path))
+				var rule *RoutingRule
+				if rules != nil {
+					rule = rules.Route(relativeSlashPath(root, path))
+				}
+				chosen := algorithms
+				if rule != nil {
+					chosen = rule.algorithms
+				}
+				if entry, ok := journal.Done(path, chosen); ok && (entry.Meta != nil || !*permissions) && (entry.Label != "" || !*labels) {
+					db.Put(entry)
+					added++
+					resumed++
+					continue
+				}
+				entry, err := HashFileEntry(calc, path, chosen)
+				if err == nil {
+					if rule != nil {
+						entry.Rule = rule.Pattern
+					}
+					if *permissions {
+						entry.Meta, err = ReadFileMeta(path)
+					}
+					if *labels {
+						entry.Label = readSecurityLabel(path)
+					}
+				}
+				if err == nil {
+					err = journal.Record(entry)
+				}
+				if err != nil {
+					journal.Close(false)
+					fmt.Printf("Error: %s: %v\n", path, err)
+					return 1
+				}
+				db.Put(entry)
+				added++
+			}
+		}
+		if err := db.Save(); err != nil {
+			journal.Close(false)
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if err := journal.Close(true); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Recorded %d file(s) in %s\n", added, positional[0])
+		if resumed > 0 {
+			fmt.Printf("%d of them were taken from the journal of an earlier run\n", resumed)
+		}
+		calc.Clones.Print()
+		return 0
+
+	case "export":
+		recipients, err := ParseEncryptRecipients(*encryptTo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		stdout, err := recipients.Writer(os.Stdout)
+		if err == nil {
+			err = db.Export(stdout, *format)
+			if closeErr := stdout.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+
+	case "import":
+		if len(positional) != 2 {
+			return usage()
+		}
+		file, err := os.Open(positional[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		count, err := db.Import(file, *format)
+		if err == nil {
+			err = db.Save()
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Imported %d entries into %s\n", count, positional[0])
+		return 0
+
+	case "vacuum":
+		age, err := parseRetentionAge(*expire)
+		if err == nil && *keep < 0 {
+			err = fmt.Errorf("-keep must not be negative")
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		now := time.Now()
+		before := fileSize(positional[0])
+		retired := 0
+		if *missing {
+			retired = db.RetireMissing(now)
+		}
+		expired := db.Expire(now.Add(-age))
+		var snapshots []string
+		if *keep > 0 {
+			if snapshots, err = pruneSnapshots(positional[0], *keep, *dryRun); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+		}
+		verb, retiredVerb := "Removed", "were"
+		if *dryRun {
+			verb, retiredVerb = "Would remove", "would be"
+		} else if err := db.Save(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if *missing {
+			fmt.Printf("%d file(s) no longer exist and %s retired\n", retired, retiredVerb)
+		}
+		fmt.Printf("%s %d expired entries and %d snapshot(s); %d deleted file(s) are still kept\n", verb, expired, len(snapshots), len(db.Deleted()))
+		if !*dryRun {
+			fmt.Printf("%s: %s -> %s\n", positional[0], markdownSize(before), markdownSize(fileSize(positional[0])))
+		}
+		return 0
+	}
+	return usage()
+}
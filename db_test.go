@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHashDBExportImport(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(dir, "b, with comma.txt"), []byte("beta"), 0644)
+
+	db, _ := OpenHashDB(filepath.Join(dir, "hashes.json"))
+	files, _ := listFiles(dir)
+	for _, path := range files {
+		entry, err := HashFileEntry(NewHashCalculator(), path, []HashAlgorithm{SHA256, MD5})
+		if err != nil {
+			t.Fatalf("Failed to hash %s: %v", path, err)
+		}
+		db.Put(entry)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	db, _ = OpenHashDB(filepath.Join(dir, "hashes.json"))
+
+	for _, format := range []string{"csv", "ndjson", "hashdeep"} {
+		var exported bytes.Buffer
+		if err := db.Export(&exported, format); err != nil {
+			t.Fatalf("%s export failed: %v", format, err)
+		}
+		imported, _ := OpenHashDB(filepath.Join(dir, format+".json"))
+		count, err := imported.Import(&exported, format)
+		if err != nil || count != 2 {
+			t.Fatalf("%s import read %d entries: %v", format, count, err)
+		}
+		for _, want := range db.Entries() {
+			got, ok := imported.Get(want.Path)
+			if !ok || got.Size != want.Size || got.Hashes[SHA256] != want.Hashes[SHA256] || got.Hashes[MD5] != want.Hashes[MD5] {
+				t.Errorf("%s round trip of %s: got %+v, want %+v", format, want.Path, got, want)
+			}
+		}
+	}
+
+	var hashdeep bytes.Buffer
+	db.Export(&hashdeep, "hashdeep")
+	if !strings.HasPrefix(hashdeep.String(), "%%%% HASHDEEP-1.0\n%%%% size,md5,sha256,filename\n") {
+		t.Errorf("Unexpected hashdeep header:\n%s", hashdeep.String())
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// DBChange is a file recorded in both scans whose content differs
+type DBChange struct {
+	Path      string        `json:"path"`
+	Algorithm HashAlgorithm `json:"algorithm,omitempty"` // empty when only the size shows the change
+	FromHash  string        `json:"fromHash,omitempty"`
+	ToHash    string        `json:"toHash,omitempty"`
+	FromSize  int64         `json:"fromSize"`
+	ToSize    int64         `json:"toSize"`
+}
+
+// DBDiff is what changed between two scans recorded in hash databases
+type DBDiff struct {
+	Added      []DBEntry  `json:"added"`
+	Removed    []DBEntry  `json:"removed"`
+	Changed    []DBChange `json:"changed"`
+	Moved      []FileMove `json:"moved"`
+	Unchanged  int        `json:"unchanged"`
+	Unverified []string   `json:"unverified"` // same size, but no algorithm recorded in both scans
+}
+
+// DiffHashDBs compares two scans of the same root. A file recorded in both
+// has changed when a digest of an algorithm both scans recorded differs, or
+// its size does. Removed and added files with the same digest are reported
+// as moved.
+func DiffHashDBs(from, to []DBEntry) DBDiff {
+	diff := DBDiff{Added: []DBEntry{}, Removed: []DBEntry{}, Changed: []DBChange{}, Moved: []FileMove{}, Unverified: []string{}}
+	old := map[string]DBEntry{}
+	for _, entry := range from {
+		old[entry.Path] = entry
+	}
+	removed := map[string]DBEntry{}
+	for p, entry := range old {
+		removed[p] = entry
+	}
+	added := map[string]DBEntry{}
+	for _, entry := range to {
+		before, ok := old[entry.Path]
+		if !ok {
+			added[entry.Path] = entry
+			continue
+		}
+		delete(removed, entry.Path)
+		change := DBChange{Path: entry.Path, FromSize: before.Size, ToSize: entry.Size}
+		for _, alg := range algorithmStrength {
+			if before.Hashes[alg] != "" && entry.Hashes[alg] != "" {
+				change.Algorithm, change.FromHash, change.ToHash = alg, before.Hashes[alg], entry.Hashes[alg]
+				break
+			}
+		}
+		switch {
+		case change.Algorithm != "" && !strings.EqualFold(change.FromHash, change.ToHash), change.FromSize != change.ToSize:
+			diff.Changed = append(diff.Changed, change)
+		case change.Algorithm == "":
+			diff.Unverified = append(diff.Unverified, entry.Path)
+		default:
+			diff.Unchanged++
+		}
+	}
+
+	// Match moves one algorithm at a time, strongest first
+	for _, alg := range algorithmStrength {
+		missing, found := map[string]string{}, map[string]string{}
+		for p, entry := range removed {
+			if digest := entry.Hashes[alg]; digest != "" {
+				missing[p] = strings.ToLower(digest)
+			}
+		}
+		for p, entry := range added {
+			if digest := entry.Hashes[alg]; digest != "" {
+				found[p] = strings.ToLower(digest)
+			}
+		}
+		for _, move := range matchMoves(missing, found) {
+			diff.Moved = append(diff.Moved, move)
+			delete(removed, move.From)
+			delete(added, move.To)
+		}
+	}
+	slices.SortFunc(diff.Moved, func(a, b FileMove) int { return strings.Compare(a.To, b.To) })
+	for _, entry := range to {
+		if _, ok := added[entry.Path]; ok {
+			diff.Added = append(diff.Added, entry)
+		}
+	}
+	for _, entry := range from {
+		if _, ok := removed[entry.Path]; ok {
+			diff.Removed = append(diff.Removed, entry)
+		}
+	}
+	return diff
+}
+
+// filter keeps the files a query matches, testing the scan that has them:
+// the later one except for removed files
+func (d *DBDiff) filter(match entryFilter, from, to *HashDB) {
+	d.Added = slices.DeleteFunc(d.Added, func(e DBEntry) bool { return !match(e) })
+	d.Removed = slices.DeleteFunc(d.Removed, func(e DBEntry) bool { return !match(e) })
+	d.Changed = slices.DeleteFunc(d.Changed, func(c DBChange) bool {
+		entry, _ := to.Get(c.Path)
+		return !match(entry)
+	})
+	d.Moved = slices.DeleteFunc(d.Moved, func(m FileMove) bool {
+		entry, _ := to.Get(m.To)
+		return !match(entry)
+	})
+	d.Unverified = slices.DeleteFunc(d.Unverified, func(p string) bool {
+		entry, _ := to.Get(p)
+		return !match(entry)
+	})
+}
+
+// runDBDiff implements db diff
+func runDBDiff(args []string) int {
+	fs := flag.NewFlagSet("db diff", flag.ExitOnError)
+	fromPath := fs.String("from", "", "Database of the earlier scan")
+	toPath := fs.String("to", "", "Database of the later scan")
+	query := fs.String("filter", "", "Only report files matching a query filter, e.g. \"size > 1GB\"")
+	only := fs.String("only", "", "Comma-separated kinds to report: added, removed, changed, moved")
+	output := fs.String("output", "text", "Output format: text or json")
+	report, args, err := splitReportArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	positional := parseFlags(fs, args)
+	if *fromPath == "" && *toPath == "" && len(positional) == 2 {
+		*fromPath, *toPath, positional = positional[0], positional[1], nil
+	}
+	if *fromPath == "" || *toPath == "" || len(positional) != 0 || (*output != "text" && *output != "json") {
+		fmt.Println("Usage: hashculate db diff -from <snap1.json> -to <snap2.json> [-filter \"<query>\"]")
+		fmt.Println("           [-only added,removed,changed,moved] [-output text|json] [-report html <out.html>]")
+		return 1
+	}
+	kinds := map[string]bool{"added": true, "removed": true, "changed": true, "moved": true}
+	if *only != "" {
+		kinds = map[string]bool{}
+		for _, kind := range strings.Split(*only, ",") {
+			kind = strings.ToLower(strings.TrimSpace(kind))
+			if kind != "added" && kind != "removed" && kind != "changed" && kind != "moved" {
+				fmt.Printf("Error: unknown kind %q. Supported: added, removed, changed, moved\n", kind)
+				return 1
+			}
+			kinds[kind] = true
+		}
+	}
+	match, err := ParseQuery(*query)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	var dbs [2]*HashDB
+	for i, p := range []string{*fromPath, *toPath} {
+		if _, err := os.Stat(p); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if dbs[i], err = OpenHashDB(p); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+	from, to := dbs[0].Entries(), dbs[1].Entries()
+	diff := DiffHashDBs(from, to)
+	diff.filter(match, dbs[0], dbs[1])
+	if !kinds["added"] {
+		diff.Added = []DBEntry{}
+	}
+	if !kinds["removed"] {
+		diff.Removed = []DBEntry{}
+	}
+	if !kinds["changed"] {
+		diff.Changed, diff.Unverified = []DBChange{}, []string{}
+	}
+	if !kinds["moved"] {
+		diff.Moved = []FileMove{}
+	}
+
+	var recorded []string
+	for _, entry := range from {
+		recorded = append(recorded, entry.Path)
+	}
+	if report != nil {
+		var rows []ReportRow
+		for _, c := range diff.Changed {
+			row := ReportRow{Path: c.Path, Status: "CHANGED", Expected: c.FromHash, Actual: c.ToHash}
+			if c.Algorithm != "" {
+				row.Algorithm = getAlgorithmName(c.Algorithm)
+			}
+			if c.FromSize != c.ToSize {
+				row.Detail = fmt.Sprintf("size %d → %d bytes", c.FromSize, c.ToSize)
+			}
+			rows = append(rows, row)
+		}
+		for _, e := range diff.Removed {
+			rows = append(rows, ReportRow{Path: e.Path, Status: "REMOVED", Detail: markdownSize(e.Size)})
+		}
+		for _, e := range diff.Added {
+			rows = append(rows, ReportRow{Path: e.Path, Status: "ADDED", Detail: markdownSize(e.Size)})
+		}
+		for _, move := range collapseMoves(diff.Moved, recorded) {
+			status := "MOVED"
+			if move.Renamed() {
+				status = "RENAMED"
+			}
+			rows = append(rows, ReportRow{Path: move.To, Status: status, Detail: "from " + move.From})
+		}
+		err := report.write(VerificationReport{
+			Title:     "Changes from " + outputPath(*fromPath) + " to " + outputPath(*toPath),
+			Manifest:  outputPath(*fromPath),
+			Root:      outputPath(*toPath),
+			Generated: outputTime(time.Now()),
+			Rows:      rows,
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+
+	if *output == "json" {
+		data, _ := json.MarshalIndent(diff, "", "  ")
+		fmt.Println(string(data))
+		return 0
+	}
+	for _, c := range diff.Changed {
+		switch {
+		case c.Algorithm != "" && !strings.EqualFold(c.FromHash, c.ToHash):
+			fmt.Printf("%s: CHANGED (%s %s → %s)\n", c.Path, getAlgorithmName(c.Algorithm), c.FromHash, c.ToHash)
+		default:
+			fmt.Printf("%s: CHANGED (size %d → %d bytes)\n", c.Path, c.FromSize, c.ToSize)
+		}
+	}
+	for _, e := range diff.Removed {
+		fmt.Printf("%s: REMOVED\n", e.Path)
+	}
+	for _, e := range diff.Added {
+		fmt.Printf("%s: ADDED\n", e.Path)
+	}
+	for _, move := range collapseMoves(diff.Moved, recorded) {
+		fmt.Println(move)
+	}
+	for _, p := range diff.Unverified {
+		fmt.Printf("%s: UNVERIFIED (no algorithm recorded in both scans)\n", p)
+	}
+	fmt.Printf("%d added, %d removed, %d changed, %d moved, %d unchanged\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), len(diff.Moved), diff.Unchanged)
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiffHashDBs(t *testing.T) {
+	entry := func(path string, size int64, hashes ...string) DBEntry {
+		e := DBEntry{Path: path, Size: size, Hashes: map[HashAlgorithm]string{}}
+		for i := 0; i < len(hashes); i += 2 {
+			e.Hashes[HashAlgorithm(hashes[i])] = hashes[i+1]
+		}
+		return e
+	}
+	from := []DBEntry{
+		entry("a.txt", 5, "sha256", "aa"),
+		entry("b.txt", 5, "sha256", "bb", "md5", "b5"),
+		entry("gone.txt", 3, "sha256", "gg"),
+		entry("m.txt", 3, "md5", "m1"),
+		entry("old/x.bin", 9, "sha256", "xx"),
+		entry("old/y.bin", 9, "md5", "yy"),
+		entry("u.txt", 3, "md5", "u1"),
+	}
+	to := []DBEntry{
+		entry("a.txt", 5, "sha256", "AA"),
+		entry("b.txt", 5, "sha256", "b2", "md5", "b5"),
+		entry("fresh.txt", 8, "sha256", "ff"),
+		entry("m.txt", 4, "sha1", "s1"),
+		entry("new/x.bin", 9, "sha256", "xx"),
+		entry("new/y.bin", 9, "sha256", "y2", "md5", "yy"),
+		entry("u.txt", 3, "sha1", "s2"),
+	}
+	diff := DiffHashDBs(from, to)
+	got := fmt.Sprintf("added %v removed %v changed %v moved %v unchanged %d unverified %v",
+		entryPaths(diff.Added), entryPaths(diff.Removed), diff.Changed, diff.Moved, diff.Unchanged, diff.Unverified)
+	want := "added [fresh.txt] removed [gone.txt] " +
+		"changed [{b.txt sha256 bb b2 5 5} {m.txt    3 4}] " +
+		"moved [old/x.bin → new/x.bin: MOVED old/y.bin → new/y.bin: MOVED] unchanged 1 unverified [u.txt]"
+	if got != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Filters test the later scan, and the earlier one for removed files
+	match, _ := ParseQuery("size < 9 and not name = fresh.txt")
+	diff.filter(match, &HashDB{entries: dbIndex(from)}, &HashDB{entries: dbIndex(to)})
+	if len(diff.Added) != 0 || len(diff.Removed) != 1 || len(diff.Changed) != 2 || len(diff.Moved) != 0 {
+		t.Errorf("filtered diff: %+v", diff)
+	}
+}
+
+func entryPaths(entries []DBEntry) []string {
+	var p []string
+	for _, e := range entries {
+		p = append(p, e.Path)
+	}
+	return p
+}
+
+func dbIndex(entries []DBEntry) map[string]*DBEntry {
+	index := map[string]*DBEntry{}
+	for i := range entries {
+		index[entries[i].Path] = &entries[i]
+	}
+	return index
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// deterministic is set by -deterministic. Outputs then leave out everything
+// that differs between two runs over the same data, such as times, durations,
+// hostnames and absolute paths, so they can be diffed and kept in version control.
+var deterministic bool
+
+// outputTime returns t, or the zero time when outputs are deterministic
+func outputTime(t time.Time) time.Time {
+	if deterministic {
+		return time.Time{}
+	}
+	return t
+}
+
+// sourceDateEpoch is the creation time of a deterministic document whose
+// format requires one: SOURCE_DATE_EPOCH when set, otherwise the Unix epoch
+func sourceDateEpoch() time.Time {
+	seconds, err := strconv.ParseInt(os.Getenv("SOURCE_DATE_EPOCH"), 10, 64)
+	if err != nil {
+		seconds = 0
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// outputPath returns p as given, or relative to the working directory when
+// outputs are deterministic and p is absolute
+func outputPath(p string) string {
+	if !deterministic || !filepath.IsAbs(p) {
+		return p
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return filepath.Base(p)
+	}
+	rel, err := filepath.Rel(wd, p)
+	if err != nil {
+		return filepath.Base(p)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// contentUUID derives a name-based UUID from data, for identifiers that are
+// random in normal runs but must repeat in deterministic ones
+func contentUUID(data []byte) string {
+	b := sha256.Sum256(data)
+	b[6] = b[6]&0x0f | 0x50
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
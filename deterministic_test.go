@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDeterministicOutputs(t *testing.T) {
+	deterministic = true
+	defer func() { deterministic = false }()
+	t.Setenv("SOURCE_DATE_EPOCH", "1700000000")
+
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "lib"), 0755)
+	os.WriteFile(filepath.Join(root, "README"), []byte("readme"), 0644)
+	os.WriteFile(filepath.Join(root, "lib", "x.so"), []byte("x"), 0644)
+
+	outputs := func() string {
+		var out bytes.Buffer
+		if err := WriteSPDX(&out, root, NewHashCalculator()); err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := BuildRollupManifest(root, SHA256, NewHashCalculator())
+		if err != nil {
+			t.Fatal(err)
+		}
+		json.NewEncoder(&out).Encode(manifest)
+		now := time.Now()
+		result := &HashResult{Filename: "README", Algorithm: SHA256, Passes: []ReadPass{{Hash: "ab", Started: now, Finished: now}}}
+		WriteJSONReport(&out, result, &URLSource{URL: "https://example.com/README", Headers: map[string][]string{"Date": {now.String()}}})
+		return out.String()
+	}
+	first := outputs()
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(root, "README"), later, later)
+	if second := outputs(); second != first {
+		t.Errorf("outputs differ between runs:\n%s\n---\n%s", first, second)
+	}
+	if !strings.Contains(first, `"created": "2023-11-14T22:13:20Z"`) {
+		t.Error("SPDX creation time does not follow SOURCE_DATE_EPOCH")
+	}
+	if strings.Contains(first, "modified") || strings.Contains(first, "started") || strings.Contains(first, "Date") {
+		t.Errorf("run-specific details left in outputs:\n%s", first)
+	}
+
+	wd, _ := os.Getwd()
+	if got := outputPath(filepath.Join(wd, "dist", "app.tar.gz")); got != "dist/app.tar.gz" {
+		t.Errorf("absolute path shown as %q", got)
+	}
+}
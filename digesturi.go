@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// niAlgorithms names the algorithms in the IANA Named Information Hash
+// Algorithm Registry that RFC 6920 ni URIs use; MD5 and SHA-1 are not in it
+var niAlgorithms = map[HashAlgorithm]string{SHA256: "sha-256", SHA512: "sha-512"}
+
+// digestURI writes a hex digest as an RFC 6920 ni URI (ni:///sha-256;<base64url>)
+// or as a hash URI (hash://sha256/<hex>)
+func digestURI(algorithm HashAlgorithm, digest, scheme string) (string, error) {
+	if algorithm == CIDV1 {
+		return "", fmt.Errorf("a cidv1 is a content identifier already")
+	}
+	switch scheme {
+	case "ni":
+		name, ok := niAlgorithms[algorithm]
+		if !ok {
+			return "", fmt.Errorf("ni URIs have no %s; use sha256 or sha512", getAlgorithmName(algorithm))
+		}
+		raw, err := hex.DecodeString(digest)
+		if err != nil {
+			return "", err
+		}
+		return "ni:///" + name + ";" + base64.RawURLEncoding.EncodeToString(raw), nil
+	case "hash":
+		return "hash://" + string(algorithm) + "/" + strings.ToLower(digest), nil
+	}
+	return "", fmt.Errorf("unknown digest URI scheme %q: expected ni or hash", scheme)
+}
+
+// parseDigestURI reads the algorithm and hex digest of an ni or hash URI.
+// It reports false for anything else, such as a plain hex digest.
+func parseDigestURI(uri string) (HashAlgorithm, string, bool, error) {
+	uri = strings.TrimSpace(uri)
+	uri, _, _ = strings.Cut(uri, "?")
+	switch {
+	case strings.HasPrefix(uri, "ni://"):
+		// The authority is optional and says where the object may be found
+		_, rest, ok := strings.Cut(strings.TrimPrefix(uri, "ni://"), "/")
+		name, value, found := strings.Cut(rest, ";")
+		if !ok || !found {
+			return "", "", true, fmt.Errorf("invalid ni URI %q: expected ni:///<algorithm>;<base64url digest>", uri)
+		}
+		for algorithm, registered := range niAlgorithms {
+			if strings.EqualFold(name, registered) {
+				raw, err := base64.RawURLEncoding.DecodeString(value)
+				if err != nil {
+					return "", "", true, fmt.Errorf("invalid ni URI %q: %w", uri, err)
+				}
+				return algorithm, hex.EncodeToString(raw), true, nil
+			}
+		}
+		return "", "", true, fmt.Errorf("ni URI %q uses %s, which hashculate does not compute", uri, name)
+	case strings.HasPrefix(uri, "hash://"):
+		name, digest, ok := strings.Cut(strings.TrimPrefix(uri, "hash://"), "/")
+		algorithm := HashAlgorithm(strings.ToLower(name))
+		if !ok || !containsAlgorithm([]HashAlgorithm{MD5, SHA1, SHA256, SHA512}, algorithm) {
+			return "", "", true, fmt.Errorf("invalid hash URI %q: expected hash://<md5|sha1|sha256|sha512>/<hex digest>", uri)
+		}
+		return algorithm, strings.ToLower(digest), true, nil
+	}
+	return "", "", false, nil
+}
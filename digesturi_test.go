@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestDigestURI(t *testing.T) {
+	const hello = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	for _, test := range []struct {
+		scheme string
+		want   string
+	}{
+		{"ni", "ni:///sha-256;WJG1tSLV3whtD_CxEPvZ0hu0_HFjrzTQgoai6Eb2vgM"},
+		{"hash", "hash://sha256/" + hello},
+	} {
+		uri, err := digestURI(SHA256, hello, test.scheme)
+		if err != nil || uri != test.want {
+			t.Errorf("%s: got %q, %v, want %q", test.scheme, uri, err, test.want)
+		}
+		algorithm, digest, ok, err := parseDigestURI(uri)
+		if !ok || err != nil || algorithm != SHA256 || digest != hello {
+			t.Errorf("%s: parsed %s %s %v %v", uri, algorithm, digest, ok, err)
+		}
+	}
+	if _, err := digestURI(MD5, "d41d8cd98f00b204e9800998ecf8427e", "ni"); err == nil {
+		t.Error("ni URIs should refuse MD5")
+	}
+}
+
+func TestParseDigestURI(t *testing.T) {
+	// The authority and query are optional parts of an ni URI
+	algorithm, digest, ok, err := parseDigestURI("ni://example.com/SHA-256;WJG1tSLV3whtD_CxEPvZ0hu0_HFjrzTQgoai6Eb2vgM?ct=text/plain")
+	if !ok || err != nil || algorithm != SHA256 || digest[:8] != "5891b5b5" {
+		t.Errorf("Parsed %s %s %v %v", algorithm, digest, ok, err)
+	}
+	if _, _, ok, _ := parseDigestURI("5891b5b5"); ok {
+		t.Error("A hex digest is not a URI")
+	}
+	for _, uri := range []string{"ni:///sha-256", "ni:///md5;1B2M2Y8AsgTpgAmY7PhCfg", "hash://cidv1/abc"} {
+		if _, _, ok, err := parseDigestURI(uri); !ok || err == nil {
+			t.Errorf("%s: want an error", uri)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"unicode/utf16"
+
+	"hashculate/hasher"
+)
+
+// discSector is the logical sector size of CDs, DVDs and Blu-ray discs
+const discSector = 2048
+
+// discReadSectors is how many sectors disc comparison reads at a time
+// before falling back to single sectors around read errors
+const discReadSectors = 32
+
+// ErrUDFOnly is returned for images that carry only a UDF file system
+var ErrUDFOnly = errors.New("the image has only a UDF file system, which is not supported; only ISO 9660 (including UDF bridge discs) can be listed")
+
+// DiscFile is a file on an ISO 9660 file system
+type DiscFile struct {
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Extents []ByteRange `json:"-"`
+	Hash    string      `json:"hash,omitempty"`
+}
+
+// DiscImage is the ISO 9660 file system of a disc or disc image
+type DiscImage struct {
+	Label  string     `json:"label"`
+	Size   int64      `json:"size"` // Volume size, which excludes any padding after it
+	Joliet bool       `json:"joliet"`
+	Files  []DiscFile `json:"files"`
+}
+
+// ReadISO9660 lists the files of an ISO 9660 image, using the Joliet names when present
+func ReadISO9660(r io.ReaderAt) (*DiscImage, error) {
+	var primary, joliet []byte
+	udf := false
+	sector := make([]byte, discSector)
+descriptors:
+	for lba := int64(16); lba < 16+64; lba++ {
+		if _, err := r.ReadAt(sector, lba*discSector); err != nil {
+			break
+		}
+		// A UDF bridge disc has the UDF recognition sequence after the ISO 9660 terminator
+		switch string(sector[1:6]) {
+		case "CD001":
+			escape := string(sector[88:91])
+			if sector[0] == 1 && primary == nil {
+				primary = bytes.Clone(sector)
+			} else if sector[0] == 2 && (escape == "%/@" || escape == "%/C" || escape == "%/E") {
+				joliet = bytes.Clone(sector)
+			}
+		case "NSR02", "NSR03":
+			udf = true
+		case "BEA01", "TEA01":
+		default:
+			break descriptors
+		}
+	}
+	if primary == nil {
+		if udf {
+			return nil, ErrUDFOnly
+		}
+		return nil, fmt.Errorf("not an ISO 9660 disc image")
+	}
+
+	descriptor := primary
+	if joliet != nil {
+		descriptor = joliet
+	}
+	image := &DiscImage{
+		Label:  strings.TrimSpace(string(primary[40:72])),
+		Size:   int64(binary.LittleEndian.Uint32(primary[80:])) * int64(binary.LittleEndian.Uint16(primary[128:])),
+		Joliet: joliet != nil,
+	}
+	root := descriptor[156 : 156+34]
+	visited := map[uint32]bool{}
+	if err := readDiscDir(r, root, "", joliet != nil, visited, &image.Files); err != nil {
+		return nil, err
+	}
+	return image, nil
+}
+
+// readDiscDir appends the files below a directory record, merging the
+// extents of files larger than 4 GB that are recorded in several parts
+func readDiscDir(r io.ReaderAt, record []byte, dir string, joliet bool, visited map[uint32]bool, files *[]DiscFile) error {
+	lba, length := binary.LittleEndian.Uint32(record[2:]), binary.LittleEndian.Uint32(record[10:])
+	if visited[lba] {
+		return nil
+	}
+	visited[lba] = true
+	data := make([]byte, length)
+	if _, err := r.ReadAt(data, int64(lba)*discSector); err != nil {
+		return fmt.Errorf("reading directory %s: %w", "/"+dir, err)
+	}
+
+	var pending *DiscFile
+	for pos := 0; pos < len(data); {
+		size := int(data[pos])
+		if size == 0 {
+			// Records never cross a sector boundary
+			pos = (pos/discSector + 1) * discSector
+			continue
+		}
+		if size < 34 || pos+size > len(data) || 33+int(data[pos+32]) > size {
+			return fmt.Errorf("directory %s: invalid record", "/"+dir)
+		}
+		rec := data[pos : pos+size]
+		pos += size
+		rawName := rec[33 : 33+int(rec[32])]
+		if len(rawName) == 1 && rawName[0] <= 1 {
+			continue // . and ..
+		}
+		name := discName(rawName, joliet)
+		flags := rec[25]
+		extent := ByteRange{Start: int64(binary.LittleEndian.Uint32(rec[2:])) * discSector}
+		extent.End = extent.Start + int64(binary.LittleEndian.Uint32(rec[10:]))
+
+		if flags&0x02 != 0 {
+			if err := readDiscDir(r, rec, path.Join(dir, name), joliet, visited, files); err != nil {
+				return err
+			}
+			continue
+		}
+		if pending == nil {
+			pending = &DiscFile{Path: path.Join(dir, name)}
+		}
+		pending.Extents = append(pending.Extents, extent)
+		pending.Size += extent.End - extent.Start
+		if flags&0x80 == 0 {
+			*files = append(*files, *pending)
+			pending = nil
+		}
+	}
+	return nil
+}
+
+// discName decodes a file identifier, dropping the ISO 9660 version suffix
+func discName(raw []byte, joliet bool) string {
+	name := string(raw)
+	if joliet {
+		units := make([]uint16, len(raw)/2)
+		for i := range units {
+			units[i] = binary.BigEndian.Uint16(raw[2*i:])
+		}
+		name = string(utf16.Decode(units))
+	}
+	if i := strings.LastIndex(name, ";"); i >= 0 {
+		name = name[:i]
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+// HashDiscFiles hashes every file of a disc image
+func HashDiscFiles(r io.ReaderAt, image *DiscImage, algorithm HashAlgorithm) error {
+	for i := range image.Files {
+		file := &image.Files[i]
+		readers := make([]io.Reader, len(file.Extents))
+		for j, extent := range file.Extents {
+			readers[j] = io.NewSectionReader(r, extent.Start, extent.End-extent.Start)
+		}
+		digests, _, err := hasher.HashReader(io.MultiReader(readers...), []HashAlgorithm{algorithm}, 1<<20, file.Size, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Path, err)
+		}
+		file.Hash = digests[0].Hash
+	}
+	return nil
+}
+
+// DiscComparison is the sector-by-sector comparison of a disc with its source image
+type DiscComparison struct {
+	Sectors    int64
+	Unreadable []ByteRange // Sector ranges the disc could not read, half-open
+	Mismatched []ByteRange // Sector ranges read with different contents
+	Missing    int64       // Sectors past the end of the disc
+}
+
+// OK reports whether every sector was read and matched
+func (c *DiscComparison) OK() bool {
+	return len(c.Unreadable) == 0 && len(c.Mismatched) == 0 && c.Missing == 0
+}
+
+// addSector records a bad sector, merging it with the previous range
+func addSector(ranges []ByteRange, sector int64) []ByteRange {
+	if n := len(ranges); n > 0 && ranges[n-1].End == sector {
+		ranges[n-1].End++
+		return ranges
+	}
+	return append(ranges, ByteRange{Start: sector, End: sector + 1})
+}
+
+// CompareDisc compares the first size bytes of a disc with its source image.
+// Reads that fail are retried a sector at a time, so bad sectors are told
+// apart from sectors that read back with the wrong data.
+func CompareDisc(disc, image io.ReaderAt, size int64, retries int, progress func(float64)) (*DiscComparison, error) {
+	c := &DiscComparison{Sectors: (size + discSector - 1) / discSector}
+	want, got := make([]byte, discReadSectors*discSector), make([]byte, discReadSectors*discSector)
+	for first := int64(0); first < c.Sectors; first += discReadSectors {
+		count := min(discReadSectors, c.Sectors-first)
+		n := min(count*discSector, size-first*discSector)
+		if _, err := image.ReadAt(want[:n], first*discSector); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading image: %w", err)
+		}
+		read, err := disc.ReadAt(got[:n], first*discSector)
+		if err == io.EOF && int64(read) < n {
+			// The disc ends early; sectors it does not hold in full are missing
+			count = int64(read) / discSector
+			c.Missing = c.Sectors - first - count
+			err = nil
+		} else if err == io.EOF {
+			err = nil
+		}
+		for s := int64(0); s < count; s++ {
+			lo, hi := s*discSector, min((s+1)*discSector, n)
+			if err != nil {
+				if !readSector(disc, got[lo:hi], (first+s)*discSector, retries) {
+					c.Unreadable = addSector(c.Unreadable, first+s)
+					continue
+				}
+			}
+			if !bytes.Equal(want[lo:hi], got[lo:hi]) {
+				c.Mismatched = addSector(c.Mismatched, first+s)
+			}
+		}
+		if c.Missing > 0 {
+			break
+		}
+		if progress != nil {
+			progress(float64(first+count) / float64(c.Sectors))
+		}
+	}
+	return c, nil
+}
+
+// readSector reads one sector, trying again up to retries times
+func readSector(disc io.ReaderAt, buf []byte, offset int64, retries int) bool {
+	for attempt := 0; attempt <= retries; attempt++ {
+		if _, err := disc.ReadAt(buf, offset); err == nil || err == io.EOF {
+			return err == nil
+		}
+	}
+	return false
+}
+
+// affectedFiles lists the files of an image that overlap the given sector ranges
+func affectedFiles(image *DiscImage, ranges []ByteRange) []string {
+	var names []string
+	for _, file := range image.Files {
+	extents:
+		for _, extent := range file.Extents {
+			for _, r := range ranges {
+				if extent.Start < r.End*discSector && r.Start*discSector < extent.End {
+					names = append(names, file.Path)
+					break extents
+				}
+			}
+		}
+	}
+	return names
+}
+
+// formatSectors renders a sector range for reports
+func formatSectors(r ByteRange) string {
+	if r.End-r.Start == 1 {
+		return fmt.Sprintf("sector %d", r.Start)
+	}
+	return fmt.Sprintf("sectors %d-%d (%d)", r.Start, r.End-1, r.End-r.Start)
+}
+
+// runDisc implements the disc command
+func runDisc(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate disc hash <image|device> [-a sha256]")
+		fmt.Println("       hashculate disc compare <device> <image> [-retries <n>] [-limit <n>]")
+		return 1
+	}
+	if len(args) < 2 {
+		return usage()
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("disc "+action, flag.ExitOnError)
+	algorithm := fs.String("a", "sha256", "Hash algorithm")
+	retries := fs.Int("retries", 2, "Extra attempts at each unreadable sector")
+	limit := fs.Int("limit", 50, "Print at most this many sector ranges of each kind (0 for all)")
+	positional := parseFlags(fs, args[1:])
+
+	switch action {
+	case "hash":
+		alg, err := parseAlgorithm(*algorithm)
+		if err != nil || len(positional) != 1 {
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			return usage()
+		}
+		f, err := os.Open(positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		image, err := ReadISO9660(f)
+		if err != nil {
+			fmt.Printf("Error: %s: %v\n", positional[0], err)
+			return 1
+		}
+		digests, _, err := hasher.HashReader(io.NewSectionReader(f, 0, image.Size), []HashAlgorithm{alg}, 4<<20, image.Size, nil)
+		if err == nil {
+			err = HashDiscFiles(f, image, alg)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Volume: %s\n", image.Label)
+		fmt.Printf("Size: %s (%d sectors)\n", formatBytes(image.Size), image.Size/discSector)
+		fmt.Printf("%s: %s\n", getAlgorithmName(alg), digests[0].Hash)
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() && info.Size() > image.Size {
+			fmt.Printf("The file has %d bytes of padding after the volume, which are not hashed\n", info.Size()-image.Size)
+		}
+		fmt.Println()
+		for _, file := range image.Files {
+			fmt.Printf("%s  %s\n", file.Hash, file.Path)
+		}
+		return 0
+
+	case "compare":
+		if len(positional) != 2 {
+			return usage()
+		}
+		var files [2]*os.File
+		for i, name := range positional {
+			f, err := os.Open(name)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			defer f.Close()
+			files[i] = f
+		}
+		info, err := files[1].Stat()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Comparing %s with %s (%d sectors)\n", positional[0], positional[1], (info.Size()+discSector-1)/discSector)
+		var progress func(float64)
+		if isTerminal(os.Stdout) && !deterministic {
+			progress = progressBar
+		}
+		c, err := CompareDisc(files[0], files[1], info.Size(), *retries, progress)
+		if err != nil {
+			fmt.Println()
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if c.OK() {
+			fmt.Println()
+			fmt.Println("The disc matches the image")
+			return 0
+		}
+
+		image, _ := ReadISO9660(files[1])
+		for _, kind := range []struct {
+			title  string
+			ranges []ByteRange
+		}{{"Unreadable", c.Unreadable}, {"Mismatched", c.Mismatched}} {
+			if len(kind.ranges) == 0 {
+				continue
+			}
+			fmt.Println()
+			fmt.Printf("%s:\n", kind.title)
+			for i, r := range kind.ranges {
+				if *limit > 0 && i == *limit {
+					fmt.Printf("  ... %d more\n", len(kind.ranges)-i)
+					break
+				}
+				fmt.Printf("  %s\n", formatSectors(r))
+			}
+			if image != nil {
+				for _, name := range affectedFiles(image, kind.ranges) {
+					fmt.Printf("  affects %s\n", name)
+				}
+			}
+		}
+		if c.Missing > 0 {
+			fmt.Println()
+			fmt.Printf("The disc ends %d sector(s) before the image\n", c.Missing)
+		}
+		return 1
+	}
+	return usage()
+}
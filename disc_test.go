@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// discRecord builds an ISO 9660 directory record
+func discRecord(name string, lba, size uint32, flags byte) []byte {
+	rec := make([]byte, 33+len(name)+(1-len(name)%2))
+	rec[0] = byte(len(rec))
+	binary.LittleEndian.PutUint32(rec[2:], lba)
+	binary.BigEndian.PutUint32(rec[6:], lba)
+	binary.LittleEndian.PutUint32(rec[10:], size)
+	binary.BigEndian.PutUint32(rec[14:], size)
+	rec[25], rec[28], rec[32] = flags, 1, byte(len(name))
+	copy(rec[33:], name)
+	return rec
+}
+
+// faultyDisc is a disc whose bad sector fails to read
+type faultyDisc struct {
+	data []byte
+	bad  int64
+}
+
+func (d faultyDisc) ReadAt(p []byte, off int64) (int, error) {
+	if bad := d.bad * discSector; off < bad+discSector && bad < off+int64(len(p)) {
+		return copy(p, d.data[off:max(off, bad)]), errors.New("input/output error")
+	}
+	return bytes.NewReader(d.data).ReadAt(p, off)
+}
+
+func TestDiscImage(t *testing.T) {
+	iso := make([]byte, 23*discSector)
+	pvd := iso[16*discSector:]
+	pvd[0], pvd[6] = 1, 1
+	copy(pvd[1:], "CD001")
+	copy(pvd[40:72], "TEST_DISC                       ")
+	binary.LittleEndian.PutUint32(pvd[80:], 23)
+	binary.LittleEndian.PutUint16(pvd[128:], discSector)
+	copy(pvd[156:], discRecord("\x00", 18, discSector, 2))
+	iso[17*discSector] = 255
+	copy(iso[17*discSector+1:], "CD001")
+
+	root := append(append(append(discRecord("\x00", 18, discSector, 2), discRecord("\x01", 18, discSector, 2)...),
+		discRecord("DOCS", 19, discSector, 2)...), discRecord("README.TXT;1", 20, 100, 0)...)
+	docs := append(append(discRecord("\x00", 19, discSector, 2), discRecord("BIG.BIN;1", 21, discSector, 0x80)...),
+		discRecord("BIG.BIN;1", 22, 500, 0)...)
+	copy(iso[18*discSector:], root)
+	copy(iso[19*discSector:], docs)
+	for i := 20 * discSector; i < len(iso); i++ {
+		iso[i] = byte(i % 251)
+	}
+
+	image, err := ReadISO9660(bytes.NewReader(iso))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := HashDiscFiles(bytes.NewReader(iso), image, SHA256); err != nil {
+		t.Fatal(err)
+	}
+	big := fmt.Sprintf("%x", sha256.Sum256(iso[21*discSector:22*discSector+500]))
+	if image.Label != "TEST_DISC" || image.Size != int64(len(iso)) || len(image.Files) != 2 ||
+		image.Files[0].Path != "DOCS/BIG.BIN" || image.Files[0].Size != discSector+500 || image.Files[0].Hash != big ||
+		image.Files[1].Path != "README.TXT" || image.Files[1].Size != 100 {
+		t.Fatalf("unexpected image: %+v", image)
+	}
+
+	// A disc with one unreadable and one changed sector
+	burned := bytes.Clone(iso)
+	burned[20*discSector+7] ^= 0xFF
+	c, err := CompareDisc(faultyDisc{data: burned, bad: 21}, bytes.NewReader(iso), int64(len(iso)), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(c.Mismatched) != "[{20 21}]" || fmt.Sprint(c.Unreadable) != "[{21 22}]" || c.Missing != 0 {
+		t.Errorf("unexpected comparison: %+v", c)
+	}
+	if got := affectedFiles(image, c.Unreadable); fmt.Sprint(got) != "[DOCS/BIG.BIN]" {
+		t.Errorf("unexpected affected files: %v", got)
+	}
+
+	c, err = CompareDisc(bytes.NewReader(iso[:20*discSector]), bytes.NewReader(iso), int64(len(iso)), 0, nil)
+	if err != nil || c.OK() || c.Missing != 3 || len(c.Mismatched) != 0 {
+		t.Errorf("short disc: %+v, %v", c, err)
+	}
+	c, _ = CompareDisc(bytes.NewReader(append(bytes.Clone(iso), make([]byte, 10*discSector)...)), bytes.NewReader(iso), int64(len(iso)), 0, nil)
+	if !c.OK() {
+		t.Errorf("padded disc should match: %+v", c)
+	}
+}
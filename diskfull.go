@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// isDiskFull reports whether err means the disk or the user's quota is full
+func isDiskFull(err error) bool {
+	for _, errno := range diskFullErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeOutputFile writes a document to path, or to stdout with a warning
+// when the disk is full and stdout is a terminal or pipe rather than a file
+// that would likely be on the same disk. It reports whether stdout was used.
+// A file it replaces is kept as the newest of the given number of backups.
+func writeOutputFile(path string, data []byte, backups int) (bool, error) {
+	err := writeFileAtomic(path, data, 0644, backups)
+	if err == nil || !isDiskFull(err) || outputOffset(os.Stdout) >= 0 {
+		return false, err
+	}
+	fmt.Fprintf(os.Stderr, "Warning: cannot write %s: %v; writing to stdout instead\n", path, err)
+	_, err = os.Stdout.Write(data)
+	return true, err
+}
+
+// appendLine appends a line to a file opened for appending, cutting a line
+// that did not fit back off so the next one starts cleanly
+func appendLine(f *os.File, line []byte) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Truncate(info.Size())
+		return err
+	}
+	return nil
+}
+
+// outputReserve is how much free space a document written to a file needs
+// before hashing starts, when the number of files is unknown
+const outputReserve = 64 << 10
+
+// outputBytesPerFile estimates the size of a document's entry for one file
+const outputBytesPerFile = 512
+
+// outputOffset returns where the next write to f lands when f is a regular
+// file, and -1 for terminals, pipes and sockets. That is the end of the file
+// both for > (truncated) and >> (appended), whose position is still 0.
+func outputOffset(f *os.File) int64 {
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return -1
+	}
+	return info.Size()
+}
+
+// stdoutDocument is a document written to stdout, which the shell may have
+// redirected to a file. A document that could not be finished is removed
+// from such a file again, so it is not later taken for a corrupt manifest.
+type stdoutDocument struct {
+	file   *os.File
+	offset int64
+}
+
+// startDocument notes where the document starts in f
+func startDocument(f *os.File) *stdoutDocument {
+	return &stdoutDocument{file: f, offset: outputOffset(f)}
+}
+
+// reserve checks before any hashing that size more bytes fit, by writing
+// them where the document starts and truncating again
+func (d *stdoutDocument) reserve(size int64) error {
+	if d.offset < 0 {
+		return nil
+	}
+	_, err := d.file.Write(make([]byte, size))
+	if err == nil {
+		err = d.file.Sync()
+	}
+	if truncErr := d.rewind(); err == nil {
+		err = truncErr
+	}
+	if isDiskFull(err) {
+		return fmt.Errorf("not enough space for the output, %d bytes needed: %w", size, err)
+	}
+	return err
+}
+
+// discard removes what was written of the document
+func (d *stdoutDocument) discard() {
+	if d.offset < 0 {
+		return
+	}
+	if d.rewind() == nil {
+		fmt.Fprintln(os.Stderr, "The unfinished output was removed")
+	}
+}
+
+// rewind cuts the file back to where the document starts
+func (d *stdoutDocument) rewind() error {
+	if err := d.file.Truncate(d.offset); err != nil {
+		return err
+	}
+	_, err := d.file.Seek(d.offset, io.SeekStart)
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsDiskFull(t *testing.T) {
+	full, err := os.OpenFile("/dev/full", os.O_WRONLY, 0)
+	if err != nil {
+		t.Skip("no /dev/full")
+	}
+	defer full.Close()
+	if _, err := full.Write([]byte("data")); !isDiskFull(err) {
+		t.Errorf("Expected a write to /dev/full to be a full disk, got %v", err)
+	}
+	if isDiskFull(os.ErrNotExist) {
+		t.Error("A missing file is not a full disk")
+	}
+}
+
+func TestStdoutDocument(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.md")
+	os.WriteFile(path, []byte("previous\n"), 0644)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	document := startDocument(f)
+	if err := document.reserve(4096); err != nil {
+		t.Fatalf("Reserve failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "previous\n" {
+		t.Errorf("Expected the reserve to be given back, got %q", data)
+	}
+	f.WriteString("| `a.txt` | 1 B | `ca97")
+	document.discard()
+	if data, _ := os.ReadFile(path); string(data) != "previous\n" {
+		t.Errorf("Expected the unfinished document to be removed, got %q", data)
+	}
+}
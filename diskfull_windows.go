@@ -0,0 +1,10 @@
+package main
+
+import "syscall"
+
+// diskFullErrnos are the errors for a full disk or quota
+var diskFullErrnos = []syscall.Errno{
+	39,   // ERROR_HANDLE_DISK_FULL
+	112,  // ERROR_DISK_FULL
+	1295, // ERROR_DISK_QUOTA_EXCEEDED
+}
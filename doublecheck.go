@@ -0,0 +1,30 @@
+package main
+
+import "time"
+
+// ReadPass is one complete read of the source made by -double-check
+type ReadPass struct {
+	Hash     string    `json:"hash"`
+	Started  time.Time `json:"started,omitzero"`
+	Finished time.Time `json:"finished,omitzero"`
+}
+
+// Duration is how long the pass took
+func (p ReadPass) Duration() time.Duration {
+	return p.Finished.Sub(p.Started)
+}
+
+// DoubleCheck hashes filePath a second time with the algorithm of first and
+// returns both passes. Differing digests point at flaky storage, cabling or
+// memory rather than at the file.
+func (hc *HashCalculator) DoubleCheck(filePath string, first *HashResult, started, finished time.Time, progressCallback func(float64)) ([]ReadPass, error) {
+	secondStarted := time.Now()
+	second, err := hc.CalculateFileHash(filePath, first.Algorithm, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+	return []ReadPass{
+		{Hash: first.Hash, Started: started, Finished: finished},
+		{Hash: second.Hash, Started: secondStarted, Finished: time.Now()},
+	}, nil
+}
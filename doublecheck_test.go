@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDoubleCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	os.WriteFile(path, bytes.Repeat([]byte("sector"), 10000), 0644)
+	calculator := NewHashCalculator()
+	started := time.Now()
+	result, err := calculator.CalculateFileHash(path, SHA256, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result.Passes, err = calculator.DoubleCheck(path, result, started, time.Now(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Passes) != 2 || result.Passes[0].Hash != result.Hash || result.Passes[1].Hash != result.Hash {
+		t.Fatalf("unexpected passes: %+v", result.Passes)
+	}
+	if result.Passes[1].Started.Before(result.Passes[0].Finished) {
+		t.Error("second pass started before the first finished")
+	}
+
+	var out bytes.Buffer
+	WriteJSONReport(&out, result, nil)
+	var report JSONReport
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil || len(report.Passes) != 2 {
+		t.Errorf("passes missing from JSON report: %s", out.String())
+	}
+}
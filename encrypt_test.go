@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChaCha20Poly1305(t *testing.T) {
+	// RFC 8439 section 2.8.2
+	key, _ := hex.DecodeString("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f")
+	nonce, _ := hex.DecodeString("070000004041424344454647")
+	aad, _ := hex.DecodeString("50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+
+	sealed := chachaPolySeal(key, nonce, plaintext, aad)
+	if got := hex.EncodeToString(sealed[len(sealed)-poly1305TagSize:]); got != "1ae10b594f09e26a7e902ecbd0600691" {
+		t.Errorf("Unexpected tag: %s", got)
+	}
+	if got := hex.EncodeToString(sealed[:16]); got != "d31a8d34648e60db7b86afbc53ef7ec2" {
+		t.Errorf("Unexpected ciphertext: %s", got)
+	}
+	opened, err := chachaPolyOpen(key, nonce, sealed, aad)
+	if err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("Round trip failed: %v", err)
+	}
+	sealed[0] ^= 1
+	if _, err := chachaPolyOpen(key, nonce, sealed, aad); err == nil {
+		t.Error("Expected tampered ciphertext to be rejected")
+	}
+}
+
+// ageDecrypt decrypts an age file for an X25519 identity
+func ageDecrypt(t *testing.T, data []byte, identity *ecdh.PrivateKey) []byte {
+	t.Helper()
+	r := bufio.NewReader(bytes.NewReader(data))
+	var header bytes.Buffer
+	readLine := func() string {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Truncated header: %v", err)
+		}
+		header.WriteString(line)
+		return strings.TrimSuffix(line, "\n")
+	}
+	if readLine() != ageVersionLine {
+		t.Fatal("Missing age version line")
+	}
+
+	var fileKey []byte
+	for {
+		line := readLine()
+		if strings.HasPrefix(line, "--- ") {
+			macKey, _ := hkdf.Key(sha256.New, fileKey, nil, "header", 32)
+			mac := hmac.New(sha256.New, macKey)
+			mac.Write(header.Bytes()[:header.Len()-len(line)-1+3])
+			if ageB64.EncodeToString(mac.Sum(nil)) != line[4:] {
+				t.Fatal("Header MAC mismatch")
+			}
+			break
+		}
+		args := strings.Fields(line)
+		body, _ := ageB64.DecodeString(readLine())
+		if fileKey != nil || len(args) != 3 || args[1] != "X25519" {
+			continue
+		}
+		share, _ := ageB64.DecodeString(args[2])
+		sharePub, _ := ecdh.X25519().NewPublicKey(share)
+		shared, _ := identity.ECDH(sharePub)
+		salt := append(append([]byte{}, share...), identity.PublicKey().Bytes()...)
+		wrapKey, _ := hkdf.Key(sha256.New, shared, salt, ageX25519Label, chachaKeySize)
+		if key, err := chachaPolyOpen(wrapKey, make([]byte, chachaNonceSize), body, nil); err == nil {
+			fileKey = key
+		}
+	}
+
+	nonce := make([]byte, 16)
+	io.ReadFull(r, nonce)
+	payloadKey, _ := hkdf.Key(sha256.New, fileKey, nonce, "payload", chachaKeySize)
+	payload, _ := io.ReadAll(r)
+	var plaintext []byte
+	for counter := uint64(0); ; counter++ {
+		n := min(len(payload), ageChunkSize+poly1305TagSize)
+		chunk, err := chachaPolyOpen(payloadKey, ageChunkNonce(counter, n == len(payload)), payload[:n], nil)
+		if err != nil {
+			t.Fatalf("Chunk %d: %v", counter, err)
+		}
+		plaintext = append(plaintext, chunk...)
+		if payload = payload[n:]; len(payload) == 0 {
+			return plaintext
+		}
+	}
+}
+
+func TestAgeInterop(t *testing.T) {
+	// Made with age v1.3.2: age-keygen, then age -r <public key> on the plaintext
+	const identityKey = "AGE-SECRET-KEY-1G4NR8TRQATM5R2TJ58K78T9P37TUY54HSA6V9JGCECYRRKJENA0QC7H8YX"
+	const ciphertext = "YWdlLWVuY3J5cHRpb24ub3JnL3YxCi0+IFgyNTUxOSBWOVZQaFFZZUk0NjlPNWczUmcrekRoOHFMWkU3RUlZbDUrUG1PVG1KblNRCnVvNm9scnlpTndGU1RpRy9hZWQvandmaGlGa016RXpNbC91eW9rS3I4WTAKLS0tIDNCdm9zTnE1N0gzeC9wdEwrZlg3ZUFIT1U2UklVWHVOMnE0MXRaV0lvZGMK6hdrROXLmPRqj4yuewjqR6uAgDHoA0RdgY8B9rv0yz+8+K0YfeP4sgeMkc0lf1lfJ45Efu91ZNbjTuICsYY="
+
+	hrp, key, err := bech32Decode(identityKey)
+	if err != nil || hrp != "age-secret-key-" {
+		t.Fatalf("Invalid identity %q: %v", hrp, err)
+	}
+	identity, err := ecdh.X25519().NewPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient := bech32Encode("age", identity.PublicKey().Bytes()); recipient != "age180zmt86cee3ld0hf8f6zcp09q0vwptye8jw5sjrkzj6khtcgwpesd0a5jp" {
+		t.Errorf("Unexpected recipient for the identity: %s", recipient)
+	}
+	data, _ := base64.StdEncoding.DecodeString(ciphertext)
+	if got := ageDecrypt(t, data, identity); string(got) != "hashculate age interop vector\n" {
+		t.Errorf("Unexpected plaintext: %q", got)
+	}
+}
+
+func TestAgeEncryption(t *testing.T) {
+	identity, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	other, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	recipient := bech32Encode("age", identity.PublicKey().Bytes())
+
+	parsed, err := parseAgeRecipient(recipient)
+	if err != nil || !parsed.Equal(identity.PublicKey()) {
+		t.Fatalf("Recipient round trip failed: %v", err)
+	}
+	corrupt := "q"
+	if strings.HasSuffix(recipient, corrupt) {
+		corrupt = "p"
+	}
+	if _, err := parseAgeRecipient(recipient[:len(recipient)-1] + corrupt); err == nil {
+		t.Error("Expected a corrupted checksum to be rejected")
+	}
+	if _, err := ParseEncryptRecipients(recipient + ",ops@example.com"); err == nil {
+		t.Error("Expected mixed age and PGP recipients to be rejected")
+	}
+
+	recipients, err := ParseEncryptRecipients(bech32Encode("age", other.PublicKey().Bytes()) + "," + recipient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sizes around the chunk boundary exercise the last-chunk flag
+	for _, size := range []int{0, 100, ageChunkSize, ageChunkSize + 1, 3 * ageChunkSize} {
+		plaintext := make([]byte, size)
+		rand.Read(plaintext)
+		var out bytes.Buffer
+		w, err := recipients.Writer(&out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(plaintext[:size/2])
+		w.Write(plaintext[size/2:])
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := ageDecrypt(t, out.Bytes(), identity); !bytes.Equal(got, plaintext) {
+			t.Errorf("Size %d: decrypted payload differs", size)
+		}
+	}
+}
+
+func TestPGPEncryptionTrust(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg is not installed")
+	}
+	gpg := func(home string, args ...string) []byte {
+		t.Helper()
+		cmd := exec.Command("gpg", append([]string{"--homedir", home, "--batch", "--quiet", "--passphrase", ""}, args...)...)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Skipf("gpg %s failed: %v", args[0], err)
+		}
+		return out
+	}
+
+	// A key that was imported but never signed is not valid for its user ID
+	owner, home := t.TempDir(), t.TempDir()
+	os.Chmod(owner, 0700)
+	os.Chmod(home, 0700)
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--homedir", owner, "--kill", "all").Run()
+		exec.Command("gpgconf", "--homedir", home, "--kill", "all").Run()
+	})
+	gpg(owner, "--quick-gen-key", "Ops <ops@example.com>", "default", "default", "never")
+	keyFile := filepath.Join(t.TempDir(), "ops.asc")
+	os.WriteFile(keyFile, gpg(owner, "--armor", "--export", "ops@example.com"), 0644)
+	gpg(home, "--import", keyFile)
+	t.Setenv("GNUPGHOME", home)
+
+	encrypt := func(recipient string) ([]byte, error) {
+		var out bytes.Buffer
+		w, err := (&EncryptRecipients{PGP: []string{recipient}}).Writer(&out)
+		if err != nil {
+			return nil, err
+		}
+		w.Write([]byte("report"))
+		err = w.Close()
+		return out.Bytes(), err
+	}
+	if _, err := encrypt("ops@example.com"); err == nil {
+		t.Error("Expected an untrusted keyring key to be refused")
+	}
+	if out, err := encrypt(keyFile); err != nil || len(out) == 0 {
+		t.Errorf("Expected encryption to an exported key file: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"hashculate/hasher"
+)
+
+const (
+	// estimateSampleSize is read sequentially at each sampled offset, so seeks
+	// between samples do not dominate the measured throughput
+	estimateSampleSize = 16 * 1024 * 1024
+	// estimateSamples is the number of offsets spread across the input
+	estimateSamples = 16
+)
+
+// AlgorithmEstimate is the predicted cost of hashing the input with one algorithm
+type AlgorithmEstimate struct {
+	Algorithm HashAlgorithm
+	Rate      float64       // Bytes per second hashed from memory
+	Duration  time.Duration // Predicted time for a full hash
+}
+
+// HashEstimate predicts how long hashing a set of files will take from a
+// short sample of read and hashing throughput
+type HashEstimate struct {
+	Files      int
+	Bytes      int64
+	Sampled    int64   // Bytes read to measure ReadRate
+	ReadRate   float64 // Bytes per second read from the inputs
+	Overlap    bool    // Reads overlap hashing, as with read-ahead
+	Algorithms []AlgorithmEstimate
+}
+
+// EstimateHashTime samples the read throughput of the files below paths and
+// the speed of each algorithm, spending about budget in total, and predicts
+// the duration of a full hash. With overlap, reading and hashing run
+// concurrently and the slower of the two bounds the duration.
+func EstimateHashTime(paths []string, algorithms []HashAlgorithm, budget time.Duration, overlap bool) (*HashEstimate, error) {
+	estimate := &HashEstimate{Overlap: overlap}
+	var files []string
+	var sizes []int64
+	for _, root := range paths {
+		list, err := listFiles(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range list {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, path)
+			sizes = append(sizes, info.Size())
+			estimate.Bytes += info.Size()
+		}
+	}
+	estimate.Files = len(files)
+
+	if err := sampleReadRate(estimate, files, sizes, budget/2); err != nil {
+		return nil, err
+	}
+	for _, algorithm := range algorithms {
+		rate, err := sampleHashRate(algorithm, budget/time.Duration(2*len(algorithms)))
+		if err != nil {
+			return nil, err
+		}
+		estimate.Algorithms = append(estimate.Algorithms, AlgorithmEstimate{
+			Algorithm: algorithm,
+			Rate:      rate,
+			Duration:  predictDuration(estimate.Bytes, estimate.ReadRate, rate, overlap),
+		})
+	}
+	return estimate, nil
+}
+
+// sampleReadRate reads blocks at offsets spread evenly across the input
+// until budget has passed and records the throughput in estimate
+func sampleReadRate(estimate *HashEstimate, files []string, sizes []int64, budget time.Duration) error {
+	buf := make([]byte, estimateSampleSize)
+	step := max(estimate.Bytes/estimateSamples, estimateSampleSize)
+	var elapsed time.Duration
+	file := 0
+	var fileStart int64
+	for offset := int64(0); offset < estimate.Bytes && (offset == 0 || elapsed < budget); offset += step {
+		// Find the file holding the offset in the concatenated input
+		for offset >= fileStart+sizes[file] {
+			fileStart += sizes[file]
+			file++
+		}
+		started := time.Now()
+		n, err := readSample(files[file], offset-fileStart, buf)
+		elapsed += time.Since(started)
+		if err != nil {
+			return err
+		}
+		estimate.Sampled += int64(n)
+	}
+	if elapsed > 0 {
+		estimate.ReadRate = float64(estimate.Sampled) / elapsed.Seconds()
+	}
+	return nil
+}
+
+// readSample reads up to len(buf) bytes of path from offset
+func readSample(path string, offset int64, buf []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := f.ReadAt(buf, offset)
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// sampleHashRate hashes a block repeatedly for about budget and returns the
+// throughput in bytes per second. None of the algorithms' speed depends on
+// the data, so the block is left zeroed.
+func sampleHashRate(algorithm HashAlgorithm, budget time.Duration) (float64, error) {
+	h, err := hasher.New(algorithm)
+	if err != nil {
+		return 0, err
+	}
+	block := make([]byte, 1024*1024)
+	var hashed int64
+	started := time.Now()
+	for hashed == 0 || time.Since(started) < budget {
+		h.Write(block)
+		hashed += int64(len(block))
+	}
+	h.Sum(nil)
+	return float64(hashed) / time.Since(started).Seconds(), nil
+}
+
+// predictDuration is the time to read and hash size bytes at the given rates
+func predictDuration(size int64, readRate, hashRate float64, overlap bool) time.Duration {
+	if size == 0 {
+		return 0
+	}
+	if readRate <= 0 || hashRate <= 0 {
+		return -1
+	}
+	read, hash := float64(size)/readRate, float64(size)/hashRate
+	seconds := read + hash
+	if overlap {
+		seconds = max(read, hash)
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// formatRate formats a throughput in bytes per second
+func formatRate(rate float64) string {
+	if rate >= 1024*1024*1024 {
+		return fmt.Sprintf("%.1f GB/s", rate/(1024*1024*1024))
+	}
+	return fmt.Sprintf("%.1f MB/s", rate/(1024*1024))
+}
+
+// runEstimate implements the estimate command
+func runEstimate(args []string) int {
+	fs := flag.NewFlagSet("estimate", flag.ExitOnError)
+	algorithms := fs.String("a", "md5,sha1,sha256,sha512", "Comma-separated algorithms to estimate")
+	budget := fs.Duration("time", 3*time.Second, "Time to spend sampling")
+	netfs := fs.Bool("netfs", false, "Predict for -netfs, where reads overlap hashing")
+	positional := parseFlags(fs, args)
+	if len(positional) == 0 || *budget <= 0 {
+		fmt.Println("Usage: hashculate estimate [-a md5,sha256] [-time 3s] [-netfs] <path>...")
+		return 1
+	}
+	var algs []HashAlgorithm
+	for _, name := range strings.Split(*algorithms, ",") {
+		alg, err := parseAlgorithm(strings.TrimSpace(name))
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		algs = append(algs, alg)
+	}
+
+	estimate, err := EstimateHashTime(positional, algs, *budget, *netfs)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Input: %d file(s), %s\n", estimate.Files, formatBytes(estimate.Bytes))
+	if estimate.Sampled > 0 {
+		fmt.Printf("Read throughput: %s (%s sampled)\n", formatRate(estimate.ReadRate), formatBytes(estimate.Sampled))
+	}
+	fmt.Println()
+	fmt.Printf("%-10s %12s  %s\n", "Algorithm", "Hash rate", "Estimated time")
+	for _, a := range estimate.Algorithms {
+		duration := a.Duration.Round(time.Second).String()
+		switch {
+		case a.Duration < 0:
+			duration = "unknown"
+		case a.Duration < time.Second:
+			duration = "under 1s"
+		}
+		fmt.Printf("%-10s %12s  %s\n", getAlgorithmName(a.Algorithm), formatRate(a.Rate), duration)
+	}
+	return 0
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEstimateHashTime(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.bin"), make([]byte, 3*1024*1024), 0644)
+	os.WriteFile(filepath.Join(dir, "b.bin"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(dir, "empty"), nil, 0644)
+
+	estimate, err := EstimateHashTime([]string{dir}, []HashAlgorithm{MD5, SHA256}, 100*time.Millisecond, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A small input is sampled in one block, which stops at the end of the first file
+	if estimate.Files != 3 || estimate.Bytes != 3*1024*1024+5 || estimate.Sampled != 3*1024*1024 {
+		t.Errorf("unexpected input: %+v", estimate)
+	}
+	if len(estimate.Algorithms) != 2 || estimate.ReadRate <= 0 || estimate.Algorithms[1].Rate <= 0 {
+		t.Fatalf("unexpected rates: %+v", estimate)
+	}
+
+	// Serial reads add the read time to the hashing time; read-ahead overlaps them
+	const gb = 1 << 30
+	if d := predictDuration(10*gb, gb, 2*gb, false); d != 15*time.Second {
+		t.Errorf("serial: expected 15s, got %s", d)
+	}
+	if d := predictDuration(10*gb, gb, 2*gb, true); d != 10*time.Second {
+		t.Errorf("overlapped: expected 10s, got %s", d)
+	}
+}
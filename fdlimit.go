@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// fdReserve descriptors are left to what a run holds open anyway: the
+// standard streams, outputs, journals, logs and directories being listed
+const fdReserve = 64
+
+// fileSlots has one slot per descriptor that files being hashed and
+// downloads may hold at once, or is nil when the system sets no useful limit
+var fileSlots = sync.OnceValue(func() chan struct{} {
+	limit := openFileLimit()
+	if limit == 0 || limit > 1<<20 {
+		return nil
+	}
+	return make(chan struct{}, max(int(limit)-fdReserve, 1))
+})
+
+// acquireFile waits until a descriptor is free, so many workers queue rather
+// than fail with "too many open files"
+func acquireFile() {
+	if slots := fileSlots(); slots != nil {
+		slots <- struct{}{}
+	}
+}
+
+// releaseFile frees the descriptor taken by acquireFile
+func releaseFile() {
+	if slots := fileSlots(); slots != nil {
+		<-slots
+	}
+}
+
+// tooManyFiles reports whether err means the process or system ran out of descriptors
+func tooManyFiles(err error) bool {
+	return errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE)
+}
+
+// openRetrying calls open until it succeeds or fails for a reason other than
+// running out of descriptors, which others, such as server connections, may
+// be holding for a moment. It gives up after about a minute.
+func openRetrying[F any](open func() (F, error)) (F, error) {
+	wait := 10 * time.Millisecond
+	for deadline := time.Now().Add(time.Minute); ; {
+		file, err := open()
+		if err == nil || !tooManyFiles(err) || time.Now().After(deadline) {
+			return file, err
+		}
+		time.Sleep(wait)
+		wait = min(2*wait, time.Second)
+	}
+}
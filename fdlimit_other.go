@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// openFileLimit is 0 where handles are only limited by memory
+func openFileLimit() uint64 {
+	return 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+func TestOpenRetrying(t *testing.T) {
+	attempts := 0
+	file, err := openRetrying(func() (string, error) {
+		attempts++
+		if attempts < 3 {
+			return "", &os.PathError{Op: "open", Path: "data.bin", Err: syscall.EMFILE}
+		}
+		return "data.bin", nil
+	})
+	if err != nil || file != "data.bin" || attempts != 3 {
+		t.Errorf("Got %q, %v after %d attempts, want data.bin after 3", file, err, attempts)
+	}
+
+	attempts = 0
+	_, err = openRetrying(func() (string, error) {
+		attempts++
+		return "", os.ErrNotExist
+	})
+	if !errors.Is(err, os.ErrNotExist) || attempts != 1 {
+		t.Errorf("Got %v after %d attempts, want a missing file reported at once", err, attempts)
+	}
+}
+
+func TestFileSlots(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows sets no open file limit")
+	}
+	limit := openFileLimit()
+	if limit == 0 {
+		t.Fatal("No open file limit read")
+	}
+	if slots := fileSlots(); slots != nil && cap(slots) != max(int(limit)-fdReserve, 1) {
+		t.Errorf("%d slots for a limit of %d", cap(slots), limit)
+	}
+	acquireFile()
+	releaseFile()
+}
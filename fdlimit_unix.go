@@ -0,0 +1,23 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// openFileLimit returns the soft RLIMIT_NOFILE, raised to the hard limit
+// first where the system permits. Go already does this at startup on most
+// systems; where it stops short, as on macOS, the attempt is repeated here.
+func openFileLimit() uint64 {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0
+	}
+	if limit.Cur < limit.Max {
+		raised := limit
+		raised.Cur = limit.Max
+		if syscall.Setrlimit(syscall.RLIMIT_NOFILE, &raised) == nil {
+			limit = raised
+		}
+	}
+	return uint64(limit.Cur)
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"hashculate/httpdigest"
+)
+
+// RedirectHop is one redirect followed while fetching a URL
+type RedirectHop struct {
+	URL      string `json:"url"`
+	Status   int    `json:"status"`
+	Location string `json:"location"`
+}
+
+// CertificateDetail identifies a certificate presented by the server
+type CertificateDetail struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"notBefore"`
+	NotAfter  time.Time `json:"notAfter"`
+	SHA256    string    `json:"sha256"`
+}
+
+// TLSDetail describes the TLS connection the body was received over
+type TLSDetail struct {
+	Version      string              `json:"version"`
+	CipherSuite  string              `json:"cipherSuite"`
+	ServerName   string              `json:"serverName"`
+	Certificates []CertificateDetail `json:"certificates"`
+}
+
+// URLSource records how a URL input was retrieved, for investigating mismatches
+type URLSource struct {
+	URL       string        `json:"url"`
+	FinalURL  string        `json:"finalUrl"`
+	Status    int           `json:"status"`
+	Redirects []RedirectHop `json:"redirects,omitempty"`
+	TLS       *TLSDetail    `json:"tls,omitempty"`
+	Headers   http.Header   `json:"headers,omitempty"`
+
+	// ContentDigest is the RFC 9530 Content-Digest the body was verified against
+	ContentDigest string `json:"contentDigest,omitempty"`
+
+	// ProviderChecksums are the storage provider checksum headers the body was
+	// verified against, such as x-amz-checksum-sha256 or x-goog-hash crc32c
+	ProviderChecksums []string `json:"providerChecksums,omitempty"`
+
+	// StoredChecksums maps the checksum properties a cloud object store keeps
+	// to verified, or to absent when the object has none
+	StoredChecksums map[string]string `json:"storedChecksums,omitempty"`
+}
+
+// maxRedirects limits how many redirects a URL input may follow
+const maxRedirects = 10
+
+// fetchTransport carries URL input requests
+var fetchTransport http.RoundTripper = http.DefaultTransport
+
+// remoteSchemes are the URL schemes accepted as inputs instead of a file path
+var remoteSchemes = []string{"http://", "https://", "webdav://", "webdavs://", "ftp://", "sftp://", "gs://"}
+
+// isURL reports whether an input names a remote resource rather than a file
+func isURL(input string) bool {
+	for _, scheme := range remoteSchemes {
+		if strings.HasPrefix(input, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoteCredentials authenticate URL inputs when the URL itself carries none
+type RemoteCredentials struct {
+	User     string
+	Password string
+	Identity string // SSH private key for sftp://
+}
+
+// resolve returns the user and password for u, preferring credentials in the URL
+func (c RemoteCredentials) resolve(u *url.URL) (string, string) {
+	user, password := c.User, c.Password
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+	return user, password
+}
+
+// FetchURLDigests downloads a URL and hashes its contents. For HTTP and
+// WebDAV the redirect chain, TLS certificates and response headers are recorded.
+func (hc *HashCalculator) FetchURLDigests(rawURL string, creds RemoteCredentials, algorithms []HashAlgorithm, progressCallback func(float64)) ([]*HashResult, *URLSource, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	var body io.ReadCloser
+	var size int64
+	switch u.Scheme {
+	case "ftp":
+		body, size, err = openFTP(u, creds)
+	case "sftp":
+		body, size, err = openSFTP(u, creds)
+	default:
+		return hc.fetchHTTP(u, creds, algorithms, progressCallback)
+	}
+	source := &URLSource{URL: u.Redacted(), FinalURL: u.Redacted()}
+	if err != nil {
+		return nil, source, fmt.Errorf("failed to fetch %s: %w", u.Redacted(), err)
+	}
+
+	results, err := hc.CalculateReaderDigests(body, path.Base(u.Path), size, algorithms, progressCallback)
+	for _, result := range results {
+		result.Path = u.Redacted()
+	}
+	if closeErr := body.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("transfer of %s failed: %w", u.Redacted(), closeErr)
+	}
+	if err != nil {
+		return nil, source, err
+	}
+	return results, source, nil
+}
+
+// fetchHTTP hashes an HTTP(S) or WebDAV resource
+func (hc *HashCalculator) fetchHTTP(u *url.URL, creds RemoteCredentials, algorithms []HashAlgorithm, progressCallback func(float64)) ([]*HashResult, *URLSource, error) {
+	source := &URLSource{URL: u.Redacted()}
+	target := *u
+	switch target.Scheme {
+	case "webdav":
+		target.Scheme = "http"
+	case "webdavs":
+		target.Scheme = "https"
+	case "gs":
+		target = gcsObjectURL(u)
+	}
+	user, password := creds.resolve(u)
+	target.User = nil
+
+	client := &http.Client{
+		Transport: fetchTransport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			previous := via[len(via)-1]
+			source.Redirects = append(source.Redirects, RedirectHop{
+				URL:      previous.URL.String(),
+				Status:   req.Response.StatusCode,
+				Location: req.URL.String(),
+			})
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, source, fmt.Errorf("invalid URL: %w", err)
+	}
+	switch {
+	case u.Scheme == "gs" && password != "":
+		req.Header.Set("Authorization", "Bearer "+password)
+	case user != "":
+		req.SetBasicAuth(user, password)
+	}
+	req.Header.Set("Want-Content-Digest", httpdigest.WantContentDigest)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, source, fmt.Errorf("failed to fetch %s: %w", source.URL, err)
+	}
+	defer resp.Body.Close()
+
+	source.FinalURL = resp.Request.URL.String()
+	source.Status = resp.StatusCode
+	source.Headers = resp.Header
+	if resp.TLS != nil {
+		source.TLS = tlsDetail(resp.TLS)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, source, fmt.Errorf("%s returned %s", source.FinalURL, resp.Status)
+	}
+
+	name := path.Base(resp.Request.URL.Path)
+	if name == "/" || name == "." {
+		name = resp.Request.URL.Host
+	}
+	// Check the body against Content-Digest, sent as a header or announced as a trailer.
+	// A body the transport decompressed no longer matches the digest of what was sent.
+	var body io.Reader = resp.Body
+	var verifier *httpdigest.Verifier
+	_, trailer := resp.Trailer["Content-Digest"]
+	if (resp.Header.Get("Content-Digest") != "" || trailer) && !resp.Uncompressed {
+		verifier = httpdigest.NewVerifier()
+		body = io.TeeReader(body, verifier)
+	}
+	// Object stores send checksums of the stored object in their own headers
+	var checksums []*cloudChecksum
+	if !resp.Uncompressed {
+		checksums = cloudChecksums(resp.Header)
+	}
+	for _, checksum := range checksums {
+		body = io.TeeReader(body, checksum)
+	}
+	results, err := hc.CalculateReaderDigests(body, name, resp.ContentLength, algorithms, progressCallback)
+	if err != nil {
+		return nil, source, err
+	}
+	for _, result := range results {
+		result.Path = source.URL
+	}
+	if verifier != nil {
+		field := resp.Header.Get("Content-Digest")
+		if field == "" {
+			field = resp.Trailer.Get("Content-Digest")
+		}
+		switch err := verifier.Check(field); err {
+		case nil:
+			source.ContentDigest = field
+		case httpdigest.ErrNoKnownDigest:
+		default:
+			return nil, source, fmt.Errorf("%s: %w", source.FinalURL, err)
+		}
+	}
+	for _, checksum := range checksums {
+		if err := checksum.check(); err != nil {
+			// Azure keeps whatever Content-MD5 the uploader set, which later writes can leave stale
+			if cloudProvider(resp.Request.URL) == "azure" && strings.HasSuffix(checksum.name, "md5") {
+				err = fmt.Errorf("%w; the stored Content-MD5 may be stale", err)
+			}
+			return nil, source, fmt.Errorf("%s: %w", source.FinalURL, err)
+		}
+		source.ProviderChecksums = append(source.ProviderChecksums, checksum.name)
+	}
+	source.StoredChecksums = storedChecksumStatus(cloudProvider(resp.Request.URL), resp.Header, source.ProviderChecksums)
+	return results, source, nil
+}
+
+// tlsDetail summarizes a TLS connection state
+func tlsDetail(state *tls.ConnectionState) *TLSDetail {
+	detail := &TLSDetail{
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ServerName:  state.ServerName,
+	}
+	for _, cert := range state.PeerCertificates {
+		sum := sha256.Sum256(cert.Raw)
+		detail.Certificates = append(detail.Certificates, CertificateDetail{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			NotBefore: cert.NotBefore.UTC(),
+			NotAfter:  cert.NotAfter.UTC(),
+			SHA256:    fmt.Sprintf("%x", sum),
+		})
+	}
+	return detail
+}
+
+// printURLSource prints where a URL input was finally retrieved from
+func printURLSource(source *URLSource) {
+	fmt.Println()
+	fmt.Printf("Source: %s\n", source.URL)
+	for _, hop := range source.Redirects {
+		fmt.Printf("  %d redirect %s -> %s\n", hop.Status, hop.URL, hop.Location)
+	}
+	if source.Status != 0 {
+		fmt.Printf("Final URL: %s (%d)\n", source.FinalURL, source.Status)
+	}
+	if source.TLS != nil && len(source.TLS.Certificates) > 0 {
+		leaf := source.TLS.Certificates[0]
+		fmt.Printf("TLS: %s, %s\n", source.TLS.Version, leaf.Subject)
+		fmt.Printf("Certificate SHA-256: %s\n", leaf.SHA256)
+	}
+	if source.ContentDigest != "" {
+		fmt.Printf("Content-Digest: verified (%s)\n", source.ContentDigest)
+	}
+	if len(source.ProviderChecksums) > 0 {
+		fmt.Printf("Provider checksum: verified (%s)\n", strings.Join(source.ProviderChecksums, ", "))
+	}
+	for _, property := range []string{"crc32c", "md5"} {
+		switch source.StoredChecksums[property] {
+		case "verified":
+			fmt.Printf("Stored %s: verified\n", strings.ToUpper(property))
+		case "absent":
+			fmt.Printf("Stored %s: absent, the object cannot be checked against it\n", strings.ToUpper(property))
+		case "unchecked":
+			fmt.Printf("Stored %s: not checked, it covers the stored form of the object\n", strings.ToUpper(property))
+		}
+	}
+}
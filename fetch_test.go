@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"hashculate/httpdigest"
+)
+
+func TestFetchURLDigests(t *testing.T) {
+	body := []byte("mirrored release")
+	mux := http.NewServeMux()
+	mux.HandleFunc("/latest", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/v1/release.tar.gz", http.StatusFound)
+	})
+	sum := sha256.Sum256(body)
+	contentDigest := "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+	mux.HandleFunc("/v1/release.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Digest", contentDigest)
+		w.Write(body)
+	})
+	mux.HandleFunc("/corrupted.tar.gz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Content-Digest")
+		w.Write([]byte("corrupted release"))
+		w.Header().Set("Content-Digest", contentDigest)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	fetchTransport = server.Client().Transport
+	defer func() { fetchTransport = http.DefaultTransport }()
+
+	results, source, err := NewHashCalculator().FetchURLDigests(server.URL+"/latest", RemoteCredentials{}, []HashAlgorithm{SHA256}, nil)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(body)); results[0].Hash != want || results[0].Filename != "release.tar.gz" {
+		t.Errorf("Unexpected result: %+v", results[0])
+	}
+	if len(source.Redirects) != 1 || source.Redirects[0].Status != http.StatusFound || source.FinalURL != server.URL+"/v1/release.tar.gz" {
+		t.Errorf("Redirect chain not recorded: %+v", source)
+	}
+	if source.ContentDigest != contentDigest {
+		t.Errorf("Content-Digest not verified: %q", source.ContentDigest)
+	}
+	leaf := sha256.Sum256(server.Certificate().Raw)
+	if source.TLS == nil || source.TLS.Certificates[0].SHA256 != fmt.Sprintf("%x", leaf) {
+		t.Errorf("TLS certificate fingerprint not recorded: %+v", source.TLS)
+	}
+
+	var out bytes.Buffer
+	WriteJSONReport(&out, results[0], source)
+	var report map[string]any
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Invalid JSON report: %v", err)
+	}
+	headers := report["source"].(map[string]any)["headers"].(map[string]any)
+	if headers["Etag"].([]any)[0] != `"v1"` {
+		t.Errorf("Response headers missing from report: %v", headers)
+	}
+
+	if _, _, err := NewHashCalculator().FetchURLDigests(server.URL+"/missing", RemoteCredentials{}, []HashAlgorithm{SHA256}, nil); err == nil {
+		t.Error("Expected an error for a 404 response")
+	}
+	if _, _, err := NewHashCalculator().FetchURLDigests(server.URL+"/corrupted.tar.gz", RemoteCredentials{}, []HashAlgorithm{SHA256}, nil); !errors.Is(err, httpdigest.ErrDigestMismatch) {
+		t.Errorf("Expected a Content-Digest trailer mismatch, got %v", err)
+	}
+}
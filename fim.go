@@ -0,0 +1,431 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AlertConfig names the log sink deviations are shipped to
+type AlertConfig struct {
+	LogSink   string `json:"log-sink"`
+	LogTarget string `json:"log-target"`
+	LogToken  string `json:"log-token"`
+}
+
+// PolicyGroup is a set of paths monitored with the same algorithms, schedule,
+// excludes and alert destination
+type PolicyGroup struct {
+	Name        string      `json:"name"`
+	Paths       []string    `json:"paths"`
+	Algorithms  []string    `json:"algorithms"`
+	Interval    string      `json:"interval"`
+	Exclude     []string    `json:"exclude"`
+	Alert       AlertConfig `json:"alert"`
+	Permissions bool        `json:"permissions"` // Also report mode, owner, ACL and capability changes
+	Labels      bool        `json:"labels"`      // Also report SELinux or Smack label changes
+
+	algorithms []HashAlgorithm
+	interval   time.Duration
+}
+
+// FIMConfig is the fim.yaml policy of the file integrity monitor. Top-level
+// paths form a group named "default"; the other top-level settings are
+// defaults for every group.
+type FIMConfig struct {
+	Database    string          `json:"database"`
+	Interval    string          `json:"interval"`
+	Algorithm   string          `json:"algorithm"`
+	Paths       []string        `json:"paths"`
+	Ignore      []string        `json:"ignore"`
+	Alert       AlertConfig     `json:"alert"`
+	Groups      []PolicyGroup   `json:"groups"`
+	Permissions bool            `json:"permissions"`
+	Labels      bool            `json:"labels"`
+	Retention   RetentionPolicy `json:"retention"`
+}
+
+// FIMChange is a deviation from the recorded baseline
+type FIMChange struct {
+	Group   string
+	Path    string
+	Kind    string // added, removed, modified, permissions or label
+	OldHash string
+	NewHash string
+	Detail  string // How the permissions or label changed
+}
+
+// LoadFIMConfig reads and validates a FIM policy file
+func LoadFIMConfig(path string) (*FIMConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	config := &FIMConfig{}
+	if err := decodeYAML(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if config.Database == "" {
+		return nil, fmt.Errorf("config %s: database is required", path)
+	}
+	if config.Interval == "" {
+		config.Interval = "5m"
+	}
+	if config.Algorithm == "" {
+		config.Algorithm = "sha256"
+	}
+	if len(config.Paths) > 0 {
+		config.Groups = append([]PolicyGroup{{Name: "default", Paths: config.Paths}}, config.Groups...)
+	}
+	if len(config.Groups) == 0 {
+		return nil, fmt.Errorf("config %s: no paths to monitor", path)
+	}
+	if err := config.Retention.parse(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range config.Groups {
+		group := &config.Groups[i]
+		if group.Name == "" {
+			group.Name = fmt.Sprintf("group-%d", i+1)
+		}
+		if names[group.Name] {
+			return nil, fmt.Errorf("config %s: duplicate group %q", path, group.Name)
+		}
+		names[group.Name] = true
+		if len(group.Paths) == 0 {
+			return nil, fmt.Errorf("config %s: group %q has no paths", path, group.Name)
+		}
+		if len(group.Algorithms) == 0 {
+			group.Algorithms = []string{config.Algorithm}
+		}
+		for _, name := range group.Algorithms {
+			alg, err := parseAlgorithm(name)
+			if err != nil {
+				return nil, fmt.Errorf("config %s: group %q: %w", path, group.Name, err)
+			}
+			group.algorithms = append(group.algorithms, alg)
+		}
+		if group.Interval == "" {
+			group.Interval = config.Interval
+		}
+		if group.interval, err = time.ParseDuration(group.Interval); err != nil || group.interval <= 0 {
+			return nil, fmt.Errorf("config %s: group %q: invalid interval %q", path, group.Name, group.Interval)
+		}
+		group.Exclude = append(group.Exclude, config.Ignore...)
+		if group.Alert.LogSink == "" {
+			group.Alert = config.Alert
+		}
+		group.Permissions = group.Permissions || config.Permissions
+		group.Labels = group.Labels || config.Labels
+	}
+	return config, nil
+}
+
+// ignored reports whether a path matches an ignore rule. A rule matches the
+// full path, the base name, or (for a directory path) everything below it.
+func ignored(path string, rules []string) bool {
+	slashed := filepath.ToSlash(path)
+	for _, rule := range rules {
+		rule = filepath.ToSlash(rule)
+		if matched, _ := filepath.Match(rule, slashed); matched {
+			return true
+		}
+		if matched, _ := filepath.Match(rule, filepath.Base(path)); matched {
+			return true
+		}
+		if strings.HasPrefix(slashed, strings.TrimSuffix(rule, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// underPaths reports whether a database path lies under one of roots
+func underPaths(path string, roots []string) bool {
+	for _, root := range roots {
+		root = dbKey(root)
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FIMMonitor compares monitored paths with the baseline in the hash database
+type FIMMonitor struct {
+	Config *FIMConfig
+	DB     *HashDB
+	calc   *HashCalculator
+}
+
+// NewFIMMonitor opens the database named by the configuration
+func NewFIMMonitor(config *FIMConfig) (*FIMMonitor, error) {
+	db, err := OpenHashDB(config.Database)
+	if err != nil {
+		return nil, err
+	}
+	db.Backups = config.Retention.Backups
+	return &FIMMonitor{Config: config, DB: db, calc: NewHashCalculator()}, nil
+}
+
+// Scan checks every group once
+func (m *FIMMonitor) Scan() ([]FIMChange, error) {
+	var changes []FIMChange
+	for i := range m.Config.Groups {
+		groupChanges, err := m.ScanGroup(&m.Config.Groups[i])
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, groupChanges...)
+	}
+	return changes, nil
+}
+
+// ScanGroup walks a group's paths once, hashing only files whose size or
+// modification time changed (or that lack one of the group's algorithms), and
+// records the new state as the baseline. Files are not reported as added
+// while the group's baseline is first being built.
+func (m *FIMMonitor) ScanGroup(group *PolicyGroup) ([]FIMChange, error) {
+	baseline := true
+	for _, entry := range m.DB.Entries() {
+		if underPaths(entry.Path, group.Paths) {
+			baseline = false
+			break
+		}
+	}
+	seen := map[string]bool{}
+	var changes []FIMChange
+	primary := group.algorithms[0]
+
+	for _, root := range group.Paths {
+		files, err := listFiles(root)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		for _, path := range files {
+			key := dbKey(path)
+			if ignored(path, group.Exclude) || key == dbKey(m.Config.Database) || key == dbKey(m.Config.Database+".tmp") ||
+				isBackup(key, dbKey(m.Config.Database)) || strings.HasPrefix(key, dbKey(snapshotDir(m.Config.Database))+"/") {
+				continue
+			}
+			seen[key] = true
+			info, err := os.Stat(path)
+			if err != nil {
+				continue // removed during the scan; reported next time
+			}
+			previous, known := m.DB.Get(key)
+			unchanged := known && previous.Size == info.Size() && previous.Modified.Equal(info.ModTime().UTC())
+			missing := false
+			for _, alg := range group.algorithms {
+				missing = missing || previous.Hashes[alg] == ""
+			}
+			// chmod and chown leave the modification time alone, so permissions are read every scan
+			meta := previous.Meta
+			if group.Permissions {
+				if current, err := ReadFileMeta(path); err == nil {
+					if previous.Meta != nil {
+						if drift := previous.Meta.Drift(current); len(drift) > 0 {
+							changes = append(changes, FIMChange{Group: group.Name, Path: key, Kind: "permissions", Detail: strings.Join(drift, ", ")})
+						}
+					}
+					meta = current
+				}
+			}
+			label := previous.Label
+			if group.Labels {
+				current := readSecurityLabel(path)
+				if previous.Label != "" && current != previous.Label {
+					changes = append(changes, FIMChange{Group: group.Name, Path: key, Kind: "label", Detail: fmt.Sprintf("%s → %s", previous.Label, metaValue(current))})
+				}
+				label = current
+			}
+			if unchanged && !missing {
+				if meta != previous.Meta || label != previous.Label {
+					previous.Meta, previous.Label = meta, label
+					m.DB.Put(previous)
+				}
+				continue
+			}
+			entry, err := HashFileEntry(m.calc, path, group.algorithms)
+			if err != nil {
+				continue
+			}
+			entry.Meta, entry.Label = meta, label
+			modified := false
+			for alg, hash := range entry.Hashes {
+				if old := previous.Hashes[alg]; old != "" && old != hash {
+					modified = true
+				}
+			}
+			switch {
+			case !known && !baseline:
+				changes = append(changes, FIMChange{Group: group.Name, Path: key, Kind: "added", NewHash: entry.Hashes[primary]})
+			case modified:
+				changes = append(changes, FIMChange{Group: group.Name, Path: key, Kind: "modified", OldHash: previous.Hashes[primary], NewHash: entry.Hashes[primary]})
+			}
+			if unchanged {
+				// Keep hashes recorded for other groups' algorithms
+				for alg, hash := range previous.Hashes {
+					if entry.Hashes[alg] == "" {
+						entry.Hashes[alg] = hash
+					}
+				}
+			}
+			m.DB.Put(entry)
+		}
+	}
+
+	// With retention, removed files keep their last hashes until they expire
+	retention := m.Config.Retention
+	now := time.Now()
+	for _, entry := range m.DB.Entries() {
+		if seen[entry.Path] || !underPaths(entry.Path, group.Paths) {
+			continue
+		}
+		if ignored(entry.Path, group.Exclude) {
+			m.DB.Delete(entry.Path)
+			continue
+		}
+		changes = append(changes, FIMChange{Group: group.Name, Path: entry.Path, Kind: "removed", OldHash: entry.Hashes[primary]})
+		if retention.ExpireDeleted != "" {
+			m.DB.Retire(entry.Path, now)
+		} else {
+			m.DB.Delete(entry.Path)
+		}
+	}
+	if retention.ExpireDeleted != "" {
+		m.DB.Expire(now.Add(-retention.expire))
+	}
+	if err := m.DB.Save(); err != nil {
+		return changes, err
+	}
+	if retention.Snapshots > 0 && (baseline || len(changes) > 0) {
+		return changes, keepSnapshot(m.Config.Database, retention.Snapshots, now)
+	}
+	return changes, nil
+}
+
+// fimFlags are the flags of the fim command
+type fimFlags struct {
+	configPath, only, healthAddr *string
+	once                         *bool
+}
+
+// newFIMFlags defines the flags of the fim command, which config check shares
+func newFIMFlags() (*flag.FlagSet, *fimFlags) {
+	fs := flag.NewFlagSet("fim", flag.ExitOnError)
+	return fs, &fimFlags{
+		configPath: fs.String("config", "fim.yaml", "FIM policy file"),
+		once:       fs.Bool("once", false, "Scan once and exit (non-zero when deviations were found)"),
+		only:       fs.String("group", "", "Only scan the named policy group"),
+		healthAddr: fs.String("health", "", "Serve GET /healthz on this address, failing while a group's last scan failed, and POST /reload"),
+	}
+}
+
+// runFIM implements the fim command
+func runFIM(args []string) int {
+	fs, flags := newFIMFlags()
+	parseFlags(fs, args)
+
+	state, err := loadFIMState(*flags.configPath, *flags.only, nil)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer func() { state.close() }()
+
+	// Orchestrators probe the monitor over HTTP, as they would serve
+	health := &healthStatus{}
+	reloads := reloadRequested()
+	if *flags.healthAddr != "" && !*flags.once {
+		mux := http.NewServeMux()
+		mux.Handle("GET /healthz", health)
+		mux.Handle("POST /reload", reloadHandler(reloads))
+		listener, err := net.Listen("tcp", *flags.healthAddr)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer listener.Close()
+		go (&http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}).Serve(listener)
+	}
+
+	// A scan in progress finishes before the monitor stops
+	var stop <-chan struct{}
+	if !*flags.once {
+		stop = stopRequested()
+		notifyReady(fmt.Sprintf("Monitoring %d group(s)", len(state.groups)))
+	}
+	// Schedules follow the last scan of each group, so a reloaded interval applies at once
+	last := map[string]time.Time{}
+	deviations := 0
+	for {
+		for _, group := range state.groups {
+			started := time.Now()
+			if started.Before(last[group.Name].Add(group.interval)) {
+				continue
+			}
+			last[group.Name] = started
+			sink := state.sinks[group.Name]
+
+			changes, err := state.monitor.ScanGroup(group)
+			health.Set("group "+group.Name, err)
+			if err != nil {
+				fmt.Printf("Error: group %s: %v\n", group.Name, err)
+				sink.Emit(logError, "fim.error", err.Error(), map[string]any{"group": group.Name})
+				if *flags.once {
+					return 1
+				}
+			}
+			for _, change := range changes {
+				fields := map[string]any{
+					"group": group.Name, "path": change.Path, "change": change.Kind,
+					"algorithm": string(group.algorithms[0]), "old_hash": change.OldHash, "new_hash": change.NewHash,
+				}
+				if change.Detail != "" {
+					fmt.Printf("%s %s: %s (%s)\n", started.Format(time.RFC3339), strings.ToUpper(change.Kind), change.Path, change.Detail)
+					fields["detail"] = change.Detail
+				} else {
+					fmt.Printf("%s %s: %s\n", started.Format(time.RFC3339), strings.ToUpper(change.Kind), change.Path)
+				}
+				sink.Emit(logWarning, "fim."+change.Kind, fmt.Sprintf("%s %s", change.Path, change.Kind), fields)
+			}
+			deviations += len(changes)
+			summary := fmt.Sprintf("group %s: %d deviation(s)", group.Name, len(changes))
+			fmt.Printf("%s Scan complete: %s\n", started.Format(time.RFC3339), summary)
+			sink.Emit(logInfo, "scan.summary", "fim: "+summary, map[string]any{"group": group.Name, "deviations": len(changes)})
+		}
+
+		if *flags.once {
+			if deviations > 0 {
+				return 1
+			}
+			return 0
+		}
+		wait := time.Hour
+		for _, group := range state.groups {
+			wait = min(wait, time.Until(last[group.Name].Add(group.interval)))
+		}
+		select {
+		case <-stop:
+			notifyStopping()
+			return 0
+		case request := <-reloads:
+			reloaded, err := reloadFIM(state, flags, health)
+			if err == nil {
+				state = reloaded
+			}
+			if request.reply != nil {
+				request.reply <- err
+			}
+		case <-time.After(max(wait, time.Second)):
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFIMScan(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "etc")
+	os.MkdirAll(filepath.Join(watched, "cache"), 0755)
+	os.WriteFile(filepath.Join(watched, "passwd"), []byte("root:x:0:0"), 0644)
+	os.WriteFile(filepath.Join(watched, "hosts"), []byte("127.0.0.1 localhost"), 0644)
+	os.WriteFile(filepath.Join(watched, "cache", "state"), []byte("volatile"), 0644)
+
+	configPath := filepath.Join(dir, "fim.yaml")
+	os.WriteFile(configPath, []byte("database: "+filepath.Join(dir, "fim.json")+"\npaths:\n  - "+watched+"\nignore:\n  - \"*.swp\"\n  - "+filepath.Join(watched, "cache")+"\n"), 0644)
+	config, err := LoadFIMConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	monitor, _ := NewFIMMonitor(config)
+
+	if changes, err := monitor.Scan(); err != nil || len(changes) != 0 {
+		t.Fatalf("Baseline scan reported %v (%v)", changes, err)
+	}
+	if len(monitor.DB.Entries()) != 2 {
+		t.Fatalf("Expected 2 files in the baseline, got %d", len(monitor.DB.Entries()))
+	}
+
+	// Changes to ignored files are not deviations
+	os.WriteFile(filepath.Join(watched, "cache", "state"), []byte("changed"), 0644)
+	os.WriteFile(filepath.Join(watched, ".passwd.swp"), []byte("swap"), 0644)
+	os.WriteFile(filepath.Join(watched, "passwd"), []byte("root:x:0:0\nevil:x:0:0"), 0644)
+	os.Chtimes(filepath.Join(watched, "passwd"), time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	os.Remove(filepath.Join(watched, "hosts"))
+	os.WriteFile(filepath.Join(watched, "shadow"), []byte("new"), 0644)
+
+	monitor, _ = NewFIMMonitor(config)
+	changes, err := monitor.Scan()
+	if err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	kinds := map[string]string{}
+	for _, change := range changes {
+		kinds[filepath.Base(change.Path)] = change.Kind
+	}
+	want := map[string]string{"passwd": "modified", "hosts": "removed", "shadow": "added"}
+	if len(kinds) != len(want) || kinds["passwd"] != "modified" || kinds["hosts"] != "removed" || kinds["shadow"] != "added" {
+		t.Errorf("Changes = %v, want %v", kinds, want)
+	}
+
+	// Deviations are reported once; the new state becomes the baseline
+	if changes, _ := monitor.Scan(); len(changes) != 0 {
+		t.Errorf("Expected no repeated deviations, got %v", changes)
+	}
+}
+
+func TestFIMPolicyGroups(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "bin"), 0755)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	os.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("binary"), 0755)
+	os.WriteFile(filepath.Join(dir, "conf", "app.conf"), []byte("key=value"), 0644)
+	os.WriteFile(filepath.Join(dir, "conf", "app.log"), []byte("noise"), 0644)
+
+	policy := `database: ` + filepath.Join(dir, "fim.json") + `
+interval: 10m
+ignore: ["*.log"]
+alert:
+  log-sink: syslog
+groups:
+  - name: binaries
+    paths: [` + filepath.Join(dir, "bin") + `]
+    algorithms: [sha256, sha512]
+    interval: 1h
+  - name: config
+    paths:
+      - ` + filepath.Join(dir, "conf") + `
+    alert:
+      log-sink: gelf
+`
+	configPath := filepath.Join(dir, "policy.yaml")
+	os.WriteFile(configPath, []byte(policy), 0644)
+	config, err := LoadFIMConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	binaries, conf := &config.Groups[0], &config.Groups[1]
+	if binaries.interval != time.Hour || conf.interval != 10*time.Minute {
+		t.Errorf("Unexpected intervals: %v, %v", binaries.interval, conf.interval)
+	}
+	if binaries.Alert.LogSink != "syslog" || conf.Alert.LogSink != "gelf" {
+		t.Errorf("Unexpected alert destinations: %+v, %+v", binaries.Alert, conf.Alert)
+	}
+
+	monitor, _ := NewFIMMonitor(config)
+	if _, err := monitor.Scan(); err != nil {
+		t.Fatalf("Scan failed: %v", err)
+	}
+	tool, _ := monitor.DB.Get(filepath.Join(dir, "bin", "tool"))
+	if tool.Hashes[SHA256] == "" || tool.Hashes[SHA512] == "" {
+		t.Errorf("Expected both group algorithms to be recorded, got %v", tool.Hashes)
+	}
+	if _, ok := monitor.DB.Get(filepath.Join(dir, "conf", "app.log")); ok {
+		t.Error("Top-level ignore rule was not applied to the group")
+	}
+
+	// Deviations in one group are not attributed to another
+	os.WriteFile(filepath.Join(dir, "conf", "app.conf"), []byte("key=changed"), 0644)
+	os.Chtimes(filepath.Join(dir, "conf", "app.conf"), time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if changes, _ := monitor.ScanGroup(binaries); len(changes) != 0 {
+		t.Errorf("Unexpected deviations in binaries group: %v", changes)
+	}
+	if changes, _ := monitor.ScanGroup(conf); len(changes) != 1 || changes[0].Group != "config" {
+		t.Errorf("Expected one config deviation, got %v", changes)
+	}
+}
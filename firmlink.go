@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// macOSDataVolume is where macOS mounts the writable data volume
+const macOSDataVolume = "/System/Volumes/Data"
+
+// firmlinks maps directories on the macOS data volume to the paths on the
+// read-only system volume that show them, e.g. /System/Volumes/Data/Users
+// to /Users. It is empty on other systems.
+var firmlinks = sync.OnceValue(func() map[string]string {
+	return loadFirmlinks("/usr/share/firmlinks", macOSDataVolume)
+})
+
+// loadFirmlinks reads a firmlinks table, one "/Users<TAB>Users" line per
+// firmlink, with the data volume's paths taken below dataVolume
+func loadFirmlinks(path, dataVolume string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	links := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		shown, data, ok := strings.Cut(scanner.Text(), "\t")
+		if ok && strings.HasPrefix(shown, "/") && data != "" {
+			links[filepath.Join(dataVolume, data)] = shown
+		}
+	}
+	return links
+}
+
+// firmlinked reports whether path lies in a data volume directory that the
+// scan also reaches through its firmlink from one of roots (absolute), so
+// listing both would count every file twice
+func firmlinked(path string, roots []string) bool {
+	links := firmlinks()
+	if len(links) == 0 {
+		return false
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for data, shown := range links {
+		if !within(path, data) {
+			continue
+		}
+		for _, root := range roots {
+			if within(shown, root) {
+				return true
+			}
+		}
+	}
+	return false
+}
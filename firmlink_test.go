@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestFirmlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("firmlinks are macOS paths")
+	}
+	dir := t.TempDir()
+	table := filepath.Join(dir, "firmlinks")
+	os.WriteFile(table, []byte("/Users\tUsers\n/usr/local\tusr/local\n"), 0644)
+	links := loadFirmlinks(table, "/System/Volumes/Data")
+	if links["/System/Volumes/Data/Users"] != "/Users" || links["/System/Volumes/Data/usr/local"] != "/usr/local" {
+		t.Fatalf("Unexpected firmlinks: %v", links)
+	}
+
+	saved := firmlinks
+	defer func() { firmlinks = saved }()
+	firmlinks = func() map[string]string { return links }
+	if !firmlinked("/System/Volumes/Data/Users/alice/notes.txt", []string{"/"}) {
+		t.Error("Expected a data volume file to be skipped when / is scanned")
+	}
+	if firmlinked("/System/Volumes/Data/Users/alice/notes.txt", []string{"/System/Volumes/Data"}) {
+		t.Error("Expected a data volume file to be kept when only the data volume is scanned")
+	}
+	if firmlinked("/Users/alice/notes.txt", []string{"/"}) || firmlinked("/System/Volumes/Data/private/x", []string{"/"}) {
+		t.Error("Expected paths outside firmlinked directories to be kept")
+	}
+}
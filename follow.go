@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"hashculate/hasher"
+)
+
+// followPoll is how often a followed file is checked for new data
+const followPoll = 250 * time.Millisecond
+
+// ErrTruncated is returned when a followed file shrinks below what was already hashed
+var ErrTruncated = errors.New("file was truncated below the hashed offset")
+
+// FollowOptions controls when rolling digests are emitted
+type FollowOptions struct {
+	Every    int64         // Emit at every multiple of this many bytes; 0 disables
+	Interval time.Duration // Emit when new data arrived and this much time passed; 0 disables
+}
+
+// RollingDigest is the digest of a followed file's first Offset bytes
+type RollingDigest struct {
+	Offset    int64         `json:"offset"`
+	Time      time.Time     `json:"time"`
+	Algorithm HashAlgorithm `json:"algorithm"`
+	Hash      string        `json:"hash"`
+}
+
+// Follow hashes a file as it grows, like tail -f, calling emit with the
+// digest of everything read so far at the configured byte offsets and time
+// intervals. It returns the final digest once stop is closed. A file that
+// shrinks or is replaced is an error, since the hashed data is gone.
+func (hc *HashCalculator) Follow(filePath string, algorithm HashAlgorithm, opts FollowOptions, stop <-chan struct{}, emit func(RollingDigest)) (RollingDigest, error) {
+	file, err := hc.openInput(filePath)
+	if err != nil {
+		return RollingDigest{}, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	opened, err := file.Stat()
+	if err != nil {
+		return RollingDigest{}, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	stream, err := hasher.NewStream([]HashAlgorithm{algorithm}, -1, nil)
+	if err != nil {
+		return RollingDigest{}, err
+	}
+	current := func() RollingDigest {
+		return RollingDigest{Offset: stream.Written(), Time: time.Now().UTC(), Algorithm: algorithm, Hash: stream.Digests()[0].Hash}
+	}
+	chunkSize := hc.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = hasher.DefaultChunkSize
+	}
+	buffer := make([]byte, chunkSize)
+	lastOffset, lastTime := int64(0), time.Now()
+	for {
+		select {
+		case <-stop:
+			return current(), nil
+		default:
+		}
+
+		// Stop reads at the next byte boundary so digests land on exact multiples
+		limit := int64(len(buffer))
+		if opts.Every > 0 {
+			limit = min(limit, opts.Every-stream.Written()%opts.Every)
+		}
+		n, err := file.Read(buffer[:limit])
+		if n > 0 {
+			stream.Write(buffer[:n])
+			onBoundary := opts.Every > 0 && stream.Written()%opts.Every == 0
+			if onBoundary || (opts.Interval > 0 && time.Since(lastTime) >= opts.Interval) {
+				emit(current())
+				lastOffset, lastTime = stream.Written(), time.Now()
+			}
+			continue
+		}
+		if err != nil && err != io.EOF {
+			return current(), fmt.Errorf("failed to read file: %w", err)
+		}
+
+		// At the end of the data written so far: wait for more
+		if info, err := os.Stat(filePath); err != nil || !os.SameFile(info, opened) {
+			return current(), fmt.Errorf("%s was removed or replaced", filePath)
+		} else if info.Size() < stream.Written() {
+			return current(), ErrTruncated
+		}
+		if opts.Interval > 0 && stream.Written() > lastOffset && time.Since(lastTime) >= opts.Interval {
+			emit(current())
+			lastOffset, lastTime = stream.Written(), time.Now()
+		}
+		select {
+		case <-stop:
+		case <-time.After(followPoll):
+		}
+	}
+}
+
+// runFollow implements -follow, printing rolling digests until interrupted
+func runFollow(calculator *HashCalculator, filePath string, algorithm HashAlgorithm, opts FollowOptions, output string) int {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+
+	encoder := json.NewEncoder(os.Stdout)
+	show := func(digest RollingDigest) {
+		if output == "json" {
+			encoder.Encode(digest)
+			return
+		}
+		fmt.Printf("%s offset %d %s\n", digest.Time.Format(time.RFC3339), digest.Offset, digest.Hash)
+	}
+	if output == "text" {
+		fmt.Printf("Following %s with %s; press Ctrl-C to stop\n", filePath, getAlgorithmName(algorithm))
+	}
+	final, err := calculator.Follow(filePath, algorithm, opts, stop, show)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (last digest at offset %d: %s)\n", err, final.Offset, final.Hash)
+		return 1
+	}
+	show(final)
+	return 0
+}
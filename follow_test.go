@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(path, []byte("first\n"), 0644)
+	go func() {
+		f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+		defer f.Close()
+		for _, line := range []string{"second\n", "third\n"} {
+			time.Sleep(50 * time.Millisecond)
+			f.WriteString(line)
+		}
+	}()
+
+	stop := make(chan struct{})
+	var offsets []int64
+	final, err := NewHashCalculator().Follow(path, SHA256, FollowOptions{Every: 5}, stop, func(d RollingDigest) {
+		data, _ := os.ReadFile(path)
+		if want := fmt.Sprintf("%x", sha256.Sum256(data[:d.Offset])); d.Hash != want {
+			t.Errorf("digest at offset %d: %s, want %s", d.Offset, d.Hash, want)
+		}
+		offsets = append(offsets, d.Offset)
+		if d.Offset == 15 {
+			close(stop)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(offsets) != "[5 10 15]" || final.Offset != 15 {
+		t.Errorf("digests at %v, final at %d", offsets, final.Offset)
+	}
+
+	// Data that was already hashed disappearing is reported
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.Truncate(path, 3)
+	}()
+	_, err = NewHashCalculator().Follow(path, SHA256, FollowOptions{}, make(chan struct{}), func(RollingDigest) {})
+	if !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated, got %v", err)
+	}
+}
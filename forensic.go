@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CaseInfo identifies the case and evidence an acquisition belongs to
+type CaseInfo struct {
+	CaseNumber     string `json:"case-number"`
+	EvidenceNumber string `json:"evidence-number"`
+	Examiner       string `json:"examiner"`
+	Description    string `json:"description"`
+	Notes          string `json:"notes"`
+}
+
+// empty reports whether no case field is set
+func (c CaseInfo) empty() bool {
+	return c == CaseInfo{}
+}
+
+// override replaces fields with those set in other
+func (c *CaseInfo) override(other CaseInfo) {
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.CaseNumber, other.CaseNumber},
+		{&c.EvidenceNumber, other.EvidenceNumber},
+		{&c.Examiner, other.Examiner},
+		{&c.Description, other.Description},
+		{&c.Notes, other.Notes},
+	} {
+		if field.src != "" {
+			*field.dst = field.src
+		}
+	}
+}
+
+// LoadCaseInfo reads the `case:` block of a YAML file
+func LoadCaseInfo(path string) (CaseInfo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return CaseInfo{}, fmt.Errorf("failed to read case file: %w", err)
+	}
+	var doc struct {
+		Case CaseInfo `json:"case"`
+	}
+	if err := decodeYAML(data, &doc); err != nil {
+		return CaseInfo{}, fmt.Errorf("invalid case file %s: %w", path, err)
+	}
+	return doc.Case, nil
+}
+
+// SourceInfo describes the acquired file or device
+type SourceInfo struct {
+	Path   string
+	Type   string
+	Size   int64
+	Vendor string
+	Model  string
+	Serial string
+}
+
+// DescribeSource identifies a source. For Linux block devices the size,
+// vendor, model and serial number are read from sysfs.
+func DescribeSource(path string) SourceInfo {
+	source := SourceInfo{Path: path, Type: "unknown", Size: -1}
+	info, err := os.Stat(path)
+	if err != nil {
+		return source
+	}
+	switch {
+	case info.Mode().IsRegular():
+		source.Type, source.Size = "file", info.Size()
+	case info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0:
+		source.Type = "block device"
+	case info.Mode()&os.ModeCharDevice != 0:
+		source.Type = "character device"
+	}
+	if source.Type != "block device" {
+		return source
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return source
+	}
+	sys := filepath.Join("/sys/class/block", filepath.Base(resolved))
+	if sectors, err := strconv.ParseInt(readSysfs(filepath.Join(sys, "size")), 10, 64); err == nil {
+		source.Size = sectors * 512
+	}
+	// A partition's device attributes are those of its disk
+	device := filepath.Join(sys, "device")
+	if _, err := os.Stat(filepath.Join(sys, "partition")); err == nil {
+		device = filepath.Join(sys, "..", "device")
+	}
+	source.Vendor = readSysfs(filepath.Join(device, "vendor"))
+	source.Model = readSysfs(filepath.Join(device, "model"))
+	source.Serial = readSysfs(filepath.Join(device, "serial"))
+	return source
+}
+
+// readSysfs returns the trimmed contents of a sysfs attribute, or "" when it is absent
+func readSysfs(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// AcquisitionLog is the record of one hashing run, attached to evidence records
+type AcquisitionLog struct {
+	Case         CaseInfo
+	Source       SourceInfo
+	Started      time.Time
+	Ended        time.Time
+	Results      []*HashResult
+	Verification string
+}
+
+// WriteAcquisitionLog writes the log in the sectioned key-value layout of
+// Guymager's .info files and ewfacquire's log
+func WriteAcquisitionLog(w io.Writer, log AcquisitionLog) error {
+	var b strings.Builder
+	line := func(key, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%-16s: %s\n", key, value)
+		}
+	}
+	section := func(title string) {
+		fmt.Fprintf(&b, "\n%s\n%s\n", title, strings.Repeat("-", len(title)))
+	}
+
+	b.WriteString("hashculate acquisition log\n")
+	b.WriteString("==========================\n")
+	line("Tool", "hashculate")
+	hostname, _ := os.Hostname()
+	line("Host", hostname)
+
+	section("Case management")
+	line("Case number", log.Case.CaseNumber)
+	line("Evidence number", log.Case.EvidenceNumber)
+	line("Examiner", log.Case.Examiner)
+	line("Description", log.Case.Description)
+	line("Notes", log.Case.Notes)
+
+	section("Source")
+	line("Path", log.Source.Path)
+	line("Type", log.Source.Type)
+	if log.Source.Size >= 0 {
+		line("Size", fmt.Sprintf("%d bytes", log.Source.Size))
+	}
+	line("Vendor", log.Source.Vendor)
+	line("Model", log.Source.Model)
+	line("Serial number", log.Source.Serial)
+
+	section("Hash calculation")
+	line("Started", log.Started.UTC().Format(time.RFC3339))
+	line("Ended", log.Ended.UTC().Format(time.RFC3339))
+	line("Duration", log.Ended.Sub(log.Started).Round(time.Millisecond).String())
+	if len(log.Results) > 0 {
+		line("Bytes read", strconv.FormatInt(log.Results[0].FileSize, 10))
+	}
+	for _, result := range log.Results {
+		line(getAlgorithmName(result.Algorithm), result.Hash)
+	}
+
+	section("Verification")
+	if len(log.Results) > 0 {
+		for i, pass := range log.Results[0].Passes {
+			line(fmt.Sprintf("Pass %d", i+1), fmt.Sprintf("%s, started %s, took %s", pass.Hash,
+				pass.Started.UTC().Format(time.RFC3339), pass.Duration().Round(time.Millisecond)))
+		}
+	}
+	verification := log.Verification
+	if verification == "" {
+		verification = "not performed"
+	}
+	line("Result", verification)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcquisitionLog(t *testing.T) {
+	dir := t.TempDir()
+	caseFile := filepath.Join(dir, "case.yaml")
+	os.WriteFile(caseFile, []byte("case:\n  case-number: \"2026-042\"\n  examiner: J. Doe\n  notes: seized at site\n"), 0644)
+	caseInfo, err := LoadCaseInfo(caseFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caseInfo.override(CaseInfo{Examiner: "A. Smith", EvidenceNumber: "E01"})
+	if caseInfo.CaseNumber != "2026-042" || caseInfo.Examiner != "A. Smith" || caseInfo.EvidenceNumber != "E01" || caseInfo.Notes != "seized at site" {
+		t.Fatalf("unexpected case info: %+v", caseInfo)
+	}
+
+	image := filepath.Join(dir, "disk.img")
+	os.WriteFile(image, []byte("evidence"), 0644)
+	result, _ := NewHashCalculator().CalculateFileHash(image, SHA256, nil)
+	started := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+	var out strings.Builder
+	WriteAcquisitionLog(&out, AcquisitionLog{
+		Case:         caseInfo,
+		Source:       DescribeSource(image),
+		Started:      started,
+		Ended:        started.Add(90 * time.Second),
+		Results:      []*HashResult{result},
+		Verification: "matched expected digest " + result.Hash,
+	})
+	for _, want := range []string{
+		"Case number     : 2026-042\n",
+		"Examiner        : A. Smith\n",
+		"Type            : file\n",
+		"Size            : 8 bytes\n",
+		"Started         : 2026-10-17T09:00:00Z\n",
+		"Duration        : 1m30s\n",
+		"SHA-256         : " + result.Hash + "\n",
+		"Result          : matched expected digest",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("log does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
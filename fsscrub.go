@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// scrubCommand builds the zpool, zfs and btrfs invocations; tests replace it
+var scrubCommand = func(name string, args ...string) *exec.Cmd {
+	return exec.Command(name, args...)
+}
+
+// scrubReport is what a checksumming filesystem knows about the data under a
+// directory: its last scrub, the checksum errors counted on its devices and,
+// for ZFS, the files with errors it could not repair
+type scrubReport struct {
+	Filesystem string // "zfs" or "btrfs"
+	Name       string // Pool or mount point
+	Scan       string // Last scrub, as the filesystem describes it
+	Errors     int64
+	Files      map[string]bool // Absolute paths
+}
+
+// readScrub asks the filesystem holding dir for its own view of the data's health
+func readScrub(dir string) (*scrubReport, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = real
+	}
+	mount, err := mountOf(abs)
+	if err != nil {
+		return nil, err
+	}
+	switch mount.FSType {
+	case "zfs":
+		return zfsScrub(mount)
+	case "btrfs":
+		return btrfsScrub(mount)
+	}
+	return nil, fmt.Errorf("%s is on %s, which keeps no checksums of its own; -scrub needs ZFS or Btrfs", dir, mount.FSType)
+}
+
+// runScrubCommand runs a filesystem tool, reporting its own complaint when it fails
+func runScrubCommand(name string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := scrubCommand(name, args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	return out, nil
+}
+
+// zfsDataset finds the dataset holding path with zfs list, for systems
+// without a mount table to read
+func zfsDataset(path string) (mountInfo, error) {
+	out, err := runScrubCommand("zfs", "list", "-H", "-o", "name,mountpoint", path)
+	if err != nil {
+		return mountInfo{}, fmt.Errorf("no ZFS dataset holds %s; -scrub needs ZFS or Btrfs (%v)", path, err)
+	}
+	fields := strings.Split(strings.TrimSpace(string(out)), "\t")
+	if len(fields) != 2 {
+		return mountInfo{}, fmt.Errorf("unexpected zfs list output: %q", out)
+	}
+	return mountInfo{Point: fields[1], FSType: "zfs", Source: fields[0]}, nil
+}
+
+// zfsScrub reads the status of the pool holding mount
+func zfsScrub(mount mountInfo) (*scrubReport, error) {
+	pool, _, _ := strings.Cut(mount.Source, "/")
+	out, err := runScrubCommand("zpool", "status", "-v", pool)
+	if err != nil {
+		return nil, err
+	}
+	report := parseZpoolStatus(out, mount)
+	report.Name = "pool " + pool
+	return report, nil
+}
+
+// parseZpoolStatus reads the scan line, the device checksum counters and the
+// permanent errors of zpool status -v. Files listed as dataset:path are
+// placed under mount when they belong to its dataset; errors in metadata or
+// deleted files, listed as <0x..>, name no file.
+func parseZpoolStatus(out []byte, mount mountInfo) *scrubReport {
+	report := &scrubReport{Filesystem: "zfs", Files: map[string]bool{}}
+	devices, files := false, false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "scan:"):
+			report.Scan = strings.TrimSpace(strings.TrimPrefix(line, "scan:"))
+		case len(fields) == 5 && fields[0] == "NAME" && fields[4] == "CKSUM":
+			devices = true
+		case devices && line == "":
+			devices = false
+		case devices && len(fields) >= 5:
+			// Pools and mirrors repeat the counts of their disks
+			if n := parseZpoolCount(fields[4]); n > report.Errors {
+				report.Errors = n
+			}
+		case strings.HasPrefix(line, "errors: Permanent errors"):
+			files = true
+		case files && line != "":
+			if dataset, path, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, "/") {
+				if dataset != mount.Source || strings.HasPrefix(path, "<") {
+					continue
+				}
+				line = filepath.Join(mount.Point, path)
+			}
+			report.Files[filepath.Clean(line)] = true
+		}
+	}
+	return report
+}
+
+// parseZpoolCount reads an error counter, which zpool abbreviates as 1.05K
+func parseZpoolCount(s string) int64 {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(s, "K"):
+		multiplier = 1e3
+	case strings.HasSuffix(s, "M"):
+		multiplier = 1e6
+	}
+	n, err := strconv.ParseFloat(strings.TrimRight(s, "KM"), 64)
+	if err != nil {
+		return 0
+	}
+	return int64(n * multiplier)
+}
+
+// btrfsScrub reads the scrub status and device error counters of mount.
+// Btrfs names no files; reading a block whose checksum fails returns EIO
+// instead, which classify recognizes.
+func btrfsScrub(mount mountInfo) (*scrubReport, error) {
+	status, err := runScrubCommand("btrfs", "scrub", "status", mount.Point)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := runScrubCommand("btrfs", "device", "stats", mount.Point)
+	if err != nil {
+		return nil, err
+	}
+	report := parseBtrfsScrub(status, stats)
+	report.Name = mount.Point
+	return report, nil
+}
+
+// parseBtrfsScrub reads btrfs scrub status and the corruption_errs counters
+// of btrfs device stats
+func parseBtrfsScrub(status, stats []byte) *scrubReport {
+	report := &scrubReport{Filesystem: "btrfs", Files: map[string]bool{}}
+	var scan []string
+	for _, line := range strings.Split(string(status), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Status:"), strings.HasPrefix(line, "Error summary:"),
+			strings.HasPrefix(line, "scrub started"), strings.HasPrefix(line, "total bytes scrubbed"):
+			scan = append(scan, strings.Join(strings.Fields(line), " "))
+		}
+	}
+	report.Scan = strings.Join(scan, ", ")
+	for _, line := range strings.Split(string(stats), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.HasSuffix(fields[0], ".corruption_errs") {
+			n, _ := strconv.ParseInt(fields[1], 10, 64)
+			report.Errors += n
+		}
+	}
+	return report
+}
+
+// String summarizes the report for the end of a tree
+func (r *scrubReport) String() string {
+	s := fmt.Sprintf("%s %s: %d checksum errors on devices", r.Filesystem, r.Name, r.Errors)
+	if len(r.Files) > 0 {
+		s += fmt.Sprintf(", %d files with permanent errors", len(r.Files))
+	}
+	if r.Scan != "" {
+		s += "; last scrub: " + r.Scan
+	}
+	return s
+}
+
+// classify says why file no longer matches its recorded digest: bitrot the
+// filesystem caught, content that changed while size and modification time
+// stayed the same, or a write by an application. readErr is the error that
+// hashing the file failed with, if any. Without a recorded modification time
+// only bitrot can be told apart.
+func (r *scrubReport) classify(file string, entry ManifestEntry, readErr error) string {
+	if real, err := filepath.EvalSymlinks(file); err == nil {
+		file = real
+	}
+	if errors.Is(readErr, syscall.EIO) || r.Files[file] {
+		return "bitrot detected by " + r.Filesystem
+	}
+	if entry.Modified.IsZero() {
+		return ""
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return ""
+	}
+	if info.Size() == entry.Size && info.ModTime().Equal(entry.Modified) {
+		return "silent change: size and modification time unchanged, not flagged by " + r.Filesystem
+	}
+	return "application change: modified " + info.ModTime().UTC().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,12 @@
+package main
+
+import "fmt"
+
+// mountOf finds the filesystem holding path in the mount table
+func mountOf(path string) (mountInfo, error) {
+	mounts := readMountTable("/proc/self/mountinfo")
+	if mounts == nil {
+		return mountInfo{}, fmt.Errorf("cannot read the mount table")
+	}
+	return (&MountStats{mounts: mounts}).mountFor(path), nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// mountOf asks zfs list for the dataset holding path, as Btrfs only runs on Linux
+func mountOf(path string) (mountInfo, error) {
+	return zfsDataset(path)
+}
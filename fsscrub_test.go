@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseZpoolStatus(t *testing.T) {
+	out := `  pool: tank
+ state: ONLINE
+status: One or more devices has experienced an error resulting in data
+	corruption.  Applications may be affected.
+  scan: scrub repaired 0B in 00:12:01 with 2 errors on Sun Oct 11 00:36:02 2026
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  mirror-0  ONLINE       0     0     0
+	    sda     ONLINE       0     0 1.05K
+	    sdb     ONLINE       0     0    12
+
+errors: Permanent errors have been detected in the following files:
+
+        /tank/photos/2019/beach.jpg
+        tank/archive:/old/report.pdf
+        tank/other:/elsewhere.txt
+        <0x21>:<0x4>
+`
+	report := parseZpoolStatus([]byte(out), mountInfo{Point: "/mnt/archive", FSType: "zfs", Source: "tank/archive"})
+	if report.Errors != 1050 {
+		t.Errorf("Errors = %d, want 1050", report.Errors)
+	}
+	if !strings.HasPrefix(report.Scan, "scrub repaired 0B") {
+		t.Errorf("Scan = %q", report.Scan)
+	}
+	want := []string{filepath.Clean("/tank/photos/2019/beach.jpg"), filepath.Join("/mnt/archive", "old/report.pdf")}
+	if len(report.Files) != len(want) {
+		t.Errorf("Files = %v, want %v", report.Files, want)
+	}
+	for _, file := range want {
+		if !report.Files[file] {
+			t.Errorf("Files = %v, want %s", report.Files, file)
+		}
+	}
+}
+
+func TestParseBtrfsScrub(t *testing.T) {
+	status := `UUID:             3d1f6c4e-8f7a-4c2b-9d0e-5b6a7c8d9e0f
+Scrub started:    Sat Oct 10 02:00:01 2026
+Status:           finished
+Duration:         0:41:13
+Total to scrub:   1.20TiB
+Rate:             508.55MiB/s
+Error summary:    csum=3
+  Corrected:      0
+  Uncorrectable:  3
+  Unverified:     0
+`
+	stats := `[/dev/sdb].write_io_errs    0
+[/dev/sdb].read_io_errs     0
+[/dev/sdb].corruption_errs  3
+[/dev/sdc].corruption_errs  1
+[/dev/sdc].generation_errs  0
+`
+	report := parseBtrfsScrub([]byte(status), []byte(stats))
+	if report.Errors != 4 || report.Scan != "Status: finished, Error summary: csum=3" {
+		t.Errorf("Report = %+v", report)
+	}
+}
+
+func TestTreeScrub(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	os.Mkdir(data, 0755)
+	calc := NewHashCalculator()
+	db, err := OpenHashDB(filepath.Join(dir, "hashes.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"flagged.jpg", "silent.txt", "edited.txt"} {
+		os.WriteFile(filepath.Join(data, name), []byte("original"), 0644)
+		entry, err := HashFileEntry(calc, filepath.Join(data, name), []HashAlgorithm{SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		db.Put(entry)
+	}
+	recorded, _ := db.Get(filepath.Join(data, "silent.txt"))
+	for _, name := range []string{"flagged.jpg", "silent.txt", "edited.txt"} {
+		os.WriteFile(filepath.Join(data, name), []byte("corrupts"), 0644)
+	}
+	os.Chtimes(filepath.Join(data, "silent.txt"), recorded.Modified, recorded.Modified)
+	later := recorded.Modified.Add(time.Hour)
+	os.Chtimes(filepath.Join(data, "edited.txt"), later, later)
+
+	real, _ := filepath.EvalSymlinks(data)
+	scrub := &scrubReport{Filesystem: "zfs", Files: map[string]bool{filepath.Join(real, "flagged.jpg"): true}}
+	root, err := BuildTree(data, dbManifest(db), "", calc, TreeOptions{Scrub: scrub})
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := map[string]string{}
+	for _, row := range root.Rows() {
+		details[row.Path] = row.Detail
+	}
+	if details["flagged.jpg"] != "SHA-256 differs; bitrot detected by zfs" {
+		t.Errorf("flagged.jpg: %q", details["flagged.jpg"])
+	}
+	if !strings.Contains(details["silent.txt"], "silent change") {
+		t.Errorf("silent.txt: %q", details["silent.txt"])
+	}
+	if !strings.Contains(details["edited.txt"], "application change") {
+		t.Errorf("edited.txt: %q", details["edited.txt"])
+	}
+}
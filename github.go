@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// githubAPI is the GitHub REST API base URL; tests replace it
+var githubAPI = "https://api.github.com"
+
+// maxChecksumFileSize bounds how much of a checksum or signature asset is read
+const maxChecksumFileSize = 4 << 20
+
+// checksumAssetName matches release assets that list checksums for other assets
+var checksumAssetName = regexp.MustCompile(`(?i)(sha(1|256|512)?sums?|checksums?|hashes)`)
+
+// signatureExtensions are detached OpenPGP signature suffixes, checked with gpg
+var signatureExtensions = []string{".asc", ".sig", ".gpg"}
+
+type githubAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+type githubRelease struct {
+	TagName string        `json:"tag_name"`
+	Assets  []githubAsset `json:"assets"`
+}
+
+// asset returns the release asset with the given name
+func (r *githubRelease) asset(name string) *githubAsset {
+	for i := range r.Assets {
+		if r.Assets[i].Name == name {
+			return &r.Assets[i]
+		}
+	}
+	return nil
+}
+
+// checksumAssets returns the assets that may hold the checksum of name: a
+// per-asset file such as foo.tar.gz.sha256 first, then shared SHASUMS files
+func (r *githubRelease) checksumAssets(name string) []githubAsset {
+	var perAsset, shared []githubAsset
+	for _, asset := range r.Assets {
+		switch {
+		case asset.Name == name || isSignatureName(asset.Name):
+		case strings.HasPrefix(asset.Name, name+".") && digestSuffix(asset.Name) != "":
+			perAsset = append(perAsset, asset)
+		case checksumAssetName.MatchString(asset.Name):
+			shared = append(shared, asset)
+		}
+	}
+	return append(perAsset, shared...)
+}
+
+// digestSuffix returns the algorithm suffix of a per-asset checksum file name
+func digestSuffix(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	switch ext {
+	case ".md5", ".sha1", ".sha256", ".sha512", ".sha256sum", ".sha512sum":
+		return ext
+	}
+	return ""
+}
+
+func isSignatureName(name string) bool {
+	for _, ext := range signatureExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseReleaseRef splits owner/repo@tag
+func parseReleaseRef(ref string) (owner, repo, tag string, err error) {
+	repoPath, tag, ok := strings.Cut(ref, "@")
+	owner, repo, slash := strings.Cut(repoPath, "/")
+	if !ok || !slash || owner == "" || repo == "" || tag == "" || strings.Contains(repo, "/") {
+		return "", "", "", fmt.Errorf("invalid release %q, expected owner/repo@tag", ref)
+	}
+	return owner, repo, tag, nil
+}
+
+// githubGet requests a GitHub URL, authenticating with $GITHUB_TOKEN when set
+func githubGet(rawURL string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(rawURL, githubAPI) {
+		req.Header.Set("Accept", "application/vnd.github+json")
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := (&http.Client{Transport: fetchTransport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %s", rawURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// githubDownload reads a small asset such as a checksum file or signature
+func githubDownload(asset githubAsset) ([]byte, error) {
+	resp, err := githubGet(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, maxChecksumFileSize))
+}
+
+// FetchGitHubRelease looks up a release by tag
+func FetchGitHubRelease(owner, repo, tag string) (*githubRelease, error) {
+	resp, err := githubGet(fmt.Sprintf("%s/repos/%s/%s/releases/tags/%s", githubAPI, owner, repo, tag))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up release: %w", err)
+	}
+	defer resp.Body.Close()
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("invalid release response: %w", err)
+	}
+	return &release, nil
+}
+
+// lookupChecksum finds the strongest checksum listed for name in the checksum
+// file named file. A per-asset file may hold just the digest without a file name.
+func lookupChecksum(data []byte, file, name string) (HashAlgorithm, string, bool) {
+	implied, _ := checksumFileAlgorithm(file)
+	fields := strings.Fields(string(data))
+	if strings.HasPrefix(file, name+".") && len(fields) == 1 {
+		alg, ok := digestLengths[len(fields[0])]
+		if implied != "" {
+			alg, ok = implied, checkDigestLength(implied, fields[0], false) == nil
+		}
+		if ok {
+			return alg, strings.ToLower(fields[0]), true
+		}
+	}
+	entries, err := parseChecksumLines(data, implied)
+	if err != nil {
+		return "", "", false
+	}
+	for _, entry := range entries {
+		if path.Base(manifestKey(entry.Path)) != name {
+			continue
+		}
+		for _, alg := range algorithmStrength {
+			if digest, ok := entry.Checksums[alg]; ok {
+				return alg, digest, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// verifyDetachedSignature checks a detached OpenPGP signature over data with
+// gpg, using the keys in the local keyring
+func verifyDetachedSignature(data, signature []byte) error {
+	dir, err := os.MkdirTemp("", "hashculate-gh-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	dataPath, sigPath := dir+"/checksums", dir+"/checksums.sig"
+	if err := os.WriteFile(dataPath, data, 0600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(sigPath, signature, 0600); err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	cmd := gpgCommand("--batch", "--verify", sigPath, dataPath)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("bad or unverifiable signature: %s", strings.TrimSpace(stderr.String()))
+		}
+		return fmt.Errorf("failed to run gpg: %w", err)
+	}
+	return nil
+}
+
+// downloadAsset saves a release asset to path
+func downloadAsset(asset githubAsset, path string) error {
+	resp, err := githubGet(asset.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// runGHVerify implements the gh-verify command
+func runGHVerify(args []string) int {
+	fs := flag.NewFlagSet("gh-verify", flag.ExitOnError)
+	assetName := fs.String("asset", "", "Release asset to verify")
+	filePath := fs.String("file", "", "Local copy of the asset [default: the asset name, downloaded if missing]")
+	requireSignature := fs.Bool("require-signature", false, "Fail unless the checksum file has a valid signature")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || *assetName == "" {
+		fmt.Println("Usage: hashculate gh-verify <owner/repo@tag> -asset <name> [-file <path>] [-require-signature]")
+		return 1
+	}
+	owner, repo, tag, err := parseReleaseRef(positional[0])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	release, err := FetchGitHubRelease(owner, repo, tag)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	asset := release.asset(*assetName)
+	if asset == nil {
+		fmt.Printf("Error: release %s has no asset named %s\n", positional[0], *assetName)
+		return 1
+	}
+	fmt.Printf("Release: %s/%s@%s\n", owner, repo, release.TagName)
+
+	// Find the first checksum file that lists the asset
+	var sumsAsset githubAsset
+	var sums []byte
+	var alg HashAlgorithm
+	var expected string
+	for _, candidate := range release.checksumAssets(asset.Name) {
+		data, err := githubDownload(candidate)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if a, digest, ok := lookupChecksum(data, candidate.Name, asset.Name); ok {
+			sumsAsset, sums, alg, expected = candidate, data, a, digest
+			break
+		}
+	}
+	if expected == "" {
+		fmt.Printf("Error: release %s publishes no checksum for %s\n", positional[0], asset.Name)
+		return 1
+	}
+	fmt.Printf("Checksums: %s\n", sumsAsset.Name)
+
+	// Check the checksum file's signature when one is published
+	signed := false
+	for _, ext := range signatureExtensions {
+		sigAsset := release.asset(sumsAsset.Name + ext)
+		if sigAsset == nil {
+			continue
+		}
+		signature, err := githubDownload(*sigAsset)
+		if err == nil {
+			err = verifyDetachedSignature(sums, signature)
+		}
+		if err != nil {
+			fmt.Printf("Signature: %s FAILED\n", sigAsset.Name)
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Signature: %s verified\n", sigAsset.Name)
+		signed = true
+		break
+	}
+	if !signed {
+		if *requireSignature {
+			fmt.Printf("Error: %s is not signed\n", sumsAsset.Name)
+			return 1
+		}
+		fmt.Println("Signature: none published")
+	}
+
+	// Verify the local copy, downloading the asset first if there is none
+	path := *filePath
+	if path == "" {
+		path = asset.Name
+	}
+	downloaded := false
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := downloadAsset(*asset, path); err != nil {
+			fmt.Printf("Error: failed to download %s: %v\n", asset.Name, err)
+			return 1
+		}
+		downloaded = true
+	}
+	result, err := NewHashCalculator().CalculateFileHash(path, alg, nil)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if downloaded {
+		fmt.Printf("Asset: %s (downloaded)\n", path)
+	} else {
+		fmt.Printf("Asset: %s\n", path)
+	}
+	fmt.Printf("%s: %s\n", getAlgorithmName(alg), result.Hash)
+	if result.Hash != expected {
+		fmt.Printf("Expected: %s\n", expected)
+		fmt.Println("Result: FAILED")
+		if downloaded {
+			os.Remove(path)
+		}
+		return 1
+	}
+	fmt.Println("Result: OK")
+	return 0
+}
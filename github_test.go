@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestGHVerify(t *testing.T) {
+	archive := []byte("tool release archive")
+	files := map[string][]byte{
+		"tool.tar.gz":    archive,
+		"SHA256SUMS":     []byte(fmt.Sprintf("%x  other.zip\n%x  tool.tar.gz\n", sha256.Sum256([]byte("other")), sha256.Sum256(archive))),
+		"SHA256SUMS.asc": []byte("-----BEGIN PGP SIGNATURE-----"),
+	}
+	mux := http.NewServeMux()
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+	mux.HandleFunc("/repos/acme/tool/releases/tags/v1.2.3", func(w http.ResponseWriter, r *http.Request) {
+		release := githubRelease{TagName: "v1.2.3"}
+		for name := range files {
+			release.Assets = append(release.Assets, githubAsset{Name: name, URL: server.URL + "/download/" + name})
+		}
+		json.NewEncoder(w).Encode(release)
+	})
+	mux.HandleFunc("/download/{name}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(files[r.PathValue("name")])
+	})
+	githubAPI, fetchTransport = server.URL, server.Client().Transport
+	defer func() { githubAPI, fetchTransport = "https://api.github.com", http.DefaultTransport }()
+	signatureValid := true
+	defaultGPG := gpgCommand
+	defer func() { gpgCommand = defaultGPG }()
+	gpgCommand = func(args ...string) *exec.Cmd {
+		if signatureValid {
+			return exec.Command("true")
+		}
+		return exec.Command("false")
+	}
+
+	dir := t.TempDir()
+	downloaded := filepath.Join(dir, "tool.tar.gz")
+	if code := runGHVerify([]string{"acme/tool@v1.2.3", "-asset", "tool.tar.gz", "-file", downloaded}); code != 0 {
+		t.Fatalf("expected the downloaded asset to verify, got exit code %d", code)
+	}
+	if data, _ := os.ReadFile(downloaded); string(data) != string(archive) {
+		t.Error("asset was not downloaded")
+	}
+
+	tampered := filepath.Join(dir, "tampered.tar.gz")
+	os.WriteFile(tampered, []byte("tampered"), 0644)
+	if code := runGHVerify([]string{"acme/tool@v1.2.3", "-asset", "tool.tar.gz", "-file", tampered}); code != 1 {
+		t.Error("expected a tampered local copy to fail")
+	}
+
+	signatureValid = false
+	if code := runGHVerify([]string{"acme/tool@v1.2.3", "-asset", "tool.tar.gz", "-file", downloaded}); code != 1 {
+		t.Error("expected a bad signature to fail")
+	}
+}
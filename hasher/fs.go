@@ -0,0 +1,157 @@
+package hasher
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// ReadDirBatch is how many directory entries are requested per read, so large
+// directories on network filesystems are listed in few round trips
+const ReadDirBatch = 1024
+
+// OS is the host filesystem as an fs.FS. Unlike os.DirFS it takes host paths
+// as they are, absolute or relative, so command-line arguments can be used
+// directly.
+var OS fs.FS = osFS{}
+
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error)          { return os.Open(name) }
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// Join joins path elements the way fsys names files: with the host separator
+// for OS and with forward slashes for every other fs.FS
+func Join(fsys fs.FS, elem ...string) string {
+	if _, ok := fsys.(osFS); ok {
+		return filepath.Join(elem...)
+	}
+	return path.Join(elem...)
+}
+
+// lstat describes name without following a final symlink when fsys can
+func lstat(fsys fs.FS, name string) (fs.FileInfo, error) {
+	if l, ok := fsys.(interface {
+		Lstat(name string) (fs.FileInfo, error)
+	}); ok {
+		return l.Lstat(name)
+	}
+	return fs.Stat(fsys, name)
+}
+
+// ListFiles returns the regular files below root in lexical order. When root
+// is itself a file it is returned on its own. Entry types come from the
+// directory listing, so files are never stat'ed individually.
+func ListFiles(fsys fs.FS, root string) ([]string, error) {
+	info, err := lstat(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			return []string{root}, nil
+		}
+		return nil, nil
+	}
+	var files []string
+	err = WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return err
+	})
+	return files, err
+}
+
+// WalkDir walks the tree at root like fs.WalkDir, calling fn for root and
+// every entry below it in lexical order, but names entries with Join so it
+// takes host paths with OS, and lists directories in ReadDirBatch batches.
+// As with fs.WalkDir, a directory that cannot be fully listed is passed to
+// fn a second time with the error, and its entries read so far are still
+// walked when fn returns nil.
+func WalkDir(fsys fs.FS, root string, fn fs.WalkDirFunc) error {
+	info, err := fs.Stat(fsys, root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walkDir(fsys, root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir calls fn for dir and, when it is a directory, the entries below it
+func walkDir(fsys fs.FS, dir string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(dir, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := readDir(fsys, dir)
+	if err != nil {
+		if err = fn(dir, d, err); err != nil {
+			if err == fs.SkipDir {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := walkDir(fsys, Join(fsys, dir, entry.Name()), entry, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir lists dir in lexical order, returning the entries read before any error
+func readDir(fsys fs.FS, dir string) ([]fs.DirEntry, error) {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	reader, ok := d.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: dir, Err: fs.ErrInvalid}
+	}
+	var entries []fs.DirEntry
+	for {
+		batch, err := reader.ReadDir(ReadDirBatch)
+		entries = append(entries, batch...)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+			return entries, err
+		}
+	}
+}
+
+// HashFile opens name in fsys and hashes it like HashReader, reporting
+// progress against the size the file has when opened
+func HashFile(fsys fs.FS, name string, algorithms []Algorithm, chunkSize int, progress func(float64)) ([]Digest, int64, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	size := int64(-1)
+	if info, err := file.Stat(); err == nil {
+		size = info.Size()
+	}
+	return HashReader(file, algorithms, chunkSize, size, progress)
+}
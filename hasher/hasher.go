@@ -0,0 +1,259 @@
+// Package hasher is the hashing core shared by the hashculate CLI and its
+// WebAssembly, C and mobile bindings: algorithm selection, chunked
+// multi-algorithm streaming with progress, and digest formatting.
+package hasher
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Algorithm represents the supported hash algorithms
+type Algorithm string
+
+const (
+	MD5    Algorithm = "md5"
+	SHA1   Algorithm = "sha1"
+	SHA256 Algorithm = "sha256"
+	SHA512 Algorithm = "sha512"
+	CIDV1  Algorithm = "cidv1" // IPFS CIDv1 as assigned by `ipfs add --cid-version 1`
+)
+
+// DefaultChunkSize is the read size used when none is given, 4MB like the HTML version
+const DefaultChunkSize = 4 * 1024 * 1024
+
+// New creates the hash.Hash for an algorithm
+func New(algorithm Algorithm) (hash.Hash, error) {
+	switch algorithm {
+	case MD5:
+		return md5.New(), nil
+	case SHA1:
+		return sha1.New(), nil
+	case SHA256:
+		return sha256.New(), nil
+	case CIDV1:
+		return NewUnixFS(DefaultIPFSChunkSize, 1), nil
+	case SHA512:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
+}
+
+// Parse parses an algorithm name such as sha256 or SHA-256
+func Parse(alg string) (Algorithm, error) {
+	switch strings.ToLower(alg) {
+	case "md5":
+		return MD5, nil
+	case "sha1", "sha-1":
+		return SHA1, nil
+	case "sha256", "sha-256":
+		return SHA256, nil
+	case "sha512", "sha-512":
+		return SHA512, nil
+	case "cidv1":
+		return CIDV1, nil
+	default:
+		return "", fmt.Errorf("unsupported algorithm: %s. Supported: md5, sha1, sha256, sha512, cidv1", alg)
+	}
+}
+
+// Name returns the display name of an algorithm
+func Name(algorithm Algorithm) string {
+	switch algorithm {
+	case MD5:
+		return "MD5"
+	case SHA1:
+		return "SHA-1"
+	case SHA256:
+		return "SHA-256"
+	case SHA512:
+		return "SHA-512"
+	case CIDV1:
+		return "CIDv1"
+	default:
+		return "Unknown"
+	}
+}
+
+// Format renders a finished digest as hex, or a CID in its string form
+func Format(algorithm Algorithm, digest []byte) string {
+	if algorithm == CIDV1 {
+		return FormatCID(digest)
+	}
+	return fmt.Sprintf("%x", digest)
+}
+
+// Digest is the finished hash of a stream for one algorithm
+type Digest struct {
+	Algorithm Algorithm
+	Hash      string
+}
+
+// Stream hashes data with several algorithms in a single pass and reports
+// progress against an expected size
+type Stream struct {
+	algorithms []Algorithm
+	hashers    []hash.Hash
+	writer     io.Writer
+	written    int64
+	progress   *progressReporter
+}
+
+// progressSteps is how finely progress is reported. Reporting every chunk
+// would call back millions of times for a terabyte file.
+const progressSteps = 1000
+
+// progressPending is the most progress reported before completion is
+// signaled, since input may continue past the expected size
+const progressPending = float64(progressSteps-1) / progressSteps
+
+// progressReporter throttles progress callbacks and keeps them within [0, 1],
+// reaching 1 only when completion is signaled
+type progressReporter struct {
+	size     int64
+	callback func(float64)
+	reported int64 // last progress reported, in steps of progressSteps
+	done     bool
+}
+
+// newProgressReporter returns nil when there is no callback
+func newProgressReporter(size int64, callback func(float64)) *progressReporter {
+	if callback == nil {
+		return nil
+	}
+	return &progressReporter{size: size, callback: callback, reported: -1}
+}
+
+// advance reports the bytes processed so far when they moved the progress on.
+// The size is only an expectation: a file that grows while it is read must
+// not pass 100%, and one that shrank ends through done instead.
+func (p *progressReporter) advance(n int64) {
+	if p == nil || p.done || p.size <= 0 {
+		return
+	}
+	// Computed in floating point: n*progressSteps overflows int64 past 9 PB
+	fraction := min(float64(n)/float64(p.size), progressPending)
+	if step := int64(fraction * progressSteps); step != p.reported {
+		p.reported = step
+		p.callback(fraction)
+	}
+}
+
+// finish reports completion, once
+func (p *progressReporter) finish() {
+	if p == nil || p.done {
+		return
+	}
+	p.done = true
+	p.callback(1)
+}
+
+// NewStream creates a stream for algorithms. size is only used for progress
+// reporting and may be -1 when unknown; progress may be nil. Progress stays
+// below 1 until Done is called.
+func NewStream(algorithms []Algorithm, size int64, progress func(float64)) (*Stream, error) {
+	s := &Stream{algorithms: algorithms, progress: newProgressReporter(size, progress)}
+	writers := make([]io.Writer, len(algorithms))
+	for _, algorithm := range algorithms {
+		h, err := New(algorithm)
+		if err != nil {
+			return nil, err
+		}
+		s.hashers = append(s.hashers, h)
+		writers[len(s.hashers)-1] = h
+	}
+	s.writer = io.MultiWriter(writers...)
+	return s, nil
+}
+
+// Write hashes the next chunk of the stream
+func (s *Stream) Write(p []byte) (int, error) {
+	s.writer.Write(p)
+	s.written += int64(len(p))
+	s.progress.advance(s.written)
+	return len(p), nil
+}
+
+// Done signals that the stream is complete, reporting 100% progress
+func (s *Stream) Done() {
+	s.progress.finish()
+}
+
+// Written returns the number of bytes hashed so far
+func (s *Stream) Written() int64 {
+	return s.written
+}
+
+// Digests returns one digest per algorithm, in the order given
+func (s *Stream) Digests() []Digest {
+	digests := make([]Digest, len(s.algorithms))
+	for i, algorithm := range s.algorithms {
+		digests[i] = Digest{Algorithm: algorithm, Hash: Format(algorithm, s.hashers[i].Sum(nil))}
+	}
+	return digests
+}
+
+// CountingReader counts the bytes read through it and reports progress
+// against an expected size. Like a Stream, it stays below 100% until Done.
+type CountingReader struct {
+	r        io.Reader
+	n        int64
+	progress *progressReporter
+}
+
+// NewCountingReader wraps r. size may be -1 when unknown; progress may be nil.
+func NewCountingReader(r io.Reader, size int64, progress func(float64)) *CountingReader {
+	return &CountingReader{r: r, progress: newProgressReporter(size, progress)}
+}
+
+// Read reads from the underlying reader and reports the progress
+func (c *CountingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.progress.advance(c.n)
+	return n, err
+}
+
+// Count returns the number of bytes read so far
+func (c *CountingReader) Count() int64 {
+	return c.n
+}
+
+// Done signals that the input is complete, reporting 100% progress
+func (c *CountingReader) Done() {
+	c.progress.finish()
+}
+
+// HashReader streams r through the algorithms in chunks of chunkSize bytes
+// (DefaultChunkSize when 0) and returns the digests and the bytes read.
+// Progress is reported as r is read and reaches 1 at the end of the input.
+func HashReader(r io.Reader, algorithms []Algorithm, chunkSize int, size int64, progress func(float64)) ([]Digest, int64, error) {
+	stream, err := NewStream(algorithms, -1, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	counter := NewCountingReader(r, size, progress)
+	buffer := make([]byte, chunkSize)
+	for {
+		n, err := counter.Read(buffer)
+		if err != nil && err != io.EOF {
+			return nil, stream.Written(), fmt.Errorf("failed to read file: %w", err)
+		}
+		if n == 0 {
+			break
+		}
+		stream.Write(buffer[:n])
+	}
+	counter.Done()
+	return stream.Digests(), stream.Written(), nil
+}
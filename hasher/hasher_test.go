@@ -0,0 +1,190 @@
+package hasher
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+)
+
+func TestHashReader(t *testing.T) {
+	var progress []float64
+	digests, n, err := HashReader(strings.NewReader("hello world"), []Algorithm{MD5, SHA256, CIDV1}, 4, 11, func(p float64) {
+		progress = append(progress, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"5eb63bbbe01eeed093cb22bb8f5acdc3",
+		"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		"bafkreifzjut3te2nhyekklss27nh3k72ysco7y32koao5eei66wof36n5e",
+	}
+	for i, digest := range digests {
+		if digest.Hash != want[i] {
+			t.Errorf("%s = %s, want %s", digest.Algorithm, digest.Hash, want[i])
+		}
+	}
+	// The last read reaches the size, but only the end of the input completes
+	if n != 11 || len(progress) != 4 || progress[2] != progressPending || progress[3] != 1 {
+		t.Errorf("Unexpected size %d or progress %v", n, progress)
+	}
+
+	// A file that shrank after its size was taken still completes
+	progress = nil
+	HashReader(strings.NewReader("hello world"), []Algorithm{MD5}, 4, 100, func(p float64) { progress = append(progress, p) })
+	if progress[len(progress)-1] != 1 {
+		t.Errorf("Progress of a shrunken input did not complete: %v", progress)
+	}
+
+	if _, err := Parse("crc32"); err == nil {
+		t.Error("Expected unsupported algorithm to be rejected")
+	}
+	if alg, _ := Parse("SHA-512"); Name(alg) != "SHA-512" {
+		t.Errorf("Unexpected algorithm %s", alg)
+	}
+}
+
+func TestStreamProgressLargeSize(t *testing.T) {
+	const size = 5 << 40
+	var calls int
+	var last float64
+	stream, _ := NewStream([]Algorithm{MD5}, size, func(p float64) {
+		calls++
+		last = p
+	})
+	// Pretend the first 5 TB minus 8 MB have been hashed, then grow past the size
+	stream.written = size - 8<<20
+	chunk := make([]byte, 1<<20)
+	for i := 0; i < 16; i++ {
+		stream.Write(chunk)
+	}
+	if calls != 1 || last != progressPending {
+		t.Errorf("expected a single report of 99.9%% while the stream grows, got %d ending at %v", calls, last)
+	}
+	stream.Done()
+	stream.Done()
+	if calls != 2 || last != 1 {
+		t.Errorf("expected reports of 99.9%% and completion, got %d ending at %v", calls, last)
+	}
+}
+
+func TestHashFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/index.html":     {Data: []byte("hello world")},
+		"site/css/style.css":  {Data: []byte("body{}")},
+		"site/.well-known/ok": {Data: []byte("ok")},
+		"other.txt":           {Data: []byte("other")},
+	}
+	files, err := ListFiles(fsys, "site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(files, " ") != "site/.well-known/ok site/css/style.css site/index.html" {
+		t.Errorf("unexpected files: %v", files)
+	}
+	digests, n, err := HashFile(fsys, "site/index.html", []Algorithm{SHA256}, 0, nil)
+	if err != nil || n != 11 || digests[0].Hash != "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" {
+		t.Errorf("unexpected digest %v of %d bytes: %v", digests, n, err)
+	}
+	if _, _, err := HashFile(fsys, "site/missing", []Algorithm{SHA256}, 0, nil); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestWalkDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"site/index.html":     {Data: []byte("hello world")},
+		"site/css/style.css":  {Data: []byte("body{}")},
+		"site/.well-known/ok": {Data: []byte("ok")},
+	}
+	var visited []string
+	err := WalkDir(fsys, "site", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		visited = append(visited, path)
+		if path == "site/.well-known" {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil || strings.Join(visited, " ") != "site site/.well-known site/css site/css/style.css site/index.html" {
+		t.Errorf("unexpected walk %v: %v", visited, err)
+	}
+
+	var failed string
+	err = WalkDir(fsys, "missing", func(path string, d fs.DirEntry, err error) error {
+		failed = path
+		return err
+	})
+	if !errors.Is(err, fs.ErrNotExist) || failed != "missing" {
+		t.Errorf("expected the missing root to be reported, got %q: %v", failed, err)
+	}
+}
+
+// FuzzChunkSizeInvariance checks that digests do not depend on how the input
+// is split: the chunk size, short reads, or the boundaries of Stream writes
+func FuzzChunkSizeInvariance(f *testing.F) {
+	for _, size := range []int{0, 1, 63, 64, 65, 4095, 4096, 4097} {
+		f.Add(bytes.Repeat([]byte{0xa5}, size), uint16(64), uint16(7))
+	}
+	// Larger than one default chunk and than an IPFS leaf, ending mid-chunk
+	large := make([]byte, DefaultChunkSize+DefaultIPFSChunkSize+3)
+	rand.New(rand.NewSource(1)).Read(large)
+	f.Add(large, uint16(0), uint16(65535))
+
+	algorithms := []Algorithm{MD5, SHA1, SHA256, SHA512, CIDV1}
+	f.Fuzz(func(t *testing.T, data []byte, chunk, split uint16) {
+		want := make([]string, len(algorithms))
+		for i, algorithm := range algorithms {
+			h, _ := New(algorithm)
+			h.Write(data)
+			want[i] = Format(algorithm, h.Sum(nil))
+		}
+		check := func(how string, digests []Digest, n int64) {
+			t.Helper()
+			if n != int64(len(data)) {
+				t.Errorf("%s: read %d of %d bytes", how, n, len(data))
+			}
+			for i, digest := range digests {
+				if digest.Hash != want[i] {
+					t.Errorf("%s: %s = %s, want %s", how, digest.Algorithm, digest.Hash, want[i])
+				}
+			}
+		}
+
+		for _, size := range []int{int(chunk), 1, len(data) + 1, DefaultChunkSize} {
+			if size == 1 && len(data) > 1<<16 {
+				continue
+			}
+			digests, n, err := HashReader(bytes.NewReader(data), algorithms, size, int64(len(data)), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			check("chunk size "+strconv.Itoa(size), digests, n)
+		}
+		short := iotest.HalfReader(bytes.NewReader(data))
+		if len(data) <= 1<<16 {
+			short = iotest.OneByteReader(bytes.NewReader(data))
+		}
+		digests, n, err := HashReader(short, algorithms, int(chunk), -1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		check("short reads", digests, n)
+
+		stream, _ := NewStream(algorithms, int64(len(data)), nil)
+		for rest := data; len(rest) > 0; {
+			piece := min(int(split)+1, len(rest))
+			stream.Write(rest[:piece])
+			rest = rest[piece:]
+		}
+		check("stream writes", stream.Digests(), stream.Written())
+	})
+}
@@ -0,0 +1,214 @@
+// Package hashertest provides fixtures for testing code built on the hasher
+// package: file trees, golden checksum manifests and corrupted copies.
+package hashertest
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"hashculate/hasher"
+)
+
+// UpdateEnv names the environment variable that makes CheckGolden rewrite
+// golden manifests instead of comparing against them
+const UpdateEnv = "HASHERTEST_UPDATE"
+
+// Tree writes files, keyed by slash-separated path, below a new temporary
+// directory and returns it. The directory is removed when the test ends.
+func Tree(t testing.TB, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// MapFS returns the same files as an in-memory filesystem
+func MapFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, content := range files {
+		fsys[name] = &fstest.MapFile{Data: []byte(content), Mode: 0644}
+	}
+	return fsys
+}
+
+// RandomFile writes size bytes generated from seed to path, so large
+// fixtures are reproducible without being checked in
+func RandomFile(t testing.TB, path string, size int64, seed int64) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Manifest hashes every file below root in fsys and returns a manifest in
+// sha256sum format (`digest  path`, paths relative to root), in lexical order
+func Manifest(fsys fs.FS, root string, algorithm hasher.Algorithm) ([]byte, error) {
+	files, err := hasher.ListFiles(fsys, root)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	for _, name := range files {
+		digests, _, err := hasher.HashFile(fsys, name, []hasher.Algorithm{algorithm}, 0, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			rel = filepath.Base(name)
+		}
+		fmt.Fprintf(&out, "%s  %s\n", digests[0].Hash, filepath.ToSlash(rel))
+	}
+	return out.Bytes(), nil
+}
+
+// CheckGolden compares the manifest of root on disk with the golden file and
+// reports every line that differs. With HASHERTEST_UPDATE=1 the golden file
+// is written instead.
+func CheckGolden(t testing.TB, root, golden string, algorithm hasher.Algorithm) {
+	t.Helper()
+	got, err := Manifest(hasher.OS, root, algorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if os.Getenv(UpdateEnv) == "1" {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with %s=1 to create it)", err, UpdateEnv)
+	}
+	if bytes.Equal(got, want) {
+		return
+	}
+	wanted := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(want)), "\n") {
+		wanted[line] = true
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(got)), "\n") {
+		if wanted[line] {
+			delete(wanted, line)
+		} else {
+			t.Errorf("%s: unexpected %s", golden, line)
+		}
+	}
+	for line := range wanted {
+		t.Errorf("%s: missing %s", golden, line)
+	}
+}
+
+// FlipBit inverts one bit of the file at path, the smallest corruption a
+// digest has to catch
+func FlipBit(t testing.TB, path string, offset int64, bit uint) {
+	t.Helper()
+	modify(t, path, func(data []byte) []byte {
+		if offset >= int64(len(data)) {
+			t.Fatalf("%s: offset %d is past the end (%d bytes)", path, offset, len(data))
+		}
+		data[offset] ^= 1 << (bit % 8)
+		return data
+	})
+}
+
+// ZeroRange overwrites length bytes at offset with zeros, like a bad sector
+// read back as zeros
+func ZeroRange(t testing.TB, path string, offset, length int64) {
+	t.Helper()
+	modify(t, path, func(data []byte) []byte {
+		end := min(offset+length, int64(len(data)))
+		for i := offset; i < end; i++ {
+			data[i] = 0
+		}
+		return data
+	})
+}
+
+// Truncate cuts the file at path to size bytes, like an interrupted copy
+func Truncate(t testing.TB, path string, size int64) {
+	t.Helper()
+	modify(t, path, func(data []byte) []byte { return data[:min(size, int64(len(data)))] })
+}
+
+// Append adds data to the end of the file at path
+func Append(t testing.TB, path string, data []byte) {
+	t.Helper()
+	modify(t, path, func(existing []byte) []byte { return append(existing, data...) })
+}
+
+// modify rewrites a file, keeping its modification time so tools that trust
+// size and time do not notice unless the size changes
+func modify(t testing.TB, path string, change func([]byte) []byte) {
+	t.Helper()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, change(data), info.Mode()); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Clock is a hasher.Clock that only moves when told to
+type Clock struct {
+	now time.Time
+}
+
+// NewClock returns a clock stopped at start
+func NewClock(start time.Time) *Clock {
+	return &Clock{now: start}
+}
+
+// Now returns the clock's current time
+func (c *Clock) Now() time.Time {
+	return c.now
+}
+
+// Advance moves the clock forward by d
+func (c *Clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// ProgressRecorder captures the progress a hasher reports, for assertions
+// instead of output on a terminal
+type ProgressRecorder struct {
+	Fractions []float64
+	Updates   []hasher.Progress
+}
+
+// Fraction records a HashReader or Stream progress callback
+func (r *ProgressRecorder) Fraction(fraction float64) {
+	r.Fractions = append(r.Fractions, fraction)
+}
+
+// Progress records a hasher.Meter update
+func (r *ProgressRecorder) Progress(p hasher.Progress) {
+	r.Updates = append(r.Updates, p)
+}
@@ -0,0 +1,89 @@
+package hashertest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"hashculate/hasher"
+)
+
+func TestFixtures(t *testing.T) {
+	files := map[string]string{"a.txt": "hello world", "sub/b.bin": "payload"}
+	root := Tree(t, files)
+	onDisk, err := Manifest(hasher.OS, root, hasher.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inMemory, err := Manifest(MapFS(files), ".", hasher.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9  a.txt\n" +
+		"239f59ed55e737c77147cf55ad0c1b030b6d7ee748a7426952f9b852d5a935e5  sub/b.bin\n"
+	if string(onDisk) != want || string(inMemory) != want {
+		t.Errorf("unexpected manifests:\n%s\n%s", onDisk, inMemory)
+	}
+
+	golden := filepath.Join(t.TempDir(), "tree.sha256")
+	os.WriteFile(golden, onDisk, 0644)
+	CheckGolden(t, root, golden, hasher.SHA256)
+
+	// Every corruption changes the manifest but keeps the modification time
+	path := filepath.Join(root, "a.txt")
+	before, _ := os.Stat(path)
+	for _, corrupt := range []func(){
+		func() { FlipBit(t, path, 0, 0) },
+		func() { ZeroRange(t, path, 2, 3) },
+		func() { Truncate(t, path, 5) },
+		func() { Append(t, path, []byte("!")) },
+	} {
+		corrupt()
+		if got, _ := Manifest(hasher.OS, root, hasher.SHA256); string(got) == string(onDisk) {
+			t.Error("corruption did not change the manifest")
+		}
+		onDisk, _ = Manifest(hasher.OS, root, hasher.SHA256)
+	}
+	if after, _ := os.Stat(path); !after.ModTime().Equal(before.ModTime()) {
+		t.Error("modification time changed")
+	}
+
+	RandomFile(t, filepath.Join(root, "r1"), 1000, 7)
+	RandomFile(t, filepath.Join(root, "r2"), 1000, 7)
+	one, _ := os.ReadFile(filepath.Join(root, "r1"))
+	two, _ := os.ReadFile(filepath.Join(root, "r2"))
+	if string(one) != string(two) {
+		t.Error("the same seed should give the same contents")
+	}
+}
+
+func TestMeter(t *testing.T) {
+	clock := NewClock(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	var recorder ProgressRecorder
+	meter := &hasher.Meter{Clock: clock, Interval: time.Second, Total: 1000, Sink: recorder.Progress}
+
+	// Reading 100 bytes every 500ms reports at most once a second
+	for done := 100; done <= 1000; done += 100 {
+		clock.Advance(500 * time.Millisecond)
+		meter.Update(float64(done) / 1000)
+	}
+	if len(recorder.Updates) != 6 {
+		t.Fatalf("expected the first, four throttled and the final update, got %+v", recorder.Updates)
+	}
+	half := recorder.Updates[2]
+	if half.Done != 500 || half.Elapsed != 2*time.Second || half.Rate != 250 || half.ETA != 2*time.Second {
+		t.Errorf("unexpected update at 50%%: %+v", half)
+	}
+	if last := recorder.Updates[5]; last.Fraction != 1 || last.ETA != 0 {
+		t.Errorf("unexpected final update: %+v", last)
+	}
+
+	// HashReader's own callbacks are throttled by progress, not time
+	recorder = ProgressRecorder{}
+	hasher.HashReader(strings.NewReader("hello world"), []hasher.Algorithm{hasher.SHA256}, 4, 11, recorder.Fraction)
+	if len(recorder.Fractions) != 4 || recorder.Fractions[3] != 1 {
+		t.Errorf("unexpected fractions: %v", recorder.Fractions)
+	}
+}
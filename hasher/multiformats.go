@@ -0,0 +1,65 @@
+package hasher
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Multihash codes of the hex algorithms, from the multicodec table
+var multihashCodes = map[Algorithm]uint64{
+	MD5:    0xd5,
+	SHA1:   0x11,
+	SHA256: MultihashSHA2_256,
+	SHA512: 0x13,
+}
+
+// multibase is one of the multibase encodings: its prefix character and encoder
+type multibase struct {
+	prefix byte
+	encode func([]byte) string
+}
+
+// multibases are the multibase encodings digests can be written in, by name
+var multibases = map[string]multibase{
+	"base16":       {'f', hex.EncodeToString},
+	"base16upper":  {'F', func(b []byte) string { return strings.ToUpper(hex.EncodeToString(b)) }},
+	"base32":       {'b', cidBase32.EncodeToString},
+	"base32upper":  {'B', base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString},
+	"base58btc":    {'z', base58Encode},
+	"base64":       {'m', base64.RawStdEncoding.EncodeToString},
+	"base64pad":    {'M', base64.StdEncoding.EncodeToString},
+	"base64url":    {'u', base64.RawURLEncoding.EncodeToString},
+	"base64urlpad": {'U', base64.URLEncoding.EncodeToString},
+}
+
+// MultibaseNames lists the multibase encodings Multibase accepts
+func MultibaseNames() []string {
+	return []string{"base16", "base16upper", "base32", "base32upper", "base58btc", "base64", "base64pad", "base64url", "base64urlpad"}
+}
+
+// Multibase encodes data in the named multibase, prefix character included
+func Multibase(name string, data []byte) (string, error) {
+	base, ok := multibases[name]
+	if !ok {
+		return "", fmt.Errorf("unknown multibase %q: expected %s", name, strings.Join(MultibaseNames(), ", "))
+	}
+	return string(base.prefix) + base.encode(data), nil
+}
+
+// FormatMultihash writes a hex digest as a multihash (the algorithm's
+// multicodec code and the digest length as varints, then the digest) in the
+// named multibase
+func FormatMultihash(algorithm Algorithm, digest, base string) (string, error) {
+	code, ok := multihashCodes[algorithm]
+	if !ok {
+		return "", fmt.Errorf("%s has no multihash code", Name(algorithm))
+	}
+	raw, err := hex.DecodeString(digest)
+	if err != nil {
+		return "", err
+	}
+	return Multibase(base, Multihash(code, raw))
+}
@@ -0,0 +1,29 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestFormatMultihash(t *testing.T) {
+	// The example of the multihash specification: SHA-256 of "multihash"
+	sum := sha256.Sum256([]byte("multihash"))
+	digest := hex.EncodeToString(sum[:])
+	for base, want := range map[string]string{
+		"base16":    "f12209cbc07c3f991725836a3aa2a581ca2029198aa420b9d99bc0e131d9f3e2cbe47",
+		"base58btc": "zQmYtUc4iTCbbfVSDNKvtQqrfyezPPnFvE33wFmutw9PBBk",
+		"base64url": "uEiCcvAfD-ZFyWDajqipYHKICkZiqQgudmbwOEx2fPiy-Rw",
+	} {
+		got, err := FormatMultihash(SHA256, digest, base)
+		if err != nil || got != want {
+			t.Errorf("%s: got %q, %v, want %q", base, got, err, want)
+		}
+	}
+	if got, _ := FormatMultihash(MD5, "d41d8cd98f00b204e9800998ecf8427e", "base16"); got != "fd50110d41d8cd98f00b204e9800998ecf8427e" {
+		t.Errorf("MD5 multihash = %s, want the two-byte varint code d501", got)
+	}
+	if _, err := FormatMultihash(SHA256, digest, "base2"); err == nil {
+		t.Error("Unknown multibase should fail")
+	}
+}
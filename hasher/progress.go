@@ -0,0 +1,73 @@
+package hasher
+
+import "time"
+
+// Clock tells the time. Tests substitute a fake so timing-dependent output
+// is deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the wall clock
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Progress is a progress update with the timing derived from it
+type Progress struct {
+	Fraction float64
+	Done     int64 // bytes, when Total is known
+	Total    int64 // -1 when unknown
+	Elapsed  time.Duration
+	Rate     float64       // bytes per second, when Total is known
+	ETA      time.Duration // -1 until it can be estimated
+}
+
+// Meter turns the fraction callbacks of HashReader and Stream into Progress
+// updates with throughput and an ETA. Updates closer together than Interval
+// are dropped, except the first and the final one. A fraction lower than the
+// last starts a new measurement, as when a file is read a second time.
+type Meter struct {
+	Clock    Clock         // SystemClock when nil
+	Interval time.Duration // minimum time between updates
+	Total    int64         // bytes, or -1 when unknown
+	Sink     func(Progress)
+
+	start    time.Time
+	last     time.Time
+	fraction float64
+	running  bool
+}
+
+// Update records progress and passes it on to the sink unless throttled
+func (m *Meter) Update(fraction float64) {
+	clock := m.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	now := clock.Now()
+	if !m.running || fraction < m.fraction {
+		m.start, m.running = now, true
+	} else if fraction < 1 && now.Sub(m.last) < m.Interval {
+		m.fraction = fraction
+		return
+	}
+	m.last, m.fraction = now, fraction
+
+	p := Progress{Fraction: fraction, Total: m.Total, Elapsed: now.Sub(m.start), ETA: -1}
+	if fraction > 0 && p.Elapsed > 0 {
+		p.ETA = time.Duration(float64(p.Elapsed) * (1 - fraction) / fraction)
+	}
+	if m.Total >= 0 {
+		p.Done = int64(fraction * float64(m.Total))
+		if p.Elapsed > 0 {
+			p.Rate = float64(p.Done) / p.Elapsed.Seconds()
+		}
+	}
+	m.Sink(p)
+	if fraction >= 1 {
+		m.running = false
+	}
+}
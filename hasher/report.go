@@ -0,0 +1,40 @@
+package hasher
+
+import "fmt"
+
+// Report is the JSON form of a digest, shared by the CLI's -output json and the bindings
+type Report struct {
+	File      string    `json:"file"`
+	Size      int64     `json:"size"`
+	Algorithm Algorithm `json:"algorithm"`
+	Hash      string    `json:"hash"`
+}
+
+// FormatBytes formats bytes in a human-readable format (similar to HTML version)
+func FormatBytes(bytes int64) string {
+	if bytes == 0 {
+		return "0 bytes"
+	}
+
+	// For small files, show bytes; for larger files, show KB
+	if bytes < 1024 {
+		return fmt.Sprintf("%d bytes", bytes)
+	}
+
+	// Convert to KB for consistency with HTML version, switching to GB and TB
+	// where a count of kilobytes would no longer be readable
+	switch {
+	case bytes >= 1<<40:
+		return fmt.Sprintf("%.1f TB (terabytes)", float64(bytes)/(1<<40))
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB (gigabytes)", float64(bytes)/(1<<30))
+	}
+	kb := float64(bytes) / 1024
+	return fmt.Sprintf("%.1f kb (kilobytes)", kb)
+}
+
+// Describe returns the one-sentence result description of the HTML version
+func Describe(filename string, size int64, algorithm Algorithm, hash string) string {
+	return fmt.Sprintf("\"%s\", with size of %s, and file hash using the hashing algorithm %s has the value : %s.",
+		filename, FormatBytes(size), Name(algorithm), hash)
+}
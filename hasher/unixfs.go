@@ -0,0 +1,190 @@
+package hasher
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"hash"
+	"math/big"
+)
+
+// Multicodec codes used in IPFS content identifiers
+const (
+	multicodecRaw     = 0x55
+	multicodecDagPB   = 0x70
+	MultihashSHA2_256 = 0x12
+)
+
+// UnixFS importer defaults matching `ipfs add`
+const (
+	DefaultIPFSChunkSize = 256 * 1024
+	unixfsMaxLinks       = 174
+	unixfsTypeFile       = 2
+)
+
+// cidBase32 is the lowercase, unpadded RFC 4648 alphabet used for CIDv1 strings
+var cidBase32 = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// base58Alphabet is the Bitcoin base58 alphabet used for CIDv0 strings
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// Multihash encodes a digest with its multihash code and length prefix
+func Multihash(code uint64, digest []byte) []byte {
+	out := binary.AppendUvarint(nil, code)
+	out = binary.AppendUvarint(out, uint64(len(digest)))
+	return append(out, digest...)
+}
+
+// cidV1 returns the binary CIDv1 for a SHA-256 digest of content with the given codec
+func cidV1(codec uint64, digest []byte) []byte {
+	out := binary.AppendUvarint(nil, 1)
+	out = binary.AppendUvarint(out, codec)
+	return append(out, Multihash(MultihashSHA2_256, digest)...)
+}
+
+// FormatCID renders a binary CID: CIDv0 (a bare multihash) in base58btc, CIDv1 in base32
+func FormatCID(cid []byte) string {
+	if len(cid) > 0 && cid[0] == MultihashSHA2_256 {
+		return base58Encode(cid)
+	}
+	return "b" + cidBase32.EncodeToString(cid)
+}
+
+// base58Encode encodes data with the Bitcoin base58 alphabet
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix, mod := big.NewInt(58), new(big.Int)
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// protoVarint appends a varint protobuf field
+func protoVarint(out []byte, field int, v uint64) []byte {
+	out = binary.AppendUvarint(out, uint64(field<<3))
+	return binary.AppendUvarint(out, v)
+}
+
+// protoBytes appends a length-delimited protobuf field
+func protoBytes(out []byte, field int, data []byte) []byte {
+	out = binary.AppendUvarint(out, uint64(field<<3|2))
+	out = binary.AppendUvarint(out, uint64(len(data)))
+	return append(out, data...)
+}
+
+// dagLink is a node of the UnixFS DAG as seen by its parent
+type dagLink struct {
+	cid      []byte
+	tsize    uint64 // serialized size of the whole subtree
+	filesize uint64 // file bytes below the node
+}
+
+// unixfsHasher builds the UnixFS file DAG `ipfs add` would create, with
+// fixed-size chunks and the balanced layout. Sum returns the binary root CID.
+// CIDv1 uses raw leaves, as `ipfs add --cid-version 1` does.
+type unixfsHasher struct {
+	chunkSize int
+	version   int
+	buf       []byte
+	leaves    []dagLink
+}
+
+// NewUnixFS returns a hasher whose Sum is the binary root CID `ipfs add`
+// would assign with the given chunk size and CID version
+func NewUnixFS(chunkSize, version int) hash.Hash {
+	return &unixfsHasher{chunkSize: chunkSize, version: version}
+}
+
+func (h *unixfsHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(h.chunkSize-len(h.buf), len(p))
+		h.buf = append(h.buf, p[:n]...)
+		p = p[n:]
+		if len(h.buf) == h.chunkSize {
+			h.leaves = append(h.leaves, h.leaf(h.buf))
+			h.buf = h.buf[:0]
+		}
+	}
+	return written, nil
+}
+
+func (h *unixfsHasher) Sum(b []byte) []byte {
+	level := append([]dagLink(nil), h.leaves...)
+	if len(h.buf) > 0 || len(level) == 0 {
+		level = append(level, h.leaf(h.buf))
+	}
+	for len(level) > 1 {
+		var parents []dagLink
+		for start := 0; start < len(level); start += unixfsMaxLinks {
+			parents = append(parents, h.parent(level[start:min(start+unixfsMaxLinks, len(level))]))
+		}
+		level = parents
+	}
+	return append(b, level[0].cid...)
+}
+
+func (h *unixfsHasher) Reset() {
+	h.buf = h.buf[:0]
+	h.leaves = nil
+}
+
+func (h *unixfsHasher) Size() int      { return 36 }
+func (h *unixfsHasher) BlockSize() int { return h.chunkSize }
+
+// leaf hashes one chunk, as a raw block for CIDv1 or a UnixFS file node for CIDv0
+func (h *unixfsHasher) leaf(data []byte) dagLink {
+	if h.version == 1 {
+		sum := sha256.Sum256(data)
+		return dagLink{cid: cidV1(multicodecRaw, sum[:]), tsize: uint64(len(data)), filesize: uint64(len(data))}
+	}
+	unixfs := protoVarint(nil, 1, unixfsTypeFile)
+	if len(data) > 0 {
+		unixfs = protoBytes(unixfs, 2, data)
+	}
+	unixfs = protoVarint(unixfs, 3, uint64(len(data)))
+	node := protoBytes(nil, 1, unixfs)
+	return dagLink{cid: h.nodeCID(node), tsize: uint64(len(node)), filesize: uint64(len(data))}
+}
+
+// parent builds a dag-pb UnixFS file node linking to children
+func (h *unixfsHasher) parent(children []dagLink) dagLink {
+	var node []byte
+	var filesize, tsize uint64
+	for _, child := range children {
+		link := protoBytes(nil, 1, child.cid)
+		link = protoBytes(link, 2, nil)
+		link = protoVarint(link, 3, child.tsize)
+		node = protoBytes(node, 2, link)
+		filesize += child.filesize
+		tsize += child.tsize
+	}
+	unixfs := protoVarint(nil, 1, unixfsTypeFile)
+	unixfs = protoVarint(unixfs, 3, filesize)
+	for _, child := range children {
+		unixfs = protoVarint(unixfs, 4, child.filesize)
+	}
+	node = protoBytes(node, 1, unixfs)
+	return dagLink{cid: h.nodeCID(node), tsize: tsize + uint64(len(node)), filesize: filesize}
+}
+
+// nodeCID addresses a dag-pb node
+func (h *unixfsHasher) nodeCID(node []byte) []byte {
+	sum := sha256.Sum256(node)
+	if h.version == 0 {
+		return Multihash(MultihashSHA2_256, sum[:])
+	}
+	return cidV1(multicodecDagPB, sum[:])
+}
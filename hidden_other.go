@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "io/fs"
+
+// hiddenAttribute reports whether Windows marks a file hidden; elsewhere only dot files are
+func hiddenAttribute(fs.DirEntry) bool {
+	return false
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// hiddenAttribute reports whether Windows marks a file hidden
+func hiddenAttribute(d fs.DirEntry) bool {
+	info, err := d.Info()
+	if err != nil {
+		return false
+	}
+	data, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
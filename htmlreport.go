@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// ReportTarget is a report requested with -report <format> <path>
+type ReportTarget struct {
+	Format string
+	Path   string
+	next   *ReportTarget // A further -report
+}
+
+// splitReportArgs removes `-report <format> <path>` from args. The flag takes
+// two values, which the flag package cannot express, so it is extracted
+// before the remaining arguments are parsed. It may be repeated to write the
+// report in several formats.
+func splitReportArgs(args []string) (*ReportTarget, []string, error) {
+	var target *ReportTarget
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		if args[i] != "-report" && args[i] != "--report" {
+			rest = append(rest, args[i])
+			continue
+		}
+		if i+2 >= len(args) {
+			return nil, nil, fmt.Errorf("-report needs a format and an output path, e.g. -report html report.html")
+		}
+		if args[i+1] != "html" && args[i+1] != "worm" {
+			return nil, nil, fmt.Errorf("unsupported report format: %s. Supported: html, worm", args[i+1])
+		}
+		target = &ReportTarget{Format: args[i+1], Path: args[i+2], next: target}
+		i += 2
+	}
+	return target, rest, nil
+}
+
+// ReportRow is one verified file in a report
+type ReportRow struct {
+	Path      string
+	Status    string
+	Algorithm string
+	Expected  string
+	Actual    string
+	Detail    string
+}
+
+// Failed reports whether the row is a verification failure
+func (r ReportRow) Failed() bool {
+	switch strings.ToLower(r.Status) {
+	case "failed", "changed", "drifted", "missing":
+		return true
+	}
+	return false
+}
+
+// VerificationReport is the content of an HTML verification report
+type VerificationReport struct {
+	Title     string
+	Manifest  string
+	Root      string
+	Generated time.Time
+	Rows      []ReportRow
+}
+
+// ReportCount is the number of rows with one status
+type ReportCount struct {
+	Status string
+	Count  int
+	Failed bool
+}
+
+// Summary counts the rows by status, in order of first appearance
+func (r VerificationReport) Summary() []ReportCount {
+	var summary []ReportCount
+	index := map[string]int{}
+	for _, row := range r.Rows {
+		i, ok := index[row.Status]
+		if !ok {
+			i = len(summary)
+			index[row.Status] = i
+			summary = append(summary, ReportCount{Status: row.Status, Failed: row.Failed()})
+		}
+		summary[i].Count++
+	}
+	return summary
+}
+
+// Failures counts the rows that did not verify
+func (r VerificationReport) Failures() int {
+	n := 0
+	for _, row := range r.Rows {
+		if row.Failed() {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteHTMLReport writes the report as a single HTML page with inline styles
+// and scripts, so it can be mailed or attached to a ticket as is
+func WriteHTMLReport(w io.Writer, report VerificationReport) error {
+	return htmlReportTemplate.Execute(w, report)
+}
+
+// write renders the report to the target path, and to any further targets
+func (t *ReportTarget) write(report VerificationReport) error {
+	if t.next != nil {
+		if err := t.next.write(report); err != nil {
+			return err
+		}
+	}
+	if t.Format == "worm" {
+		if err := writeWORMReport(t.Path, report); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+	f, err := createAtomic(t.Path, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create report: %w", err)
+	}
+	if err := WriteHTMLReport(f, report); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	if err := f.Commit(); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"lower": strings.ToLower,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #1f2328; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+.meta { color: #59636e; margin-bottom: 1.5em; }
+.verdict { display: inline-block; padding: 0.4em 0.8em; border-radius: 4px; font-weight: bold; }
+.verdict.pass { background: #dafbe1; color: #116329; }
+.verdict.fail { background: #ffebe9; color: #a40e26; }
+.stats { display: flex; gap: 1em; margin: 1.5em 0; flex-wrap: wrap; }
+.stat { border: 1px solid #d1d9e0; border-radius: 6px; padding: 0.6em 1.2em; min-width: 6em; }
+.stat .count { font-size: 1.6em; font-weight: bold; }
+.stat.failed { border-color: #cf222e; color: #a40e26; }
+.controls { margin-bottom: 1em; }
+.controls input, .controls select { font-size: 1em; padding: 0.3em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 0.4em 0.6em; border-bottom: 1px solid #d1d9e0; }
+th { cursor: pointer; user-select: none; background: #f6f8fa; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+td.hash { font-family: ui-monospace, Menlo, Consolas, monospace; font-size: 0.85em; word-break: break-all; }
+tr.failed { background: #ffebe9; }
+tr.failed td.status { color: #a40e26; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="meta">
+{{if .Root}}Directory: {{.Root}}<br>{{end}}
+{{if .Manifest}}Checked against: {{.Manifest}}<br>{{end}}
+{{if not .Generated.IsZero}}Generated: {{.Generated.Format "2006-01-02 15:04:05 MST"}}{{end}}
+</div>
+{{if .Failures}}<div class="verdict fail">{{.Failures}} of {{len .Rows}} files failed verification</div>
+{{else}}<div class="verdict pass">All {{len .Rows}} files verified</div>
+{{end}}
+<div class="stats">
+{{range .Summary}}<div class="stat{{if .Failed}} failed{{end}}"><div class="count">{{.Count}}</div>{{.Status}}</div>
+{{end}}</div>
+<div class="controls">
+<input id="filter" type="search" placeholder="Filter files" aria-label="Filter files">
+<select id="status" aria-label="Status">
+<option value="">All statuses</option>
+<option value="failed">Failures only</option>
+{{range .Summary}}<option value="{{lower .Status}}">{{.Status}}</option>
+{{end}}</select>
+</div>
+<table id="results">
+<thead><tr><th>File</th><th>Status</th><th>Algorithm</th><th>Expected</th><th>Actual</th><th>Detail</th></tr></thead>
+<tbody>
+{{range .Rows}}<tr class="{{if .Failed}}failed{{end}}" data-status="{{lower .Status}}"><td>{{.Path}}</td><td class="status">{{.Status}}</td><td>{{.Algorithm}}</td><td class="hash">{{.Expected}}</td><td class="hash">{{.Actual}}</td><td>{{.Detail}}</td></tr>
+{{end}}</tbody>
+</table>
+<script>
+(function () {
+  var table = document.getElementById("results");
+  var body = table.tBodies[0];
+  var filter = document.getElementById("filter");
+  var status = document.getElementById("status");
+  function apply() {
+    var text = filter.value.toLowerCase();
+    var want = status.value;
+    Array.prototype.forEach.call(body.rows, function (row) {
+      var matches = row.textContent.toLowerCase().indexOf(text) >= 0;
+      if (want === "failed") {
+        matches = matches && row.classList.contains("failed");
+      } else if (want) {
+        matches = matches && row.dataset.status === want;
+      }
+      row.style.display = matches ? "" : "none";
+    });
+  }
+  filter.addEventListener("input", apply);
+  status.addEventListener("change", apply);
+  Array.prototype.forEach.call(table.tHead.rows[0].cells, function (th, column) {
+    th.addEventListener("click", function () {
+      var ascending = !th.classList.contains("asc");
+      Array.prototype.forEach.call(th.parentNode.cells, function (c) { c.classList.remove("asc", "desc"); });
+      th.classList.add(ascending ? "asc" : "desc");
+      var rows = Array.prototype.slice.call(body.rows);
+      rows.sort(function (a, b) {
+        var x = a.cells[column].textContent, y = b.cells[column].textContent;
+        return ascending ? x.localeCompare(y) : y.localeCompare(x);
+      });
+      rows.forEach(function (row) { body.appendChild(row); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
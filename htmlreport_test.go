@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReport(t *testing.T) {
+	target, rest, err := splitReportArgs([]string{"./dist", "-report", "html", "out.html", "-problems"})
+	if err != nil || target == nil || target.Path != "out.html" || strings.Join(rest, " ") != "./dist -problems" {
+		t.Fatalf("unexpected split: %+v %v %v", target, rest, err)
+	}
+	if _, _, err := splitReportArgs([]string{"-report", "pdf", "out.pdf"}); err == nil {
+		t.Error("expected an error for an unsupported report format")
+	}
+	if _, _, err := splitReportArgs([]string{"-report", "html"}); err == nil {
+		t.Error("expected an error for a missing report path")
+	}
+
+	var out strings.Builder
+	err = WriteHTMLReport(&out, VerificationReport{
+		Title:     "Verification of dist",
+		Generated: time.Now(),
+		Rows: []ReportRow{
+			{Path: "bin/app", Status: "OK"},
+			{Path: "<script>.txt", Status: "FAILED", Algorithm: "SHA-256", Expected: "aa", Actual: "bb"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	for _, want := range []string{"1 of 2 files failed verification", `<tr class="failed" data-status="failed">`, "&lt;script&gt;.txt"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report does not contain %q", want)
+		}
+	}
+}
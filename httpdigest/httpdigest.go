@@ -0,0 +1,385 @@
+// Package httpdigest computes and verifies HTTP message body digests: the
+// Content-Digest field of RFC 9530 and, optionally, the legacy Digest field of
+// RFC 3230. Middleware covers server responses and requests; Transport covers
+// client requests and responses.
+package httpdigest
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// ErrDigestMismatch is returned when a body does not match its Content-Digest
+var ErrDigestMismatch = errors.New("httpdigest: body does not match Content-Digest")
+
+// ErrNoKnownDigest is returned when a Content-Digest names only algorithms this package cannot check
+var ErrNoKnownDigest = errors.New("httpdigest: Content-Digest has no sha-256 or sha-512 member")
+
+// WantContentDigest is the Want-Content-Digest field sent by clients, preferring sha-256
+const WantContentDigest = "sha-256=2, sha-512=1"
+
+// fieldNames are the RFC 9530 registry names of the algorithms that may be used
+var fieldNames = map[hasher.Algorithm]string{
+	hasher.SHA256: "sha-256",
+	hasher.SHA512: "sha-512",
+}
+
+// legacyNames are the RFC 3230 names used in the Digest field
+var legacyNames = map[hasher.Algorithm]string{
+	hasher.SHA256: "SHA-256",
+	hasher.SHA512: "SHA-512",
+}
+
+// Options configures which digests are computed and checked
+type Options struct {
+	Algorithms     []hasher.Algorithm // sha256 and/or sha512; default sha256
+	Legacy         bool               // also send the RFC 3230 Digest field
+	Trailer        bool               // stream responses and send the digest as a trailer instead of buffering
+	VerifyRequests bool               // reject requests whose Content-Digest does not match with 400
+}
+
+// algorithms returns the configured algorithms, checking they can be used in Content-Digest
+func (o Options) algorithms() ([]hasher.Algorithm, error) {
+	if len(o.Algorithms) == 0 {
+		return []hasher.Algorithm{hasher.SHA256}, nil
+	}
+	for _, alg := range o.Algorithms {
+		if fieldNames[alg] == "" {
+			return nil, fmt.Errorf("httpdigest: %s cannot be used in Content-Digest, use sha256 or sha512", alg)
+		}
+	}
+	return o.Algorithms, nil
+}
+
+// digester hashes a body with several algorithms
+type digester struct {
+	algorithms []hasher.Algorithm
+	hashers    []hash.Hash
+}
+
+func newDigester(algorithms []hasher.Algorithm) *digester {
+	d := &digester{algorithms: algorithms}
+	for _, alg := range algorithms {
+		h, _ := hasher.New(alg)
+		d.hashers = append(d.hashers, h)
+	}
+	return d
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	for _, h := range d.hashers {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// sums returns the raw digest per algorithm
+func (d *digester) sums() map[hasher.Algorithm][]byte {
+	sums := map[hasher.Algorithm][]byte{}
+	for i, alg := range d.algorithms {
+		sums[alg] = d.hashers[i].Sum(nil)
+	}
+	return sums
+}
+
+// Format renders digests as a Content-Digest dictionary, e.g. sha-256=:base64:
+func Format(algorithms []hasher.Algorithm, sums map[hasher.Algorithm][]byte) string {
+	var items []string
+	for _, alg := range algorithms {
+		items = append(items, fieldNames[alg]+"=:"+base64.StdEncoding.EncodeToString(sums[alg])+":")
+	}
+	return strings.Join(items, ", ")
+}
+
+// formatLegacy renders digests as an RFC 3230 Digest field
+func formatLegacy(algorithms []hasher.Algorithm, sums map[hasher.Algorithm][]byte) string {
+	var items []string
+	for _, alg := range algorithms {
+		items = append(items, legacyNames[alg]+"="+base64.StdEncoding.EncodeToString(sums[alg]))
+	}
+	return strings.Join(items, ",")
+}
+
+// Parse reads a Content-Digest dictionary into raw digests, skipping
+// algorithms this package does not know
+func Parse(field string) (map[hasher.Algorithm][]byte, error) {
+	digests := map[hasher.Algorithm][]byte{}
+	for _, item := range strings.Split(field, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("httpdigest: malformed Content-Digest member %q", item)
+		}
+		value, _, _ = strings.Cut(value, ";") // parameters are ignored
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return nil, fmt.Errorf("httpdigest: Content-Digest member %q is not a byte sequence", item)
+		}
+		sum, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return nil, fmt.Errorf("httpdigest: Content-Digest member %q: %w", item, err)
+		}
+		for alg, fieldName := range fieldNames {
+			if strings.EqualFold(strings.TrimSpace(name), fieldName) {
+				digests[alg] = sum
+			}
+		}
+	}
+	return digests, nil
+}
+
+// Verifier hashes a body with every algorithm Content-Digest may use, so it
+// can be checked against a field that only arrives after the body as a trailer
+type Verifier struct {
+	digester *digester
+}
+
+// NewVerifier creates a verifier for sha-256 and sha-512 digests
+func NewVerifier() *Verifier {
+	return &Verifier{digester: newDigester([]hasher.Algorithm{hasher.SHA256, hasher.SHA512})}
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	return v.digester.Write(p)
+}
+
+// Check compares the body written so far with every known member of a
+// Content-Digest field
+func (v *Verifier) Check(field string) error {
+	expected, err := Parse(field)
+	if err != nil {
+		return err
+	}
+	if len(expected) == 0 {
+		return ErrNoKnownDigest
+	}
+	sums := v.digester.sums()
+	for alg, sum := range expected {
+		if subtle.ConstantTimeCompare(sum, sums[alg]) != 1 {
+			return ErrDigestMismatch
+		}
+	}
+	return nil
+}
+
+// ParseWant returns the algorithms of a Want-Content-Digest field this
+// package supports, most preferred first; a weight of 0 excludes an algorithm
+func ParseWant(field string) []hasher.Algorithm {
+	type wanted struct {
+		alg    hasher.Algorithm
+		weight int
+	}
+	var all []wanted
+	for _, item := range strings.Split(field, ",") {
+		name, weight, _ := strings.Cut(strings.TrimSpace(item), "=")
+		w, err := strconv.Atoi(strings.TrimSpace(weight))
+		if err != nil || w <= 0 {
+			continue
+		}
+		for alg, fieldName := range fieldNames {
+			if strings.EqualFold(strings.TrimSpace(name), fieldName) {
+				all = append(all, wanted{alg, w})
+			}
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool { return all[i].weight > all[j].weight })
+	algorithms := make([]hasher.Algorithm, len(all))
+	for i, w := range all {
+		algorithms[i] = w.alg
+	}
+	return algorithms
+}
+
+// Middleware adds Content-Digest to responses of next, using the algorithm
+// the client prefers in Want-Content-Digest when it asks for one, and, with
+// VerifyRequests, rejects request bodies that do not match their digest.
+// Responses are buffered so the digest can be sent as a header, unless
+// Trailer is set.
+func Middleware(next http.Handler, options Options) (http.Handler, error) {
+	defaults, err := options.algorithms()
+	if err != nil {
+		return nil, err
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		algorithms := defaults
+		if want := ParseWant(r.Header.Get("Want-Content-Digest")); len(want) > 0 {
+			algorithms = want[:1]
+		}
+		if options.VerifyRequests && r.Header.Get("Content-Digest") != "" && r.Body != nil {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "failed to read request body", http.StatusBadRequest)
+				return
+			}
+			verifier := NewVerifier()
+			verifier.Write(body)
+			if err := verifier.Check(r.Header.Get("Content-Digest")); err != nil && err != ErrNoKnownDigest {
+				http.Error(w, "request body does not match Content-Digest", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		if options.Trailer {
+			w.Header().Add("Trailer", "Content-Digest")
+			if options.Legacy {
+				w.Header().Add("Trailer", "Digest")
+			}
+			d := newDigester(algorithms)
+			next.ServeHTTP(&trailerWriter{ResponseWriter: w, digester: d}, r)
+			sums := d.sums()
+			w.Header().Set("Content-Digest", Format(algorithms, sums))
+			if options.Legacy {
+				w.Header().Set("Digest", formatLegacy(algorithms, sums))
+			}
+			return
+		}
+
+		buffered := &bufferedWriter{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+		for name, values := range buffered.header {
+			w.Header()[name] = values
+		}
+		if r.Method != http.MethodHead && buffered.status != http.StatusNoContent && buffered.status != http.StatusNotModified {
+			d := newDigester(algorithms)
+			d.Write(buffered.body.Bytes())
+			sums := d.sums()
+			w.Header().Set("Content-Digest", Format(algorithms, sums))
+			if options.Legacy {
+				w.Header().Set("Digest", formatLegacy(algorithms, sums))
+			}
+		}
+		w.WriteHeader(buffered.status)
+		w.Write(buffered.body.Bytes())
+	}), nil
+}
+
+// bufferedWriter collects a response so headers can be added after the body is known
+type bufferedWriter struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (b *bufferedWriter) Header() http.Header { return b.header }
+
+func (b *bufferedWriter) WriteHeader(status int) {
+	if !b.wroteHeader {
+		b.status, b.wroteHeader = status, true
+	}
+}
+
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.wroteHeader = true
+	return b.body.Write(p)
+}
+
+// trailerWriter hashes a response as it is streamed
+type trailerWriter struct {
+	http.ResponseWriter
+	digester *digester
+}
+
+func (t *trailerWriter) Write(p []byte) (int, error) {
+	n, err := t.ResponseWriter.Write(p)
+	t.digester.Write(p[:n])
+	return n, err
+}
+
+func (t *trailerWriter) Flush() {
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Transport is an http.RoundTripper that adds Content-Digest to request
+// bodies and verifies response bodies against their Content-Digest header or
+// trailer as they are read. A mismatch makes the final body Read fail with
+// ErrDigestMismatch.
+type Transport struct {
+	Base    http.RoundTripper // http.DefaultTransport when nil
+	Options Options
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	algorithms, err := t.Options.algorithms()
+	if err != nil {
+		return nil, err
+	}
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	req = req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody && req.Header.Get("Content-Digest") == "" {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		d := newDigester(algorithms)
+		d.Write(body)
+		sums := d.sums()
+		req.Header.Set("Content-Digest", Format(algorithms, sums))
+		if t.Options.Legacy {
+			req.Header.Set("Digest", formatLegacy(algorithms, sums))
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(body)), nil }
+		req.ContentLength = int64(len(body))
+	}
+	var want []string
+	for i, alg := range algorithms {
+		want = append(want, fmt.Sprintf("%s=%d", fieldNames[alg], len(algorithms)-i))
+	}
+	req.Header.Set("Want-Content-Digest", strings.Join(want, ", "))
+
+	resp, err := base.RoundTrip(req)
+	if err != nil || resp.Body == nil {
+		return resp, err
+	}
+	resp.Body = &verifyingBody{ReadCloser: resp.Body, resp: resp, verifier: NewVerifier()}
+	return resp, nil
+}
+
+// verifyingBody hashes a response body and checks it at end of stream
+type verifyingBody struct {
+	io.ReadCloser
+	resp     *http.Response
+	verifier *Verifier
+	done     bool
+}
+
+func (v *verifyingBody) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.verifier.Write(p[:n])
+	if err == io.EOF && !v.done {
+		v.done = true
+		// Trailers are only populated once the body has been read
+		field := v.resp.Header.Get("Content-Digest")
+		if field == "" {
+			field = v.resp.Trailer.Get("Content-Digest")
+		}
+		if field != "" {
+			if checkErr := v.verifier.Check(field); checkErr != nil && checkErr != ErrNoKnownDigest {
+				return n, checkErr
+			}
+		}
+	}
+	return n, err
+}
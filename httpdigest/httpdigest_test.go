@@ -0,0 +1,96 @@
+package httpdigest
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"hashculate/hasher"
+)
+
+// helloDigest is the RFC 9530 Content-Digest of "hello world"
+const helloDigest = "sha-256=:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=:"
+
+func TestMiddlewareAndTransport(t *testing.T) {
+	var received string
+	handler, err := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = string(body)
+		io.WriteString(w, "hello world")
+	}), Options{VerifyRequests: true, Legacy: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "hello world" || received != "payload" {
+		t.Fatalf("Unexpected round trip: %v %q %q", err, body, received)
+	}
+	if got := resp.Header.Get("Content-Digest"); got != helloDigest {
+		t.Errorf("Content-Digest = %s, want %s", got, helloDigest)
+	}
+	if got := resp.Header.Get("Digest"); got != "SHA-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=" {
+		t.Errorf("Unexpected legacy Digest: %s", got)
+	}
+
+	// A request body that does not match its digest is rejected
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("tampered"))
+	req.Header.Set("Content-Digest", helloDigest)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a mismatched request digest: %v", err)
+	}
+
+	// Want-Content-Digest selects the response algorithm
+	req, _ = http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Want-Content-Digest", "sha-256=1, sha-512=5, md5=9")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil || !strings.HasPrefix(resp.Header.Get("Content-Digest"), "sha-512=:") {
+		t.Errorf("Expected a sha-512 Content-Digest: %v", err)
+	}
+
+	if _, err := Middleware(handler, Options{Algorithms: []hasher.Algorithm{hasher.MD5}}); err == nil {
+		t.Error("Expected md5 to be refused for Content-Digest")
+	}
+}
+
+func TestTransportDetectsTampering(t *testing.T) {
+	// The digest is sent as a trailer after a streamed body that was altered on the way
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "Content-Digest")
+		io.WriteString(w, "hello w0rld")
+		w.Header().Set("Content-Digest", helloDigest)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.ReadAll(resp.Body); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got %v", err)
+	}
+
+	trailer, _ := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello ")
+		io.WriteString(w, "world")
+	}), Options{Trailer: true})
+	recorder := httptest.NewRecorder()
+	trailer.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if got := recorder.Result().Trailer.Get("Content-Digest"); got != helloDigest {
+		t.Errorf("Trailer Content-Digest = %q, want %s", got, helloDigest)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"hashculate/hasher"
+)
+
+// ScanJournal records each file a batch scan has finished, so a scan that
+// was stopped or lost to a reboot resumes where it left off
+type ScanJournal struct {
+	mu   sync.Mutex // Guards appends from files hashed at once
+	path string
+	file *os.File
+	done map[string]DBEntry
+	full bool // The disk filled up and journaling stopped
+}
+
+// OpenScanJournal loads the files finished by an earlier run and opens the
+// journal for appending. A line cut short by a crash is ignored.
+func OpenScanJournal(path string) (*ScanJournal, error) {
+	j := &ScanJournal{path: path, done: map[string]DBEntry{}}
+	if f, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry DBEntry
+			if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Path != "" {
+				j.done[entry.Path] = entry
+			}
+		}
+		f.Close()
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// Resumed returns how many files the journal holds from earlier runs
+func (j *ScanJournal) Resumed() int {
+	return len(j.done)
+}
+
+// Done returns the journaled entry for path when the file is unchanged since
+// and was hashed with every algorithm wanted
+func (j *ScanJournal) Done(path string, algorithms []HashAlgorithm) (DBEntry, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return DBEntry{}, false
+	}
+	return j.Unchanged(dbKey(path), info.Size(), info.ModTime(), algorithms)
+}
+
+// Unchanged returns the journaled entry for key when it was recorded with
+// this size and modification time and every algorithm wanted, for entries
+// that are not local files
+func (j *ScanJournal) Unchanged(key string, size int64, modified time.Time, algorithms []HashAlgorithm) (DBEntry, bool) {
+	entry, ok := j.done[key]
+	if !ok || size != entry.Size || !modified.UTC().Equal(entry.Modified) {
+		return DBEntry{}, false
+	}
+	for _, alg := range algorithms {
+		if entry.Hashes[alg] == "" {
+			return DBEntry{}, false
+		}
+	}
+	return entry, true
+}
+
+// Record appends a finished file and syncs it to disk
+func (j *ScanJournal) Record(entry DBEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.full {
+		return nil
+	}
+	err = appendLine(j.file, data)
+	if err == nil {
+		err = j.file.Sync()
+	}
+	// The journal only speeds up a rerun, so a full disk does not stop the scan
+	if isDiskFull(err) {
+		j.full = true
+		fmt.Fprintf(os.Stderr, "Warning: journal %s: %v; journaling stopped\n", j.path, err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal, removing it when the scan completed
+func (j *ScanJournal) Close(completed bool) error {
+	err := j.file.Close()
+	if completed {
+		err = os.Remove(j.path)
+	}
+	return err
+}
+
+// journalEntry describes the digests of a file as a journal entry
+func journalEntry(path string, info os.FileInfo, results []*HashResult) DBEntry {
+	entry := DBEntry{Path: dbKey(path), Size: info.Size(), Modified: info.ModTime().UTC(), Hashes: map[HashAlgorithm]string{}}
+	for _, result := range results {
+		entry.Hashes[result.Algorithm] = result.Hash
+	}
+	return entry
+}
+
+// journaledDigests returns the digests of a file the journal holds, as if it
+// had just been hashed
+func (hc *HashCalculator) journaledDigests(path string, algorithms []HashAlgorithm) ([]*HashResult, bool) {
+	if hc.Journal == nil {
+		return nil, false
+	}
+	entry, ok := hc.Journal.Done(path, algorithms)
+	if !ok {
+		return nil, false
+	}
+	if hc.Batch != nil {
+		progress, done := hc.Batch.File(path, entry.Size)
+		progress(1)
+		done()
+	}
+	name := hc.Paths.name(path, filepath.Base(path))
+	results := make([]*HashResult, len(algorithms))
+	for i, alg := range algorithms {
+		results[i] = &HashResult{
+			Algorithm:   alg,
+			Hash:        entry.Hashes[alg],
+			Filename:    name,
+			Path:        filepath.Clean(path),
+			Basename:    filepath.Base(path),
+			FileSize:    entry.Size,
+			ChunkSize:   hc.ChunkSize,
+			Description: hasher.Describe(name, entry.Size, alg, entry.Hashes[alg]),
+		}
+	}
+	return results, true
+}
+
+// ScanControl lets a running batch scan be paused, resumed and stopped
+// between files
+type ScanControl struct {
+	mu      sync.Mutex
+	changed *sync.Cond
+	paused  bool
+	stopped bool
+	suspend bool // Pause requested by SIGTSTP, which suspends the process
+	status  string
+}
+
+// NewScanControl creates a control for a running scan
+func NewScanControl() *ScanControl {
+	c := &ScanControl{}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Wait blocks while the scan is paused and reports whether it may go on
+func (c *ScanControl) Wait() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.paused && !c.stopped {
+		c.changed.Wait()
+	}
+	return !c.stopped
+}
+
+// Set pauses, resumes or stops the scan
+func (c *ScanControl) Set(paused, stopped bool) {
+	c.mu.Lock()
+	c.paused, c.stopped = paused, c.stopped || stopped
+	c.mu.Unlock()
+	c.changed.Broadcast()
+}
+
+// Between is called between files. When a pause was requested it calls
+// onPause, then suspends the process after SIGTSTP or waits for the control
+// socket, and it reports whether the scan may go on.
+func (c *ScanControl) Between(onPause func()) bool {
+	c.mu.Lock()
+	paused, suspended := c.paused && !c.stopped, c.suspend
+	c.suspend = false
+	c.mu.Unlock()
+	if paused {
+		onPause()
+		if suspended && suspend() {
+			c.Set(false, false)
+		}
+	}
+	return c.Wait()
+}
+
+// SetStatus records what the scan is doing, for the status command
+func (c *ScanControl) SetStatus(status string) {
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+}
+
+// command handles one control socket command
+func (c *ScanControl) command(line string) string {
+	switch strings.TrimSpace(line) {
+	case "pause":
+		c.Set(true, false)
+		return "ok, pausing after the current file"
+	case "resume":
+		c.Set(false, false)
+		return "ok"
+	case "stop":
+		c.Set(false, true)
+		return "ok, stopping after the current file"
+	case "status":
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		state := "running"
+		switch {
+		case c.stopped:
+			state = "stopping"
+		case c.paused:
+			state = "paused"
+		}
+		return state + ", " + c.status
+	}
+	return "error: unknown command; use pause, resume, stop or status"
+}
+
+// Listen serves pause, resume, stop and status commands, one per line, on a Unix socket
+func (c *ScanControl) Listen(path string) (net.Listener, error) {
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket: %w", err)
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					fmt.Fprintln(conn, c.command(scanner.Text()))
+				}
+			}()
+		}
+	}()
+	return listener, nil
+}
+
+// HandleSignals stops the scan after the current file on SIGINT or SIGTERM,
+// and pauses it on SIGTSTP where the platform has job control
+func (c *ScanControl) HandleSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, append([]os.Signal{os.Interrupt, syscall.SIGTERM}, suspendSignals...)...)
+	go func() {
+		for sig := range signals {
+			if sig == os.Interrupt || sig == syscall.SIGTERM {
+				c.Set(false, true)
+				continue
+			}
+			c.mu.Lock()
+			c.suspend = true
+			c.mu.Unlock()
+			c.Set(true, false)
+		}
+	}()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanJournal(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	os.WriteFile(a, []byte("alpha"), 0644)
+	os.WriteFile(b, []byte("beta"), 0644)
+	path := filepath.Join(dir, "db.json.journal")
+
+	journal, err := OpenScanJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{a, b} {
+		entry, err := HashFileEntry(NewHashCalculator(), file, []HashAlgorithm{SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := journal.Record(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	journal.Close(false)
+
+	// A line cut short by a crash is skipped, and a file changed since is hashed again
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"path":"c.txt","si`)
+	f.Close()
+	os.WriteFile(b, []byte("changed"), 0644)
+	journal, err = OpenScanJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if journal.Resumed() != 2 {
+		t.Errorf("expected 2 journaled files, got %d", journal.Resumed())
+	}
+	if entry, ok := journal.Done(a, []HashAlgorithm{SHA256}); !ok || entry.Hashes[SHA256] != "8ed3f6ad685b959ead7022518e1af76cd816f8e8ec7ccdda1ed4018e8f2223f8" {
+		t.Errorf("unchanged file not taken from the journal: %+v", entry)
+	}
+	if _, ok := journal.Done(a, []HashAlgorithm{SHA256, MD5}); ok {
+		t.Error("a file journaled without every algorithm must be hashed again")
+	}
+	if _, ok := journal.Done(b, []HashAlgorithm{SHA256}); ok {
+		t.Error("a changed file must be hashed again")
+	}
+	journal.Close(true)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("journal not removed after a completed scan")
+	}
+}
+
+func TestScanControl(t *testing.T) {
+	control := NewScanControl()
+	control.SetStatus("3 file(s) done")
+	if got := control.command("pause"); got != "ok, pausing after the current file" {
+		t.Errorf("pause: %s", got)
+	}
+	if got := control.command("status"); got != "paused, 3 file(s) done" {
+		t.Errorf("status: %s", got)
+	}
+
+	goOn := make(chan bool)
+	go func() { goOn <- control.Between(func() {}) }()
+	select {
+	case <-goOn:
+		t.Fatal("a paused scan went on")
+	case <-time.After(50 * time.Millisecond):
+	}
+	control.command("resume")
+	if !<-goOn {
+		t.Error("a resumed scan must go on")
+	}
+	control.command("stop")
+	if control.Between(func() {}) {
+		t.Error("a stopped scan must not go on")
+	}
+}
+
+func TestResumeJournal(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "data"), 0755)
+	a, b := filepath.Join(dir, "data", "a.txt"), filepath.Join(dir, "data", "b.txt")
+	os.WriteFile(a, []byte("alpha"), 0644)
+	os.WriteFile(b, []byte("beta"), 0644)
+
+	// A crashed run finished a.txt; its journaled digests are used without reading the file
+	info, _ := os.Stat(a)
+	journal, _ := OpenScanJournal(filepath.Join(dir, "run.journal"))
+	journal.Record(DBEntry{Path: dbKey(a), Size: info.Size(), Modified: info.ModTime().UTC(),
+		Hashes: map[HashAlgorithm]string{SHA1: "journaled-sha1", SHA256: "journaled-sha256", MD5: "journaled-md5"}})
+	journal.Close(false)
+
+	calc := NewHashCalculator()
+	calc.Journal, _ = OpenScanJournal(filepath.Join(dir, "run.journal"))
+	var out strings.Builder
+	if err := WriteSPDX(&out, filepath.Join(dir, "data"), calc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "journaled-sha256") {
+		t.Errorf("journaled digests not used:\n%s", out.String())
+	}
+	calc.Journal.Close(false)
+	reopened, _ := OpenScanJournal(filepath.Join(dir, "run.journal"))
+	if _, ok := reopened.Done(b, spdxAlgorithms); !ok {
+		t.Error("b.txt was not journaled")
+	}
+	reopened.Close(true)
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// terminationMessageLimit is how much of the termination log Kubernetes keeps
+const terminationMessageLimit = 4096
+
+// K8sVolume is a mounted volume and the manifest it has to match
+type K8sVolume struct {
+	Dir      string
+	Manifest string
+}
+
+// K8sVerification is the outcome of checking one volume against its manifest
+type K8sVerification struct {
+	Volume K8sVolume
+	Checks []SBOMCheckResult
+	Extra  []string // files on the volume the manifest does not list, with strict checking
+}
+
+// Problems counts the files that block the pod from starting
+func (v *K8sVerification) Problems() map[string]int {
+	problems := map[string]int{}
+	for _, check := range v.Checks {
+		if check.Status != "OK" {
+			problems[check.Status]++
+		}
+	}
+	if len(v.Extra) > 0 {
+		problems["EXTRA"] = len(v.Extra)
+	}
+	return problems
+}
+
+// parseK8sVolume splits a `<dir>=<manifest>` argument
+func parseK8sVolume(arg string) (K8sVolume, error) {
+	dir, manifest, ok := strings.Cut(arg, "=")
+	if !ok || dir == "" || manifest == "" {
+		return K8sVolume{}, fmt.Errorf("expected <dir>=<manifest>, got %q", arg)
+	}
+	return K8sVolume{Dir: dir, Manifest: manifest}, nil
+}
+
+// VerifyVolume hashes the files the manifest lists below the volume. With
+// strict, files the manifest does not list are reported as well, except the
+// `..data` links and timestamped directories the kubelet adds to ConfigMap
+// and Secret volumes.
+func VerifyVolume(volume K8sVolume, strict bool, calculator *HashCalculator) (*K8sVerification, error) {
+	entries, err := LoadManifest(volume.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	v := &K8sVerification{Volume: volume, Checks: VerifySBOM(entries, volume.Dir, calculator)}
+	if !strict {
+		return v, nil
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range entries {
+		listed[manifestKey(entry.Path)] = true
+	}
+	files, err := listFiles(volume.Dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		rel := relativeSlashPath(volume.Dir, file)
+		if !listed[rel] && !strings.HasPrefix(rel, "..") {
+			v.Extra = append(v.Extra, rel)
+		}
+	}
+	return v, nil
+}
+
+// k8sEvents writes one JSON object per event to the container log, where
+// cluster log collectors pick them up, and ships them to the log sink
+type k8sEvents struct {
+	w    io.Writer
+	sink *LogSink
+}
+
+// Emit logs an event with its fields flattened into the JSON object
+func (e k8sEvents) Emit(level int, event, message string, fields map[string]any) {
+	record := map[string]any{"level": levelName(level), "event": event, "message": message}
+	if t := outputTime(time.Now().UTC()); !t.IsZero() {
+		record["time"] = t.Format(time.RFC3339Nano)
+	}
+	for k, v := range fields {
+		record[k] = v
+	}
+	data, _ := json.Marshal(record)
+	fmt.Fprintf(e.w, "%s\n", data)
+	e.sink.Emit(level, event, message, fields)
+}
+
+// writeTerminationMessage leaves the reason for a failure where Kubernetes
+// shows it in the pod status. Outside a pod the file does not exist and
+// nothing is written.
+func writeTerminationMessage(path, message string) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(message) > terminationMessageLimit {
+		message = message[:terminationMessageLimit]
+	}
+	_, err = f.WriteString(message)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// runK8sVerify implements the k8s-verify command
+func runK8sVerify(args []string) int {
+	fs := flag.NewFlagSet("k8s-verify", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "Also fail on files the manifest does not list")
+	terminationLog := fs.String("termination-log", "/dev/termination-log", "Where to leave the failure summary for the pod status")
+	logFlags := registerLogSinkFlags(fs)
+	positional := parseFlags(fs, args)
+	if len(positional) == 0 {
+		fmt.Println("Usage: hashculate k8s-verify [-strict] [-termination-log <path>] <dir>=<manifest>...")
+		return 1
+	}
+	var volumes []K8sVolume
+	for _, arg := range positional {
+		volume, err := parseK8sVolume(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		volumes = append(volumes, volume)
+	}
+	sink, err := logFlags.open()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer sink.Close()
+
+	events := k8sEvents{w: os.Stdout, sink: sink}
+	var failures []string
+	for _, volume := range volumes {
+		fields := map[string]any{"volume": volume.Dir, "manifest": volume.Manifest}
+		v, err := VerifyVolume(volume, *strict, NewHashCalculator())
+		if err != nil {
+			events.Emit(logError, "volume.error", err.Error(), fields)
+			failures = append(failures, fmt.Sprintf("%s: %v", volume.Dir, err))
+			continue
+		}
+
+		for _, check := range v.Checks {
+			if check.Status == "OK" {
+				continue
+			}
+			detail := map[string]any{"volume": volume.Dir, "path": check.Path, "status": check.Status,
+				"algorithm": string(check.Algorithm), "expected": check.Expected, "actual": check.Actual}
+			if check.Err != nil {
+				detail["error"] = check.Err.Error()
+			}
+			events.Emit(logError, "verify.failed", fmt.Sprintf("%s: %s", check.Path, check.Status), detail)
+		}
+		for _, extra := range v.Extra {
+			events.Emit(logError, "verify.failed", extra+": EXTRA", map[string]any{"volume": volume.Dir, "path": extra, "status": "EXTRA"})
+		}
+
+		problems := v.Problems()
+		fields["files"] = len(v.Checks)
+		for status, count := range problems {
+			fields[strings.ToLower(status)] = count
+		}
+		if len(problems) == 0 {
+			events.Emit(logInfo, "volume.verified", fmt.Sprintf("%s: %d file(s) verified", volume.Dir, len(v.Checks)), fields)
+			continue
+		}
+		var counts []string
+		for _, status := range []string{"FAILED", "MISSING", "UNSUPPORTED", "EXTRA"} {
+			if problems[status] > 0 {
+				counts = append(counts, fmt.Sprintf("%d %s", problems[status], strings.ToLower(status)))
+			}
+		}
+		summary := fmt.Sprintf("%s: %s", volume.Dir, strings.Join(counts, ", "))
+		events.Emit(logError, "volume.failed", summary, fields)
+		failures = append(failures, summary)
+	}
+
+	if len(failures) > 0 {
+		message := "hashculate k8s-verify: " + strings.Join(failures, "; ")
+		if err := writeTerminationMessage(*terminationLog, message); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyVolume(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	for name, content := range map[string]string{"model.bin": "weights", "conf/app.yaml": "debug: false", "..2026_10_17/app.yaml": "debug: false"} {
+		os.MkdirAll(filepath.Join(data, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(data, name), []byte(content), 0644)
+	}
+	manifest := filepath.Join(dir, "manifest.sha256")
+	os.WriteFile(manifest, []byte(fmt.Sprintf("%x  model.bin\n%x  conf/app.yaml\n", sha256.Sum256([]byte("weights")), sha256.Sum256([]byte("debug: false")))), 0644)
+
+	volume, err := parseK8sVolume(data + "=" + manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := VerifyVolume(volume, true, NewHashCalculator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := v.Problems(); len(problems) != 0 || len(v.Checks) != 2 {
+		t.Errorf("expected a clean volume, got %v with %d checks", problems, len(v.Checks))
+	}
+
+	os.WriteFile(filepath.Join(data, "model.bin"), []byte("poisoned"), 0644)
+	os.WriteFile(filepath.Join(data, "backdoor.sh"), []byte("#!/bin/sh"), 0755)
+	if v, err = VerifyVolume(volume, true, NewHashCalculator()); err != nil {
+		t.Fatal(err)
+	}
+	if problems := v.Problems(); problems["FAILED"] != 1 || fmt.Sprint(v.Extra) != "[backdoor.sh]" {
+		t.Errorf("unexpected problems: %v, extra %v", problems, v.Extra)
+	}
+
+	// The failure summary goes to the termination log only when Kubernetes provides one
+	if err := writeTerminationMessage(filepath.Join(dir, "missing", "termination-log"), "failed"); err != nil {
+		t.Errorf("a missing termination log should be skipped: %v", err)
+	}
+	log := filepath.Join(dir, "termination-log")
+	os.WriteFile(log, nil, 0644)
+	writeTerminationMessage(log, strings.Repeat("x", 5000))
+	if written, _ := os.ReadFile(log); len(written) != terminationMessageLimit {
+		t.Errorf("expected the message to be cut to %d bytes, got %d", terminationMessageLimit, len(written))
+	}
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Log event severities, using syslog levels so every sink can map them directly
+const (
+	logError   = 3
+	logWarning = 4
+	logInfo    = 6
+)
+
+// gelfChunkSize is the largest GELF UDP datagram sent before chunking
+const gelfChunkSize = 8192
+
+// LogEvent is a structured event shipped to central logging
+type LogEvent struct {
+	Time    time.Time
+	Level   int
+	Event   string // e.g. verify.failed, scan.summary
+	Message string
+	Fields  map[string]any
+}
+
+// LogSink ships events to syslog, GELF or Splunk HEC. A nil sink discards events.
+type LogSink struct {
+	kind     string
+	hostname string
+	conn     net.Conn // syslog and GELF
+	stream   bool     // conn is TCP
+	hecURL   string
+	hecToken string
+	client   *http.Client
+}
+
+// logSinkFlags are the -log-sink options shared by every command that reports results
+type logSinkFlags struct {
+	kind, target, token *string
+}
+
+// registerLogSinkFlags adds the -log-sink options to a flag set
+func registerLogSinkFlags(fs *flag.FlagSet) *logSinkFlags {
+	return &logSinkFlags{
+		kind:   fs.String("log-sink", "", "Ship events to central logging: syslog, gelf, splunk-hec"),
+		target: fs.String("log-target", "", "Log sink address (udp://host:port, tcp://host:port) or HEC URL"),
+		token:  fs.String("log-token", "", "Splunk HEC token [default: $HASHCULATE_LOG_TOKEN]"),
+	}
+}
+
+// open connects the configured sink, returning nil when none is configured
+func (f *logSinkFlags) open() (*LogSink, error) {
+	if *f.kind == "" {
+		return nil, nil
+	}
+	token := *f.token
+	if token == "" {
+		token = os.Getenv("HASHCULATE_LOG_TOKEN")
+	}
+	return OpenLogSink(*f.kind, *f.target, token)
+}
+
+// OpenLogSink connects to a log sink. target defaults to the local collector's standard port.
+func OpenLogSink(kind, target, token string) (*LogSink, error) {
+	hostname, _ := os.Hostname()
+	sink := &LogSink{kind: kind, hostname: hostname}
+	switch kind {
+	case "syslog", "gelf":
+		if target == "" {
+			target = "udp://localhost:514"
+			if kind == "gelf" {
+				target = "udp://localhost:12201"
+			}
+		}
+		network, address := "udp", target
+		if scheme, rest, ok := strings.Cut(target, "://"); ok {
+			network, address = scheme, rest
+		}
+		if network != "udp" && network != "tcp" {
+			return nil, fmt.Errorf("unsupported log target network: %s", network)
+		}
+		conn, err := net.DialTimeout(network, address, 10*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", target, err)
+		}
+		sink.conn, sink.stream = conn, network == "tcp"
+	case "splunk-hec":
+		if target == "" || token == "" {
+			return nil, fmt.Errorf("splunk-hec needs -log-target <url> and a token")
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HEC URL: %w", err)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/services/collector/event"
+		}
+		sink.hecURL, sink.hecToken = u.String(), token
+		sink.client = &http.Client{Timeout: 30 * time.Second}
+	default:
+		return nil, fmt.Errorf("unsupported log sink: %s. Supported: syslog, gelf, splunk-hec", kind)
+	}
+	return sink, nil
+}
+
+// Emit ships an event. Delivery problems are reported on stderr but never fail the command.
+func (s *LogSink) Emit(level int, event, message string, fields map[string]any) {
+	if s == nil {
+		return
+	}
+	e := LogEvent{Time: time.Now().UTC(), Level: level, Event: event, Message: message, Fields: fields}
+	var err error
+	switch s.kind {
+	case "syslog":
+		err = s.write(s.syslogMessage(e))
+	case "gelf":
+		err = s.sendGELF(e)
+	case "splunk-hec":
+		err = s.sendHEC(e)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: log sink %s: %v\n", s.kind, err)
+	}
+}
+
+// Close releases the sink's connection
+func (s *LogSink) Close() {
+	if s != nil && s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// sortedFields returns field names in a stable order
+func sortedFields(fields map[string]any) []string {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// syslogMessage formats an RFC 5424 message with the fields as structured data
+func (s *LogSink) syslogMessage(e LogEvent) []byte {
+	const facilityLocal0 = 16
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+	var sd strings.Builder
+	sd.WriteString("[hashculate@32473 event=\"" + escape.Replace(e.Event) + "\"")
+	for _, k := range sortedFields(e.Fields) {
+		fmt.Fprintf(&sd, " %s=\"%s\"", k, escape.Replace(fmt.Sprint(e.Fields[k])))
+	}
+	sd.WriteString("]")
+	msg := fmt.Sprintf("<%d>1 %s %s hashculate %d %s %s %s",
+		facilityLocal0*8+e.Level, e.Time.Format(time.RFC3339Nano), s.hostname, os.Getpid(), e.Event, sd.String(), e.Message)
+	if s.stream {
+		// RFC 6587 octet counting
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg)
+}
+
+// sendGELF sends a GELF 1.1 message, chunking large UDP messages
+func (s *LogSink) sendGELF(e LogEvent) error {
+	message := map[string]any{
+		"version":       "1.1",
+		"host":          s.hostname,
+		"short_message": e.Message,
+		"timestamp":     float64(e.Time.UnixMilli()) / 1000,
+		"level":         e.Level,
+		"_event":        e.Event,
+	}
+	for k, v := range e.Fields {
+		message["_"+k] = v
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if s.stream {
+		return s.write(append(data, 0))
+	}
+	if len(data) <= gelfChunkSize {
+		return s.write(data)
+	}
+	const header = 12
+	payload := gelfChunkSize - header
+	count := (len(data) + payload - 1) / payload
+	if count > 128 {
+		return fmt.Errorf("GELF message too large (%d bytes)", len(data))
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	for i := 0; i < count; i++ {
+		chunk := append([]byte{0x1e, 0x0f}, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, data[i*payload:min((i+1)*payload, len(data))]...)
+		if err := s.write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendHEC posts an event to the Splunk HTTP Event Collector
+func (s *LogSink) sendHEC(e LogEvent) error {
+	event := map[string]any{"level": levelName(e.Level), "event": e.Event, "message": e.Message}
+	for k, v := range e.Fields {
+		event[k] = v
+	}
+	body, err := json.Marshal(map[string]any{
+		"time":       float64(e.Time.UnixMilli()) / 1000,
+		"host":       s.hostname,
+		"source":     "hashculate",
+		"sourcetype": "_json",
+		"event":      event,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.hecURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Splunk "+s.hecToken)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HEC returned %s", resp.Status)
+	}
+	return nil
+}
+
+// write sends raw bytes on the sink's connection
+func (s *LogSink) write(data []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	_, err := s.conn.Write(data)
+	return err
+}
+
+// levelName names a syslog severity
+func levelName(level int) string {
+	switch level {
+	case logError:
+		return "error"
+	case logWarning:
+		return "warning"
+	default:
+		return "info"
+	}
+}
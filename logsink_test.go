@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// receiveUDP returns the next datagram sent to conn
+func receiveUDP(t *testing.T, conn net.PacketConn) string {
+	t.Helper()
+	buf := make([]byte, 65536)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("No datagram received: %v", err)
+	}
+	return string(buf[:n])
+}
+
+func TestLogSinks(t *testing.T) {
+	collector, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer collector.Close()
+	fields := map[string]any{"path": "bin/app", "status": "FAILED", "expected": `a"b`}
+
+	syslog, err := OpenLogSink("syslog", "udp://"+collector.LocalAddr().String(), "")
+	if err != nil {
+		t.Fatalf("Failed to open syslog sink: %v", err)
+	}
+	syslog.Emit(logError, "verify.failed", "bin/app: FAILED", fields)
+	msg := receiveUDP(t, collector)
+	if !strings.HasPrefix(msg, "<131>1 ") || !strings.Contains(msg, `[hashculate@32473 event="verify.failed" expected="a\"b" path="bin/app" status="FAILED"] bin/app: FAILED`) {
+		t.Errorf("Unexpected syslog message: %s", msg)
+	}
+
+	gelf, _ := OpenLogSink("gelf", "udp://"+collector.LocalAddr().String(), "")
+	gelf.Emit(logError, "verify.failed", "bin/app: FAILED", fields)
+	var event map[string]any
+	if err := json.Unmarshal([]byte(receiveUDP(t, collector)), &event); err != nil {
+		t.Fatalf("Invalid GELF message: %v", err)
+	}
+	if event["version"] != "1.1" || event["_path"] != "bin/app" || event["level"] != float64(logError) {
+		t.Errorf("Unexpected GELF message: %v", event)
+	}
+
+	var received map[string]any
+	hec := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/services/collector/event" || r.Header.Get("Authorization") != "Splunk token-1" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &received)
+	}))
+	defer hec.Close()
+	splunk, _ := OpenLogSink("splunk-hec", hec.URL, "token-1")
+	splunk.Emit(logInfo, "scan.summary", "3 OK", map[string]any{"ok": 3})
+	if event, _ := received["event"].(map[string]any); event["event"] != "scan.summary" || event["ok"] != float64(3) {
+		t.Errorf("Unexpected HEC event: %v", received)
+	}
+
+	var none *LogSink
+	none.Emit(logInfo, "ignored", "nil sinks discard events", nil)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// torrentPieceLength picks a power-of-two piece length giving at most about 1500 pieces
+func torrentPieceLength(size int64) int64 {
+	pieceLength := int64(v2BlockSize)
+	for pieceLength < 16*1024*1024 && size/pieceLength > 1500 {
+		pieceLength *= 2
+	}
+	return pieceLength
+}
+
+// BuildTorrentInfo hashes a single file into a v1, v2 or hybrid torrent info dictionary
+func BuildTorrentInfo(path string, pieceLength int64, v1, v2 bool) (map[string]any, error) {
+	if pieceLength < v2BlockSize || pieceLength&(pieceLength-1) != 0 {
+		return nil, fmt.Errorf("piece length must be a power of two of at least 16 KiB")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	var pieces []byte
+	var leaves [][]byte
+	var length int64
+	buffer := make([]byte, pieceLength)
+	for {
+		n, err := io.ReadFull(file, buffer)
+		if n > 0 {
+			length += int64(n)
+			if v1 {
+				sum := sha1.Sum(buffer[:n])
+				pieces = append(pieces, sum[:]...)
+			}
+			if v2 {
+				for i := 0; i < n; i += v2BlockSize {
+					sum := sha256.Sum256(buffer[i:min(i+v2BlockSize, n)])
+					leaves = append(leaves, sum[:])
+				}
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+	}
+
+	name := filepath.Base(path)
+	info := map[string]any{"name": name, "piece length": pieceLength}
+	if v1 {
+		info["length"] = length
+		info["pieces"] = pieces
+	}
+	if v2 {
+		entry := map[string]any{"length": length}
+		if length > 0 {
+			entry["pieces root"] = piecesRootV2(leaves, pieceLength)
+		}
+		info["meta version"] = 2
+		info["file tree"] = map[string]any{name: map[string]any{"": entry}}
+	}
+	return info, nil
+}
+
+// piecesRootV2 computes a file's v2 merkle root from its 16 KiB block hashes
+func piecesRootV2(leaves [][]byte, pieceLength int64) []byte {
+	zeroLeaf := make([]byte, sha256.Size)
+	blocksPerPiece := int(pieceLength / v2BlockSize)
+	if len(leaves) <= blocksPerPiece {
+		return merkleRootV2(leaves, nextPowerOfTwo(len(leaves)), zeroLeaf)
+	}
+	var pieceHashes [][]byte
+	for start := 0; start < len(leaves); start += blocksPerPiece {
+		pieceHashes = append(pieceHashes, merkleRootV2(leaves[start:min(start+blocksPerPiece, len(leaves))], blocksPerPiece, zeroLeaf))
+	}
+	padPiece := merkleRootV2(nil, blocksPerPiece, zeroLeaf)
+	return merkleRootV2(pieceHashes, nextPowerOfTwo(len(pieceHashes)), padPiece)
+}
+
+// MagnetLink builds a magnet URI for a hashed file. kind is "urn" for a plain
+// content URN of the result's algorithm, or "btih", "btmh" or "bt" (hybrid) for
+// BitTorrent info-hashes of a single-file torrent with the given piece length.
+func MagnetLink(path string, result *HashResult, kind string, pieceLength int64) (string, error) {
+	var topics []string
+	switch kind {
+	case "urn":
+		hash := result.Hash
+		if result.Algorithm == SHA1 {
+			// Magnet links conventionally carry SHA-1 as base32
+			digest, _ := hex.DecodeString(result.Hash)
+			hash = base32.StdEncoding.EncodeToString(digest)
+		}
+		topics = append(topics, fmt.Sprintf("urn:%s:%s", result.Algorithm, hash))
+	case "btih", "btmh", "bt":
+		if pieceLength == 0 {
+			pieceLength = torrentPieceLength(result.FileSize)
+		}
+		info, err := BuildTorrentInfo(path, pieceLength, kind != "btmh", kind != "btih")
+		if err != nil {
+			return "", err
+		}
+		raw := bencode(info)
+		if kind != "btmh" {
+			sum := sha1.Sum(raw)
+			topics = append(topics, "urn:btih:"+hex.EncodeToString(sum[:]))
+		}
+		if kind != "btih" {
+			sum := sha256.Sum256(raw)
+			topics = append(topics, "urn:btmh:"+hex.EncodeToString(hasher.Multihash(hasher.MultihashSHA2_256, sum[:])))
+		}
+	default:
+		return "", fmt.Errorf("unsupported magnet type: %s. Supported: urn, btih, btmh, bt", kind)
+	}
+
+	var link strings.Builder
+	link.WriteString("magnet:?")
+	for _, topic := range topics {
+		link.WriteString("xt=" + topic + "&")
+	}
+	fmt.Fprintf(&link, "xl=%d&dn=%s", result.FileSize, url.QueryEscape(filepath.Base(result.Filename)))
+	return link.String(), nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMagnetLinkHybridTorrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "release.bin")
+	os.WriteFile(path, bytes.Repeat([]byte("hashculate"), 10000), 0644)
+	result, _ := NewHashCalculator().CalculateFileHash(path, SHA1, nil)
+
+	link, err := MagnetLink(path, result, "bt", 0)
+	if err != nil {
+		t.Fatalf("Failed to build magnet link: %v", err)
+	}
+
+	// The link must name the torrent built from the same info dictionary
+	info, _ := BuildTorrentInfo(path, torrentPieceLength(result.FileSize), true, true)
+	tor, err := ParseTorrent(bencode(map[string]any{"info": info}))
+	if err != nil {
+		t.Fatalf("Failed to parse generated torrent: %v", err)
+	}
+	if !strings.Contains(link, "xt=urn:btih:"+hex.EncodeToString(tor.InfoHashV1())) ||
+		!strings.Contains(link, "xt=urn:btmh:1220"+hex.EncodeToString(tor.InfoHashV2())) {
+		t.Errorf("Magnet link %s does not carry the torrent info-hashes", link)
+	}
+	if report, err := tor.VerifyV1(path); err != nil || len(report.BadPieces()) != 0 {
+		t.Errorf("Generated torrent does not verify its own data: %v", err)
+	}
+
+	urn, _ := MagnetLink(path, result, "urn", 0)
+	if !strings.HasPrefix(urn, "magnet:?xt=urn:sha1:") || !strings.HasSuffix(urn, "&xl=100000&dn=release.bin") {
+		t.Errorf("Unexpected URN magnet link: %s", urn)
+	}
+}
@@ -1,164 +1,208 @@
 package main
 
 import (
-	"crypto/md5"
-	"crypto/sha1"
-	"crypto/sha256"
-	"crypto/sha512"
+	"cmp"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"hash"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
+	"time"
+
+	"hashculate/hasher"
 )
 
 // HashAlgorithm represents the supported hash algorithms
-type HashAlgorithm string
+type HashAlgorithm = hasher.Algorithm
 
 const (
-	MD5    HashAlgorithm = "md5"
-	SHA1   HashAlgorithm = "sha1"
-	SHA256 HashAlgorithm = "sha256"
-	SHA512 HashAlgorithm = "sha512"
+	MD5    = hasher.MD5
+	SHA1   = hasher.SHA1
+	SHA256 = hasher.SHA256
+	SHA512 = hasher.SHA512
+	CIDV1  = hasher.CIDV1
 )
 
 // HashResult contains the result of a hash calculation
 type HashResult struct {
 	Algorithm   HashAlgorithm
 	Hash        string
-	Filename    string
+	Filename    string // Name recorded in outputs, following the calculator's PathFormat
+	Path        string // Input as given, cleaned; the URL of remote inputs
+	Basename    string
 	FileSize    int64
 	ChunkSize   int64
 	Description string
+	Passes      []ReadPass     // Both reads of the source with -double-check
+	Sample      *SampleInfo    // What a -sample screening hash covers
+	Payload     *PayloadInfo   // What a -payload media hash covers
+	Pixels      *PixelInfo     // The image behind a -a pixels hash
+	PDF         *PDFInfo       // What a -pdf canonical hash covers
+	OOXML       *OOXMLInfo     // What an -ooxml content hash covers
+	Parts       []ConcatPart   // The pieces of a split file hashed with -concat
+	UUID        string         // Derived from the digest with -uuid
+	Parameters  *RunParameters // Settings of the run, for JSON reports
 }
 
 // HashCalculator handles file hash calculations
 type HashCalculator struct {
-	ChunkSize int64 // Default 4MB like the HTML version
+	ChunkSize int64          // Default 4MB like the HTML version
+	Readahead int            // Chunks read ahead of hashing; 0 reads synchronously
+	NetFS     bool           // Skip per-file stat calls, which cost a round trip on network shares
+	Stats     *MountStats    // Per-mount throughput, when collected
+	ReadOnly  bool           // Refuse symlinked inputs and leave access times untouched
+	Paths     PathFormat     // How input paths are recorded in results
+	Batch     *BatchProgress // Progress of multi-file runs, used when no callback is given
+	Journal   *ScanJournal   // Files finished by this or an interrupted earlier run
+	FS        fs.FS          // Filesystem files are listed and opened in; nil for the host's
+	Clones    *cloneCache    // Digests of clones and hard links already hashed, when reused
+	Warm      *cacheWarmer   // Reads listed files into the page cache ahead of hashing
+	Jobs      int            // Files CalculateConcurrent hashes at once; 0 for one per CPU
 }
 
 // NewHashCalculator creates a new hash calculator with default chunk size
 func NewHashCalculator() *HashCalculator {
 	return &HashCalculator{
-		ChunkSize: 4 * 1024 * 1024, // 4MB chunks
+		ChunkSize: hasher.DefaultChunkSize, // 4MB chunks
 	}
 }
 
 // createHasher creates the appropriate hash.Hash based on algorithm
 func (hc *HashCalculator) createHasher(algorithm HashAlgorithm) (hash.Hash, error) {
-	switch algorithm {
-	case MD5:
-		return md5.New(), nil
-	case SHA1:
-		return sha1.New(), nil
-	case SHA256:
-		return sha256.New(), nil
-	case SHA512:
-		return sha512.New(), nil
-	default:
-		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
-	}
+	return hasher.New(algorithm)
 }
 
 // formatBytes formats bytes in a human-readable format (similar to HTML version)
 func formatBytes(bytes int64) string {
-	if bytes == 0 {
-		return "0 bytes"
-	}
-
-	// For small files, show bytes; for larger files, show KB
-	if bytes < 1024 {
-		return fmt.Sprintf("%d bytes", bytes)
-	}
-
-	// Convert to KB for consistency with HTML version
-	kb := float64(bytes) / 1024
-	return fmt.Sprintf("%.1f kb (kilobytes)", kb)
+	return hasher.FormatBytes(bytes)
 }
 
 // getAlgorithmName returns the display name for the algorithm
 func getAlgorithmName(algorithm HashAlgorithm) string {
-	switch algorithm {
-	case MD5:
-		return "MD5"
-	case SHA1:
-		return "SHA-1"
-	case SHA256:
-		return "SHA-256"
-	case SHA512:
-		return "SHA-512"
-	default:
-		return "Unknown"
-	}
+	return hasher.Name(algorithm)
 }
 
 // CalculateFileHash calculates the hash of a file using the specified algorithm
 func (hc *HashCalculator) CalculateFileHash(filePath string, algorithm HashAlgorithm, progressCallback func(float64)) (*HashResult, error) {
-	// Open the file
-	file, err := os.Open(filePath)
+	results, err := hc.CalculateFileDigests(filePath, []HashAlgorithm{algorithm}, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// CalculateFileDigests calculates several hashes of a file in a single pass,
+// returning one result per algorithm in the order given
+func (hc *HashCalculator) CalculateFileDigests(filePath string, algorithms []HashAlgorithm, progressCallback func(float64)) ([]*HashResult, error) {
+	hc.Warm.done(filePath)
+	if results, ok := hc.journaledDigests(filePath, algorithms); ok {
+		return results, nil
+	}
+
+	// Open the file, queueing for a descriptor when workers hold them all
+	acquireFile()
+	defer releaseFile()
+	file, err := openRetrying(func() (fs.File, error) {
+		if hc.FS != nil {
+			return hc.FS.Open(filePath)
+		}
+		return hc.openInput(filePath)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
 	}
 	defer file.Close()
 
 	// Get file info
-	fileInfo, err := file.Stat()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+	size := int64(-1)
+	var fileInfo fs.FileInfo
+	if !hc.NetFS || hc.Journal != nil {
+		fileInfo, err = file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file info: %w", err)
+		}
+		size = fileInfo.Size()
 	}
 
-	// Create hasher
-	hasher, err := hc.createHasher(algorithm)
-	if err != nil {
-		return nil, err
+	if progressCallback == nil && hc.Batch != nil {
+		var done func()
+		progressCallback, done = hc.Batch.File(filePath, size)
+		defer done()
 	}
 
-	// Process file in chunks
-	buffer := make([]byte, hc.ChunkSize)
-	var totalRead int64 = 0
-	fileSize := fileInfo.Size()
-
-	for {
-		bytesRead, err := file.Read(buffer)
-		if err != nil && err != io.EOF {
-			return nil, fmt.Errorf("failed to read file: %w", err)
+	// A clone shares its data on disk with a file already hashed, so it is not read again
+	var clone string
+	if f, ok := file.(*os.File); ok {
+		clone = hc.Clones.key(f, size)
+	}
+	started := time.Now()
+	name := hc.Paths.name(filePath, filepath.Base(filePath))
+	results, cloned := hc.Clones.get(clone, algorithms)
+	if cloned {
+		for _, result := range results {
+			result.Filename = name
 		}
-
-		if bytesRead == 0 {
-			break
+		if progressCallback != nil {
+			progressCallback(1)
 		}
-
-		// Update hash with chunk
-		hasher.Write(buffer[:bytesRead])
-		totalRead += int64(bytesRead)
-
-		// Report progress
-		if progressCallback != nil && fileSize > 0 {
-			progress := float64(totalRead) / float64(fileSize)
-			progressCallback(progress)
+	} else {
+		var reader io.Reader = file
+		if hc.Readahead > 0 {
+			reader = newPrefetchReader(file, hc.ChunkSize, hc.Readahead)
 		}
+		results, err = hc.CalculateReaderDigests(reader, name, size, algorithms, progressCallback)
+		if err == nil {
+			hc.Clones.put(clone, results)
+		}
+	}
+	for _, result := range results {
+		result.Path, result.Basename = filepath.Clean(filePath), filepath.Base(filePath)
+	}
+	if err == nil && hc.Stats != nil && !cloned {
+		hc.Stats.Record(filePath, results[0].FileSize, time.Since(started))
 	}
+	if err == nil && hc.Journal != nil {
+		err = hc.Journal.Record(journalEntry(filePath, fileInfo, results))
+	}
+	return results, err
+}
 
-	// Finalize hash
-	hashBytes := hasher.Sum(nil)
-	hashHex := fmt.Sprintf("%x", hashBytes)
+// CalculateReaderDigests hashes a stream in a single pass. size is only used
+// for progress reporting and may be -1 when unknown.
+func (hc *HashCalculator) CalculateReaderDigests(reader io.Reader, filename string, size int64, algorithms []HashAlgorithm, progressCallback func(float64)) ([]*HashResult, error) {
+	// Process file in chunks
+	digests, fileSize, err := hasher.HashReader(reader, algorithms, int(hc.ChunkSize), size, progressCallback)
+	if err != nil {
+		return nil, err
+	}
 
-	// Create description similar to HTML version
-	filename := filepath.Base(filePath)
-	algorithmName := getAlgorithmName(algorithm)
-	description := fmt.Sprintf("\"%s\", with size of %s, and file hash using the hashing algorithm %s has the value : %s.",
-		filename, formatBytes(fileSize), algorithmName, hashHex)
+	results := make([]*HashResult, len(algorithms))
+	for i, algorithm := range algorithms {
+		// Create description similar to HTML version
+		results[i] = &HashResult{
+			Algorithm:   algorithm,
+			Hash:        digests[i].Hash,
+			Filename:    filename,
+			Basename:    filename,
+			FileSize:    fileSize,
+			ChunkSize:   hc.ChunkSize,
+			Description: hasher.Describe(filename, fileSize, algorithm, digests[i].Hash),
+		}
+	}
+	return results, nil
+}
 
-	return &HashResult{
-		Algorithm:   algorithm,
-		Hash:        hashHex,
-		Filename:    filename,
-		FileSize:    fileSize,
-		ChunkSize:   hc.ChunkSize,
-		Description: description,
-	}, nil
+// formatDigest renders a finished digest as hex, or a CID in its string form
+func formatDigest(algorithm HashAlgorithm, digest []byte) string {
+	return hasher.Format(algorithm, digest)
 }
 
 // String returns a string representation of the hash result
@@ -169,63 +213,379 @@ func (hr *HashResult) String() string {
 
 // parseAlgorithm parses algorithm string and returns HashAlgorithm
 func parseAlgorithm(alg string) (HashAlgorithm, error) {
-	switch strings.ToLower(alg) {
-	case "md5":
-		return MD5, nil
-	case "sha1", "sha-1":
-		return SHA1, nil
-	case "sha256", "sha-256":
-		return SHA256, nil
-	case "sha512", "sha-512":
-		return SHA512, nil
-	default:
-		return "", fmt.Errorf("unsupported algorithm: %s. Supported: md5, sha1, sha256, sha512", alg)
-	}
+	return hasher.Parse(alg)
 }
 
 // printUsage prints usage information
 func printUsage() {
 	fmt.Println("Hashculate - File Hash Calculator")
-	fmt.Println("Usage: hashculate [options] <file>")
+	fmt.Println("Usage: hashculate [options] <file|url>")
+	fmt.Println("       hashculate [options] <file|pattern>...   (one result per file)")
+	fmt.Println("       hashculate [options] -r <dir>...          (every file below the directories)")
 	fmt.Println()
 	fmt.Println("Options:")
-	fmt.Println("  -algorithm, -a  Hash algorithm (md5, sha1, sha256, sha512) [default: md5]")
+	fmt.Println("  -algorithm, -a  Hash algorithm (md5, sha1, sha256, sha512, cidv1) [default: md5]")
+	fmt.Println("                  or pixels: SHA-256 of the decoded pixels of a JPEG, PNG or TIFF image")
 	fmt.Println("  -chunk-size, -c Chunk size in MB for processing large files [default: 4]")
 	fmt.Println("  -progress, -p   Show progress during calculation [default: true]")
+	fmt.Println("  -recursive, -r  Hash every file below the directories given, writing each result as it finishes")
+	fmt.Println("  -include, -exclude <patterns> With -recursive, comma-separated patterns of the only files")
+	fmt.Println("                  to hash, or of files and directories to skip; patterns with a / match paths")
+	fmt.Println("                  relative to the directory given, others names at any depth")
+	fmt.Println("  -skip-symlinks  With -recursive, skip links to files (links to directories are never followed)")
+	fmt.Println("  -skip-hidden    With -recursive, skip dot files and directories, and hidden files on Windows")
+	fmt.Println("  -jobs <n>       Files to hash at once in text and json runs of several files; results keep")
+	fmt.Println("                  the order of the files given or walked [default: one per CPU]")
+	fmt.Println("  -output <fmt>   Output format: text, json, spdx (file checksums of a directory),")
+	fmt.Println("                  markdown (release-notes checksum table of files/dirs),")
+	fmt.Println("                  rclone (rclone hashsum listing of files/dirs),")
+	fmt.Println("                  parquet (one row per file of files/dirs, for DuckDB/Spark),")
+	fmt.Println("                  sums (sha256sum/md5sum manifest of files/dirs) [default: text];")
+	fmt.Println("                  a checksum file name such as checksums.sha256 or SHA256SUMS writes sums to it")
+	fmt.Println("  -binary         With sums output, mark files with *, as sha256sum -b does")
+	fmt.Println("  -backups <n>    Keep this many copies of a checksum file -output replaces as <file>.1 …")
+	fmt.Println("  -check <file>   Verify the files a checksum manifest lists, as sha256sum -c does, printing")
+	fmt.Println("                  OK, FAILED or MISSING per file and a summary; exits 1 unless all verify.")
+	fmt.Println("                  JSON reports are verified with the algorithm and digest mode they record,")
+	fmt.Println("                  databases and rollup manifests with their chunk size; GNU and BSD lines")
+	fmt.Println("                  record no settings")
+	fmt.Println("  -quiet          With -check, only print files that did not verify")
+	fmt.Println("  -ignore-missing With -check, leave out listed files that do not exist")
+	fmt.Println("  -chain <log>    Append the result to a tamper-evident chain log")
+	fmt.Println("  -timestamp      Request an RFC 3161 timestamp token for the digest")
+	fmt.Println("  -tsa-url <url>  Timestamp authority URL [default: https://freetsa.org/tsr]")
+	fmt.Println("  -tsa-ca <pem>   Trusted TSA root certificates (PEM)")
+	fmt.Println("  -tsr <path>     Where to store the timestamp token [default: <file>.tsr]")
+	fmt.Println("  -ots            Anchor the digest with OpenTimestamps into <file>.ots")
+	fmt.Println("  -ots-calendar   Comma-separated OpenTimestamps calendar URLs")
+	fmt.Println("  -attest <path>  Write an in-toto statement (SLSA provenance) for the file")
+	fmt.Println("  -sidecar        Write the digest to <file>.<algorithm> (app.iso.sha256) next to the file")
+	fmt.Println("  -builder-id     Builder ID recorded in the provenance")
+	fmt.Println("  -predicate      JSON file to use as a custom predicate (with -predicate-type)")
+	fmt.Println("  -remote-user    User for ftp://, sftp:// and webdav(s):// inputs")
+	fmt.Println("  -remote-password Password for ftp:// and webdav(s)://, or a gs:// access token [default: $HASHCULATE_REMOTE_PASSWORD]")
+	fmt.Println("  -identity <key> SSH private key for sftp:// (ssh-agent is used otherwise)")
+	fmt.Println("  -netfs          Tune for SMB/NFS: 16 MB chunks, read-ahead, fewer stat calls,")
+	fmt.Println("                  and per-mount throughput stats")
+	fmt.Println("  -clones         Read the data of APFS/Btrfs/XFS clones and hard links once in multi-file runs")
+	fmt.Println("  -log-sink <type> Ship events to syslog, gelf or splunk-hec (also for verify commands)")
+	fmt.Println("  -log-target     Log sink address (udp://host:port, tcp://host:port) or HEC URL")
+	fmt.Println("  -log-token      Splunk HEC token [default: $HASHCULATE_LOG_TOKEN]")
+	fmt.Println("  -magnet <type>  Print a magnet link: urn, btih, btmh, bt (hybrid v1+v2)")
+	fmt.Println("  -piece-length   Torrent piece length in KB for BitTorrent magnets [default: auto]")
+	fmt.Println("  -truncate <n>   Show only the first n hex characters of the digest")
+	fmt.Println("  -uri ni|hash    Show the digest as an RFC 6920 ni:///sha-256;... URI or a hash://sha256/...")
+	fmt.Println("                  URL; -expect takes either form too")
+	fmt.Println("  -uuid v5|v3     Also show a UUID derived from the digest's hash:// URL, with SHA-1 (v5)")
+	fmt.Println("                  or MD5 (v3), in the -uuid-namespace <uuid|dns|url|oid|x500> [default: url]")
+	fmt.Println("  -multihash <base> Show the digest as a multihash in a multibase: base58btc, base32,")
+	fmt.Println("                  base32upper, base16, base16upper, base64, base64pad, base64url, base64urlpad")
+	fmt.Println("  -expect <hash>  Fail unless the digest matches")
+	fmt.Println("  -replay <report.json> Verify the file of a JSON report with the algorithm, chunk size, mode")
+	fmt.Println("                  and path mode it records; flags given as well win and are reported as drift")
+	fmt.Println("  -record-host    Record the hostname in the parameters of JSON reports")
+	fmt.Println("  -prefix-match   Let -expect be a digest prefix (at least 6 characters)")
+	fmt.Println("  -readonly-assert Open inputs read-only without following symlinks or updating atime,")
+	fmt.Println("                  and refuse outputs that would write to or next to them")
+	fmt.Println("  -landlock       With -readonly-assert, confine the process with Landlock (Linux)")
+	fmt.Println("  -double-check   Read the source a second time and fail unless both passes match")
+	fmt.Println("  -acquisition-log <path> Write a forensic acquisition log (case, source, times, hashes)")
+	fmt.Println("  -case-file      YAML file with a case: block for the acquisition log")
+	fmt.Println("  -case-number, -evidence-number, -examiner, -case-notes")
+	fmt.Println("                  Case details for the acquisition log (override -case-file)")
+	fmt.Println("  -path-mode <m>  Record input paths as relative, absolute or basename [default: base name")
+	fmt.Println("                  of files, paths inside a directory relative to it]")
+	fmt.Println("  -base <dir>     Directory relative paths start from [default: working directory]")
+	fmt.Println("  -pdf            Hash PDFs with dates, document IDs and incremental update trailers")
+	fmt.Println("                  normalized, reporting the raw file hash as well")
+	fmt.Println("  -resume-journal <file> With spdx, markdown, rclone, parquet and sums output, journal finished")
+	fmt.Println("                  files so a run that crashed skips them when started again; removed once complete")
+	fmt.Println("  -no-prescan     With spdx, markdown, rclone, parquet and sums output, start at once instead of")
+	fmt.Println("                  totalling the size of all files first; progress then shows bytes done")
+	fmt.Println("                  without a total")
+	fmt.Println("  -stat-workers <n> Stat this many files at once while totalling sizes [default: 1]")
+	fmt.Println("  -warm-cache     In multi-file runs, read files into the page cache a little ahead of")
+	fmt.Println("                  hashing them, so a spinning disk serves many small files with fewer seeks")
+	fmt.Println("  -concat         Hash split files as one stream: list the parts, give a pattern such as")
+	fmt.Println("                  'file.7z.*', or the first part (file.001, file.part1) to find the rest")
+	fmt.Println("  -ooxml          Hash the members of docx, xlsx and pptx files in canonical order, ignoring")
+	fmt.Println("                  zip timestamps and compression; the raw file hash is reported as well")
+	fmt.Println("  -payload        Hash only the audio/video payload of MP3, FLAC, MP4 and Matroska files,")
+	fmt.Println("                  so re-tagged copies compare equal")
+	fmt.Println("  -sample <n>     Screening hash over the size and the first, middle and last n MB only;")
+	fmt.Println("                  for quick triage, not proof that files are identical")
+	fmt.Println("  -follow         Hash the file as it grows (like tail -f), printing rolling digests")
+	fmt.Println("  -follow-bytes <n> With -follow, print a digest at every multiple of n bytes")
+	fmt.Println("  -follow-interval <d> With -follow, print a digest every d (e.g. 30s) [default: 10s]")
+	fmt.Println("  -bell           Ring the terminal bell when done (three times on failure), or play the")
+	fmt.Println("                  system sound without a terminal; also works with every command")
+	fmt.Println("  -deterministic  Leave times, durations, hostnames and absolute paths out of outputs")
+	fmt.Println("  -encrypt-to     Encrypt json/spdx/markdown output and -attest files to age (age1...) or PGP")
+	fmt.Println("                  recipients, comma-separated")
 	fmt.Println("  -help, -h       Show this help message")
 	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  verify-chain <log|s3://bucket/prefix/>  Verify every link of a chain log")
+	fmt.Println("  verify-timestamp <file> <token.tsr|proof.ots>")
+	fmt.Println("                      Verify that a timestamp token or proof covers a file")
+	fmt.Println("  verify-attestation <artifact> -trusted-root <json> -certificate-identity <id>")
+	fmt.Println("                      -certificate-oidc-issuer <url>")
+	fmt.Println("                      Verify a Sigstore bundle signs the artifact digest")
+	fmt.Println("  sbom verify <sbom.json> [-root <dir>] [-report html|worm <target>]")
+	fmt.Println("                      Verify SPDX/CycloneDX file checksums against disk")
+	fmt.Println("  manifest create <dir> [-o manifest.json] | verify <manifest.json> [-root <dir>] [-cache]")
+	fmt.Println("  manifest prove <manifest.json> <path> | check-proof <proof.json> -root <digest> [-file <path>]")
+	fmt.Println("                      Record files with per-directory rollup digests; verify, skipping")
+	fmt.Println("                      unchanged subtrees")
+	fmt.Println("  checkpoint keygen <key.pem> | append <log> -key <key.pem> | verify <log> -key <key.pem.pub>")
+	fmt.Println("                      Sign checkpoints of an append-only log and detect later rewriting")
+	fmt.Println("  tree <dir> -check <manifest> [-problems] [-scrub] [-report html|worm <target>]")
+	fmt.Println("                      Show a directory tree with ok/changed/new/missing per file")
+	fmt.Println("  gh-verify <owner/repo@tag> -asset <name> [-file <path>] [-require-signature]")
+	fmt.Println("                      Verify a release asset against the release's SHASUMS and signature")
+	fmt.Println("  pkg-hash <url|file> [-format homebrew|scoop|nix-sri|nix-base32]")
+	fmt.Println("                      Print the SHA-256 as package manifests spell it")
+	fmt.Println("  locate-corruption <good> <bad> [-block <KB>]")
+	fmt.Println("                      Report the byte ranges where a damaged copy differs")
+	fmt.Println("  disc hash <image|device> | compare <device> <image> [-retries <n>]")
+	fmt.Println("                      Hash an ISO 9660 image and its files, or check a burned disc by sector")
+	fmt.Println("  sidecar write|verify <path>... | mv <old> <new>")
+	fmt.Println("                      Write or verify <file>.sha256 sidecars, or move a file with its sidecars")
+	fmt.Println("  cloud verify <s3|gs|b2://bucket/prefix> -manifest <file> [-jobs <n>] [-resume <journal>]")
+	fmt.Println("                      Stream every object under a prefix and verify it against a manifest")
+	fmt.Println("  estimate <path>... [-a <algorithms>] [-time <duration>]")
+	fmt.Println("                      Sample read and hash speed and predict how long a full hash takes")
+	fmt.Println("  query -db <db.json> \"size > 1GB and changed since '2024-01-01'\" [-format <fmt>]")
+	fmt.Println("                      List database entries matching a filter")
+	fmt.Println("  db add|export|import <db.json> ... [-encrypt-to <recipients>]")
+	fmt.Println("                      Record hashes in a database; export/import csv, ndjson, hashdeep;")
+	fmt.Println("                      export parquet")
+	fmt.Println("  db diff -from <snap1.json> -to <snap2.json> [-filter \"<query>\"] [-output json]")
+	fmt.Println("                      Report files added, removed, changed and moved between two scans")
+	fmt.Println("  db vacuum <db.json> [-expire 30d] [-keep <n>] [-missing] [-dry-run]")
+	fmt.Println("                      Drop expired entries of deleted files and old snapshots")
+	fmt.Println("  config check fim|serve [<flags>] | <config.yaml>")
+	fmt.Println("                      Validate config files and print the effective settings and their sources")
+	fmt.Println("  scan <drive|dir>... [-o scan.json] [-exclude-system] [-exclude <patterns>] [-follow]")
+	fmt.Println("                      Record every file of a drive in a hash database, e.g. scan C:\\ -exclude-system")
+	fmt.Println("  fim [-config fim.yaml] [-once] [-group <name>] [-health <addr>]")
+	fmt.Println("                      Monitor paths and report files added, removed or modified; SIGHUP reloads the policy")
+	fmt.Println("  torrent verify <file.torrent> [-data <dir>]")
+	fmt.Println("                      Check downloaded data against the torrent's piece hashes")
+	fmt.Println("  cid [-cid-version 0|1] [-chunker size-<bytes>] <file|dir>...")
+	fmt.Println("                      Compute the IPFS CIDs `ipfs add` would assign")
+	fmt.Println("  torrent infohash <file.torrent>")
+	fmt.Println("                      Print the v1/v2 info-hashes of a torrent")
+	fmt.Println("  serve [-config serve.yaml] [-listen <addr>]")
+	fmt.Println("                      Run a REST hashing service with API keys, mTLS and rate limits")
+	fmt.Println("  service install|uninstall [-name <name>] [-socket <addr>] serve|fim [flags]")
+	fmt.Println("                      Register serve or fim as a systemd unit or Windows service")
+	fmt.Println("  ci verify-artifacts -manifest <checksums.txt> [-glob 'dist/*'] [-format github|plain]")
+	fmt.Println("                      Gate a pipeline on build artifacts matching their checksums")
+	fmt.Println("  k8s-verify [-strict] <dir>=<manifest>...")
+	fmt.Println("                      Gate a pod on its volumes matching their manifests, logging JSON events")
+	fmt.Println("  health [-timeout 5s] [url]")
+	fmt.Println("                      Exit 0 when a service's /healthz answers, for container health checks")
+	fmt.Println()
+	fmt.Println("Every flag can also be set as HASHCULATE_<FLAG>, or HASHCULATE_<COMMAND>_<FLAG> for a command")
+	fmt.Println("(e.g. HASHCULATE_SERVE_LISTEN=:8080). Flags on the command line take precedence.")
+	fmt.Println()
 	fmt.Println("Examples:")
 	fmt.Println("  hashculate myfile.txt")
 	fmt.Println("  hashculate -algorithm sha256 myfile.txt")
 	fmt.Println("  hashculate -a sha512 -c 8 largefile.bin")
+	fmt.Println("  hashculate -a sha256 -chain audit.log evidence.img")
+	fmt.Println("  hashculate -output spdx ./dist > files.spdx.json")
+	fmt.Println("  hashculate -output markdown dist/*.tar.gz")
+	fmt.Println("  hashculate -magnet bt release.iso")
+	fmt.Println("  hashculate -a sha256 -output json https://example.com/release.tar.gz")
+	fmt.Println("  hashculate -output spdx -encrypt-to age1... ./dist > files.spdx.json.age")
+}
+
+// commands maps subcommand names to their implementations
+var commands = map[string]func(args []string) int{
+	"verify-chain":       runVerifyChain,
+	"verify-timestamp":   runVerifyTimestamp,
+	"verify-attestation": runVerifyAttestation,
+	"sbom":               runSBOM,
+	"torrent":            runTorrent,
+	"cid":                runCID,
+	"db":                 runDB,
+	"fim":                runFIM,
+	"scan":               runScan,
+	"config":             runConfig,
+	"serve":              runServe,
+	"tree":               runTree,
+	"gh-verify":          runGHVerify,
+	"pkg-hash":           runPkgHash,
+	"locate-corruption":  runLocateCorruption,
+	"manifest":           runManifest,
+	"checkpoint":         runCheckpoint,
+	"disc":               runDisc,
+	"estimate":           runEstimate,
+	"sidecar":            runSidecar,
+	"cloud":              runCloud,
+	"query":              runQuery,
+	"service":            runService,
+	"health":             runHealth,
+	"k8s-verify":         runK8sVerify,
+	"ci":                 runCI,
+}
+
+// parseFlags parses a subcommand's flags, allowing them before or after positional arguments
+// and taking flags that were not given from HASHCULATE_<COMMAND>_<FLAG> variables
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	positional := parseArgs(fs, args)
+	if err := applyEnv(fs, fs.Name()); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	return positional
+}
+
+// parseArgs parses flags given before or after positional arguments and returns the positionals
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
 }
 
 // progressBar displays a simple progress bar
 func progressBar(progress float64) {
+	drawProgressBar(progress, "")
+}
+
+// progressInterval is how often the progress bar with a time estimate is redrawn
+const progressInterval = 100 * time.Millisecond
+
+// progressETA displays the progress bar with the time left, once it can be estimated
+func progressETA(p hasher.Progress) {
+	suffix := ""
+	if eta := p.ETA.Round(time.Second); eta > 0 {
+		suffix = fmt.Sprintf(", %s left", eta)
+	}
+	// Padded so a shorter estimate blanks the end of a longer one
+	drawProgressBar(p.Fraction, fmt.Sprintf("%-16s", suffix))
+}
+
+// drawProgressBar redraws the progress line, ending it once complete
+func drawProgressBar(progress float64, suffix string) {
+	progress = min(max(progress, 0), 1)
 	barWidth := 50
 	filled := int(progress * float64(barWidth))
 	bar := strings.Repeat("=", filled) + strings.Repeat("-", barWidth-filled)
 	percentage := int(progress * 100)
-	fmt.Printf("\rProgress: [%s] %d%%", bar, percentage)
+	fmt.Printf("\rProgress: [%s] %d%%%s", bar, percentage, suffix)
 	if progress >= 1.0 {
 		fmt.Println()
 	}
 }
 
 func main() {
+	// Dispatch subcommands before parsing hashing flags
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			args, bell := bellFlag(os.Args[2:])
+			code := command(args)
+			if bell {
+				ringBell(code != 0)
+			}
+			os.Exit(code)
+		}
+	}
+
 	// Define command line flags
 	var (
-		algorithm     = flag.String("algorithm", "md5", "Hash algorithm (md5, sha1, sha256, sha512)")
-		algShort      = flag.String("a", "md5", "Hash algorithm (short)")
-		chunkSize     = flag.Int("chunk-size", 4, "Chunk size in MB")
-		chunkShort    = flag.Int("c", 4, "Chunk size in MB (short)")
-		showProgress  = flag.Bool("progress", true, "Show progress")
-		progressShort = flag.Bool("p", true, "Show progress (short)")
-		help          = flag.Bool("help", false, "Show help")
-		helpShort     = flag.Bool("h", false, "Show help (short)")
+		algorithm      = flag.String("algorithm", "md5", "Hash algorithm (md5, sha1, sha256, sha512)")
+		algShort       = flag.String("a", "md5", "Hash algorithm (short)")
+		chunkSize      = flag.Int("chunk-size", 4, "Chunk size in MB")
+		chunkShort     = flag.Int("c", 4, "Chunk size in MB (short)")
+		showProgress   = flag.Bool("progress", true, "Show progress")
+		progressShort  = flag.Bool("p", true, "Show progress (short)")
+		help           = flag.Bool("help", false, "Show help")
+		helpShort      = flag.Bool("h", false, "Show help (short)")
+		output         = flag.String("output", "text", "Output format (text, json, spdx, markdown, rclone, parquet, sums) or a checksum file to write")
+		chainLog       = flag.String("chain", "", "Append result to a tamper-evident chain log")
+		timestamp      = flag.Bool("timestamp", false, "Request an RFC 3161 timestamp for the digest")
+		tsaURL         = flag.String("tsa-url", "https://freetsa.org/tsr", "Timestamp authority URL")
+		tsaCA          = flag.String("tsa-ca", "", "PEM file with trusted TSA root certificates")
+		tsrPath        = flag.String("tsr", "", "Path to store the timestamp token")
+		otsStamp       = flag.Bool("ots", false, "Anchor the digest with OpenTimestamps")
+		otsCalendars   = flag.String("ots-calendar", strings.Join(defaultOTSCalendars, ","), "OpenTimestamps calendar URLs")
+		attestPath     = flag.String("attest", "", "Write an in-toto attestation with the file as subject")
+		builderID      = flag.String("builder-id", defaultBuilderID, "Builder ID recorded in SLSA provenance")
+		predicatePath  = flag.String("predicate", "", "JSON file used as attestation predicate")
+		predicateType  = flag.String("predicate-type", "", "Predicate type URI for -predicate")
+		magnet         = flag.String("magnet", "", "Print a magnet link (urn, btih, btmh, bt)")
+		remoteUser     = flag.String("remote-user", "", "User for ftp://, sftp:// and WebDAV/HTTP inputs")
+		remotePass     = flag.String("remote-password", "", "Password for ftp:// and WebDAV/HTTP inputs [default: $HASHCULATE_REMOTE_PASSWORD]")
+		identity       = flag.String("identity", "", "SSH private key for sftp:// inputs")
+		netfs          = flag.Bool("netfs", false, "Tune reads for SMB/NFS shares and report per-mount throughput")
+		clones         = flag.Bool("clones", false, "Hash files that share their data on disk (clones, hard links) once")
+		warmCache      = flag.Bool("warm-cache", false, "Read files into the page cache a little ahead of hashing them in multi-file runs")
+		statWorkers    = flag.Int("stat-workers", 1, "Files stated at once while totalling the size of a multi-file run")
+		pieceLength    = flag.Int("piece-length", 0, "Torrent piece length in KB for -magnet bt* [default: auto]")
+		encryptTo      = flag.String("encrypt-to", "", "Encrypt reports to age or PGP recipients (comma-separated)")
+		truncate       = flag.Int("truncate", 0, "Print only the first N hex characters of the digest")
+		uriScheme      = flag.String("uri", "", "Print the digest as an RFC 6920 ni URI (ni) or a hash:// URL (hash)")
+		uuidVersion    = flag.String("uuid", "", "Also print a UUID derived from the digest: v5 (SHA-1) or v3 (MD5)")
+		uuidNamespace  = flag.String("uuid-namespace", "url", "Namespace of -uuid: a UUID, or dns, url, oid or x500")
+		multihashBase  = flag.String("multihash", "", "Print the digest as a multihash in this multibase (base58btc, base32, base16, base64url, ...)")
+		expect         = flag.String("expect", "", "Expected digest; exit with an error when it does not match")
+		prefixMatch    = flag.Bool("prefix-match", false, "Let -expect be a prefix of the digest")
+		readOnly       = flag.Bool("readonly-assert", false, "Open inputs read-only without following symlinks and refuse writes near them")
+		landlock       = flag.Bool("landlock", false, "With -readonly-assert, confine the process with Landlock (Linux)")
+		doubleCheck    = flag.Bool("double-check", false, "Read the source twice and confirm both passes match")
+		acquisitionLog = flag.String("acquisition-log", "", "Write a forensic acquisition log to this path")
+		caseFile       = flag.String("case-file", "", "YAML file with a case: block (case-number, examiner, ...)")
+		caseNumber     = flag.String("case-number", "", "Case number recorded in the acquisition log")
+		evidenceNumber = flag.String("evidence-number", "", "Evidence number recorded in the acquisition log")
+		examiner       = flag.String("examiner", "", "Examiner recorded in the acquisition log")
+		caseNotes      = flag.String("case-notes", "", "Notes recorded in the acquisition log")
+		pathMode       = flag.String("path-mode", "", "Record input paths as relative, absolute or basename")
+		pathBase       = flag.String("base", "", "Directory -path-mode relative paths start from")
+		follow         = flag.Bool("follow", false, "Hash the file as it grows and print rolling digests until interrupted")
+		followBytes    = flag.Int64("follow-bytes", 0, "With -follow, print a digest at every multiple of this many bytes")
+		payload        = flag.Bool("payload", false, "Hash only the audio/video payload of MP3, FLAC, MP4 and Matroska files")
+		canonicalPDF   = flag.Bool("pdf", false, "Hash PDFs with dates, document IDs and incremental update trailers normalized")
+		resumeJournal  = flag.String("resume-journal", "", "Journal finished files of an spdx or markdown run to this file, skipping those it already holds")
+		noPrescan      = flag.Bool("no-prescan", false, "Start multi-file runs at once, without totalling their size for the progress display")
+		concat         = flag.Bool("concat", false, "Hash the parts of a split file (list, pattern or first numbered part) as one stream")
+		ooxml          = flag.Bool("ooxml", false, "Hash the members of docx, xlsx and pptx files in canonical order, ignoring zip details")
+		sample         = flag.Int("sample", 0, "Screening hash over the size and the first, middle and last N MB only")
+		followInterval = flag.Duration("follow-interval", 0, "With -follow, print a digest when data arrived and this much time passed [default: 10s]")
+		writeSidecar   = flag.Bool("sidecar", false, "Write the digest to <file>.<algorithm> next to the file, as sha256sum does")
+		recursive      = flag.Bool("recursive", false, "Hash every file below the directories given, writing each result as it finishes")
+		recursiveShort = flag.Bool("r", false, "Hash every file below the directories given (short)")
+		includeList    = flag.String("include", "", "With -recursive, comma-separated patterns of the only files to hash")
+		excludeList    = flag.String("exclude", "", "With -recursive, comma-separated patterns of files and directories to skip")
+		skipSymlinks   = flag.Bool("skip-symlinks", false, "With -recursive, skip symbolic links to files")
+		skipHidden     = flag.Bool("skip-hidden", false, "With -recursive, skip dot files and directories, and hidden files on Windows")
+		jobs           = flag.Int("jobs", runtime.GOMAXPROCS(0), "Files to hash at once in text and json runs of several files, written in the order given")
+		checkFile      = flag.String("check", "", "Verify the files a checksum manifest lists, as sha256sum -c does")
+		quiet          = flag.Bool("quiet", false, "With -check, only print files that did not verify")
+		ignoreMissing  = flag.Bool("ignore-missing", false, "With -check, leave out listed files that do not exist")
+		binaryMode     = flag.Bool("binary", false, "With sums output, mark files with *, as sha256sum -b does")
+		backups        = flag.Int("backups", 0, "Keep this many copies of a checksum file -output replaces as <file>.1 …")
+		replay         = flag.String("replay", "", "Verify the file of a JSON report with the settings it records")
+		recordHost     = flag.Bool("record-host", false, "Record the hostname in the parameters of JSON reports")
 	)
+	bell := flag.Bool("bell", false, "Ring the terminal bell when hashing finishes, three times on failure")
+	flag.BoolVar(&deterministic, "deterministic", false, "Leave times, durations, hostnames and absolute paths out of outputs")
+	logFlags := registerLogSinkFlags(flag.CommandLine)
 
 	flag.Parse()
+	if err := applyEnv(flag.CommandLine, ""); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Show help if requested
 	if *help || *helpShort {
@@ -233,15 +593,82 @@ func main() {
 		return
 	}
 
-	// Get file path from arguments
+	// A report's recorded settings stand in for flags not given, and its digest for -expect
+	var replayed *JSONReport
+	if *replay != "" {
+		explicit := map[string]bool{}
+		flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+		var err error
+		if replayed, err = loadReplay(*replay); err == nil {
+			err = replayFlags(flag.CommandLine, replayed, explicit)
+		}
+		if err != nil {
+			fmt.Printf("Error: -replay: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// A checksum manifest is verified on its own, like sha256sum -c
+	if *checkFile != "" {
+		if len(flag.Args()) > 0 {
+			fmt.Println("Error: -check verifies the files the manifest lists and takes no other files")
+			os.Exit(1)
+		}
+		opts := CheckOptions{Quiet: *quiet, IgnoreMissing: *ignoreMissing}
+		// An algorithm given with -a takes precedence over one guessed from the name or digest length
+		var err error
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "algorithm" || f.Name == "a" {
+				opts.Algorithm, err = parseAlgorithm(f.Value.String())
+			}
+		})
+		if err != nil || opts.Algorithm == CIDV1 {
+			fmt.Println("Error: -check verifies md5, sha1, sha256 or sha512 digests")
+			os.Exit(1)
+		}
+		os.Exit(CheckChecksums(os.Stdout, *checkFile, NewHashCalculator(), opts))
+	}
+	if *quiet || *ignoreMissing {
+		fmt.Println("Error: -quiet and -ignore-missing apply to -check")
+		os.Exit(1)
+	}
+
+	// An -output naming a checksum file, such as checksums.sha256, writes a GNU manifest to it
+	sumsFile, sumsAlgorithm := "", HashAlgorithm("")
+	if implied, ok := checksumOutputFile(*output); ok {
+		sumsFile, sumsAlgorithm, *output = *output, implied, "sums"
+		explicit := false
+		flag.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "algorithm" || f.Name == "a" })
+		if !explicit {
+			flag.Set("algorithm", string(sumsAlgorithm))
+		}
+	}
+
+	// Listings of every file below the inputs go to stdout as one document
+	listing := *output == "spdx" || *output == "markdown" || *output == "rclone" || *output == "parquet" || *output == "sums"
+
+	// Get file paths from arguments; patterns are expanded where the shell did not
 	args := flag.Args()
-	if len(args) != 1 {
-		fmt.Println("Error: Please specify exactly one file to hash")
+	if replayed != nil && len(args) == 0 {
+		args = []string{cmp.Or(replayed.Path, replayed.File)}
+	}
+	if !*concat {
+		var err error
+		if args, err = expandGlobs(args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(args) == 0 || (len(args) > 1 && *output == "spdx") {
+		fmt.Println("Error: Please specify a file to hash, or one directory for -output spdx")
 		fmt.Println()
 		printUsage()
 		os.Exit(1)
 	}
 
+	// Several files hashed to text or json get one result each, as do the files below a directory with -recursive
+	walkTree := *recursive || *recursiveShort
+	batch := (len(args) > 1 || walkTree) && !listing && !*concat
 	filePath := args[0]
 
 	// Use short flags if provided, otherwise use long flags
@@ -256,8 +683,25 @@ func main() {
 	}
 
 	selectedProgress := *showProgress
-	if flag.Lookup("p").Value.String() != "true" {
-		selectedProgress = *progressShort
+	if flag.Lookup("p").Value.String() != "true" || deterministic {
+		selectedProgress = *progressShort && !deterministic
+	}
+
+	// The progress line is redrawn in place, so logs and pipes get none unless asked for
+	progressTo := os.Stdout
+	if listing || batch {
+		progressTo = os.Stderr
+	}
+	if !isTerminal(progressTo) {
+		asked := false
+		flag.Visit(func(f *flag.Flag) { asked = asked || f.Name == "progress" || f.Name == "p" })
+		selectedProgress = selectedProgress && asked
+	}
+
+	// Pixel hashes are SHA-256 over decoded image data
+	pixels := strings.EqualFold(selectedAlgorithm, pixelsAlgorithm)
+	if pixels {
+		selectedAlgorithm = string(SHA256)
 	}
 
 	// Parse algorithm
@@ -267,44 +711,1001 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Reports record what kind of digest they hold; a replay must compute the same kind
+	params := newRunParameters([]HashAlgorithm{hashAlg}, 0, *recordHost)
+	switch {
+	case pixels:
+		params.Mode = pixelsAlgorithm
+	case *canonicalPDF:
+		params.Mode = "pdf"
+	case *ooxml:
+		params.Mode = "ooxml"
+	case *payload:
+		params.Mode = "payload"
+	case *sample > 0:
+		params.Mode, params.SampleMB = "sample", *sample
+	case *concat:
+		params.Mode = "concat"
+	}
+	if replayed != nil && replayed.Parameters.digest() != params.digest() {
+		fmt.Printf("Error: -replay: the report holds a %s digest, but the flags given ask for %s\n", replayed.Parameters.digest(), params.digest())
+		os.Exit(1)
+	}
+
+	// Timestamps and proofs cover raw digests, which a CID does not expose as hex
+	if hashAlg == CIDV1 && (*timestamp || *otsStamp) {
+		fmt.Println("Error: -timestamp and -ots require a hex digest algorithm, not cidv1")
+		os.Exit(1)
+	}
+
+	// Short digests are for display and lookup only, so say what they give up
+	if *truncate < 0 || (*truncate > 0 && hashAlg == CIDV1) {
+		fmt.Println("Error: -truncate takes a positive number of hex characters and no cidv1")
+		os.Exit(1)
+	}
+	if *uriScheme != "" {
+		if *truncate > 0 {
+			fmt.Println("Error: -uri prints the whole digest and cannot be combined with -truncate")
+			os.Exit(1)
+		}
+		if _, err := digestURI(hashAlg, "", *uriScheme); err != nil {
+			fmt.Printf("Error: -uri: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *multihashBase != "" {
+		if *truncate > 0 || *uriScheme != "" {
+			fmt.Println("Error: -multihash prints the whole digest and cannot be combined with -truncate or -uri")
+			os.Exit(1)
+		}
+		if hashAlg == CIDV1 {
+			fmt.Println("Error: -multihash: a cidv1 holds a multihash already")
+			os.Exit(1)
+		}
+		if _, err := hasher.FormatMultihash(hashAlg, "", *multihashBase); err != nil {
+			fmt.Printf("Error: -multihash: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	var uuidSpace [16]byte
+	version := 0
+	if *uuidVersion != "" {
+		if version, err = parseUUIDVersion(*uuidVersion); err == nil {
+			uuidSpace, err = parseUUID(*uuidNamespace)
+		}
+		if err == nil && hashAlg == CIDV1 {
+			err = fmt.Errorf("a cidv1 has no hex digest to derive a UUID from")
+		}
+		if err != nil {
+			fmt.Printf("Error: -uuid: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if algorithm, digest, ok, err := parseDigestURI(*expect); ok {
+		if err == nil && algorithm != hashAlg {
+			err = fmt.Errorf("%s names %s, but -a is %s", *expect, getAlgorithmName(algorithm), getAlgorithmName(hashAlg))
+		}
+		if err != nil {
+			fmt.Printf("Error: -expect: %v\n", err)
+			os.Exit(1)
+		}
+		*expect = digest
+	}
+	if *prefixMatch && len(strings.TrimSpace(*expect)) < minPrefixLength {
+		fmt.Printf("Error: -prefix-match needs an -expect digest of at least %d characters\n", minPrefixLength)
+		os.Exit(1)
+	}
+	if *expect != "" {
+		if err := checkDigestLength(hashAlg, *expect, *prefixMatch); err != nil {
+			fmt.Printf("Error: -expect: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *truncate > 0 {
+		fmt.Fprintln(os.Stderr, truncationWarning(*truncate))
+	}
+
+	// Truncation and URIs only change what is shown; timestamps, proofs and logs keep the full digest
+	show := func(result *HashResult) HashResult {
+		shown := *result
+		switch {
+		case *truncate > 0:
+			shown.Hash = truncateDigest(result.Hash, *truncate)
+		case *uriScheme != "":
+			shown.Hash, _ = digestURI(result.Algorithm, result.Hash, *uriScheme)
+		case *multihashBase != "":
+			shown.Hash, _ = hasher.FormatMultihash(result.Algorithm, result.Hash, *multihashBase)
+		}
+		shown.Description = strings.Replace(result.Description, result.Hash, shown.Hash, 1)
+		if version != 0 {
+			shown.UUID = digestUUID(version, uuidSpace, result.Algorithm, result.Hash)
+		}
+		shown.Parameters = params
+		return shown
+	}
+
+	// Downstream verification may need more than the base name of the input
+	paths := PathFormat{Base: *pathBase}
+	if paths.Mode, err = parsePathMode(*pathMode); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if paths.Base != "" {
+		if paths.Mode == PathModeDefault {
+			paths.Mode = PathModeRelative
+		}
+		if paths.Mode != PathModeRelative {
+			fmt.Println("Error: -base applies to -path-mode relative")
+			os.Exit(1)
+		}
+	}
+	if paths.Mode == PathModeAbsolute && deterministic {
+		fmt.Println("Error: -path-mode absolute records the location of the input and cannot be -deterministic")
+		os.Exit(1)
+	}
+	if *recordHost && deterministic {
+		fmt.Println("Error: -record-host records where the file was hashed and cannot be -deterministic")
+		os.Exit(1)
+	}
+
+	// The chunk is a single buffer, which a 32-bit int cannot size past 2 GB
+	if selectedChunkSize < 1 || selectedChunkSize > 1024 {
+		fmt.Println("Error: -chunk-size must be between 1 and 1024 MB")
+		os.Exit(1)
+	}
+
+	// URL inputs are streamed, so features that need the file on disk are unavailable
+	remote := isURL(filePath)
+	if remote && (listing || *otsStamp || (*timestamp && *tsrPath == "") || strings.HasPrefix(*magnet, "bt")) {
+		fmt.Println("Error: -output spdx, markdown, rclone, parquet and sums, -ots, -timestamp without -tsr and BitTorrent magnets need a local file")
+		os.Exit(1)
+	}
+
+	// Proofs, logs and special digests each cover a single input
+	if batch && (*follow || pixels || *ooxml || *canonicalPDF || *payload || *sample > 0 || *doubleCheck || *acquisitionLog != "" ||
+		*chainLog != "" || *timestamp || *otsStamp || *attestPath != "" || *magnet != "" || *expect != "") {
+		fmt.Println("Error: -follow, -a pixels, -ooxml, -pdf, -payload, -sample, -double-check, -acquisition-log, -chain,")
+		fmt.Println("-timestamp, -ots, -attest, -magnet and -expect apply to a single file")
+		os.Exit(1)
+	}
+	if batch && *replay != "" {
+		fmt.Println("Error: -replay verifies the single file of a report")
+		os.Exit(1)
+	}
+	if batch && slices.ContainsFunc(args, isURL) {
+		fmt.Println("Error: URLs are hashed one at a time")
+		os.Exit(1)
+	}
+	if *jobs < 1 {
+		fmt.Println("Error: -jobs needs at least one worker")
+		os.Exit(1)
+	}
+	jobsGiven := false
+	flag.Visit(func(f *flag.Flag) { jobsGiven = jobsGiven || f.Name == "jobs" })
+	if jobsGiven && listing {
+		fmt.Println("Error: -jobs applies to text and json output; spdx, markdown, rclone, parquet and sums listings")
+		fmt.Println("       hash one file at a time")
+		os.Exit(1)
+	}
+
+	// Directory walks stream their results, so nothing needs the whole file list
+	var filter WalkFilter
+	if *includeList != "" {
+		filter.Include = strings.Split(*includeList, ",")
+	}
+	if *excludeList != "" {
+		filter.Exclude = strings.Split(*excludeList, ",")
+	}
+	filter.SkipSymlinks, filter.SkipHidden = *skipSymlinks, *skipHidden
+	if !walkTree && (len(filter.Include) > 0 || len(filter.Exclude) > 0 || filter.SkipSymlinks || filter.SkipHidden) {
+		fmt.Println("Error: -include, -exclude, -skip-symlinks and -skip-hidden apply to -recursive")
+		os.Exit(1)
+	}
+	if walkTree && (listing || *concat || *warmCache) {
+		fmt.Println("Error: -recursive hashes to text or json output; spdx, markdown, rclone, parquet and sums listings")
+		fmt.Println("       include every file below a directory already, and -concat and -warm-cache need a file list")
+		os.Exit(1)
+	}
+
+	// Reports may list a whole file inventory, so they can be encrypted for storage
+	recipients, err := ParseEncryptRecipients(*encryptTo)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if recipients != nil && *output == "text" && *attestPath == "" {
+		fmt.Println("Error: -encrypt-to applies to -output json, spdx and markdown, and -attest")
+		os.Exit(1)
+	}
+
+	// A pattern or first part of a split file stands for the list of parts
+	var parts []string
+	if *concat && !remote {
+		if parts, err = expandParts(args); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		args = parts
+	}
+
 	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		fmt.Printf("Error: File '%s' does not exist\n", filePath)
+	for _, path := range args {
+		if _, err := os.Stat(path); !remote && !batch && os.IsNotExist(err) {
+			fmt.Printf("Error: File '%s' does not exist\n", path)
+			os.Exit(1)
+		}
+	}
+
+	// Case details come from the case file, overridden by flags
+	var caseInfo CaseInfo
+	if *caseFile != "" {
+		if caseInfo, err = LoadCaseInfo(*caseFile); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	caseInfo.override(CaseInfo{CaseNumber: *caseNumber, EvidenceNumber: *evidenceNumber, Examiner: *examiner, Notes: *caseNotes})
+	if !caseInfo.empty() && *acquisitionLog == "" {
+		fmt.Println("Error: case details are recorded with -acquisition-log <path>")
+		os.Exit(1)
+	}
+	if *doubleCheck && (remote || listing) {
+		fmt.Println("Error: -double-check applies to hashing a single local file or device")
+		os.Exit(1)
+	}
+	if *acquisitionLog != "" && deterministic {
+		fmt.Println("Error: an acquisition log records when and where evidence was hashed and cannot be -deterministic")
+		os.Exit(1)
+	}
+	if *acquisitionLog != "" && (remote || listing) {
+		fmt.Println("Error: -acquisition-log applies to hashing a single local file or device")
+		os.Exit(1)
+	}
+
+	// Forensic mode: nothing may be written to or next to the evidence
+	outputs := []string{*chainLog, *tsrPath, *attestPath, *acquisitionLog, sumsFile}
+	if *landlock && !*readOnly {
+		fmt.Println("Error: -landlock requires -readonly-assert")
 		os.Exit(1)
 	}
+	if *readOnly {
+		if *otsStamp || *writeSidecar || (*timestamp && *tsrPath == "") {
+			fmt.Println("Error: -readonly-assert: -ots, -sidecar and -timestamp without -tsr write next to the input")
+			os.Exit(1)
+		}
+		for _, path := range args {
+			if err := checkReadOnlyOutputs(path, outputs); err != nil {
+				fmt.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	sink, err := logFlags.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer sink.Close()
+
+	landlockABI := 0
+	if *landlock {
+		if landlockABI, err = ApplyLandlock(outputs); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// Create hash calculator with custom chunk size
 	calculator := &HashCalculator{
 		ChunkSize: int64(selectedChunkSize) * 1024 * 1024, // Convert MB to bytes
+		ReadOnly:  *readOnly,
+		Paths:     paths,
 	}
+	if *netfs {
+		calculator.ChunkSize = max(calculator.ChunkSize, netfsChunkSize)
+		calculator.Readahead = netfsReadahead
+		calculator.NetFS = true
+		calculator.Stats = NewMountStats()
+	}
+	if *clones {
+		calculator.Clones = newCloneCache()
+	}
+	if *warmCache {
+		calculator.Warm = newCacheWarmer()
+	}
+	calculator.Jobs = *jobs
 
-	fmt.Printf("Calculating %s hash for: %s\n", getAlgorithmName(hashAlg), filePath)
-	fmt.Printf("Chunk size: %d MB\n", selectedChunkSize)
-	fmt.Println()
+	// Reports record the settings they were made with, so a replay can say where its own differ
+	params.ChunkSize, params.PathMode = calculator.ChunkSize, paths.Mode
+	params.Includes, params.Excludes = filter.Include, filter.Exclude
+	if filter.SkipSymlinks {
+		params.Options = append(params.Options, "skip-symlinks")
+	}
+	if filter.SkipHidden {
+		params.Options = append(params.Options, "skip-hidden")
+	}
+	if replayed != nil {
+		for _, drift := range replayed.Parameters.Drift(params) {
+			fmt.Fprintf(os.Stderr, "Settings drift: %s\n", drift)
+		}
+	}
+
+	// Screening, payload, pixel, canonical PDF and Office content digests are
+	// not digests of the file, so they must not stand in for one in listings,
+	// proofs or logs
+	plainOutput := *output == "text" || *output == "json"
+	recorded := *chainLog != "" || *attestPath != "" || *timestamp || *otsStamp || *magnet != "" || *doubleCheck || *acquisitionLog != ""
+	partialDigest := func(conflict bool, what string) {
+		if conflict || remote || *follow || !plainOutput || recorded {
+			fmt.Printf("Error: %s for text or json output, and cannot be\n", what)
+			fmt.Println("       recorded in chain logs, attestations, timestamps, magnets or acquisition logs")
+			os.Exit(1)
+		}
+	}
+	if *sample != 0 {
+		partialDigest(*sample < 0 || hashAlg == CIDV1, "-sample gives a screening hash of a local file")
+	}
+	if *payload {
+		partialDigest(*sample > 0, "-payload hashes the media payload of a local file")
+	}
+	if pixels {
+		partialDigest(*sample > 0 || *payload || *canonicalPDF || *ooxml, "-a pixels hashes the decoded image of a local file")
+	}
+	if *canonicalPDF {
+		partialDigest(hashAlg == CIDV1 || *sample > 0 || *payload || *ooxml, "-pdf hashes the canonical form of a local PDF")
+	}
+	if *ooxml {
+		partialDigest(hashAlg == CIDV1 || *sample > 0 || *payload, "-ooxml hashes the contents of a local Office document")
+	}
+
+	// The parts of a split file are read one after another as a single stream
+	if *concat {
+		if remote || pixels || *sample > 0 || *payload || *canonicalPDF || *ooxml || *follow || !plainOutput || recorded {
+			fmt.Println("Error: -concat hashes local parts to text or json output, and cannot be combined with other hash")
+			fmt.Println("       modes, chain logs, attestations, timestamps, magnets or acquisition logs")
+			os.Exit(1)
+		}
+	}
+
+	// rclone, Parquet and checksum listings hold plain digests of whole files
+	if (*output == "rclone" || *output == "parquet" || *output == "sums") && (pixels || *sample > 0 || *payload || *canonicalPDF || *ooxml || *concat || *follow) {
+		fmt.Println("Error: -output rclone, parquet and sums list plain digests of whole files")
+		os.Exit(1)
+	}
+	if (*output == "rclone" || *output == "sums") && hashAlg == CIDV1 {
+		fmt.Println("Error: -output rclone and sums list md5, sha1, sha256 or sha512 digests")
+		os.Exit(1)
+	}
+	if sumsFile != "" && hashAlg != sumsAlgorithm {
+		fmt.Printf("Error: %s names a file of %s digests, but -a is %s\n", sumsFile, getAlgorithmName(sumsAlgorithm), getAlgorithmName(hashAlg))
+		os.Exit(1)
+	}
+	if *binaryMode && *output != "sums" {
+		fmt.Println("Error: -binary applies to sums output")
+		os.Exit(1)
+	}
+	if *backups < 0 || (*backups > 0 && sumsFile == "") {
+		fmt.Println("Error: -backups keeps copies of a checksum file named by -output and must not be negative")
+		os.Exit(1)
+	}
+	if *output == "parquet" && isTerminal(os.Stdout) {
+		fmt.Println("Error: -output parquet writes a binary file; redirect it, e.g. > results.parquet")
+		os.Exit(1)
+	}
+
+	// A sidecar holds the plain digest of a local file, as sha256sum writes it
+	if *writeSidecar && (remote || hashAlg == CIDV1 || pixels || *sample > 0 || *payload || *canonicalPDF || *ooxml || *concat ||
+		*follow || !plainOutput) {
+		fmt.Println("Error: -sidecar writes the hex digest of a whole local file, with text or json output")
+		os.Exit(1)
+	}
+
+	// Following a growing file prints rolling digests instead of one result
+	if *follow {
+		if remote || hashAlg == CIDV1 || !plainOutput || recorded || *expect != "" {
+			fmt.Println("Error: -follow hashes a local file with a hex digest algorithm to text or json output only")
+			os.Exit(1)
+		}
+		if *followBytes < 0 || *followInterval < 0 {
+			fmt.Println("Error: -follow-bytes and -follow-interval must not be negative")
+			os.Exit(1)
+		}
+		opts := FollowOptions{Every: *followBytes, Interval: *followInterval}
+		if opts.Every == 0 && opts.Interval == 0 {
+			opts.Interval = 10 * time.Second
+		}
+		os.Exit(runFollow(calculator, filePath, hashAlg, opts, *output))
+	}
+
+	// A journal of finished files lets a crashed multi-file run pick up where it stopped
+	if *resumeJournal != "" {
+		if !listing {
+			fmt.Println("Error: -resume-journal applies to -output spdx, markdown, rclone, parquet and sums")
+			os.Exit(1)
+		}
+		if calculator.Journal, err = OpenScanJournal(*resumeJournal); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if calculator.Journal.Resumed() > 0 {
+			fmt.Fprintf(os.Stderr, "Resuming: %d file(s) already hashed according to %s\n", calculator.Journal.Resumed(), *resumeJournal)
+		}
+	}
+
+	// Reports go to stdout, so multi-file runs show their progress on stderr
+	expected := 0
+	if selectedProgress && listing {
+		files, total := 0, int64(-1)
+		if !*noPrescan {
+			inputs := args
+			if *output == "spdx" {
+				inputs = []string{filePath}
+			}
+			if files, total, err = PrescanBatch(inputs, *statWorkers); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		calculator.Batch = NewBatchProgress(os.Stderr, files, total)
+		expected = files
+	}
+
+	// Several inputs get one result each, written as each file finishes; only
+	// a batch in which every file failed is an error
+	if batch {
+		if *output == "text" {
+			if walkTree {
+				fmt.Printf("Calculating %s hashes of the files below %s\n", getAlgorithmName(hashAlg), strings.Join(args, ", "))
+			} else {
+				fmt.Printf("Calculating %s hashes of %d files\n", getAlgorithmName(hashAlg), len(args))
+			}
+			fmt.Printf("Chunk size: %d MB\n", calculator.ChunkSize/1024/1024)
+			fmt.Println()
+		}
+		if selectedProgress && walkTree {
+			calculator.Batch = NewBatchProgress(os.Stderr, 0, -1)
+		} else if selectedProgress {
+			var total int64
+			for _, path := range args {
+				if info, err := os.Stat(path); err == nil {
+					total += info.Size()
+				}
+			}
+			calculator.Batch = NewBatchProgress(os.Stderr, len(args), total)
+		}
+		stdout, err := recipients.Writer(os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		out := &batchOutput{w: stdout, json: *output == "json", show: show}
+		pool := newHashPool(context.Background(), calculator.Jobs, func(r FileHashResult) {
+			if r.Err != nil {
+				sink.Emit(logError, "hash.failed", r.Err.Error(), map[string]any{"file": r.Path, "algorithm": string(hashAlg)})
+			} else {
+				sink.Emit(logInfo, "hash.computed", r.Result.Description, map[string]any{
+					"file": r.Path, "size": r.Result.FileSize, "algorithm": string(r.Result.Algorithm), "hash": r.Result.Hash,
+				})
+			}
+			// Results share the terminal with the progress line, which is drawn again with the next file
+			if calculator.Batch != nil && isTerminal(os.Stdout) {
+				calculator.Batch.Clear()
+			}
+			if err := out.Write(r); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		})
+		// Files are hashed on the pool's workers, and their results written in turn
+		hash := func(path string, err error) {
+			pool.Add(path, func(path string) FileHashResult {
+				r := FileHashResult{Path: path, Err: err}
+				if err == nil {
+					r.Result, r.Err = calculator.CalculateFileHash(path, hashAlg, nil)
+				}
+				if r.Err == nil && *writeSidecar {
+					r.Err = WriteSidecar(r.Path, r.Result.Algorithm, r.Result.Hash)
+				}
+				return r
+			})
+		}
+		if walkTree {
+			calculator.walkFiles(args, filter, hash)
+		} else {
+			calculator.Warm.start(args)
+			for _, path := range args {
+				hash(path, nil)
+			}
+		}
+		pool.Wait()
+		if calculator.Batch != nil {
+			calculator.Batch.Finish()
+		}
+		err = out.Close()
+		if closeErr := stdout.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if *bell {
+			ringBell(out.failed == out.files)
+		}
+		if calculator.Stats != nil {
+			calculator.Stats.Print(os.Stderr)
+		}
+		calculator.Clones.Print()
+		sink.Close()
+		if out.files == 0 {
+			fmt.Fprintf(os.Stderr, "Error: no files to hash below %s\n", strings.Join(args, ", "))
+			os.Exit(1)
+		}
+		if out.failed == out.files {
+			os.Exit(1)
+		}
+		return
+	}
+
+	// A full disk is found before hashing starts, and a document that could not
+	// be finished is removed again rather than left to verify as corrupt. A
+	// checksum file only replaces the one it is named after once complete.
+	documentFile := os.Stdout
+	var sumsOut *atomicFile
+	if sumsFile != "" {
+		if sumsOut, err = createAtomic(sumsFile, 0644); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		sumsOut.backups = *backups
+		documentFile = sumsOut.File
+	}
+	document := startDocument(documentFile)
+	if listing {
+		if err := document.reserve(max(outputReserve, int64(expected)*outputBytesPerFile)); err != nil {
+			sumsOut.Abort()
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Structured output formats write only the document to stdout
+	switch *output {
+	case "text":
+	case "json":
+		selectedProgress = false
+	case "spdx", "markdown", "sums", "rclone", "parquet":
+		stdout, err := recipients.Writer(documentFile)
+		unreadable := 0
+		if err == nil {
+			switch *output {
+			case "spdx":
+				err = WriteSPDX(stdout, filePath, calculator)
+			case "markdown":
+				err = WriteMarkdownChecksums(stdout, args, calculator)
+			case "sums":
+				unreadable, err = WriteChecksums(stdout, args, hashAlg, calculator, ChecksumListing{Binary: *binaryMode, Self: sumsFile})
+			case "rclone":
+				err = WriteRcloneHashsum(stdout, args, hashAlg, calculator)
+			default:
+				err = WriteParquetResults(stdout, args, hashAlg, calculator)
+			}
+			if closeErr := stdout.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if calculator.Batch != nil {
+			calculator.Batch.Finish()
+		}
+		if calculator.Journal != nil {
+			calculator.Journal.Close(err == nil)
+		}
+		if err == nil && sumsOut != nil {
+			err = sumsOut.Commit()
+		}
+		if *bell {
+			ringBell(err != nil || unreadable > 0)
+		}
+		if err != nil {
+			if sumsOut != nil {
+				sumsOut.Abort()
+			} else {
+				document.discard()
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if calculator.Stats != nil {
+			calculator.Stats.Print(os.Stderr)
+		}
+		calculator.Clones.Print()
+		if unreadable > 0 {
+			fmt.Fprintf(os.Stderr, "Error: %d file(s) could not be read and are not listed\n", unreadable)
+			os.Exit(1)
+		}
+		return
+	default:
+		fmt.Printf("Error: unsupported output format: %s. Supported: text, json, spdx, markdown, rclone, parquet, sums,\n", *output)
+		fmt.Println("or a checksum file name such as checksums.sha256")
+		os.Exit(1)
+	}
+
+	if *output == "text" {
+		if *concat {
+			fmt.Printf("Calculating %s hash of %d parts as one file: %s\n", getAlgorithmName(hashAlg), len(parts), outputPath(joinedName(parts[0])))
+		} else if pixels {
+			fmt.Printf("Calculating SHA-256 pixel hash (metadata and orientation excluded) for: %s\n", outputPath(filePath))
+		} else if *ooxml {
+			fmt.Printf("Calculating %s content hash (members in canonical order, zip details ignored) for: %s\n", getAlgorithmName(hashAlg), outputPath(filePath))
+		} else if *canonicalPDF {
+			fmt.Printf("Calculating %s canonical PDF hash (dates, IDs and trailers normalized) for: %s\n", getAlgorithmName(hashAlg), outputPath(filePath))
+		} else if *payload {
+			fmt.Printf("Calculating %s payload hash (tags and metadata excluded) for: %s\n", getAlgorithmName(hashAlg), outputPath(filePath))
+		} else if *sample > 0 {
+			fmt.Printf("Calculating %s screening hash (first, middle and last %d MB) for: %s\n", getAlgorithmName(hashAlg), *sample, outputPath(filePath))
+		} else {
+			fmt.Printf("Calculating %s hash for: %s\n", getAlgorithmName(hashAlg), outputPath(filePath))
+		}
+		fmt.Printf("Chunk size: %d MB\n", calculator.ChunkSize/1024/1024)
+		if *readOnly {
+			fmt.Println("Read-only: O_RDONLY, no symlinks followed, access time preserved where permitted")
+		}
+		if landlockABI > 0 {
+			fmt.Printf("Landlock: enforced (ABI %d), writes limited to the -chain, -tsr and -attest directories\n", landlockABI)
+		}
+		fmt.Println()
+	}
 
 	// Define progress callback
 	var progressCallback func(float64)
 	if selectedProgress {
-		progressCallback = progressBar
+		progressCallback = (&hasher.Meter{Interval: progressInterval, Total: -1, Sink: progressETA}).Update
 	}
 
 	// Calculate hash
-	result, err := calculator.CalculateFileHash(filePath, hashAlg, progressCallback)
+	startedOn := time.Now()
+	var result *HashResult
+	var source *URLSource
+	if remote {
+		var results []*HashResult
+		creds := RemoteCredentials{User: *remoteUser, Password: *remotePass, Identity: *identity}
+		if creds.Password == "" {
+			creds.Password = os.Getenv("HASHCULATE_REMOTE_PASSWORD")
+		}
+		results, source, err = calculator.FetchURLDigests(filePath, creds, []HashAlgorithm{hashAlg}, progressCallback)
+		if err == nil {
+			result = results[0]
+		}
+	} else if *concat {
+		result, err = calculator.ConcatFiles(parts, hashAlg, progressCallback)
+	} else if pixels {
+		result, err = calculator.PixelFile(filePath)
+	} else if *ooxml {
+		result, err = calculator.OOXMLFile(filePath, hashAlg, progressCallback)
+	} else if *canonicalPDF {
+		result, err = calculator.PDFFile(filePath, hashAlg, progressCallback)
+	} else if *payload {
+		result, err = calculator.PayloadFile(filePath, hashAlg, progressCallback)
+	} else if *sample > 0 {
+		result, err = calculator.SampleFile(filePath, hashAlg, int64(*sample)<<20)
+	} else {
+		result, err = calculator.CalculateFileHash(filePath, hashAlg, progressCallback)
+	}
 	if err != nil {
-		fmt.Printf("Error calculating hash: %v\n", err)
+		if *bell {
+			ringBell(true)
+		}
+		sink.Emit(logError, "hash.failed", err.Error(), map[string]any{"file": filePath, "algorithm": string(hashAlg)})
+		sink.Close()
+		if *output == "json" {
+			fmt.Fprintf(os.Stderr, "Error calculating hash: %v\n", err)
+		} else {
+			fmt.Printf("Error calculating hash: %v\n", err)
+		}
 		os.Exit(1)
 	}
+	finishedOn := time.Now()
+	sink.Emit(logInfo, "hash.computed", result.Description, map[string]any{
+		"file": filePath, "size": result.FileSize, "algorithm": string(result.Algorithm), "hash": result.Hash,
+	})
+
+	// Read the source again, from the device rather than the page cache where possible
+	consistent := true
+	if *doubleCheck {
+		uncached := dropPageCache(filePath)
+		if *output == "text" {
+			fmt.Println()
+			if uncached {
+				fmt.Println("Second pass (page cache dropped):")
+			} else {
+				fmt.Println("Second pass (may be served from the page cache):")
+			}
+		}
+		result.Passes, err = calculator.DoubleCheck(filePath, result, startedOn, finishedOn, progressCallback)
+		if err != nil {
+			if *bell {
+				ringBell(true)
+			}
+			sink.Emit(logError, "hash.failed", err.Error(), map[string]any{"file": filePath, "algorithm": string(hashAlg)})
+			sink.Close()
+			fmt.Fprintf(os.Stderr, "Error in second pass: %v\n", err)
+			os.Exit(1)
+		}
+		finishedOn = result.Passes[1].Finished
+		consistent = result.Passes[0].Hash == result.Passes[1].Hash
+		if !consistent {
+			sink.Emit(logError, "verify.failed", filePath+": passes differ", map[string]any{
+				"file": filePath, "algorithm": string(hashAlg), "first": result.Passes[0].Hash, "second": result.Passes[1].Hash,
+			})
+		}
+	}
+
+	shown := show(result)
+	matched := *expect == "" || digestMatches(result.Hash, *expect, *prefixMatch)
+	if !matched {
+		sink.Emit(logError, "verify.failed", filePath+": FAILED", map[string]any{
+			"file": filePath, "algorithm": string(result.Algorithm), "expected": *expect, "actual": result.Hash,
+		})
+	}
+	if *bell {
+		ringBell(!consistent || !matched)
+	}
+
+	// The acquisition log is written before any verification failure exits
+	if *acquisitionLog != "" {
+		record := AcquisitionLog{
+			Case:    caseInfo,
+			Source:  DescribeSource(filePath),
+			Started: startedOn,
+			Ended:   finishedOn,
+			Results: []*HashResult{result},
+		}
+		var checks []string
+		switch {
+		case !consistent:
+			checks = append(checks, "FAILED, the two read passes differ")
+		case result.Passes != nil:
+			checks = append(checks, "both read passes match")
+		}
+		switch {
+		case *expect == "":
+		case matched:
+			checks = append(checks, "matched expected digest "+*expect)
+		default:
+			checks = append(checks, "FAILED, expected digest "+*expect)
+		}
+		record.Verification = strings.Join(checks, "; ")
+		f, err := os.OpenFile(*acquisitionLog, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			err = WriteAcquisitionLog(f, record)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing acquisition log: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Only a digest that passed verification is worth recording next to the file
+	sidecar := ""
+	if *writeSidecar && consistent && matched {
+		sidecar = sidecarPath(filePath, result.Algorithm)
+		if err := WriteSidecar(filePath, result.Algorithm, result.Hash); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing sidecar: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Links, proofs and logs of the digest are written for text and json output
+	// alike; with json their notes go to stderr, leaving stdout to the report
+	writeProofs := func(notes io.Writer) {
+		// Print the magnet link
+		if *magnet != "" {
+			link, err := MagnetLink(filePath, result, *magnet, int64(*pieceLength)*1024)
+			if err != nil {
+				fmt.Fprintf(notes, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(notes)
+			fmt.Fprintln(notes, "Magnet:")
+			fmt.Fprintln(notes, link)
+		}
+
+		// Timestamp the digest
+		if *timestamp {
+			var roots *x509.CertPool
+			if *tsaCA != "" {
+				if roots, err = loadCertPool(*tsaCA); err != nil {
+					fmt.Fprintf(notes, "Error: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			digest, _ := hex.DecodeString(result.Hash)
+			token, err := RequestTimestamp(*tsaURL, result.Algorithm, digest)
+			if err != nil {
+				fmt.Fprintf(notes, "Error requesting timestamp: %v\n", err)
+				os.Exit(1)
+			}
+			tokenPath := *tsrPath
+			if tokenPath == "" {
+				tokenPath = filePath + ".tsr"
+			}
+			if err := os.WriteFile(tokenPath, token.Raw, 0644); err != nil {
+				fmt.Fprintf(notes, "Error writing timestamp token: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(notes)
+			fmt.Fprintf(notes, "Timestamp token saved to %s\n", tokenPath)
+			printTimestamp(notes, token, roots)
+		}
+
+		// Anchor the digest with OpenTimestamps
+		if *otsStamp {
+			digest, _ := hex.DecodeString(result.Hash)
+			proof, err := StampOTS(result.Algorithm, digest, strings.Split(*otsCalendars, ","))
+			if err != nil {
+				fmt.Fprintf(notes, "Error creating OpenTimestamps proof: %v\n", err)
+				os.Exit(1)
+			}
+			proofPath := filePath + ".ots"
+			if err := os.WriteFile(proofPath, proof.Bytes(), 0644); err != nil {
+				fmt.Fprintf(notes, "Error writing OpenTimestamps proof: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(notes)
+			fmt.Fprintf(notes, "OpenTimestamps proof saved to %s (pending until confirmed in a Bitcoin block)\n", proofPath)
+		}
+
+		if sidecar != "" {
+			fmt.Fprintln(notes)
+			fmt.Fprintf(notes, "Checksum written to %s\n", sidecar)
+		}
+
+		// Write the in-toto attestation
+		if *attestPath != "" {
+			statement, err := BuildStatement([]*HashResult{result}, AttestOptions{
+				BuilderID:     *builderID,
+				PredicateType: *predicateType,
+				PredicatePath: *predicatePath,
+				StartedOn:     startedOn,
+				FinishedOn:    finishedOn,
+			})
+			if err == nil {
+				err = WriteStatement(*attestPath, statement, recipients)
+			}
+			if err != nil {
+				fmt.Fprintf(notes, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(notes)
+			fmt.Fprintf(notes, "in-toto attestation written to %s\n", *attestPath)
+		}
+
+		// Record the result in the chain log
+		if *chainLog != "" {
+			chainTSA := ""
+			if *timestamp {
+				chainTSA = *tsaURL
+			}
+			record, err := AppendChainRecord(*chainLog, []*HashResult{result}, chainTSA)
+			if err != nil {
+				fmt.Fprintf(notes, "Error writing chain log: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Fprintln(notes)
+			fmt.Fprintf(notes, "Chain record #%d appended to %s (digest %s)\n", record.Seq, *chainLog, record.Digest)
+		}
+	}
+
+	if *output == "json" {
+		stdout, err := recipients.Writer(os.Stdout)
+		if err == nil {
+			err = WriteJSONReport(stdout, &shown, source)
+			if closeErr := stdout.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			document.discard()
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			sink.Close()
+			os.Exit(1)
+		}
+		// As with text output, the acquisition log above has recorded the failure,
+		// and no proofs are written for a digest that did not verify
+		if !consistent {
+			fmt.Fprintln(os.Stderr, "Error: the two read passes produced different digests")
+			sink.Close()
+			os.Exit(1)
+		}
+		if !matched {
+			fmt.Fprintf(os.Stderr, "Error: %s hash does not match expected %s\n", getAlgorithmName(result.Algorithm), *expect)
+			sink.Close()
+			os.Exit(1)
+		}
+		writeProofs(os.Stderr)
+		return
+	}
 
 	// Display results
 	fmt.Println()
 	fmt.Println("Hash calculation complete!")
 	fmt.Println("=" + strings.Repeat("=", 50))
 	fmt.Printf("File: %s\n", result.Filename)
+	if result.Path != "" && result.Path != result.Filename {
+		fmt.Printf("Path: %s\n", outputPath(result.Path))
+	}
 	fmt.Printf("Size: %s\n", formatBytes(result.FileSize))
 	fmt.Printf("Algorithm: %s\n", getAlgorithmName(result.Algorithm))
-	fmt.Printf("Hash: %s\n", result.Hash)
+	fmt.Printf("Hash: %s\n", shown.Hash)
+	if shown.UUID != "" {
+		fmt.Printf("UUID: %s\n", shown.UUID)
+	}
+	if result.Pixels != nil {
+		fmt.Printf("Image: %s, %dx%d pixels\n", strings.ToUpper(result.Pixels.Format), result.Pixels.Width, result.Pixels.Height)
+		fmt.Printf("Container SHA-256: %s\n", truncateDigest(result.Pixels.Container, *truncate))
+	}
+	for i, part := range result.Parts {
+		fmt.Printf("Part %d: %s (%s)\n", i+1, part.Name, formatBytes(part.Size))
+	}
+	if result.PDF != nil {
+		fmt.Printf("PDF: version %s, %d objects, %d incremental updates\n", result.PDF.Version, result.PDF.Objects, result.PDF.Revisions-1)
+		fmt.Printf("Raw hash: %s\n", truncateDigest(result.PDF.Raw, *truncate))
+	}
+	if result.OOXML != nil {
+		fmt.Printf("Document: %s, %d members, %s uncompressed\n", result.OOXML.Type, result.OOXML.Members, formatBytes(result.OOXML.Bytes))
+		fmt.Printf("Raw hash: %s\n", truncateDigest(result.OOXML.Raw, *truncate))
+	}
 	fmt.Println("=" + strings.Repeat("=", 50))
 	fmt.Println()
 	fmt.Println("Description:")
-	fmt.Println(result.Description)
+	fmt.Println(shown.Description)
+	if result.Sample != nil && !result.Sample.Complete {
+		fmt.Println()
+		fmt.Printf("Screening hash only: %s of %s read. Equal screening hashes suggest, but do not prove,\n",
+			formatBytes(result.Sample.Covered), formatBytes(result.FileSize))
+		fmt.Println("identical files; hash them in full before relying on it.")
+	}
+	if result.Passes != nil {
+		fmt.Println()
+		for i, pass := range result.Passes {
+			if deterministic {
+				fmt.Printf("Pass %d: %s\n", i+1, truncateDigest(pass.Hash, *truncate))
+				continue
+			}
+			fmt.Printf("Pass %d: %s (%s)\n", i+1, truncateDigest(pass.Hash, *truncate), pass.Duration().Round(time.Millisecond))
+		}
+		if !consistent {
+			fmt.Println("Double check: FAILED, the passes differ; suspect the storage device, cabling or memory")
+			sink.Close()
+			os.Exit(1)
+		}
+		fmt.Println("Double check: OK")
+	}
+	if *expect != "" {
+		fmt.Println()
+		fmt.Printf("Expected: %s\n", *expect)
+		if !matched {
+			fmt.Println("Result: FAILED")
+			sink.Close()
+			os.Exit(1)
+		}
+		if *prefixMatch && len(strings.TrimSpace(*expect)) < len(result.Hash) {
+			fmt.Printf("Result: OK (prefix of %d characters)\n", len(strings.TrimSpace(*expect)))
+			fmt.Fprintln(os.Stderr, truncationWarning(len(strings.TrimSpace(*expect))))
+		} else {
+			fmt.Println("Result: OK")
+		}
+	}
+	if source != nil {
+		printURLSource(source)
+	}
+	if calculator.Stats != nil && !deterministic {
+		fmt.Println()
+		calculator.Stats.Print(os.Stdout)
+	}
+	writeProofs(os.Stdout)
 }
@@ -96,6 +96,8 @@ func TestFormatBytes(t *testing.T) {
 		{1024, "1.0 kb (kilobytes)"},
 		{2048, "2.0 kb (kilobytes)"},
 		{1536, "1.5 kb (kilobytes)"},
+		{5 << 30, "5.0 GB (gigabytes)"},
+		{3 << 40, "3.0 TB (terabytes)"},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ManifestEntry is the expected checksums of one file in a manifest or SBOM
+type ManifestEntry struct {
+	Path      string
+	Checksums map[HashAlgorithm]string
+	Meta      *FileMeta // Recorded permissions, from hash databases
+	Label     string    // Recorded SELinux or Smack label, from hash databases
+	Size      int64     // Recorded size, from hash databases
+	Modified  time.Time // Recorded modification time, from hash databases
+}
+
+// digestLengths maps hex digest lengths to the algorithm GNU tools imply
+var digestLengths = map[int]HashAlgorithm{32: MD5, 40: SHA1, 64: SHA256, 128: SHA512}
+
+// checkDigestLength fails when a hex digest is too long or short to come from
+// algorithm, naming the algorithm its length belongs to, so a digest of the
+// wrong kind is reported up front rather than as a mismatch. With prefix,
+// shorter digests are accepted.
+func checkDigestLength(algorithm HashAlgorithm, digest string, prefix bool) error {
+	got := len(strings.TrimSpace(digest))
+	for want, alg := range digestLengths {
+		if alg != algorithm || got == want || (prefix && got < want) {
+			continue
+		}
+		if other, ok := digestLengths[got]; ok {
+			return fmt.Errorf("%s digests have %d characters, but this one has %d, like %s digests",
+				getAlgorithmName(algorithm), want, got, getAlgorithmName(other))
+		}
+		return fmt.Errorf("%s digests have %d characters, but this one has %d, which matches no supported algorithm",
+			getAlgorithmName(algorithm), want, got)
+	}
+	return nil
+}
+
+// bsdChecksumLine matches `SHA256 (file) = digest` lines written by shasum --tag and BSD md5
+var bsdChecksumLine = regexp.MustCompile(`^(MD5|SHA1|SHA256|SHA512|SHA-1|SHA-256|SHA-512) \((.*)\) = ([0-9a-fA-F]+)$`)
+
+// LoadManifest reads expected checksums from a GNU or BSD checksum file
+// (sha256sum, shasum --tag), a hashdeep file, a hashculate database or rollup
+// manifest, or an SPDX or CycloneDX SBOM
+func LoadManifest(manifestPath string) ([]ManifestEntry, error) {
+	entries, err := loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	return entries, checkManifestDigests(entries)
+}
+
+// checkManifestDigests checks that every listed digest has the length of its algorithm
+func checkManifestDigests(entries []ManifestEntry) error {
+	for _, entry := range entries {
+		for alg, digest := range entry.Checksums {
+			if err := checkDigestLength(alg, digest, false); err != nil {
+				return fmt.Errorf("manifest entry %s: %w", entry.Path, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadManifest reads the entries of a manifest in any supported format
+func loadManifest(manifestPath string) ([]ManifestEntry, error) {
+	return loadManifestAs(manifestPath, "")
+}
+
+// loadManifestAs reads a manifest like loadManifest, taking the digests of
+// GNU lines to be of the given algorithm when it is not empty
+func loadManifestAs(manifestPath string, algorithm HashAlgorithm) ([]ManifestEntry, error) {
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		if bytes.Contains(trimmed, []byte(`"directories"`)) {
+			manifest, err := LoadRollupManifest(manifestPath)
+			if err != nil {
+				return nil, err
+			}
+			var entries []ManifestEntry
+			for _, file := range manifest.Files {
+				entries = append(entries, ManifestEntry{Path: file.Path, Checksums: map[HashAlgorithm]string{manifest.Algorithm: file.Hash}})
+			}
+			return entries, nil
+		}
+		if bytes.Contains(trimmed, []byte(`"entries"`)) {
+			db, err := OpenHashDB(manifestPath)
+			if err != nil {
+				return nil, err
+			}
+			return dbManifest(db), nil
+		}
+		return ParseSBOM(data)
+	case bytes.HasPrefix(trimmed, []byte("%%%% HASHDEEP")):
+		db := &HashDB{entries: map[string]*DBEntry{}}
+		if _, err := db.Import(bytes.NewReader(data), "hashdeep"); err != nil {
+			return nil, fmt.Errorf("invalid hashdeep manifest: %w", err)
+		}
+		return dbManifest(db), nil
+	}
+	implied, _ := checksumFileAlgorithm(manifestPath)
+	return parseChecksumLines(data, cmp.Or(algorithm, implied))
+}
+
+// dbManifest converts database entries to manifest entries
+func dbManifest(db *HashDB) []ManifestEntry {
+	var entries []ManifestEntry
+	for _, entry := range db.Entries() {
+		entries = append(entries, ManifestEntry{Path: entry.Path, Checksums: entry.Hashes, Meta: entry.Meta, Label: entry.Label,
+			Size: entry.Size, Modified: entry.Modified})
+	}
+	return entries
+}
+
+// checksumFileAlgorithm infers the algorithm of a checksum file from its
+// name, as in SHA512SUMS, sha256sum.txt, app.tar.gz.sha256 or file.md5
+func checksumFileAlgorithm(name string) (HashAlgorithm, bool) {
+	base := strings.TrimSuffix(strings.ToLower(path.Base(filepath.ToSlash(name))), ".txt")
+	for _, candidate := range []string{strings.TrimPrefix(path.Ext(base), "."), base} {
+		candidate = strings.TrimSuffix(strings.TrimSuffix(candidate, "s"), "sum")
+		if alg, err := parseAlgorithm(candidate); err == nil && alg != CIDV1 {
+			return alg, true
+		}
+	}
+	return "", false
+}
+
+// parseChecksumLines reads `digest  file` (GNU, `*` marks binary mode) and
+// `ALG (file) = digest` (BSD) lines. GNU escapes names containing a backslash,
+// newline or carriage return and marks them with a leading backslash. GNU lines carry no
+// algorithm; it is implied by the checksum file's name when given, and by
+// the digest length otherwise. rclone's UNSUPPORTED and ERROR markers give
+// entries without a checksum.
+func parseChecksumLines(data []byte, implied HashAlgorithm) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if name, ok := rcloneMarkerLine(text); ok {
+			entries = append(entries, ManifestEntry{Path: name, Checksums: map[HashAlgorithm]string{}})
+			continue
+		}
+		escaped := strings.HasPrefix(text, "\\")
+		if escaped {
+			text = text[1:]
+		}
+
+		var alg HashAlgorithm
+		var name, digest string
+		if m := bsdChecksumLine.FindStringSubmatch(text); m != nil {
+			alg, _ = parseAlgorithm(m[1])
+			name, digest = m[2], m[3]
+			if err := checkDigestLength(alg, digest, false); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		} else {
+			var ok bool
+			digest, name, ok = strings.Cut(text, " ")
+			if !ok || (!strings.HasPrefix(name, " ") && !strings.HasPrefix(name, "*")) {
+				return nil, fmt.Errorf("line %d: not a checksum line", line)
+			}
+			name = name[1:]
+			if implied != "" {
+				if err := checkDigestLength(implied, digest, false); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				alg = implied
+			} else if alg, ok = digestLengths[len(digest)]; !ok {
+				return nil, fmt.Errorf("line %d: unrecognized digest length %d", line, len(digest))
+			}
+		}
+		if escaped {
+			name = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(name)
+		}
+		entries = append(entries, ManifestEntry{Path: name, Checksums: map[HashAlgorithm]string{alg: strings.ToLower(digest)}})
+	}
+	return entries, scanner.Err()
+}
+
+// manifestKey normalizes a manifest path for matching against files on disk
+func manifestKey(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadManifest(t *testing.T) {
+	dir := t.TempDir()
+	sha256Empty := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	md5Empty := "d41d8cd98f00b204e9800998ecf8427e"
+	manifests := map[string]string{
+		"gnu":      sha256Empty + "  bin/app\n" + md5Empty + " *README\n\\" + sha256Empty + "  a\\\\b\n",
+		"bsd":      "SHA256 (bin/app) = " + sha256Empty + "\nMD5 (README) = " + md5Empty + "\n",
+		"hashdeep": "%%%% HASHDEEP-1.0\n%%%% size,md5,sha256,filename\n0," + md5Empty + "," + sha256Empty + ",bin/app\n",
+	}
+	for name, content := range manifests {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0644)
+		entries, err := LoadManifest(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(entries) == 0 || entries[0].Path != "bin/app" || entries[0].Checksums[SHA256] != sha256Empty {
+			t.Errorf("%s: unexpected first entry %+v", name, entries)
+		}
+		if name == "gnu" && (len(entries) != 3 || entries[1].Checksums[MD5] != md5Empty || entries[2].Path != `a\b`) {
+			t.Errorf("gnu: unexpected entries %+v", entries)
+		}
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad"), []byte("not a checksum\n"), 0644)
+	if _, err := LoadManifest(filepath.Join(dir, "bad")); err == nil {
+		t.Error("expected an error for a malformed manifest")
+	}
+}
+
+func TestCheckDigestLength(t *testing.T) {
+	md5Empty := "d41d8cd98f00b204e9800998ecf8427e"
+	tests := []struct {
+		algorithm HashAlgorithm
+		digest    string
+		prefix    bool
+		want      string
+	}{
+		{MD5, md5Empty, false, ""},
+		{SHA256, md5Empty, false, "SHA-256 digests have 64 characters, but this one has 32, like MD5 digests"},
+		{SHA1, "abc123", false, "SHA-1 digests have 40 characters, but this one has 6, which matches no supported algorithm"},
+		{SHA1, "abc123", true, ""},
+		{MD5, md5Empty + "00", true, "MD5 digests have 32 characters, but this one has 34, which matches no supported algorithm"},
+		{CIDV1, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", false, ""},
+	}
+	for _, test := range tests {
+		err := checkDigestLength(test.algorithm, test.digest, test.prefix)
+		if got := fmt.Sprint(err); (err == nil) != (test.want == "") || (err != nil && got != test.want) {
+			t.Errorf("checkDigestLength(%s, %s) = %v, want %q", test.algorithm, test.digest, err, test.want)
+		}
+	}
+
+	// A BSD line declaring one algorithm with another's digest is reported by line
+	path := filepath.Join(t.TempDir(), "SHA256SUMS")
+	os.WriteFile(path, []byte("SHA256 (app) = "+md5Empty+"\n"), 0644)
+	if _, err := LoadManifest(path); err == nil || !strings.HasPrefix(err.Error(), "line 1: SHA-256 digests") {
+		t.Errorf("expected a digest length error, got %v", err)
+	}
+}
+
+func TestChecksumFileAlgorithm(t *testing.T) {
+	for name, want := range map[string]HashAlgorithm{
+		"SHA512SUMS":           SHA512,
+		"dist/sha256sum.txt":   SHA256,
+		"MD5SUMS.txt":          MD5,
+		"app.tar.gz.sha1":      SHA1,
+		"app.tar.gz.sha256sum": SHA256,
+		"file.md5":             MD5,
+		"checksums.txt":        "",
+		"manifest.json":        "",
+	} {
+		if got, _ := checksumFileAlgorithm(name); got != want {
+			t.Errorf("checksumFileAlgorithm(%s) = %q, want %q", name, got, want)
+		}
+	}
+
+	// GNU lines take the algorithm from the file name, so a digest of another
+	// kind fails by name instead of being checked with the wrong algorithm
+	dir := t.TempDir()
+	sha256Empty := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	os.WriteFile(filepath.Join(dir, "SHA512SUMS"), []byte(sha256Empty+"  app\n"), 0644)
+	_, err := LoadManifest(filepath.Join(dir, "SHA512SUMS"))
+	if err == nil || !strings.Contains(err.Error(), "like SHA-256 digests") {
+		t.Errorf("expected the SHA-256 digest to be named, got %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "app.sha256"), []byte(sha256Empty+"  app\n"), 0644)
+	if entries, err := LoadManifest(filepath.Join(dir, "app.sha256")); err != nil || entries[0].Checksums[SHA256] != sha256Empty {
+		t.Errorf("unexpected entries %+v, %v", entries, err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// markdownSize formats a file size the way release pages show it, e.g. "4.2 MiB"
+func markdownSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	unit := ""
+	for _, u := range []string{"KiB", "MiB", "GiB", "TiB", "PiB"} {
+		value /= 1024
+		unit = u
+		if value < 1024 {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f %s", value, unit)
+}
+
+// markdownCode wraps text in a code span, escaping table pipes
+func markdownCode(text string) string {
+	return "`" + strings.ReplaceAll(text, "|", `\|`) + "`"
+}
+
+// WriteMarkdownChecksums hashes every file below the given paths and writes
+// the "## Checksums" table used in release notes. Files inside a directory are
+// named relative to it; files given directly by their base name, or by their
+// path when two of them share a base name.
+func WriteMarkdownChecksums(w io.Writer, paths []string, calculator *HashCalculator) error {
+	var rows []*HashResult
+	for _, root := range paths {
+		files, err := calculator.listFiles(root)
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, path := range files {
+			result, err := calculator.CalculateFileHash(path, SHA256, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			name := filepath.Base(path)
+			if path != root {
+				name = relativeSlashPath(root, path)
+			}
+			result.Filename = calculator.Paths.name(path, name)
+			rows = append(rows, result)
+		}
+	}
+
+	// The same name from two inputs would be ambiguous, so those rows show the path as given
+	seen := map[string]int{}
+	for _, row := range rows {
+		seen[row.Filename]++
+	}
+
+	var table strings.Builder
+	fmt.Fprintln(&table, "## Checksums")
+	fmt.Fprintln(&table)
+	fmt.Fprintln(&table, "| File | Size | SHA-256 |")
+	fmt.Fprintln(&table, "| --- | ---: | --- |")
+	for _, row := range rows {
+		name := row.Filename
+		if seen[name] > 1 {
+			name = filepath.ToSlash(outputPath(row.Path))
+		}
+		fmt.Fprintf(&table, "| %s | %s | %s |\n", markdownCode(name), markdownSize(row.FileSize), markdownCode(row.Hash))
+	}
+	_, err := io.WriteString(w, table.String())
+	return err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownChecksums(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "dist", "linux"), 0755)
+	archive := make([]byte, 3*1024*1024/2)
+	os.WriteFile(filepath.Join(dir, "dist", "linux", "app.tar.gz"), archive, 0644)
+	os.WriteFile(filepath.Join(dir, "a|b.txt"), []byte("hello"), 0644)
+
+	var out strings.Builder
+	paths := []string{filepath.Join(dir, "dist"), filepath.Join(dir, "a|b.txt")}
+	if err := WriteMarkdownChecksums(&out, paths, NewHashCalculator()); err != nil {
+		t.Fatal(err)
+	}
+	want := "## Checksums\n\n" +
+		"| File | Size | SHA-256 |\n" +
+		"| --- | ---: | --- |\n" +
+		"| `linux/app.tar.gz` | 1.5 MiB | `" + fmt.Sprintf("%x", sha256.Sum256(archive)) + "` |\n" +
+		"| `a\\|b.txt` | 5 B | `2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824` |\n"
+	if out.String() != want {
+		t.Errorf("unexpected table:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// Files given directly that share a base name are told apart by their paths
+	os.MkdirAll(filepath.Join(dir, "arm64"), 0755)
+	os.WriteFile(filepath.Join(dir, "arm64", "app.tar.gz"), archive, 0644)
+	out.Reset()
+	paths = []string{filepath.Join(dir, "dist", "linux", "app.tar.gz"), filepath.Join(dir, "arm64", "app.tar.gz")}
+	if err := WriteMarkdownChecksums(&out, paths, NewHashCalculator()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "| `"+filepath.ToSlash(paths[1])+"` |") {
+		t.Errorf("colliding base names not disambiguated:\n%s", out.String())
+	}
+}
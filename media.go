@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"hashculate/hasher"
+)
+
+// ErrUnsupportedMedia is returned for files that are not MP3, FLAC, MP4 or Matroska
+var ErrUnsupportedMedia = errors.New("not an MP3, FLAC, MP4 or Matroska file")
+
+// PayloadInfo describes what a -payload digest covers
+type PayloadInfo struct {
+	Format string `json:"format"` // mp3, flac, mp4 or matroska
+	Bytes  int64  `json:"bytes"`  // Payload bytes hashed
+}
+
+// MediaPayload finds the audio and video data of a media file, leaving out
+// tags, cover art and other metadata that taggers rewrite
+func MediaPayload(r io.ReaderAt, size int64) (string, []ByteRange, error) {
+	head := make([]byte, 12)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	start := id3v2Length(r, 0)
+	magic := make([]byte, 4)
+	r.ReadAt(magic, start)
+	switch {
+	case bytes.Equal(magic, []byte("fLaC")):
+		ranges, err := flacPayload(r, start+4, size)
+		return "flac", ranges, err
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		ranges, err := mp4Payload(r, size)
+		return "mp4", ranges, err
+	case bytes.HasPrefix(head, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		ranges, err := matroskaPayload(r, size)
+		return "matroska", ranges, err
+	case magic[0] == 0xFF && magic[1]&0xE0 == 0xE0:
+		end := trailingTagsStart(r, size)
+		if end <= start {
+			return "mp3", nil, fmt.Errorf("no audio frames")
+		}
+		return "mp3", []ByteRange{{Start: start, End: end}}, nil
+	}
+	return "", nil, ErrUnsupportedMedia
+}
+
+// id3v2Length returns the offset after any ID3v2 tags starting at offset
+func id3v2Length(r io.ReaderAt, offset int64) int64 {
+	header := make([]byte, 10)
+	for {
+		if _, err := r.ReadAt(header, offset); err != nil || string(header[:3]) != "ID3" {
+			return offset
+		}
+		// The size is "syncsafe": 7 bits per byte
+		size := int64(header[6]&0x7f)<<21 | int64(header[7]&0x7f)<<14 | int64(header[8]&0x7f)<<7 | int64(header[9]&0x7f)
+		offset += 10 + size
+		if header[5]&0x10 != 0 {
+			offset += 10 // footer
+		}
+	}
+}
+
+// trailingTagsStart returns where ID3v1 and APEv2 tags at the end of a file begin
+func trailingTagsStart(r io.ReaderAt, size int64) int64 {
+	end := size
+	tag := make([]byte, 3)
+	if end >= 128 {
+		if _, err := r.ReadAt(tag, end-128); err == nil && string(tag) == "TAG" {
+			end -= 128
+		}
+	}
+	footer := make([]byte, 32)
+	if end >= 32 {
+		if _, err := r.ReadAt(footer, end-32); err == nil && string(footer[:8]) == "APETAGEX" {
+			// The size covers the items and footer; a header precedes them when flagged
+			end -= int64(binary.LittleEndian.Uint32(footer[12:16]))
+			if binary.LittleEndian.Uint32(footer[20:24])&(1<<31) != 0 {
+				end -= 32
+			}
+		}
+	}
+	return max(end, 0)
+}
+
+// flacPayload skips the metadata blocks that follow the fLaC marker
+func flacPayload(r io.ReaderAt, offset, size int64) ([]ByteRange, error) {
+	header := make([]byte, 4)
+	for {
+		if _, err := r.ReadAt(header, offset); err != nil {
+			return nil, fmt.Errorf("truncated FLAC metadata: %w", err)
+		}
+		offset += 4 + (int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3]))
+		if header[0]&0x80 != 0 {
+			break
+		}
+	}
+	end := trailingTagsStart(r, size)
+	if end <= offset {
+		return nil, fmt.Errorf("no FLAC frames")
+	}
+	return []ByteRange{{Start: offset, End: end}}, nil
+}
+
+// mp4Payload returns the contents of the top-level mdat boxes
+func mp4Payload(r io.ReaderAt, size int64) ([]ByteRange, error) {
+	var ranges []ByteRange
+	header := make([]byte, 16)
+	for offset := int64(0); offset+8 <= size; {
+		if _, err := r.ReadAt(header[:8], offset); err != nil {
+			return nil, fmt.Errorf("truncated MP4 box: %w", err)
+		}
+		boxSize, headerSize := int64(binary.BigEndian.Uint32(header)), int64(8)
+		switch boxSize {
+		case 0:
+			boxSize = size - offset
+		case 1:
+			if _, err := r.ReadAt(header[8:16], offset+8); err != nil {
+				return nil, fmt.Errorf("truncated MP4 box: %w", err)
+			}
+			boxSize, headerSize = int64(binary.BigEndian.Uint64(header[8:16])), 16
+		}
+		if boxSize < headerSize || offset+boxSize > size {
+			return nil, fmt.Errorf("invalid MP4 box %q at %d", header[4:8], offset)
+		}
+		if string(header[4:8]) == "mdat" {
+			ranges = append(ranges, ByteRange{Start: offset + headerSize, End: offset + boxSize})
+		}
+		offset += boxSize
+	}
+	if ranges == nil {
+		return nil, fmt.Errorf("no mdat box")
+	}
+	return ranges, nil
+}
+
+// Matroska element IDs
+const (
+	mkvSegment     = 0x18538067
+	mkvCluster     = 0x1F43B675
+	mkvTimestamp   = 0xE7
+	mkvSimpleBlock = 0xA3
+	mkvBlockGroup  = 0xA0
+)
+
+// mkvTopLevel are the Segment children that end a Cluster of unknown size
+var mkvTopLevel = map[uint64]bool{
+	mkvCluster: true, 0x114D9B74: true, 0x1549A966: true, 0x1654AE6B: true,
+	0x1C53BB6B: true, 0x1941A469: true, 0x1043A770: true, 0x1254C367: true,
+}
+
+// ebmlVint reads an EBML variable-length integer. IDs keep their length
+// marker; sizes drop it and report all ones as unknown.
+func ebmlVint(r io.ReaderAt, offset int64, keepMarker bool) (value uint64, length int64, unknown bool, err error) {
+	buf := make([]byte, 8)
+	if _, err := r.ReadAt(buf[:1], offset); err != nil {
+		return 0, 0, false, err
+	}
+	length = 1
+	for mask := byte(0x80); buf[0]&mask == 0; mask >>= 1 {
+		if length++; length > 8 {
+			return 0, 0, false, fmt.Errorf("invalid EBML number at %d", offset)
+		}
+	}
+	if _, err := r.ReadAt(buf[1:length], offset+1); err != nil {
+		return 0, 0, false, err
+	}
+	value = uint64(buf[0])
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+	unknown = !keepMarker && value == 0xFF>>length
+	for _, b := range buf[1:length] {
+		value = value<<8 | uint64(b)
+		unknown = unknown && b == 0xFF
+	}
+	return value, length, unknown, nil
+}
+
+// ebmlElement reads the header of the element at offset
+func ebmlElement(r io.ReaderAt, offset, limit int64) (id uint64, dataStart, dataEnd int64, err error) {
+	id, idLength, _, err := ebmlVint(r, offset, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size, sizeLength, unknown, err := ebmlVint(r, offset+idLength, false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	dataStart = offset + idLength + sizeLength
+	dataEnd = limit
+	if !unknown {
+		dataEnd = dataStart + int64(size)
+	}
+	if dataEnd > limit {
+		return 0, 0, 0, fmt.Errorf("EBML element %x at %d overruns its parent", id, offset)
+	}
+	return id, dataStart, dataEnd, nil
+}
+
+// matroskaPayload returns the timestamps and blocks of every Cluster, leaving
+// out tags, attachments, chapters and the indexes that point into the file
+func matroskaPayload(r io.ReaderAt, size int64) ([]ByteRange, error) {
+	var ranges []ByteRange
+	for offset := int64(0); offset < size; {
+		id, start, end, err := ebmlElement(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		offset = end
+		if id != mkvSegment {
+			continue
+		}
+		for child := start; child < end; {
+			id, clusterStart, clusterEnd, err := ebmlElement(r, child, end)
+			if err != nil {
+				return nil, err
+			}
+			child = clusterEnd
+			if id != mkvCluster {
+				continue
+			}
+			for element := clusterStart; element < clusterEnd; {
+				id, _, elementEnd, err := ebmlElement(r, element, clusterEnd)
+				if err != nil {
+					return nil, err
+				}
+				if mkvTopLevel[id] {
+					// A Cluster of unknown size ends where the next top-level element begins
+					child = element
+					break
+				}
+				if id == mkvTimestamp || id == mkvSimpleBlock || id == mkvBlockGroup {
+					ranges = append(ranges, ByteRange{Start: element, End: elementEnd})
+				}
+				element = elementEnd
+			}
+		}
+	}
+	if ranges == nil {
+		return nil, fmt.Errorf("no Matroska clusters")
+	}
+	return ranges, nil
+}
+
+// PayloadFile hashes only the audio and video payload of a media file, so
+// copies that differ only in tags or cover art get the same digest
+func (hc *HashCalculator) PayloadFile(filePath string, algorithm HashAlgorithm, progressCallback func(float64)) (*HashResult, error) {
+	file, err := hc.openInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	format, ranges, err := MediaPayload(file, info.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	var total int64
+	readers := make([]io.Reader, len(ranges))
+	for i, r := range ranges {
+		readers[i] = io.NewSectionReader(file, r.Start, r.End-r.Start)
+		total += r.End - r.Start
+	}
+	digests, n, err := hasher.HashReader(io.MultiReader(readers...), []HashAlgorithm{algorithm}, int(hc.ChunkSize), total, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+
+	name := hc.Paths.name(filePath, info.Name())
+	hash := digests[0].Hash
+	return &HashResult{
+		Algorithm: algorithm,
+		Hash:      hash,
+		Filename:  name,
+		Path:      filePath,
+		Basename:  info.Name(),
+		FileSize:  info.Size(),
+		ChunkSize: hc.ChunkSize,
+		Description: fmt.Sprintf("\"%s\", with size of %s, has the %s payload hash %s over %s of %s audio and video data, without tags and metadata.",
+			name, formatBytes(info.Size()), getAlgorithmName(algorithm), hash, formatBytes(n), format),
+		Payload: &PayloadInfo{Format: format, Bytes: n},
+	}, nil
+}
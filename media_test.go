@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mp4Box builds an MP4 box, with a 64-bit size when large is set
+func mp4Box(kind string, large bool, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	if large {
+		box := binary.BigEndian.AppendUint32(nil, 1)
+		box = append(box, kind...)
+		return append(binary.BigEndian.AppendUint64(box, uint64(16+len(body))), body...)
+	}
+	return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(body))), kind...), body...)
+}
+
+// ebml builds an EBML element with an 8-byte size, or an unknown size when data is nil
+func ebml(id []byte, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(body)))
+	size[0] = 0x01
+	if data == nil {
+		size = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+	}
+	return append(append(append([]byte{}, id...), size...), body...)
+}
+
+func TestMediaPayload(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xFF, 0xFB, 0x90, 0x64, 1, 2, 3, 4}, 64)
+	id3 := func(n int) []byte {
+		return append([]byte{'I', 'D', '3', 4, 0, 0, 0, 0, byte(n >> 7), byte(n & 0x7f)}, make([]byte, n)...)
+	}
+	id3v1 := append([]byte("TAG"), make([]byte, 125)...)
+	ape := append([]byte("APETAGEX"), binary.LittleEndian.AppendUint32(nil, 2000)...)
+	ape = append(binary.LittleEndian.AppendUint32(ape, 32+8), make([]byte, 16)...)
+	ape = append(make([]byte, 8), ape...)
+
+	flacBlock := func(kind byte, last bool, n int) []byte {
+		if last {
+			kind |= 0x80
+		}
+		return append([]byte{kind, 0, byte(n >> 8), byte(n)}, make([]byte, n)...)
+	}
+
+	cluster := ebml([]byte{0x1F, 0x43, 0xB6, 0x75}, ebml([]byte{0xE7}, []byte{0}), ebml([]byte{0xA3}, audio))
+	ebmlHeader := ebml([]byte{0x1A, 0x45, 0xDF, 0xA3}, []byte("webm"))
+	tags := func(title string) []byte { return ebml([]byte{0x12, 0x54, 0xC3, 0x67}, []byte(title)) }
+
+	pairs := []struct {
+		format   string
+		original []byte
+		retagged []byte
+	}{
+		{"mp3", bytes.Join([][]byte{id3(20), audio}, nil), bytes.Join([][]byte{id3(300), audio, ape, id3v1}, nil)},
+		{"flac", bytes.Join([][]byte{[]byte("fLaC"), flacBlock(0, false, 34), flacBlock(4, true, 40), audio}, nil),
+			bytes.Join([][]byte{id3(10), []byte("fLaC"), flacBlock(0, false, 34), flacBlock(4, false, 400), flacBlock(6, false, 900), flacBlock(1, true, 100), audio}, nil)},
+		{"mp4", bytes.Join([][]byte{mp4Box("ftyp", false, []byte("M4A ")), mp4Box("moov", false, []byte("udta")), mp4Box("mdat", false, audio)}, nil),
+			bytes.Join([][]byte{mp4Box("ftyp", false, []byte("M4A ")), mp4Box("mdat", true, audio), mp4Box("moov", false, []byte("udta with a longer title"))}, nil)},
+		{"matroska", append(append([]byte{}, ebmlHeader...), ebml([]byte{0x18, 0x53, 0x80, 0x67}, tags("a"), cluster)...),
+			bytes.Join([][]byte{ebmlHeader, ebml([]byte{0x18, 0x53, 0x80, 0x67}), tags("a longer title"), cluster}, nil)},
+	}
+
+	dir := t.TempDir()
+	payloadHashes := map[string]string{}
+	for _, pair := range pairs {
+		var hashes []string
+		for i, data := range [][]byte{pair.original, pair.retagged} {
+			path := filepath.Join(dir, pair.format+string(rune('a'+i)))
+			os.WriteFile(path, data, 0644)
+			result, err := NewHashCalculator().PayloadFile(path, SHA256, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", pair.format, err)
+			}
+			if result.Payload.Format != pair.format {
+				t.Errorf("%s detected as %s", pair.format, result.Payload.Format)
+			}
+			hashes = append(hashes, result.Hash)
+		}
+		payloadHashes[pair.format] = hashes[0]
+		if hashes[0] != hashes[1] {
+			t.Errorf("%s: re-tagged copy has a different payload hash", pair.format)
+		}
+	}
+
+	path := filepath.Join(dir, "changed.mp3")
+	os.WriteFile(path, append(id3(20), append(audio[:len(audio)-1], 9)...), 0644)
+	if result, _ := NewHashCalculator().PayloadFile(path, SHA256, nil); result == nil || result.Hash == payloadHashes["mp3"] {
+		t.Errorf("changed audio not detected: %+v", result)
+	}
+	os.WriteFile(path, []byte("plain text"), 0644)
+	if _, err := NewHashCalculator().PayloadFile(path, SHA256, nil); err == nil {
+		t.Error("expected an error for a file that is not media")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// FileMeta is the permission metadata recorded alongside a file's hashes
+type FileMeta struct {
+	Mode  string `json:"mode"` // Octal permission bits, with setuid, setgid and sticky
+	Owner string `json:"owner,omitempty"`
+	Group string `json:"group,omitempty"`
+	ACL   string `json:"acl,omitempty"`  // Extended POSIX access ACL, as getfacl -c prints it on one line
+	Caps  string `json:"caps,omitempty"` // File capabilities, as getcap prints them
+}
+
+// fileMode formats the permission bits of a file mode in octal
+func fileMode(mode os.FileMode) string {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return fmt.Sprintf("%04o", bits)
+}
+
+// ReadFileMeta reads the mode of a file and, where the platform has them,
+// its owner, group, ACL and capabilities
+func ReadFileMeta(path string) (*FileMeta, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	meta := &FileMeta{Mode: fileMode(info.Mode())}
+	readPlatformMeta(path, info, meta)
+	return meta, nil
+}
+
+// Drift describes how current differs from the recorded metadata, e.g.
+// "mode 0644 → 0755". Owner, group, ACL and capabilities are only compared
+// where the platform reads them.
+func (m *FileMeta) Drift(current *FileMeta) []string {
+	var drift []string
+	compare := func(name, recorded, now string) {
+		if recorded != now {
+			drift = append(drift, fmt.Sprintf("%s %s → %s", name, metaValue(recorded), metaValue(now)))
+		}
+	}
+	compare("mode", m.Mode, current.Mode)
+	if extendedMeta {
+		compare("owner", m.Owner, current.Owner)
+		compare("group", m.Group, current.Group)
+		compare("acl", m.ACL, current.ACL)
+		compare("caps", m.Caps, current.Caps)
+	}
+	return drift
+}
+
+// metaValue shows an empty metadata field as "none"
+func metaValue(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// userName returns the name of a user ID, or the ID when it has none
+func userName(uid uint32) string {
+	id := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(id); err == nil {
+		return u.Username
+	}
+	return id
+}
+
+// groupName returns the name of a group ID, or the ID when it has none
+func groupName(gid uint32) string {
+	id := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(id); err == nil {
+		return g.Name
+	}
+	return id
+}
+
+// POSIX ACL entry tags of the system.posix_acl_access attribute
+const (
+	aclUserObj  = 0x01
+	aclUser     = 0x02
+	aclGroupObj = 0x04
+	aclGroup    = 0x08
+	aclMask     = 0x10
+	aclOther    = 0x20
+)
+
+// decodePosixACL formats a system.posix_acl_access attribute as
+// "user::rw-,user:alice:r--,group::r--,mask::r--,other::---"
+func decodePosixACL(data []byte) (string, error) {
+	if len(data) < 4 || binary.LittleEndian.Uint32(data) != 2 || (len(data)-4)%8 != 0 {
+		return "", fmt.Errorf("unsupported ACL format")
+	}
+	var entries []string
+	for rest := data[4:]; len(rest) > 0; rest = rest[8:] {
+		tag := binary.LittleEndian.Uint16(rest)
+		perm := binary.LittleEndian.Uint16(rest[2:])
+		id := binary.LittleEndian.Uint32(rest[4:])
+		var qualifier string
+		switch tag {
+		case aclUserObj:
+			qualifier = "user:"
+		case aclUser:
+			qualifier = "user:" + userName(id)
+		case aclGroupObj:
+			qualifier = "group:"
+		case aclGroup:
+			qualifier = "group:" + groupName(id)
+		case aclMask:
+			qualifier = "mask:"
+		case aclOther:
+			qualifier = "other:"
+		default:
+			return "", fmt.Errorf("unknown ACL tag %#x", tag)
+		}
+		rwx := []byte("---")
+		for i, c := range "rwx" {
+			if perm&(4>>i) != 0 {
+				rwx[i] = byte(c)
+			}
+		}
+		entries = append(entries, qualifier+":"+string(rwx))
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// capabilityNames are the Linux capabilities by bit number
+var capabilityNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill", "setgid", "setuid",
+	"setpcap", "linux_immutable", "net_bind_service", "net_broadcast", "net_admin", "net_raw",
+	"ipc_lock", "ipc_owner", "sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time", "sys_tty_config", "mknod",
+	"lease", "audit_write", "audit_control", "setfcap", "mac_override", "mac_admin", "syslog",
+	"wake_alarm", "block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+// decodeCapabilities formats a security.capability attribute as getcap
+// does, e.g. "cap_net_admin,cap_net_raw=ep"
+func decodeCapabilities(data []byte) (string, error) {
+	if len(data) != 20 && len(data) != 24 {
+		return "", fmt.Errorf("unsupported capability format")
+	}
+	magic := binary.LittleEndian.Uint32(data)
+	if version := magic &^ 1; version != 0x02000000 && version != 0x03000000 {
+		return "", fmt.Errorf("unsupported capability version %#x", version)
+	}
+	effective := magic&1 != 0
+	permitted := uint64(binary.LittleEndian.Uint32(data[4:])) | uint64(binary.LittleEndian.Uint32(data[12:]))<<32
+	inheritable := uint64(binary.LittleEndian.Uint32(data[8:])) | uint64(binary.LittleEndian.Uint32(data[16:]))<<32
+
+	// Capabilities with the same flags are listed together, in bit order
+	var order []string
+	groups := map[string][]string{}
+	for bit := range 64 {
+		flags := ""
+		if effective && permitted&(1<<bit) != 0 {
+			flags += "e"
+		}
+		if inheritable&(1<<bit) != 0 {
+			flags += "i"
+		}
+		if permitted&(1<<bit) != 0 {
+			flags += "p"
+		}
+		if flags == "" {
+			continue
+		}
+		name := fmt.Sprintf("cap_%d", bit)
+		if bit < len(capabilityNames) {
+			name = "cap_" + capabilityNames[bit]
+		}
+		if groups[flags] == nil {
+			order = append(order, flags)
+		}
+		groups[flags] = append(groups[flags], name)
+	}
+	var clauses []string
+	for _, flags := range order {
+		clauses = append(clauses, strings.Join(groups[flags], ",")+"="+flags)
+	}
+	return strings.Join(clauses, " "), nil
+}
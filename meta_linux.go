@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"syscall"
+)
+
+// extendedMeta reports whether owner, group, ACLs and capabilities are read
+const extendedMeta = true
+
+// readPlatformMeta adds the owner, group, extended ACL and capabilities of a file
+func readPlatformMeta(path string, info os.FileInfo, meta *FileMeta) {
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		meta.Owner = userName(stat.Uid)
+		meta.Group = groupName(stat.Gid)
+	}
+	// Files without the attributes, or on filesystems without xattrs, have none
+	if data := getxattr(path, "system.posix_acl_access"); data != nil {
+		meta.ACL, _ = decodePosixACL(data)
+	}
+	if data := getxattr(path, "security.capability"); data != nil {
+		meta.Caps, _ = decodeCapabilities(data)
+	}
+}
+
+// readSecurityLabel returns the SELinux context of a file, or its Smack
+// label on Smack systems, or "" when it has neither
+func readSecurityLabel(path string) string {
+	for _, name := range []string{"security.selinux", "security.SMACK64"} {
+		if data := getxattr(path, name); data != nil {
+			return strings.TrimRight(string(data), "\x00")
+		}
+	}
+	return ""
+}
+
+// getxattr returns an extended attribute, or nil when it cannot be read
+func getxattr(path, name string) []byte {
+	size, err := syscall.Getxattr(path, name, nil)
+	if err != nil || size <= 0 {
+		return nil
+	}
+	data := make([]byte, size)
+	if size, err = syscall.Getxattr(path, name, data); err != nil {
+		return nil
+	}
+	return data[:size]
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestSecurityLabels(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "sbin")
+	os.MkdirAll(watched, 0755)
+	daemon := filepath.Join(watched, "daemon")
+	os.WriteFile(daemon, []byte("binary"), 0755)
+	// Setting security.* attributes needs CAP_SYS_ADMIN and a filesystem with xattrs
+	if err := syscall.Setxattr(daemon, "security.selinux", []byte("system_u:object_r:bin_t:s0\x00"), 0); err != nil {
+		t.Skipf("Cannot set a security label here: %v", err)
+	}
+	if label := readSecurityLabel(daemon); label != "system_u:object_r:bin_t:s0" {
+		t.Fatalf("readSecurityLabel = %q", label)
+	}
+
+	configPath := filepath.Join(dir, "fim.yaml")
+	os.WriteFile(configPath, []byte("database: "+filepath.Join(dir, "fim.json")+"\nlabels: true\npaths: ["+watched+"]\n"), 0644)
+	config, err := LoadFIMConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	monitor, _ := NewFIMMonitor(config)
+	if changes, err := monitor.Scan(); err != nil || len(changes) != 0 {
+		t.Fatalf("Baseline scan reported %v (%v)", changes, err)
+	}
+	syscall.Setxattr(daemon, "security.selinux", []byte("system_u:object_r:tmp_t:s0\x00"), 0)
+	changes, err := monitor.Scan()
+	if err != nil || len(changes) != 1 || changes[0].Kind != "label" || changes[0].Detail != "system_u:object_r:bin_t:s0 → system_u:object_r:tmp_t:s0" {
+		t.Fatalf("Changes = %+v (%v), want one label change", changes, err)
+	}
+
+	// Verifying against the database flags the relabelled file as drifted
+	entries, err := LoadManifest(filepath.Join(dir, "fim.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Setxattr(daemon, "security.selinux", []byte("unconfined_u:object_r:user_home_t:s0\x00"), 0)
+	root, err := BuildTree(dir, entries, filepath.Join(dir, "fim.json"), NewHashCalculator(), TreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range root.Rows() {
+		if filepath.Base(row.Path) == "daemon" && row.Status != treeDrifted {
+			t.Errorf("daemon: %s (%s), want drifted", row.Status, row.Detail)
+		}
+	}
+}
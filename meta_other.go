@@ -0,0 +1,16 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// extendedMeta reports whether owner, group, ACLs and capabilities are read
+const extendedMeta = false
+
+// readPlatformMeta records only the mode outside Linux
+func readPlatformMeta(path string, info os.FileInfo, meta *FileMeta) {}
+
+// readSecurityLabel returns "", as security labels are only read on Linux
+func readSecurityLabel(path string) string {
+	return ""
+}
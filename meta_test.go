@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestDecodeACLAndCapabilities(t *testing.T) {
+	acl := binary.LittleEndian.AppendUint32(nil, 2)
+	for _, e := range []struct {
+		tag, perm uint16
+		id        uint32
+	}{{aclUserObj, 6, 0xffffffff}, {aclUser, 4, 4242424}, {aclGroupObj, 4, 0xffffffff}, {aclMask, 5, 0xffffffff}, {aclOther, 0, 0xffffffff}} {
+		acl = binary.LittleEndian.AppendUint16(acl, e.tag)
+		acl = binary.LittleEndian.AppendUint16(acl, e.perm)
+		acl = binary.LittleEndian.AppendUint32(acl, e.id)
+	}
+	text, err := decodePosixACL(acl)
+	if want := "user::rw-,user:4242424:r--,group::r--,mask::r-x,other::---"; err != nil || text != want {
+		t.Errorf("decodePosixACL = %q (%v), want %q", text, err, want)
+	}
+
+	// v2 capability data: effective flag, net_bind_service and net_raw permitted, chown inheritable
+	caps := binary.LittleEndian.AppendUint32(nil, 0x02000001)
+	caps = binary.LittleEndian.AppendUint32(caps, 1<<10|1<<13)
+	caps = binary.LittleEndian.AppendUint32(caps, 1)
+	caps = binary.LittleEndian.AppendUint32(caps, 0)
+	caps = binary.LittleEndian.AppendUint32(caps, 0)
+	text, err = decodeCapabilities(caps)
+	if want := "cap_chown=i cap_net_bind_service,cap_net_raw=ep"; err != nil || text != want {
+		t.Errorf("decodeCapabilities = %q (%v), want %q", text, err, want)
+	}
+	if _, err := decodeCapabilities(caps[:8]); err == nil {
+		t.Error("Expected truncated capability data to be rejected")
+	}
+}
+
+func TestPermissionDrift(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permission bits")
+	}
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data")
+	os.MkdirAll(data, 0755)
+	script := filepath.Join(data, "run.sh")
+	os.WriteFile(script, []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(data, "notes.txt"), []byte("notes"), 0644)
+
+	dbPath := filepath.Join(dir, "hashes.json")
+	db, _ := OpenHashDB(dbPath)
+	calc := NewHashCalculator()
+	for _, name := range []string{"run.sh", "notes.txt"} {
+		entry, err := HashFileEntry(calc, filepath.Join(data, name), []HashAlgorithm{SHA256})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Meta, err = ReadFileMeta(filepath.Join(data, name)); err != nil {
+			t.Fatal(err)
+		}
+		db.Put(entry)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if meta, _ := db.Get(script); meta.Meta == nil || meta.Meta.Mode != "0755" {
+		t.Fatalf("Recorded metadata = %+v, want mode 0755", meta.Meta)
+	}
+
+	os.Chmod(script, os.ModeSetuid|0777)
+	entries, err := LoadManifest(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := BuildTree(data, entries, dbPath, calc, TreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := root.Rows()
+	if len(rows) != 2 || rows[0].Status != treeOK || rows[1].Status != treeDrifted || rows[1].Detail != "mode 0755 → 4777" {
+		t.Errorf("Rows = %+v, want run.sh drifted from mode 0755 to 4777", rows)
+	}
+}
+
+func TestFIMPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no Unix permission bits")
+	}
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "bin")
+	os.MkdirAll(watched, 0755)
+	tool := filepath.Join(watched, "tool")
+	os.WriteFile(tool, []byte("binary"), 0755)
+
+	configPath := filepath.Join(dir, "fim.yaml")
+	os.WriteFile(configPath, []byte("database: "+filepath.Join(dir, "fim.json")+"\npermissions: true\npaths: ["+watched+"]\n"), 0644)
+	config, err := LoadFIMConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	monitor, _ := NewFIMMonitor(config)
+	if changes, err := monitor.Scan(); err != nil || len(changes) != 0 {
+		t.Fatalf("Baseline scan reported %v (%v)", changes, err)
+	}
+
+	// A chmod keeps the content and modification time
+	info, _ := os.Stat(tool)
+	os.Chmod(tool, os.ModeSetuid|0755)
+	os.Chtimes(tool, info.ModTime(), info.ModTime())
+	changes, err := monitor.Scan()
+	if err != nil || len(changes) != 1 || changes[0].Kind != "permissions" || changes[0].Detail != "mode 0755 → 4755" {
+		t.Fatalf("Changes = %+v (%v), want one permissions change", changes, err)
+	}
+	if changes, _ := monitor.Scan(); len(changes) != 0 {
+		t.Errorf("Expected no repeated deviations, got %v", changes)
+	}
+}
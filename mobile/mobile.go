@@ -0,0 +1,187 @@
+// Package mobile wraps the hasher package for gomobile, so Android and iOS
+// apps can hash large downloads with the same chunked code as the CLI:
+//
+//	gomobile bind -target=android -o hashculate.aar ./mobile
+//	gomobile bind -target=ios -o Hashculate.xcframework ./mobile
+//
+// The API only uses types gomobile can bind: strings, numbers, byte slices,
+// structs and interfaces implemented on the Java/Swift side.
+package mobile
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// ProgressListener receives the fraction hashed so far, between 0 and 1
+type ProgressListener interface {
+	OnProgress(progress float64)
+}
+
+// Reader supplies a stream in chunks. Read returns up to n bytes; an empty
+// result ends the stream.
+type Reader interface {
+	Read(n int) ([]byte, error)
+}
+
+// Result holds the digests of a file or stream
+type Result struct {
+	File string
+	Size int64
+
+	digests []hasher.Digest
+}
+
+// Hash returns the digest for an algorithm, or an empty string if it was not computed
+func (r *Result) Hash(algorithm string) string {
+	alg, err := hasher.Parse(algorithm)
+	if err != nil {
+		return ""
+	}
+	for _, digest := range r.digests {
+		if digest.Algorithm == alg {
+			return digest.Hash
+		}
+	}
+	return ""
+}
+
+// Description returns the CLI's description sentence for an algorithm
+func (r *Result) Description(algorithm string) string {
+	hash := r.Hash(algorithm)
+	if hash == "" {
+		return ""
+	}
+	alg, _ := hasher.Parse(algorithm)
+	return hasher.Describe(r.File, r.Size, alg, hash)
+}
+
+// JSON returns the -output json document, an array for several algorithms
+func (r *Result) JSON() string {
+	reports := make([]hasher.Report, len(r.digests))
+	for i, digest := range r.digests {
+		reports[i] = hasher.Report{File: r.File, Size: r.Size, Algorithm: digest.Algorithm, Hash: digest.Hash}
+	}
+	var data []byte
+	if len(reports) == 1 {
+		data, _ = json.MarshalIndent(reports[0], "", "  ")
+	} else {
+		data, _ = json.MarshalIndent(reports, "", "  ")
+	}
+	return string(data)
+}
+
+// Stream hashes chunks pushed by the app, e.g. from a download callback
+type Stream struct {
+	name   string
+	stream *hasher.Stream
+}
+
+// parseAlgorithms parses a comma-separated list, defaulting to sha256
+func parseAlgorithms(list string) ([]hasher.Algorithm, error) {
+	if list == "" {
+		list = "sha256"
+	}
+	var algorithms []hasher.Algorithm
+	for _, name := range strings.Split(list, ",") {
+		alg, err := hasher.Parse(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+		algorithms = append(algorithms, alg)
+	}
+	return algorithms, nil
+}
+
+// progressFunc adapts a listener, which may be nil
+func progressFunc(listener ProgressListener) func(float64) {
+	if listener == nil {
+		return nil
+	}
+	return listener.OnProgress
+}
+
+// NewStream starts hashing a stream of size bytes (-1 when unknown) with
+// comma-separated algorithms
+func NewStream(name string, size int64, algorithms string, listener ProgressListener) (*Stream, error) {
+	algs, err := parseAlgorithms(algorithms)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := hasher.NewStream(algs, size, progressFunc(listener))
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{name: name, stream: stream}, nil
+}
+
+// Write hashes the next chunk
+func (s *Stream) Write(data []byte) {
+	s.stream.Write(data)
+}
+
+// Finish completes the progress and returns the digests of everything written
+func (s *Stream) Finish() *Result {
+	s.stream.Done()
+	return &Result{File: s.name, Size: s.stream.Written(), digests: s.stream.Digests()}
+}
+
+// HashFile hashes the file at path with comma-separated algorithms
+func HashFile(path string, algorithms string, listener ProgressListener) (*Result, error) {
+	algs, err := parseAlgorithms(algorithms)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	digests, size, err := hasher.HashReader(file, algs, 0, info.Size(), progressFunc(listener))
+	if err != nil {
+		return nil, err
+	}
+	return &Result{File: filepath.Base(path), Size: size, digests: digests}, nil
+}
+
+// readerAdapter turns a Reader into an io.Reader
+type readerAdapter struct {
+	r Reader
+}
+
+func (a readerAdapter) Read(p []byte) (int, error) {
+	data, err := a.r.Read(len(p))
+	if err != nil {
+		return 0, err
+	}
+	if len(data) == 0 {
+		return 0, io.EOF
+	}
+	if len(data) > len(p) {
+		return 0, errors.New("reader returned more bytes than requested")
+	}
+	return copy(p, data), nil
+}
+
+// HashStream hashes the chunks returned by r. size (-1 when unknown) drives progress.
+func HashStream(r Reader, name string, size int64, algorithms string, listener ProgressListener) (*Result, error) {
+	algs, err := parseAlgorithms(algorithms)
+	if err != nil {
+		return nil, err
+	}
+	digests, n, err := hasher.HashReader(readerAdapter{r}, algs, 0, size, progressFunc(listener))
+	if err != nil {
+		return nil, err
+	}
+	return &Result{File: name, Size: n, digests: digests}, nil
+}
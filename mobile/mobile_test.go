@@ -0,0 +1,60 @@
+package mobile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type progressRecorder struct{ values []float64 }
+
+func (p *progressRecorder) OnProgress(progress float64) { p.values = append(p.values, progress) }
+
+type chunkReader struct{ data []byte }
+
+func (c *chunkReader) Read(n int) ([]byte, error) {
+	n = min(n, len(c.data), 3)
+	chunk := c.data[:n]
+	c.data = c.data[n:]
+	return chunk, nil
+}
+
+func TestMobileBindings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "download.bin")
+	os.WriteFile(path, []byte("hello world"), 0644)
+
+	progress := &progressRecorder{}
+	result, err := HashFile(path, "sha256,md5", progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Hash("md5") != "5eb63bbbe01eeed093cb22bb8f5acdc3" || result.Size != 11 || len(progress.values) == 0 {
+		t.Errorf("Unexpected file result: %+v", result)
+	}
+	if !strings.Contains(result.Description("SHA-256"), `"download.bin", with size of 11 bytes`) {
+		t.Errorf("Unexpected description: %s", result.Description("sha256"))
+	}
+
+	streamed, err := HashStream(&chunkReader{data: []byte("hello world")}, "download.bin", 11, "md5", nil)
+	if err != nil || streamed.Hash("md5") != result.Hash("md5") {
+		t.Errorf("Stream hash differs from file hash: %v", err)
+	}
+
+	pushed, _ := NewStream("download.bin", -1, "sha256", nil)
+	pushed.Write([]byte("hello "))
+	pushed.Write([]byte("world"))
+	want := `{
+  "file": "download.bin",
+  "size": 11,
+  "algorithm": "sha256",
+  "hash": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+}`
+	if got := pushed.Finish().JSON(); got != want {
+		t.Errorf("Unexpected JSON: %s", got)
+	}
+
+	if _, err := HashFile(path, "crc32", nil); err == nil {
+		t.Error("Expected unsupported algorithm to be rejected")
+	}
+}
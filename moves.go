@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// FileMove is a file found at a new path with the digest recorded for an old
+// one, or a directory whose files all moved together
+type FileMove struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Files int    `json:"files,omitempty"` // files moved with a directory; 0 for a single file
+}
+
+// Renamed reports whether the move kept the file in its directory
+func (m FileMove) Renamed() bool {
+	return m.Files == 0 && path.Dir(m.From) == path.Dir(m.To)
+}
+
+// String describes the move as `old → new: MOVED` or `RENAMED`
+func (m FileMove) String() string {
+	switch {
+	case m.Files > 0:
+		return fmt.Sprintf("%s/ → %s/: MOVED (%d files)", m.From, m.To, m.Files)
+	case m.Renamed():
+		return fmt.Sprintf("%s → %s: RENAMED", m.From, m.To)
+	}
+	return fmt.Sprintf("%s → %s: MOVED", m.From, m.To)
+}
+
+// collapseMoves reports a directory whose recorded files all moved to the
+// same relative paths below another as one move, taking the highest such
+// directory, so reorganizing a tree is not listed file by file. recorded
+// holds every path in the manifest.
+func collapseMoves(moves []FileMove, recorded []string) []FileMove {
+	under := map[string]int{}
+	for _, p := range recorded {
+		for dir := path.Dir(p); dir != rootDir; dir = path.Dir(dir) {
+			under[dir]++
+		}
+	}
+
+	// Count the moves each directory pair explains: a/b/x to c/b/x supports
+	// a/b to c/b and a to c
+	type pair struct{ from, to string }
+	pairs := func(move FileMove) []pair {
+		var found []pair
+		from, to := path.Dir(move.From), path.Dir(move.To)
+		for from != rootDir && to != rootDir && from != to {
+			found = append(found, pair{from, to})
+			if path.Base(from) != path.Base(to) {
+				break
+			}
+			from, to = path.Dir(from), path.Dir(to)
+		}
+		return found
+	}
+	supported := map[pair]int{}
+	for _, move := range moves {
+		for _, p := range pairs(move) {
+			supported[p]++
+		}
+	}
+
+	var collapsed []FileMove
+	done := map[pair]bool{}
+	for _, move := range moves {
+		var best *pair
+		for _, p := range pairs(move) {
+			if n := supported[p]; n > 1 && n == under[p.from] {
+				best = &p
+			}
+		}
+		switch {
+		case best == nil:
+			collapsed = append(collapsed, move)
+		case !done[*best]:
+			done[*best] = true
+			collapsed = append(collapsed, FileMove{From: best.from, To: best.to, Files: supported[*best]})
+		}
+	}
+	return collapsed
+}
+
+// matchMoves pairs missing files with new files of the same digest, so a
+// reorganized archive shows moves rather than deletions and additions. Both
+// maps go from path to digest. Among missing files with the digest of a new
+// one, the one with the same base name is preferred.
+func matchMoves(missing, added map[string]string) []FileMove {
+	byDigest := map[string][]string{}
+	for p, digest := range missing {
+		byDigest[digest] = append(byDigest[digest], p)
+	}
+	for _, paths := range byDigest {
+		sort.Strings(paths)
+	}
+	var newPaths []string
+	for p := range added {
+		newPaths = append(newPaths, p)
+	}
+	sort.Strings(newPaths)
+
+	var moves []FileMove
+	for _, to := range newPaths {
+		candidates := byDigest[added[to]]
+		if len(candidates) == 0 {
+			continue
+		}
+		pick := 0
+		for i, from := range candidates {
+			if path.Base(from) == path.Base(to) {
+				pick = i
+				break
+			}
+		}
+		moves = append(moves, FileMove{From: candidates[pick], To: to})
+		byDigest[added[to]] = append(candidates[:pick:pick], candidates[pick+1:]...)
+	}
+	return moves
+}
+
+// Rename moves the file or directory from to the path to in the manifest, as
+// after `mv from to` below its root, and recomputes the rollup digests. It
+// returns the number of files renamed.
+func (m *RollupManifest) Rename(from, to string) (int, error) {
+	from, to = manifestKey(from), manifestKey(to)
+	if from == "" || to == "" {
+		return 0, fmt.Errorf("cannot rename the manifest root")
+	}
+	renamed := map[int]string{}
+	kept := map[string]bool{}
+	for i, file := range m.Files {
+		switch {
+		case file.Path == from:
+			renamed[i] = to
+		case strings.HasPrefix(file.Path, from+"/"):
+			renamed[i] = to + strings.TrimPrefix(file.Path, from)
+		default:
+			kept[file.Path] = true
+		}
+	}
+	if len(renamed) == 0 {
+		return 0, fmt.Errorf("%s is not in the manifest", from)
+	}
+
+	// A file may not land on another file, inside one, or where a directory is
+	for _, target := range renamed {
+		for dir := target; dir != rootDir; dir = path.Dir(dir) {
+			if kept[dir] {
+				return 0, fmt.Errorf("%s is already in the manifest", dir)
+			}
+		}
+		for p := range kept {
+			if strings.HasPrefix(p, target+"/") {
+				return 0, fmt.Errorf("%s is a directory in the manifest", target)
+			}
+		}
+	}
+
+	for i, target := range renamed {
+		m.Files[i].Path = target
+	}
+	directories, _, err := rollupDirectories(m.Algorithm, m.Files)
+	if err != nil {
+		return 0, err
+	}
+	m.Directories, m.Root = directories, directories[rootDir]
+	return len(renamed), nil
+}
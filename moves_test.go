@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileMoves(t *testing.T) {
+	moves := matchMoves(
+		map[string]string{"a/x.iso": "1", "b/x.iso": "1", "a/y": "2", "gone": "3"},
+		map[string]string{"c/x.iso": "1", "c/z": "1", "y": "2", "new": "4"},
+	)
+	if fmt.Sprint(moves) != "[a/x.iso → c/x.iso: MOVED b/x.iso → c/z: MOVED a/y → y: MOVED]" {
+		t.Errorf("unexpected moves %v", moves)
+	}
+
+	root := t.TempDir()
+	for name, content := range map[string]string{"a/one": "one", "a/two": "two", "b/three": "three"} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+	}
+	manifest, err := BuildRollupManifest(root, SHA256, NewHashCalculator())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Reorganizing the tree shows up as moves, not as deletions and additions
+	os.Rename(filepath.Join(root, "a"), filepath.Join(root, "c"))
+	os.Rename(filepath.Join(root, "b", "three"), filepath.Join(root, "three"))
+	check, err := VerifyRollupManifest(manifest, root, NewHashCalculator(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(check.Missing) != 0 || len(check.New) != 0 || len(check.Moved) != 3 {
+		t.Fatalf("unexpected verification %+v", check)
+	}
+	// A directory that moved as a whole is reported once
+	var reported []string
+	for _, move := range collapseMoves(check.Moved, []string{"a/one", "a/two", "b/three"}) {
+		reported = append(reported, move.String())
+	}
+	if want := "[a/ → c/: MOVED (2 files) b/three → three: MOVED]"; fmt.Sprint(reported) != want {
+		t.Errorf("reported %v, want %s", reported, want)
+	}
+	if move := (FileMove{From: "b/three", To: "b/3"}); move.String() != "b/three → b/3: RENAMED" {
+		t.Errorf("unexpected rename %s", move)
+	}
+
+	// Recording the moves in the manifest makes the tree verify again
+	if n, err := manifest.Rename("a", "c"); err != nil || n != 2 {
+		t.Fatalf("rename a: %d, %v", n, err)
+	}
+	if _, err := manifest.Rename("b/three", "three"); err != nil {
+		t.Fatal(err)
+	}
+	if check, err = VerifyRollupManifest(manifest, root, NewHashCalculator(), false); err != nil || !check.RootMatches {
+		t.Errorf("renamed manifest does not match: %+v, %v", check, err)
+	}
+	if _, err := manifest.Rename("three", "c/one"); err == nil {
+		t.Error("expected renaming onto an existing file to fail")
+	}
+
+	// The tree view finds moves against checksum lists too
+	entries := []ManifestEntry{{Path: "c/one", Checksums: map[HashAlgorithm]string{SHA256: manifest.Files[0].Hash}}}
+	os.Rename(filepath.Join(root, "c", "one"), filepath.Join(root, "one"))
+	tree, err := BuildTree(root, entries, "", NewHashCalculator(), TreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Counts[treeMoved] != 1 || tree.Counts[treeMissing] != 0 || tree.Counts[treeNew] != 2 {
+		t.Errorf("unexpected tree counts %v", tree.Counts)
+	}
+}
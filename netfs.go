@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Network filesystem mode settings: large sequential reads kept in flight
+// ahead of hashing hide the per-request latency of SMB and NFS
+const (
+	netfsChunkSize = 16 * 1024 * 1024
+	netfsReadahead = 2
+)
+
+// prefetchReader reads chunks on a background goroutine while earlier chunks are hashed
+type prefetchReader struct {
+	chunks  chan []byte
+	free    chan []byte
+	current []byte
+	pending []byte
+	err     error
+	errOnce chan error
+}
+
+// newPrefetchReader keeps up to depth chunks of chunkSize read ahead of the consumer
+func newPrefetchReader(r io.Reader, chunkSize int64, depth int) *prefetchReader {
+	p := &prefetchReader{
+		chunks:  make(chan []byte, depth),
+		free:    make(chan []byte, depth+1),
+		errOnce: make(chan error, 1),
+	}
+	for i := 0; i < depth+1; i++ {
+		p.free <- make([]byte, chunkSize)
+	}
+	go func() {
+		defer close(p.chunks)
+		for buf := range p.free {
+			n, err := io.ReadFull(r, buf)
+			if n > 0 {
+				p.chunks <- buf[:n]
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				p.errOnce <- io.EOF
+				return
+			}
+			if err != nil {
+				p.errOnce <- err
+				return
+			}
+		}
+	}()
+	return p
+}
+
+func (p *prefetchReader) Read(b []byte) (int, error) {
+	for len(p.pending) == 0 {
+		if p.current != nil {
+			p.free <- p.current[:cap(p.current)]
+			p.current = nil
+		}
+		chunk, ok := <-p.chunks
+		if !ok {
+			if p.err == nil {
+				p.err = <-p.errOnce
+			}
+			return 0, p.err
+		}
+		p.current, p.pending = chunk, chunk
+	}
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+// mountInfo is a mounted filesystem
+type mountInfo struct {
+	Point  string
+	FSType string
+	Source string // Device, share or ZFS dataset
+}
+
+// mountUsage accumulates hashing throughput for one mount
+type mountUsage struct {
+	mountInfo
+	Files   int
+	Bytes   int64
+	Elapsed time.Duration
+}
+
+// MountStats records per-mount throughput so slow shares stand out
+type MountStats struct {
+	mu     sync.Mutex
+	mounts []mountInfo
+	usage  map[string]*mountUsage
+}
+
+// NewMountStats loads the mount table; without one all files count towards "/"
+func NewMountStats() *MountStats {
+	return &MountStats{mounts: readMountTable("/proc/self/mountinfo"), usage: map[string]*mountUsage{}}
+}
+
+// readMountTable parses a Linux mountinfo file
+func readMountTable(path string) []mountInfo {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	var mounts []mountInfo
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		for i, field := range fields {
+			if field == "-" && len(fields) > i+1 && len(fields) > 4 {
+				unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\134`, `\`)
+				mount := mountInfo{Point: unescape.Replace(fields[4]), FSType: fields[i+1]}
+				if len(fields) > i+2 {
+					mount.Source = unescape.Replace(fields[i+2])
+				}
+				mounts = append(mounts, mount)
+				break
+			}
+		}
+	}
+	return mounts
+}
+
+// mountFor finds the mount containing path (the longest matching mount point)
+func (s *MountStats) mountFor(path string) mountInfo {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	best := mountInfo{Point: string(filepath.Separator), FSType: "unknown"}
+	matched := -1
+	for _, m := range s.mounts {
+		if (abs == m.Point || strings.HasPrefix(abs, strings.TrimSuffix(m.Point, "/")+"/")) && len(m.Point) > matched {
+			best, matched = m, len(m.Point)
+		}
+	}
+	return best
+}
+
+// Record adds a hashed file to its mount's totals
+func (s *MountStats) Record(path string, bytes int64, elapsed time.Duration) {
+	mount := s.mountFor(path)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := s.usage[mount.Point]
+	if usage == nil {
+		usage = &mountUsage{mountInfo: mount}
+		s.usage[mount.Point] = usage
+	}
+	usage.Files++
+	usage.Bytes += bytes
+	usage.Elapsed += elapsed
+}
+
+// Print writes one throughput line per mount
+func (s *MountStats) Print(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	points := make([]string, 0, len(s.usage))
+	for point := range s.usage {
+		points = append(points, point)
+	}
+	sort.Strings(points)
+	for _, point := range points {
+		u := s.usage[point]
+		rate := 0.0
+		if u.Elapsed > 0 {
+			rate = float64(u.Bytes) / 1024 / 1024 / u.Elapsed.Seconds()
+		}
+		fmt.Fprintf(w, "Mount %s (%s): %d file(s), %s in %s, %.1f MB/s\n",
+			u.Point, u.FSType, u.Files, formatBytes(u.Bytes), u.Elapsed.Round(time.Millisecond), rate)
+	}
+}
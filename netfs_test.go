@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"testing/iotest"
+
+	"hashculate/hasher"
+)
+
+func TestPrefetchReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+	for _, chunk := range []int64{7, 1000, 10000, 20000} {
+		got, err := io.ReadAll(newPrefetchReader(iotest.HalfReader(bytes.NewReader(data)), chunk, netfsReadahead))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("Chunk size %d: read %d bytes (%v), want %d", chunk, len(got), err, len(data))
+		}
+	}
+
+	calc := &HashCalculator{ChunkSize: 64, Readahead: netfsReadahead, NetFS: true, Stats: NewMountStats()}
+	path := filepath.Join(t.TempDir(), "share.bin")
+	os.WriteFile(path, data, 0644)
+	result, err := calc.CalculateFileHash(path, SHA256, nil)
+	if err != nil {
+		t.Fatalf("Hashing failed: %v", err)
+	}
+	plain, _ := NewHashCalculator().CalculateFileHash(path, SHA256, nil)
+	if result.Hash != plain.Hash || result.FileSize != plain.FileSize {
+		t.Errorf("netfs hash %s (%d bytes) differs from plain hash %s", result.Hash, result.FileSize, plain.Hash)
+	}
+
+	var stats bytes.Buffer
+	calc.Stats.Print(&stats)
+	if !strings.Contains(stats.String(), "1 file(s)") {
+		t.Errorf("Unexpected mount stats: %s", stats.String())
+	}
+}
+
+func TestReadMountTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mountinfo")
+	os.WriteFile(path, []byte("22 1 0:21 / / rw,relatime - ext4 /dev/sda1 rw\n"+
+		"40 22 0:35 / /mnt/team\\040share rw - cifs //nas/team rw,vers=3.1.1\n"), 0644)
+	stats := &MountStats{mounts: readMountTable(path)}
+	if m := stats.mountFor("/mnt/team share/reports/q3.pdf"); m.Point != "/mnt/team share" || m.FSType != "cifs" || m.Source != "//nas/team" {
+		t.Errorf("Unexpected mount for share file: %+v", m)
+	}
+	if m := stats.mountFor("/mnt/team shared.txt"); m.FSType != "ext4" {
+		t.Errorf("Mount prefix matched a sibling path: %+v", m)
+	}
+}
+
+// FuzzCalculatorBackends checks that every way the calculator reads a file
+// gives the digests of a one-shot hash: serially or through the read-ahead
+// pipeline, at any chunk size, with -readonly-assert and from an fs.FS
+func FuzzCalculatorBackends(f *testing.F) {
+	for _, size := range []int{0, 1, 100, 4096} {
+		f.Add(bytes.Repeat([]byte("ab"), size), uint16(64), uint8(3))
+	}
+	f.Add(bytes.Repeat([]byte("0123456789"), 1<<19), uint16(65535), uint8(0))
+
+	algorithms := []HashAlgorithm{SHA256, MD5, CIDV1}
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint16, depth uint8) {
+		path := filepath.Join(t.TempDir(), "input.bin")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		want := make([]string, len(algorithms))
+		for i, algorithm := range algorithms {
+			h, _ := hasher.New(algorithm)
+			h.Write(data)
+			want[i] = formatDigest(algorithm, h.Sum(nil))
+		}
+
+		chunkSize := int64(chunk) + 1
+		backends := map[string]*HashCalculator{
+			"serial":         {ChunkSize: chunkSize},
+			"default chunks": NewHashCalculator(),
+			"read-ahead":     {ChunkSize: chunkSize, Readahead: int(depth%8) + 1},
+			"netfs":          {ChunkSize: chunkSize, Readahead: netfsReadahead, NetFS: true},
+			"read-only":      {ChunkSize: chunkSize, ReadOnly: true},
+			"fs.FS":          {ChunkSize: chunkSize, FS: fstest.MapFS{"input.bin": {Data: data}}},
+		}
+		for name, calc := range backends {
+			input := path
+			if calc.FS != nil {
+				input = "input.bin"
+			}
+			results, err := calc.CalculateFileDigests(input, algorithms, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			for i, result := range results {
+				if result.Hash != want[i] || result.FileSize != int64(len(data)) {
+					t.Errorf("%s: %s = %s (%d bytes), want %s (%d bytes)", name, result.Algorithm, result.Hash, result.FileSize, want[i], len(data))
+				}
+			}
+		}
+	})
+}
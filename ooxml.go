@@ -0,0 +1,121 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// ooxmlDomain starts the canonical form of an Office document, so a content
+// hash can never equal the digest of a file
+const ooxmlDomain = "hashculate ooxml v1"
+
+// ErrNotOOXML is returned for files that are not Office Open XML packages
+var ErrNotOOXML = errors.New("not an Office Open XML (docx, xlsx, pptx) document")
+
+// OOXMLInfo describes what an -ooxml content hash covers
+type OOXMLInfo struct {
+	Type    string `json:"type"` // docx, xlsx, pptx or ooxml
+	Members int    `json:"members"`
+	Bytes   int64  `json:"bytes"` // Uncompressed size of the members
+	Raw     string `json:"raw"`   // Digest of the file itself
+}
+
+// ooxmlType names the kind of document from the parts a package holds
+func ooxmlType(names []string) string {
+	for _, name := range names {
+		switch strings.SplitN(name, "/", 2)[0] {
+		case "word":
+			return "docx"
+		case "xl":
+			return "xlsx"
+		case "ppt":
+			return "pptx"
+		}
+	}
+	return "ooxml"
+}
+
+// CanonicalOOXML writes the members of an Office Open XML package sorted by
+// name, each as its name and uncompressed size followed by its contents.
+// Member order, timestamps, compression and other zip-level details are
+// left out.
+func CanonicalOOXML(w io.Writer, r io.ReaderAt, size int64) (*OOXMLInfo, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrNotOOXML
+	}
+	members := map[string]*zip.File{}
+	var names []string
+	for _, f := range archive.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		name := path.Clean(strings.TrimPrefix(f.Name, "/"))
+		if members[name] != nil {
+			return nil, fmt.Errorf("duplicate member %s", name)
+		}
+		members[name] = f
+		names = append(names, name)
+	}
+	if members["[Content_Types].xml"] == nil {
+		return nil, ErrNotOOXML
+	}
+	sort.Strings(names)
+
+	info := &OOXMLInfo{Type: ooxmlType(names), Members: len(names)}
+	fmt.Fprintf(w, "%s %d\n", ooxmlDomain, len(names))
+	for _, name := range names {
+		f := members[name]
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintf(w, "%s %d\n", name, f.UncompressedSize64)
+		n, err := io.Copy(w, rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		info.Bytes += n
+	}
+	return info, nil
+}
+
+// OOXMLFile hashes the contents of a docx, xlsx or pptx package in canonical
+// member order, so exports that differ only at the zip level compare equal.
+// The digest of the file itself is returned alongside.
+func (hc *HashCalculator) OOXMLFile(filePath string, algorithm HashAlgorithm, progressCallback func(float64)) (*HashResult, error) {
+	raw, err := hc.CalculateFileHash(filePath, algorithm, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+	file, err := hc.openInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+
+	stream, err := hasher.NewStream([]HashAlgorithm{algorithm}, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	info, err := CanonicalOOXML(stream, file, raw.FileSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	info.Raw = raw.Hash
+
+	result := *raw
+	result.Hash = stream.Digests()[0].Hash
+	result.OOXML = info
+	result.Description = fmt.Sprintf("\"%s\", with size of %s, is a %s document with the %s content hash %s over %d members; the file itself has %s.",
+		result.Filename, formatBytes(result.FileSize), info.Type, getAlgorithmName(algorithm), result.Hash, info.Members, raw.Hash)
+	return &result, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testOOXML zips the members in the given order, with one timestamp and compression method
+func testOOXML(members [][2]string, modified time.Time, method uint16) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, m := range members {
+		w, _ := zw.CreateHeader(&zip.FileHeader{Name: m[0], Method: method, Modified: modified})
+		w.Write([]byte(m[1]))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestOOXMLFile(t *testing.T) {
+	dir := t.TempDir()
+	members := [][2]string{
+		{"[Content_Types].xml", "<Types/>"},
+		{"_rels/.rels", "<Relationships/>"},
+		{"word/document.xml", "<w:document>Hello</w:document>"},
+	}
+	reordered := [][2]string{members[2], members[0], members[1]}
+	edited := [][2]string{members[0], members[1], {"word/document.xml", "<w:document>Hullo</w:document>"}}
+	files := map[string][]byte{
+		"a.docx": testOOXML(members, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), zip.Deflate),
+		"b.docx": testOOXML(reordered, time.Date(2025, 6, 7, 8, 9, 10, 0, time.UTC), zip.Store),
+		"c.docx": testOOXML(edited, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), zip.Deflate),
+		"d.zip":  testOOXML(members[1:], time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), zip.Deflate),
+	}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(dir, name), data, 0644)
+	}
+
+	a, err := NewHashCalculator().OOXMLFile(filepath.Join(dir, "a.docx"), SHA256, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewHashCalculator().OOXMLFile(filepath.Join(dir, "b.docx"), SHA256, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash != b.Hash || a.OOXML.Raw == b.OOXML.Raw {
+		t.Errorf("content %s/%s, raw %s/%s", a.Hash, b.Hash, a.OOXML.Raw, b.OOXML.Raw)
+	}
+	if a.OOXML.Type != "docx" || a.OOXML.Members != 3 {
+		t.Errorf("unexpected details: %+v", a.OOXML)
+	}
+	c, err := NewHashCalculator().OOXMLFile(filepath.Join(dir, "c.docx"), SHA256, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Hash == a.Hash {
+		t.Error("changed document content must change the content hash")
+	}
+	if _, err := NewHashCalculator().OOXMLFile(filepath.Join(dir, "d.zip"), SHA256, nil); err == nil {
+		t.Error("expected an error for a zip without [Content_Types].xml")
+	}
+}
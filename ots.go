@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// otsMagic is the header of a detached OpenTimestamps proof file
+var otsMagic = []byte("\x00OpenTimestamps\x00\x00Proof\x00\xbf\x89\xe2\xe8\x84\xe8\x92\x94")
+
+// defaultOTSCalendars are the public calendars used when stamping
+var defaultOTSCalendars = []string{
+	"https://a.pool.opentimestamps.org",
+	"https://b.pool.opentimestamps.org",
+	"https://a.pool.eternitywall.com",
+	"https://ots.btc.catallaxy.com",
+}
+
+// OpenTimestamps operation and attestation tags
+const (
+	otsOpSHA1    = 0x02
+	otsOpSHA256  = 0x08
+	otsOpAppend  = 0xf0
+	otsOpPrepend = 0xf1
+	otsOpReverse = 0xf2
+	otsOpHexlify = 0xf3
+
+	otsAttestationTag = 0x00
+	otsMoreItems      = 0xff
+)
+
+var (
+	otsPendingTag = [8]byte{0x83, 0xdf, 0xe3, 0x0d, 0x2e, 0xf9, 0x0c, 0x8e}
+	otsBitcoinTag = [8]byte{0x05, 0x88, 0x96, 0x0d, 0x73, 0xd7, 0x19, 0x01}
+)
+
+// otsOp is a single commitment operation applied to a message
+type otsOp struct {
+	Tag byte
+	Arg []byte
+}
+
+// otsAttestation states that a message was committed to by some notary
+type otsAttestation struct {
+	Tag     [8]byte
+	Payload []byte
+}
+
+// otsBranch is an operation and the timestamp of its result
+type otsBranch struct {
+	Op    otsOp
+	Child *otsTimestamp
+}
+
+// otsTimestamp is a tree of operations leading from a message to attestations
+type otsTimestamp struct {
+	Msg          []byte
+	Attestations []otsAttestation
+	Branches     []otsBranch
+}
+
+// OTSProof is a detached OpenTimestamps proof for a file digest
+type OTSProof struct {
+	Algorithm HashAlgorithm
+	Timestamp *otsTimestamp
+}
+
+// apply computes the result of the operation on msg
+func (op otsOp) apply(msg []byte) ([]byte, error) {
+	switch op.Tag {
+	case otsOpSHA1:
+		sum := sha1.Sum(msg)
+		return sum[:], nil
+	case otsOpSHA256:
+		sum := sha256.Sum256(msg)
+		return sum[:], nil
+	case otsOpAppend:
+		return append(append([]byte(nil), msg...), op.Arg...), nil
+	case otsOpPrepend:
+		return append(append([]byte(nil), op.Arg...), msg...), nil
+	case otsOpReverse:
+		out := make([]byte, len(msg))
+		for i := range msg {
+			out[i] = msg[len(msg)-1-i]
+		}
+		return out, nil
+	case otsOpHexlify:
+		return []byte(hex.EncodeToString(msg)), nil
+	default:
+		return nil, fmt.Errorf("unsupported OpenTimestamps operation 0x%02x", op.Tag)
+	}
+}
+
+// otsOpHasArg reports whether the operation tag is followed by an argument
+func otsOpHasArg(tag byte) bool {
+	return tag == otsOpAppend || tag == otsOpPrepend
+}
+
+func readVarUint(r *bufio.Reader) (uint64, error) {
+	var value uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("varuint overflow")
+}
+
+func readVarBytes(r *bufio.Reader, max uint64) ([]byte, error) {
+	n, err := readVarUint(r)
+	if err != nil {
+		return nil, err
+	}
+	if n > max {
+		return nil, fmt.Errorf("field of %d bytes exceeds limit of %d", n, max)
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(r, buf)
+	return buf, err
+}
+
+func writeVarUint(w *bytes.Buffer, value uint64) {
+	for value >= 0x80 {
+		w.WriteByte(byte(value) | 0x80)
+		value >>= 7
+	}
+	w.WriteByte(byte(value))
+}
+
+func writeVarBytes(w *bytes.Buffer, data []byte) {
+	writeVarUint(w, uint64(len(data)))
+	w.Write(data)
+}
+
+// readOTSTimestamp deserializes a timestamp tree starting from msg
+func readOTSTimestamp(r *bufio.Reader, msg []byte, depth int) (*otsTimestamp, error) {
+	if depth > 256 {
+		return nil, fmt.Errorf("timestamp nested too deeply")
+	}
+	ts := &otsTimestamp{Msg: msg}
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		more := tag == otsMoreItems
+		if more {
+			if tag, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+
+		if tag == otsAttestationTag {
+			var att otsAttestation
+			if _, err := io.ReadFull(r, att.Tag[:]); err != nil {
+				return nil, err
+			}
+			if att.Payload, err = readVarBytes(r, 8192); err != nil {
+				return nil, err
+			}
+			ts.Attestations = append(ts.Attestations, att)
+		} else {
+			op := otsOp{Tag: tag}
+			if otsOpHasArg(tag) {
+				if op.Arg, err = readVarBytes(r, 4096); err != nil {
+					return nil, err
+				}
+			}
+			result, err := op.apply(msg)
+			if err != nil {
+				return nil, err
+			}
+			child, err := readOTSTimestamp(r, result, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			ts.Branches = append(ts.Branches, otsBranch{Op: op, Child: child})
+		}
+
+		if !more {
+			return ts, nil
+		}
+	}
+}
+
+// serialize writes the timestamp tree in OpenTimestamps binary form
+func (ts *otsTimestamp) serialize(w *bytes.Buffer) {
+	items := len(ts.Attestations) + len(ts.Branches)
+	written := 0
+	next := func() {
+		written++
+		if written < items {
+			w.WriteByte(otsMoreItems)
+		}
+	}
+	for _, att := range ts.Attestations {
+		next()
+		w.WriteByte(otsAttestationTag)
+		w.Write(att.Tag[:])
+		writeVarBytes(w, att.Payload)
+	}
+	for _, branch := range ts.Branches {
+		next()
+		w.WriteByte(branch.Op.Tag)
+		if otsOpHasArg(branch.Op.Tag) {
+			writeVarBytes(w, branch.Op.Arg)
+		}
+		branch.Child.serialize(w)
+	}
+}
+
+// merge adds the attestations and branches of other, which must commit to the same message
+func (ts *otsTimestamp) merge(other *otsTimestamp) {
+	ts.Attestations = append(ts.Attestations, other.Attestations...)
+	ts.Branches = append(ts.Branches, other.Branches...)
+}
+
+// walk calls fn for every node of the tree
+func (ts *otsTimestamp) walk(fn func(node *otsTimestamp)) {
+	fn(ts)
+	for _, branch := range ts.Branches {
+		branch.Child.walk(fn)
+	}
+}
+
+// otsFileOp returns the operation tag used to hash the stamped file
+func otsFileOp(algorithm HashAlgorithm) (byte, error) {
+	switch algorithm {
+	case SHA1:
+		return otsOpSHA1, nil
+	case SHA256:
+		return otsOpSHA256, nil
+	default:
+		return 0, fmt.Errorf("OpenTimestamps supports sha1 and sha256 digests, not %s", algorithm)
+	}
+}
+
+// ParseOTSProof parses a detached .ots proof file
+func ParseOTSProof(data []byte) (*OTSProof, error) {
+	if !bytes.HasPrefix(data, otsMagic) {
+		return nil, fmt.Errorf("not an OpenTimestamps proof")
+	}
+	r := bufio.NewReader(bytes.NewReader(data[len(otsMagic):]))
+	version, err := readVarUint(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenTimestamps proof: %w", err)
+	}
+	if version != 1 {
+		return nil, fmt.Errorf("unsupported OpenTimestamps proof version %d", version)
+	}
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, fmt.Errorf("invalid OpenTimestamps proof: %w", err)
+	}
+	proof := &OTSProof{}
+	var size int
+	switch tag {
+	case otsOpSHA1:
+		proof.Algorithm, size = SHA1, sha1.Size
+	case otsOpSHA256:
+		proof.Algorithm, size = SHA256, sha256.Size
+	default:
+		return nil, fmt.Errorf("unsupported OpenTimestamps file hash 0x%02x", tag)
+	}
+	digest := make([]byte, size)
+	if _, err := io.ReadFull(r, digest); err != nil {
+		return nil, fmt.Errorf("invalid OpenTimestamps proof: %w", err)
+	}
+	if proof.Timestamp, err = readOTSTimestamp(r, digest, 0); err != nil {
+		return nil, fmt.Errorf("invalid OpenTimestamps proof: %w", err)
+	}
+	if _, err := r.ReadByte(); err != io.EOF {
+		return nil, fmt.Errorf("invalid OpenTimestamps proof: trailing data")
+	}
+	return proof, nil
+}
+
+// Bytes serializes the proof as a detached .ots file
+func (p *OTSProof) Bytes() []byte {
+	var buf bytes.Buffer
+	buf.Write(otsMagic)
+	writeVarUint(&buf, 1)
+	tag, _ := otsFileOp(p.Algorithm)
+	buf.WriteByte(tag)
+	buf.Write(p.Timestamp.Msg)
+	p.Timestamp.serialize(&buf)
+	return buf.Bytes()
+}
+
+// otsClient is used for calendar and block explorer requests
+var otsClient = &http.Client{Timeout: 30 * time.Second}
+
+// StampOTS submits a file digest to OpenTimestamps calendars. A random nonce is
+// appended before hashing so calendars never learn the file digest itself.
+func StampOTS(algorithm HashAlgorithm, digest []byte, calendars []string) (*OTSProof, error) {
+	if _, err := otsFileOp(algorithm); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	root := &otsTimestamp{Msg: digest}
+	appendOp := otsOp{Tag: otsOpAppend, Arg: nonce}
+	appended, _ := appendOp.apply(digest)
+	hashOp := otsOp{Tag: otsOpSHA256}
+	commitment, _ := hashOp.apply(appended)
+	tip := &otsTimestamp{Msg: commitment}
+	root.Branches = []otsBranch{{Op: appendOp, Child: &otsTimestamp{
+		Msg:      appended,
+		Branches: []otsBranch{{Op: hashOp, Child: tip}},
+	}}}
+
+	var errs []error
+	for _, calendar := range calendars {
+		calendar = strings.TrimRight(calendar, "/")
+		resp, err := otsClient.Post(calendar+"/digest", "application/x-www-form-urlencoded", bytes.NewReader(commitment))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ts, err := readCalendarTimestamp(resp, commitment)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", calendar, err))
+			continue
+		}
+		tip.merge(ts)
+	}
+	if len(tip.Attestations) == 0 && len(tip.Branches) == 0 {
+		return nil, fmt.Errorf("no calendar accepted the digest: %w", errors.Join(errs...))
+	}
+	return &OTSProof{Algorithm: algorithm, Timestamp: root}, nil
+}
+
+// readCalendarTimestamp parses a calendar response committing to msg
+func readCalendarTimestamp(resp *http.Response, msg []byte) (*otsTimestamp, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar returned HTTP %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	return readOTSTimestamp(bufio.NewReader(bytes.NewReader(body)), msg, 0)
+}
+
+// Upgrade asks calendars for completed proofs of pending attestations and
+// returns the number of attestations that were upgraded.
+func (p *OTSProof) Upgrade() int {
+	upgraded := 0
+	p.Timestamp.walk(func(node *otsTimestamp) {
+		var kept []otsAttestation
+		for _, att := range node.Attestations {
+			if att.Tag != otsPendingTag {
+				kept = append(kept, att)
+				continue
+			}
+			calendar, err := pendingURI(att)
+			if err == nil {
+				var resp *http.Response
+				resp, err = otsClient.Get(strings.TrimRight(calendar, "/") + "/timestamp/" + hex.EncodeToString(node.Msg))
+				if err == nil {
+					var ts *otsTimestamp
+					if ts, err = readCalendarTimestamp(resp, node.Msg); err == nil && ts.complete() {
+						node.Branches = append(node.Branches, ts.Branches...)
+						kept = append(kept, ts.Attestations...)
+						upgraded++
+						continue
+					}
+				}
+			}
+			kept = append(kept, att)
+		}
+		node.Attestations = kept
+	})
+	return upgraded
+}
+
+// complete reports whether the tree contains any non-pending attestation
+func (ts *otsTimestamp) complete() bool {
+	found := false
+	ts.walk(func(node *otsTimestamp) {
+		for _, att := range node.Attestations {
+			if att.Tag != otsPendingTag {
+				found = true
+			}
+		}
+	})
+	return found
+}
+
+// pendingURI returns the calendar URI of a pending attestation
+func pendingURI(att otsAttestation) (string, error) {
+	uri, err := readVarBytes(bufio.NewReader(bytes.NewReader(att.Payload)), 1000)
+	if err != nil {
+		return "", fmt.Errorf("invalid pending attestation: %w", err)
+	}
+	for _, c := range uri {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("._/:-", c) >= 0) {
+			return "", fmt.Errorf("invalid character in calendar URI %q", uri)
+		}
+	}
+	return string(uri), nil
+}
+
+// bitcoinHeight returns the block height of a Bitcoin attestation
+func bitcoinHeight(att otsAttestation) (uint64, error) {
+	return readVarUint(bufio.NewReader(bytes.NewReader(att.Payload)))
+}
+
+// verifyBitcoinAttestation checks msg against the merkle root of a block via an Esplora API
+func verifyBitcoinAttestation(esplora string, height uint64, msg []byte) (time.Time, error) {
+	esplora = strings.TrimRight(esplora, "/")
+	resp, err := otsClient.Get(fmt.Sprintf("%s/block-height/%d", esplora, height))
+	if err != nil {
+		return time.Time{}, err
+	}
+	blockHash, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return time.Time{}, fmt.Errorf("block %d not found (HTTP %s)", height, resp.Status)
+	}
+
+	resp, err = otsClient.Get(esplora + "/block/" + strings.TrimSpace(string(blockHash)))
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer resp.Body.Close()
+	var block struct {
+		MerkleRoot string `json:"merkle_root"`
+		Timestamp  int64  `json:"timestamp"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&block); err != nil {
+		return time.Time{}, fmt.Errorf("invalid block header: %w", err)
+	}
+
+	// Explorers display the merkle root byte-reversed relative to the header
+	reversed, _ := otsOp{Tag: otsOpReverse}.apply(msg)
+	if hex.EncodeToString(reversed) != strings.ToLower(block.MerkleRoot) {
+		return time.Time{}, fmt.Errorf("merkle root of block %d does not match proof", height)
+	}
+	return time.Unix(block.Timestamp, 0).UTC(), nil
+}
+
+// runVerifyOTS verifies a file against an OpenTimestamps proof
+func runVerifyOTS(filePath, proofPath string, data []byte, upgrade bool, esplora string) int {
+	proof, err := ParseOTSProof(data)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	result, err := NewHashCalculator().CalculateFileHash(filePath, proof.Algorithm, nil)
+	if err != nil {
+		fmt.Printf("Error calculating hash: %v\n", err)
+		return 1
+	}
+	if result.Hash != hex.EncodeToString(proof.Timestamp.Msg) {
+		fmt.Printf("FAILED: %s: proof covers %x, file has %s %s\n", filePath, proof.Timestamp.Msg, getAlgorithmName(proof.Algorithm), result.Hash)
+		return 1
+	}
+
+	if upgrade {
+		if n := proof.Upgrade(); n > 0 {
+			if err := os.WriteFile(proofPath, proof.Bytes(), 0644); err != nil {
+				fmt.Printf("Error writing upgraded proof: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Upgraded %d pending attestation(s) in %s\n", n, proofPath)
+		}
+	}
+
+	verified, failed := 0, 0
+	proof.Timestamp.walk(func(node *otsTimestamp) {
+		for _, att := range node.Attestations {
+			switch att.Tag {
+			case otsPendingTag:
+				uri, err := pendingURI(att)
+				if err != nil {
+					fmt.Printf("Invalid attestation: %v\n", err)
+					failed++
+					continue
+				}
+				fmt.Printf("Pending confirmation at %s\n", uri)
+			case otsBitcoinTag:
+				height, err := bitcoinHeight(att)
+				if err != nil {
+					fmt.Printf("Invalid Bitcoin attestation: %v\n", err)
+					failed++
+					continue
+				}
+				when, err := verifyBitcoinAttestation(esplora, height, node.Msg)
+				if err != nil {
+					fmt.Printf("Bitcoin block %d attestation could not be verified: %v\n", height, err)
+					failed++
+					continue
+				}
+				fmt.Printf("Bitcoin block %d attests existence as of %s\n", height, when.Format(time.RFC3339))
+				verified++
+			default:
+				fmt.Printf("Unknown attestation %x\n", att.Tag)
+			}
+		}
+	})
+
+	switch {
+	case verified > 0:
+		fmt.Printf("OK: %s existed with %s %s\n", filePath, getAlgorithmName(proof.Algorithm), result.Hash)
+		return 0
+	case failed > 0:
+		fmt.Printf("FAILED: %s: no attestation could be verified\n", filePath)
+		return 1
+	default:
+		fmt.Printf("PENDING: %s matches the proof, but it is not confirmed yet; retry later with -upgrade\n", filePath)
+		return 1
+	}
+}
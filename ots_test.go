@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOTSStampUpgradeVerify(t *testing.T) {
+	upgradeSuffix := []byte("block-merkle-path")
+	var calendarURL string
+	var merkleRoot []byte
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/digest", func(w http.ResponseWriter, r *http.Request) {
+		// Commit to the submitted digest with a pending attestation
+		var buf bytes.Buffer
+		buf.WriteByte(otsAttestationTag)
+		buf.Write(otsPendingTag[:])
+		var uri bytes.Buffer
+		writeVarBytes(&uri, []byte(calendarURL))
+		writeVarBytes(&buf, uri.Bytes())
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/timestamp/", func(w http.ResponseWriter, r *http.Request) {
+		msg, _ := hex.DecodeString(strings.TrimPrefix(r.URL.Path, "/timestamp/"))
+		appended := append(append([]byte(nil), msg...), upgradeSuffix...)
+		sum := sha256.Sum256(appended)
+		merkleRoot = sum[:]
+
+		var buf bytes.Buffer
+		buf.WriteByte(otsOpAppend)
+		writeVarBytes(&buf, upgradeSuffix)
+		buf.WriteByte(otsOpSHA256)
+		buf.WriteByte(otsAttestationTag)
+		buf.Write(otsBitcoinTag[:])
+		var height bytes.Buffer
+		writeVarUint(&height, 800000)
+		writeVarBytes(&buf, height.Bytes())
+		w.Write(buf.Bytes())
+	})
+	mux.HandleFunc("/api/block-height/800000", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "00000000blockhash")
+	})
+	mux.HandleFunc("/api/block/00000000blockhash", func(w http.ResponseWriter, r *http.Request) {
+		reversed, _ := otsOp{Tag: otsOpReverse}.apply(merkleRoot)
+		fmt.Fprintf(w, `{"merkle_root":"%x","timestamp":1690168629}`, reversed)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	calendarURL = server.URL
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "evidence.txt")
+	if err := os.WriteFile(filePath, []byte("evidence"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	digest := sha256.Sum256([]byte("evidence"))
+
+	proof, err := StampOTS(SHA256, digest[:], []string{server.URL})
+	if err != nil {
+		t.Fatalf("Stamp failed: %v", err)
+	}
+	proofPath := filePath + ".ots"
+	if err := os.WriteFile(proofPath, proof.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write proof: %v", err)
+	}
+
+	// Round trip through the binary format
+	parsed, err := ParseOTSProof(proof.Bytes())
+	if err != nil {
+		t.Fatalf("Failed to parse proof: %v", err)
+	}
+	if !bytes.Equal(parsed.Bytes(), proof.Bytes()) {
+		t.Error("Proof does not survive a serialization round trip")
+	}
+
+	esplora := server.URL + "/api"
+	if code := runVerifyOTS(filePath, proofPath, proof.Bytes(), false, esplora); code == 0 {
+		t.Error("Expected pending proof not to verify")
+	}
+	if code := runVerifyOTS(filePath, proofPath, proof.Bytes(), true, esplora); code != 0 {
+		t.Errorf("Expected upgraded proof to verify, got exit code %d", code)
+	}
+	upgraded, _ := os.ReadFile(proofPath)
+	if parsed, err := ParseOTSProof(upgraded); err != nil || !parsed.Timestamp.complete() {
+		t.Errorf("Expected upgraded proof on disk to be complete (err: %v)", err)
+	}
+
+	// A modified file must not match the proof
+	if err := os.WriteFile(filePath, []byte("tampered"), 0644); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+	if code := runVerifyOTS(filePath, proofPath, upgraded, false, esplora); code == 0 {
+		t.Error("Expected modified file to fail verification")
+	}
+}
@@ -0,0 +1,34 @@
+//go:build linux && (amd64 || arm64 || loong64 || ppc64 || ppc64le || riscv64 || mips64 || mips64le)
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// POSIX_FADV_WILLNEED and POSIX_FADV_DONTNEED on these architectures
+const (
+	posixFadvWillNeed = 3
+	posixFadvDontNeed = 4
+)
+
+// dropPageCache asks the kernel to evict a file's cached pages, so that the
+// next read comes from the storage device. It reports whether it succeeded.
+func dropPageCache(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	file.Sync()
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, file.Fd(), 0, 0, posixFadvDontNeed, 0, 0)
+	return errno == 0
+}
+
+// prefetchPages asks the kernel to start reading the first length bytes of f
+// into the page cache without waiting for them. It reports whether it succeeded.
+func prefetchPages(f *os.File, length int64) bool {
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, uintptr(length), posixFadvWillNeed, 0, 0)
+	return errno == 0
+}
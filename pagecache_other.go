@@ -0,0 +1,15 @@
+//go:build !(linux && (amd64 || arm64 || loong64 || ppc64 || ppc64le || riscv64 || mips64 || mips64le))
+
+package main
+
+import "os"
+
+// dropPageCache is not supported here; the second read may be served from cache
+func dropPageCache(path string) bool {
+	return false
+}
+
+// prefetchPages is not supported here; files are warmed by reading them
+func prefetchPages(f *os.File, length int64) bool {
+	return false
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// RunParameters are the settings a report or database was produced with, so a
+// later verification can run with the same ones and say where its own differ
+type RunParameters struct {
+	Version    string          `json:"version"`
+	Algorithms []HashAlgorithm `json:"algorithms"`
+	ChunkSize  int64           `json:"chunkSize,omitempty"`
+	Mode       string          `json:"mode,omitempty"`     // Digest variant: pdf, ooxml, payload, pixels, sample or concat
+	SampleMB   int             `json:"sampleMB,omitempty"` // With the sample mode
+	PathMode   PathMode        `json:"pathMode,omitempty"`
+	Includes   []string        `json:"includes,omitempty"` // Patterns of the only files hashed, as given
+	Excludes   []string        `json:"excludes,omitempty"` // Patterns of paths left out, as given
+	Options    []string        `json:"options,omitempty"`  // Other switches that shape which files or fields are recorded
+	Host       string          `json:"host,omitempty"`     // Only with -record-host
+}
+
+// toolVersion is the module version of this build, or its VCS revision
+var toolVersion = sync.OnceValue(func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" && len(setting.Value) >= 12 {
+			return setting.Value[:12]
+		}
+	}
+	return "devel"
+})
+
+// newRunParameters describes a run with this build, recording the hostname when asked
+func newRunParameters(algorithms []HashAlgorithm, chunkSize int64, recordHost bool) *RunParameters {
+	params := &RunParameters{Version: toolVersion(), Algorithms: algorithms, ChunkSize: chunkSize}
+	if recordHost {
+		params.Host, _ = os.Hostname()
+	}
+	return params
+}
+
+// Drift lists the settings in which a run with current differs from p
+func (p *RunParameters) Drift(current *RunParameters) []string {
+	var drift []string
+	change := func(what, from, to string) {
+		if from != to {
+			drift = append(drift, fmt.Sprintf("%s %s → %s", what, metaValue(from), metaValue(to)))
+		}
+	}
+	algorithms := func(list []HashAlgorithm) string {
+		names := make([]string, len(list))
+		for i, alg := range list {
+			names[i] = string(alg)
+		}
+		return strings.Join(names, ",")
+	}
+	megabytes := func(size int64) string {
+		if size == 0 {
+			return ""
+		}
+		return fmt.Sprintf("%d MB", size>>20)
+	}
+	sample := func(p *RunParameters) string {
+		if p.Mode != "sample" {
+			return p.Mode
+		}
+		return "sample " + strconv.Itoa(p.SampleMB) + " MB"
+	}
+	change("version", p.Version, current.Version)
+	change("algorithm", algorithms(p.Algorithms), algorithms(current.Algorithms))
+	change("chunk size", megabytes(p.ChunkSize), megabytes(current.ChunkSize))
+	change("mode", sample(p), sample(current))
+	change("path mode", string(p.PathMode), string(current.PathMode))
+	change("includes", strings.Join(p.Includes, ","), strings.Join(current.Includes, ","))
+	change("excludes", strings.Join(p.Excludes, ","), strings.Join(current.Excludes, ","))
+	change("options", strings.Join(p.Options, ","), strings.Join(current.Options, ","))
+	return drift
+}
+
+// digest describes what the digest of a run is, e.g. "SHA-256 (pdf)"
+func (p *RunParameters) digest() string {
+	names := make([]string, len(p.Algorithms))
+	for i, alg := range p.Algorithms {
+		names[i] = getAlgorithmName(alg)
+	}
+	switch p.Mode {
+	case "":
+		return strings.Join(names, ", ")
+	case "sample":
+		return fmt.Sprintf("%s (sample of %d MB)", strings.Join(names, ", "), p.SampleMB)
+	}
+	return fmt.Sprintf("%s (%s)", strings.Join(names, ", "), p.Mode)
+}
+
+// manifestParameters returns the parameters a hash database or JSON report
+// records, or nil for other manifests and those written before they were kept
+func manifestParameters(path string) *RunParameters {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var recorded struct {
+		Parameters *RunParameters `json:"parameters"`
+	}
+	if json.Unmarshal(data, &recorded) != nil {
+		return nil
+	}
+	return recorded.Parameters
+}
+
+// loadReplay reads the single-file JSON report a run is to repeat
+func loadReplay(path string) (*JSONReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report JSONReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("%s is not a single-file JSON report: %w", path, err)
+	}
+	if report.Parameters == nil {
+		return nil, fmt.Errorf("%s records no parameters; it was written before reports kept them", path)
+	}
+	if _, _, ok, _ := parseDigestURI(report.Hash); !ok && checkDigestLength(report.Algorithm, report.Hash, false) != nil {
+		return nil, fmt.Errorf("%s holds a shortened or re-encoded digest; replay needs the full hex digest or a digest URI", path)
+	}
+	return &report, nil
+}
+
+// replayFlags sets the flags a report's parameters call for, except those
+// given on the command line, which win and show up as drift instead
+func replayFlags(flags *flag.FlagSet, report *JSONReport, explicit map[string]bool) error {
+	p := report.Parameters
+	set := func(value string, names ...string) error {
+		if slices.ContainsFunc(names, func(name string) bool { return explicit[name] }) {
+			return nil
+		}
+		return flags.Set(names[0], value)
+	}
+	algorithm := string(report.Algorithm)
+	if p.Mode == pixelsAlgorithm {
+		algorithm = pixelsAlgorithm
+	}
+	settings := [][]string{
+		{algorithm, "algorithm", "a"},
+		{string(p.PathMode), "path-mode"},
+		{report.Hash, "expect"},
+	}
+	if p.ChunkSize > 0 {
+		settings = append(settings, []string{strconv.FormatInt(p.ChunkSize>>20, 10), "chunk-size", "c"})
+	}
+	switch p.Mode {
+	case "pdf", "ooxml", "payload", "concat":
+		settings = append(settings, []string{"true", p.Mode})
+	case "sample":
+		settings = append(settings, []string{strconv.Itoa(p.SampleMB), "sample"})
+	}
+	for _, setting := range settings {
+		if err := set(setting[0], setting[1:]...); err != nil {
+			return fmt.Errorf("-%s %s: %w", setting[1], setting[0], err)
+		}
+	}
+	return nil
+}
+
+// loadReports reads the JSON report of a single file or a batch written with
+// -output json, and reports false when the file holds something else
+func loadReports(path string) ([]JSONReport, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	data = bytes.TrimSpace(data)
+	var reports []JSONReport
+	switch {
+	case bytes.HasPrefix(data, []byte("[")):
+		if json.Unmarshal(data, &reports) != nil {
+			return nil, false
+		}
+	case bytes.HasPrefix(data, []byte("{")):
+		var report JSONReport
+		if json.Unmarshal(data, &report) != nil {
+			return nil, false
+		}
+		reports = []JSONReport{report}
+	}
+	// Batches list files that could not be hashed by name and error only
+	hashed := slices.ContainsFunc(reports, func(r JSONReport) bool { return r.Hash != "" && r.Algorithm != "" })
+	return reports, hashed && !slices.ContainsFunc(reports, func(r JSONReport) bool { return r.File == "" })
+}
+
+// hashAsRecorded hashes the file of a report with the algorithm, digest mode
+// and chunk size the report records
+func (hc *HashCalculator) hashAsRecorded(report JSONReport) (*HashResult, error) {
+	path := cmp.Or(report.Path, report.File)
+	p := report.Parameters
+	if p == nil {
+		return hc.CalculateFileHash(path, report.Algorithm, nil)
+	}
+	// A copy takes the recorded chunk size, so it cannot carry over to later reports
+	recorded := *hc
+	if p.ChunkSize > 0 {
+		recorded.ChunkSize = p.ChunkSize
+	}
+	hc = &recorded
+	switch p.Mode {
+	case pixelsAlgorithm:
+		return hc.PixelFile(path)
+	case "pdf":
+		return hc.PDFFile(path, report.Algorithm, nil)
+	case "ooxml":
+		return hc.OOXMLFile(path, report.Algorithm, nil)
+	case "payload":
+		return hc.PayloadFile(path, report.Algorithm, nil)
+	case "sample":
+		return hc.SampleFile(path, report.Algorithm, int64(p.SampleMB)<<20)
+	case "concat":
+		// Parts recorded by name alone lie next to the first one
+		parts := make([]string, len(report.Parts))
+		for i, part := range report.Parts {
+			parts[i] = filepath.FromSlash(part.Name)
+			if !strings.ContainsAny(part.Name, `/\`) {
+				parts[i] = filepath.Join(filepath.Dir(path), part.Name)
+			}
+		}
+		return hc.ConcatFiles(parts, report.Algorithm, nil)
+	}
+	return hc.CalculateFileHash(path, report.Algorithm, nil)
+}
+
+// noteParameters prints the settings p records and how the running version
+// differs, skipping lines already noted
+func noteParameters(w io.Writer, p *RunParameters, noted map[string]bool) {
+	settings := p.digest()
+	if p.ChunkSize > 0 {
+		settings += fmt.Sprintf(", %d MB chunks", p.ChunkSize>>20)
+	}
+	if !noted[settings] {
+		noted[settings] = true
+		fmt.Fprintf(w, "Recorded settings: %s\n", settings)
+	}
+	current := *p
+	current.Version = toolVersion()
+	for _, drift := range p.Drift(&current) {
+		if !noted[drift] {
+			noted[drift] = true
+			fmt.Fprintf(w, "Settings drift: %s\n", drift)
+		}
+	}
+}
+
+// verifyReports hashes the files of JSON reports again the way each report
+// records, noting the settings applied and where this build differs
+func verifyReports(w io.Writer, reports []JSONReport, calculator *HashCalculator) []SBOMCheckResult {
+	noted := map[string]bool{}
+	var checks []SBOMCheckResult
+	for _, report := range reports {
+		check := SBOMCheckResult{Path: cmp.Or(report.Path, report.File), Algorithm: report.Algorithm, Status: "UNSUPPORTED"}
+		if report.Hash == "" {
+			check.Err = fmt.Errorf("not hashed when the report was written")
+			checks = append(checks, check)
+			continue
+		}
+		check.Expected = report.Hash
+		if _, digest, ok, err := parseDigestURI(report.Hash); ok && err == nil {
+			check.Expected = digest
+		} else if checkDigestLength(report.Algorithm, report.Hash, false) != nil {
+			check.Err = fmt.Errorf("the report holds a shortened or re-encoded digest")
+			checks = append(checks, check)
+			continue
+		}
+
+		if report.Parameters != nil {
+			noteParameters(w, report.Parameters, noted)
+		}
+
+		result, err := calculator.hashAsRecorded(report)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			check.Status = "MISSING"
+		case err != nil:
+			check.Status, check.Err = "FAILED", err
+		case result.Hash != check.Expected:
+			check.Status, check.Actual = "FAILED", result.Hash
+		default:
+			check.Status, check.Actual = "OK", result.Hash
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
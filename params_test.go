@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"hashculate/hasher"
+)
+
+func TestRunParametersDrift(t *testing.T) {
+	recorded := &RunParameters{Version: "v1.2.0", Algorithms: []HashAlgorithm{SHA256}, ChunkSize: 4 << 20, Mode: "sample", SampleMB: 8}
+	current := &RunParameters{Version: "v1.3.0", Algorithms: []HashAlgorithm{SHA256}, ChunkSize: 16 << 20, Mode: "sample", SampleMB: 8, Host: "elsewhere"}
+	want := []string{"version v1.2.0 → v1.3.0", "chunk size 4 MB → 16 MB"}
+	if drift := recorded.Drift(current); !slices.Equal(drift, want) {
+		t.Errorf("drift %q, want %q", drift, want)
+	}
+	if drift := recorded.Drift(recorded); len(drift) != 0 {
+		t.Errorf("identical settings drifted: %q", drift)
+	}
+}
+
+func TestReplayFlags(t *testing.T) {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	algorithm := flags.String("algorithm", "md5", "")
+	flags.String("a", "md5", "")
+	chunkSize := flags.Int("chunk-size", 4, "")
+	flags.Int("c", 4, "")
+	pathMode := flags.String("path-mode", "", "")
+	expect := flags.String("expect", "", "")
+	pdf := flags.Bool("pdf", false, "")
+	flags.Parse([]string{"-c", "8"})
+
+	report := &JSONReport{Parameters: &RunParameters{Algorithms: []HashAlgorithm{SHA256}, ChunkSize: 16 << 20, Mode: "pdf", PathMode: PathModeRelative}}
+	report.Algorithm, report.Hash = SHA256, strings.Repeat("ab", 32)
+	if err := replayFlags(flags, report, map[string]bool{"c": true}); err != nil {
+		t.Fatal(err)
+	}
+	if *algorithm != "sha256" || *pathMode != "relative" || *expect != report.Hash || !*pdf {
+		t.Errorf("recorded settings not applied: -algorithm %s -path-mode %s -expect %s -pdf %v", *algorithm, *pathMode, *expect, *pdf)
+	}
+	if *chunkSize != 4 {
+		t.Errorf("a chunk size given on the command line was replaced with %d", *chunkSize)
+	}
+}
+
+func TestTreeRecordedExcludes(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "cache", "deep"), 0755)
+	os.WriteFile(filepath.Join(dir, "kept.txt"), []byte("kept"), 0644)
+	os.WriteFile(filepath.Join(dir, "cache", "deep", "blob"), []byte("blob"), 0644)
+	os.WriteFile(filepath.Join(dir, "added.txt"), []byte("added"), 0644)
+
+	dbPath := filepath.Join(t.TempDir(), "scan.json")
+	db, _ := OpenHashDB(dbPath)
+	entry, err := HashFileEntry(NewHashCalculator(), filepath.Join(dir, "kept.txt"), []HashAlgorithm{SHA256})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Put(entry)
+	db.SetParameters(&RunParameters{Version: "v1.0.0", Algorithms: []HashAlgorithm{SHA256}, Excludes: []string{"cache"}})
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	params := manifestParameters(dbPath)
+	if params == nil || !slices.Equal(params.Excludes, []string{"cache"}) {
+		t.Fatalf("database parameters not kept: %+v", params)
+	}
+	root, err := BuildTree(dir, dbManifest(db), dbPath, NewHashCalculator(), TreeOptions{Excludes: params.Excludes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Counts[treeOK] != 1 || root.Counts[treeNew] != 1 {
+		t.Errorf("files below an excluded directory should not be new: %v", root.Counts)
+	}
+}
+
+func TestCheckReportsWithRecordedSettings(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "evidence.bin")
+	os.WriteFile(file, []byte("recorded with a screening hash"), 0644)
+
+	calc := NewHashCalculator()
+	result, err := calc.SampleFile(file, SHA512, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result.Parameters = &RunParameters{Version: "v1.0.0", Algorithms: []HashAlgorithm{SHA512}, ChunkSize: 8 << 20, Mode: "sample", SampleMB: 1}
+	report := filepath.Join(dir, "report.json")
+	f, _ := os.Create(report)
+	WriteJSONReport(f, result, nil)
+	f.Close()
+
+	var out strings.Builder
+	if code := CheckChecksums(&out, report, calc, CheckOptions{}); code != 0 {
+		t.Fatalf("The report should verify with its recorded settings:\n%s", out.String())
+	}
+	if calc.ChunkSize != hasher.DefaultChunkSize {
+		t.Errorf("The recorded chunk size leaked into the calculator: %d", calc.ChunkSize)
+	}
+	for _, want := range []string{"Recorded settings: SHA-512 (sample of 1 MB), 8 MB chunks", "Settings drift: version v1.0.0 → ", "evidence.bin: OK"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output lacks %q:\n%s", want, out.String())
+		}
+	}
+
+	os.WriteFile(file, []byte("changed after the report was made"), 0644)
+	out.Reset()
+	if code := CheckChecksums(&out, report, NewHashCalculator(), CheckOptions{}); code != 1 || !strings.Contains(out.String(), "evidence.bin: FAILED") {
+		t.Errorf("A changed file should fail:\n%s", out.String())
+	}
+}
+
+func TestCheckRollupWithRecordedSettings(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0644)
+	calculator := NewHashCalculator()
+	calculator.ChunkSize = 8 << 20
+	manifest, err := BuildRollupManifest(dir, SHA256, calculator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest.Parameters.Version = "v1.0.0"
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	data, _ := json.Marshal(manifest)
+	os.WriteFile(path, data, 0644)
+
+	// Rollup paths are relative to the directory the manifest was made of
+	t.Chdir(dir)
+	var out strings.Builder
+	checker := NewHashCalculator()
+	if code := CheckChecksums(&out, path, checker, CheckOptions{}); code != 0 {
+		t.Fatalf("The manifest should verify:\n%s", out.String())
+	}
+	if checker.ChunkSize != hasher.DefaultChunkSize {
+		t.Errorf("The recorded chunk size leaked into the calculator: %d", checker.ChunkSize)
+	}
+	for _, want := range []string{"Recorded settings: SHA-256, 8 MB chunks", "Settings drift: version v1.0.0 → ", "a.txt: OK"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Output lacks %q:\n%s", want, out.String())
+		}
+	}
+}
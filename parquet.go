@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// parquetRowGroupBytes is how much column data is buffered before it is
+// written out as a row group, bounding memory for scans of any size
+const parquetRowGroupBytes = 64 << 20
+
+// Parquet physical types, converted types and codes used by the writer
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetRequired = 0
+	parquetOptional = 1
+
+	parquetPlain = 0
+	parquetRLE   = 3
+	parquetGzip  = 2
+)
+
+// parquetColumn buffers the PLAIN-encoded values of one column of a row group
+type parquetColumn struct {
+	name      string
+	kind      int32
+	converted int32
+	optional  bool
+	values    bytes.Buffer
+	defined   []bool
+}
+
+// add appends a value: a string, an int64, or nil for a null in an optional column
+func (c *parquetColumn) add(value any) {
+	c.defined = append(c.defined, value != nil)
+	switch v := value.(type) {
+	case string:
+		c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(v))))
+		c.values.WriteString(v)
+	case int64:
+		c.values.Write(binary.LittleEndian.AppendUint64(nil, uint64(v)))
+	}
+}
+
+// ParquetWriter streams hash results to a Parquet file with one row per
+// file: path, size, modification time and a column per algorithm. Pages are
+// PLAIN-encoded and gzip-compressed, which DuckDB, Spark and pandas all read.
+type ParquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []*parquetColumn
+	hashes  []HashAlgorithm
+	rule    bool
+	rows    int64
+	total   int64
+	groups  []any
+}
+
+// NewParquetWriter writes the file header and returns a writer with a hash
+// column for each algorithm, and a rule column when rule is set
+func NewParquetWriter(w io.Writer, algorithms []HashAlgorithm, rule bool) (*ParquetWriter, error) {
+	p := &ParquetWriter{w: w, hashes: algorithms, rule: rule}
+	p.columns = []*parquetColumn{
+		{name: "path", kind: parquetByteArray, converted: parquetUTF8},
+		{name: "size", kind: parquetInt64, converted: -1},
+		{name: "modified", kind: parquetInt64, converted: parquetTimestampMillis, optional: true},
+	}
+	if rule {
+		p.columns = append(p.columns, &parquetColumn{name: "rule", kind: parquetByteArray, converted: parquetUTF8, optional: true})
+	}
+	for _, alg := range algorithms {
+		p.columns = append(p.columns, &parquetColumn{name: string(alg), kind: parquetByteArray, converted: parquetUTF8, optional: true})
+	}
+	return p, p.write([]byte("PAR1"))
+}
+
+func (p *ParquetWriter) write(data []byte) error {
+	n, err := p.w.Write(data)
+	p.offset += int64(n)
+	return err
+}
+
+// Write adds the row for one file, writing a row group once enough is buffered
+func (p *ParquetWriter) Write(entry DBEntry) error {
+	values := []any{entry.Path, entry.Size, nil}
+	if !entry.Modified.IsZero() {
+		values[2] = entry.Modified.UnixMilli()
+	}
+	if p.rule {
+		values = append(values, optionalString(entry.Rule))
+	}
+	for _, alg := range p.hashes {
+		values = append(values, optionalString(entry.Hashes[alg]))
+	}
+	buffered := 0
+	for i, column := range p.columns {
+		column.add(values[i])
+		buffered += column.values.Len()
+	}
+	p.rows++
+	if buffered >= parquetRowGroupBytes {
+		return p.flush()
+	}
+	return nil
+}
+
+// optionalString is nil for an empty string, so it is stored as null
+func optionalString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// flush writes the buffered rows as a row group with one page per column
+func (p *ParquetWriter) flush() error {
+	rows := int64(len(p.columns[0].defined))
+	if rows == 0 {
+		return nil
+	}
+	var chunks []any
+	var groupBytes int64
+	for _, column := range p.columns {
+		var page bytes.Buffer
+		if column.optional {
+			levels := rleBits(column.defined)
+			page.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(levels))))
+			page.Write(levels)
+		}
+		page.Write(column.values.Bytes())
+
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page.Bytes())
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		header := encodeThrift([]thriftField{
+			{1, int32(0)}, // DATA_PAGE
+			{2, int32(page.Len())},
+			{3, int32(compressed.Len())},
+			{5, []thriftField{{1, int32(rows)}, {2, int32(parquetPlain)}, {3, int32(parquetRLE)}, {4, int32(parquetRLE)}}},
+		})
+		start := p.offset
+		if err := p.write(header); err != nil {
+			return err
+		}
+		if err := p.write(compressed.Bytes()); err != nil {
+			return err
+		}
+		uncompressed := int64(len(header) + page.Len())
+		groupBytes += uncompressed
+		chunks = append(chunks, []thriftField{
+			{2, start},
+			{3, []thriftField{
+				{1, column.kind},
+				{2, thriftList{thriftTypeI32, []any{int32(parquetPlain), int32(parquetRLE)}}},
+				{3, thriftList{thriftTypeBinary, []any{column.name}}},
+				{4, int32(parquetGzip)},
+				{5, rows},
+				{6, uncompressed},
+				{7, p.offset - start},
+				{9, start},
+			}},
+		})
+		column.values.Reset()
+		column.defined = column.defined[:0]
+	}
+	p.groups = append(p.groups, []thriftField{
+		{1, thriftList{thriftTypeStruct, chunks}},
+		{2, groupBytes},
+		{3, rows},
+	})
+	p.total += rows
+	return nil
+}
+
+// Close writes the last row group and the footer
+func (p *ParquetWriter) Close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+	schema := []any{[]thriftField{{4, "schema"}, {5, int32(len(p.columns))}}}
+	for _, column := range p.columns {
+		repetition := int32(parquetRequired)
+		if column.optional {
+			repetition = parquetOptional
+		}
+		element := []thriftField{{1, column.kind}, {3, repetition}, {4, column.name}}
+		if column.converted >= 0 {
+			element = append(element, thriftField{6, column.converted})
+		}
+		schema = append(schema, element)
+	}
+	footer := encodeThrift([]thriftField{
+		{1, int32(1)},
+		{2, thriftList{thriftTypeStruct, schema}},
+		{3, p.total},
+		{4, thriftList{thriftTypeStruct, p.groups}},
+		{6, "hashculate"},
+	})
+	if err := p.write(footer); err != nil {
+		return err
+	}
+	return p.write(append(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))), "PAR1"...))
+}
+
+// rleBits encodes 0/1 definition levels as runs of the RLE/bit-packing hybrid
+func rleBits(bits []bool) []byte {
+	var out []byte
+	for i := 0; i < len(bits); {
+		run := 1
+		for i+run < len(bits) && bits[i+run] == bits[i] {
+			run++
+		}
+		out = binary.AppendUvarint(out, uint64(run)<<1)
+		if bits[i] {
+			out = append(out, 1)
+		} else {
+			out = append(out, 0)
+		}
+		i += run
+	}
+	return out
+}
+
+// Compact protocol type codes of the Thrift values Parquet metadata uses
+const (
+	thriftTypeI32    = 5
+	thriftTypeI64    = 6
+	thriftTypeBinary = 8
+	thriftTypeList   = 9
+	thriftTypeStruct = 12
+)
+
+// thriftField is a field of a Thrift struct: an int32, int64, string, nested
+// struct ([]thriftField) or thriftList
+type thriftField struct {
+	id    int16
+	value any
+}
+
+// thriftList is a Thrift list of elements of one type
+type thriftList struct {
+	elem  byte
+	items []any
+}
+
+// encodeThrift serializes a struct with the Thrift compact protocol
+func encodeThrift(fields []thriftField) []byte {
+	return appendThriftStruct(nil, fields)
+}
+
+func appendThriftStruct(b []byte, fields []thriftField) []byte {
+	last := int16(0)
+	for _, f := range fields {
+		kind := thriftType(f.value)
+		if delta := f.id - last; delta > 0 && delta <= 15 {
+			b = append(b, byte(delta)<<4|kind)
+		} else {
+			b = append(b, kind)
+			b = binary.AppendVarint(b, int64(f.id))
+		}
+		last = f.id
+		b = appendThriftValue(b, f.value)
+	}
+	return append(b, 0)
+}
+
+func appendThriftValue(b []byte, value any) []byte {
+	switch v := value.(type) {
+	case int32:
+		return binary.AppendVarint(b, int64(v))
+	case int64:
+		return binary.AppendVarint(b, v)
+	case string:
+		b = binary.AppendUvarint(b, uint64(len(v)))
+		return append(b, v...)
+	case []thriftField:
+		return appendThriftStruct(b, v)
+	case thriftList:
+		if len(v.items) < 15 {
+			b = append(b, byte(len(v.items))<<4|v.elem)
+		} else {
+			b = append(b, 0xf0|v.elem)
+			b = binary.AppendUvarint(b, uint64(len(v.items)))
+		}
+		for _, item := range v.items {
+			b = appendThriftValue(b, item)
+		}
+		return b
+	}
+	panic(fmt.Sprintf("unsupported thrift value %T", value))
+}
+
+func thriftType(value any) byte {
+	switch value.(type) {
+	case int32:
+		return thriftTypeI32
+	case int64:
+		return thriftTypeI64
+	case string:
+		return thriftTypeBinary
+	case thriftList:
+		return thriftTypeList
+	}
+	return thriftTypeStruct
+}
+
+// WriteParquetResults hashes every file below the given paths and writes a
+// Parquet file of the results, named as in markdown output
+func WriteParquetResults(w io.Writer, paths []string, algorithm HashAlgorithm, calculator *HashCalculator) error {
+	writer, err := NewParquetWriter(w, []HashAlgorithm{algorithm}, false)
+	if err != nil {
+		return err
+	}
+	for _, root := range paths {
+		files, err := calculator.listFiles(root)
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, path := range files {
+			info, err := fs.Stat(calculator.fs(), path)
+			if err != nil {
+				return err
+			}
+			result, err := calculator.CalculateFileHash(path, algorithm, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			name := filepath.Base(path)
+			if path != root {
+				name = relativeSlashPath(root, path)
+			}
+			entry := DBEntry{
+				Path:     calculator.Paths.name(path, name),
+				Size:     result.FileSize,
+				Modified: info.ModTime().UTC(),
+				Hashes:   map[HashAlgorithm]string{algorithm: result.Hash},
+			}
+			if deterministic {
+				entry.Modified = time.Time{}
+			}
+			if err := writer.Write(entry); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readThrift decodes a compact protocol struct into field id → value, enough
+// to read back the metadata ParquetWriter writes
+func readThrift(t *testing.T, r *bytes.Reader) map[int16]any {
+	fields := map[int16]any{}
+	last := int16(0)
+	for {
+		b, _ := r.ReadByte()
+		if b == 0 {
+			return fields
+		}
+		id := last + int16(b>>4)
+		if b>>4 == 0 {
+			v, _ := binary.ReadVarint(r)
+			id = int16(v)
+		}
+		last = id
+		fields[id] = readThriftValue(t, r, b&0x0f)
+	}
+}
+
+func readThriftValue(t *testing.T, r *bytes.Reader, kind byte) any {
+	switch kind {
+	case thriftTypeI32, thriftTypeI64:
+		v, _ := binary.ReadVarint(r)
+		return v
+	case thriftTypeBinary:
+		n, _ := binary.ReadUvarint(r)
+		data := make([]byte, n)
+		io.ReadFull(r, data)
+		return string(data)
+	case thriftTypeStruct:
+		return readThrift(t, r)
+	case thriftTypeList:
+		b, _ := r.ReadByte()
+		n := uint64(b >> 4)
+		if n == 15 {
+			n, _ = binary.ReadUvarint(r)
+		}
+		items := []any{}
+		for range n {
+			items = append(items, readThriftValue(t, r, b&0x0f))
+		}
+		return items
+	}
+	t.Fatalf("unexpected thrift type %d", kind)
+	return nil
+}
+
+func TestParquetWriter(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []DBEntry{
+		{Path: "a.txt", Size: 5, Modified: modified, Hashes: map[HashAlgorithm]string{SHA256: "2cf24d", MD5: "5d4140"}},
+		{Path: "dir/b.bin", Size: 1 << 40, Hashes: map[HashAlgorithm]string{SHA256: "486ea4"}},
+	}
+	var out bytes.Buffer
+	writer, err := NewParquetWriter(&out, []HashAlgorithm{SHA256, MD5}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if err := writer.Write(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data := out.Bytes()
+	if string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Fatal("missing PAR1 magic")
+	}
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	footer := readThrift(t, bytes.NewReader(data[len(data)-8-footerLength:len(data)-8]))
+	if footer[3] != int64(2) {
+		t.Errorf("num_rows = %v", footer[3])
+	}
+	var names []string
+	for _, element := range footer[2].([]any)[1:] {
+		names = append(names, element.(map[int16]any)[4].(string))
+	}
+	if got := strings.Join(names, " "); got != "path size modified sha256 md5" {
+		t.Errorf("columns = %s", got)
+	}
+
+	// Read every column back from its page
+	group := footer[4].([]any)[0].(map[int16]any)
+	columns := map[string][]any{}
+	for i, chunk := range group[1].([]any) {
+		meta := chunk.(map[int16]any)[3].(map[int16]any)
+		page := bytes.NewReader(data[meta[9].(int64):])
+		header := readThrift(t, page)
+		compressed := make([]byte, header[3].(int64))
+		io.ReadFull(page, compressed)
+		gz, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(gz)
+		if int64(len(body)) != header[2].(int64) {
+			t.Errorf("%s: uncompressed size %d, header says %d", names[i], len(body), header[2])
+		}
+		defined := []bool{true, true}
+		if i >= 2 {
+			// Optional columns: RLE runs of definition levels after their length
+			levels := bytes.NewReader(body[4 : 4+binary.LittleEndian.Uint32(body)])
+			body = body[4+binary.LittleEndian.Uint32(body):]
+			defined = nil
+			for levels.Len() > 0 {
+				run, _ := binary.ReadUvarint(levels)
+				value, _ := levels.ReadByte()
+				for range run >> 1 {
+					defined = append(defined, value == 1)
+				}
+			}
+		}
+		for _, ok := range defined {
+			switch {
+			case !ok:
+				columns[names[i]] = append(columns[names[i]], nil)
+			case meta[1] == int64(parquetInt64):
+				columns[names[i]] = append(columns[names[i]], int64(binary.LittleEndian.Uint64(body)))
+				body = body[8:]
+			default:
+				n := binary.LittleEndian.Uint32(body)
+				columns[names[i]] = append(columns[names[i]], string(body[4:4+n]))
+				body = body[4+n:]
+			}
+		}
+	}
+	want := map[string][]any{
+		"path":     {"a.txt", "dir/b.bin"},
+		"size":     {int64(5), int64(1 << 40)},
+		"modified": {modified.UnixMilli(), nil},
+		"sha256":   {"2cf24d", "486ea4"},
+		"md5":      {"5d4140", nil},
+	}
+	for name, values := range want {
+		for i, value := range values {
+			if columns[name][i] != value {
+				t.Errorf("%s[%d] = %v, want %v", name, i, columns[name][i], value)
+			}
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// PathMode controls how input paths are recorded in outputs
+type PathMode string
+
+const (
+	PathModeDefault  PathMode = ""         // Base names for files, paths below a hashed directory relative to it
+	PathModeRelative PathMode = "relative" // Relative to PathFormat.Base
+	PathModeAbsolute PathMode = "absolute"
+	PathModeBasename PathMode = "basename"
+)
+
+// parsePathMode validates a -path-mode value
+func parsePathMode(mode string) (PathMode, error) {
+	switch m := PathMode(mode); m {
+	case PathModeDefault, PathModeRelative, PathModeAbsolute, PathModeBasename:
+		return m, nil
+	}
+	return "", fmt.Errorf("unsupported path mode: %s. Supported: relative, absolute, basename", mode)
+}
+
+// PathFormat renders input paths the way downstream verification expects them
+type PathFormat struct {
+	Mode PathMode
+	Base string // Directory relative paths start from; the working directory when empty
+}
+
+// name returns how p is recorded in outputs, or fallback in the default mode
+func (f PathFormat) name(p, fallback string) string {
+	switch f.Mode {
+	case PathModeBasename:
+		return filepath.Base(p)
+	case PathModeAbsolute:
+		if abs, err := filepath.Abs(p); err == nil {
+			return abs
+		}
+	case PathModeRelative:
+		base := f.Base
+		if base == "" {
+			base = "."
+		}
+		absBase, err := filepath.Abs(base)
+		if err != nil {
+			return fallback
+		}
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return fallback
+		}
+		if rel, err := filepath.Rel(absBase, abs); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return fallback
+}
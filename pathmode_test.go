@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFormat(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "b"} {
+		os.MkdirAll(filepath.Join(root, dir), 0755)
+		os.WriteFile(filepath.Join(root, dir, "data.bin"), []byte(dir), 0644)
+	}
+	file := filepath.Join(root, "a", "data.bin")
+
+	tests := []struct {
+		format PathFormat
+		want   string
+	}{
+		{PathFormat{}, "data.bin"},
+		{PathFormat{Mode: PathModeBasename}, "data.bin"},
+		{PathFormat{Mode: PathModeAbsolute}, file},
+		{PathFormat{Mode: PathModeRelative, Base: root}, "a/data.bin"},
+		{PathFormat{Mode: PathModeRelative, Base: filepath.Join(root, "b")}, "../a/data.bin"},
+	}
+	for _, test := range tests {
+		calculator := NewHashCalculator()
+		calculator.Paths = test.format
+		result, err := calculator.CalculateFileHash(file, SHA256, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Filename != test.want {
+			t.Errorf("%+v: recorded %q, want %q", test.format, result.Filename, test.want)
+		}
+		if result.Path != file || result.Basename != "data.bin" {
+			t.Errorf("%+v: path %q, base name %q", test.format, result.Path, result.Basename)
+		}
+	}
+
+	if _, err := parsePathMode("canonical"); err == nil {
+		t.Error("Expected an unknown path mode to be rejected")
+	}
+}
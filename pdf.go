@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"hashculate/hasher"
+)
+
+// pdfDomain starts the canonical form of a PDF, so a canonical hash can never
+// equal the digest of a file. v2 prefixes dictionaries with their length.
+const pdfDomain = "hashculate pdf v2"
+
+// ErrNotPDF is returned when a file has no PDF header
+var ErrNotPDF = errors.New("not a PDF file")
+
+var (
+	pdfVersion = regexp.MustCompile(`%PDF-(\d\.\d)`)
+	pdfObject  = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfLength  = regexp.MustCompile(`/Length\s+(\d+)(\s+\d+\s+R)?`)
+	pdfRoot    = regexp.MustCompile(`/Root\s+(\d+\s+\d+)\s+R`)
+	pdfType    = regexp.MustCompile(`/Type\s*/(\w+)`)
+	pdfStream  = regexp.MustCompile(`\bstream\r?\n`)
+
+	// Volatile values, in dictionaries and in XMP metadata
+	pdfDates    = regexp.MustCompile(`/(ModDate|CreationDate)\s*(\((?:\\.|[^\\)])*\)|<[0-9A-Fa-f\s]*>)`)
+	xmpElements = regexp.MustCompile(`<(xmp:(?:Modify|Create|Metadata)Date|xmpMM:(?:Document|Instance)ID)>[^<]*</`)
+	xmpAttrs    = regexp.MustCompile(`(xmp:(?:Modify|Create|Metadata)Date|xmpMM:(?:Document|Instance)ID)="[^"]*"`)
+)
+
+// PDFInfo describes what a -pdf canonical hash covers
+type PDFInfo struct {
+	Version   string `json:"version"`
+	Objects   int    `json:"objects"`
+	Revisions int    `json:"revisions"` // 1 plus the number of incremental updates
+	Raw       string `json:"raw"`       // Digest of the file itself
+}
+
+// pdfObj is an indirect object, split into its dictionary and stream data
+type pdfObj struct {
+	num, gen int
+	dict     []byte
+	stream   []byte
+	isStream bool
+}
+
+// normalizePDF blanks the creation and modification dates and XMP document IDs
+func normalizePDF(data []byte) []byte {
+	data = pdfDates.ReplaceAll(data, []byte("/$1 ()"))
+	data = xmpElements.ReplaceAll(data, []byte("<$1></"))
+	return xmpAttrs.ReplaceAll(data, []byte(`$1=""`))
+}
+
+// parsePDFObjects finds the indirect objects of every revision of a PDF.
+// Objects redefined by incremental updates keep their last definition.
+func parsePDFObjects(data []byte) map[[2]int]*pdfObj {
+	objects := map[[2]int]*pdfObj{}
+	for pos := 0; pos < len(data); {
+		loc := pdfObject.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		gen, _ := strconv.Atoi(string(data[pos+loc[4] : pos+loc[5]]))
+		start := pos + loc[1]
+		end := bytes.Index(data[start:], []byte("endobj"))
+		if end < 0 {
+			break
+		}
+		obj := &pdfObj{num: num, gen: gen, dict: data[start : start+end]}
+
+		// Stream data is binary, so it is skipped by its length rather than searched
+		if s := pdfStream.FindIndex(obj.dict); s != nil {
+			obj.isStream = true
+			obj.dict = data[start : start+s[0]]
+			dataStart := start + s[1]
+			dataEnd := -1
+			if m := pdfLength.FindSubmatch(obj.dict); m != nil && len(m[2]) == 0 {
+				if n, err := strconv.Atoi(string(m[1])); err == nil && dataStart+n <= len(data) &&
+					bytes.HasPrefix(bytes.TrimLeft(data[dataStart+n:], "\r\n"), []byte("endstream")) {
+					dataEnd = dataStart + n
+				}
+			}
+			if dataEnd < 0 {
+				i := bytes.Index(data[dataStart:], []byte("endstream"))
+				if i < 0 {
+					break
+				}
+				dataEnd = dataStart + i
+			}
+			obj.stream = data[dataStart:dataEnd]
+			end = bytes.Index(data[dataEnd:], []byte("endobj"))
+			if end < 0 {
+				break
+			}
+			start = dataEnd
+		}
+		objects[[2]int{num, gen}] = obj
+		pos = start + end + len("endobj")
+	}
+	return objects
+}
+
+// CanonicalPDF writes the canonical form of a PDF: its version, document
+// catalog and indirect objects in object number order, each at its latest
+// revision, without cross-reference data or trailers and with dates and
+// document IDs blanked. Metadata and object streams are compared decompressed.
+func CanonicalPDF(w io.Writer, data []byte) (*PDFInfo, error) {
+	header := pdfVersion.FindSubmatch(data[:min(len(data), 1024)])
+	if header == nil {
+		return nil, ErrNotPDF
+	}
+	objects := parsePDFObjects(data)
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("no objects found in PDF")
+	}
+	info := &PDFInfo{Version: string(header[1]), Revisions: max(1, bytes.Count(data, []byte("%%EOF")))}
+
+	fmt.Fprintf(w, "%s %s\n", pdfDomain, info.Version)
+	if roots := pdfRoot.FindAllSubmatch(data, -1); roots != nil {
+		fmt.Fprintf(w, "root %s\n", roots[len(roots)-1][1])
+	}
+	keys := make([][2]int, 0, len(objects))
+	for key := range objects {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i][0] < keys[j][0] || (keys[i][0] == keys[j][0] && keys[i][1] < keys[j][1])
+	})
+	for _, key := range keys {
+		obj := objects[key]
+		kind := ""
+		if m := pdfType.FindSubmatch(obj.dict); m != nil {
+			kind = string(m[1])
+		}
+		if kind == "XRef" {
+			continue // Offsets, the file ID and the previous revision
+		}
+		dict, stream := normalizePDF(obj.dict), obj.stream
+		if kind == "Metadata" || kind == "ObjStm" {
+			if bytes.Contains(dict, []byte("/FlateDecode")) {
+				if zr, err := zlib.NewReader(bytes.NewReader(stream)); err == nil {
+					if inflated, err := io.ReadAll(zr); err == nil {
+						stream = inflated
+					}
+				}
+			}
+			stream = normalizePDF(stream)
+			dict = pdfLength.ReplaceAll(dict, nil) // Depends on the dates and compression
+		}
+		// Lengths keep the encoding unambiguous: a string in a dictionary cannot pose as another object
+		dict = bytes.TrimSpace(dict)
+		fmt.Fprintf(w, "%d %d obj %d\n", obj.num, obj.gen, len(dict))
+		w.Write(dict)
+		io.WriteString(w, "\n")
+		if obj.isStream {
+			fmt.Fprintf(w, "stream %d\n", len(stream))
+			w.Write(stream)
+			io.WriteString(w, "\n")
+		}
+		info.Objects++
+	}
+	return info, nil
+}
+
+// PDFFile hashes the canonical form of a PDF, so documents regenerated from
+// the same source or re-saved with only new dates compare equal. The digest
+// of the file itself is returned alongside.
+func (hc *HashCalculator) PDFFile(filePath string, algorithm HashAlgorithm, progressCallback func(float64)) (*HashResult, error) {
+	raw, err := hc.CalculateFileHash(filePath, algorithm, progressCallback)
+	if err != nil {
+		return nil, err
+	}
+	file, err := hc.openInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	data, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	stream, err := hasher.NewStream([]HashAlgorithm{algorithm}, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	info, err := CanonicalPDF(stream, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	info.Raw = raw.Hash
+
+	result := *raw
+	result.Hash = stream.Digests()[0].Hash
+	result.PDF = info
+	result.Description = fmt.Sprintf("\"%s\", with size of %s, is a PDF %s document with the canonical %s hash %s over %d objects; the file itself has %s.",
+		result.Filename, formatBytes(result.FileSize), info.Version, getAlgorithmName(algorithm), result.Hash, info.Objects, raw.Hash)
+	return &result, nil
+}
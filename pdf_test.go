@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testPDF builds a small PDF with a compressed XMP stream and a valid cross-reference table
+func testPDF(date, id, text string) []byte {
+	var xmp bytes.Buffer
+	zw := zlib.NewWriter(&xmp)
+	fmt.Fprintf(zw, `<x:xmpmeta><rdf:Description xmp:ModifyDate="%s"><xmpMM:InstanceID>uuid:%s</xmpMM:InstanceID></rdf:Description></x:xmpmeta>`, date, id)
+	zw.Close()
+	content := fmt.Sprintf("BT /F1 12 Tf (%s) Tj ET", text)
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /Metadata 5 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content),
+		fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream", xmp.Len(), xmp.Bytes()),
+		fmt.Sprintf("<< /Producer (test) /CreationDate (D:%s) /ModDate (D:%s) >>", date, date),
+	}
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.7\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R /Info 6 0 R /ID [<%s><%s>] >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, id, id, xref)
+	return pdf.Bytes()
+}
+
+func TestPDFFile(t *testing.T) {
+	dir := t.TempDir()
+	original := testPDF("20240101120000Z", "0a1b", "Hello")
+	update := fmt.Sprintf("6 0 obj\n<< /Producer (test) /CreationDate (D:20240101120000Z) /ModDate (D:20250607080910Z) >>\nendobj\n"+
+		"xref\n0 1\n0000000000 65535 f \n6 1\n%010d 00000 n \ntrailer\n<< /Size 7 /Root 1 0 R /Prev 1 /ID [<0a1b><9f9f>] >>\nstartxref\n%d\n%%%%EOF\n",
+		len(original), len(original)+100)
+	files := map[string][]byte{
+		"original.pdf":    original,
+		"regenerated.pdf": testPDF("20250607080910Z", "c3d4", "Hello"),
+		"updated.pdf":     append(append([]byte{}, original...), update...),
+		"edited.pdf":      testPDF("20240101120000Z", "0a1b", "Hullo"),
+	}
+	results := map[string]*HashResult{}
+	for name, data := range files {
+		os.WriteFile(filepath.Join(dir, name), data, 0644)
+		result, err := NewHashCalculator().PDFFile(filepath.Join(dir, name), SHA256, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		results[name] = result
+	}
+
+	want := results["original.pdf"]
+	if want.PDF.Objects != 6 || want.PDF.Version != "1.7" || want.PDF.Revisions != 1 {
+		t.Errorf("unexpected details: %+v", want.PDF)
+	}
+	for _, name := range []string{"regenerated.pdf", "updated.pdf"} {
+		if results[name].Hash != want.Hash || results[name].PDF.Raw == want.PDF.Raw {
+			t.Errorf("%s: canonical %s, raw %s; original canonical %s, raw %s", name, results[name].Hash, results[name].PDF.Raw, want.Hash, want.PDF.Raw)
+		}
+	}
+	if results["updated.pdf"].PDF.Revisions != 2 {
+		t.Errorf("expected two revisions: %+v", results["updated.pdf"].PDF)
+	}
+	if results["edited.pdf"].Hash == want.Hash {
+		t.Error("a changed page must change the canonical hash")
+	}
+
+	// A string holding an object header must not read as a second object
+	canonical := func(data string) string {
+		var out bytes.Buffer
+		if _, err := CanonicalPDF(&out, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+		return fmt.Sprintf("%x", sha256.Sum256(out.Bytes()))
+	}
+	one := canonical("%PDF-1.7\n1 0 obj\n<< /S (X\n2 0 obj\nY) >>\nendobj\n")
+	two := canonical("%PDF-1.7\n1 0 obj\n<< /S (X\nendobj\n2 0 obj\nY) >>\nendobj\n")
+	if one == two {
+		t.Error("an object split in two must change the canonical hash")
+	}
+
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a pdf"), 0644)
+	if _, err := NewHashCalculator().PDFFile(filepath.Join(dir, "notes.txt"), SHA256, nil); err == nil {
+		t.Error("expected an error for a file that is not a PDF")
+	}
+}
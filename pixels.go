@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"hashculate/hasher"
+)
+
+// pixelsAlgorithm is the -a value that selects pixel hashing
+const pixelsAlgorithm = "pixels"
+
+// pixelsDomain starts the hashed pixel data, so a pixel hash can never equal
+// the digest of a file
+const pixelsDomain = "hashculate pixels v1"
+
+// PixelInfo describes the image behind a pixel hash
+type PixelInfo struct {
+	Format    string `json:"format"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Container string `json:"container"` // SHA-256 of the file itself
+}
+
+func init() {
+	image.RegisterFormat("tiff", "II*\x00", decodeTIFF, decodeTIFFConfig)
+	image.RegisterFormat("tiff", "MM\x00*", decodeTIFF, decodeTIFFConfig)
+}
+
+// PixelFile decodes a JPEG, PNG or TIFF image and hashes its pixels with
+// SHA-256, as 16-bit non-premultiplied RGBA in stored row order. Metadata,
+// including the EXIF orientation flag, and the way pixels are encoded do not
+// affect the digest; the SHA-256 of the file is returned alongside.
+func (hc *HashCalculator) PixelFile(filePath string) (*HashResult, error) {
+	container, err := hc.CalculateFileHash(filePath, SHA256, nil)
+	if err != nil {
+		return nil, err
+	}
+	file, err := hc.openInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	img, format, err := image.Decode(bufio.NewReader(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: not a JPEG, PNG or uncompressed TIFF image: %w", filePath, err)
+	}
+
+	stream, _ := hasher.NewStream([]HashAlgorithm{SHA256}, -1, nil)
+	bounds := img.Bounds()
+	fmt.Fprintf(stream, "%s %dx%d\n", pixelsDomain, bounds.Dx(), bounds.Dy())
+	row := make([]byte, 8*bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBA64Model.Convert(img.At(x, y)).(color.NRGBA64)
+			i := 8 * (x - bounds.Min.X)
+			binary.BigEndian.PutUint16(row[i:], c.R)
+			binary.BigEndian.PutUint16(row[i+2:], c.G)
+			binary.BigEndian.PutUint16(row[i+4:], c.B)
+			binary.BigEndian.PutUint16(row[i+6:], c.A)
+		}
+		stream.Write(row)
+	}
+
+	result := *container
+	result.Hash = stream.Digests()[0].Hash
+	result.Pixels = &PixelInfo{Format: format, Width: bounds.Dx(), Height: bounds.Dy(), Container: container.Hash}
+	result.Description = fmt.Sprintf("\"%s\", with size of %s, is a %dx%d %s image whose pixels have the SHA-256 hash %s; the file itself has %s.",
+		result.Filename, formatBytes(result.FileSize), bounds.Dx(), bounds.Dy(), format, result.Hash, container.Hash)
+	return &result, nil
+}
+
+// tiffImage is the part of a baseline TIFF needed to read uncompressed pixels
+type tiffImage struct {
+	order           binary.ByteOrder
+	width, height   int
+	bits, samples   int
+	compression     int
+	photometric     int
+	planar          int
+	stripOffsets    []int64
+	stripByteCounts []int64
+	rowsPerStrip    int
+}
+
+// readTIFF parses the first image file directory of a TIFF file
+func readTIFF(r io.Reader) (*tiffImage, []byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(data) < 8 {
+		return nil, nil, fmt.Errorf("tiff: truncated header")
+	}
+	t := &tiffImage{order: binary.LittleEndian, bits: 1, samples: 1, compression: 1, planar: 1}
+	if data[0] == 'M' {
+		t.order = binary.BigEndian
+	}
+	ifd := int64(t.order.Uint32(data[4:]))
+	if ifd+2 > int64(len(data)) {
+		return nil, nil, fmt.Errorf("tiff: invalid directory offset")
+	}
+	count := int64(t.order.Uint16(data[ifd:]))
+	for i := int64(0); i < count; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > int64(len(data)) {
+			return nil, nil, fmt.Errorf("tiff: truncated directory")
+		}
+		values, err := tiffValues(data, t.order, data[entry:entry+12])
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(values) == 0 {
+			continue
+		}
+		switch t.order.Uint16(data[entry:]) {
+		case 256:
+			t.width = int(values[0])
+		case 257:
+			t.height = int(values[0])
+		case 258:
+			t.bits = int(values[0])
+		case 259:
+			t.compression = int(values[0])
+		case 262:
+			t.photometric = int(values[0])
+		case 273:
+			t.stripOffsets = values
+		case 277:
+			t.samples = int(values[0])
+		case 278:
+			t.rowsPerStrip = int(values[0])
+		case 279:
+			t.stripByteCounts = values
+		case 284:
+			t.planar = int(values[0])
+		}
+	}
+	return t, data, nil
+}
+
+// tiffValues reads the SHORT or LONG values of a directory entry
+func tiffValues(data []byte, order binary.ByteOrder, entry []byte) ([]int64, error) {
+	kind, count := order.Uint16(entry[2:]), int64(order.Uint32(entry[4:]))
+	size := map[uint16]int64{3: 2, 4: 4}[kind]
+	if size == 0 {
+		return nil, nil
+	}
+	raw := entry[8:12]
+	if size*count > 4 {
+		offset := int64(order.Uint32(entry[8:]))
+		if count > int64(len(data)) || offset+size*count > int64(len(data)) {
+			return nil, fmt.Errorf("tiff: value outside the file")
+		}
+		raw = data[offset : offset+size*count]
+	}
+	values := make([]int64, count)
+	for i := range values {
+		if size == 2 {
+			values[i] = int64(order.Uint16(raw[2*i:]))
+		} else {
+			values[i] = int64(order.Uint32(raw[4*i:]))
+		}
+	}
+	return values, nil
+}
+
+// decodeTIFFConfig reports the size and color model of a TIFF image
+func decodeTIFFConfig(r io.Reader) (image.Config, error) {
+	t, _, err := readTIFF(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	model := color.NRGBAModel
+	if t.samples == 1 {
+		model = color.GrayModel
+	}
+	return image.Config{ColorModel: model, Width: t.width, Height: t.height}, nil
+}
+
+// decodeTIFF decodes an uncompressed, 8-bit grayscale, RGB or RGBA TIFF
+func decodeTIFF(r io.Reader) (image.Image, error) {
+	t, data, err := readTIFF(r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.compression != 1:
+		return nil, fmt.Errorf("tiff: compression %d is not supported, only uncompressed images", t.compression)
+	case t.bits != 8 || t.planar != 1:
+		return nil, fmt.Errorf("tiff: only 8-bit, interleaved samples are supported")
+	case !(t.photometric == 1 && t.samples == 1) && !(t.photometric == 2 && (t.samples == 3 || t.samples == 4)):
+		return nil, fmt.Errorf("tiff: only grayscale, RGB and RGBA images are supported")
+	case t.width <= 0 || t.height <= 0 || len(t.stripOffsets) != len(t.stripByteCounts):
+		return nil, fmt.Errorf("tiff: invalid image layout")
+	}
+
+	// Concatenate the strips, which hold the rows in order
+	var pixels []byte
+	for i, offset := range t.stripOffsets {
+		end := offset + t.stripByteCounts[i]
+		if end > int64(len(data)) {
+			return nil, fmt.Errorf("tiff: strip outside the file")
+		}
+		pixels = append(pixels, data[offset:end]...)
+	}
+	if len(pixels) < t.width*t.height*t.samples {
+		return nil, fmt.Errorf("tiff: strips hold fewer pixels than the image")
+	}
+
+	bounds := image.Rect(0, 0, t.width, t.height)
+	if t.samples == 1 {
+		img := image.NewGray(bounds)
+		copy(img.Pix, pixels)
+		return img, nil
+	}
+	img := image.NewNRGBA(bounds)
+	for i := 0; i < t.width*t.height; i++ {
+		copy(img.Pix[4*i:4*i+3], pixels[t.samples*i:])
+		img.Pix[4*i+3] = 0xFF
+		if t.samples == 4 {
+			img.Pix[4*i+3] = pixels[t.samples*i+3]
+		}
+	}
+	return img, nil
+}
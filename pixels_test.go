@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPixelFile(t *testing.T) {
+	dir := t.TempDir()
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = byte(40 * i)
+	}
+	for i := 3; i < len(img.Pix); i += 4 {
+		img.Pix[i] = 0xFF
+	}
+
+	// The same pixels as a PNG, a PNG with a text chunk and an uncompressed TIFF
+	var plain bytes.Buffer
+	png.Encode(&plain, img)
+	text := []byte("tEXtComment\x00edited")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = binary.BigEndian.AppendUint32(append(chunk, text...), crc32.ChecksumIEEE(text))
+	edited := append(append(append([]byte{}, plain.Bytes()[:33]...), chunk...), plain.Bytes()[33:]...)
+
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x07\x00")
+	for _, tag := range [][2]uint32{{256, 3}, {257, 2}, {258, 8}, {262, 2}, {273, 98}, {277, 3}, {279, 18}} {
+		tiff = binary.LittleEndian.AppendUint16(tiff, uint16(tag[0]))
+		tiff = binary.LittleEndian.AppendUint16(tiff, 4)
+		tiff = binary.LittleEndian.AppendUint32(tiff, 1)
+		tiff = binary.LittleEndian.AppendUint32(tiff, tag[1])
+	}
+	tiff = append(tiff, 0, 0, 0, 0)
+	for i := 0; i < len(img.Pix); i += 4 {
+		tiff = append(tiff, img.Pix[i:i+3]...)
+	}
+
+	hashes := map[string]*HashResult{}
+	for name, data := range map[string][]byte{"a.png": plain.Bytes(), "b.png": edited, "c.tif": tiff} {
+		os.WriteFile(filepath.Join(dir, name), data, 0644)
+		result, err := NewHashCalculator().PixelFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		hashes[name] = result
+	}
+	if hashes["a.png"].Hash != hashes["b.png"].Hash || hashes["a.png"].Hash != hashes["c.tif"].Hash {
+		t.Errorf("pixel hashes differ: %s %s %s", hashes["a.png"].Hash, hashes["b.png"].Hash, hashes["c.tif"].Hash)
+	}
+	if hashes["a.png"].Pixels.Container == hashes["b.png"].Pixels.Container || hashes["c.tif"].Pixels.Format != "tiff" {
+		t.Errorf("unexpected container details: %+v %+v", hashes["a.png"].Pixels, hashes["c.tif"].Pixels)
+	}
+
+	// An EXIF segment, orientation flag included, does not change a JPEG's pixels
+	var photo bytes.Buffer
+	jpeg.Encode(&photo, img, nil)
+	exif := []byte("\xFF\xE1\x00\x22Exif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	rotated := append(append(append([]byte{}, photo.Bytes()[:2]...), exif...), photo.Bytes()[2:]...)
+	os.WriteFile(filepath.Join(dir, "a.jpg"), photo.Bytes(), 0644)
+	os.WriteFile(filepath.Join(dir, "b.jpg"), rotated, 0644)
+	a, err := NewHashCalculator().PixelFile(filepath.Join(dir, "a.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewHashCalculator().PixelFile(filepath.Join(dir, "b.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash != b.Hash || a.Pixels.Container == b.Pixels.Container {
+		t.Errorf("jpeg with EXIF: pixels %s/%s, containers %s/%s", a.Hash, b.Hash, a.Pixels.Container, b.Pixels.Container)
+	}
+
+	os.WriteFile(filepath.Join(dir, "c.txt"), []byte("not an image"), 0644)
+	if _, err := NewHashCalculator().PixelFile(filepath.Join(dir, "c.txt")); err == nil {
+		t.Error("expected an error for a file that is not an image")
+	}
+}
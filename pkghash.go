@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// pkgHashFormats are the package manager hash spellings, in the order they are listed
+var pkgHashFormats = []string{"homebrew", "scoop", "nix-sri", "nix-base32"}
+
+// nixBase32Alphabet is Nix's base32 alphabet, which omits e, o, u and t
+const nixBase32Alphabet = "0123456789abcdfghijklmnpqrsvwxyz"
+
+// nixBase32 encodes a digest the way `nix hash convert --to nix32` does: five
+// bits at a time starting from the last, without padding
+func nixBase32(digest []byte) string {
+	length := (len(digest)*8-1)/5 + 1
+	out := make([]byte, 0, length)
+	for n := length - 1; n >= 0; n-- {
+		b := n * 5
+		i, j := b/8, uint(b%8)
+		c := digest[i] >> j
+		if i+1 < len(digest) {
+			c |= digest[i+1] << (8 - j)
+		}
+		out = append(out, nixBase32Alphabet[c&0x1f])
+	}
+	return string(out)
+}
+
+// FormatPackageHash spells a SHA-256 digest as the given package manager expects it
+func FormatPackageHash(format string, digest []byte) (string, error) {
+	switch format {
+	case "homebrew":
+		return fmt.Sprintf("sha256 %q", hex.EncodeToString(digest)), nil
+	case "scoop":
+		return fmt.Sprintf("\"hash\": %q", hex.EncodeToString(digest)), nil
+	case "nix-sri":
+		return "sha256-" + base64.StdEncoding.EncodeToString(digest), nil
+	case "nix-base32":
+		return nixBase32(digest), nil
+	}
+	return "", fmt.Errorf("unsupported format: %s. Supported: homebrew, scoop, nix-sri, nix-base32", format)
+}
+
+// runPkgHash implements the pkg-hash command
+func runPkgHash(args []string) int {
+	fs := flag.NewFlagSet("pkg-hash", flag.ExitOnError)
+	format := fs.String("format", "", "homebrew, scoop, nix-sri or nix-base32 [default: all]")
+	remoteUser := fs.String("remote-user", "", "User for ftp://, sftp:// and WebDAV/HTTP inputs")
+	identity := fs.String("identity", "", "SSH private key for sftp:// inputs")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("Usage: hashculate pkg-hash <url|file> [-format homebrew|scoop|nix-sri|nix-base32]")
+		return 1
+	}
+	formats := pkgHashFormats
+	if *format != "" {
+		if _, err := FormatPackageHash(*format, nil); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		formats = []string{*format}
+	}
+
+	calculator := NewHashCalculator()
+	var result *HashResult
+	var err error
+	if isURL(positional[0]) {
+		var results []*HashResult
+		creds := RemoteCredentials{User: *remoteUser, Password: os.Getenv("HASHCULATE_REMOTE_PASSWORD"), Identity: *identity}
+		results, _, err = calculator.FetchURLDigests(positional[0], creds, []HashAlgorithm{SHA256}, nil)
+		if err == nil {
+			result = results[0]
+		}
+	} else {
+		result, err = calculator.CalculateFileHash(positional[0], SHA256, nil)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	digest, _ := hex.DecodeString(result.Hash)
+	for _, f := range formats {
+		line, _ := FormatPackageHash(f, digest)
+		if len(formats) == 1 {
+			fmt.Println(line)
+		} else {
+			fmt.Printf("%-11s %s\n", f+":", line)
+		}
+	}
+	return 0
+}
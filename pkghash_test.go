@@ -0,0 +1,25 @@
+package main
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestFormatPackageHash(t *testing.T) {
+	empty := sha256.Sum256(nil)
+	tests := map[string]string{
+		"homebrew":   `sha256 "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`,
+		"scoop":      `"hash": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"`,
+		"nix-sri":    "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"nix-base32": "0mdqa9w1p6cmli6976v4wi0sw9r4p5prkj7lzfd1877wk11c9c73",
+	}
+	for format, want := range tests {
+		got, err := FormatPackageHash(format, empty[:])
+		if err != nil || got != want {
+			t.Errorf("%s: expected %s, got %s (%v)", format, want, got, err)
+		}
+	}
+	if _, err := FormatPackageHash("cargo", empty[:]); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
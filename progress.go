@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// BatchProgress shows the progress of a multi-file run on one line: bytes
+// across the whole batch and the file being hashed. Without a pre-scan the
+// total is unknown and only the bytes and files done so far are shown. When
+// several files are hashed at once, the line names the one started last.
+type BatchProgress struct {
+	mu        sync.Mutex
+	w         io.Writer
+	files     int
+	total     int64 // -1 when not pre-scanned
+	started   int
+	completed int64        // Bytes of the files done
+	active    []*batchFile // Files being hashed, in the order they started
+	width     int          // length of the last line, so a shorter one can blank it
+}
+
+// batchFile is a file of the batch being hashed
+type batchFile struct {
+	name     string
+	size     int64
+	fraction float64
+}
+
+// NewBatchProgress creates a batch display for files totalling total bytes,
+// or for an unknown batch when total is -1
+func NewBatchProgress(w io.Writer, files int, total int64) *BatchProgress {
+	return &BatchProgress{w: w, files: files, total: total}
+}
+
+// PrescanBatch counts the files below paths and their total size, so the
+// batch display can show overall progress from the start. Files are stated
+// on workers goroutines at once.
+func PrescanBatch(paths []string, workers int) (int, int64, error) {
+	var files int
+	var total int64
+	for _, root := range paths {
+		list, err := listFiles(root)
+		if err != nil {
+			return 0, 0, err
+		}
+		sizes, err := statSizes(list, workers)
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, size := range sizes {
+			files++
+			total += size
+		}
+	}
+	return files, total, nil
+}
+
+// File starts a file of the batch and returns its progress callback, and a
+// function that counts it as done once it is finished or has failed
+func (b *BatchProgress) File(name string, size int64) (func(float64), func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	file := &batchFile{name: name, size: max(size, 0)}
+	b.started++
+	b.active = append(b.active, file)
+	b.draw()
+	progress := func(fraction float64) {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		file.fraction = fraction
+		b.draw()
+	}
+	done := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if i := slices.Index(b.active, file); i >= 0 {
+			b.active = slices.Delete(b.active, i, i+1)
+			b.completed += file.size
+		}
+	}
+	return progress, done
+}
+
+// Finish ends the line, once every file is done
+func (b *BatchProgress) Finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.started == 0 {
+		return
+	}
+	b.draw()
+	fmt.Fprintln(b.w)
+}
+
+// Clear blanks the progress line so other output can take its place; the next
+// update draws it again
+func (b *BatchProgress) Clear() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.width > 0 {
+		fmt.Fprintf(b.w, "\r%s\r", strings.Repeat(" ", b.width))
+		b.width = 0
+	}
+}
+
+// draw redraws the progress line
+func (b *BatchProgress) draw() {
+	done := b.completed
+	for _, file := range b.active {
+		done += int64(file.fraction * float64(file.size))
+	}
+	var line string
+	if b.total >= 0 {
+		overall := 1.0
+		if b.total > 0 {
+			overall = min(float64(done)/float64(b.total), 1)
+		}
+		filled := int(overall * 30)
+		line = fmt.Sprintf("Total: [%s%s] %d%% %s of %s, file %d/%d", strings.Repeat("=", filled), strings.Repeat("-", 30-filled),
+			int(overall*100), markdownSize(done), markdownSize(b.total), b.started, b.files)
+	} else {
+		line = fmt.Sprintf("Total: %s, file %d", markdownSize(done), b.started)
+	}
+	if len(b.active) > 0 {
+		file := b.active[len(b.active)-1]
+		line += fmt.Sprintf(" | %s %d%%", filepath.Base(file.name), int(file.fraction*100))
+	}
+	fmt.Fprintf(b.w, "\r%s%s", line, strings.Repeat(" ", max(b.width-len(line), 0)))
+	b.width = len(line)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBatchProgress(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.bin"), make([]byte, 3000), 0644)
+	os.WriteFile(filepath.Join(dir, "sub", "b.bin"), make([]byte, 1000), 0644)
+	files, total, err := PrescanBatch([]string{dir}, 4)
+	if err != nil || files != 2 || total != 4000 {
+		t.Fatalf("prescan: %d files, %d bytes, %v", files, total, err)
+	}
+
+	var out strings.Builder
+	calc := NewHashCalculator()
+	calc.Batch = NewBatchProgress(&out, files, total)
+	if err := WriteSPDX(&strings.Builder{}, dir, calc); err != nil {
+		t.Fatal(err)
+	}
+	calc.Batch.Finish()
+	lines := strings.Split(out.String(), "\r")
+	if !strings.Contains(lines[len(lines)-2], "| b.bin 100%") || !strings.Contains(lines[len(lines)-1], "100% 3.9 KiB of 3.9 KiB, file 2/2") {
+		t.Errorf("unexpected progress:\n%q", out.String())
+	}
+
+	// Without a pre-scan only the bytes and files so far are known
+	out.Reset()
+	batch := NewBatchProgress(&out, 0, -1)
+	progress, _ := batch.File("a.bin", 3000)
+	progress(0.5)
+	if !strings.HasSuffix(out.String(), "\rTotal: 1.5 KiB, file 1 | a.bin 50%") {
+		t.Errorf("unexpected progress without a pre-scan: %q", out.String())
+	}
+
+	// Files hashed at once count as done as each finishes, in any order
+	out.Reset()
+	batch = NewBatchProgress(&out, 2, 4000)
+	progressA, doneA := batch.File("a.bin", 3000)
+	progressB, doneB := batch.File("b.bin", 1000)
+	progressB(1)
+	doneB()
+	progressA(0.5)
+	if !strings.HasSuffix(out.String(), "62% 2.4 KiB of 3.9 KiB, file 2/2 | a.bin 50%") {
+		t.Errorf("unexpected progress of files hashed at once: %q", out.String())
+	}
+	doneA()
+	batch.Finish()
+	if lines := strings.Split(out.String(), "\r"); !strings.Contains(lines[len(lines)-1], "100% 3.9 KiB of 3.9 KiB, file 2/2") {
+		t.Errorf("unexpected progress once both are done: %q", out.String())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// ProofEntry is one entry of a directory listing in a membership proof
+type ProofEntry struct {
+	Type string `json:"type"` // f or d
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+}
+
+// ProofLevel is the full listing of one directory on the path to the root
+type ProofLevel struct {
+	Dir     string       `json:"dir"`
+	Entries []ProofEntry `json:"entries"`
+}
+
+// MembershipProof shows that a file with a given digest is part of the tree
+// identified by a root digest. It holds the listings of the file's directory
+// and of each parent up to the root, innermost first.
+type MembershipProof struct {
+	Version   int           `json:"version"`
+	Algorithm HashAlgorithm `json:"algorithm"`
+	Path      string        `json:"path"`
+	Hash      string        `json:"hash"`
+	Size      int64         `json:"size"`
+	Root      string        `json:"root"`
+	Levels    []ProofLevel  `json:"levels"`
+}
+
+// Prove builds the membership proof of one file of the manifest
+func (m *RollupManifest) Prove(filePath string) (*MembershipProof, error) {
+	filePath = manifestKey(filePath)
+	var file *ManifestFile
+	for i := range m.Files {
+		if m.Files[i].Path == filePath {
+			file = &m.Files[i]
+		}
+	}
+	if file == nil {
+		return nil, fmt.Errorf("%s is not in the manifest", filePath)
+	}
+	digests, listings, err := rollupDirectories(m.Algorithm, m.Files)
+	if err != nil {
+		return nil, err
+	}
+	if digests[rootDir] != m.Root {
+		return nil, fmt.Errorf("the manifest's files do not add up to its root digest")
+	}
+
+	proof := &MembershipProof{Version: 1, Algorithm: m.Algorithm, Path: file.Path, Hash: file.Hash, Size: file.Size, Root: m.Root}
+	for dir := path.Dir(file.Path); ; dir = path.Dir(dir) {
+		level := ProofLevel{Dir: dir}
+		for _, entry := range listings[dir] {
+			kind := "f"
+			if entry.Dir {
+				kind = "d"
+			}
+			level.Entries = append(level.Entries, ProofEntry{Type: kind, Name: entry.Name, Hash: entry.Hash})
+		}
+		proof.Levels = append(proof.Levels, level)
+		if dir == rootDir {
+			return proof, nil
+		}
+	}
+}
+
+// Check verifies the proof against a trusted root digest: the file's digest
+// must appear in its directory listing, and each listing's digest in its
+// parent's, up to a listing whose digest is the root
+func (p *MembershipProof) Check(root string) error {
+	if len(p.Levels) == 0 {
+		return fmt.Errorf("proof has no levels")
+	}
+	want := ProofEntry{Type: "f", Name: path.Base(p.Path), Hash: p.Hash}
+	dir := path.Dir(p.Path)
+	for _, level := range p.Levels {
+		if level.Dir != dir {
+			return fmt.Errorf("proof level %s, expected %s", level.Dir, dir)
+		}
+		found := false
+		entries := make([]rollupEntry, len(level.Entries))
+		for i, entry := range level.Entries {
+			if entry == want {
+				found = true
+			}
+			entries[i] = rollupEntry{Dir: entry.Type == "d", Hash: entry.Hash, Name: entry.Name}
+		}
+		if !found {
+			return fmt.Errorf("%s does not list %s with digest %s", level.Dir, want.Name, want.Hash)
+		}
+		digest, err := rollupDigest(p.Algorithm, entries)
+		if err != nil {
+			return err
+		}
+		want = ProofEntry{Type: "d", Name: path.Base(dir), Hash: digest}
+		if dir == rootDir {
+			break
+		}
+		dir = path.Dir(dir)
+	}
+	if dir != rootDir {
+		return fmt.Errorf("proof ends at %s before reaching the root", dir)
+	}
+	if want.Hash != root {
+		return fmt.Errorf("proof leads to root %s, not %s", want.Hash, root)
+	}
+	return nil
+}
+
+// LoadMembershipProof reads a proof written by `manifest prove`
+func LoadMembershipProof(p string) (*MembershipProof, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proof: %w", err)
+	}
+	var proof MembershipProof
+	if err := json.Unmarshal(data, &proof); err != nil {
+		return nil, fmt.Errorf("invalid proof %s: %w", p, err)
+	}
+	return &proof, nil
+}
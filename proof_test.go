@@ -0,0 +1,45 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMembershipProof(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"README": "readme", "lib/a/x.so": "x", "lib/b/y.so": "y"} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+	}
+	manifest, err := BuildRollupManifest(root, SHA256, NewHashCalculator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof, err := manifest.Prove("lib/a/x.so")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proof.Levels) != 3 || proof.Levels[0].Dir != "lib/a" || proof.Levels[2].Dir != "." {
+		t.Fatalf("unexpected levels: %+v", proof.Levels)
+	}
+	if err := proof.Check(manifest.Root); err != nil {
+		t.Errorf("valid proof rejected: %v", err)
+	}
+	if err := proof.Check(manifest.Directories["lib"]); err == nil {
+		t.Error("proof accepted against the wrong root")
+	}
+
+	forged := *proof
+	forged.Hash = fmt.Sprintf("%x", sha256.Sum256([]byte("forged")))
+	forged.Levels = append([]ProofLevel{}, proof.Levels...)
+	forged.Levels[0] = ProofLevel{Dir: "lib/a", Entries: []ProofEntry{{Type: "f", Name: "x.so", Hash: forged.Hash}}}
+	if err := forged.Check(manifest.Root); err == nil {
+		t.Error("forged listing accepted")
+	}
+	if _, err := manifest.Prove("lib/missing"); err == nil {
+		t.Error("expected an error for a file not in the manifest")
+	}
+}
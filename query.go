@@ -0,0 +1,444 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// entryFilter reports whether a database entry matches a query
+type entryFilter func(DBEntry) bool
+
+// queryToken is a word, quoted string, operator or parenthesis of a query
+type queryToken struct {
+	text   string
+	quoted bool
+	pos    int
+}
+
+// queryOperators are the comparison operators, longest first
+var queryOperators = []string{"<=", ">=", "!=", "=", "<", ">", "~"}
+
+// querySizeUnits are the size suffixes, binary as elsewhere in hashculate
+var querySizeUnits = map[string]int64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+// queryDateLayouts are the accepted date forms, read as UTC
+var queryDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// tokenizeQuery splits a query into tokens
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, queryToken{text: string(c), pos: i})
+			i++
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at position %d", i+1)
+			}
+			tokens = append(tokens, queryToken{text: query[i+1 : i+1+end], quoted: true, pos: i})
+			i += end + 2
+		default:
+			if op := queryOperatorAt(query[i:]); op != "" {
+				tokens = append(tokens, queryToken{text: op, pos: i})
+				i += len(op)
+				continue
+			}
+			start := i
+			for i < len(query) && !strings.ContainsRune(" \t\n()'\"", rune(query[i])) && queryOperatorAt(query[i:]) == "" {
+				i++
+			}
+			tokens = append(tokens, queryToken{text: query[start:i], pos: start})
+		}
+	}
+	return tokens, nil
+}
+
+func queryOperatorAt(s string) string {
+	for _, op := range queryOperators {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// queryParser is a recursive-descent parser over the tokens of a query:
+//
+//	expr      = and { "or" and }
+//	and       = unary { "and" unary }
+//	unary     = "not" unary | "(" expr ")" | condition
+//	condition = field operator value | field ("since" | "before") value
+type queryParser struct {
+	tokens []queryToken
+	next   int
+	end    int
+}
+
+// ParseQuery compiles a filter such as
+// `size > 1GB and algorithm = 'sha256' and changed since '2024-01-01'`
+func ParseQuery(query string) (entryFilter, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return func(DBEntry) bool { return true }, nil
+	}
+	p := &queryParser{tokens: tokens, end: len(query)}
+	filter, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.tokens) {
+		return nil, p.errorf("unexpected %q", p.tokens[p.next].text)
+	}
+	return filter, nil
+}
+
+// errorf describes a problem at the current token
+func (p *queryParser) errorf(format string, args ...any) error {
+	pos := p.end + 1
+	if p.next < len(p.tokens) {
+		pos = p.tokens[p.next].pos + 1
+	}
+	return fmt.Errorf("query: %s at position %d", fmt.Sprintf(format, args...), pos)
+}
+
+// keyword consumes the next token when it is the given unquoted keyword
+func (p *queryParser) keyword(word string) bool {
+	if p.next < len(p.tokens) && !p.tokens[p.next].quoted && strings.EqualFold(p.tokens[p.next].text, word) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+// take returns the next token, failing with what was expected at the end
+func (p *queryParser) take(expected string) (queryToken, error) {
+	if p.next >= len(p.tokens) {
+		return queryToken{}, p.errorf("expected %s", expected)
+	}
+	p.next++
+	return p.tokens[p.next-1], nil
+}
+
+func (p *queryParser) or() (entryFilter, error) {
+	left, err := p.and()
+	for err == nil && p.keyword("or") {
+		var right entryFilter
+		if right, err = p.and(); err == nil {
+			l := left
+			left = func(e DBEntry) bool { return l(e) || right(e) }
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) and() (entryFilter, error) {
+	left, err := p.unary()
+	for err == nil && p.keyword("and") {
+		var right entryFilter
+		if right, err = p.unary(); err == nil {
+			l := left
+			left = func(e DBEntry) bool { return l(e) && right(e) }
+		}
+	}
+	return left, err
+}
+
+func (p *queryParser) unary() (entryFilter, error) {
+	if p.keyword("not") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e DBEntry) bool { return !inner(e) }, nil
+	}
+	if p.keyword("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, p.errorf("expected )")
+		}
+		return inner, nil
+	}
+	return p.condition()
+}
+
+// condition parses one comparison of a field with a value
+func (p *queryParser) condition() (entryFilter, error) {
+	field, err := p.take("a field")
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(field.text)
+	op, err := p.take("an operator")
+	if err != nil {
+		return nil, err
+	}
+	if word := strings.ToLower(op.text); !op.quoted && (word == "since" || word == "before") {
+		if name != "modified" && name != "changed" && name != "recorded" {
+			p.next--
+			return nil, p.errorf("%s compares modified, changed or recorded times", word)
+		}
+		op.text = map[string]string{"since": ">=", "before": "<"}[word]
+	}
+	if op.quoted || queryOperatorAt(op.text) != op.text {
+		p.next--
+		return nil, p.errorf("expected an operator after %s", field.text)
+	}
+	value, err := p.take("a value")
+	if err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case "size":
+		size, err := parseQuerySize(value.text)
+		if err != nil {
+			p.next--
+			return nil, p.errorf("%v", err)
+		}
+		return p.compare(op, func(e DBEntry) int { return cmpInt64(e.Size, size) })
+	case "modified", "changed", "recorded":
+		when, err := parseQueryTime(value.text)
+		if err != nil {
+			p.next--
+			return nil, p.errorf("%v", err)
+		}
+		return p.compare(op, func(e DBEntry) int {
+			t := e.Modified
+			if name == "recorded" {
+				t = e.Recorded
+			}
+			return t.Compare(when)
+		})
+	case "path", "name", "rule":
+		return p.match(op, value.text, false, func(e DBEntry) []string {
+			switch name {
+			case "name":
+				return []string{path.Base(e.Path)}
+			case "rule":
+				return []string{e.Rule}
+			}
+			return []string{e.Path}
+		})
+	case "algorithm":
+		alg, err := parseAlgorithm(value.text)
+		if err != nil {
+			p.next--
+			return nil, p.errorf("%v", err)
+		}
+		has := func(e DBEntry) bool { return e.Hashes[alg] != "" }
+		switch op.text {
+		case "=":
+			return has, nil
+		case "!=":
+			return func(e DBEntry) bool { return !has(e) }, nil
+		}
+		return nil, p.operatorError(op, name)
+	case "hash":
+		return p.match(op, value.text, true, func(e DBEntry) []string {
+			var digests []string
+			for _, digest := range e.Hashes {
+				digests = append(digests, digest)
+			}
+			return digests
+		})
+	}
+	if alg, err := parseAlgorithm(name); err == nil && alg != CIDV1 {
+		return p.match(op, value.text, true, func(e DBEntry) []string { return []string{e.Hashes[alg]} })
+	}
+	p.next -= 3
+	return nil, p.errorf("unknown field %q (path, name, size, modified, changed, recorded, algorithm, rule, hash, md5, sha1, sha256, sha512)", field.text)
+}
+
+// compare builds an ordered comparison from cmp, which compares an entry to the value
+func (p *queryParser) compare(op queryToken, cmp func(DBEntry) int) (entryFilter, error) {
+	test := map[string]func(int) bool{
+		"=": func(c int) bool { return c == 0 }, "!=": func(c int) bool { return c != 0 },
+		"<": func(c int) bool { return c < 0 }, "<=": func(c int) bool { return c <= 0 },
+		">": func(c int) bool { return c > 0 }, ">=": func(c int) bool { return c >= 0 },
+	}[op.text]
+	if test == nil {
+		return nil, p.operatorError(op, "this field")
+	}
+	return func(e DBEntry) bool { return test(cmp(e)) }, nil
+}
+
+// match builds an equality or glob (~) test against any of the strings of
+// an entry; digests compare case-insensitively
+func (p *queryParser) match(op queryToken, value string, digest bool, values func(DBEntry) []string) (entryFilter, error) {
+	if digest {
+		value = strings.ToLower(value)
+	}
+	if op.text == "~" {
+		if _, err := path.Match(value, ""); err != nil {
+			p.next--
+			return nil, p.errorf("invalid pattern %q", value)
+		}
+	}
+	var test func(string) bool
+	switch op.text {
+	case "=", "!=":
+		test = func(s string) bool { return s == value }
+	case "~":
+		test = func(s string) bool {
+			ok, _ := path.Match(value, s)
+			return ok
+		}
+	default:
+		return nil, p.operatorError(op, "text fields")
+	}
+	return func(e DBEntry) bool {
+		found := false
+		for _, s := range values(e) {
+			if digest {
+				s = strings.ToLower(s)
+			}
+			found = found || test(s)
+		}
+		return found == (op.text != "!=")
+	}, nil
+}
+
+func (p *queryParser) operatorError(op queryToken, field string) error {
+	p.next -= 2
+	return p.errorf("%s cannot be used with %s", op.text, field)
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// parseQuerySize reads a size such as 1GB, 512k or 1.5TiB
+func parseQuerySize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	number, err := strconv.ParseFloat(s[:i], 64)
+	unit, ok := querySizeUnits[strings.ToLower(s[i:])]
+	if err != nil || !ok {
+		return 0, fmt.Errorf("invalid size %q (e.g. 500, 64KB, 1.5GB)", s)
+	}
+	return int64(number * float64(unit)), nil
+}
+
+// parseQueryTime reads a date or time in UTC
+func parseQueryTime(s string) (time.Time, error) {
+	for _, layout := range queryDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q (e.g. 2024-01-01 or 2024-01-01T12:00:00Z)", s)
+}
+
+// runQuery implements the query command
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	dbPath := fs.String("db", "", "Hash database to query")
+	format := fs.String("format", "text", "Output format: text, csv, ndjson, hashdeep, parquet")
+	count := fs.Bool("count", false, "Only print the number of matching entries")
+	sortBy := fs.String("sort", "path", "Order by path, or by size, modified or recorded, largest and newest first")
+	limit := fs.Int("limit", 0, "Print at most this many entries")
+	positional := parseFlags(fs, args)
+	if *dbPath == "" || len(positional) > 1 {
+		fmt.Println("Usage: hashculate query -db <db.json> [\"<filter>\"] [-format text|csv|ndjson|hashdeep|parquet] [-count]")
+		fmt.Println("           [-sort path|size|modified|recorded] [-limit <n>]")
+		return 1
+	}
+	query := ""
+	if len(positional) == 1 {
+		query = positional[0]
+	}
+	filter, err := ParseQuery(query)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if _, err := os.Stat(*dbPath); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	db, err := OpenHashDB(*dbPath)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	all := db.Entries()
+	var matched []DBEntry
+	for _, entry := range all {
+		if filter(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	switch *sortBy {
+	case "path":
+	case "size":
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].Size > matched[j].Size })
+	case "modified":
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].Modified.After(matched[j].Modified) })
+	case "recorded":
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].Recorded.After(matched[j].Recorded) })
+	default:
+		fmt.Printf("Error: unsupported sort order: %s. Supported: path, size, modified, recorded\n", *sortBy)
+		return 1
+	}
+	if *limit > 0 && len(matched) > *limit {
+		matched = matched[:*limit]
+	}
+
+	if *count {
+		fmt.Println(len(matched))
+		return 0
+	}
+	if *format != "text" {
+		// Exports of the database order entries by path
+		result := &HashDB{entries: map[string]*DBEntry{}}
+		for i := range matched {
+			result.entries[matched[i].Path] = &matched[i]
+		}
+		if err := result.Export(os.Stdout, *format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	for _, entry := range matched {
+		modified := "-"
+		if !entry.Modified.IsZero() {
+			modified = entry.Modified.Format("2006-01-02 15:04")
+		}
+		fmt.Printf("%s  %10s  %s\n", modified, markdownSize(entry.Size), entry.Path)
+	}
+	fmt.Printf("\n%d of %d entries match\n", len(matched), len(all))
+	return 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	day := func(s string) time.Time { d, _ := time.Parse("2006-01-02", s); return d }
+	entries := []DBEntry{
+		{Path: "iso/big.iso", Size: 3 << 30, Modified: day("2024-03-01"), Hashes: map[HashAlgorithm]string{SHA256: "AB12"}},
+		{Path: "iso/old.iso", Size: 2 << 30, Modified: day("2023-06-01"), Hashes: map[HashAlgorithm]string{SHA256: "cd34", MD5: "ee"}, Rule: "*.iso"},
+		{Path: "docs/a.txt", Size: 100, Modified: day("2024-05-01"), Recorded: day("2024-05-02"), Hashes: map[HashAlgorithm]string{MD5: "ff"}},
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"size > 1GB and algorithm = 'sha256' and changed since '2024-01-01'", "iso/big.iso"},
+		{"", "iso/big.iso iso/old.iso docs/a.txt"},
+		{"size <= 2GiB", "iso/old.iso docs/a.txt"},
+		{"modified before 2024-01-01 or recorded since \"2024-05-01\"", "iso/old.iso docs/a.txt"},
+		{"not (name ~ '*.iso') or sha256 = ab12", "iso/big.iso docs/a.txt"},
+		{"algorithm != md5", "iso/big.iso"},
+		{"md5 != '' and NOT rule = '*.iso'", "docs/a.txt"},
+		{"hash ~ 'c*' or path = docs/a.txt", "iso/old.iso docs/a.txt"},
+		{"size=100", "docs/a.txt"},
+	}
+	for _, tt := range tests {
+		filter, err := ParseQuery(tt.query)
+		if err != nil {
+			t.Errorf("%q: %v", tt.query, err)
+			continue
+		}
+		var got []string
+		for _, entry := range entries {
+			if filter(entry) {
+				got = append(got, entry.Path)
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%q matched %v, want %s", tt.query, got, tt.want)
+		}
+	}
+
+	for query, want := range map[string]string{
+		"size >":                "expected a value at position 7",
+		"size > lots":           `invalid size "lots"`,
+		"colour = red":          `unknown field "colour"`,
+		"size since 1GB":        "since compares modified, changed or recorded times at position 6",
+		"path < a":              "< cannot be used with text fields at position 6",
+		"(size > 1 and":         "expected a field",
+		"size > 1 size":         `unexpected "size" at position 10`,
+		"modified > yesterday":  `invalid date "yesterday"`,
+		"path = 'unterminated":  "unterminated string at position 8",
+		"algorithm = whirlpool": "unsupported",
+	} {
+		if _, err := ParseQuery(query); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: error %v, want %q", query, err, want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// rcloneMarkers stand in for the digest in rclone hashsum listings when a
+// remote lacks the hash or an object could not be read
+var rcloneMarkers = []string{"UNSUPPORTED", "ERROR"}
+
+// rcloneLine formats a listing line as rclone hashsum does: the digest, or a
+// marker right-aligned to the digest's width, two spaces and the path
+func rcloneLine(algorithm HashAlgorithm, sum, name string) string {
+	width := 0
+	for length, alg := range digestLengths {
+		if alg == algorithm {
+			width = length
+		}
+	}
+	return fmt.Sprintf("%*s  %s\n", width, sum, name)
+}
+
+// rcloneMarkerLine returns the path of a line whose digest is an rclone
+// marker, so listings of remotes without the hash still load
+func rcloneMarkerLine(text string) (string, bool) {
+	trimmed := strings.TrimLeft(text, " ")
+	for _, marker := range rcloneMarkers {
+		if name, ok := strings.CutPrefix(trimmed, marker+"  "); ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// WriteRcloneHashsum hashes every file below the given paths and writes the
+// listing `rclone hashsum` prints, which `rclone check -C` and `rclone
+// checksum` read back. Files are named as in markdown output. A file that
+// cannot be read gets the ERROR marker, and the error is returned once the
+// listing is complete.
+func WriteRcloneHashsum(w io.Writer, paths []string, algorithm HashAlgorithm, calculator *HashCalculator) error {
+	failed := 0
+	for _, root := range paths {
+		files, err := calculator.listFiles(root)
+		if err != nil {
+			return fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, path := range files {
+			name := filepath.Base(path)
+			if path != root {
+				name = relativeSlashPath(root, path)
+			}
+			name = calculator.Paths.name(path, name)
+			sum := "ERROR"
+			if result, err := calculator.CalculateFileHash(path, algorithm, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+				failed++
+			} else {
+				sum = result.Hash
+			}
+			if _, err := io.WriteString(w, rcloneLine(algorithm, sum, name)); err != nil {
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d file(s) could not be read", failed)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRcloneHashsum(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "photos"), 0755)
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644)
+	os.WriteFile(filepath.Join(dir, "photos", "b.jpg"), []byte("world"), 0644)
+
+	var out strings.Builder
+	if err := WriteRcloneHashsum(&out, []string{dir}, MD5, NewHashCalculator()); err != nil {
+		t.Fatal(err)
+	}
+	want := "5d41402abc4b2a76b9719d911017c592  a.txt\n" +
+		"7d793037a0760186574b0282f2f435e7  photos/b.jpg\n"
+	if out.String() != want {
+		t.Errorf("listing:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	// Markers are right-aligned to the digest width, as rclone prints them
+	if got := rcloneLine(SHA1, "ERROR", "c.bin"); got != strings.Repeat(" ", 35)+"ERROR  c.bin\n" {
+		t.Errorf("marker line = %q", got)
+	}
+
+	// Listings of remotes without the hash load with those files unchecked
+	listing := want + rcloneLine(MD5, "UNSUPPORTED", "remote only.bin")
+	entries, err := parseChecksumLines([]byte(listing), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Path != "remote only.bin" || len(entries[2].Checksums) != 0 {
+		t.Errorf("entries = %+v", entries)
+	}
+	results := VerifySBOM(entries, dir, NewHashCalculator())
+	if results[0].Status != "OK" || results[1].Status != "OK" || results[2].Status != "UNSUPPORTED" {
+		t.Errorf("results = %+v", results)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openInput opens a file to hash. In read-only mode the final path component
+// must not be a symlink and, where the platform allows, access times are left
+// untouched; the file is never opened for writing either way.
+func (hc *HashCalculator) openInput(path string) (*os.File, error) {
+	if !hc.ReadOnly {
+		return os.Open(path)
+	}
+	file, err := openReadOnly(path)
+	if err != nil {
+		return nil, fmt.Errorf("read-only open: %w", err)
+	}
+	return file, nil
+}
+
+// resolveExisting returns the absolute path with symlinks resolved as far as
+// the path exists
+func resolveExisting(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		return resolved
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
+
+// checkReadOnlyOutputs rejects output files that are the input, lie inside an
+// input directory or next to an input, so nothing hashculate writes can touch
+// the evidence or the directory holding it
+func checkReadOnlyOutputs(input string, outputs []string) error {
+	in := resolveExisting(input)
+	info, err := os.Stat(in)
+	isDir := err == nil && info.IsDir()
+	for _, output := range outputs {
+		if output == "" {
+			continue
+		}
+		out := resolveExisting(output)
+		switch {
+		case out == in || (isDir && strings.HasPrefix(out, in+string(filepath.Separator))):
+			return fmt.Errorf("-readonly-assert: %s would write to the input %s", output, input)
+		case filepath.Dir(out) == filepath.Dir(in):
+			return fmt.Errorf("-readonly-assert: %s would write next to the input %s", output, input)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// openReadOnly opens path with O_NOFOLLOW and O_NOATIME. O_NOATIME is only
+// permitted to the file's owner, so it is dropped when the kernel refuses it.
+func openReadOnly(path string) (*os.File, error) {
+	flags := syscall.O_RDONLY | syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+	fd, err := syscall.Open(path, flags|syscall.O_NOATIME, 0)
+	if err == syscall.EPERM {
+		fd, err = syscall.Open(path, flags, 0)
+	}
+	if err == syscall.ELOOP {
+		return nil, fmt.Errorf("%s is a symlink", path)
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// Landlock system calls and flags (linux/landlock.h)
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	landlockAccessExecute  = 1 << 0
+	landlockAccessReadFile = 1 << 2
+	landlockAccessReadDir  = 1 << 3
+	landlockAccessABI1     = 1<<13 - 1 // execute through make_sym
+	landlockAccessRefer    = 1 << 13   // ABI 2
+	landlockAccessTruncate = 1 << 14   // ABI 3
+
+	prSetNoNewPrivs = 38
+	oPath           = 0x200000 // O_PATH, missing from package syscall
+)
+
+// ApplyLandlock confines the whole process to reading files, writing only
+// below the directories of the given output files. It returns the Landlock
+// ABI version the kernel enforces.
+func ApplyLandlock(outputs []string) (int, error) {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return 0, fmt.Errorf("Landlock is not available: %w", errno)
+	}
+	handled := uint64(landlockAccessABI1)
+	if abi >= 2 {
+		handled |= landlockAccessRefer
+	}
+	if abi >= 3 {
+		handled |= landlockAccessTruncate
+	}
+
+	attr := handled
+	rulesetFD, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return 0, fmt.Errorf("failed to create Landlock ruleset: %w", errno)
+	}
+	defer syscall.Close(int(rulesetFD))
+
+	if err := landlockAllow(int(rulesetFD), "/", landlockAccessReadFile|landlockAccessReadDir|landlockAccessExecute); err != nil {
+		return 0, err
+	}
+	for _, output := range outputs {
+		if output == "" {
+			continue
+		}
+		if err := landlockAllow(int(rulesetFD), filepath.Dir(resolveExisting(output)), handled); err != nil {
+			return 0, err
+		}
+	}
+
+	// Every thread must be restricted, not just the calling one
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return 0, landlockThreadsError("set no_new_privs", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(sysLandlockRestrictSelf, rulesetFD, 0, 0); errno != 0 {
+		return 0, landlockThreadsError("restrict process", errno)
+	}
+	return int(abi), nil
+}
+
+// landlockAllow grants access beneath dir
+func landlockAllow(rulesetFD int, dir string, access uint64) error {
+	fd, err := syscall.Open(dir, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("landlock rule for %s: %w", dir, err)
+	}
+	defer syscall.Close(fd)
+	// struct landlock_path_beneath_attr is packed: u64 allowed_access, s32 parent_fd
+	var rule [12]byte
+	*(*uint64)(unsafe.Pointer(&rule[0])) = access
+	*(*int32)(unsafe.Pointer(&rule[8])) = int32(fd)
+	if _, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFD), landlockRulePathBeneath, uintptr(unsafe.Pointer(&rule[0])), 0, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock rule for %s: %w", dir, errno)
+	}
+	return nil
+}
+
+// landlockThreadsError explains that cgo builds cannot restrict every thread
+func landlockThreadsError(step string, errno syscall.Errno) error {
+	if errors.Is(errno, syscall.ENOTSUP) {
+		return fmt.Errorf("Landlock: cannot %s on all threads in a cgo build; rebuild with CGO_ENABLED=0", step)
+	}
+	return fmt.Errorf("Landlock: failed to %s: %w", step, errno)
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// openReadOnly refuses symlinks and opens path for reading. Without O_NOFOLLOW
+// on every platform the check is made with Lstat before opening.
+func openReadOnly(path string) (*os.File, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return nil, fmt.Errorf("%s is a symlink", path)
+	}
+	return os.Open(path)
+}
+
+// ApplyLandlock is only supported on Linux
+func ApplyLandlock(outputs []string) (int, error) {
+	return 0, fmt.Errorf("Landlock is only available on Linux")
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadOnlyAssert(t *testing.T) {
+	dir := t.TempDir()
+	evidence := filepath.Join(dir, "evidence")
+	os.MkdirAll(evidence, 0755)
+	image := filepath.Join(evidence, "disk.img")
+	os.WriteFile(image, []byte("evidence"), 0644)
+	link := filepath.Join(dir, "link.img")
+	if err := os.Symlink(image, link); err != nil {
+		t.Skipf("symlinks unavailable: %v", err)
+	}
+
+	calculator := NewHashCalculator()
+	calculator.ReadOnly = true
+	if _, err := calculator.CalculateFileHash(image, SHA256, nil); err != nil {
+		t.Errorf("regular file refused: %v", err)
+	}
+	if _, err := calculator.CalculateFileHash(link, SHA256, nil); err == nil {
+		t.Error("expected a symlinked input to be refused")
+	}
+
+	if err := checkReadOnlyOutputs(image, []string{filepath.Join(dir, "chain.log"), ""}); err != nil {
+		t.Errorf("output outside the evidence refused: %v", err)
+	}
+	for _, output := range []string{image, link, filepath.Join(evidence, "chain.log")} {
+		input := image
+		if output != image && output != link {
+			input = evidence
+		}
+		if err := checkReadOnlyOutputs(input, []string{output}); err == nil {
+			t.Errorf("expected %s to be refused as an output for %s", output, input)
+		}
+	}
+
+	// Nor may anything be written beside the input, such as a log or checksum file
+	for _, output := range []string{filepath.Join(evidence, "chain.log"), filepath.Join(evidence, "SHA256SUMS")} {
+		if err := checkReadOnlyOutputs(image, []string{output}); err == nil {
+			t.Errorf("expected %s next to %s to be refused", output, image)
+		}
+	}
+}
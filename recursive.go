@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// WalkFilter chooses the files -recursive hashes. Patterns containing a slash
+// match paths relative to the directory given; others match names at any depth.
+type WalkFilter struct {
+	Include      []string // When set, only files matching one of these are hashed
+	Exclude      []string // Files and directories to skip
+	SkipSymlinks bool     // Skip symbolic links to files; links to directories are never followed
+	SkipHidden   bool     // Skip dot files and directories, and those marked hidden on Windows
+}
+
+// walkFiles calls visit for each file below roots in the calculator's
+// filesystem that the filter lets through, in lexical order as the walk
+// reaches it, so hashing starts at once and nothing is held in memory for
+// large trees. A root that is a file is visited as given. Paths that cannot be
+// listed are visited with their error and the walk carries on.
+func (hc *HashCalculator) walkFiles(roots []string, filter WalkFilter, visit func(path string, err error)) {
+	fsys := hc.fs()
+	for _, root := range roots {
+		hasher.WalkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				visit(path, err)
+				return nil
+			}
+			if path == root {
+				if !d.IsDir() {
+					visit(root, nil)
+				}
+				return nil
+			}
+			rel := relativeSlashPath(root, path)
+			if (filter.SkipHidden && hidden(d)) || matchesPattern(rel, filter.Exclude) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || (len(filter.Include) > 0 && !matchesPattern(rel, filter.Include)) {
+				return nil
+			}
+			switch {
+			case d.Type().IsRegular():
+				visit(path, nil)
+			case d.Type()&fs.ModeSymlink != 0 && !filter.SkipSymlinks:
+				// Only links to regular files are read; devices and pipes could block
+				if target, err := fs.Stat(fsys, path); err != nil {
+					visit(path, err)
+				} else if target.Mode().IsRegular() {
+					visit(path, nil)
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// matchesPattern reports whether a slash-separated relative path, or its
+// name, matches one of patterns
+func matchesPattern(rel string, patterns []string) bool {
+	if caseInsensitive {
+		rel = strings.ToLower(rel)
+	}
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(strings.TrimPrefix(pattern, "./"))
+		if caseInsensitive {
+			pattern = strings.ToLower(pattern)
+		}
+		subject := rel
+		if !strings.Contains(pattern, "/") {
+			subject = rel[strings.LastIndex(rel, "/")+1:]
+		}
+		if matched, _ := filepath.Match(pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hidden reports whether a directory entry is a dot file or marked hidden
+func hidden(d fs.DirEntry) bool {
+	return strings.HasPrefix(d.Name(), ".") || hiddenAttribute(d)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWalkFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.log", "src/main.go", "src/vendor/dep.go", ".git/config", "docs/.draft.txt", "docs/guide.txt"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(name), 0644)
+	}
+	os.Symlink(filepath.Join(dir, "a.txt"), filepath.Join(dir, "link.txt"))
+	os.Symlink(filepath.Join(dir, "src"), filepath.Join(dir, "src-link"))
+
+	walk := func(filter WalkFilter) []string {
+		var got []string
+		NewHashCalculator().walkFiles([]string{dir}, filter, func(path string, err error) {
+			if err != nil {
+				t.Errorf("%s: %v", path, err)
+			}
+			got = append(got, relativeSlashPath(dir, path))
+		})
+		return got
+	}
+
+	// Links to directories are never followed
+	want := []string{".git/config", "a.txt", "b.log", "docs/.draft.txt", "docs/guide.txt", "link.txt", "src/main.go", "src/vendor/dep.go"}
+	if got := walk(WalkFilter{}); !slices.Equal(got, want) {
+		t.Errorf("walk = %q, want %q", got, want)
+	}
+	want = []string{"a.txt", "docs/guide.txt", "src/main.go"}
+	if got := walk(WalkFilter{Include: []string{"*.txt", "*.go"}, Exclude: []string{"src/vendor"}, SkipHidden: true, SkipSymlinks: true}); !slices.Equal(got, want) {
+		t.Errorf("filtered walk = %q, want %q", got, want)
+	}
+}
+
+func TestWalkFilesFS(t *testing.T) {
+	calculator := NewHashCalculator()
+	calculator.FS = fstest.MapFS{
+		"dist/app.tar.gz":        {Data: []byte("app")},
+		"dist/docs/README.md":    {Data: []byte("readme")},
+		"dist/docs/.notes":       {Data: []byte("notes")},
+		"dist/vendor/dep.tar.gz": {Data: []byte("dep")},
+	}
+	var got []string
+	filter := WalkFilter{Exclude: []string{"vendor"}, SkipHidden: true}
+	calculator.walkFiles([]string{"dist", "missing"}, filter, func(path string, err error) {
+		if err != nil {
+			path += " (error)"
+		}
+		got = append(got, path)
+	})
+	if want := []string{"dist/app.tar.gz", "dist/docs/README.md", "missing (error)"}; !slices.Equal(got, want) {
+		t.Errorf("walk = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+)
+
+// fimState is what the monitor runs with, rebuilt from the policy on reload
+type fimState struct {
+	config  *FIMConfig
+	monitor *FIMMonitor
+	groups  []*PolicyGroup
+	sinks   map[string]*LogSink
+}
+
+// loadFIMState reads the policy, selects the groups to run (all, or only the
+// named one) and opens each group's alert destination. The database is
+// reopened only when previous is nil or names a different file.
+func loadFIMState(path, only string, previous *fimState) (*fimState, error) {
+	config, err := LoadFIMConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	state := &fimState{config: config, sinks: map[string]*LogSink{}}
+	if previous != nil && previous.config.Database == config.Database {
+		state.monitor = &FIMMonitor{Config: config, DB: previous.monitor.DB, calc: previous.monitor.calc}
+		state.monitor.DB.Backups = config.Retention.Backups
+	} else if state.monitor, err = NewFIMMonitor(config); err != nil {
+		return nil, err
+	}
+	for i := range config.Groups {
+		if only == "" || config.Groups[i].Name == only {
+			state.groups = append(state.groups, &config.Groups[i])
+		}
+	}
+	if len(state.groups) == 0 {
+		return nil, fmt.Errorf("no policy group named %q", only)
+	}
+
+	// Each group alerts to its own destination
+	for _, group := range state.groups {
+		if group.Alert.LogSink == "" {
+			continue
+		}
+		token := group.Alert.LogToken
+		if token == "" {
+			token = os.Getenv("HASHCULATE_LOG_TOKEN")
+		}
+		sink, err := OpenLogSink(group.Alert.LogSink, group.Alert.LogTarget, token)
+		if err != nil {
+			state.close()
+			return nil, fmt.Errorf("group %s: %w", group.Name, err)
+		}
+		state.sinks[group.Name] = sink
+	}
+	return state, nil
+}
+
+// close closes the alert destinations
+func (s *fimState) close() {
+	for _, sink := range s.sinks {
+		sink.Close()
+	}
+}
+
+// reloadRequest asks a daemon to reload; the outcome is sent on reply when it is not nil
+type reloadRequest struct {
+	reply chan error
+}
+
+// reloadRequested returns a channel that receives a request whenever one of
+// the reload signals (SIGHUP) arrives
+func reloadRequested() chan reloadRequest {
+	requests := make(chan reloadRequest, 1)
+	if len(reloadSignals) == 0 {
+		return requests
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, reloadSignals...)
+	go func() {
+		for range signals {
+			select {
+			case requests <- reloadRequest{}:
+			default: // A reload is already pending
+			}
+		}
+	}()
+	return requests
+}
+
+// reloadHandler serves POST /reload, answering once the daemon has reloaded,
+// which waits for a scan in progress to finish
+func reloadHandler(requests chan<- reloadRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		request := reloadRequest{reply: make(chan error, 1)}
+		select {
+		case requests <- request:
+		case <-r.Context().Done():
+			return
+		}
+		select {
+		case err := <-request.reply:
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			fmt.Fprintln(w, "reloaded")
+		case <-r.Context().Done():
+		}
+	}
+}
+
+// reloadFIM rebuilds the monitor from its policy file between scans. An
+// invalid policy leaves the monitor running as it was. Groups keep their
+// schedule by name, and those that are gone stop counting towards health.
+func reloadFIM(state *fimState, flags *fimFlags, health *healthStatus) (*fimState, error) {
+	sdNotify("RELOADING=1")
+	defer sdNotify("READY=1")
+	reloaded, err := loadFIMState(*flags.configPath, *flags.only, state)
+	if err != nil {
+		fmt.Printf("Error: reload: %v, keeping the running policy\n", err)
+		return state, err
+	}
+	kept := map[string]bool{}
+	for _, group := range reloaded.groups {
+		kept[group.Name] = true
+	}
+	for _, group := range state.groups {
+		if !kept[group.Name] {
+			health.Set("group "+group.Name, nil)
+		}
+	}
+	state.close()
+	fmt.Printf("Reloaded %s: %d group(s)\n", *flags.configPath, len(reloaded.groups))
+	for _, group := range reloaded.groups {
+		reloaded.sinks[group.Name].Emit(logInfo, "fim.reload", "fim: policy reloaded", map[string]any{"group": group.Name})
+	}
+	return reloaded, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// reloadSignals are the signals that make a daemon reload its configuration;
+// there are none, so POST /reload is the only way
+var reloadSignals []os.Signal
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadFIM(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "etc"), 0755)
+	os.WriteFile(filepath.Join(dir, "etc", "app.conf"), []byte("key=value"), 0644)
+	configPath := filepath.Join(dir, "fim.yaml")
+	database := "database: " + filepath.Join(dir, "fim.json") + "\n"
+	os.WriteFile(configPath, []byte(database+"paths: ["+filepath.Join(dir, "etc")+"]\ninterval: 1h\n"), 0644)
+
+	only := ""
+	flags := &fimFlags{configPath: &configPath, only: &only}
+	health := &healthStatus{}
+	state, err := loadFIMState(configPath, only, nil)
+	if err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+	health.Set("group default", os.ErrNotExist)
+
+	// A renamed group with a new schedule replaces the old one, on the same database
+	os.WriteFile(configPath, []byte(database+"groups:\n  - name: config\n    paths: ["+filepath.Join(dir, "etc")+"]\n    interval: 5m\n"), 0644)
+	reloaded, err := reloadFIM(state, flags, health)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if len(reloaded.groups) != 1 || reloaded.groups[0].Name != "config" || reloaded.groups[0].interval != 5*time.Minute {
+		t.Errorf("Unexpected groups after reload: %+v", reloaded.groups)
+	}
+	if reloaded.monitor.DB != state.monitor.DB {
+		t.Error("Expected the database to be kept when its path is unchanged")
+	}
+	if len(health.failed) != 0 {
+		t.Errorf("Expected the removed group to stop counting towards health, got %v", health.failed)
+	}
+
+	// An invalid policy keeps the running one
+	os.WriteFile(configPath, []byte(database+"interval: soon\n"), 0644)
+	if kept, err := reloadFIM(reloaded, flags, health); err == nil || kept != reloaded {
+		t.Error("Expected an invalid policy to be rejected and the running one kept")
+	}
+}
+
+func TestReloadHandler(t *testing.T) {
+	requests := make(chan reloadRequest)
+	go func() {
+		request := <-requests
+		request.reply <- nil
+		request = <-requests
+		request.reply <- os.ErrNotExist
+	}()
+	handler := reloadHandler(requests)
+	for _, want := range []int{http.StatusOK, http.StatusUnprocessableEntity} {
+		recorder := httptest.NewRecorder()
+		handler(recorder, httptest.NewRequest("POST", "/reload", nil))
+		if recorder.Code != want {
+			t.Errorf("Expected %d, got %d: %s", want, recorder.Code, recorder.Body)
+		}
+	}
+}
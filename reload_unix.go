@@ -0,0 +1,11 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals are the signals that make a daemon reload its configuration
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// remoteDialTimeout bounds connection setup for FTP inputs
+const remoteDialTimeout = 30 * time.Second
+
+// ftpReader streams a file over an FTP data connection
+type ftpReader struct {
+	control *textproto.Conn
+	data    net.Conn
+}
+
+func (r *ftpReader) Read(p []byte) (int, error) {
+	return r.data.Read(p)
+}
+
+// Close ends the transfer and checks the server reported it complete
+func (r *ftpReader) Close() error {
+	r.data.Close()
+	defer r.control.Close()
+	if _, _, err := r.control.ReadResponse(226); err != nil {
+		return err
+	}
+	r.control.Cmd("QUIT")
+	return nil
+}
+
+// openFTP logs in (anonymously without credentials) and starts a binary passive-mode download
+func openFTP(u *url.URL, creds RemoteCredentials) (io.ReadCloser, int64, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+	conn, err := net.DialTimeout("tcp", host, remoteDialTimeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	control := textproto.NewConn(conn)
+	fail := func(err error) (io.ReadCloser, int64, error) {
+		control.Close()
+		return nil, 0, err
+	}
+	command := func(expect int, format string, args ...any) (int, string, error) {
+		if _, err := control.Cmd(format, args...); err != nil {
+			return 0, "", err
+		}
+		return control.ReadResponse(expect)
+	}
+
+	if _, _, err := control.ReadResponse(220); err != nil {
+		return fail(err)
+	}
+	user, password := creds.resolve(u)
+	if user == "" {
+		user, password = "anonymous", "anonymous@"
+	}
+	code, _, err := command(3, "USER %s", user)
+	if err != nil && code != 230 {
+		return fail(err)
+	}
+	if code == 331 {
+		if _, _, err := command(230, "PASS %s", password); err != nil {
+			return fail(err)
+		}
+	}
+	if _, _, err := command(200, "TYPE I"); err != nil {
+		return fail(err)
+	}
+
+	size := int64(-1)
+	if _, msg, err := command(213, "SIZE %s", u.Path); err == nil {
+		size, _ = strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	}
+
+	// Passive mode; the data connection always goes to the control host
+	var port int
+	if _, msg, err := command(229, "EPSV"); err == nil {
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start < 0 || end < start {
+			return fail(fmt.Errorf("unexpected EPSV reply: %s", msg))
+		}
+		port, err = strconv.Atoi(msg[start+4 : end])
+		if err != nil {
+			return fail(fmt.Errorf("unexpected EPSV reply: %s", msg))
+		}
+	} else {
+		_, msg, err := command(227, "PASV")
+		if err != nil {
+			return fail(err)
+		}
+		start, end := strings.Index(msg, "("), strings.Index(msg, ")")
+		fields := strings.Split(msg[start+1:max(end, start+1)], ",")
+		if start < 0 || len(fields) != 6 {
+			return fail(fmt.Errorf("unexpected PASV reply: %s", msg))
+		}
+		high, _ := strconv.Atoi(fields[4])
+		low, _ := strconv.Atoi(fields[5])
+		port = high<<8 | low
+	}
+	data, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), strconv.Itoa(port)), remoteDialTimeout)
+	if err != nil {
+		return fail(err)
+	}
+	if _, _, err := command(1, "RETR %s", u.Path); err != nil {
+		data.Close()
+		return fail(err)
+	}
+	return &ftpReader{control: control, data: data}, size, nil
+}
+
+// SFTP protocol version 3 packet types and flags
+const (
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpStat    = 17
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+
+	sftpReadFlag  = 0x1
+	sftpAttrSize  = 0x1
+	sftpStatusEOF = 1
+	sftpChunkSize = 32 * 1024
+)
+
+// sftpClient speaks the SFTP v3 protocol over an ssh subsystem channel
+type sftpClient struct {
+	in     io.Writer
+	out    *bufio.Reader
+	nextID uint32
+}
+
+// sftpCommand builds the ssh invocation that opens the sftp subsystem; the
+// user's ssh config, agent and known_hosts apply
+var sftpCommand = func(u *url.URL, user string, identity string) *exec.Cmd {
+	args := []string{"-s"}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	if identity != "" {
+		args = append(args, "-i", identity)
+	}
+	if user != "" {
+		args = append(args, "-l", user)
+	}
+	return exec.Command("ssh", append(args, "--", u.Hostname(), "sftp")...)
+}
+
+// packet sends one SFTP packet
+func (c *sftpClient) packet(kind byte, payload []byte) error {
+	header := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+	_, err := c.in.Write(append(append(header, kind), payload...))
+	return err
+}
+
+// request sends a packet with a fresh request id and returns the reply type and payload
+func (c *sftpClient) request(kind byte, payload []byte) (byte, []byte, error) {
+	c.nextID++
+	if err := c.packet(kind, append(binary.BigEndian.AppendUint32(nil, c.nextID), payload...)); err != nil {
+		return 0, nil, err
+	}
+	reply, body, err := c.reply()
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(body) < 4 || binary.BigEndian.Uint32(body) != c.nextID {
+		return 0, nil, fmt.Errorf("sftp: unexpected reply id")
+	}
+	return reply, body[4:], nil
+}
+
+// reply reads one SFTP packet
+func (c *sftpClient) reply() (byte, []byte, error) {
+	var length uint32
+	if err := binary.Read(c.out, binary.BigEndian, &length); err != nil {
+		return 0, nil, err
+	}
+	if length == 0 || length > 256*1024 {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(c.out, packet); err != nil {
+		return 0, nil, err
+	}
+	return packet[0], packet[1:], nil
+}
+
+// sftpString encodes an SFTP string
+func sftpString(s []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(s))), s...)
+}
+
+// sftpStatusError converts a STATUS reply into an error
+func sftpStatusError(body []byte) error {
+	if len(body) < 4 {
+		return fmt.Errorf("sftp: malformed status")
+	}
+	code := binary.BigEndian.Uint32(body)
+	if code == sftpStatusEOF {
+		return io.EOF
+	}
+	message := ""
+	if len(body) >= 8 {
+		n := binary.BigEndian.Uint32(body[4:])
+		if int(n) <= len(body)-8 {
+			message = string(body[8 : 8+n])
+		}
+	}
+	return fmt.Errorf("sftp: status %d: %s", code, message)
+}
+
+// sftpFile reads a remote file sequentially
+type sftpFile struct {
+	client *sftpClient
+	handle []byte
+	offset uint64
+	done   func() error
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	length := uint32(min(len(p), sftpChunkSize))
+	payload := append(sftpString(f.handle), binary.BigEndian.AppendUint64(nil, f.offset)...)
+	kind, body, err := f.client.request(sftpRead, binary.BigEndian.AppendUint32(payload, length))
+	if err != nil {
+		return 0, err
+	}
+	switch kind {
+	case sftpData:
+		if len(body) < 4 || int(binary.BigEndian.Uint32(body)) > len(body)-4 {
+			return 0, fmt.Errorf("sftp: malformed data")
+		}
+		n := copy(p, body[4:4+binary.BigEndian.Uint32(body)])
+		f.offset += uint64(n)
+		return n, nil
+	case sftpStatus:
+		return 0, sftpStatusError(body)
+	}
+	return 0, fmt.Errorf("sftp: unexpected reply type %d", kind)
+}
+
+func (f *sftpFile) Close() error {
+	f.client.request(sftpClose, sftpString(f.handle))
+	return f.done()
+}
+
+// openSFTPFile initializes the session and opens a file for reading
+func openSFTPFile(client *sftpClient, path string) (*sftpFile, int64, error) {
+	if err := client.packet(sftpInit, binary.BigEndian.AppendUint32(nil, 3)); err != nil {
+		return nil, 0, err
+	}
+	if kind, _, err := client.reply(); err != nil || kind != sftpVersion {
+		return nil, 0, errors.Join(fmt.Errorf("sftp: handshake failed"), err)
+	}
+
+	size := int64(-1)
+	kind, body, err := client.request(sftpStat, sftpString([]byte(path)))
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind == sftpStatus {
+		return nil, 0, sftpStatusError(body)
+	}
+	if kind == sftpAttrs && len(body) >= 12 && binary.BigEndian.Uint32(body)&sftpAttrSize != 0 {
+		size = int64(binary.BigEndian.Uint64(body[4:]))
+	}
+
+	payload := append(sftpString([]byte(path)), binary.BigEndian.AppendUint32(nil, sftpReadFlag)...)
+	kind, body, err = client.request(sftpOpen, binary.BigEndian.AppendUint32(payload, 0))
+	if err != nil {
+		return nil, 0, err
+	}
+	if kind == sftpStatus {
+		return nil, 0, sftpStatusError(body)
+	}
+	if kind != sftpHandle || len(body) < 4 || int(binary.BigEndian.Uint32(body)) > len(body)-4 {
+		return nil, 0, fmt.Errorf("sftp: unexpected reply to open")
+	}
+	return &sftpFile{client: client, handle: body[4 : 4+binary.BigEndian.Uint32(body)]}, size, nil
+}
+
+// openSFTP downloads a file through the system ssh client's sftp subsystem
+func openSFTP(u *url.URL, creds RemoteCredentials) (io.ReadCloser, int64, error) {
+	user, _ := creds.resolve(u)
+	cmd := sftpCommand(u, user, creds.Identity)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, 0, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, 0, fmt.Errorf("failed to run ssh: %w", err)
+	}
+	done := func() error {
+		stdin.Close()
+		return cmd.Wait()
+	}
+
+	client := &sftpClient{in: stdin, out: bufio.NewReader(stdout)}
+	file, size, err := openSFTPFile(client, strings.TrimPrefix(u.Path, "/~/"))
+	if err != nil {
+		done()
+		return nil, 0, err
+	}
+	file.done = done
+	return file, size, nil
+}
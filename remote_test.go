@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveFTP answers one anonymous or password login and passive-mode RETR of content
+func serveFTP(t *testing.T, content []byte) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "220 ready\r\n")
+		var data net.Listener
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+			switch command {
+			case "USER":
+				fmt.Fprint(conn, "331 password please\r\n")
+			case "PASS":
+				if arg != "secret" {
+					fmt.Fprint(conn, "530 login incorrect\r\n")
+					continue
+				}
+				fmt.Fprint(conn, "230 logged in\r\n")
+			case "TYPE":
+				fmt.Fprint(conn, "200 binary\r\n")
+			case "SIZE":
+				fmt.Fprintf(conn, "213 %d\r\n", len(content))
+			case "EPSV":
+				data, _ = net.Listen("tcp", "127.0.0.1:0")
+				fmt.Fprintf(conn, "229 Entering Extended Passive Mode (|||%d|)\r\n", data.Addr().(*net.TCPAddr).Port)
+			case "RETR":
+				fmt.Fprint(conn, "150 opening\r\n")
+				dataConn, _ := data.Accept()
+				dataConn.Write(content)
+				dataConn.Close()
+				data.Close()
+				fmt.Fprint(conn, "226 done\r\n")
+			case "QUIT":
+				fmt.Fprint(conn, "221 bye\r\n")
+				return
+			}
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestFetchFTPAndWebDAV(t *testing.T) {
+	content := []byte("legacy archive")
+	want := fmt.Sprintf("%x", sha256.Sum256(content))
+
+	addr := serveFTP(t, content)
+	results, source, err := NewHashCalculator().FetchURLDigests("ftp://ops:secret@"+addr+"/pub/archive.tar", RemoteCredentials{}, []HashAlgorithm{SHA256}, nil)
+	if err != nil {
+		t.Fatalf("FTP fetch failed: %v", err)
+	}
+	if results[0].Hash != want || results[0].Filename != "archive.tar" {
+		t.Errorf("Unexpected FTP result: %+v", results[0])
+	}
+	if strings.Contains(source.URL, "secret") {
+		t.Errorf("Password leaked into the recorded URL: %s", source.URL)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "ops" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write(content)
+	}))
+	defer server.Close()
+	davURL := strings.Replace(server.URL, "http://", "webdav://", 1) + "/remote.php/dav/files/archive.tar"
+	creds := RemoteCredentials{User: "ops", Password: "secret"}
+	if results, _, err := NewHashCalculator().FetchURLDigests(davURL, creds, []HashAlgorithm{SHA256}, nil); err != nil || results[0].Hash != want {
+		t.Errorf("WebDAV fetch failed: %v", err)
+	}
+	if _, _, err := NewHashCalculator().FetchURLDigests(davURL, RemoteCredentials{}, []HashAlgorithm{SHA256}, nil); err == nil {
+		t.Error("Expected WebDAV fetch without credentials to fail")
+	}
+}
+
+func TestSFTPClient(t *testing.T) {
+	content := []byte(strings.Repeat("sftp payload ", 5000))
+	toServer, clientIn := io.Pipe()
+	clientOut, fromServer := io.Pipe()
+
+	// Minimal SFTP v3 server for a single file
+	go func() {
+		reader := bufio.NewReader(toServer)
+		send := func(kind byte, payload []byte) {
+			header := binary.BigEndian.AppendUint32(nil, uint32(len(payload)+1))
+			fromServer.Write(append(append(header, kind), payload...))
+		}
+		for {
+			var length uint32
+			if binary.Read(reader, binary.BigEndian, &length) != nil {
+				return
+			}
+			packet := make([]byte, length)
+			io.ReadFull(reader, packet)
+			if packet[0] == sftpInit {
+				send(sftpVersion, binary.BigEndian.AppendUint32(nil, 3))
+				continue
+			}
+			id := packet[1:5]
+			switch packet[0] {
+			case sftpStat:
+				attrs := binary.BigEndian.AppendUint32(append([]byte(nil), id...), sftpAttrSize)
+				send(sftpAttrs, binary.BigEndian.AppendUint64(attrs, uint64(len(content))))
+			case sftpOpen:
+				send(sftpHandle, append(append([]byte(nil), id...), sftpString([]byte("h1"))...))
+			case sftpRead:
+				offset := binary.BigEndian.Uint64(packet[11:])
+				size := binary.BigEndian.Uint32(packet[19:])
+				if offset >= uint64(len(content)) {
+					send(sftpStatus, binary.BigEndian.AppendUint32(append([]byte(nil), id...), sftpStatusEOF))
+					continue
+				}
+				end := min(offset+uint64(size), uint64(len(content)))
+				send(sftpData, append(append([]byte(nil), id...), sftpString(content[offset:end])...))
+			case sftpClose:
+				send(sftpStatus, binary.BigEndian.AppendUint32(append([]byte(nil), id...), 0))
+			}
+		}
+	}()
+
+	client := &sftpClient{in: clientIn, out: bufio.NewReader(clientOut)}
+	file, size, err := openSFTPFile(client, "/srv/data.bin")
+	if err != nil {
+		t.Fatalf("Failed to open SFTP file: %v", err)
+	}
+	file.done = func() error { return clientIn.Close() }
+	results, err := NewHashCalculator().CalculateReaderDigests(file, "data.bin", size, []HashAlgorithm{SHA256}, nil)
+	if err != nil {
+		t.Fatalf("SFTP read failed: %v", err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(content)); results[0].Hash != want || results[0].FileSize != int64(len(content)) {
+		t.Errorf("Unexpected SFTP result: %+v", results[0])
+	}
+	file.Close()
+}
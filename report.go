@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"hashculate/hasher"
+)
+
+// JSONReport is the document written by -output json
+type JSONReport struct {
+	hasher.Report
+	Path   string     `json:"path,omitempty"`
+	Source *URLSource `json:"source,omitempty"`
+	Passes []ReadPass `json:"passes,omitempty"`
+
+	// Sample is set for screening hashes, which do not cover the whole file
+	Sample *SampleInfo `json:"sample,omitempty"`
+
+	// Payload is set for media digests that leave out tags and metadata
+	Payload *PayloadInfo `json:"payload,omitempty"`
+
+	// Pixels is set for -a pixels digests, with the file's own SHA-256
+	Pixels *PixelInfo `json:"pixels,omitempty"`
+
+	// PDF is set for -pdf canonical digests, with the file's own digest
+	PDF *PDFInfo `json:"pdf,omitempty"`
+
+	// OOXML is set for -ooxml content digests, with the file's own digest
+	OOXML *OOXMLInfo `json:"ooxml,omitempty"`
+
+	// Parts lists the pieces of a split file hashed with -concat
+	Parts []ConcatPart `json:"parts,omitempty"`
+
+	// UUID is derived from the digest with -uuid
+	UUID string `json:"uuid,omitempty"`
+
+	// Parameters are the settings the digest was computed with, for -replay
+	Parameters *RunParameters `json:"parameters,omitempty"`
+}
+
+// WriteJSONReport writes a hash result, and the URL it was fetched from if any, as JSON
+func WriteJSONReport(w io.Writer, result *HashResult, source *URLSource) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(jsonReport(result, source))
+}
+
+// jsonReport builds the -output json document of a hash result
+func jsonReport(result *HashResult, source *URLSource) JSONReport {
+	passes := result.Passes
+	if deterministic {
+		// Response headers carry the server's date and cache state
+		if source != nil {
+			stripped := *source
+			stripped.Headers = nil
+			source = &stripped
+		}
+		passes = nil
+		for _, pass := range result.Passes {
+			passes = append(passes, ReadPass{Hash: pass.Hash})
+		}
+	}
+
+	return JSONReport{
+		Report: hasher.Report{
+			File:      result.Filename,
+			Size:      result.FileSize,
+			Algorithm: result.Algorithm,
+			Hash:      result.Hash,
+		},
+		Path:    outputPath(result.Path),
+		Source:  source,
+		Passes:  passes,
+		Sample:  result.Sample,
+		Payload: result.Payload,
+		Pixels:  result.Pixels,
+		PDF:     result.PDF,
+		OOXML:   result.OOXML,
+		Parts:   result.Parts,
+		UUID:    result.UUID,
+
+		Parameters: result.Parameters,
+	}
+}
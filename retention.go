@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetentionPolicy bounds how a long-running hash database grows
+type RetentionPolicy struct {
+	Snapshots     int    `json:"snapshots"`      // Snapshots kept in <db.json>.snapshots; 0 takes none
+	ExpireDeleted string `json:"expire-deleted"` // How long entries of deleted files are kept; empty drops them at once
+	Backups       int    `json:"backups"`        // Copies of the previous database kept as <db.json>.1 …; 0 keeps none
+
+	expire time.Duration
+}
+
+// parse validates the policy
+func (p *RetentionPolicy) parse() error {
+	if p.Snapshots < 0 {
+		return fmt.Errorf("retention: snapshots must not be negative")
+	}
+	if p.Backups < 0 {
+		return fmt.Errorf("retention: backups must not be negative")
+	}
+	if p.ExpireDeleted == "" {
+		return nil
+	}
+	expire, err := parseRetentionAge(p.ExpireDeleted)
+	if err != nil {
+		return fmt.Errorf("retention: %w", err)
+	}
+	p.expire = expire
+	return nil
+}
+
+// parseRetentionAge parses a Go duration, or a number of days such as "30d"
+func parseRetentionAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	age, err := time.ParseDuration(s)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q (e.g. 30d or 12h)", s)
+	}
+	return age, nil
+}
+
+// Deleted returns the retired entries ordered by path
+func (db *HashDB) Deleted() []DBEntry {
+	entries := make([]DBEntry, 0, len(db.deleted))
+	for _, entry := range db.deleted {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries
+}
+
+// Retire moves the entry for path to the deleted entries, keeping its last
+// known hashes until it expires
+func (db *HashDB) Retire(path string, when time.Time) {
+	key := dbKey(path)
+	entry, ok := db.entries[key]
+	if !ok {
+		return
+	}
+	delete(db.entries, key)
+	entry.Deleted = when.UTC()
+	db.deleted[key] = entry
+}
+
+// Expire drops deleted entries retired before cutoff and returns how many
+func (db *HashDB) Expire(cutoff time.Time) int {
+	expired := 0
+	for key, entry := range db.deleted {
+		if !entry.Deleted.After(cutoff) {
+			delete(db.deleted, key)
+			expired++
+		}
+	}
+	return expired
+}
+
+// RetireMissing retires the entries whose files no longer exist and returns how many
+func (db *HashDB) RetireMissing(now time.Time) int {
+	retired := 0
+	for _, entry := range db.Entries() {
+		if _, err := os.Lstat(entry.Path); os.IsNotExist(err) {
+			db.Retire(entry.Path, now)
+			retired++
+		}
+	}
+	return retired
+}
+
+// snapshotDir is where the snapshots of a database are kept
+func snapshotDir(dbPath string) string {
+	return dbPath + ".snapshots"
+}
+
+// snapshotHashDB copies the saved database into its snapshot directory
+func snapshotHashDB(dbPath string, now time.Time) (string, error) {
+	dir := snapshotDir(dbPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create snapshot directory: %w", err)
+	}
+	source, err := os.Open(dbPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot hash database: %w", err)
+	}
+	defer source.Close()
+	// Names sort by time, so the oldest snapshots are pruned first
+	path := filepath.Join(dir, now.UTC().Format("20060102T150405.000000Z")+".json")
+	target, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot hash database: %w", err)
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to snapshot hash database: %w", err)
+	}
+	return path, target.Close()
+}
+
+// listSnapshots returns the snapshots of a database, oldest first
+func listSnapshots(dbPath string) ([]string, error) {
+	entries, err := os.ReadDir(snapshotDir(dbPath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshots []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") {
+			snapshots = append(snapshots, filepath.Join(snapshotDir(dbPath), entry.Name()))
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// pruneSnapshots removes all but the newest keep snapshots, returning the
+// ones removed (or that would be, with dryRun)
+func pruneSnapshots(dbPath string, keep int, dryRun bool) ([]string, error) {
+	snapshots, err := listSnapshots(dbPath)
+	if err != nil || len(snapshots) <= keep {
+		return nil, err
+	}
+	old := snapshots[:len(snapshots)-keep]
+	if !dryRun {
+		for _, path := range old {
+			if err := os.Remove(path); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return old, nil
+}
+
+// keepSnapshot snapshots the saved database and prunes all but the newest keep snapshots
+func keepSnapshot(dbPath string, keep int, now time.Time) error {
+	if _, err := snapshotHashDB(dbPath, now); err != nil {
+		return err
+	}
+	_, err := pruneSnapshots(dbPath, keep, false)
+	return err
+}
+
+// fileSize returns the size of a file, or 0 when it cannot be read
+func fileSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHashDBRetention(t *testing.T) {
+	dir := t.TempDir()
+	kept := filepath.Join(dir, "kept")
+	os.WriteFile(kept, []byte("kept"), 0644)
+	dbPath := filepath.Join(dir, "hashes.json")
+	db, _ := OpenHashDB(dbPath)
+	now := time.Now()
+	db.Put(DBEntry{Path: kept, Hashes: map[HashAlgorithm]string{SHA256: "aa"}})
+	db.Put(DBEntry{Path: filepath.Join(dir, "gone"), Hashes: map[HashAlgorithm]string{SHA256: "bb"}})
+	db.Put(DBEntry{Path: filepath.Join(dir, "old"), Hashes: map[HashAlgorithm]string{SHA256: "cc"}})
+	db.Retire(filepath.Join(dir, "old"), now.Add(-40*24*time.Hour))
+
+	if retired := db.RetireMissing(now); retired != 1 {
+		t.Errorf("Retired %d entries, want 1", retired)
+	}
+	if expired := db.Expire(now.Add(-30 * 24 * time.Hour)); expired != 1 {
+		t.Errorf("Expired %d entries, want 1", expired)
+	}
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	db, _ = OpenHashDB(dbPath)
+	if entries := db.Entries(); len(entries) != 1 || entries[0].Path != dbKey(kept) {
+		t.Errorf("Entries = %v, want only %s", entries, kept)
+	}
+	deleted := db.Deleted()
+	if len(deleted) != 1 || filepath.Base(deleted[0].Path) != "gone" || deleted[0].Hashes[SHA256] != "bb" || deleted[0].Deleted.IsZero() {
+		t.Errorf("Deleted = %v, want gone with its last hash", deleted)
+	}
+
+	// A file that comes back is live again
+	db.Put(DBEntry{Path: filepath.Join(dir, "gone"), Hashes: map[HashAlgorithm]string{SHA256: "dd"}})
+	if len(db.Deleted()) != 0 || len(db.Entries()) != 2 {
+		t.Errorf("Re-added file is still retired")
+	}
+
+	for _, age := range []string{"30d", "12h", "0"} {
+		if _, err := parseRetentionAge(age); err != nil {
+			t.Errorf("parseRetentionAge(%q): %v", age, err)
+		}
+	}
+	if _, err := parseRetentionAge("-1d"); err == nil {
+		t.Error("Expected a negative age to be rejected")
+	}
+}
+
+func TestFIMRetention(t *testing.T) {
+	dir := t.TempDir()
+	watched := filepath.Join(dir, "etc")
+	os.MkdirAll(watched, 0755)
+	os.WriteFile(filepath.Join(watched, "hosts"), []byte("127.0.0.1 localhost"), 0644)
+	dbPath := filepath.Join(watched, "fim.json")
+
+	configPath := filepath.Join(dir, "fim.yaml")
+	os.WriteFile(configPath, []byte("database: "+dbPath+"\npaths: ["+watched+"]\nretention:\n  snapshots: 2\n  expire-deleted: 30d\n"), 0644)
+	config, err := LoadFIMConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	monitor, _ := NewFIMMonitor(config)
+	for i := 0; i < 3; i++ {
+		os.WriteFile(filepath.Join(watched, "passwd"), []byte{byte(i)}, 0644)
+		os.Chtimes(filepath.Join(watched, "passwd"), time.Now().Add(time.Duration(i)*time.Minute), time.Now().Add(time.Duration(i)*time.Minute))
+		if _, err := monitor.Scan(); err != nil {
+			t.Fatalf("Scan failed: %v", err)
+		}
+	}
+	os.Remove(filepath.Join(watched, "hosts"))
+	changes, err := monitor.Scan()
+	if err != nil || len(changes) != 1 || changes[0].Kind != "removed" {
+		t.Fatalf("Changes = %v (%v), want hosts removed", changes, err)
+	}
+	// Snapshots inside the monitored paths are not deviations
+	if changes, _ := monitor.Scan(); len(changes) != 0 {
+		t.Errorf("Expected no repeated deviations, got %v", changes)
+	}
+
+	snapshots, _ := listSnapshots(dbPath)
+	if len(snapshots) != 2 {
+		t.Errorf("Kept %d snapshots, want 2", len(snapshots))
+	}
+	if deleted := monitor.DB.Deleted(); len(deleted) != 1 || filepath.Base(deleted[0].Path) != "hosts" {
+		t.Errorf("Deleted = %v, want hosts", deleted)
+	}
+
+	config.Retention.ExpireDeleted = "-1h"
+	if err := config.Retention.parse(); err == nil {
+		t.Error("Expected a negative expiry to be rejected")
+	}
+}
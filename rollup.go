@@ -0,0 +1,473 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"hashculate/hasher"
+)
+
+// rootDir is the manifest path of the directory the manifest was made of
+const rootDir = "."
+
+// ManifestFile is a file recorded in a rollup manifest
+type ManifestFile struct {
+	Path     string    `json:"path"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified,omitzero"`
+	Hash     string    `json:"hash"`
+}
+
+// RollupManifest lists every file below a directory with its digest, and a
+// rollup digest per directory computed over its entries' names and digests.
+// An unchanged rollup digest proves the whole subtree is unchanged.
+type RollupManifest struct {
+	Version     int               `json:"version"`
+	Algorithm   HashAlgorithm     `json:"algorithm"`
+	Root        string            `json:"root"`
+	Created     time.Time         `json:"created,omitzero"`
+	Parameters  *RunParameters    `json:"parameters,omitempty"`
+	Directories map[string]string `json:"directories"`
+	Files       []ManifestFile    `json:"files"`
+}
+
+// rollupEntry is one line of a directory listing that a rollup digest covers
+type rollupEntry struct {
+	Dir  bool
+	Hash string
+	Name string
+}
+
+// rollupDigest hashes a directory listing. Each entry is written as
+// "<d|f> <hex digest> <name>\n" in name order, as in a git tree object.
+func rollupDigest(algorithm HashAlgorithm, entries []rollupEntry) (string, error) {
+	h, err := hasher.New(algorithm)
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, entry := range entries {
+		kind := "f"
+		if entry.Dir {
+			kind = "d"
+		}
+		fmt.Fprintf(h, "%s %s %s\n", kind, entry.Hash, entry.Name)
+	}
+	return hasher.Format(algorithm, h.Sum(nil)), nil
+}
+
+// rollupDirectories computes the rollup digest of every directory that
+// contains files, bottom-up, and returns them with the listing of each
+func rollupDirectories(algorithm HashAlgorithm, files []ManifestFile) (map[string]string, map[string][]rollupEntry, error) {
+	listings := map[string][]rollupEntry{rootDir: nil}
+	known := map[string]bool{rootDir: true}
+	for _, file := range files {
+		listings[path.Dir(file.Path)] = append(listings[path.Dir(file.Path)], rollupEntry{Hash: file.Hash, Name: path.Base(file.Path)})
+		for dir := path.Dir(file.Path); !known[dir]; dir = path.Dir(dir) {
+			known[dir] = true
+			listings[path.Dir(dir)] = append(listings[path.Dir(dir)], rollupEntry{Dir: true, Name: path.Base(dir)})
+		}
+	}
+
+	// Deeper directories first, so subdirectory digests are known when their parent is hashed
+	dirs := make([]string, 0, len(listings))
+	for dir := range listings {
+		dirs = append(dirs, dir)
+	}
+	depth := func(dir string) int {
+		if dir == rootDir {
+			return 0
+		}
+		return strings.Count(dir, "/") + 1
+	}
+	sort.Slice(dirs, func(i, j int) bool { return depth(dirs[i]) > depth(dirs[j]) })
+
+	digests := map[string]string{}
+	for _, dir := range dirs {
+		listing := listings[dir]
+		for i := range listing {
+			if listing[i].Dir {
+				listing[i].Hash = digests[path.Join(dir, listing[i].Name)]
+			}
+		}
+		digest, err := rollupDigest(algorithm, listing)
+		if err != nil {
+			return nil, nil, err
+		}
+		digests[dir] = digest
+	}
+	return digests, listings, nil
+}
+
+// BuildRollupManifest hashes every file below root
+func BuildRollupManifest(root string, algorithm HashAlgorithm, calculator *HashCalculator) (*RollupManifest, error) {
+	paths, err := calculator.listFiles(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	manifest := &RollupManifest{Version: 1, Algorithm: algorithm, Created: outputTime(time.Now().UTC()), Files: []ManifestFile{},
+		Parameters: newRunParameters([]HashAlgorithm{algorithm}, calculator.ChunkSize, false)}
+	for _, p := range paths {
+		file, err := hashManifestFile(root, p, algorithm, calculator)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, file)
+	}
+	manifest.Directories, _, err = rollupDirectories(algorithm, manifest.Files)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Root = manifest.Directories[rootDir]
+	return manifest, nil
+}
+
+// hashManifestFile records one file below root
+func hashManifestFile(root, p string, algorithm HashAlgorithm, calculator *HashCalculator) (ManifestFile, error) {
+	info, err := fs.Stat(calculator.fs(), p)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	result, err := calculator.CalculateFileHash(p, algorithm, nil)
+	if err != nil {
+		return ManifestFile{}, fmt.Errorf("%s: %w", p, err)
+	}
+	return ManifestFile{Path: relativeSlashPath(root, p), Size: result.FileSize, Modified: outputTime(info.ModTime().UTC()), Hash: result.Hash}, nil
+}
+
+// LoadRollupManifest reads a manifest written by `manifest create`
+func LoadRollupManifest(p string) (*RollupManifest, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	var manifest RollupManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", p, err)
+	}
+	if manifest.Version != 1 || manifest.Directories == nil {
+		return nil, fmt.Errorf("%s is not a rollup manifest", p)
+	}
+	return &manifest, nil
+}
+
+// ManifestVerification is the outcome of checking a directory against a rollup manifest
+type ManifestVerification struct {
+	RootMatches bool
+	Changed     []string
+	Missing     []string
+	New         []string
+	Moved       []FileMove // missing files found again at a new path
+	Unchanged   []string   // directories skipped because their rollup digest matched
+	FilesRead   int
+	FilesCached int
+}
+
+// VerifyRollupManifest checks root against a manifest. With useCache, files
+// whose size and modification time match the manifest are not read again, so
+// an unchanged subtree costs only directory listings and stat calls. The
+// comparison then starts at the root and only descends into directories whose
+// rollup digest differs.
+func VerifyRollupManifest(manifest *RollupManifest, root string, calculator *HashCalculator, useCache bool) (*ManifestVerification, error) {
+	recorded := map[string]ManifestFile{}
+	for _, file := range manifest.Files {
+		recorded[file.Path] = file
+	}
+	paths, err := calculator.listFiles(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	result := &ManifestVerification{}
+	var current []ManifestFile
+	for _, p := range paths {
+		rel := relativeSlashPath(root, p)
+		if old, ok := recorded[rel]; ok && useCache {
+			if info, err := fs.Stat(calculator.fs(), p); err == nil && info.Size() == old.Size && info.ModTime().Equal(old.Modified) {
+				current = append(current, old)
+				result.FilesCached++
+				continue
+			}
+		}
+		file, err := hashManifestFile(root, p, manifest.Algorithm, calculator)
+		if err != nil {
+			return nil, err
+		}
+		current = append(current, file)
+		result.FilesRead++
+	}
+	digests, listings, err := rollupDirectories(manifest.Algorithm, current)
+	if err != nil {
+		return nil, err
+	}
+	result.RootMatches = digests[rootDir] == manifest.Root
+
+	// Index the manifest's own listings to find what disappeared
+	_, recordedListings, err := rollupDirectories(manifest.Algorithm, manifest.Files)
+	if err != nil {
+		return nil, err
+	}
+	currentHashes := map[string]string{}
+	for _, file := range current {
+		currentHashes[file.Path] = file.Hash
+	}
+
+	var compare func(dir string)
+	compare = func(dir string) {
+		if digests[dir] == manifest.Directories[dir] {
+			result.Unchanged = append(result.Unchanged, dir)
+			return
+		}
+		seen := map[string]bool{}
+		for _, entry := range listings[dir] {
+			p := path.Join(dir, entry.Name)
+			seen[entry.Name] = true
+			switch {
+			case entry.Dir:
+				compare(p)
+			case recorded[p].Hash == "":
+				result.New = append(result.New, p)
+			case recorded[p].Hash != currentHashes[p]:
+				result.Changed = append(result.Changed, p)
+			}
+		}
+		for _, entry := range recordedListings[dir] {
+			if seen[entry.Name] {
+				continue
+			}
+			p := path.Join(dir, entry.Name)
+			if !entry.Dir {
+				result.Missing = append(result.Missing, p)
+				continue
+			}
+			for _, file := range manifest.Files {
+				if strings.HasPrefix(file.Path, p+"/") {
+					result.Missing = append(result.Missing, file.Path)
+				}
+			}
+		}
+	}
+	compare(rootDir)
+
+	// A new file with the digest of a missing one is that file, moved
+	missing, added := map[string]string{}, map[string]string{}
+	for _, p := range result.Missing {
+		missing[p] = recorded[p].Hash
+	}
+	for _, p := range result.New {
+		added[p] = currentHashes[p]
+	}
+	result.Moved = matchMoves(missing, added)
+	for _, move := range result.Moved {
+		delete(missing, move.From)
+		delete(added, move.To)
+	}
+	result.Missing, result.New = nil, nil
+	for p := range missing {
+		result.Missing = append(result.Missing, p)
+	}
+	for p := range added {
+		result.New = append(result.New, p)
+	}
+	sort.Strings(result.Changed)
+	sort.Strings(result.Missing)
+	sort.Strings(result.New)
+	return result, nil
+}
+
+// runManifest implements the manifest command
+func runManifest(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate manifest create <dir> [-a sha256] [-o manifest.json [-backups <n>]]")
+		fmt.Println("       hashculate manifest verify <manifest.json> [-root <dir>] [-cache]")
+		fmt.Println("       hashculate manifest mv <manifest.json> <old> <new> [-backups <n>]")
+		fmt.Println("       hashculate manifest prove <manifest.json> <path> [-o proof.json]")
+		fmt.Println("       hashculate manifest check-proof <proof.json> -root <digest> [-file <path>]")
+		return 1
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("manifest create", flag.ExitOnError)
+		algorithm := fs.String("a", "sha256", "Hash algorithm")
+		output := fs.String("o", "", "Write the manifest to this file instead of stdout")
+		backups := fs.Int("backups", 0, "Keep this many copies of a manifest -o replaces as <manifest>.1 …")
+		fs.BoolVar(&deterministic, "deterministic", false, "Leave out creation and modification times")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 1 {
+			return usage()
+		}
+		alg, err := parseAlgorithm(*algorithm)
+		if err != nil || alg == CIDV1 {
+			fmt.Printf("Error: manifests need a hex digest algorithm (md5, sha1, sha256, sha512)\n")
+			return 1
+		}
+		manifest, err := BuildRollupManifest(positional[0], alg, NewHashCalculator())
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		data, _ := json.MarshalIndent(manifest, "", "  ")
+		data = append(data, '\n')
+		if *output == "" {
+			os.Stdout.Write(data)
+			return 0
+		}
+		if toStdout, err := writeOutputFile(*output, data, *backups); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		} else if toStdout {
+			return 0
+		}
+		fmt.Printf("%d files, root %s\n", len(manifest.Files), manifest.Root)
+		return 0
+
+	case "verify":
+		fs := flag.NewFlagSet("manifest verify", flag.ExitOnError)
+		root := fs.String("root", ".", "Directory the manifest was created from")
+		useCache := fs.Bool("cache", false, "Trust files whose size and modification time are unchanged")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 1 {
+			return usage()
+		}
+		manifest, err := LoadRollupManifest(positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if manifest.Parameters != nil {
+			noteParameters(os.Stdout, manifest.Parameters, map[string]bool{})
+		}
+		check, err := VerifyRollupManifest(manifest, *root, NewHashCalculator(), *useCache)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		for _, p := range check.Changed {
+			fmt.Printf("%s: CHANGED\n", p)
+		}
+		for _, p := range check.Missing {
+			fmt.Printf("%s: MISSING\n", p)
+		}
+		for _, p := range check.New {
+			fmt.Printf("%s: NEW\n", p)
+		}
+		var recorded []string
+		for _, file := range manifest.Files {
+			recorded = append(recorded, file.Path)
+		}
+		for _, move := range collapseMoves(check.Moved, recorded) {
+			fmt.Println(move)
+		}
+		if check.RootMatches {
+			fmt.Printf("Root %s matches\n", manifest.Root)
+		} else {
+			fmt.Printf("Root differs from %s\n", manifest.Root)
+		}
+		fmt.Printf("%d changed, %d missing, %d new, %d moved; %d unchanged subtree(s) skipped; %d file(s) read, %d trusted from cache\n",
+			len(check.Changed), len(check.Missing), len(check.New), len(check.Moved), len(check.Unchanged), check.FilesRead, check.FilesCached)
+		if len(check.Changed) > 0 || len(check.Missing) > 0 {
+			return 1
+		}
+		return 0
+
+	case "mv":
+		fs := flag.NewFlagSet("manifest mv", flag.ExitOnError)
+		backups := fs.Int("backups", 0, "Keep this many copies of the manifest as it was as <manifest>.1 …")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 3 {
+			return usage()
+		}
+		manifest, err := LoadRollupManifest(positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		renamed, err := manifest.Rename(positional[1], positional[2])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		data, _ := json.MarshalIndent(manifest, "", "  ")
+		data = append(data, '\n')
+		if err := writeFileAtomic(positional[0], data, 0644, *backups); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("%d file(s) renamed, root %s\n", renamed, manifest.Root)
+		return 0
+
+	case "prove":
+		fs := flag.NewFlagSet("manifest prove", flag.ExitOnError)
+		output := fs.String("o", "", "Write the proof to this file instead of stdout")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 2 {
+			return usage()
+		}
+		manifest, err := LoadRollupManifest(positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		proof, err := manifest.Prove(positional[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		data, _ := json.MarshalIndent(proof, "", "  ")
+		data = append(data, '\n')
+		if *output == "" {
+			os.Stdout.Write(data)
+			return 0
+		}
+		if toStdout, err := writeOutputFile(*output, data, 0); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		} else if toStdout {
+			return 0
+		}
+		fmt.Printf("Proof for %s, %d level(s), root %s\n", proof.Path, len(proof.Levels), proof.Root)
+		return 0
+
+	case "check-proof":
+		fs := flag.NewFlagSet("manifest check-proof", flag.ExitOnError)
+		root := fs.String("root", "", "Trusted root digest, e.g. from a signed release announcement")
+		file := fs.String("file", "", "Hash this file and check it is the one the proof covers")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 1 || *root == "" {
+			return usage()
+		}
+		proof, err := LoadMembershipProof(positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if *file != "" {
+			result, err := NewHashCalculator().CalculateFileHash(*file, proof.Algorithm, nil)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			if result.Hash != proof.Hash {
+				fmt.Printf("%s: FAILED %s is %s, the proof covers %s\n", *file, getAlgorithmName(proof.Algorithm), result.Hash, proof.Hash)
+				return 1
+			}
+		}
+		if err := proof.Check(strings.ToLower(*root)); err != nil {
+			fmt.Printf("%s: FAILED %v\n", proof.Path, err)
+			return 1
+		}
+		fmt.Printf("%s: OK, member of root %s\n", proof.Path, proof.Root)
+		return 0
+	}
+	return usage()
+}
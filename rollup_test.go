@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRollupManifest(t *testing.T) {
+	root := t.TempDir()
+	for name, content := range map[string]string{"README": "readme", "bin/app": "app", "lib/a/x.so": "x", "lib/b/y.so": "y"} {
+		os.MkdirAll(filepath.Join(root, filepath.Dir(name)), 0755)
+		os.WriteFile(filepath.Join(root, name), []byte(content), 0644)
+	}
+	manifest, err := BuildRollupManifest(root, SHA256, NewHashCalculator())
+	if err != nil {
+		t.Fatal(err)
+	}
+	listing := fmt.Sprintf("f %x app\n", sha256.Sum256([]byte("app")))
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte(listing))); manifest.Directories["bin"] != want {
+		t.Errorf("bin rollup: expected %s, got %s", want, manifest.Directories["bin"])
+	}
+	if len(manifest.Directories) != 5 || manifest.Root != manifest.Directories["."] {
+		t.Fatalf("unexpected directories: %v", manifest.Directories)
+	}
+
+	check, err := VerifyRollupManifest(manifest, root, NewHashCalculator(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.RootMatches || check.FilesRead != 0 || check.FilesCached != 4 || len(check.Unchanged) != 1 {
+		t.Errorf("unchanged tree: %+v", check)
+	}
+
+	os.WriteFile(filepath.Join(root, "lib", "a", "x.so"), []byte("tampered"), 0644)
+	os.RemoveAll(filepath.Join(root, "bin"))
+	os.WriteFile(filepath.Join(root, "NEW"), []byte("new"), 0644)
+	check, err = VerifyRollupManifest(manifest, root, NewHashCalculator(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.RootMatches || fmt.Sprint(check.Changed) != "[lib/a/x.so]" || fmt.Sprint(check.Missing) != "[bin/app]" || fmt.Sprint(check.New) != "[NEW]" {
+		t.Errorf("changed tree: %+v", check)
+	}
+	if fmt.Sprint(check.Unchanged) != "[lib/b]" || check.FilesRead != 2 {
+		t.Errorf("expected only lib/b to be skipped and two files read: %+v", check)
+	}
+}
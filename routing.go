@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// RoutingRule picks the algorithms for files whose name matches Pattern
+type RoutingRule struct {
+	Pattern    string   `json:"pattern"`
+	Algorithms []string `json:"algorithms"`
+
+	algorithms []HashAlgorithm
+}
+
+// RoutingRules map file patterns to algorithms, so one scan can hash each
+// class of file with the right trade-off. The first matching rule applies.
+type RoutingRules struct {
+	Rules []RoutingRule `json:"rules"`
+}
+
+// LoadRoutingRules reads routing rules from a YAML file such as
+//
+//	rules:
+//	  - pattern: "*.iso"
+//	    algorithms: [sha256]
+//	  - pattern: "*"
+//	    algorithms: [md5]
+func LoadRoutingRules(file string) (*RoutingRules, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %w", err)
+	}
+	rules := &RoutingRules{}
+	if err := decodeYAML(data, rules); err != nil {
+		return nil, fmt.Errorf("invalid rules %s: %w", file, err)
+	}
+	if len(rules.Rules) == 0 {
+		return nil, fmt.Errorf("rules %s: no rules", file)
+	}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if _, err := path.Match(rule.Pattern, ""); err != nil || rule.Pattern == "" {
+			return nil, fmt.Errorf("rules %s: invalid pattern %q", file, rule.Pattern)
+		}
+		if len(rule.Algorithms) == 0 {
+			return nil, fmt.Errorf("rules %s: pattern %q has no algorithms", file, rule.Pattern)
+		}
+		for _, name := range rule.Algorithms {
+			alg, err := parseAlgorithm(name)
+			if err != nil {
+				return nil, fmt.Errorf("rules %s: pattern %q: %w", file, rule.Pattern, err)
+			}
+			rule.algorithms = append(rule.algorithms, alg)
+		}
+	}
+	return rules, nil
+}
+
+// Route returns the first rule matching a slash-separated path relative to
+// the scanned root. Patterns with a slash match the whole path, others the
+// base name; nil means no rule applies.
+func (r *RoutingRules) Route(rel string) *RoutingRule {
+	for i := range r.Rules {
+		rule := &r.Rules[i]
+		name := path.Base(rel)
+		if strings.Contains(rule.Pattern, "/") {
+			name = rel
+		}
+		if matched, _ := path.Match(rule.Pattern, name); matched {
+			return rule
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRoutingRules(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "rules.yaml")
+	os.WriteFile(file, []byte(`rules:
+  - pattern: "*.iso"
+    algorithms: [sha256]
+  - pattern: photos/*.jpg
+    algorithms: [md5, sha1]
+  - pattern: "*"
+    algorithms: [sha512]
+`), 0644)
+	rules, err := LoadRoutingRules(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rel, want := range map[string]string{
+		"dist/debian.iso":     "*.iso",
+		"photos/a.jpg":        "photos/*.jpg",
+		"photos/2024/b.jpg":   "*",
+		"notes.txt":           "*",
+		"photos/cd-image.iso": "*.iso",
+	} {
+		if rule := rules.Route(rel); rule == nil || rule.Pattern != want {
+			t.Errorf("%s: expected rule %q, got %+v", rel, want, rule)
+		}
+	}
+	if got := rules.Route("photos/a.jpg").algorithms; len(got) != 2 || got[0] != MD5 || got[1] != SHA1 {
+		t.Errorf("unexpected algorithms: %v", got)
+	}
+
+	os.WriteFile(file, []byte("rules:\n  - pattern: \"*.iso\"\n    algorithms: [xxh3]\n"), 0644)
+	if _, err := LoadRoutingRules(file); err == nil {
+		t.Error("expected an error for an unsupported algorithm")
+	}
+}
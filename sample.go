@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"hashculate/hasher"
+)
+
+// sampleDomain starts the hashed data of a screening hash, so it can never
+// equal the full digest of any file
+const sampleDomain = "hashculate sample v1"
+
+// SampleInfo describes what a screening hash covers
+type SampleInfo struct {
+	Window   int64 `json:"window"`   // Bytes read at the start, middle and end
+	Covered  int64 `json:"covered"`  // Bytes actually hashed
+	Complete bool  `json:"complete"` // The file was small enough to be read whole
+}
+
+// sampleRanges returns the start, middle and end windows of a file, or the
+// whole file when the windows would overlap
+func sampleRanges(size, window int64) []ByteRange {
+	if size <= 3*window {
+		return []ByteRange{{Start: 0, End: size}}
+	}
+	middle := size/2 - window/2
+	return []ByteRange{{Start: 0, End: window}, {Start: middle, End: middle + window}, {Start: size - window, End: size}}
+}
+
+// SampleFile computes a screening hash over the size of a file and window
+// bytes at its start, middle and end. It tells different files apart quickly,
+// but two files with the same screening hash may still differ elsewhere.
+func (hc *HashCalculator) SampleFile(filePath string, algorithm HashAlgorithm, window int64) (*HashResult, error) {
+	file, err := hc.openInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	stream, err := hasher.NewStream([]HashAlgorithm{algorithm}, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(stream, "%s window=%d size=%d\n", sampleDomain, window, info.Size())
+	sample := &SampleInfo{Window: window}
+	ranges := sampleRanges(info.Size(), window)
+	for _, r := range ranges {
+		n, err := io.Copy(stream, io.NewSectionReader(file, r.Start, r.End-r.Start))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if n != r.End-r.Start {
+			return nil, fmt.Errorf("%s changed size while it was sampled", filePath)
+		}
+		sample.Covered += n
+	}
+	sample.Complete = len(ranges) == 1
+
+	name := hc.Paths.name(filePath, info.Name())
+	hash := stream.Digests()[0].Hash
+	covers := fmt.Sprintf("%s at its start, middle and end; this is not proof that two files are identical", formatBytes(window))
+	if sample.Complete {
+		covers = "its full contents"
+	}
+	return &HashResult{
+		Algorithm: algorithm,
+		Hash:      hash,
+		Filename:  name,
+		Path:      filePath,
+		Basename:  info.Name(),
+		FileSize:  info.Size(),
+		ChunkSize: hc.ChunkSize,
+		Description: fmt.Sprintf("\"%s\", with size of %s, has the %s screening hash %s over its size and %s.",
+			name, formatBytes(info.Size()), getAlgorithmName(algorithm), hash, covers),
+		Sample: sample,
+	}, nil
+}
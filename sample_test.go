@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSampleFile(t *testing.T) {
+	dir := t.TempDir()
+	original := make([]byte, 10<<20)
+	for i := range original {
+		original[i] = byte(i % 251)
+	}
+	os.WriteFile(filepath.Join(dir, "a.mkv"), original, 0644)
+
+	sample := func(name string) *HashResult {
+		result, err := NewHashCalculator().SampleFile(filepath.Join(dir, name), SHA256, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	result := sample("a.mkv")
+	if result.Sample.Covered != 3<<20 || result.Sample.Complete {
+		t.Errorf("unexpected coverage: %+v", result.Sample)
+	}
+	if full := fmt.Sprintf("%x", sha256.Sum256(original)); result.Hash == full {
+		t.Error("screening hash equals the full digest")
+	}
+
+	// Changes inside a sampled window are noticed, changes between windows are not
+	middle := append([]byte{}, original...)
+	middle[5<<20] ^= 1
+	os.WriteFile(filepath.Join(dir, "b.mkv"), middle, 0644)
+	unsampled := append([]byte{}, original...)
+	unsampled[2<<20] ^= 1
+	os.WriteFile(filepath.Join(dir, "c.mkv"), unsampled, 0644)
+	if sample("b.mkv").Hash == result.Hash {
+		t.Error("change in the middle window not detected")
+	}
+	if sample("c.mkv").Hash != result.Hash {
+		t.Error("expected a change outside the windows to go unnoticed")
+	}
+
+	os.WriteFile(filepath.Join(dir, "small.txt"), []byte("small"), 0644)
+	if small := sample("small.txt"); !small.Sample.Complete || small.Sample.Covered != 5 {
+		t.Errorf("small file not read whole: %+v", small.Sample)
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SBOMCheckResult is the outcome of verifying one SBOM entry against disk
+type SBOMCheckResult struct {
+	Path      string
+	Algorithm HashAlgorithm
+	Expected  string
+	Actual    string
+	Status    string // OK, FAILED, MISSING or UNSUPPORTED
+	Err       error
+}
+
+// algorithmStrength orders algorithms from strongest to weakest
+var algorithmStrength = []HashAlgorithm{SHA512, SHA256, SHA1, MD5}
+
+// sbomAlgorithm maps SPDX and CycloneDX algorithm names to supported algorithms
+func sbomAlgorithm(name string) (HashAlgorithm, bool) {
+	alg, err := parseAlgorithm(strings.ReplaceAll(name, "_", "-"))
+	return alg, err == nil
+}
+
+type spdxDocument struct {
+	SPDXVersion string `json:"spdxVersion"`
+	Files       []struct {
+		FileName  string `json:"fileName"`
+		Checksums []struct {
+			Algorithm     string `json:"algorithm"`
+			ChecksumValue string `json:"checksumValue"`
+		} `json:"checksums"`
+	} `json:"files"`
+}
+
+type cyclonedxComponent struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Hashes []struct {
+		Alg     string `json:"alg"`
+		Content string `json:"content"`
+	} `json:"hashes"`
+	Components []cyclonedxComponent `json:"components"`
+}
+
+type cyclonedxDocument struct {
+	BOMFormat  string               `json:"bomFormat"`
+	Components []cyclonedxComponent `json:"components"`
+}
+
+// ParseSBOM reads the file checksums from an SPDX or CycloneDX JSON document
+func ParseSBOM(data []byte) ([]ManifestEntry, error) {
+	var probe struct {
+		SPDXVersion string `json:"spdxVersion"`
+		BOMFormat   string `json:"bomFormat"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("invalid SBOM JSON: %w", err)
+	}
+
+	var entries []ManifestEntry
+	switch {
+	case probe.SPDXVersion != "":
+		var doc spdxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid SPDX document: %w", err)
+		}
+		for _, file := range doc.Files {
+			entry := ManifestEntry{Path: file.FileName, Checksums: map[HashAlgorithm]string{}}
+			for _, checksum := range file.Checksums {
+				if alg, ok := sbomAlgorithm(checksum.Algorithm); ok {
+					entry.Checksums[alg] = strings.ToLower(checksum.ChecksumValue)
+				}
+			}
+			entries = append(entries, entry)
+		}
+	case probe.BOMFormat == "CycloneDX":
+		var doc cyclonedxDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid CycloneDX document: %w", err)
+		}
+		var walk func(components []cyclonedxComponent)
+		walk = func(components []cyclonedxComponent) {
+			for _, component := range components {
+				if component.Type == "file" && len(component.Hashes) > 0 {
+					entry := ManifestEntry{Path: component.Name, Checksums: map[HashAlgorithm]string{}}
+					for _, h := range component.Hashes {
+						if alg, ok := sbomAlgorithm(h.Alg); ok {
+							entry.Checksums[alg] = strings.ToLower(h.Content)
+						}
+					}
+					entries = append(entries, entry)
+				}
+				walk(component.Components)
+			}
+		}
+		walk(doc.Components)
+	default:
+		return nil, fmt.Errorf("unrecognized SBOM: expected SPDX or CycloneDX JSON")
+	}
+	return entries, nil
+}
+
+// VerifySBOM hashes every file listed in the SBOM below root with the strongest listed algorithm
+func VerifySBOM(entries []ManifestEntry, root string, calculator *HashCalculator) []SBOMCheckResult {
+	var results []SBOMCheckResult
+	for _, entry := range entries {
+		check := SBOMCheckResult{Path: entry.Path, Status: "UNSUPPORTED"}
+		for _, alg := range algorithmStrength {
+			if expected, ok := entry.Checksums[alg]; ok {
+				check.Algorithm, check.Expected = alg, expected
+				break
+			}
+		}
+		if check.Algorithm == "" {
+			results = append(results, check)
+			continue
+		}
+
+		path := filepath.FromSlash(entry.Path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(entry.Path, "./")))
+		}
+		result, err := calculator.CalculateFileHash(path, check.Algorithm, nil)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			check.Status = "MISSING"
+		case err != nil:
+			check.Status, check.Err = "FAILED", err
+		case result.Hash != check.Expected:
+			check.Status, check.Actual = "FAILED", result.Hash
+		default:
+			check.Status, check.Actual = "OK", result.Hash
+		}
+		results = append(results, check)
+	}
+	return results
+}
+
+// runSBOM implements the sbom command
+func runSBOM(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Println("Usage: hashculate sbom verify <sbom.spdx.json|cyclonedx.json> [-root <dir>]")
+		return 1
+	}
+	fs := flag.NewFlagSet("sbom verify", flag.ExitOnError)
+	root := fs.String("root", ".", "Directory the SBOM file paths are relative to")
+	quiet := fs.Bool("quiet", false, "Only print files that did not verify")
+	fs.BoolVar(&deterministic, "deterministic", false, "Leave the generation time and absolute paths out of reports")
+	logFlags := registerLogSinkFlags(fs)
+	report, args, err := splitReportArgs(args[1:])
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 {
+		fmt.Println("Usage: hashculate sbom verify <sbom.spdx.json|cyclonedx.json> [-root <dir>] [-report html <out.html>]")
+		return 1
+	}
+	sink, err := logFlags.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer sink.Close()
+
+	data, err := os.ReadFile(positional[0])
+	if err != nil {
+		fmt.Printf("Error: failed to read SBOM: %v\n", err)
+		return 1
+	}
+	entries, err := ParseSBOM(data)
+	if err == nil {
+		err = checkManifestDigests(entries)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	counts := map[string]int{}
+	var rows []ReportRow
+	for _, check := range VerifySBOM(entries, *root, NewHashCalculator()) {
+		counts[check.Status]++
+		row := ReportRow{Path: check.Path, Status: check.Status, Expected: check.Expected, Actual: check.Actual}
+		if check.Algorithm != "" {
+			row.Algorithm = getAlgorithmName(check.Algorithm)
+		}
+		if check.Err != nil {
+			row.Detail = check.Err.Error()
+		}
+		rows = append(rows, row)
+		if check.Status == "FAILED" || check.Status == "MISSING" {
+			sink.Emit(logError, "verify.failed", fmt.Sprintf("%s: %s", check.Path, check.Status), map[string]any{
+				"sbom": positional[0], "path": check.Path, "status": check.Status,
+				"algorithm": string(check.Algorithm), "expected": check.Expected, "actual": check.Actual,
+			})
+		}
+		if *quiet && check.Status == "OK" {
+			continue
+		}
+		switch {
+		case check.Err != nil:
+			fmt.Printf("%s: FAILED (%v)\n", check.Path, check.Err)
+		case check.Status == "FAILED":
+			fmt.Printf("%s: FAILED %s expected %s, got %s\n", check.Path, getAlgorithmName(check.Algorithm), check.Expected, check.Actual)
+		case check.Status == "UNSUPPORTED":
+			fmt.Printf("%s: UNSUPPORTED (no md5, sha1, sha256 or sha512 checksum)\n", check.Path)
+		default:
+			fmt.Printf("%s: %s\n", check.Path, check.Status)
+		}
+	}
+
+	if report != nil {
+		err := report.write(VerificationReport{
+			Title:     "Verification of " + outputPath(positional[0]),
+			Manifest:  outputPath(positional[0]),
+			Root:      outputPath(*root),
+			Generated: outputTime(time.Now()),
+			Rows:      rows,
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+
+	fmt.Println()
+	summary := fmt.Sprintf("%d OK, %d mismatched, %d missing, %d unsupported",
+		counts["OK"], counts["FAILED"], counts["MISSING"], counts["UNSUPPORTED"])
+	fmt.Println(summary)
+	failed := counts["FAILED"] > 0 || counts["MISSING"] > 0
+	level := logInfo
+	if failed {
+		level = logError
+	}
+	sink.Emit(level, "scan.summary", "sbom verify: "+summary, map[string]any{
+		"sbom": positional[0], "ok": counts["OK"], "failed": counts["FAILED"],
+		"missing": counts["MISSING"], "unsupported": counts["UNSUPPORTED"],
+	})
+	if failed {
+		return 1
+	}
+	return 0
+}
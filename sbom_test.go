@@ -0,0 +1,50 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifySBOM(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "bin"), 0755)
+	os.WriteFile(filepath.Join(root, "bin", "app"), []byte("app"), 0644)
+	os.WriteFile(filepath.Join(root, "README"), []byte("changed"), 0644)
+	appSum := sha256.Sum256([]byte("app"))
+	readmeSum := sha256.Sum256([]byte("readme"))
+
+	spdx := fmt.Sprintf(`{"spdxVersion":"SPDX-2.3","files":[
+		{"fileName":"./bin/app","checksums":[{"algorithm":"SHA1","checksumValue":"ignored"},{"algorithm":"SHA256","checksumValue":"%x"}]},
+		{"fileName":"./README","checksums":[{"algorithm":"SHA256","checksumValue":"%x"}]},
+		{"fileName":"./gone","checksums":[{"algorithm":"SHA256","checksumValue":"%x"}]}]}`, appSum, readmeSum, appSum)
+	cyclonedx := fmt.Sprintf(`{"bomFormat":"CycloneDX","components":[{"type":"library","name":"lib","components":[
+		{"type":"file","name":"bin/app","hashes":[{"alg":"SHA-256","content":"%x"}]},
+		{"type":"file","name":"README","hashes":[{"alg":"SHA-256","content":"%x"}]},
+		{"type":"file","name":"gone","hashes":[{"alg":"SHA-256","content":"%x"}]}]}]}`, appSum, readmeSum, appSum)
+
+	for name, doc := range map[string]string{"spdx": spdx, "cyclonedx": cyclonedx} {
+		entries, err := ParseSBOM([]byte(doc))
+		if err != nil {
+			t.Fatalf("%s: parse failed: %v", name, err)
+		}
+		results := VerifySBOM(entries, root, NewHashCalculator())
+		if len(results) != 3 {
+			t.Fatalf("%s: expected 3 results, got %d", name, len(results))
+		}
+		for i, want := range []string{"OK", "FAILED", "MISSING"} {
+			if results[i].Status != want {
+				t.Errorf("%s: %s expected %s, got %s", name, results[i].Path, want, results[i].Status)
+			}
+		}
+		if results[0].Algorithm != SHA256 {
+			t.Errorf("%s: expected strongest algorithm sha256, got %s", name, results[0].Algorithm)
+		}
+	}
+
+	if _, err := ParseSBOM([]byte(`{"foo":1}`)); err == nil {
+		t.Error("Expected error for unrecognized SBOM")
+	}
+}
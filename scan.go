@@ -0,0 +1,357 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"hashculate/hasher"
+)
+
+// systemExcludes are the paths a drive-wide scan skips with -exclude-system:
+// swap and hibernation files, recycle bins, temporary and cache directories
+// and virtual file systems, as patterns for scanExcludes
+var systemExcludes = map[string][]string{
+	"windows": {
+		"pagefile.sys", "hiberfil.sys", "swapfile.sys", "DumpStack.log.tmp", "System Volume Information",
+		"$Recycle.Bin", "$WinREAgent", "$WINDOWS.~BT", "$WINDOWS.~WS", "Config.Msi",
+		"Windows/Temp", "Windows/Prefetch", "Windows/SoftwareDistribution/Download",
+		"ProgramData/Microsoft/Windows Defender/Scans", "Users/*/AppData/Local/Temp",
+	},
+	"darwin": {
+		".Spotlight-V100", ".fseventsd", ".Trashes", "/dev", "/private/tmp", "/private/var/vm",
+		"/private/var/folders", "/System/Volumes", "/Volumes",
+	},
+	"linux": {
+		"lost+found", "/proc", "/sys", "/dev", "/run", "/tmp", "/var/tmp", "/var/run", "/var/cache", "/swapfile", "/swap.img",
+	},
+}
+
+// scanProblem is a file or directory a scan could not read
+type scanProblem struct {
+	Path string
+	Err  error
+}
+
+// scanWalk lists the regular files of a scan. Links and junctions are
+// counted and left alone unless followed; a followed link into a directory
+// the scan covers anyway, or above one, would scan it twice or loop forever
+// and is skipped.
+type scanWalk struct {
+	excludes []string // Absolute patterns, as for ignored
+	follow   bool
+	covered  []string // Real paths of the roots and followed targets
+
+	files       []string
+	total       int64
+	problems    []scanProblem
+	links       int
+	firmlinked  int // macOS data volume directories also scanned through their firmlinks
+	overlapping []string
+}
+
+// caseInsensitive is set where paths usually ignore case
+var caseInsensitive = runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+
+// scanExcludes turns patterns into ones for ignored: plain names match at
+// any depth, and patterns with a slash are taken below root, with or without
+// a leading one as in .gitignore
+func scanExcludes(root string, patterns []string) []string {
+	var excludes []string
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, `/\`) {
+			excludes = append(excludes, pattern)
+		} else {
+			excludes = append(excludes, filepath.Join(root, filepath.FromSlash(strings.TrimLeft(pattern, `/\`))))
+		}
+	}
+	return excludes
+}
+
+// excluded reports whether path matches an exclude
+func (w *scanWalk) excluded(path string) bool {
+	if caseInsensitive {
+		lowered := make([]string, len(w.excludes))
+		for i, pattern := range w.excludes {
+			lowered[i] = strings.ToLower(pattern)
+		}
+		return ignored(strings.ToLower(path), lowered)
+	}
+	return ignored(path, w.excludes)
+}
+
+// excludedBelow reports whether path, or a directory between root and it, matches an exclude
+func (w *scanWalk) excludedBelow(root, path string) bool {
+	root = filepath.Clean(root)
+	for p := filepath.Clean(path); len(p) > len(root); p = filepath.Dir(p) {
+		if w.excluded(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// walk lists the files below dir, or dir itself when it is a file
+func (w *scanWalk) walk(dir string) {
+	hasher.WalkDir(hasher.OS, dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			w.problems = append(w.problems, scanProblem{path, err})
+			return nil
+		}
+		if path == dir && entry.IsDir() {
+			return nil
+		}
+		if w.excluded(path) {
+			if entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		// Junctions and mount points are irregular entries on Windows
+		linked := entry.Type()&(fs.ModeSymlink|fs.ModeIrregular) != 0
+		switch {
+		case linked && !w.follow:
+			w.links++
+		case linked:
+			info, err := os.Stat(path)
+			switch {
+			case err != nil:
+				w.problems = append(w.problems, scanProblem{path, err})
+			case info.Mode().IsRegular():
+				w.files = append(w.files, path)
+				w.total += info.Size()
+			case info.IsDir():
+				target, err := linkTarget(path)
+				if err != nil {
+					w.problems = append(w.problems, scanProblem{path, err})
+				} else if w.overlaps(target) {
+					w.overlapping = append(w.overlapping, path)
+				} else {
+					w.covered = append(w.covered, target)
+					w.walk(path)
+				}
+			default: // Such as files kept only online by a cloud drive
+				w.links++
+			}
+		case entry.IsDir() && firmlinked(path, w.covered):
+			w.firmlinked++
+			return fs.SkipDir
+		case entry.Type().IsRegular():
+			if info, err := entry.Info(); err == nil {
+				w.total += info.Size()
+			}
+			w.files = append(w.files, path)
+		}
+		return nil
+	})
+}
+
+// overlaps reports whether a directory lies within, or contains, one the
+// scan already covers
+func (w *scanWalk) overlaps(dir string) bool {
+	for _, covered := range w.covered {
+		if within(dir, covered) || within(covered, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether path is dir or lies below it
+func within(path, dir string) bool {
+	if caseInsensitive {
+		path, dir = strings.ToLower(path), strings.ToLower(dir)
+	}
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// linkTarget resolves a link or junction to the real path of its target;
+// EvalSymlinks alone leaves Windows junctions alone
+func linkTarget(path string) (string, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	if target, err = filepath.EvalSymlinks(target); err != nil {
+		return "", err
+	}
+	return filepath.Abs(target)
+}
+
+// scanRoot completes a bare drive such as C: to its root directory, which
+// C: alone does not mean on Windows
+func scanRoot(root string) string {
+	if volume := filepath.VolumeName(root); volume != "" && volume == root {
+		return root + string(filepath.Separator)
+	}
+	return root
+}
+
+// runScan implements the scan command
+func runScan(args []string) int {
+	fs := flag.NewFlagSet("scan", flag.ExitOnError)
+	output := fs.String("o", "scan.json", "Hash database to record the scan in")
+	algorithmList := fs.String("a", "sha256", "Comma-separated algorithms")
+	excludeSystem := fs.Bool("exclude-system", false, "Skip swap and hibernation files, recycle bins, temporary directories and virtual file systems")
+	follow := fs.Bool("follow", false, "Follow symbolic links and junctions, skipping those that loop")
+	clones := fs.Bool("clones", false, "Hash files that share their data on disk (clones, hard links) once")
+	warmCache := fs.Bool("warm-cache", false, "Read files into the page cache a little ahead of hashing them")
+	backups := fs.Int("backups", 0, "Keep this many copies of the previous database as <db.json>.1 …")
+	excludeList := fs.String("exclude", "", "Comma-separated patterns of paths to skip; plain names match at any depth")
+	recordHost := fs.Bool("record-host", false, "Record the hostname in the database's parameters")
+	positional := parseFlags(fs, args)
+	algorithms, err := parseAlgorithmList(*algorithmList)
+	if err != nil || len(positional) == 0 {
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+		fmt.Println("Usage: hashculate scan <drive|dir>... [-o scan.json] [-a sha256] [-exclude-system] [-exclude <patterns>] [-follow] [-clones] [-warm-cache] [-backups <n>] [-record-host]")
+		return 1
+	}
+
+	walk := &scanWalk{follow: *follow}
+	absOutput, _ := filepath.Abs(*output)
+	var roots []string
+	for _, root := range positional {
+		root = scanRoot(root)
+		roots = append(roots, root)
+		real, err := filepath.EvalSymlinks(root)
+		if err == nil {
+			real, err = filepath.Abs(real)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		walk.covered = append(walk.covered, real)
+		var patterns []string
+		if *excludeList != "" {
+			patterns = strings.Split(*excludeList, ",")
+		}
+		if *excludeSystem {
+			patterns = append(patterns, systemExcludes[runtime.GOOS]...)
+		}
+		walk.excludes = scanExcludes(root, patterns)
+		// The scan's own database changes while it runs
+		for _, output := range []string{filepath.Clean(*output), absOutput} {
+			walk.excludes = append(walk.excludes, output, output+".*")
+		}
+		fmt.Printf("Listing %s...\n", root)
+		walk.walk(root)
+	}
+
+	db, err := OpenHashDB(*output)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	db.Backups = *backups
+	journal, err := OpenScanJournal(*output + ".journal")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if journal.Resumed() > 0 {
+		fmt.Printf("Resuming: %d file(s) already hashed according to %s\n", journal.Resumed(), *output+".journal")
+	}
+
+	calc := NewHashCalculator()
+	if *clones {
+		calc.Clones = newCloneCache()
+	}
+	params := newRunParameters(algorithms, calc.ChunkSize, *recordHost)
+	if *excludeList != "" {
+		params.Excludes = strings.Split(*excludeList, ",")
+	}
+	if *excludeSystem {
+		params.Options = append(params.Options, "exclude-system")
+	}
+	if *follow {
+		params.Options = append(params.Options, "follow")
+	}
+	for _, drift := range db.SetParameters(params) {
+		fmt.Printf("Settings drift since the last scan: %s\n", drift)
+	}
+	if *warmCache {
+		calc.Warm = newCacheWarmer()
+		calc.Warm.start(walk.files)
+		defer calc.Warm.stop()
+	}
+	if isTerminal(os.Stderr) {
+		calc.Batch = NewBatchProgress(os.Stderr, len(walk.files), walk.total)
+	}
+	recorded := 0
+	for _, path := range walk.files {
+		entry, ok := journal.Done(path, algorithms)
+		if !ok {
+			if entry, err = HashFileEntry(calc, path, algorithms); err == nil {
+				err = journal.Record(entry)
+			}
+			// Files in use or readable only by administrators do not stop the scan
+			if err != nil {
+				walk.problems = append(walk.problems, scanProblem{path, err})
+				continue
+			}
+		}
+		db.Put(entry)
+		recorded++
+	}
+	if calc.Batch != nil {
+		calc.Batch.Finish()
+	}
+	// The database is a snapshot, so files gone since the last scan leave it
+	listed := map[string]bool{}
+	for _, path := range walk.files {
+		listed[dbKey(path)] = true
+	}
+	for _, entry := range db.Entries() {
+		if !listed[entry.Path] && underPaths(entry.Path, roots) {
+			db.Delete(entry.Path)
+		}
+	}
+	if err := db.Save(); err != nil {
+		journal.Close(false)
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	journal.Close(true)
+
+	fmt.Printf("Recorded %d file(s) in %s\n", recorded, *output)
+	calc.Clones.Print()
+	if walk.links > 0 {
+		fmt.Printf("%d link(s) and junction(s) not followed (-follow follows them)\n", walk.links)
+	}
+	if walk.firmlinked > 0 {
+		fmt.Printf("%d data volume director(ies) skipped, being scanned through their firmlinks\n", walk.firmlinked)
+	}
+	for _, path := range walk.overlapping {
+		fmt.Printf("Skipped %s: leads into or above a directory the scan covers\n", path)
+	}
+	denied, inUse := 0, 0
+	for _, problem := range walk.problems {
+		fmt.Printf("Skipped %s: %v\n", problem.Path, problem.Err)
+		if errors.Is(problem.Err, os.ErrPermission) {
+			denied++
+		} else if isInUse(problem.Err) {
+			inUse++
+		}
+	}
+	if denied > 0 && !elevated() {
+		fmt.Printf("%d path(s) could not be read without privileges: %s\n", denied, elevationHint)
+	}
+	if inUse > 0 {
+		fmt.Printf("%d file(s) were locked by running programs; scan a shadow copy to include them\n", inUse)
+	}
+	if len(walk.problems) > 0 {
+		return 1
+	}
+	return 0
+}
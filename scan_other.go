@@ -0,0 +1,19 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// elevationHint tells how to scan with the privileges to read every file
+const elevationHint = "run the scan as root, e.g. with sudo"
+
+// elevated reports whether the process runs as root
+func elevated() bool {
+	return os.Geteuid() == 0
+}
+
+// isInUse reports whether a file could not be read because another program
+// locked it, which only Windows does
+func isInUse(err error) bool {
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+func TestScanWalk(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(root, "data", "sub"), 0755)
+	os.MkdirAll(filepath.Join(root, "Windows", "Temp"), 0755)
+	os.WriteFile(filepath.Join(root, "data", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(root, "data", "sub", "pagefile.sys"), []byte("swap"), 0644)
+	os.WriteFile(filepath.Join(root, "Windows", "Temp", "t.tmp"), []byte("t"), 0644)
+	os.WriteFile(filepath.Join(outside, "o.txt"), []byte("o"), 0644)
+	if err := os.Symlink("..", filepath.Join(root, "data", "sub", "up")); err != nil {
+		t.Skipf("Symbolic links are not available: %v", err)
+	}
+	os.Symlink(outside, filepath.Join(root, "data", "outside"))
+
+	walk := &scanWalk{excludes: scanExcludes(root, systemExcludes["windows"]), covered: []string{root}}
+	walk.walk(root)
+	if want := []string{filepath.Join(root, "data", "a.txt")}; !slices.Equal(walk.files, want) {
+		t.Errorf("Expected %v, got %v", want, walk.files)
+	}
+	if walk.links != 2 {
+		t.Errorf("Expected 2 links left alone, got %d", walk.links)
+	}
+
+	// Following, the link out of the tree is scanned and the one back into it is a loop
+	real, _ := filepath.EvalSymlinks(root)
+	walk = &scanWalk{follow: true, covered: []string{real}}
+	walk.walk(root)
+	if !slices.Contains(walk.files, filepath.Join(root, "data", "outside", "o.txt")) || len(walk.files) != 4 {
+		t.Errorf("Unexpected files when following links: %v", walk.files)
+	}
+	if want := []string{filepath.Join(root, "data", "sub", "up")}; !slices.Equal(walk.overlapping, want) {
+		t.Errorf("Expected the loop %v to be skipped, got %v", want, walk.overlapping)
+	}
+}
+
+func TestScanRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		if got := scanRoot(`C:`); got != `C:\` {
+			t.Errorf("Expected C: to mean the drive's root, got %q", got)
+		}
+	}
+	if got := scanRoot("data"); got != "data" {
+		t.Errorf("Expected a directory to be kept, got %q", got)
+	}
+	excludes := scanExcludes(filepath.FromSlash("/mnt/image"), []string{"lost+found", "/proc", "var/tmp"})
+	want := []string{"lost+found", filepath.FromSlash("/mnt/image/proc"), filepath.FromSlash("/mnt/image/var/tmp")}
+	if !slices.Equal(excludes, want) {
+		t.Errorf("Expected %v, got %v", want, excludes)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+)
+
+// elevationHint tells how to scan with the privileges to read every file
+const elevationHint = "run the scan from an elevated prompt (Run as administrator)"
+
+// tokenElevation is the TokenElevation information class of GetTokenInformation
+const tokenElevation = 20
+
+// elevated reports whether the process runs with an elevated (administrator) token
+func elevated() bool {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return false
+	}
+	var token syscall.Token
+	if err := syscall.OpenProcessToken(process, syscall.TOKEN_QUERY, &token); err != nil {
+		return false
+	}
+	defer token.Close()
+	var isElevated uint32
+	var size uint32
+	err = syscall.GetTokenInformation(token, tokenElevation, (*byte)(unsafe.Pointer(&isElevated)), uint32(unsafe.Sizeof(isElevated)), &size)
+	return err == nil && isElevated != 0
+}
+
+// isInUse reports whether a file could not be read because another program
+// locked it, as Windows does for registry hives and open databases
+func isInUse(err error) bool {
+	return errors.Is(err, syscall.Errno(32)) || // ERROR_SHARING_VIOLATION
+		errors.Is(err, syscall.Errno(33)) // ERROR_LOCK_VIOLATION
+}
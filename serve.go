@@ -0,0 +1,520 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hashculate/httpdigest"
+)
+
+// Tenant is a client of the hashing service. It authenticates with an API key
+// or a client certificate and may only hash server files below its paths.
+type Tenant struct {
+	Name         string   `json:"name"`
+	APIKeySHA256 string   `json:"api-key-sha256"` // hex SHA-256 of the API key
+	ClientCN     string   `json:"client-cn"`      // certificate CN, DNS or email SAN
+	Paths        []string `json:"paths"`
+	RateLimit    int      `json:"rate-limit"` // requests per minute, 0 for unlimited
+	Burst        int      `json:"burst"`
+
+	keyHash []byte
+	roots   []string
+	limiter *rateLimiter
+}
+
+// ServeConfig is the serve.yaml configuration of the hashing service
+type ServeConfig struct {
+	Listen   string   `json:"listen"`
+	TLSCert  string   `json:"tls-cert"`
+	TLSKey   string   `json:"tls-key"`
+	ClientCA string   `json:"client-ca"` // enables mTLS
+	Tenants  []Tenant `json:"tenants"`
+}
+
+// HashResponse is the JSON body returned for a hashing request
+type HashResponse struct {
+	File   string                   `json:"file"`
+	Size   int64                    `json:"size"`
+	Hashes map[HashAlgorithm]string `json:"hashes"`
+	Tenant string                   `json:"tenant,omitempty"`
+}
+
+// LoadServeConfig reads and validates a serve policy file
+func LoadServeConfig(path string) (*ServeConfig, error) {
+	config, err := readServeConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := config.prepare(); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// readServeConfig reads a serve policy file without validating it
+func readServeConfig(path string) (*ServeConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	config := &ServeConfig{}
+	if err := decodeYAML(data, config); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// prepare validates tenants and resolves their credentials, roots and limits
+func (c *ServeConfig) prepare() error {
+	if c.Listen == "" {
+		c.Listen = "localhost:8080"
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tls-cert and tls-key must be set together")
+	}
+	if c.ClientCA != "" && c.TLSCert == "" {
+		return errors.New("client-ca requires tls-cert and tls-key")
+	}
+	names := map[string]bool{}
+	for i := range c.Tenants {
+		tenant := &c.Tenants[i]
+		if tenant.Name == "" {
+			tenant.Name = fmt.Sprintf("tenant-%d", i+1)
+		}
+		if names[tenant.Name] {
+			return fmt.Errorf("duplicate tenant %q", tenant.Name)
+		}
+		names[tenant.Name] = true
+		if tenant.APIKeySHA256 == "" && tenant.ClientCN == "" {
+			return fmt.Errorf("tenant %q needs api-key-sha256 or client-cn", tenant.Name)
+		}
+		if tenant.ClientCN != "" && c.ClientCA == "" {
+			return fmt.Errorf("tenant %q: client-cn requires client-ca", tenant.Name)
+		}
+		if tenant.APIKeySHA256 != "" {
+			key, err := hex.DecodeString(tenant.APIKeySHA256)
+			if err != nil || len(key) != sha256.Size {
+				return fmt.Errorf("tenant %q: api-key-sha256 must be 64 hex characters", tenant.Name)
+			}
+			tenant.keyHash = key
+		}
+		for _, path := range tenant.Paths {
+			root, err := resolvePath(path)
+			if err != nil {
+				return fmt.Errorf("tenant %q: %w", tenant.Name, err)
+			}
+			tenant.roots = append(tenant.roots, root)
+		}
+		if tenant.RateLimit < 0 || tenant.Burst < 0 {
+			return fmt.Errorf("tenant %q: rate-limit and burst cannot be negative", tenant.Name)
+		}
+		if tenant.RateLimit > 0 {
+			tenant.limiter = newRateLimiter(float64(tenant.RateLimit)/60, max(tenant.Burst, 1))
+		}
+	}
+	return nil
+}
+
+// resolvePath returns the absolute path with symlinks resolved
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// allowedPath resolves path and checks it lies within one of roots, so
+// symlinks and .. cannot escape a tenant's allowlist
+func allowedPath(path string, roots []string) (string, bool) {
+	resolved, err := resolvePath(path)
+	if err != nil {
+		return "", false
+	}
+	for _, root := range roots {
+		rel, err := filepath.Rel(root, resolved)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, true
+		}
+	}
+	return "", false
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// allow takes a token, or returns how long until one is available
+func (l *rateLimiter) allow(now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// Server is the REST hashing service
+type Server struct {
+	Config  *ServeConfig
+	Sink    *LogSink
+	calc    *HashCalculator
+	mux     *http.ServeMux
+	handler http.Handler
+	uploads uploadStore
+}
+
+// NewServer creates the service for a prepared configuration
+func NewServer(config *ServeConfig, sink *LogSink) *Server {
+	s := &Server{Config: config, Sink: sink, calc: NewHashCalculator(), mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	s.mux.HandleFunc("POST /v1/hash", s.authorized(s.handleUpload))
+	s.mux.HandleFunc("GET /v1/hash", s.authorized(s.handlePath))
+	s.mux.HandleFunc("POST /v1/uploads", s.authorized(s.handleUploadCreate))
+	s.mux.HandleFunc("HEAD /v1/uploads/{id}", s.authorized(s.handleUploadStatus))
+	s.mux.HandleFunc("GET /v1/uploads/{id}", s.authorized(s.handleUploadStatus))
+	s.mux.HandleFunc("PATCH /v1/uploads/{id}", s.authorized(s.handleUploadChunk))
+	s.mux.HandleFunc("POST /v1/uploads/{id}/complete", s.authorized(s.handleUploadComplete))
+	s.mux.HandleFunc("DELETE /v1/uploads/{id}", s.authorized(s.handleUploadCancel))
+	// Responses carry an RFC 9530 Content-Digest; the default options cannot fail
+	s.handler, _ = httpdigest.Middleware(s.mux, httpdigest.Options{})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// checkContentDigest verifies a request body hashed by verifier against its
+// Content-Digest header or trailer. Digests with only unknown algorithms are ignored.
+func checkContentDigest(r *http.Request, verifier *httpdigest.Verifier) error {
+	field := r.Header.Get("Content-Digest")
+	if field == "" {
+		field = r.Trailer.Get("Content-Digest")
+	}
+	if field == "" {
+		return nil
+	}
+	if err := verifier.Check(field); err != nil && err != httpdigest.ErrNoKnownDigest {
+		return err
+	}
+	return nil
+}
+
+// tenantHandler is a handler for an authenticated request. tenant is nil when
+// the server runs without tenants.
+type tenantHandler func(w http.ResponseWriter, r *http.Request, tenant *Tenant)
+
+// authenticate finds the tenant presenting the request's API key or client certificate
+func (s *Server) authenticate(r *http.Request) *Tenant {
+	key := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		key = bearer
+	}
+	if key != "" {
+		sum := sha256.Sum256([]byte(key))
+		for i := range s.Config.Tenants {
+			tenant := &s.Config.Tenants[i]
+			if tenant.keyHash != nil && subtle.ConstantTimeCompare(sum[:], tenant.keyHash) == 1 {
+				return tenant
+			}
+		}
+		return nil
+	}
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	names := append(append([]string{cert.Subject.CommonName}, cert.DNSNames...), cert.EmailAddresses...)
+	for i := range s.Config.Tenants {
+		tenant := &s.Config.Tenants[i]
+		for _, name := range names {
+			if tenant.ClientCN != "" && name == tenant.ClientCN {
+				return tenant
+			}
+		}
+	}
+	return nil
+}
+
+// authorized wraps a handler with authentication and the tenant's rate limit
+func (s *Server) authorized(next tenantHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if len(s.Config.Tenants) == 0 {
+			next(w, r, nil)
+			return
+		}
+		tenant := s.authenticate(r)
+		if tenant == nil {
+			s.Sink.Emit(logWarning, "auth.denied", "unauthenticated request", map[string]any{"remote": r.RemoteAddr, "path": r.URL.Path})
+			w.Header().Set("WWW-Authenticate", `Bearer realm="hashculate"`)
+			writeError(w, http.StatusUnauthorized, "missing or invalid API key or client certificate")
+			return
+		}
+		if tenant.limiter != nil {
+			if ok, wait := tenant.limiter.allow(time.Now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+		}
+		next(w, r, tenant)
+	}
+}
+
+// requestAlgorithms parses the algorithm query parameter, defaulting to sha256
+func requestAlgorithms(r *http.Request) ([]HashAlgorithm, error) {
+	list := r.URL.Query().Get("algorithm")
+	if list == "" {
+		list = "sha256"
+	}
+	return parseAlgorithmList(list)
+}
+
+// handleUpload hashes the request body
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	algorithms, err := requestAlgorithms(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "upload"
+	}
+	verifier := httpdigest.NewVerifier()
+	results, err := s.calc.CalculateReaderDigests(io.TeeReader(r.Body, verifier), name, r.ContentLength, algorithms, nil)
+	if err == nil {
+		err = checkContentDigest(r, verifier)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.respond(w, tenant, results)
+}
+
+// handlePath hashes a file on the server within the tenant's allowlist
+func (s *Server) handlePath(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	algorithms, err := requestAlgorithms(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeError(w, http.StatusBadRequest, "path query parameter is required")
+		return
+	}
+	// Without tenants nobody is authenticated, so server files are off limits
+	if tenant == nil {
+		writeError(w, http.StatusForbidden, "hashing server files requires tenants with path allowlists")
+		return
+	}
+	resolved, ok := allowedPath(path, tenant.roots)
+	if !ok {
+		s.Sink.Emit(logWarning, "auth.denied", "path outside allowlist", map[string]any{"tenant": tenant.Name, "file": path})
+		writeError(w, http.StatusForbidden, "path is not allowed for this tenant")
+		return
+	}
+	results, err := s.calc.CalculateFileDigests(resolved, algorithms, nil)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	results[0].Filename = path
+	s.respond(w, tenant, results)
+}
+
+// respond writes the digests of a request
+func (s *Server) respond(w http.ResponseWriter, tenant *Tenant, results []*HashResult) {
+	response := HashResponse{File: results[0].Filename, Size: results[0].FileSize, Hashes: map[HashAlgorithm]string{}}
+	for _, result := range results {
+		response.Hashes[result.Algorithm] = result.Hash
+	}
+	fields := map[string]any{"file": response.File, "size": response.Size}
+	if tenant != nil {
+		response.Tenant = tenant.Name
+		fields["tenant"] = tenant.Name
+	}
+	s.Sink.Emit(logInfo, "hash.computed", "hashed "+response.File, fields)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeError writes a JSON error body
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// tlsConfig builds the server TLS settings, requesting client certificates for mTLS
+func (c *ServeConfig) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if c.ClientCA != "" {
+		pool, err := loadCertPool(c.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		// API-key clients may still connect without a certificate
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// serveFlags are the flags of the serve command
+type serveFlags struct {
+	configPath, listen, tlsCert, tlsKey, clientCA *string
+	drain                                         *time.Duration
+	log                                           *logSinkFlags
+}
+
+// newServeFlags defines the flags of the serve command, which config check shares
+func newServeFlags() (*flag.FlagSet, *serveFlags) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	return fs, &serveFlags{
+		configPath: fs.String("config", "", "Service configuration with TLS settings and tenants"),
+		listen:     fs.String("listen", "", "Listen address [default: localhost:8080]"),
+		tlsCert:    fs.String("tls-cert", "", "Server certificate in PEM, instead of tls-cert in the config"),
+		tlsKey:     fs.String("tls-key", "", "Server private key in PEM, instead of tls-key in the config"),
+		clientCA:   fs.String("client-ca", "", "CA certificates for mTLS clients, instead of client-ca in the config"),
+		drain:      fs.Duration("drain-timeout", 30*time.Second, "How long to let in-flight requests finish on shutdown"),
+		log:        registerLogSinkFlags(fs),
+	}
+}
+
+// config reads the configuration file, when one is given, applies the flags
+// that override it and validates the result
+func (f *serveFlags) config() (*ServeConfig, error) {
+	config := &ServeConfig{}
+	if *f.configPath != "" {
+		var err error
+		if config, err = readServeConfig(*f.configPath); err != nil {
+			return nil, err
+		}
+	}
+	// Flags override the config, so a container can run from its environment alone
+	for _, override := range []struct{ flag, field *string }{
+		{f.listen, &config.Listen}, {f.tlsCert, &config.TLSCert}, {f.tlsKey, &config.TLSKey}, {f.clientCA, &config.ClientCA},
+	} {
+		if *override.flag != "" {
+			*override.field = *override.flag
+		}
+	}
+	if err := config.prepare(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// runServe implements the serve command
+func runServe(args []string) int {
+	fs, flags := newServeFlags()
+	parseFlags(fs, args)
+	config, err := flags.config()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	sink, err := flags.log.open()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer sink.Close()
+
+	server := &http.Server{Addr: config.Listen, Handler: NewServer(config, sink), ReadHeaderTimeout: 30 * time.Second}
+
+	// A socket passed by systemd socket activation replaces the listen address
+	listeners, err := activationListeners()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	var listener net.Listener
+	if len(listeners) > 0 {
+		listener = listeners[0]
+	} else if listener, err = net.Listen("tcp", config.Listen); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(config.Tenants) == 0 {
+		fmt.Println("Warning: no tenants configured, uploads are accepted without authentication")
+	}
+	scheme := "http"
+	if config.TLSCert != "" {
+		if server.TLSConfig, err = config.tlsConfig(); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		scheme = "https"
+	}
+
+	// Shutting down stops accepting connections and lets requests being hashed finish
+	stopped := make(chan error, 1)
+	stop := stopRequested()
+	go func() {
+		<-stop
+		notifyStopping()
+		fmt.Printf("Shutting down, waiting up to %s for requests in progress\n", *flags.drain)
+		ctx, cancel := context.WithTimeout(context.Background(), *flags.drain)
+		defer cancel()
+		stopped <- server.Shutdown(ctx)
+	}()
+
+	status := fmt.Sprintf("Serving on %s://%s (%d tenant(s))", scheme, listener.Addr(), len(config.Tenants))
+	fmt.Println(status)
+	notifyReady(status)
+	if scheme == "https" {
+		err = server.ServeTLS(listener, "", "")
+	} else {
+		err = server.Serve(listener)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		err = <-stopped
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
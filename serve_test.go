@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeTenants(t *testing.T) {
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "artifacts")
+	os.Mkdir(allowed, 0755)
+	os.WriteFile(filepath.Join(allowed, "a.txt"), []byte("hello world"), 0644)
+	os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0644)
+	os.Symlink(filepath.Join(dir, "secret.txt"), filepath.Join(allowed, "escape"))
+
+	keyHash := sha256.Sum256([]byte("build-key"))
+	config := &ServeConfig{Tenants: []Tenant{{
+		Name:         "build",
+		APIKeySHA256: hex.EncodeToString(keyHash[:]),
+		Paths:        []string{allowed},
+		RateLimit:    60,
+		Burst:        4,
+	}}}
+	if err := config.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewServer(config, nil))
+	defer server.Close()
+
+	get := func(key, path string) (int, HashResponse) {
+		req, _ := http.NewRequest("GET", server.URL+"/v1/hash?algorithm=sha256,md5&path="+url.QueryEscape(path), nil)
+		if key != "" {
+			req.Header.Set("Authorization", "Bearer "+key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body HashResponse
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	status, body := get("build-key", filepath.Join(allowed, "a.txt"))
+	if status != http.StatusOK || body.Hashes[MD5] != "5eb63bbbe01eeed093cb22bb8f5acdc3" || body.Tenant != "build" {
+		t.Errorf("Expected allowed file to be hashed, got %d %+v", status, body)
+	}
+	if status, _ := get("wrong-key", filepath.Join(allowed, "a.txt")); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong key, got %d", status)
+	}
+	if status, _ := get("build-key", filepath.Join(allowed, "..", "secret.txt")); status != http.StatusForbidden {
+		t.Errorf("Expected 403 outside the allowlist, got %d", status)
+	}
+	if status, _ := get("build-key", filepath.Join(allowed, "escape")); status != http.StatusForbidden {
+		t.Errorf("Expected 403 for a symlink escaping the allowlist, got %d", status)
+	}
+
+	// Three requests used the burst of four; the next is allowed, then limited
+	req, _ := http.NewRequest("POST", server.URL+"/v1/hash", strings.NewReader("hello world"))
+	req.Header.Set("X-API-Key", "build-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected upload to be hashed: %v", err)
+	}
+	resp.Body.Close()
+	if status, _ := get("build-key", filepath.Join(allowed, "a.txt")); status != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the burst is used, got %d", status)
+	}
+}
+
+func TestServeMutualTLS(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "clients-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	caCert, _ := x509.ParseCertificate(caDER)
+	clientCert := func(cn string) tls.Certificate {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+
+	config := &ServeConfig{ClientCA: "unused", TLSCert: "unused", TLSKey: "unused", Tenants: []Tenant{{Name: "scanner", ClientCN: "scanner.internal"}}}
+	if err := config.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(NewServer(config, nil))
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+
+	upload := func(cert *tls.Certificate) int {
+		// A fresh transport per call so connections are not reused across identities
+		transport := server.Client().Transport.(*http.Transport).Clone()
+		if cert != nil {
+			transport.TLSClientConfig.Certificates = []tls.Certificate{*cert}
+		}
+		client := &http.Client{Transport: transport}
+		resp, err := client.Post(server.URL+"/v1/hash", "application/octet-stream", strings.NewReader("data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	good := clientCert("scanner.internal")
+	if status := upload(&good); status != http.StatusOK {
+		t.Errorf("Expected the scanner certificate to be accepted, got %d", status)
+	}
+	other := clientCert("laptop.internal")
+	if status := upload(&other); status != http.StatusUnauthorized {
+		t.Errorf("Expected an unknown certificate to be rejected, got %d", status)
+	}
+	if status := upload(nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected a request without credentials to be rejected, got %d", status)
+	}
+}
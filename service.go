@@ -0,0 +1,199 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// serviceCommands are the commands that run as long-lived services
+var serviceCommands = map[string]func(args []string) int{"serve": runServe, "fim": runFIM}
+
+// serviceStop is closed when the Windows service manager asks the service to stop
+var serviceStop = make(chan struct{})
+
+// serviceReady is set while running as a Windows service, to report the service as running
+var serviceReady func()
+
+// sdNotify sends a state change to systemd when it supervises the process with
+// Type=notify, and does nothing otherwise
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:] // Abstract namespace
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// notifyReady tells the service manager the service is up
+func notifyReady(status string) {
+	sdNotify("READY=1\nSTATUS=" + status)
+	if serviceReady != nil {
+		serviceReady()
+	}
+}
+
+// notifyStopping tells the service manager the service is shutting down
+func notifyStopping() {
+	sdNotify("STOPPING=1")
+}
+
+// stopRequested returns a channel that receives once SIGINT or SIGTERM
+// arrives or the Windows service manager asks the service to stop
+func stopRequested() <-chan struct{} {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+		case <-serviceStop:
+		}
+		close(stop)
+	}()
+	return stop
+}
+
+// activationListeners returns the sockets systemd passed with socket
+// activation (LISTEN_FDS), or none when the process was started directly
+func activationListeners() ([]net.Listener, error) {
+	pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if pid != os.Getpid() || count <= 0 {
+		return nil, nil
+	}
+	// The variables describe this process only, not its children
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, count)
+	for i := range listeners {
+		file := os.NewFile(uintptr(3+i), "LISTEN_FD_"+strconv.Itoa(3+i))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: descriptor %d: %w", 3+i, err)
+		}
+		listeners[i] = listener
+	}
+	return listeners, nil
+}
+
+// ServiceSpec describes a service to install
+type ServiceSpec struct {
+	Name       string
+	Executable string
+	Args       []string // The command and its flags, e.g. serve -config /etc/hashculate/serve.yaml
+	Socket     string   // Address for a systemd socket unit, empty for none
+	Dir        string   // Where systemd units are written
+}
+
+// systemdUnits returns the unit files for a service, keyed by file name
+func (s ServiceSpec) systemdUnits() map[string]string {
+	quoted := []string{strconv.Quote(s.Executable)}
+	for _, arg := range s.Args {
+		quoted = append(quoted, strconv.Quote(arg))
+	}
+	units := map[string]string{
+		s.Name + ".service": fmt.Sprintf(`[Unit]
+Description=hashculate %s
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+TimeoutStopSec=60
+
+[Install]
+WantedBy=multi-user.target
+`, s.Args[0], strings.Join(quoted, " ")),
+	}
+	if s.Args[0] == "fim" {
+		// The monitor reloads its policy on SIGHUP
+		units[s.Name+".service"] = strings.Replace(units[s.Name+".service"], "Restart=", "ExecReload=/bin/kill -HUP $MAINPID\nRestart=", 1)
+	}
+	if s.Socket != "" {
+		units[s.Name+".socket"] = fmt.Sprintf(`[Unit]
+Description=hashculate %s socket
+
+[Socket]
+ListenStream=%s
+
+[Install]
+WantedBy=sockets.target
+`, s.Args[0], s.Socket)
+	}
+	return units
+}
+
+// runService implements the service command
+func runService(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate service install [-name hashculate] [-socket <addr>] [-dir <unit dir>] serve|fim [flags]")
+		fmt.Println("       hashculate service uninstall [-name hashculate] [-dir <unit dir>]")
+		return 1
+	}
+	if len(args) < 1 {
+		return usage()
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("service "+action, flag.ExitOnError)
+	name := fs.String("name", "hashculate", "Service name")
+	socket := fs.String("socket", "", "With systemd, also install a socket unit listening on this address for serve")
+	dir := fs.String("dir", "/etc/systemd/system", "Directory for systemd unit files")
+	// Flags after the command belong to it, so parsing stops there
+	fs.Parse(args[1:])
+	rest := fs.Args()
+
+	switch action {
+	case "install":
+		if len(rest) == 0 || serviceCommands[rest[0]] == nil {
+			return usage()
+		}
+		if *socket != "" && rest[0] != "serve" {
+			fmt.Println("Error: -socket applies to serve")
+			return 1
+		}
+		executable, err := os.Executable()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		spec := ServiceSpec{Name: *name, Executable: executable, Args: rest, Socket: *socket, Dir: *dir}
+		if err := installService(spec); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+	case "uninstall":
+		if err := uninstallService(ServiceSpec{Name: *name, Dir: *dir}); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		return 0
+	case "run":
+		// Started by the Windows service manager with the name and command line given at install
+		if len(rest) < 2 || serviceCommands[rest[1]] == nil {
+			return usage()
+		}
+		return runAsService(rest[0], rest[1:])
+	}
+	return usage()
+}
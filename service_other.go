@@ -0,0 +1,58 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// installService writes systemd units for the service
+func installService(spec ServiceSpec) error {
+	units := spec.systemdUnits()
+	names := make([]string, 0, len(units))
+	for name := range units {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := filepath.Join(spec.Dir, name)
+		if err := os.WriteFile(path, []byte(units[name]), 0644); err != nil {
+			return fmt.Errorf("failed to write unit: %w", err)
+		}
+		fmt.Printf("Wrote %s\n", path)
+	}
+	enable := spec.Name + ".service"
+	if spec.Socket != "" {
+		enable = spec.Name + ".socket"
+	}
+	fmt.Printf("Enable it with: systemctl daemon-reload && systemctl enable --now %s\n", enable)
+	return nil
+}
+
+// uninstallService removes the systemd units of the service
+func uninstallService(spec ServiceSpec) error {
+	removed := 0
+	for _, name := range []string{spec.Name + ".service", spec.Name + ".socket"} {
+		path := filepath.Join(spec.Dir, name)
+		if err := os.Remove(path); err == nil {
+			fmt.Printf("Removed %s\n", path)
+			removed++
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if removed == 0 {
+		return fmt.Errorf("no units named %s in %s", spec.Name, spec.Dir)
+	}
+	fmt.Printf("Stop it first with: systemctl disable --now %s, then run systemctl daemon-reload\n", spec.Name)
+	return nil
+}
+
+// runAsService is only used by the Windows service manager
+func runAsService(name string, args []string) int {
+	fmt.Println("Error: service run is started by the Windows service manager; use systemd units elsewhere")
+	return 1
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestServiceIntegration(t *testing.T) {
+	spec := ServiceSpec{Name: "hashculate", Executable: "/usr/local/bin/hashculate", Args: []string{"serve", "-config", "/etc/hashculate/serve.yaml"}, Socket: "0.0.0.0:8443"}
+	units := spec.systemdUnits()
+	service := units["hashculate.service"]
+	if !strings.Contains(service, "Type=notify\n") || !strings.Contains(service, `ExecStart="/usr/local/bin/hashculate" "serve" "-config" "/etc/hashculate/serve.yaml"`) {
+		t.Errorf("unexpected service unit:\n%s", service)
+	}
+	if !strings.Contains(units["hashculate.socket"], "ListenStream=0.0.0.0:8443\n") {
+		t.Errorf("unexpected socket unit:\n%s", units["hashculate.socket"])
+	}
+
+	// Socket activation only applies to the process systemd started
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if listeners, err := activationListeners(); err != nil || listeners != nil {
+		t.Errorf("expected no listeners for another process: %v, %v", listeners, err)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+	notifyReady("Serving on http://localhost:8080")
+	buf := make([]byte, 256)
+	n, _ := conn.Read(buf)
+	if got := string(buf[:n]); got != "READY=1\nSTATUS=Serving on http://localhost:8080" {
+		t.Errorf("unexpected notification: %q", got)
+	}
+}
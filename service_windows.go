@@ -0,0 +1,127 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// Service manager values from winsvc.h
+const (
+	serviceWin32OwnProcess = 0x10
+	serviceStopped         = 1
+	serviceStartPending    = 2
+	serviceStopPending     = 3
+	serviceRunning         = 4
+	serviceAcceptStop      = 0x1
+	serviceAcceptShutdown  = 0x4
+	serviceControlStop     = 1
+	serviceControlShutdown = 5
+)
+
+var (
+	advapi32                     = syscall.NewLazyDLL("advapi32.dll")
+	startServiceCtrlDispatcher   = advapi32.NewProc("StartServiceCtrlDispatcherW")
+	registerServiceCtrlHandlerEx = advapi32.NewProc("RegisterServiceCtrlHandlerExW")
+	setServiceStatus             = advapi32.NewProc("SetServiceStatus")
+)
+
+// serviceStatus is SERVICE_STATUS
+type serviceStatus struct {
+	ServiceType             uint32
+	CurrentState            uint32
+	ControlsAccepted        uint32
+	Win32ExitCode           uint32
+	ServiceSpecificExitCode uint32
+	CheckPoint              uint32
+	WaitHint                uint32
+}
+
+// serviceTableEntry is SERVICE_TABLE_ENTRYW
+type serviceTableEntry struct {
+	name *uint16
+	proc uintptr
+}
+
+// installService registers the service with the service manager
+func installService(spec ServiceSpec) error {
+	command := []string{syscall.EscapeArg(spec.Executable), "service", "run", syscall.EscapeArg(spec.Name)}
+	for _, arg := range spec.Args {
+		command = append(command, syscall.EscapeArg(arg))
+	}
+	if spec.Socket != "" {
+		return fmt.Errorf("socket activation is a systemd feature; set -listen in the command instead")
+	}
+	out, err := exec.Command("sc.exe", "create", spec.Name, "binPath=", strings.Join(command, " "),
+		"start=", "auto", "DisplayName=", "hashculate "+spec.Args[0]).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sc create: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("Installed service %s\n", spec.Name)
+	fmt.Printf("Start it with: sc.exe start %s\n", spec.Name)
+	return nil
+}
+
+// uninstallService removes the service from the service manager
+func uninstallService(spec ServiceSpec) error {
+	out, err := exec.Command("sc.exe", "delete", spec.Name).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("sc delete: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	fmt.Printf("Removed service %s\n", spec.Name)
+	return nil
+}
+
+// runAsService connects to the service manager and runs the command as the
+// service, reporting it running once ready and stopping it on request
+func runAsService(name string, args []string) int {
+	var (
+		handle uintptr
+		mu     sync.Mutex
+		status = serviceStatus{ServiceType: serviceWin32OwnProcess}
+		code   = 0
+	)
+	report := func(state uint32) {
+		mu.Lock()
+		defer mu.Unlock()
+		status.CurrentState = state
+		status.ControlsAccepted = 0
+		if state == serviceRunning {
+			status.ControlsAccepted = serviceAcceptStop | serviceAcceptShutdown
+		}
+		if state == serviceStopped && code != 0 {
+			status.Win32ExitCode, status.ServiceSpecificExitCode = 1066, uint32(code) // ERROR_SERVICE_SPECIFIC_ERROR
+		}
+		setServiceStatus.Call(handle, uintptr(unsafe.Pointer(&status)))
+	}
+	var stopOnce sync.Once
+	handler := syscall.NewCallback(func(control, eventType, eventData, context uintptr) uintptr {
+		if control == serviceControlStop || control == serviceControlShutdown {
+			report(serviceStopPending)
+			stopOnce.Do(func() { close(serviceStop) })
+		}
+		return 0
+	})
+	main := syscall.NewCallback(func(argc, argv uintptr) uintptr {
+		serviceName, _ := syscall.UTF16PtrFromString(name)
+		handle, _, _ = registerServiceCtrlHandlerEx.Call(uintptr(unsafe.Pointer(serviceName)), handler, 0)
+		report(serviceStartPending)
+		serviceReady = func() { report(serviceRunning) }
+		code = serviceCommands[args[0]](args[1:])
+		report(serviceStopped)
+		return 0
+	})
+
+	serviceName, _ := syscall.UTF16PtrFromString(name)
+	table := []serviceTableEntry{{name: serviceName, proc: main}, {}}
+	if ok, _, err := startServiceCtrlDispatcher.Call(uintptr(unsafe.Pointer(&table[0]))); ok == 0 {
+		fmt.Printf("Error: not started by the service manager: %v\n", err)
+		return 1
+	}
+	return code
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sidecarSuffixes are the companion checksum file extensions looked for next
+// to a file, strongest first
+var sidecarSuffixes = []string{".sha512", ".sha512sum", ".sha256", ".sha256sum", ".sha1", ".md5"}
+
+// sidecarPath returns the companion checksum file of path, such as app.iso.sha256
+func sidecarPath(path string, algorithm HashAlgorithm) string {
+	return path + "." + string(algorithm)
+}
+
+// WriteSidecar writes the digest of a file next to it in sha256sum format, so
+// `sha256sum -c` run in its directory verifies it
+func WriteSidecar(path string, algorithm HashAlgorithm, digest string) error {
+	return writeSidecarFile(sidecarPath(path, algorithm), filepath.Base(path), digest)
+}
+
+// writeSidecarFile writes a one-line checksum file for the file name, escaping
+// it as GNU tools do
+func writeSidecarFile(sidecar, name, digest string) error {
+	return os.WriteFile(sidecar, []byte(checksumLine(digest, name, false)), 0644)
+}
+
+// MoveWithSidecars renames a file together with its sidecars, rewriting the
+// file name they record when it changes, and returns the new sidecar paths.
+// As with mv, a file moved onto a directory keeps its name. A directory is
+// renamed as it is, since the sidecars inside record base names only.
+func MoveWithSidecars(from, to string) ([]string, error) {
+	info, err := os.Stat(from)
+	if err != nil {
+		return nil, err
+	}
+	if target, err := os.Stat(to); err == nil && target.IsDir() {
+		to = filepath.Join(to, filepath.Base(from))
+	}
+	if info.IsDir() {
+		return nil, os.Rename(from, to)
+	}
+
+	// Read the sidecars first, so one that lists no checksum stops the move
+	type sidecar struct{ from, to, digest string }
+	var sidecars []sidecar
+	for _, suffix := range sidecarSuffixes {
+		data, err := os.ReadFile(from + suffix)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		_, digest, ok := lookupChecksum(data, filepath.Base(from+suffix), filepath.Base(from))
+		if !ok {
+			return nil, fmt.Errorf("%s lists no checksum for %s", from+suffix, filepath.Base(from))
+		}
+		sidecars = append(sidecars, sidecar{from + suffix, to + suffix, digest})
+	}
+
+	if err := os.Rename(from, to); err != nil {
+		return nil, err
+	}
+	var moved []string
+	for _, s := range sidecars {
+		if err := writeSidecarFile(s.to, filepath.Base(to), s.digest); err != nil {
+			return moved, err
+		}
+		if err := os.Remove(s.from); err != nil {
+			return moved, err
+		}
+		moved = append(moved, s.to)
+	}
+	return moved, nil
+}
+
+// SidecarCheck is the result of verifying a file against one sidecar
+type SidecarCheck struct {
+	Path      string
+	Sidecar   string
+	Algorithm HashAlgorithm
+	Expected  string
+	Actual    string
+	Status    string // OK, FAILED or MISSING
+	Err       error
+}
+
+// FindSidecars maps the files below paths to their sidecars, in the order
+// the files are listed. Sidecars inside the listing are matched to the file
+// they are named after, and files given or listed are probed for sidecars
+// next to them. The last result counts the files without any sidecar.
+func FindSidecars(paths []string) ([]string, map[string][]string, int, error) {
+	var targets []string
+	sidecars := map[string][]string{}
+	seen := map[string]bool{}
+	add := func(target, sidecar string) {
+		if seen[sidecar] {
+			return
+		}
+		seen[sidecar] = true
+		if sidecars[target] == nil {
+			targets = append(targets, target)
+		}
+		sidecars[target] = append(sidecars[target], sidecar)
+	}
+
+	var plain []string
+	for _, root := range paths {
+		list, err := listFiles(root)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		for _, path := range list {
+			if digestSuffix(path) != "" {
+				add(strings.TrimSuffix(path, filepath.Ext(path)), path)
+				continue
+			}
+			plain = append(plain, path)
+		}
+	}
+	unchecked := 0
+	for _, path := range plain {
+		for _, suffix := range sidecarSuffixes {
+			if info, err := os.Stat(path + suffix); err == nil && info.Mode().IsRegular() {
+				add(path, path+suffix)
+			}
+		}
+		if sidecars[path] == nil {
+			unchecked++
+		}
+	}
+	return targets, sidecars, unchecked, nil
+}
+
+// VerifySidecars checks each file against its sidecars, hashing it once for
+// all of their algorithms
+func VerifySidecars(targets []string, sidecars map[string][]string, calculator *HashCalculator) []SidecarCheck {
+	var checks []SidecarCheck
+	for _, target := range targets {
+		var pending []SidecarCheck
+		var algorithms []HashAlgorithm
+		for _, sidecar := range sidecars[target] {
+			check := SidecarCheck{Path: target, Sidecar: sidecar, Status: "FAILED"}
+			data, err := os.ReadFile(sidecar)
+			if err != nil {
+				check.Err = err
+				checks = append(checks, check)
+				continue
+			}
+			alg, digest, ok := lookupChecksum(data, filepath.Base(sidecar), filepath.Base(target))
+			if !ok {
+				check.Err = fmt.Errorf("%s lists no checksum for %s", filepath.Base(sidecar), filepath.Base(target))
+				checks = append(checks, check)
+				continue
+			}
+			check.Algorithm, check.Expected = alg, digest
+			pending = append(pending, check)
+			if !containsAlgorithm(algorithms, alg) {
+				algorithms = append(algorithms, alg)
+			}
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		results, err := calculator.CalculateFileDigests(target, algorithms, nil)
+		for _, check := range pending {
+			switch {
+			case errors.Is(err, os.ErrNotExist):
+				check.Status = "MISSING"
+			case err != nil:
+				check.Err = err
+			default:
+				for _, result := range results {
+					if result.Algorithm == check.Algorithm {
+						check.Actual = result.Hash
+					}
+				}
+				if check.Actual == check.Expected {
+					check.Status = "OK"
+				}
+			}
+			checks = append(checks, check)
+		}
+	}
+	return checks
+}
+
+// containsAlgorithm reports whether algorithm is in algorithms
+func containsAlgorithm(algorithms []HashAlgorithm, algorithm HashAlgorithm) bool {
+	for _, a := range algorithms {
+		if a == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// runSidecar implements the sidecar command
+func runSidecar(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate sidecar write <path>... [-a sha256] [-force]")
+		fmt.Println("       hashculate sidecar verify <path>... [-quiet]")
+		fmt.Println("       hashculate sidecar mv <old> <new>")
+		return 1
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+	action := args[0]
+	fs := flag.NewFlagSet("sidecar "+action, flag.ExitOnError)
+	switch action {
+	case "write":
+		algorithm := fs.String("a", "sha256", "Hash algorithm")
+		force := fs.Bool("force", false, "Replace existing sidecars")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) == 0 {
+			return usage()
+		}
+		alg, err := parseAlgorithm(*algorithm)
+		if err == nil && alg == CIDV1 {
+			err = fmt.Errorf("sidecars hold hex digests, not cidv1")
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		calculator := NewHashCalculator()
+		written, skipped := 0, 0
+		for _, root := range positional {
+			list, err := listFiles(root)
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				return 1
+			}
+			for _, path := range list {
+				if digestSuffix(path) != "" {
+					continue
+				}
+				// An existing sidecar records an earlier state that verify can still compare with
+				if _, err := os.Stat(sidecarPath(path, alg)); err == nil && !*force {
+					fmt.Printf("%s: exists, skipped\n", sidecarPath(path, alg))
+					skipped++
+					continue
+				}
+				result, err := calculator.CalculateFileHash(path, alg, nil)
+				if err == nil {
+					err = WriteSidecar(path, alg, result.Hash)
+				}
+				if err != nil {
+					fmt.Printf("Error: %v\n", err)
+					return 1
+				}
+				fmt.Printf("%s  %s\n", result.Hash, sidecarPath(path, alg))
+				written++
+			}
+		}
+		fmt.Println()
+		fmt.Printf("%d sidecar(s) written, %d skipped\n", written, skipped)
+		return 0
+
+	case "mv":
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 2 {
+			return usage()
+		}
+		moved, err := MoveWithSidecars(positional[0], positional[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		for _, sidecar := range moved {
+			fmt.Printf("Moved %s\n", sidecar)
+		}
+		return 0
+
+	case "verify":
+		quiet := fs.Bool("quiet", false, "Only print files that did not verify")
+		positional := parseFlags(fs, args[1:])
+		if len(positional) == 0 {
+			return usage()
+		}
+		targets, sidecars, unchecked, err := FindSidecars(positional)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		counts := map[string]int{}
+		for _, check := range VerifySidecars(targets, sidecars, NewHashCalculator()) {
+			counts[check.Status]++
+			if *quiet && check.Status == "OK" {
+				continue
+			}
+			switch {
+			case check.Err != nil:
+				fmt.Printf("%s: FAILED (%v)\n", check.Path, check.Err)
+			case check.Status == "FAILED":
+				fmt.Printf("%s: FAILED %s expected %s, got %s\n", check.Path, getAlgorithmName(check.Algorithm), check.Expected, check.Actual)
+			default:
+				fmt.Printf("%s: %s (%s)\n", check.Path, check.Status, filepath.Base(check.Sidecar))
+			}
+		}
+		fmt.Println()
+		fmt.Printf("%d OK, %d mismatched, %d missing, %d file(s) without a sidecar\n",
+			counts["OK"], counts["FAILED"], counts["MISSING"], unchecked)
+		if counts["FAILED"] > 0 || counts["MISSING"] > 0 {
+			return 1
+		}
+		return 0
+	}
+	return usage()
+}
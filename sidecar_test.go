@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSidecars(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	for _, name := range []string{"app.iso", "sub/notes.txt", "sub/gone.bin", "plain"} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(name), 0644)
+		if name == "plain" {
+			continue
+		}
+		result, err := NewHashCalculator().CalculateFileHash(path, SHA256, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := WriteSidecar(path, SHA256, result.Hash); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "app.iso.sha256"))
+	if want := "  app.iso\n"; len(data) != 64+len(want) || string(data[64:]) != want {
+		t.Errorf("unexpected sidecar %q", data)
+	}
+
+	os.WriteFile(filepath.Join(dir, "app.iso"), []byte("tampered"), 0644)
+	os.Remove(filepath.Join(dir, "sub", "gone.bin"))
+	targets, sidecars, unchecked, err := FindSidecars([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 3 || unchecked != 1 {
+		t.Fatalf("expected 3 files with sidecars and 1 without, got %v and %d", targets, unchecked)
+	}
+	statuses := map[string]string{}
+	for _, check := range VerifySidecars(targets, sidecars, NewHashCalculator()) {
+		rel, _ := filepath.Rel(dir, check.Path)
+		statuses[filepath.ToSlash(rel)] = check.Status
+	}
+	if statuses["app.iso"] != "FAILED" || statuses["sub/notes.txt"] != "OK" || statuses["sub/gone.bin"] != "MISSING" {
+		t.Errorf("unexpected statuses %v", statuses)
+	}
+
+	// A file given directly is checked against the sidecar beside it
+	targets, _, _, _ = FindSidecars([]string{filepath.Join(dir, "sub", "notes.txt")})
+	if len(targets) != 1 {
+		t.Errorf("sidecar next to a given file not found: %v", targets)
+	}
+
+	// Moving a file takes its sidecars along and rewrites the name they record
+	moved, err := MoveWithSidecars(filepath.Join(dir, "sub", "notes.txt"), filepath.Join(dir, "README"))
+	if err != nil || len(moved) != 1 {
+		t.Fatalf("move: %v, %v", moved, err)
+	}
+	targets, sidecars, _, _ = FindSidecars([]string{filepath.Join(dir, "README")})
+	if checks := VerifySidecars(targets, sidecars, NewHashCalculator()); len(checks) != 1 || checks[0].Status != "OK" {
+		t.Errorf("moved file does not verify: %+v", checks)
+	}
+}
@@ -0,0 +1,676 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Fulcio certificate extensions carrying the OIDC issuer
+var (
+	oidFulcioIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidFulcioIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// sigstoreBundle is the JSON form of a Sigstore bundle (v0.1 to v0.3)
+type sigstoreBundle struct {
+	MediaType            string `json:"mediaType"`
+	VerificationMaterial struct {
+		Certificate *struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain *struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []sigstoreTlogEntry `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature *struct {
+		MessageDigest struct {
+			Algorithm string `json:"algorithm"`
+			Digest    []byte `json:"digest"`
+		} `json:"messageDigest"`
+		Signature []byte `json:"signature"`
+	} `json:"messageSignature"`
+	DSSEEnvelope *struct {
+		Payload     []byte `json:"payload"`
+		PayloadType string `json:"payloadType"`
+		Signatures  []struct {
+			Sig []byte `json:"sig"`
+		} `json:"signatures"`
+	} `json:"dsseEnvelope"`
+}
+
+type sigstoreTlogEntry struct {
+	LogIndex string `json:"logIndex"`
+	LogID    struct {
+		KeyID []byte `json:"keyId"`
+	} `json:"logId"`
+	IntegratedTime   string `json:"integratedTime"`
+	InclusionPromise *struct {
+		SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+	} `json:"inclusionPromise"`
+	InclusionProof *struct {
+		LogIndex string   `json:"logIndex"`
+		RootHash []byte   `json:"rootHash"`
+		TreeSize string   `json:"treeSize"`
+		Hashes   [][]byte `json:"hashes"`
+	} `json:"inclusionProof"`
+	CanonicalizedBody []byte `json:"canonicalizedBody"`
+}
+
+// legacyCosignBundle is the bundle written by older `cosign sign-blob --bundle`
+type legacyCosignBundle struct {
+	Base64Signature string `json:"base64Signature"`
+	Cert            string `json:"cert"`
+	RekorBundle     struct {
+		SignedEntryTimestamp []byte `json:"SignedEntryTimestamp"`
+		Payload              struct {
+			Body           string `json:"body"`
+			IntegratedTime int64  `json:"integratedTime"`
+			LogIndex       int64  `json:"logIndex"`
+			LogID          string `json:"logID"`
+		} `json:"Payload"`
+	} `json:"rekorBundle"`
+}
+
+// sigstoreTrustedRoot is the subset of a Sigstore trusted_root.json used for verification
+type sigstoreTrustedRoot struct {
+	Tlogs []struct {
+		PublicKey struct {
+			RawBytes []byte `json:"rawBytes"`
+		} `json:"publicKey"`
+		LogID struct {
+			KeyID []byte `json:"keyId"`
+		} `json:"logId"`
+	} `json:"tlogs"`
+	CertificateAuthorities []struct {
+		CertChain struct {
+			Certificates []struct {
+				RawBytes []byte `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"certChain"`
+	} `json:"certificateAuthorities"`
+}
+
+// signedArtifact is a bundle normalized across formats
+type signedArtifact struct {
+	Certificate   *x509.Certificate
+	Intermediates []*x509.Certificate
+	Signature     []byte
+	Digest        []byte // message digest signed, when a message signature is used
+	Payload       []byte // DSSE payload, when an envelope is used
+	PayloadType   string
+	Tlog          *tlogEntry
+}
+
+// tlogEntry is a normalized Rekor transparency log entry
+type tlogEntry struct {
+	Body           []byte
+	IntegratedTime int64
+	LogIndex       int64
+	LogID          []byte
+	SET            []byte
+	Proof          *merkleProof
+}
+
+// merkleProof is an RFC 6962 inclusion proof
+type merkleProof struct {
+	LogIndex int64
+	TreeSize int64
+	RootHash []byte
+	Hashes   [][]byte
+}
+
+// SigstorePolicy describes the identity an artifact must be signed by
+type SigstorePolicy struct {
+	Identity       string
+	IdentityRegexp string
+	OIDCIssuer     string
+}
+
+// SigstoreVerification describes a successfully verified artifact signature
+type SigstoreVerification struct {
+	Identity       string
+	Issuer         string
+	LogIndex       int64
+	IntegratedTime time.Time
+}
+
+// parseSigstoreBundle reads either a Sigstore bundle or a legacy cosign bundle
+func parseSigstoreBundle(data []byte) (*signedArtifact, error) {
+	var bundle sigstoreBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid bundle: %w", err)
+	}
+	if bundle.MediaType == "" {
+		return parseLegacyCosignBundle(data)
+	}
+
+	artifact := &signedArtifact{}
+	var ders [][]byte
+	if material := bundle.VerificationMaterial; material.Certificate != nil {
+		ders = append(ders, material.Certificate.RawBytes)
+	} else if material.X509CertificateChain != nil {
+		for _, cert := range material.X509CertificateChain.Certificates {
+			ders = append(ders, cert.RawBytes)
+		}
+	}
+	if len(ders) == 0 {
+		return nil, fmt.Errorf("bundle has no signing certificate (public key bundles are not supported)")
+	}
+	for i, der := range ders {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bundle certificate: %w", err)
+		}
+		if i == 0 {
+			artifact.Certificate = cert
+		} else {
+			artifact.Intermediates = append(artifact.Intermediates, cert)
+		}
+	}
+
+	switch {
+	case bundle.MessageSignature != nil:
+		if bundle.MessageSignature.MessageDigest.Algorithm != "SHA2_256" {
+			return nil, fmt.Errorf("unsupported bundle digest algorithm %s", bundle.MessageSignature.MessageDigest.Algorithm)
+		}
+		artifact.Digest = bundle.MessageSignature.MessageDigest.Digest
+		artifact.Signature = bundle.MessageSignature.Signature
+	case bundle.DSSEEnvelope != nil:
+		if len(bundle.DSSEEnvelope.Signatures) != 1 {
+			return nil, fmt.Errorf("expected exactly one DSSE signature, found %d", len(bundle.DSSEEnvelope.Signatures))
+		}
+		artifact.Payload = bundle.DSSEEnvelope.Payload
+		artifact.PayloadType = bundle.DSSEEnvelope.PayloadType
+		artifact.Signature = bundle.DSSEEnvelope.Signatures[0].Sig
+	default:
+		return nil, fmt.Errorf("bundle has neither a message signature nor a DSSE envelope")
+	}
+
+	if len(bundle.VerificationMaterial.TlogEntries) > 0 {
+		entry := bundle.VerificationMaterial.TlogEntries[0]
+		tlog := &tlogEntry{Body: entry.CanonicalizedBody, LogID: entry.LogID.KeyID}
+		var err error
+		if tlog.IntegratedTime, err = strconv.ParseInt(entry.IntegratedTime, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid tlog integrated time: %w", err)
+		}
+		if tlog.LogIndex, err = strconv.ParseInt(entry.LogIndex, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid tlog index: %w", err)
+		}
+		if entry.InclusionPromise != nil {
+			tlog.SET = entry.InclusionPromise.SignedEntryTimestamp
+		}
+		if p := entry.InclusionProof; p != nil {
+			proof := &merkleProof{RootHash: p.RootHash, Hashes: p.Hashes}
+			proof.LogIndex, _ = strconv.ParseInt(p.LogIndex, 10, 64)
+			proof.TreeSize, _ = strconv.ParseInt(p.TreeSize, 10, 64)
+			tlog.Proof = proof
+		}
+		artifact.Tlog = tlog
+	}
+	return artifact, nil
+}
+
+// parseLegacyCosignBundle reads the pre-Sigstore-bundle cosign format
+func parseLegacyCosignBundle(data []byte) (*signedArtifact, error) {
+	var legacy legacyCosignBundle
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		return nil, fmt.Errorf("invalid cosign bundle: %w", err)
+	}
+	if legacy.Base64Signature == "" || legacy.Cert == "" {
+		return nil, fmt.Errorf("unrecognized bundle format")
+	}
+	signature, err := base64.StdEncoding.DecodeString(legacy.Base64Signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle signature: %w", err)
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(legacy.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("invalid bundle certificate: not PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle certificate: %w", err)
+	}
+	body, err := base64.StdEncoding.DecodeString(legacy.RekorBundle.Payload.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tlog body: %w", err)
+	}
+	logID, err := hex.DecodeString(legacy.RekorBundle.Payload.LogID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tlog log ID: %w", err)
+	}
+	return &signedArtifact{
+		Certificate: cert,
+		Signature:   signature,
+		Tlog: &tlogEntry{
+			Body:           body,
+			IntegratedTime: legacy.RekorBundle.Payload.IntegratedTime,
+			LogIndex:       legacy.RekorBundle.Payload.LogIndex,
+			LogID:          logID,
+			SET:            legacy.RekorBundle.SignedEntryTimestamp,
+		},
+	}, nil
+}
+
+// loadTrustedRoot reads Fulcio roots and Rekor keys from a trusted_root.json
+func loadTrustedRoot(path string) (*x509.CertPool, *x509.CertPool, map[string]crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read trusted root: %w", err)
+	}
+	var root sigstoreTrustedRoot
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid trusted root: %w", err)
+	}
+
+	roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+	for _, ca := range root.CertificateAuthorities {
+		chain := ca.CertChain.Certificates
+		for i, raw := range chain {
+			cert, err := x509.ParseCertificate(raw.RawBytes)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("invalid CA certificate in trusted root: %w", err)
+			}
+			// Chains are ordered leaf-most first and end with the root
+			if i == len(chain)-1 {
+				roots.AddCert(cert)
+			} else {
+				intermediates.AddCert(cert)
+			}
+		}
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, tlog := range root.Tlogs {
+		key, err := x509.ParsePKIXPublicKey(tlog.PublicKey.RawBytes)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid transparency log key in trusted root: %w", err)
+		}
+		keys[hex.EncodeToString(tlog.LogID.KeyID)] = key
+	}
+	return roots, intermediates, keys, nil
+}
+
+// verifyWithKey checks a signature over digest (the SHA-256 of the signed message)
+func verifyWithKey(key crypto.PublicKey, digest, message, signature []byte) error {
+	switch pub := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest, signature) {
+			return fmt.Errorf("ECDSA signature verification failed")
+		}
+		return nil
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest, signature)
+	case ed25519.PublicKey:
+		if message == nil {
+			return fmt.Errorf("ed25519 signatures over a prehashed digest are not supported")
+		}
+		if !ed25519.Verify(pub, message, signature) {
+			return fmt.Errorf("ed25519 signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// dssePAE returns the DSSE pre-authentication encoding of a payload
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// certificateIdentity returns the signer identity and OIDC issuer of a Fulcio certificate
+func certificateIdentity(cert *x509.Certificate) (string, string) {
+	identity := ""
+	switch {
+	case len(cert.EmailAddresses) > 0:
+		identity = cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		identity = cert.URIs[0].String()
+	}
+	issuer := ""
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidFulcioIssuerV2):
+			var value string
+			if _, err := asn1.Unmarshal(ext.Value, &value); err == nil {
+				issuer = value
+			}
+		case ext.Id.Equal(oidFulcioIssuerV1) && issuer == "":
+			issuer = string(ext.Value)
+		}
+	}
+	return identity, issuer
+}
+
+// verifySET checks the Rekor signed entry timestamp over the entry
+func verifySET(tlog *tlogEntry, keys map[string]crypto.PublicKey) error {
+	key, ok := keys[hex.EncodeToString(tlog.LogID)]
+	if !ok {
+		return fmt.Errorf("transparency log %x is not in the trusted root", tlog.LogID)
+	}
+	if len(tlog.SET) == 0 {
+		return fmt.Errorf("tlog entry has no signed entry timestamp")
+	}
+	// json.Marshal sorts map keys, which yields the canonical form Rekor signs
+	payload, err := json.Marshal(map[string]any{
+		"body":           base64.StdEncoding.EncodeToString(tlog.Body),
+		"integratedTime": tlog.IntegratedTime,
+		"logIndex":       tlog.LogIndex,
+		"logID":          hex.EncodeToString(tlog.LogID),
+	})
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(payload)
+	if err := verifyWithKey(key, sum[:], payload, tlog.SET); err != nil {
+		return fmt.Errorf("invalid signed entry timestamp: %w", err)
+	}
+	return nil
+}
+
+// verifyInclusion recomputes the RFC 6962 Merkle root from an inclusion proof
+func verifyInclusion(proof *merkleProof, body []byte) error {
+	if proof.LogIndex < 0 || proof.LogIndex >= proof.TreeSize {
+		return fmt.Errorf("inclusion proof index %d outside tree of size %d", proof.LogIndex, proof.TreeSize)
+	}
+	leaf := sha256.Sum256(append([]byte{0x00}, body...))
+	hash := leaf[:]
+	node := func(left, right []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte{0x01}, left...), right...))
+		return sum[:]
+	}
+
+	index, last := proof.LogIndex, proof.TreeSize-1
+	for _, sibling := range proof.Hashes {
+		if last == 0 {
+			return fmt.Errorf("inclusion proof has too many hashes")
+		}
+		if index%2 == 1 || index == last {
+			hash = node(sibling, hash)
+			for index%2 == 0 && index != 0 {
+				index >>= 1
+				last >>= 1
+			}
+		} else {
+			hash = node(hash, sibling)
+		}
+		index >>= 1
+		last >>= 1
+	}
+	if last != 0 {
+		return fmt.Errorf("inclusion proof has too few hashes")
+	}
+	if !bytes.Equal(hash, proof.RootHash) {
+		return fmt.Errorf("inclusion proof does not match root hash")
+	}
+	return nil
+}
+
+// verifyTlogBody checks that the Rekor entry records this artifact, signature and certificate
+func verifyTlogBody(body []byte, artifact *signedArtifact, digest []byte) error {
+	var entry struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+			PayloadHash struct {
+				Value string `json:"value"`
+			} `json:"payloadHash"`
+			Signatures []struct {
+				Signature []byte `json:"signature"`
+				Verifier  []byte `json:"verifier"`
+			} `json:"signatures"`
+			Content struct {
+				PayloadHash struct {
+					Value string `json:"value"`
+				} `json:"payloadHash"`
+				Envelope struct {
+					Signatures []struct {
+						Sig       []byte `json:"sig"`
+						PublicKey []byte `json:"publicKey"`
+					} `json:"signatures"`
+				} `json:"envelope"`
+			} `json:"content"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return fmt.Errorf("invalid tlog entry body: %w", err)
+	}
+
+	// Each kind records the artifact hash alongside the signature and the key that made it
+	var want, got string
+	var signature, verifier []byte
+	switch entry.Kind {
+	case "hashedrekord":
+		want, got = hex.EncodeToString(digest), entry.Spec.Data.Hash.Value
+		signature, verifier = entry.Spec.Signature.Content, entry.Spec.Signature.PublicKey.Content
+	case "dsse":
+		sum := sha256.Sum256(artifact.Payload)
+		want, got = hex.EncodeToString(sum[:]), entry.Spec.PayloadHash.Value
+		if len(entry.Spec.Signatures) != 1 {
+			return fmt.Errorf("expected exactly one signature in the tlog entry, found %d", len(entry.Spec.Signatures))
+		}
+		signature, verifier = entry.Spec.Signatures[0].Signature, entry.Spec.Signatures[0].Verifier
+	case "intoto":
+		sum := sha256.Sum256(artifact.Payload)
+		want, got = hex.EncodeToString(sum[:]), entry.Spec.Content.PayloadHash.Value
+		signatures := entry.Spec.Content.Envelope.Signatures
+		if len(signatures) != 1 {
+			return fmt.Errorf("expected exactly one signature in the tlog entry, found %d", len(signatures))
+		}
+		// intoto entries encode the already base64 envelope signature a second time
+		sig, err := base64.StdEncoding.DecodeString(string(signatures[0].Sig))
+		if err != nil {
+			return fmt.Errorf("invalid tlog entry signature: %w", err)
+		}
+		signature, verifier = sig, signatures[0].PublicKey
+	default:
+		return fmt.Errorf("unsupported tlog entry kind %q", entry.Kind)
+	}
+	if want != got {
+		return fmt.Errorf("transparency log entry records %s, not this artifact", got)
+	}
+	if !bytes.Equal(signature, artifact.Signature) {
+		return fmt.Errorf("transparency log entry records a different signature")
+	}
+	return verifyTlogVerifier(verifier, artifact.Certificate)
+}
+
+// verifyTlogVerifier checks that a PEM certificate or public key from a Rekor entry is the signing certificate's
+func verifyTlogVerifier(verifier []byte, cert *x509.Certificate) error {
+	block, _ := pem.Decode(verifier)
+	if block == nil {
+		return fmt.Errorf("transparency log entry has no PEM certificate or public key")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		if !bytes.Equal(block.Bytes, cert.Raw) {
+			return fmt.Errorf("transparency log entry records a different certificate")
+		}
+	case "PUBLIC KEY":
+		if !bytes.Equal(block.Bytes, cert.RawSubjectPublicKeyInfo) {
+			return fmt.Errorf("transparency log entry records a different public key")
+		}
+	default:
+		return fmt.Errorf("unsupported PEM type %q in transparency log entry", block.Type)
+	}
+	return nil
+}
+
+// VerifySigstoreBundle verifies that a Sigstore bundle signs the artifact digest,
+// was issued to the expected identity, and was recorded in a trusted log.
+func VerifySigstoreBundle(bundleData []byte, digest []byte, policy SigstorePolicy, trustedRootPath string) (*SigstoreVerification, error) {
+	artifact, err := parseSigstoreBundle(bundleData)
+	if err != nil {
+		return nil, err
+	}
+	roots, intermediates, tlogKeys, err := loadTrustedRoot(trustedRootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature must cover the artifact digest
+	key := artifact.Certificate.PublicKey
+	if artifact.Payload != nil {
+		var statement InTotoStatement
+		if err := json.Unmarshal(artifact.Payload, &statement); err != nil {
+			return nil, fmt.Errorf("invalid DSSE payload: %w", err)
+		}
+		covered := false
+		for _, subject := range statement.Subject {
+			if subject.Digest["sha256"] == hex.EncodeToString(digest) {
+				covered = true
+			}
+		}
+		if !covered {
+			return nil, fmt.Errorf("attestation has no subject with the artifact digest")
+		}
+		pae := dssePAE(artifact.PayloadType, artifact.Payload)
+		sum := sha256.Sum256(pae)
+		if err := verifyWithKey(key, sum[:], pae, artifact.Signature); err != nil {
+			return nil, fmt.Errorf("invalid DSSE signature: %w", err)
+		}
+	} else {
+		if artifact.Digest != nil && !bytes.Equal(artifact.Digest, digest) {
+			return nil, fmt.Errorf("bundle signs digest %x, artifact has %x", artifact.Digest, digest)
+		}
+		if err := verifyWithKey(key, digest, nil, artifact.Signature); err != nil {
+			return nil, fmt.Errorf("invalid artifact signature: %w", err)
+		}
+	}
+
+	// The transparency log proves when the short-lived certificate was used
+	if artifact.Tlog == nil {
+		return nil, fmt.Errorf("bundle has no transparency log entry")
+	}
+	if err := verifySET(artifact.Tlog, tlogKeys); err != nil {
+		return nil, err
+	}
+	if artifact.Tlog.Proof != nil {
+		if err := verifyInclusion(artifact.Tlog.Proof, artifact.Tlog.Body); err != nil {
+			return nil, err
+		}
+	}
+	if err := verifyTlogBody(artifact.Tlog.Body, artifact, digest); err != nil {
+		return nil, err
+	}
+	integrated := time.Unix(artifact.Tlog.IntegratedTime, 0).UTC()
+
+	for _, cert := range artifact.Intermediates {
+		intermediates.AddCert(cert)
+	}
+	if _, err := artifact.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   integrated,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	}); err != nil {
+		return nil, fmt.Errorf("signing certificate not trusted: %w", err)
+	}
+
+	identity, issuer := certificateIdentity(artifact.Certificate)
+	if policy.Identity != "" && identity != policy.Identity {
+		return nil, fmt.Errorf("certificate identity %q does not match %q", identity, policy.Identity)
+	}
+	if policy.IdentityRegexp != "" {
+		re, err := regexp.Compile(policy.IdentityRegexp)
+		if err != nil {
+			return nil, fmt.Errorf("invalid identity regexp: %w", err)
+		}
+		if !re.MatchString(identity) {
+			return nil, fmt.Errorf("certificate identity %q does not match %q", identity, policy.IdentityRegexp)
+		}
+	}
+	if policy.OIDCIssuer != "" && issuer != policy.OIDCIssuer {
+		return nil, fmt.Errorf("certificate issuer %q does not match %q", issuer, policy.OIDCIssuer)
+	}
+
+	return &SigstoreVerification{
+		Identity:       identity,
+		Issuer:         issuer,
+		LogIndex:       artifact.Tlog.LogIndex,
+		IntegratedTime: integrated,
+	}, nil
+}
+
+// runVerifyAttestation implements the verify-attestation command
+func runVerifyAttestation(args []string) int {
+	fs := flag.NewFlagSet("verify-attestation", flag.ExitOnError)
+	bundlePath := fs.String("bundle", "", "Sigstore bundle [default: <artifact>.sigstore.json]")
+	trustedRoot := fs.String("trusted-root", "", "Sigstore trusted_root.json with Fulcio and Rekor keys")
+	identity := fs.String("certificate-identity", "", "Expected signer identity (email or URI)")
+	identityRegexp := fs.String("certificate-identity-regexp", "", "Regular expression the signer identity must match")
+	issuer := fs.String("certificate-oidc-issuer", "", "Expected OIDC issuer of the signer")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || *trustedRoot == "" || (*identity == "" && *identityRegexp == "") || *issuer == "" {
+		fmt.Println("Usage: hashculate verify-attestation <artifact> -trusted-root <trusted_root.json>")
+		fmt.Println("         (-certificate-identity <id> | -certificate-identity-regexp <re>)")
+		fmt.Println("         -certificate-oidc-issuer <url> [-bundle <bundle.json>]")
+		return 1
+	}
+	artifactPath := positional[0]
+	if *bundlePath == "" {
+		*bundlePath = artifactPath + ".sigstore.json"
+	}
+
+	bundleData, err := os.ReadFile(*bundlePath)
+	if err != nil {
+		fmt.Printf("Error: failed to read bundle: %v\n", err)
+		return 1
+	}
+	result, err := NewHashCalculator().CalculateFileHash(artifactPath, SHA256, nil)
+	if err != nil {
+		fmt.Printf("Error calculating hash: %v\n", err)
+		return 1
+	}
+	digest, _ := hex.DecodeString(result.Hash)
+
+	verification, err := VerifySigstoreBundle(bundleData, digest, SigstorePolicy{
+		Identity:       *identity,
+		IdentityRegexp: *identityRegexp,
+		OIDCIssuer:     *issuer,
+	}, *trustedRoot)
+	if err != nil {
+		fmt.Printf("FAILED: %s: %v\n", artifactPath, err)
+		return 1
+	}
+	fmt.Printf("OK: %s (SHA-256 %s)\n", artifactPath, result.Hash)
+	fmt.Printf("Signed by: %s\n", verification.Identity)
+	fmt.Printf("Issuer: %s\n", verification.Issuer)
+	fmt.Printf("Transparency log index: %d (integrated %s)\n", verification.LogIndex, verification.IntegratedTime.Format(time.RFC3339))
+	return 0
+}
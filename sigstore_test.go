@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sigstoreFixture is a fake Fulcio CA and Rekor log that can sign artifacts
+type sigstoreFixture struct {
+	trustedRoot string
+	caCert      *x509.Certificate
+	caKey       *ecdsa.PrivateKey
+	rekorKey    *ecdsa.PrivateKey
+	rekorID     []byte
+}
+
+func newSigstoreFixture(t *testing.T) *sigstoreFixture {
+	t.Helper()
+	f := &sigstoreFixture{}
+	f.caKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	f.rekorKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &f.caKey.PublicKey, f.caKey)
+	f.caCert, _ = x509.ParseCertificate(der)
+
+	rekorDER, _ := x509.MarshalPKIXPublicKey(&f.rekorKey.PublicKey)
+	id := sha256.Sum256(rekorDER)
+	f.rekorID = id[:]
+
+	root := map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.trustedroot+json;version=0.1",
+		"tlogs": []any{map[string]any{
+			"publicKey": map[string]any{"rawBytes": rekorDER},
+			"logId":     map[string]any{"keyId": f.rekorID},
+		}},
+		"certificateAuthorities": []any{map[string]any{
+			"certChain": map[string]any{"certificates": []any{map[string]any{"rawBytes": f.caCert.Raw}}},
+		}},
+	}
+	data, _ := json.Marshal(root)
+	f.trustedRoot = filepath.Join(t.TempDir(), "trusted_root.json")
+	os.WriteFile(f.trustedRoot, data, 0644)
+	return f
+}
+
+// sign returns a v0.3 bundle signing content as identity, with a two-leaf inclusion proof
+func (f *sigstoreFixture) sign(t *testing.T, content []byte, identity string) []byte {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	issuer, _ := asn1.MarshalWithParams("https://accounts.example.com", "utf8")
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       time.Now().Add(-time.Minute),
+		NotAfter:        time.Now().Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{identity},
+		ExtraExtensions: []pkix.Extension{{Id: oidFulcioIssuerV2, Value: issuer}},
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, f.caCert, &key.PublicKey, f.caKey)
+
+	digest := sha256.Sum256(content)
+	signature, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	body := []byte(fmt.Sprintf(`{"apiVersion":"0.0.1","kind":"hashedrekord","spec":{"data":{"hash":{"algorithm":"sha256","value":"%x"}},"signature":{"content":"%s","publicKey":{"content":"%s"}}}}`,
+		digest, base64.StdEncoding.EncodeToString(signature), base64.StdEncoding.EncodeToString(certPEM)))
+	integrated := time.Now().Unix()
+	setPayload, _ := json.Marshal(map[string]any{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": integrated,
+		"logIndex":       1,
+		"logID":          hex.EncodeToString(f.rekorID),
+	})
+	setDigest := sha256.Sum256(setPayload)
+	set, _ := ecdsa.SignASN1(rand.Reader, f.rekorKey, setDigest[:])
+
+	otherLeaf := sha256.Sum256([]byte{0x00, 'x'})
+	ourLeaf := sha256.Sum256(append([]byte{0x00}, body...))
+	rootHash := sha256.Sum256(append(append([]byte{0x01}, otherLeaf[:]...), ourLeaf[:]...))
+
+	bundle := map[string]any{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]any{
+			"certificate": map[string]any{"rawBytes": der},
+			"tlogEntries": []any{map[string]any{
+				"logIndex":          "1",
+				"logId":             map[string]any{"keyId": f.rekorID},
+				"integratedTime":    fmt.Sprint(integrated),
+				"inclusionPromise":  map[string]any{"signedEntryTimestamp": set},
+				"inclusionProof":    map[string]any{"logIndex": "1", "treeSize": "2", "rootHash": rootHash[:], "hashes": [][]byte{otherLeaf[:]}},
+				"canonicalizedBody": body,
+			}},
+		},
+		"messageSignature": map[string]any{
+			"messageDigest": map[string]any{"algorithm": "SHA2_256", "digest": digest[:]},
+			"signature":     signature,
+		},
+	}
+	data, _ := json.Marshal(bundle)
+	return data
+}
+
+func TestVerifySigstoreBundle(t *testing.T) {
+	f := newSigstoreFixture(t)
+	content := []byte("release artifact")
+	digest := sha256.Sum256(content)
+	bundle := f.sign(t, content, "dev@example.com")
+	policy := SigstorePolicy{Identity: "dev@example.com", OIDCIssuer: "https://accounts.example.com"}
+
+	verification, err := VerifySigstoreBundle(bundle, digest[:], policy, f.trustedRoot)
+	if err != nil {
+		t.Fatalf("Expected bundle to verify: %v", err)
+	}
+	if verification.Identity != "dev@example.com" || verification.LogIndex != 1 {
+		t.Errorf("Unexpected verification result: %+v", verification)
+	}
+
+	other := sha256.Sum256([]byte("tampered artifact"))
+	if _, err := VerifySigstoreBundle(bundle, other[:], policy, f.trustedRoot); err == nil {
+		t.Error("Expected failure for a different artifact digest")
+	}
+
+	wrongIdentity := SigstorePolicy{Identity: "attacker@example.com", OIDCIssuer: policy.OIDCIssuer}
+	if _, err := VerifySigstoreBundle(bundle, digest[:], wrongIdentity, f.trustedRoot); err == nil {
+		t.Error("Expected failure for a different signer identity")
+	}
+
+	regexpPolicy := SigstorePolicy{IdentityRegexp: `@example\.com$`, OIDCIssuer: policy.OIDCIssuer}
+	if _, err := VerifySigstoreBundle(bundle, digest[:], regexpPolicy, f.trustedRoot); err != nil {
+		t.Errorf("Expected identity regexp to match: %v", err)
+	}
+
+	// A bundle from an untrusted CA must be rejected
+	untrusted := newSigstoreFixture(t).sign(t, content, "dev@example.com")
+	if _, err := VerifySigstoreBundle(untrusted, digest[:], policy, f.trustedRoot); err == nil {
+		t.Error("Expected failure for a bundle signed by an untrusted CA and log")
+	}
+}
+
+func TestVerifySigstoreBundleSwappedCertificate(t *testing.T) {
+	f := newSigstoreFixture(t)
+	content := []byte("release artifact")
+	digest := sha256.Sum256(content)
+	policy := SigstorePolicy{IdentityRegexp: `@example\.com$`}
+
+	// Another signer's certificate and signature over the same artifact, with the first signer's log entry
+	var bundle, other map[string]any
+	json.Unmarshal(f.sign(t, content, "dev@example.com"), &bundle)
+	json.Unmarshal(f.sign(t, content, "attacker@example.com"), &other)
+	material := bundle["verificationMaterial"].(map[string]any)
+	material["certificate"] = other["verificationMaterial"].(map[string]any)["certificate"]
+	bundle["messageSignature"] = other["messageSignature"]
+	swapped, _ := json.Marshal(bundle)
+
+	_, err := VerifySigstoreBundle(swapped, digest[:], policy, f.trustedRoot)
+	if err == nil || !strings.Contains(err.Error(), "different signature") {
+		t.Errorf("Expected the log entry to reject another signer's signature, got %v", err)
+	}
+
+	// Only the certificate swapped: the signature no longer verifies
+	json.Unmarshal(f.sign(t, content, "dev@example.com"), &bundle)
+	bundle["verificationMaterial"].(map[string]any)["certificate"] = other["verificationMaterial"].(map[string]any)["certificate"]
+	swapped, _ = json.Marshal(bundle)
+	if _, err := VerifySigstoreBundle(swapped, digest[:], policy, f.trustedRoot); err == nil {
+		t.Error("Expected failure for a swapped certificate")
+	}
+}
+
+func TestVerifyTlogBodyCertificate(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	cert, _ := x509.ParseCertificate(der)
+	otherDER, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	digest := sha256.Sum256([]byte("artifact"))
+	artifact := &signedArtifact{Certificate: cert, Signature: []byte("sig")}
+	entry := func(verifier []byte) []byte {
+		return []byte(fmt.Sprintf(`{"kind":"hashedrekord","spec":{"data":{"hash":{"algorithm":"sha256","value":"%x"}},"signature":{"content":"%s","publicKey":{"content":"%s"}}}}`,
+			digest, base64.StdEncoding.EncodeToString([]byte("sig")), base64.StdEncoding.EncodeToString(verifier)))
+	}
+
+	if err := verifyTlogBody(entry(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), artifact, digest[:]); err != nil {
+		t.Errorf("Expected the recorded certificate to match: %v", err)
+	}
+	if err := verifyTlogBody(entry(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: cert.RawSubjectPublicKeyInfo})), artifact, digest[:]); err != nil {
+		t.Errorf("Expected the recorded public key to match: %v", err)
+	}
+	if err := verifyTlogBody(entry(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: otherDER})), artifact, digest[:]); err == nil {
+		t.Error("Expected failure for a different recorded certificate")
+	}
+}
+
+func TestParseLegacyCosignBundle(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	legacy := fmt.Sprintf(`{"base64Signature":"%s","cert":"%s","rekorBundle":{"SignedEntryTimestamp":"AAAA","Payload":{"body":"%s","integratedTime":1700000000,"logIndex":5,"logID":"abcd"}}}`,
+		base64.StdEncoding.EncodeToString([]byte("sig")),
+		base64.StdEncoding.EncodeToString(certPEM),
+		base64.StdEncoding.EncodeToString([]byte("{}")))
+	artifact, err := parseSigstoreBundle([]byte(legacy))
+	if err != nil {
+		t.Fatalf("Failed to parse legacy bundle: %v", err)
+	}
+	if artifact.Tlog.LogIndex != 5 || string(artifact.Signature) != "sig" {
+		t.Errorf("Unexpected legacy bundle contents: %+v", artifact.Tlog)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptySHA256 is the payload hash of a request without a body
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// awsCredentials sign S3 requests; without an access key requests are sent
+// unsigned, which public buckets accept
+type awsCredentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// awsCredentialsFromEnv reads the standard AWS_* credential variables
+func awsCredentialsFromEnv() awsCredentials {
+	return awsCredentials{
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// signV4 signs a request with AWS Signature Version 4 for the s3 service. A
+// request with a body must carry its SHA-256 in X-Amz-Content-Sha256. The
+// host and every header already set are signed, and the path and query are
+// rewritten in the canonical encoding that is signed.
+func (c awsCredentials) signV4(req *http.Request, region string, now time.Time) {
+	if c.AccessKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = emptySHA256
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+	if c.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.SessionToken)
+	}
+
+	req.URL.RawPath = awsURIEncode(req.URL.Path, false)
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var params []string
+	for _, k := range keys {
+		values := query[k]
+		sort.Strings(values)
+		for _, v := range values {
+			params = append(params, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	req.URL.RawQuery = strings.Join(params, "&")
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{req.Method, req.URL.RawPath, req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, payload}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := fmt.Sprintf("AWS4-HMAC-SHA256\n%s\n%s\n%x", amzDate, scope, sha256.Sum256([]byte(canonical)))
+
+	key := []byte("AWS4" + c.SecretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%x",
+		c.AccessKey, scope, signedHeaders, hmacSHA256(key, toSign)))
+}
+
+// hmacSHA256 computes HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsURIEncode percent-encodes everything but unreserved characters, and
+// slashes unless encodeSlash, as Signature Version 4 requires
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// awsRegion is the region requests are signed for when none is given
+func awsRegion() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+// s3Endpoint returns the URL of a bucket: virtual-hosted on AWS, or
+// path-style below a custom endpoint such as MinIO
+func s3Endpoint(bucket, endpoint, region string) (url.URL, error) {
+	if endpoint == "" {
+		return url.URL{Scheme: "https", Host: bucket + ".s3." + region + ".amazonaws.com", Path: "/"}, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return url.URL{}, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/"
+	return *u, nil
+}
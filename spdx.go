@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// spdxAlgorithms are the checksums emitted per file; SPDX 2.x requires SHA1
+var spdxAlgorithms = []HashAlgorithm{SHA1, SHA256, MD5}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxFile struct {
+	SPDXID    string         `json:"SPDXID"`
+	FileName  string         `json:"fileName"`
+	Checksums []spdxChecksum `json:"checksums"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+type spdxOutput struct {
+	SPDXVersion       string `json:"spdxVersion"`
+	DataLicense       string `json:"dataLicense"`
+	SPDXID            string `json:"SPDXID"`
+	Name              string `json:"name"`
+	DocumentNamespace string `json:"documentNamespace"`
+	CreationInfo      struct {
+		Created  string   `json:"created"`
+		Creators []string `json:"creators"`
+	} `json:"creationInfo"`
+	Files         []spdxFile         `json:"files"`
+	Relationships []spdxRelationship `json:"relationships"`
+}
+
+// spdxAlgorithmName returns the SPDX spelling of an algorithm
+func spdxAlgorithmName(algorithm HashAlgorithm) string {
+	return strings.ToUpper(string(algorithm))
+}
+
+// newUUID returns a random RFC 4122 version 4 UUID
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// WriteSPDX hashes every file below root and writes an SPDX 2.3 JSON document
+// describing them with SHA1, SHA256 and MD5 checksums
+func WriteSPDX(w io.Writer, root string, calculator *HashCalculator) error {
+	files, err := calculator.listFiles(root)
+	if err != nil {
+		return fmt.Errorf("failed to list files: %w", err)
+	}
+
+	name := filepath.Base(filepath.Clean(root))
+	doc := spdxOutput{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", name, newUUID()),
+		Files:             []spdxFile{},
+		Relationships:     []spdxRelationship{},
+	}
+	doc.CreationInfo.Created = time.Now().UTC().Format(time.RFC3339)
+	if deterministic {
+		doc.CreationInfo.Created = sourceDateEpoch().Format(time.RFC3339)
+	}
+	doc.CreationInfo.Creators = []string{"Tool: hashculate"}
+
+	for i, path := range files {
+		results, err := calculator.CalculateFileDigests(path, spdxAlgorithms, nil)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		file := spdxFile{
+			SPDXID:   fmt.Sprintf("SPDXRef-File-%d", i+1),
+			FileName: calculator.Paths.name(path, "./"+relativeSlashPath(root, path)),
+		}
+		for _, result := range results {
+			file.Checksums = append(file.Checksums, spdxChecksum{
+				Algorithm:     spdxAlgorithmName(result.Algorithm),
+				ChecksumValue: result.Hash,
+			})
+		}
+		doc.Files = append(doc.Files, file)
+		doc.Relationships = append(doc.Relationships, spdxRelationship{
+			SPDXElementID:      doc.SPDXID,
+			RelationshipType:   "DESCRIBES",
+			RelatedSPDXElement: file.SPDXID,
+		})
+	}
+
+	// The namespace must be unique per document, so a deterministic one is derived from the contents
+	if deterministic {
+		contents, _ := json.Marshal(doc.Files)
+		doc.DocumentNamespace = fmt.Sprintf("https://spdx.org/spdxdocs/%s-%s", name, contentUUID(contents))
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(doc)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteSPDXRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	os.WriteFile(filepath.Join(root, "a.txt"), []byte("alpha"), 0644)
+	os.WriteFile(filepath.Join(root, "sub", "b.txt"), []byte("beta"), 0644)
+
+	var buf bytes.Buffer
+	if err := WriteSPDX(&buf, root, NewHashCalculator()); err != nil {
+		t.Fatalf("WriteSPDX failed: %v", err)
+	}
+
+	// The generated document must verify against the same tree
+	entries, err := ParseSBOM(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Generated SPDX does not parse: %v", err)
+	}
+	if len(entries) != 2 || entries[1].Path != "./sub/b.txt" {
+		t.Fatalf("Unexpected entries: %+v", entries)
+	}
+	for _, alg := range spdxAlgorithms {
+		if entries[0].Checksums[alg] == "" {
+			t.Errorf("Missing %s checksum", alg)
+		}
+	}
+	for _, check := range VerifySBOM(entries, root, NewHashCalculator()) {
+		if check.Status != "OK" {
+			t.Errorf("%s: expected OK, got %s", check.Path, check.Status)
+		}
+	}
+}
+
+func TestCalculateFileDigests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.bin")
+	os.WriteFile(path, []byte("multi-digest content"), 0644)
+	calculator := NewHashCalculator()
+
+	results, err := calculator.CalculateFileDigests(path, []HashAlgorithm{MD5, SHA512}, nil)
+	if err != nil {
+		t.Fatalf("CalculateFileDigests failed: %v", err)
+	}
+	for _, result := range results {
+		single, _ := calculator.CalculateFileHash(path, result.Algorithm, nil)
+		if single.Hash != result.Hash {
+			t.Errorf("%s: single-pass digest %s differs from %s", result.Algorithm, result.Hash, single.Hash)
+		}
+	}
+}
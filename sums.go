@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// checksumNameEscaper escapes file names in GNU checksum lines, which are
+// then marked with a leading backslash
+var checksumNameEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+// checksumName escapes a name that needs it and returns the backslash its
+// line then starts with, as sha256sum does both for manifests and -c results
+func checksumName(name string) (string, string) {
+	if strings.ContainsAny(name, "\\\n\r") {
+		return "\\", checksumNameEscaper.Replace(name)
+	}
+	return "", name
+}
+
+// checksumLine formats a line as sha256sum writes it: the digest, a space, a
+// space or * for binary mode, and the name, escaped when it needs to be
+func checksumLine(digest, name string, binary bool) string {
+	mode := " "
+	if binary {
+		mode = "*"
+	}
+	mark, name := checksumName(name)
+	return mark + digest + " " + mode + name + "\n"
+}
+
+// ChecksumListing chooses how WriteChecksums names and marks files
+type ChecksumListing struct {
+	Binary bool   // Mark files with *, as sha256sum -b does
+	Self   string // The manifest being written, left out with its temporary file and backups when it lies below an input
+}
+
+// WriteChecksums hashes every file below the given paths and writes a GNU
+// checksum manifest that sha256sum -c (or md5sum -c and so on) run from the
+// same directory verifies. Files are named by their path as given, or as
+// -path-mode records them. Files that cannot be read are reported on stderr,
+// left out and counted, and the rest of the listing is still written.
+func WriteChecksums(w io.Writer, paths []string, algorithm HashAlgorithm, calculator *HashCalculator, listing ChecksumListing) (int, error) {
+	self := ""
+	if listing.Self != "" {
+		self, _ = filepath.Abs(listing.Self)
+	}
+	unreadable := 0
+	for _, root := range paths {
+		files, err := calculator.listFiles(root)
+		if err != nil {
+			return unreadable, fmt.Errorf("failed to list files: %w", err)
+		}
+		for _, path := range files {
+			if abs, _ := filepath.Abs(path); self != "" && (abs == self || abs == self+".tmp" || isBackup(abs, self)) {
+				continue
+			}
+			result, err := calculator.CalculateFileHash(path, algorithm, nil)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s: %v\n", path, err)
+				unreadable++
+				continue
+			}
+			name := calculator.Paths.name(path, filepath.ToSlash(outputPath(path)))
+			if _, err := io.WriteString(w, checksumLine(result.Hash, name, listing.Binary)); err != nil {
+				return unreadable, err
+			}
+		}
+	}
+	return unreadable, nil
+}
+
+// checksumOutputFile reports whether an -output value names a checksum file
+// to write, such as checksums.sha256 or SHA256SUMS, rather than a format, and
+// the algorithm its name implies
+func checksumOutputFile(output string) (HashAlgorithm, bool) {
+	switch output {
+	case "text", "json", "spdx", "markdown", "rclone", "parquet", "sums":
+		return "", false
+	}
+	// A bare algorithm name is a mistyped format, not a file name
+	if !strings.Contains(output, ".") && !strings.HasSuffix(strings.ToUpper(output), "SUMS") {
+		return "", false
+	}
+	return checksumFileAlgorithm(output)
+}
+
+// CheckOptions tune CheckChecksums
+type CheckOptions struct {
+	Quiet         bool          // Print only the files that did not verify
+	IgnoreMissing bool          // Leave out listed files that do not exist, as sha256sum --ignore-missing does
+	Algorithm     HashAlgorithm // Algorithm of GNU lines, instead of the one the name or digest length implies
+}
+
+// CheckChecksums verifies the files a checksum manifest lists, relative to
+// the working directory as sha256sum -c does, printing a line per file and a
+// summary. JSON reports are verified with the algorithm, digest mode and
+// chunk size they record. It returns the exit code: 0 when every file
+// verified, 1 otherwise.
+func CheckChecksums(w io.Writer, manifest string, calculator *HashCalculator, opts CheckOptions) int {
+	var checks []SBOMCheckResult
+	if reports, ok := loadReports(manifest); ok {
+		checks = verifyReports(w, reports, calculator)
+	} else {
+		entries, err := loadManifestAs(manifest, opts.Algorithm)
+		if err == nil {
+			err = checkManifestDigests(entries)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "Error: %v\n", err)
+			return 1
+		}
+		// Databases and rollup manifests record their settings too, and list
+		// digests of whole files, so only the chunk size is replayed
+		if p := manifestParameters(manifest); p != nil {
+			noteParameters(w, p, map[string]bool{})
+			if p.ChunkSize > 0 {
+				recorded := *calculator
+				recorded.ChunkSize = p.ChunkSize
+				calculator = &recorded
+			}
+		}
+		checks = VerifySBOM(entries, ".", calculator)
+	}
+	counts := map[string]int{}
+	for _, check := range checks {
+		if check.Status == "MISSING" && opts.IgnoreMissing {
+			continue
+		}
+		counts[check.Status]++
+		if opts.Quiet && check.Status == "OK" {
+			continue
+		}
+		// A name with a newline must not be able to print a result line of its own
+		line := check.Path + ": " + check.Status
+		if check.Err != nil {
+			line += fmt.Sprintf(" (%v)", check.Err)
+		}
+		mark, line := checksumName(line)
+		fmt.Fprintf(w, "%s%s\n", mark, line)
+	}
+
+	checked := counts["OK"] + counts["FAILED"] + counts["MISSING"] + counts["UNSUPPORTED"]
+	var parts []string
+	for _, status := range []string{"OK", "FAILED", "MISSING", "UNSUPPORTED"} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if checked == 0 {
+		fmt.Fprintf(w, "Error: %s: no file was verified\n", manifest)
+		return 1
+	}
+	fmt.Fprintf(w, "Checked %d file(s): %s\n", checked, strings.Join(parts, ", "))
+	if counts["FAILED"] > 0 || counts["MISSING"] > 0 || counts["OK"] == 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChecksumLine(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	for _, tc := range []struct {
+		name   string
+		binary bool
+		want   string
+	}{
+		{"plain.txt", false, digest + "  plain.txt\n"},
+		{"image.iso", true, digest + " *image.iso\n"},
+		{"back\\slash\nnew", false, "\\" + digest + "  back\\\\slash\\nnew\n"},
+	} {
+		line := checksumLine(digest, tc.name, tc.binary)
+		if line != tc.want {
+			t.Errorf("checksumLine(%q) = %q, want %q", tc.name, line, tc.want)
+		}
+		entries, err := parseChecksumLines([]byte(line), "")
+		if err != nil || len(entries) != 1 || entries[0].Path != tc.name || entries[0].Checksums[SHA256] != digest {
+			t.Errorf("%q does not read back: %+v, %v", line, entries, err)
+		}
+	}
+
+	for output, want := range map[string]HashAlgorithm{"checksums.sha256": SHA256, "SHA512SUMS": SHA512, "MD5SUMS.txt": MD5, "sha256": "", "rclone": ""} {
+		if alg, _ := checksumOutputFile(output); alg != want {
+			t.Errorf("checksumOutputFile(%q) = %q, want %q", output, alg, want)
+		}
+	}
+}
+
+func TestWriteAndCheckChecksums(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "sub"), 0755)
+	for _, name := range []string{"a.txt", "sub/b.txt", "sub/c.txt"} {
+		os.WriteFile(filepath.Join(dir, filepath.FromSlash(name)), []byte(name), 0644)
+	}
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	os.WriteFile(manifest+".1", []byte("old\n"), 0644)
+	f, err := createAtomic(manifest, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreadable, err := WriteChecksums(f, []string{dir}, SHA256, NewHashCalculator(), ChecksumListing{Self: manifest})
+	if err == nil {
+		err = f.Commit()
+	}
+	if err != nil || unreadable != 0 {
+		t.Fatalf("WriteChecksums: %d unreadable, %v", unreadable, err)
+	}
+	data, _ := os.ReadFile(manifest)
+	if strings.Count(string(data), "\n") != 3 || strings.Contains(string(data), "SHA256SUMS") {
+		t.Fatalf("Manifest should list the three files but not itself, its temporary file or backups:\n%s", data)
+	}
+
+	var out strings.Builder
+	if code := CheckChecksums(&out, manifest, NewHashCalculator(), CheckOptions{}); code != 0 {
+		t.Errorf("Unchanged files failed to verify:\n%s", out.String())
+	}
+
+	os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("changed"), 0644)
+	os.Remove(filepath.Join(dir, "sub", "c.txt"))
+	out.Reset()
+	if code := CheckChecksums(&out, manifest, NewHashCalculator(), CheckOptions{Quiet: true}); code != 1 {
+		t.Errorf("A changed file should fail the check")
+	}
+	got := out.String()
+	if strings.Contains(got, "a.txt") || !strings.Contains(got, "b.txt: FAILED") || !strings.Contains(got, "c.txt: MISSING") ||
+		!strings.HasSuffix(got, "Checked 3 file(s): 1 OK, 1 FAILED, 1 MISSING\n") {
+		t.Errorf("Unexpected check output:\n%s", got)
+	}
+}
+
+func TestCheckChecksumsEscapesNames(t *testing.T) {
+	manifest := filepath.Join(t.TempDir(), "SHA256SUMS")
+	name := "missing\nforged.txt: OK"
+	os.WriteFile(manifest, []byte(checksumLine(strings.Repeat("ab", 32), name, false)), 0644)
+	var out strings.Builder
+	CheckChecksums(&out, manifest, NewHashCalculator(), CheckOptions{})
+	want := "\\missing\\nforged.txt: OK: MISSING"
+	if lines := strings.Split(out.String(), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], want) {
+		t.Errorf("Name should be escaped on one result line starting %q:\n%s", want, out.String())
+	}
+}
+
+func TestCheckChecksumsWithAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	os.WriteFile(file, []byte("a"), 0644)
+	manifest := filepath.Join(dir, "list.txt")
+	os.WriteFile(manifest, []byte(checksumLine("ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb", file, false)), 0644)
+
+	var out strings.Builder
+	if code := CheckChecksums(&out, manifest, NewHashCalculator(), CheckOptions{Algorithm: SHA256}); code != 0 {
+		t.Errorf("The SHA-256 digest should verify with -a sha256:\n%s", out.String())
+	}
+	out.Reset()
+	if code := CheckChecksums(&out, manifest, NewHashCalculator(), CheckOptions{Algorithm: SHA512}); code != 1 || !strings.Contains(out.String(), "line 1") {
+		t.Errorf("A SHA-256 digest should be refused with -a sha512:\n%s", out.String())
+	}
+}
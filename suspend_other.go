@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// suspendSignals are the signals that pause a batch scan; there are none
+// without job control
+var suspendSignals []os.Signal
+
+// suspend is unavailable without job control, so a paused scan waits for the
+// control socket instead
+func suspend() bool {
+	return false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// suspendSignals are the signals that pause a batch scan
+var suspendSignals = []os.Signal{syscall.SIGTSTP}
+
+// suspend stops the process the way an uncaught SIGTSTP would, once the
+// journal is up to date; it continues when the shell sends SIGCONT
+func suspend() bool {
+	return syscall.Kill(os.Getpid(), syscall.SIGSTOP) == nil
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Object identifiers used by RFC 3161 and CMS
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidTSTInfo       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 1, 4}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSAPSS        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+
+	oidMD5    = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 5}
+	oidSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+)
+
+type messageImprint struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	HashedMessage []byte
+}
+
+type timeStampReq struct {
+	Version        int
+	MessageImprint messageImprint
+	Nonce          *big.Int `asn1:"optional"`
+	CertReq        bool     `asn1:"optional"`
+}
+
+type pkiStatusInfo struct {
+	Status       int
+	StatusString []string       `asn1:"optional"`
+	FailInfo     asn1.BitString `asn1:"optional"`
+}
+
+type timeStampResp struct {
+	Status         pkiStatusInfo
+	TimeStampToken asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,tag:0"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type issuerAndSerial struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type cmsAttribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+type tstAccuracy struct {
+	Seconds int `asn1:"optional"`
+	Millis  int `asn1:"optional,tag:0"`
+	Micros  int `asn1:"optional,tag:1"`
+}
+
+type tstInfo struct {
+	Version        int
+	Policy         asn1.ObjectIdentifier
+	MessageImprint messageImprint
+	SerialNumber   *big.Int
+	GenTime        asn1.RawValue
+	Accuracy       tstAccuracy   `asn1:"optional"`
+	Ordering       bool          `asn1:"optional"`
+	Nonce          *big.Int      `asn1:"optional"`
+	TSA            asn1.RawValue `asn1:"optional,explicit,tag:0"`
+	Extensions     asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+// TimestampToken is a parsed RFC 3161 timestamp whose signature has been checked
+type TimestampToken struct {
+	GenTime      time.Time
+	Policy       string
+	SerialNumber *big.Int
+	Algorithm    HashAlgorithm
+	Digest       []byte
+	Nonce        *big.Int
+	Certificate  *x509.Certificate
+	Certificates []*x509.Certificate
+	Raw          []byte // DER encoded TimeStampResp
+}
+
+// algorithmOID returns the object identifier of a hash algorithm
+func algorithmOID(algorithm HashAlgorithm) (asn1.ObjectIdentifier, error) {
+	switch algorithm {
+	case MD5:
+		return oidMD5, nil
+	case SHA1:
+		return oidSHA1, nil
+	case SHA256:
+		return oidSHA256, nil
+	case SHA512:
+		return oidSHA512, nil
+	default:
+		return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+	}
+}
+
+// algorithmFromOID maps a digest object identifier back to a supported algorithm
+func algorithmFromOID(oid asn1.ObjectIdentifier) (HashAlgorithm, error) {
+	for _, algorithm := range []HashAlgorithm{MD5, SHA1, SHA256, SHA512} {
+		if want, _ := algorithmOID(algorithm); want.Equal(oid) {
+			return algorithm, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported digest algorithm %s", oid)
+}
+
+// cryptoHashFromOID maps a CMS digest algorithm to a crypto.Hash
+func cryptoHashFromOID(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	default:
+		return 0, fmt.Errorf("unsupported signer digest algorithm %s", oid)
+	}
+}
+
+// signatureAlgorithm picks the x509 signature algorithm for a signer's key and digest
+func signatureAlgorithm(cert *x509.Certificate, digest crypto.Hash, sigOID asn1.ObjectIdentifier) (x509.SignatureAlgorithm, error) {
+	switch cert.PublicKeyAlgorithm {
+	case x509.RSA:
+		pss := sigOID.Equal(oidRSAPSS)
+		switch digest {
+		case crypto.SHA1:
+			if !pss {
+				return x509.SHA1WithRSA, nil
+			}
+		case crypto.SHA256:
+			if pss {
+				return x509.SHA256WithRSAPSS, nil
+			}
+			return x509.SHA256WithRSA, nil
+		case crypto.SHA384:
+			if pss {
+				return x509.SHA384WithRSAPSS, nil
+			}
+			return x509.SHA384WithRSA, nil
+		case crypto.SHA512:
+			if pss {
+				return x509.SHA512WithRSAPSS, nil
+			}
+			return x509.SHA512WithRSA, nil
+		}
+	case x509.ECDSA:
+		switch digest {
+		case crypto.SHA1:
+			return x509.ECDSAWithSHA1, nil
+		case crypto.SHA256:
+			return x509.ECDSAWithSHA256, nil
+		case crypto.SHA384:
+			return x509.ECDSAWithSHA384, nil
+		case crypto.SHA512:
+			return x509.ECDSAWithSHA512, nil
+		}
+	case x509.Ed25519:
+		return x509.PureEd25519, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signer key %s with %s", cert.PublicKeyAlgorithm, digest)
+}
+
+// parseGeneralizedTime parses a GeneralizedTime, allowing the fractional seconds TSAs commonly emit
+func parseGeneralizedTime(raw asn1.RawValue) (time.Time, error) {
+	if raw.Tag != asn1.TagGeneralizedTime {
+		return time.Time{}, fmt.Errorf("genTime is not a GeneralizedTime")
+	}
+	return time.Parse("20060102150405Z0700", string(raw.Bytes))
+}
+
+// signerCertificate finds the certificate identified by a SignerInfo
+func signerCertificate(info *signerInfo, certs []*x509.Certificate) (*x509.Certificate, error) {
+	if info.SID.Class == asn1.ClassContextSpecific && info.SID.Tag == 0 {
+		for _, cert := range certs {
+			if bytes.Equal(cert.SubjectKeyId, info.SID.Bytes) {
+				return cert, nil
+			}
+		}
+	} else {
+		var sid issuerAndSerial
+		if _, err := asn1.Unmarshal(info.SID.FullBytes, &sid); err != nil {
+			return nil, fmt.Errorf("invalid signer identifier: %w", err)
+		}
+		for _, cert := range certs {
+			if cert.SerialNumber.Cmp(sid.SerialNumber) == 0 && bytes.Equal(cert.RawIssuer, sid.Issuer.FullBytes) {
+				return cert, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("signer certificate not included in timestamp token")
+}
+
+// verifySignerInfo checks the CMS signature over the encapsulated TSTInfo
+func verifySignerInfo(info *signerInfo, content []byte, cert *x509.Certificate) error {
+	digestHash, err := cryptoHashFromOID(info.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	sigAlg, err := signatureAlgorithm(cert, digestHash, info.SignatureAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	signed := content
+	if len(info.SignedAttrs.FullBytes) > 0 {
+		h := digestHash.New()
+		h.Write(content)
+		contentDigest := h.Sum(nil)
+
+		var found bool
+		rest := info.SignedAttrs.Bytes
+		for len(rest) > 0 {
+			var attr cmsAttribute
+			if rest, err = asn1.Unmarshal(rest, &attr); err != nil {
+				return fmt.Errorf("invalid signed attribute: %w", err)
+			}
+			if !attr.Type.Equal(oidMessageDigest) || len(attr.Values) != 1 {
+				continue
+			}
+			var value []byte
+			if _, err := asn1.Unmarshal(attr.Values[0].FullBytes, &value); err != nil {
+				return fmt.Errorf("invalid message digest attribute: %w", err)
+			}
+			if !bytes.Equal(value, contentDigest) {
+				return fmt.Errorf("timestamp content does not match signed message digest")
+			}
+			found = true
+		}
+		if !found {
+			return fmt.Errorf("timestamp signature has no message digest attribute")
+		}
+
+		// The signature covers the attributes re-tagged as an explicit SET OF
+		signed = append([]byte{0x31}, info.SignedAttrs.FullBytes[1:]...)
+	}
+
+	if err := cert.CheckSignature(sigAlg, signed, info.Signature); err != nil {
+		return fmt.Errorf("timestamp signature is invalid: %w", err)
+	}
+	return nil
+}
+
+// ParseTimestampResponse parses a DER TimeStampResp and verifies its CMS signature
+func ParseTimestampResponse(der []byte) (*TimestampToken, error) {
+	var resp timeStampResp
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return nil, fmt.Errorf("invalid timestamp response: %w", err)
+	} else if len(rest) > 0 {
+		return nil, fmt.Errorf("invalid timestamp response: trailing data")
+	}
+	// 0 = granted, 1 = grantedWithMods
+	if resp.Status.Status > 1 {
+		return nil, fmt.Errorf("timestamp request rejected by TSA (status %d) %v", resp.Status.Status, resp.Status.StatusString)
+	}
+	if len(resp.TimeStampToken.FullBytes) == 0 {
+		return nil, fmt.Errorf("timestamp response contains no token")
+	}
+
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(resp.TimeStampToken.FullBytes, &ci); err != nil {
+		return nil, fmt.Errorf("invalid timestamp token: %w", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("timestamp token is not CMS signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return nil, fmt.Errorf("invalid timestamp signed data: %w", err)
+	}
+	if !sd.EncapContentInfo.EContentType.Equal(oidTSTInfo) {
+		return nil, fmt.Errorf("timestamp token does not contain TSTInfo")
+	}
+
+	var info tstInfo
+	if _, err := asn1.Unmarshal(sd.EncapContentInfo.EContent, &info); err != nil {
+		return nil, fmt.Errorf("invalid TSTInfo: %w", err)
+	}
+	genTime, err := parseGeneralizedTime(info.GenTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid genTime: %w", err)
+	}
+	algorithm, err := algorithmFromOID(info.MessageImprint.HashAlgorithm.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var certs []*x509.Certificate
+	if len(sd.Certificates.Bytes) > 0 {
+		if certs, err = x509.ParseCertificates(sd.Certificates.Bytes); err != nil {
+			return nil, fmt.Errorf("invalid TSA certificate: %w", err)
+		}
+	}
+	if len(sd.SignerInfos) != 1 {
+		return nil, fmt.Errorf("timestamp token must have exactly one signer, found %d", len(sd.SignerInfos))
+	}
+	cert, err := signerCertificate(&sd.SignerInfos[0], certs)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignerInfo(&sd.SignerInfos[0], sd.EncapContentInfo.EContent, cert); err != nil {
+		return nil, err
+	}
+
+	return &TimestampToken{
+		GenTime:      genTime,
+		Policy:       info.Policy.String(),
+		SerialNumber: info.SerialNumber,
+		Algorithm:    algorithm,
+		Digest:       info.MessageImprint.HashedMessage,
+		Nonce:        info.Nonce,
+		Certificate:  cert,
+		Certificates: certs,
+		Raw:          der,
+	}, nil
+}
+
+// VerifyDigest checks that the token covers the given digest
+func (tt *TimestampToken) VerifyDigest(algorithm HashAlgorithm, digest []byte) error {
+	if tt.Algorithm != algorithm {
+		return fmt.Errorf("timestamp covers a %s digest, not %s", getAlgorithmName(tt.Algorithm), getAlgorithmName(algorithm))
+	}
+	if !bytes.Equal(tt.Digest, digest) {
+		return fmt.Errorf("timestamp covers digest %x, not %x", tt.Digest, digest)
+	}
+	return nil
+}
+
+// VerifyChain checks the TSA certificate against roots (system roots when nil)
+func (tt *TimestampToken) VerifyChain(roots *x509.CertPool) error {
+	intermediates := x509.NewCertPool()
+	for _, cert := range tt.Certificates {
+		if cert != tt.Certificate {
+			intermediates.AddCert(cert)
+		}
+	}
+	_, err := tt.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   tt.GenTime,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	})
+	if err != nil {
+		return fmt.Errorf("TSA certificate not trusted: %w", err)
+	}
+	return nil
+}
+
+// RequestTimestamp asks a TSA to timestamp a digest and returns the verified token
+func RequestTimestamp(tsaURL string, algorithm HashAlgorithm, digest []byte) (*TimestampToken, error) {
+	oid, err := algorithmOID(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	req, err := asn1.Marshal(timeStampReq{
+		Version: 1,
+		MessageImprint: messageImprint{
+			HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.NullRawValue},
+			HashedMessage: digest,
+		},
+		Nonce:   nonce,
+		CertReq: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode timestamp request: %w", err)
+	}
+
+	resp, err := http.Post(tsaURL, "application/timestamp-query", bytes.NewReader(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to contact TSA: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("TSA returned HTTP %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read TSA response: %w", err)
+	}
+
+	token, err := ParseTimestampResponse(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := token.VerifyDigest(algorithm, digest); err != nil {
+		return nil, err
+	}
+	if token.Nonce == nil || token.Nonce.Cmp(nonce) != 0 {
+		return nil, fmt.Errorf("TSA response nonce does not match request")
+	}
+	return token, nil
+}
+
+// loadCertPool reads PEM certificates from a file for use as trust roots
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CA certificate: %w", err)
+		}
+		pool.AddCert(cert)
+	}
+	return pool, nil
+}
+
+// printTimestamp prints the details of a validated token and its trust status
+func printTimestamp(w io.Writer, token *TimestampToken, roots *x509.CertPool) {
+	fmt.Fprintf(w, "Timestamp: %s\n", token.GenTime.UTC().Format(time.RFC3339))
+	fmt.Fprintf(w, "TSA: %s\n", token.Certificate.Subject)
+	fmt.Fprintf(w, "Serial: %s\n", token.SerialNumber)
+	if err := token.VerifyChain(roots); err != nil {
+		fmt.Fprintf(w, "Warning: %v\n", err)
+	} else {
+		fmt.Fprintln(w, "TSA certificate: trusted")
+	}
+}
+
+// runVerifyTimestamp implements the verify-timestamp command
+func runVerifyTimestamp(args []string) int {
+	fs := flag.NewFlagSet("verify-timestamp", flag.ExitOnError)
+	tsaCA := fs.String("tsa-ca", "", "PEM file with trusted TSA root certificates")
+	upgrade := fs.Bool("upgrade", false, "Fetch completed OpenTimestamps attestations from calendars")
+	esplora := fs.String("esplora-url", "https://blockstream.info/api", "Esplora API used to check Bitcoin attestations")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fmt.Println("Usage: hashculate verify-timestamp [-tsa-ca <pem>] [-upgrade] <file> <token.tsr|proof.ots>")
+		return 1
+	}
+	filePath, tokenPath := fs.Arg(0), fs.Arg(1)
+
+	data, err := os.ReadFile(tokenPath)
+	if err != nil {
+		fmt.Printf("Error: failed to read token: %v\n", err)
+		return 1
+	}
+	if bytes.HasPrefix(data, otsMagic) {
+		return runVerifyOTS(filePath, tokenPath, data, *upgrade, *esplora)
+	}
+	token, err := ParseTimestampResponse(data)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+
+	result, err := NewHashCalculator().CalculateFileHash(filePath, token.Algorithm, nil)
+	if err != nil {
+		fmt.Printf("Error calculating hash: %v\n", err)
+		return 1
+	}
+	digest, _ := hex.DecodeString(result.Hash)
+	if err := token.VerifyDigest(token.Algorithm, digest); err != nil {
+		fmt.Printf("FAILED: %s: %v\n", filePath, err)
+		return 1
+	}
+
+	var roots *x509.CertPool
+	if *tsaCA != "" {
+		if roots, err = loadCertPool(*tsaCA); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if err := token.VerifyChain(roots); err != nil {
+			fmt.Printf("FAILED: %s: %v\n", filePath, err)
+			return 1
+		}
+	}
+
+	fmt.Printf("OK: %s existed with %s %s\n", filePath, getAlgorithmName(token.Algorithm), result.Hash)
+	printTimestamp(os.Stdout, token, roots)
+	return 0
+}
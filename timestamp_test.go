@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newFakeTSA starts a TSA that signs every request with a self-signed certificate
+func newFakeTSA(t *testing.T) (*httptest.Server, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(7),
+		Subject:      pkix.Name{CommonName: "Test TSA"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageTimeStamping},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var req timeStampReq
+		if _, err := asn1.Unmarshal(body, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		info, _ := asn1.Marshal(tstInfo{
+			Version:        1,
+			Policy:         asn1.ObjectIdentifier{1, 2, 3, 4},
+			MessageImprint: req.MessageImprint,
+			SerialNumber:   big.NewInt(42),
+			GenTime:        asn1.RawValue{Tag: asn1.TagGeneralizedTime, Bytes: []byte(time.Now().UTC().Format("20060102150405.000Z"))},
+			Nonce:          req.Nonce,
+		})
+		contentDigest := sha256.Sum256(info)
+		digestValue, _ := asn1.Marshal(contentDigest[:])
+		attr, _ := asn1.Marshal(cmsAttribute{Type: oidMessageDigest, Values: []asn1.RawValue{{FullBytes: digestValue}}})
+		attrSet, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attr})
+		attrHash := sha256.Sum256(attrSet)
+		signature, _ := ecdsa.SignASN1(rand.Reader, key, attrHash[:])
+		sid, _ := asn1.Marshal(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber})
+
+		sha256ID := pkix.AlgorithmIdentifier{Algorithm: oidSHA256}
+		sd, _ := asn1.Marshal(signedData{
+			Version:          3,
+			DigestAlgorithms: []pkix.AlgorithmIdentifier{sha256ID},
+			EncapContentInfo: encapsulatedContentInfo{EContentType: oidTSTInfo, EContent: info},
+			Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: cert.Raw},
+			SignerInfos: []signerInfo{{
+				Version:            1,
+				SID:                asn1.RawValue{FullBytes: sid},
+				DigestAlgorithm:    sha256ID,
+				SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attr},
+				SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}},
+				Signature:          signature,
+			}},
+		})
+		token, _ := asn1.Marshal(contentInfo{
+			ContentType: oidSignedData,
+			Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+		})
+		resp, _ := asn1.Marshal(timeStampResp{TimeStampToken: asn1.RawValue{FullBytes: token}})
+		w.Header().Set("Content-Type", "application/timestamp-reply")
+		w.Write(resp)
+	}))
+	t.Cleanup(server.Close)
+	return server, cert
+}
+
+func TestRequestTimestamp(t *testing.T) {
+	server, cert := newFakeTSA(t)
+	digest := sha256.Sum256([]byte("evidence"))
+
+	token, err := RequestTimestamp(server.URL, SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Timestamp request failed: %v", err)
+	}
+	if err := token.VerifyDigest(SHA256, digest[:]); err != nil {
+		t.Errorf("Token does not cover requested digest: %v", err)
+	}
+	other := sha256.Sum256([]byte("other"))
+	if err := token.VerifyDigest(SHA256, other[:]); err == nil {
+		t.Error("Expected digest mismatch for a different digest, but got none")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if err := token.VerifyChain(roots); err != nil {
+		t.Errorf("Expected TSA certificate to be trusted: %v", err)
+	}
+	if err := token.VerifyChain(x509.NewCertPool()); err == nil {
+		t.Error("Expected untrusted TSA certificate with empty root pool")
+	}
+
+	// Flip a byte of the digest inside the signed TSTInfo
+	tampered := append([]byte(nil), token.Raw...)
+	i := bytes.Index(tampered, digest[:])
+	if i < 0 {
+		t.Fatal("Digest not found in token")
+	}
+	tampered[i] ^= 0xff
+	if _, err := ParseTimestampResponse(tampered); err == nil {
+		t.Error("Expected tampered token to fail verification")
+	}
+}
+
+func TestChainWithTimestamp(t *testing.T) {
+	server, _ := newFakeTSA(t)
+	logPath := filepath.Join(t.TempDir(), "chain.log")
+	result := &HashResult{Algorithm: SHA256, Hash: "abc123", Filename: "file.bin", FileSize: 42}
+
+	record, err := AppendChainRecord(logPath, []*HashResult{result}, server.URL)
+	if err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if len(record.Timestamp) == 0 {
+		t.Fatal("Expected chain record to carry a timestamp")
+	}
+	if _, err := VerifyChain(logPath); err != nil {
+		t.Errorf("Verify failed on timestamped chain: %v", err)
+	}
+}
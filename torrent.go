@@ -0,0 +1,615 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// bdecoder decodes bencoded data, keeping the raw bytes of the top-level info dictionary
+type bdecoder struct {
+	data    []byte
+	pos     int
+	depth   int
+	infoRaw []byte
+}
+
+func (d *bdecoder) value() (any, error) {
+	if d.pos >= len(d.data) {
+		return nil, fmt.Errorf("unexpected end of bencoded data")
+	}
+	if d.depth > 64 {
+		return nil, fmt.Errorf("bencoded data nested too deeply")
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		end := bytes.IndexByte(d.data[d.pos:], 'e')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated integer at offset %d", d.pos)
+		}
+		n, err := strconv.ParseInt(string(d.data[d.pos+1:d.pos+end]), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid integer at offset %d", d.pos)
+		}
+		d.pos += end + 1
+		return n, nil
+	case c == 'l':
+		d.pos++
+		d.depth++
+		list := []any{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		d.depth--
+		d.pos++
+		return list, nil
+	case c == 'd':
+		d.pos++
+		d.depth++
+		dict := map[string]any{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			key, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			k, ok := key.([]byte)
+			if !ok {
+				return nil, fmt.Errorf("dictionary key is not a string at offset %d", d.pos)
+			}
+			start := d.pos
+			v, err := d.value()
+			if err != nil {
+				return nil, err
+			}
+			if d.depth == 1 && string(k) == "info" {
+				d.infoRaw = d.data[start:d.pos]
+			}
+			dict[string(k)] = v
+		}
+		d.depth--
+		d.pos++
+		return dict, nil
+	case c >= '0' && c <= '9':
+		colon := bytes.IndexByte(d.data[d.pos:], ':')
+		if colon < 0 {
+			return nil, fmt.Errorf("invalid string at offset %d", d.pos)
+		}
+		n, err := strconv.Atoi(string(d.data[d.pos : d.pos+colon]))
+		start := d.pos + colon + 1
+		if err != nil || n < 0 || start+n > len(d.data) {
+			return nil, fmt.Errorf("invalid string length at offset %d", d.pos)
+		}
+		d.pos = start + n
+		return d.data[start:d.pos], nil
+	default:
+		return nil, fmt.Errorf("invalid bencode type %q at offset %d", c, d.pos)
+	}
+}
+
+// bencode encodes strings, byte slices, integers, lists and dictionaries
+func bencode(v any) []byte {
+	switch v := v.(type) {
+	case string:
+		return []byte(fmt.Sprintf("%d:%s", len(v), v))
+	case []byte:
+		return append([]byte(fmt.Sprintf("%d:", len(v))), v...)
+	case int:
+		return []byte(fmt.Sprintf("i%de", v))
+	case int64:
+		return []byte(fmt.Sprintf("i%de", v))
+	case []any:
+		out := []byte("l")
+		for _, item := range v {
+			out = append(out, bencode(item)...)
+		}
+		return append(out, 'e')
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := []byte("d")
+		for _, k := range keys {
+			out = append(out, bencode(k)...)
+			out = append(out, bencode(v[k])...)
+		}
+		return append(out, 'e')
+	}
+	panic(fmt.Sprintf("bencode: unsupported type %T", v))
+}
+
+// TorrentFile is a file described by a torrent, relative to the torrent root
+type TorrentFile struct {
+	Path       string
+	Length     int64
+	Padding    bool   // BEP 47 pad file, all zeros and never stored on disk
+	PiecesRoot []byte // v2 merkle root of the file
+}
+
+// Torrent is the subset of a .torrent file needed for verification
+type Torrent struct {
+	Name        string
+	PieceLength int64
+	Pieces      [][]byte // v1 SHA-1 piece hashes
+	Files       []TorrentFile
+	SingleFile  bool
+	V1, V2      bool
+	PieceLayers map[string][]byte // v2 piece layers keyed by pieces root
+	InfoRaw     []byte
+}
+
+func bstring(v any) string {
+	b, _ := v.([]byte)
+	return string(b)
+}
+
+func bint(v any) (int64, bool) {
+	n, ok := v.(int64)
+	return n, ok
+}
+
+// ParseTorrent decodes a .torrent file
+func ParseTorrent(data []byte) (*Torrent, error) {
+	d := &bdecoder{data: data}
+	root, err := d.value()
+	if err != nil {
+		return nil, fmt.Errorf("invalid torrent: %w", err)
+	}
+	meta, ok := root.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid torrent: top level is not a dictionary")
+	}
+	info, ok := meta["info"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid torrent: missing info dictionary")
+	}
+
+	t := &Torrent{Name: bstring(info["name"]), InfoRaw: d.infoRaw, PieceLayers: map[string][]byte{}}
+	if strings.Contains(t.Name, "..") || strings.ContainsAny(t.Name, `/\`) {
+		return nil, fmt.Errorf("invalid torrent name %q", t.Name)
+	}
+	if t.PieceLength, ok = bint(info["piece length"]); !ok || t.PieceLength <= 0 {
+		return nil, fmt.Errorf("invalid torrent: missing piece length")
+	}
+
+	if pieces, ok := info["pieces"].([]byte); ok {
+		if len(pieces)%sha1.Size != 0 {
+			return nil, fmt.Errorf("invalid torrent: pieces length is not a multiple of 20")
+		}
+		t.V1 = true
+		for i := 0; i < len(pieces); i += sha1.Size {
+			t.Pieces = append(t.Pieces, pieces[i:i+sha1.Size])
+		}
+		if length, ok := bint(info["length"]); ok {
+			t.SingleFile = true
+			t.Files = []TorrentFile{{Path: t.Name, Length: length}}
+		} else if files, ok := info["files"].([]any); ok {
+			for _, f := range files {
+				entry, _ := f.(map[string]any)
+				length, _ := bint(entry["length"])
+				var parts []string
+				for _, p := range entry["path"].([]any) {
+					parts = append(parts, bstring(p))
+				}
+				path, err := torrentPath(t.Name, parts)
+				if err != nil {
+					return nil, err
+				}
+				t.Files = append(t.Files, TorrentFile{
+					Path:    path,
+					Length:  length,
+					Padding: strings.Contains(bstring(entry["attr"]), "p"),
+				})
+			}
+		}
+	}
+
+	if version, _ := bint(info["meta version"]); version == 2 {
+		t.V2 = true
+		tree, _ := info["file tree"].(map[string]any)
+		var v2Files []TorrentFile
+		var walk func(node map[string]any, parts []string) error
+		walk = func(node map[string]any, parts []string) error {
+			keys := make([]string, 0, len(node))
+			for k := range node {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				child, _ := node[k].(map[string]any)
+				if k == "" {
+					length, _ := bint(child["length"])
+					path, err := torrentPath(t.Name, parts)
+					if err != nil {
+						return err
+					}
+					root, _ := child["pieces root"].([]byte)
+					v2Files = append(v2Files, TorrentFile{Path: path, Length: length, PiecesRoot: root})
+					continue
+				}
+				if err := walk(child, append(parts, k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err := walk(tree, nil); err != nil {
+			return nil, err
+		}
+		// A single file whose only path component is the torrent name lives at the root
+		if len(v2Files) == 1 && v2Files[0].Path == filepath.Join(t.Name, t.Name) {
+			v2Files[0].Path = t.Name
+			t.SingleFile = true
+		}
+		if layers, ok := meta["piece layers"].(map[string]any); ok {
+			for k, v := range layers {
+				t.PieceLayers[k], _ = v.([]byte)
+			}
+		}
+		if !t.V1 {
+			t.Files = v2Files
+		} else {
+			// Hybrid torrents: attach v2 roots to the matching v1 files
+			roots := map[string][]byte{}
+			for _, f := range v2Files {
+				roots[f.Path] = f.PiecesRoot
+			}
+			for i := range t.Files {
+				t.Files[i].PiecesRoot = roots[t.Files[i].Path]
+			}
+		}
+	}
+
+	if !t.V1 && !t.V2 {
+		return nil, fmt.Errorf("invalid torrent: neither v1 pieces nor a v2 file tree")
+	}
+	return t, nil
+}
+
+// torrentPath joins torrent path components, rejecting traversal outside the root
+func torrentPath(name string, parts []string) (string, error) {
+	for _, p := range parts {
+		if p == "" || p == "." || p == ".." || strings.ContainsAny(p, `/\`) {
+			return "", fmt.Errorf("invalid torrent file path %q", strings.Join(parts, "/"))
+		}
+	}
+	return filepath.Join(append([]string{name}, parts...)...), nil
+}
+
+// InfoHashV1 returns the BitTorrent v1 info-hash (SHA-1 of the info dictionary)
+func (t *Torrent) InfoHashV1() []byte {
+	sum := sha1.Sum(t.InfoRaw)
+	return sum[:]
+}
+
+// InfoHashV2 returns the BitTorrent v2 info-hash (SHA-256 of the info dictionary)
+func (t *Torrent) InfoHashV2() []byte {
+	sum := sha256.Sum256(t.InfoRaw)
+	return sum[:]
+}
+
+// TorrentPieceResult reports the verification status of one piece
+type TorrentPieceResult struct {
+	Index int
+	File  string // set for v2 pieces, which never span files
+	OK    bool
+}
+
+// TorrentReport summarizes verification of downloaded data
+type TorrentReport struct {
+	Pieces       []TorrentPieceResult
+	MissingFiles []string
+	SizeMismatch []string
+}
+
+// BadPieces returns the pieces that failed verification
+func (r *TorrentReport) BadPieces() []TorrentPieceResult {
+	var bad []TorrentPieceResult
+	for _, p := range r.Pieces {
+		if !p.OK {
+			bad = append(bad, p)
+		}
+	}
+	return bad
+}
+
+// dataPath resolves a torrent file path inside the data directory. For single
+// file torrents, dataDir may also be the file itself.
+func (t *Torrent) dataPath(dataDir string, file TorrentFile) string {
+	if t.SingleFile {
+		if info, err := os.Stat(dataDir); err == nil && !info.IsDir() {
+			return dataDir
+		}
+	}
+	return filepath.Join(dataDir, file.Path)
+}
+
+// openTorrentFile opens a file for verification, recording missing files and size mismatches
+func (t *Torrent) openTorrentFile(dataDir string, file TorrentFile, report *TorrentReport) (io.Reader, func(), bool) {
+	f, err := os.Open(t.dataPath(dataDir, file))
+	if err != nil {
+		report.MissingFiles = append(report.MissingFiles, file.Path)
+		return io.LimitReader(zeroReader{}, file.Length), func() {}, false
+	}
+	intact := true
+	if info, err := f.Stat(); err == nil && info.Size() != file.Length {
+		report.SizeMismatch = append(report.SizeMismatch, file.Path)
+		intact = false
+	}
+	// Short files are padded so the following pieces stay aligned
+	reader := io.MultiReader(io.LimitReader(f, file.Length), io.LimitReader(zeroReader{}, file.Length))
+	return io.LimitReader(reader, file.Length), func() { f.Close() }, intact
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// VerifyV1 checks the downloaded data against the v1 piece hashes
+func (t *Torrent) VerifyV1(dataDir string) (*TorrentReport, error) {
+	report := &TorrentReport{}
+	piece := 0
+	hasher := sha1.New()
+	var filled int64
+	pieceIntact := true
+	buffer := make([]byte, 1024*1024)
+
+	finishPiece := func() {
+		ok := pieceIntact && piece < len(t.Pieces) && bytes.Equal(hasher.Sum(nil), t.Pieces[piece])
+		report.Pieces = append(report.Pieces, TorrentPieceResult{Index: piece, OK: ok})
+		piece++
+		hasher.Reset()
+		filled = 0
+		pieceIntact = true
+	}
+
+	for _, file := range t.Files {
+		var reader io.Reader
+		closeFile, intact := func() {}, true
+		if file.Padding {
+			reader = io.LimitReader(zeroReader{}, file.Length)
+		} else {
+			reader, closeFile, intact = t.openTorrentFile(dataDir, file, report)
+		}
+		for {
+			want := min(int64(len(buffer)), t.PieceLength-filled)
+			n, err := io.ReadFull(reader, buffer[:want])
+			if n > 0 {
+				hasher.Write(buffer[:n])
+				filled += int64(n)
+				pieceIntact = pieceIntact && intact
+				if filled == t.PieceLength {
+					finishPiece()
+				}
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				closeFile()
+				return nil, err
+			}
+		}
+		closeFile()
+	}
+	if filled > 0 {
+		finishPiece()
+	}
+	if piece != len(t.Pieces) {
+		return nil, fmt.Errorf("torrent lists %d pieces but files cover %d", len(t.Pieces), piece)
+	}
+	return report, nil
+}
+
+// v2BlockSize is the leaf size of BitTorrent v2 merkle trees
+const v2BlockSize = 16 * 1024
+
+// merkleRootV2 computes the root of SHA-256 leaves padded to width with pad hashes
+func merkleRootV2(leaves [][]byte, width int, pad []byte) []byte {
+	level := make([][]byte, width)
+	for i := range level {
+		if i < len(leaves) {
+			level[i] = leaves[i]
+		} else {
+			level[i] = pad
+		}
+	}
+	for len(level) > 1 {
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			sum := sha256.Sum256(append(append([]byte(nil), level[2*i]...), level[2*i+1]...))
+			next[i] = sum[:]
+		}
+		level = next
+	}
+	return level[0]
+}
+
+// nextPowerOfTwo returns the smallest power of two >= n (and at least 1)
+func nextPowerOfTwo(n int) int {
+	p := 1
+	for p < n {
+		p <<= 1
+	}
+	return p
+}
+
+// VerifyV2 checks each file against its v2 merkle root and piece layer
+func (t *Torrent) VerifyV2(dataDir string) (*TorrentReport, error) {
+	report := &TorrentReport{}
+	blocksPerPiece := int(t.PieceLength / v2BlockSize)
+	zeroLeaf := make([]byte, sha256.Size)
+	padPiece := merkleRootV2(nil, blocksPerPiece, zeroLeaf)
+	index := 0
+
+	for _, file := range t.Files {
+		if file.Length == 0 || file.Padding {
+			continue
+		}
+		reader, closeFile, intact := t.openTorrentFile(dataDir, file, report)
+		var leaves [][]byte
+		buffer := make([]byte, v2BlockSize)
+		for {
+			n, err := io.ReadFull(reader, buffer)
+			if n > 0 {
+				sum := sha256.Sum256(buffer[:n])
+				leaves = append(leaves, sum[:])
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			if err != nil {
+				closeFile()
+				return nil, err
+			}
+		}
+		closeFile()
+
+		if file.Length <= t.PieceLength {
+			root := merkleRootV2(leaves, nextPowerOfTwo(len(leaves)), zeroLeaf)
+			report.Pieces = append(report.Pieces, TorrentPieceResult{Index: index, File: file.Path, OK: intact && bytes.Equal(root, file.PiecesRoot)})
+			index++
+			continue
+		}
+
+		layer := t.PieceLayers[string(file.PiecesRoot)]
+		if len(layer)%sha256.Size != 0 {
+			return nil, fmt.Errorf("invalid piece layer for %s", file.Path)
+		}
+		var layerHashes [][]byte
+		for i := 0; i < len(layer); i += sha256.Size {
+			layerHashes = append(layerHashes, layer[i:i+sha256.Size])
+		}
+		// The piece layer is only trusted once it hashes up to the file's root
+		if root := merkleRootV2(layerHashes, nextPowerOfTwo(len(layerHashes)), padPiece); !bytes.Equal(root, file.PiecesRoot) {
+			return nil, fmt.Errorf("piece layer for %s does not match its pieces root", file.Path)
+		}
+		for i, start := 0, 0; start < len(leaves); i, start = i+1, start+blocksPerPiece {
+			end := min(start+blocksPerPiece, len(leaves))
+			hash := merkleRootV2(leaves[start:end], blocksPerPiece, zeroLeaf)
+			ok := intact && i < len(layerHashes) && bytes.Equal(hash, layerHashes[i])
+			report.Pieces = append(report.Pieces, TorrentPieceResult{Index: index, File: file.Path, OK: ok})
+			index++
+		}
+	}
+	return report, nil
+}
+
+// loadTorrent reads and parses a .torrent file
+func loadTorrent(path string) (*Torrent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read torrent: %w", err)
+	}
+	return ParseTorrent(data)
+}
+
+// runTorrent implements the torrent command
+func runTorrent(args []string) int {
+	usage := func() int {
+		fmt.Println("Usage: hashculate torrent verify <file.torrent> [-data <dir>]")
+		fmt.Println("       hashculate torrent infohash <file.torrent>")
+		return 1
+	}
+	if len(args) == 0 {
+		return usage()
+	}
+
+	switch args[0] {
+	case "infohash":
+		if len(args) != 2 {
+			return usage()
+		}
+		t, err := loadTorrent(args[1])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		if t.V1 {
+			fmt.Printf("v1: %s\n", hex.EncodeToString(t.InfoHashV1()))
+		}
+		if t.V2 {
+			fmt.Printf("v2: %s\n", hex.EncodeToString(t.InfoHashV2()))
+		}
+		return 0
+
+	case "verify":
+		fs := flag.NewFlagSet("torrent verify", flag.ExitOnError)
+		dataDir := fs.String("data", ".", "Directory containing the downloaded data")
+		logFlags := registerLogSinkFlags(fs)
+		positional := parseFlags(fs, args[1:])
+		if len(positional) != 1 {
+			return usage()
+		}
+		sink, err := logFlags.open()
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+		defer sink.Close()
+		t, err := loadTorrent(positional[0])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+
+		var report *TorrentReport
+		if t.V1 {
+			report, err = t.VerifyV1(*dataDir)
+		} else {
+			report, err = t.VerifyV2(*dataDir)
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+
+		for _, path := range report.MissingFiles {
+			fmt.Printf("MISSING: %s\n", path)
+		}
+		for _, path := range report.SizeMismatch {
+			fmt.Printf("SIZE MISMATCH: %s\n", path)
+		}
+		bad := report.BadPieces()
+		for _, p := range bad {
+			if p.File != "" {
+				fmt.Printf("BAD piece %d (%s)\n", p.Index, p.File)
+			} else {
+				fmt.Printf("BAD piece %d\n", p.Index)
+			}
+		}
+		summary := fmt.Sprintf("%s: %d of %d pieces OK", t.Name, len(report.Pieces)-len(bad), len(report.Pieces))
+		fmt.Println(summary)
+		failed := len(bad) > 0 || len(report.MissingFiles) > 0
+		level := logInfo
+		if failed {
+			level = logError
+		}
+		sink.Emit(level, "scan.summary", "torrent verify: "+summary, map[string]any{
+			"torrent": positional[0], "pieces": len(report.Pieces), "bad_pieces": len(bad),
+			"missing_files": strings.Join(report.MissingFiles, ","), "size_mismatches": strings.Join(report.SizeMismatch, ","),
+		})
+		if failed {
+			return 1
+		}
+		return 0
+	}
+	return usage()
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTorrentVerifyV1(t *testing.T) {
+	dir := t.TempDir()
+	first := bytes.Repeat([]byte("a"), 50)
+	second := bytes.Repeat([]byte("b"), 30)
+	os.MkdirAll(filepath.Join(dir, "album", "disc"), 0755)
+	os.WriteFile(filepath.Join(dir, "album", "one.bin"), first, 0644)
+	os.WriteFile(filepath.Join(dir, "album", "disc", "two.bin"), second, 0644)
+
+	// 32-byte pieces span the boundary between the two files
+	stream := append(append([]byte(nil), first...), second...)
+	var pieces []byte
+	for i := 0; i < len(stream); i += 32 {
+		sum := sha1.Sum(stream[i:min(i+32, len(stream))])
+		pieces = append(pieces, sum[:]...)
+	}
+	info := map[string]any{
+		"name":         "album",
+		"piece length": 32,
+		"pieces":       pieces,
+		"files": []any{
+			map[string]any{"length": 50, "path": []any{"one.bin"}},
+			map[string]any{"length": 30, "path": []any{"disc", "two.bin"}},
+		},
+	}
+	tor, err := ParseTorrent(bencode(map[string]any{"announce": "http://tracker", "info": info}))
+	if err != nil {
+		t.Fatalf("Failed to parse torrent: %v", err)
+	}
+	if want := sha1.Sum(bencode(info)); !bytes.Equal(tor.InfoHashV1(), want[:]) {
+		t.Errorf("Info-hash = %x, want %x", tor.InfoHashV1(), want)
+	}
+
+	report, err := tor.VerifyV1(dir)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(report.Pieces) != 3 || len(report.BadPieces()) != 0 {
+		t.Fatalf("Expected 3 good pieces, got %+v", report.Pieces)
+	}
+
+	// Corrupt a byte of the second file, which lies in the last piece
+	second[20] = 'x'
+	os.WriteFile(filepath.Join(dir, "album", "disc", "two.bin"), second, 0644)
+	report, _ = tor.VerifyV1(dir)
+	if bad := report.BadPieces(); len(bad) != 1 || bad[0].Index != 2 {
+		t.Errorf("Expected only piece 2 to be bad, got %+v", bad)
+	}
+
+	os.Remove(filepath.Join(dir, "album", "one.bin"))
+	report, _ = tor.VerifyV1(dir)
+	if len(report.MissingFiles) != 1 || len(report.BadPieces()) != 3 {
+		t.Errorf("Expected missing file to fail every piece, got %+v", report)
+	}
+}
+
+func TestTorrentVerifyV2(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 2500) // 40000 bytes, three 16 KiB pieces
+	path := filepath.Join(dir, "image.bin")
+	os.WriteFile(path, data, 0644)
+
+	var layer []byte
+	var hashes [][]byte
+	for i := 0; i < len(data); i += v2BlockSize {
+		sum := sha256.Sum256(data[i:min(i+v2BlockSize, len(data))])
+		layer = append(layer, sum[:]...)
+		hashes = append(hashes, sum[:])
+	}
+	pair := func(a, b []byte) []byte {
+		sum := sha256.Sum256(append(append([]byte(nil), a...), b...))
+		return sum[:]
+	}
+	root := pair(pair(hashes[0], hashes[1]), pair(hashes[2], make([]byte, 32)))
+
+	info := map[string]any{
+		"name":         "image.bin",
+		"piece length": v2BlockSize,
+		"meta version": 2,
+		"file tree": map[string]any{
+			"image.bin": map[string]any{"": map[string]any{"length": len(data), "pieces root": root}},
+		},
+	}
+	tor, err := ParseTorrent(bencode(map[string]any{"info": info, "piece layers": map[string]any{string(root): layer}}))
+	if err != nil {
+		t.Fatalf("Failed to parse torrent: %v", err)
+	}
+	if want := sha256.Sum256(bencode(info)); !bytes.Equal(tor.InfoHashV2(), want[:]) {
+		t.Errorf("Info-hash = %x, want %x", tor.InfoHashV2(), want)
+	}
+
+	report, err := tor.VerifyV2(path)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if len(report.Pieces) != 3 || len(report.BadPieces()) != 0 {
+		t.Fatalf("Expected 3 good pieces, got %+v", report.Pieces)
+	}
+
+	data[20000] ^= 0xff
+	os.WriteFile(path, data, 0644)
+	report, _ = tor.VerifyV2(dir)
+	if bad := report.BadPieces(); len(bad) != 1 || bad[0].Index != 1 {
+		t.Errorf("Expected only piece 1 to be bad, got %+v", bad)
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Tree statuses, in the order rollups list them
+const (
+	treeOK         = "ok"
+	treeChanged    = "changed"
+	treeDrifted    = "drifted" // Same content, different permissions
+	treeNew        = "new"
+	treeMissing    = "missing"
+	treeMoved      = "moved"
+	treeUnverified = "unverified"
+)
+
+var treeStatuses = []string{treeOK, treeChanged, treeDrifted, treeNew, treeMissing, treeMoved, treeUnverified}
+
+// treeGlyphs marks each file with its status
+var treeGlyphs = map[string]string{
+	treeOK:         "✓",
+	treeChanged:    "✗",
+	treeDrifted:    "~",
+	treeNew:        "+",
+	treeMissing:    "-",
+	treeMoved:      "→",
+	treeUnverified: "?",
+}
+
+// treeNode is a directory or file in a verification tree
+type treeNode struct {
+	Name     string
+	Status   string // empty for directories
+	Detail   string
+	Children []*treeNode
+	Counts   map[string]int
+}
+
+// child returns the directory named name, creating it if needed
+func (n *treeNode) child(name string) *treeNode {
+	for _, c := range n.Children {
+		if c.Name == name && c.Status == "" {
+			return c
+		}
+	}
+	c := &treeNode{Name: name, Counts: map[string]int{}}
+	n.Children = append(n.Children, c)
+	return c
+}
+
+// add places a file at the slash-separated path and counts it in every parent
+func (n *treeNode) add(path, status, detail string) {
+	n.Counts[status]++
+	parts := strings.Split(path, "/")
+	for _, dir := range parts[:len(parts)-1] {
+		n = n.child(dir)
+		n.Counts[status]++
+	}
+	n.Children = append(n.Children, &treeNode{Name: parts[len(parts)-1], Status: status, Detail: detail})
+}
+
+// sort orders children by name throughout the tree
+func (n *treeNode) sort() {
+	sort.Slice(n.Children, func(i, j int) bool { return n.Children[i].Name < n.Children[j].Name })
+	for _, c := range n.Children {
+		c.sort()
+	}
+}
+
+// clean reports whether every file below n verified
+func (n *treeNode) clean() bool {
+	if n.Status != "" {
+		return n.Status == treeOK
+	}
+	return len(n.Counts) == 1 && n.Counts[treeOK] > 0
+}
+
+// rollup summarizes the non-zero status counts, e.g. "2 ok, 1 changed"
+func rollup(counts map[string]int) string {
+	var parts []string
+	for _, status := range treeStatuses {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	if len(parts) == 0 {
+		return "empty"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// TreeOptions are the optional inputs of BuildTree
+type TreeOptions struct {
+	Scrub    *scrubReport // Checksum errors the filesystem found
+	Excludes []string     // Patterns of paths the manifest's scan left out, as recorded
+}
+
+// BuildTree verifies dir against manifest entries and arranges the results as
+// a tree. Manifest paths are relative to dir; files on disk that the manifest
+// does not list are reported as new, except the manifest itself, and as moved
+// when they have the digest of a missing file. Files whose recorded
+// permissions or security label no longer match are reported as drifted.
+// With a scrub report, changed files say whether the filesystem caught them
+// as bitrot or an application rewrote them. Files the recorded scan excluded
+// are not reported as new.
+func BuildTree(dir string, entries []ManifestEntry, manifestPath string, calculator *HashCalculator, opts TreeOptions) (*treeNode, error) {
+	scrub := opts.Scrub
+	root := &treeNode{Name: filepath.Base(filepath.Clean(dir)), Counts: map[string]int{}}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i, entry := range entries {
+		if filepath.IsAbs(entry.Path) {
+			if rel, err := filepath.Rel(absDir, entry.Path); err == nil {
+				entries[i].Path = rel
+			}
+		}
+	}
+
+	recorded := map[string]ManifestEntry{}
+	for _, entry := range entries {
+		if entry.Meta != nil || entry.Label != "" || scrub != nil {
+			recorded[manifestKey(entry.Path)] = entry
+		}
+	}
+	drift := func(key string) string {
+		entry, ok := recorded[key]
+		if !ok {
+			return ""
+		}
+		file := filepath.Join(dir, filepath.FromSlash(key))
+		var drift []string
+		if entry.Meta != nil {
+			if current, err := ReadFileMeta(file); err == nil {
+				drift = entry.Meta.Drift(current)
+			}
+		}
+		if entry.Label != "" {
+			if current := readSecurityLabel(file); current != entry.Label {
+				drift = append(drift, fmt.Sprintf("label %s → %s", entry.Label, metaValue(current)))
+			}
+		}
+		return strings.Join(drift, ", ")
+	}
+
+	listed := map[string]bool{}
+	missing := map[string]string{}
+	var missingAlgorithms []HashAlgorithm
+	for _, check := range VerifySBOM(entries, dir, calculator) {
+		key := manifestKey(check.Path)
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+		switch check.Status {
+		case "OK":
+			if detail := drift(key); detail != "" {
+				root.add(key, treeDrifted, detail)
+			} else {
+				root.add(key, treeOK, "")
+			}
+		case "MISSING":
+			missing[key] = string(check.Algorithm) + ":" + check.Expected
+			if !containsAlgorithm(missingAlgorithms, check.Algorithm) {
+				missingAlgorithms = append(missingAlgorithms, check.Algorithm)
+			}
+		case "UNSUPPORTED":
+			root.add(key, treeUnverified, "no md5, sha1, sha256 or sha512 checksum")
+		case "FAILED":
+			detail := getAlgorithmName(check.Algorithm) + " differs"
+			if check.Err != nil {
+				detail = check.Err.Error()
+			}
+			if scrub != nil {
+				if class := scrub.classify(filepath.Join(absDir, filepath.FromSlash(key)), recorded[key], check.Err); class != "" {
+					detail += "; " + class
+				}
+			}
+			if permissions := drift(key); permissions != "" {
+				detail += "; " + permissions
+			}
+			root.add(key, treeChanged, detail)
+		}
+	}
+
+	files, err := listFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	missingDigests := map[string]bool{}
+	for _, digest := range missing {
+		missingDigests[digest] = true
+	}
+	absManifest, _ := filepath.Abs(manifestPath)
+	skip := &scanWalk{excludes: scanExcludes(dir, opts.Excludes)}
+	added := map[string]string{}
+	for _, file := range files {
+		if abs, _ := filepath.Abs(file); abs == absManifest || skip.excludedBelow(dir, file) {
+			continue
+		}
+		key := relativeSlashPath(dir, file)
+		if listed[key] {
+			continue
+		}
+		added[key] = ""
+		if len(missing) == 0 {
+			continue
+		}
+		// New files are only read when a missing file may have moved to them
+		results, err := calculator.CalculateFileDigests(file, missingAlgorithms, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			added[key] = string(result.Algorithm) + ":" + result.Hash
+			if missingDigests[added[key]] {
+				break
+			}
+		}
+	}
+	for _, move := range matchMoves(missing, added) {
+		delete(missing, move.From)
+		delete(added, move.To)
+		root.add(move.To, treeMoved, "from "+move.From)
+	}
+	for key := range missing {
+		root.add(key, treeMissing, "")
+	}
+	for key := range added {
+		root.add(key, treeNew, "")
+	}
+	root.sort()
+	return root, nil
+}
+
+// Rows flattens the files of the tree into report rows, in tree order
+func (n *treeNode) Rows() []ReportRow {
+	var rows []ReportRow
+	var walk func(n *treeNode, prefix string)
+	walk = func(n *treeNode, prefix string) {
+		for _, c := range n.Children {
+			if c.Status == "" {
+				walk(c, prefix+c.Name+"/")
+			} else {
+				rows = append(rows, ReportRow{Path: prefix + c.Name, Status: c.Status, Detail: c.Detail})
+			}
+		}
+	}
+	walk(n, "")
+	return rows
+}
+
+// WriteTree prints the tree with box-drawing indentation, status glyphs and
+// per-directory rollups. With problemsOnly, verified files and directories
+// without problems are left out.
+func WriteTree(w io.Writer, root *treeNode, problemsOnly bool) {
+	fmt.Fprintf(w, "%s/  (%s)\n", root.Name, rollup(root.Counts))
+	writeTreeChildren(w, root, "", problemsOnly)
+}
+
+func writeTreeChildren(w io.Writer, n *treeNode, prefix string, problemsOnly bool) {
+	var shown []*treeNode
+	for _, c := range n.Children {
+		if !problemsOnly || !c.clean() {
+			shown = append(shown, c)
+		}
+	}
+	for i, c := range shown {
+		branch, indent := "├── ", "│   "
+		if i == len(shown)-1 {
+			branch, indent = "└── ", "    "
+		}
+		switch {
+		case c.Status == "":
+			fmt.Fprintf(w, "%s%s%s/  (%s)\n", prefix, branch, c.Name, rollup(c.Counts))
+			writeTreeChildren(w, c, prefix+indent, problemsOnly)
+		case c.Detail != "":
+			fmt.Fprintf(w, "%s%s%s %s  (%s)\n", prefix, branch, treeGlyphs[c.Status], c.Name, c.Detail)
+		default:
+			fmt.Fprintf(w, "%s%s%s %s\n", prefix, branch, treeGlyphs[c.Status], c.Name)
+		}
+	}
+}
+
+// runTree implements the tree command
+func runTree(args []string) int {
+	fs := flag.NewFlagSet("tree", flag.ExitOnError)
+	check := fs.String("check", "", "Checksum manifest, hashdeep file, hashculate database or SBOM to verify against")
+	problems := fs.Bool("problems", false, "Only show files and directories that did not verify")
+	scrub := fs.Bool("scrub", false, "Correlate changed files with the checksum errors ZFS or Btrfs found")
+	fs.BoolVar(&deterministic, "deterministic", false, "Leave the generation time and absolute paths out of reports")
+	report, args, err := splitReportArgs(args)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || *check == "" {
+		fmt.Println("Usage: hashculate tree <dir> -check <manifest> [-problems] [-scrub] [-report html <out.html>]")
+		return 1
+	}
+
+	entries, err := LoadManifest(*check)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	var opts TreeOptions
+	if *scrub {
+		if opts.Scrub, err = readScrub(positional[0]); err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+	// A database records how its scan was run, so the same files are left out again
+	calculator := NewHashCalculator()
+	params := manifestParameters(*check)
+	if params != nil {
+		opts.Excludes = params.Excludes
+		if slices.Contains(params.Options, "exclude-system") {
+			opts.Excludes = append(opts.Excludes, systemExcludes[runtime.GOOS]...)
+		}
+		current := *params
+		current.Version, current.ChunkSize = toolVersion(), calculator.ChunkSize
+		for _, drift := range params.Drift(&current) {
+			fmt.Printf("Settings drift: %s\n", drift)
+		}
+	}
+	root, err := BuildTree(positional[0], entries, *check, calculator, opts)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	WriteTree(os.Stdout, root, *problems)
+	if report != nil {
+		err := report.write(VerificationReport{
+			Title:     "Verification of " + outputPath(positional[0]),
+			Manifest:  outputPath(*check),
+			Root:      outputPath(positional[0]),
+			Generated: outputTime(time.Now()),
+			Rows:      root.Rows(),
+		})
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return 1
+		}
+	}
+	fmt.Println()
+	fmt.Println(rollup(root.Counts))
+	if opts.Scrub != nil {
+		fmt.Println(opts.Scrub)
+	}
+	if root.Counts[treeChanged] > 0 || root.Counts[treeDrifted] > 0 || root.Counts[treeMissing] > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "dist")
+	os.MkdirAll(filepath.Join(dir, "bin"), 0755)
+	os.WriteFile(filepath.Join(dir, "bin", "app"), []byte("app"), 0644)
+	os.WriteFile(filepath.Join(dir, "bin", "tool"), []byte("tampered"), 0644)
+	os.WriteFile(filepath.Join(dir, "NOTES"), []byte("new"), 0644)
+	manifest := filepath.Join(dir, "SHA256SUMS")
+	os.WriteFile(manifest, []byte(fmt.Sprintf("%x  bin/app\n%x  bin/tool\n%x  ./gone.txt\n",
+		sha256.Sum256([]byte("app")), sha256.Sum256([]byte("tool")), sha256.Sum256([]byte("gone")))), 0644)
+
+	entries, err := LoadManifest(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := BuildTree(dir, entries, manifest, NewHashCalculator(), TreeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	WriteTree(&out, tree, false)
+	want := "dist/  (1 ok, 1 changed, 1 new, 1 missing)\n" +
+		"├── + NOTES\n" +
+		"├── bin/  (1 ok, 1 changed)\n" +
+		"│   ├── ✓ app\n" +
+		"│   └── ✗ tool  (SHA-256 differs)\n" +
+		"└── - gone.txt\n"
+	if out.String() != want {
+		t.Errorf("unexpected tree:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	WriteTree(&out, tree, true)
+	if strings.Contains(out.String(), "app") || !strings.Contains(out.String(), "tool") {
+		t.Errorf("-problems should only show files that did not verify:\n%s", out.String())
+	}
+}
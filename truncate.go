@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// minPrefixLength is the shortest expected digest -prefix-match accepts
+const minPrefixLength = 6
+
+// truncateDigest returns the first n characters of a hex digest, or all of it when n is 0
+func truncateDigest(hash string, n int) string {
+	if n <= 0 || n >= len(hash) {
+		return hash
+	}
+	return hash[:n]
+}
+
+// truncationWarning explains what a digest of n hex characters still guarantees
+func truncationWarning(n int) string {
+	bits := n * 4
+	return fmt.Sprintf("Warning: %d hex characters keep only %d bits of the digest. Collisions become likely "+
+		"after about 2^%d different files, and a file matching a given short hash can be forged with about "+
+		"2^%d work. Short hashes identify files; they do not prove integrity.", n, bits, bits/2, bits)
+}
+
+// digestMatches compares a computed digest with an expected one. With prefix,
+// an expected digest shorter than the computed one only has to match its start.
+func digestMatches(actual, expected string, prefix bool) bool {
+	expected = strings.ToLower(strings.TrimSpace(expected))
+	if prefix && len(expected) < len(actual) {
+		return strings.HasPrefix(actual, expected)
+	}
+	return actual == expected
+}
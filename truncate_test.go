@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestDigestPrefixes(t *testing.T) {
+	full := "98ea6e4f216f2fb4b69fff9b3a44842c38686ca685f3f55dc48c5d3fb1107be4"
+	if got := truncateDigest(full, 12); got != "98ea6e4f216f" {
+		t.Errorf("truncateDigest: got %s", got)
+	}
+	if got := truncateDigest(full, 100); got != full {
+		t.Errorf("truncateDigest past the end: got %s", got)
+	}
+
+	tests := []struct {
+		expected string
+		prefix   bool
+		want     bool
+	}{
+		{full, false, true},
+		{"98EA6E4F216F", true, true},
+		{"98ea6e4f216f", false, false},
+		{"98ea6e4f216e", true, false},
+		{full + "00", true, false},
+	}
+	for _, test := range tests {
+		if got := digestMatches(full, test.expected, test.prefix); got != test.want {
+			t.Errorf("digestMatches(%s, prefix=%v) = %v, want %v", test.expected, test.prefix, got, test.want)
+		}
+	}
+}
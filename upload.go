@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"hashculate/httpdigest"
+)
+
+// uploadIdleTimeout is how long an unfinished upload is kept without new chunks
+const uploadIdleTimeout = time.Hour
+
+// uploadDigestChunkLimit caps a chunk sent with Content-Digest, which is held
+// in memory until its digest is checked
+const uploadDigestChunkLimit = 64 << 20
+
+// UploadStatus describes a chunked upload session
+type UploadStatus struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Length int64  `json:"length"` // -1 when not declared
+}
+
+// uploadSession hashes the chunks of one upload as they arrive, so the file is
+// never assembled on the server
+type uploadSession struct {
+	mu         sync.Mutex
+	id         string
+	name       string
+	tenant     *Tenant
+	algorithms []HashAlgorithm
+	hashers    []hash.Hash
+	offset     int64
+	length     int64
+	updated    atomic.Int64 // Unix nanoseconds of the last chunk, read without the session lock
+}
+
+// uploadStore holds the open upload sessions of a server
+type uploadStore struct {
+	mu       sync.Mutex
+	sessions map[string]*uploadSession
+}
+
+// create starts a session, dropping sessions that have been idle too long.
+// Handlers remove sessions while holding their lock, so the sweep must not
+// take it.
+func (u *uploadStore) create(session *uploadSession) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.sessions == nil {
+		u.sessions = map[string]*uploadSession{}
+	}
+	for id, s := range u.sessions {
+		if time.Since(time.Unix(0, s.updated.Load())) > uploadIdleTimeout {
+			delete(u.sessions, id)
+		}
+	}
+	u.sessions[session.id] = session
+}
+
+// get returns a session if it belongs to the tenant
+func (u *uploadStore) get(id string, tenant *Tenant) *uploadSession {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	session := u.sessions[id]
+	if session == nil || session.tenant != tenant {
+		return nil
+	}
+	return session
+}
+
+func (u *uploadStore) remove(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.sessions, id)
+}
+
+// handleUploadCreate starts a chunked upload
+func (s *Server) handleUploadCreate(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	algorithms, err := requestAlgorithms(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	length := int64(-1)
+	if value := r.Header.Get("Upload-Length"); value != "" {
+		if length, err = strconv.ParseInt(value, 10, 64); err != nil || length < 0 {
+			writeError(w, http.StatusBadRequest, "invalid Upload-Length")
+			return
+		}
+	}
+	session := &uploadSession{name: r.URL.Query().Get("name"), tenant: tenant, algorithms: algorithms, length: length}
+	session.updated.Store(time.Now().UnixNano())
+	if session.name == "" {
+		session.name = "upload"
+	}
+	for _, algorithm := range algorithms {
+		hasher, err := s.calc.createHasher(algorithm)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		session.hashers = append(session.hashers, hasher)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	session.id = hex.EncodeToString(id)
+	s.uploads.create(session)
+
+	w.Header().Set("Location", "/v1/uploads/"+session.id)
+	writeUploadStatus(w, http.StatusCreated, session.status())
+}
+
+// handleUploadStatus reports the offset to resume an upload from
+func (s *Server) handleUploadStatus(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	session := s.uploads.get(r.PathValue("id"), tenant)
+	if session == nil {
+		writeError(w, http.StatusNotFound, "no such upload")
+		return
+	}
+	session.mu.Lock()
+	status := session.status()
+	session.mu.Unlock()
+	writeUploadStatus(w, http.StatusOK, status)
+}
+
+// handleUploadChunk hashes the next chunk. The Upload-Offset header must match
+// the bytes received so far; a chunk that breaks off is kept up to where it
+// stopped and the client resumes from the returned offset. A chunk sent with
+// Content-Digest is buffered, up to uploadDigestChunkLimit, and only hashed
+// once its digest matches.
+func (s *Server) handleUploadChunk(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	session := s.uploads.get(r.PathValue("id"), tenant)
+	if session == nil {
+		writeError(w, http.StatusNotFound, "no such upload")
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Upload-Offset header is required")
+		return
+	}
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if offset != session.offset {
+		writeUploadStatus(w, http.StatusConflict, session.status())
+		return
+	}
+	var body io.Reader = r.Body
+	if session.length >= 0 {
+		// One extra byte detects a chunk running past the declared length
+		body = io.LimitReader(r.Body, session.length-session.offset+1)
+	}
+	writers := make([]io.Writer, len(session.hashers))
+	for i, hasher := range session.hashers {
+		writers[i] = hasher
+	}
+	if r.Header.Get("Content-Digest") != "" {
+		chunk, err := io.ReadAll(io.LimitReader(body, uploadDigestChunkLimit+1))
+		if len(chunk) > uploadDigestChunkLimit {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("chunks with Content-Digest are limited to %d MB", uploadDigestChunkLimit>>20))
+			return
+		}
+		verifier := httpdigest.NewVerifier()
+		verifier.Write(chunk)
+		if err == nil {
+			err = checkContentDigest(r, verifier)
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		body = bytes.NewReader(chunk)
+	}
+	written, copyErr := io.Copy(io.MultiWriter(writers...), body)
+	session.offset += written
+	session.updated.Store(time.Now().UnixNano())
+	switch {
+	case session.length >= 0 && session.offset > session.length:
+		s.uploads.remove(session.id)
+		writeError(w, http.StatusRequestEntityTooLarge, "upload exceeds Upload-Length")
+	case copyErr != nil:
+		writeUploadStatus(w, http.StatusBadRequest, session.status())
+	default:
+		writeUploadStatus(w, http.StatusOK, session.status())
+	}
+}
+
+// handleUploadComplete finishes an upload and returns its digests
+func (s *Server) handleUploadComplete(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	session := s.uploads.get(r.PathValue("id"), tenant)
+	if session == nil {
+		writeError(w, http.StatusNotFound, "no such upload")
+		return
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if session.length >= 0 && session.offset != session.length {
+		writeError(w, http.StatusConflict, fmt.Sprintf("upload incomplete: %d of %d bytes received", session.offset, session.length))
+		return
+	}
+	s.uploads.remove(session.id)
+
+	results := make([]*HashResult, len(session.algorithms))
+	for i, algorithm := range session.algorithms {
+		results[i] = &HashResult{Algorithm: algorithm, Hash: formatDigest(algorithm, session.hashers[i].Sum(nil)), Filename: session.name, FileSize: session.offset}
+	}
+	s.respond(w, tenant, results)
+}
+
+// handleUploadCancel discards an upload
+func (s *Server) handleUploadCancel(w http.ResponseWriter, r *http.Request, tenant *Tenant) {
+	if s.uploads.get(r.PathValue("id"), tenant) == nil {
+		writeError(w, http.StatusNotFound, "no such upload")
+		return
+	}
+	s.uploads.remove(r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// status returns the session state; the caller holds the session lock
+func (session *uploadSession) status() UploadStatus {
+	return UploadStatus{ID: session.id, Offset: session.offset, Length: session.length}
+}
+
+// writeUploadStatus writes an upload status with the Upload-Offset header
+func writeUploadStatus(w http.ResponseWriter, code int, status UploadStatus) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(status.Offset, 10))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestChunkedUpload(t *testing.T) {
+	keyA := sha256.Sum256([]byte("key-a"))
+	keyB := sha256.Sum256([]byte("key-b"))
+	config := &ServeConfig{Tenants: []Tenant{
+		{Name: "a", APIKeySHA256: hex.EncodeToString(keyA[:])},
+		{Name: "b", APIKeySHA256: hex.EncodeToString(keyB[:])},
+	}}
+	if err := config.prepare(); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewServer(config, nil))
+	defer server.Close()
+
+	do := func(method, path, key string, headers map[string]string, body []byte) (*http.Response, []byte) {
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return resp, data
+	}
+
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	resp, _ := do("POST", "/v1/uploads?algorithm=sha256,md5&name=big.bin", "key-a", map[string]string{"Upload-Length": strconv.Itoa(len(content))}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d", resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+
+	if resp, _ := do("PATCH", location, "key-a", map[string]string{"Upload-Offset": "0"}, content[:4000]); resp.StatusCode != http.StatusOK || resp.Header.Get("Upload-Offset") != "4000" {
+		t.Fatalf("First chunk failed: %d %s", resp.StatusCode, resp.Header.Get("Upload-Offset"))
+	}
+	// A retried chunk at a stale offset is rejected with the offset to resume from
+	if resp, _ := do("PATCH", location, "key-a", map[string]string{"Upload-Offset": "0"}, content[:4000]); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected 409 for a stale offset, got %d", resp.StatusCode)
+	}
+	if resp, _ := do("HEAD", location, "key-a", nil, nil); resp.Header.Get("Upload-Offset") != "4000" {
+		t.Errorf("Expected resume offset 4000, got %q", resp.Header.Get("Upload-Offset"))
+	}
+	// Sessions are private to the tenant that created them
+	if resp, _ := do("PATCH", location, "key-b", map[string]string{"Upload-Offset": "4000"}, content[4000:]); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected another tenant to get 404, got %d", resp.StatusCode)
+	}
+	if resp, _ := do("POST", location+"/complete", "key-a", nil, nil); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected an incomplete upload to be refused, got %d", resp.StatusCode)
+	}
+	do("PATCH", location, "key-a", map[string]string{"Upload-Offset": "4000"}, content[4000:])
+
+	resp, data := do("POST", location+"/complete", "key-a", nil, nil)
+	var result HashResponse
+	json.Unmarshal(data, &result)
+	sum := sha256.Sum256(content)
+	if resp.StatusCode != http.StatusOK || result.Hashes[SHA256] != hex.EncodeToString(sum[:]) || result.Size != int64(len(content)) || result.File != "big.bin" {
+		t.Errorf("Unexpected completion: %d %s", resp.StatusCode, data)
+	}
+	if resp, _ := do("HEAD", location, "key-a", nil, nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the session to be gone after completion, got %d", resp.StatusCode)
+	}
+
+	if resp.Header.Get("Content-Digest") == "" {
+		t.Error("Expected the response to carry a Content-Digest")
+	}
+
+	// A chunk that does not match its Content-Digest is not hashed
+	resp, _ = do("POST", "/v1/uploads", "key-a", nil, nil)
+	location = resp.Header.Get("Location")
+	wrong := map[string]string{"Upload-Offset": "0", "Content-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"}
+	if resp, _ := do("PATCH", location, "key-a", wrong, content[:10]); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a chunk with a wrong Content-Digest, got %d", resp.StatusCode)
+	}
+	chunkSum := sha256.Sum256(content[:10])
+	right := map[string]string{"Upload-Offset": "0", "Content-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(chunkSum[:]) + ":"}
+	if resp, _ := do("PATCH", location, "key-a", right, content[:10]); resp.Header.Get("Upload-Offset") != "10" {
+		t.Errorf("Expected the verified chunk to be hashed, got offset %q", resp.Header.Get("Upload-Offset"))
+	}
+	// Without an Upload-Length, the buffered chunk is still capped
+	right["Upload-Offset"] = "10"
+	if resp, _ := do("PATCH", location, "key-a", right, make([]byte, uploadDigestChunkLimit+1)); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for an oversized chunk with Content-Digest, got %d", resp.StatusCode)
+	}
+
+	// Data beyond the declared length aborts the upload
+	resp, _ = do("POST", "/v1/uploads", "key-a", map[string]string{"Upload-Length": "5"}, nil)
+	if resp, _ := do("PATCH", resp.Header.Get("Location"), "key-a", map[string]string{"Upload-Offset": "0"}, content[:10]); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 past Upload-Length, got %d", resp.StatusCode)
+	}
+}
+
+func TestUploadCreateWhileSessionBusy(t *testing.T) {
+	var store uploadStore
+	busy := &uploadSession{id: "busy"}
+	busy.updated.Store(time.Now().UnixNano())
+	store.create(busy)
+
+	// A chunk handler holds its session's lock while it removes the session
+	busy.mu.Lock()
+	created := make(chan struct{})
+	go func() {
+		store.create(&uploadSession{id: "new"})
+		close(created)
+	}()
+	select {
+	case <-created:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Creating an upload blocked on the lock of another session")
+	}
+	store.remove(busy.id)
+	busy.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// uuidNamespaces are the predefined namespaces of RFC 9562, by the names
+// -uuid-namespace accepts
+var uuidNamespaces = map[string]string{
+	"dns":  "6ba7b810-9dad-11d1-80b4-00c04fd430c8",
+	"url":  "6ba7b811-9dad-11d1-80b4-00c04fd430c8",
+	"oid":  "6ba7b812-9dad-11d1-80b4-00c04fd430c8",
+	"x500": "6ba7b814-9dad-11d1-80b4-00c04fd430c8",
+}
+
+// parseUUID reads a UUID in its hyphenated form, with or without braces or
+// a urn:uuid: prefix, or one of the predefined namespace names
+func parseUUID(s string) ([16]byte, error) {
+	var u [16]byte
+	if named, ok := uuidNamespaces[strings.ToLower(s)]; ok {
+		s = named
+	}
+	text := strings.TrimPrefix(strings.Trim(strings.ToLower(s), "{}"), "urn:uuid:")
+	if len(text) != 36 || text[8] != '-' || text[13] != '-' || text[18] != '-' || text[23] != '-' {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+	if _, err := hex.Decode(u[:], []byte(strings.ReplaceAll(text, "-", ""))); err != nil {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+// formatUUID writes a UUID in its hyphenated lowercase form
+func formatUUID(u [16]byte) string {
+	h := hex.EncodeToString(u[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// nameUUID derives the version 3 (MD5) or version 5 (SHA-1) UUID of a name
+// in a namespace, as RFC 9562 describes
+func nameUUID(version int, namespace [16]byte, name string) [16]byte {
+	var sum []byte
+	if version == 3 {
+		h := md5.New()
+		h.Write(namespace[:])
+		h.Write([]byte(name))
+		sum = h.Sum(nil)
+	} else {
+		h := sha1.New()
+		h.Write(namespace[:])
+		h.Write([]byte(name))
+		sum = h.Sum(nil)
+	}
+	var u [16]byte
+	copy(u[:], sum)
+	u[6] = u[6]&0x0f | byte(version)<<4
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// parseUUIDVersion reads the -uuid value: v5 (SHA-1) or v3 (MD5)
+func parseUUIDVersion(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "v5", "5":
+		return 5, nil
+	case "v3", "3":
+		return 3, nil
+	}
+	return 0, fmt.Errorf("unknown UUID version %q: expected v5 or v3", s)
+}
+
+// digestUUID derives a UUID from a file's digest. The name is the digest's
+// hash:// URL, so equal content hashed with different algorithms does not
+// share a UUID and anyone can derive the same UUID from the digest alone.
+func digestUUID(version int, namespace [16]byte, algorithm HashAlgorithm, digest string) string {
+	name, _ := digestURI(algorithm, digest, "hash")
+	return formatUUID(nameUUID(version, namespace, name))
+}
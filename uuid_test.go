@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestDigestUUID(t *testing.T) {
+	const digest = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	url, _ := parseUUID("url")
+	dns, _ := parseUUID("{6BA7B810-9DAD-11D1-80B4-00C04FD430C8}")
+	// As derived by Python's uuid.uuid5(uuid.NAMESPACE_URL, "hash://sha256/...") and uuid3
+	if got := digestUUID(5, url, SHA256, digest); got != "e271594f-38e2-556c-b1dd-0b952a9dba9a" {
+		t.Errorf("v5 UUID = %s", got)
+	}
+	if got := digestUUID(3, dns, SHA256, digest); got != "cb3aa084-44a4-3477-8113-8677e1a3d5d8" {
+		t.Errorf("v3 UUID = %s", got)
+	}
+	if digestUUID(5, url, SHA256, digest) == digestUUID(5, dns, SHA256, digest) {
+		t.Error("Namespaces should give different UUIDs")
+	}
+}
+
+func TestParseUUID(t *testing.T) {
+	for _, s := range []string{"urn:uuid:6ba7b811-9dad-11d1-80b4-00c04fd430c8", "URL", "6ba7b811-9dad-11d1-80b4-00c04fd430c8"} {
+		u, err := parseUUID(s)
+		if err != nil || formatUUID(u) != "6ba7b811-9dad-11d1-80b4-00c04fd430c8" {
+			t.Errorf("%s: got %s, %v", s, formatUUID(u), err)
+		}
+	}
+	for _, s := range []string{"assets", "6ba7b8119dad11d180b400c04fd430c8", "6ba7b811-9dad-11d1-80b4-00c04fd430cz"} {
+		if _, err := parseUUID(s); err == nil {
+			t.Errorf("%s: want an error", s)
+		}
+	}
+}
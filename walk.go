@@ -0,0 +1,57 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+
+	"hashculate/hasher"
+)
+
+// listFiles returns the regular files below root on the host filesystem in
+// lexical order. When root is itself a file it is returned on its own.
+func listFiles(root string) ([]string, error) {
+	files, err := hasher.ListFiles(hasher.OS, root)
+	if err != nil || len(firmlinks()) == 0 {
+		return files, err
+	}
+	// Below / on macOS the data volume's directories also appear through their firmlinks
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	kept := files[:0]
+	for _, path := range files {
+		if !firmlinked(path, []string{abs}) {
+			kept = append(kept, path)
+		}
+	}
+	return kept, nil
+}
+
+// fs returns the filesystem inputs are read from, the host's by default
+func (hc *HashCalculator) fs() fs.FS {
+	if hc.FS != nil {
+		return hc.FS
+	}
+	return hasher.OS
+}
+
+// listFiles returns the regular files below root in the calculator's
+// filesystem, and starts warming them when the calculator does that
+func (hc *HashCalculator) listFiles(root string) ([]string, error) {
+	files, err := hasher.ListFiles(hc.fs(), root)
+	if err == nil && hc.FS == nil {
+		hc.Warm.start(files)
+	}
+	return files, err
+}
+
+// relativeSlashPath returns path relative to root using forward slashes, or
+// the base name when path is root itself
+func relativeSlashPath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCalculatorFS(t *testing.T) {
+	calculator := NewHashCalculator()
+	calculator.FS = fstest.MapFS{
+		"dist/app.tar.gz":     {Data: []byte("app")},
+		"dist/docs/README.md": {Data: []byte("readme")},
+	}
+	manifest, err := BuildRollupManifest("dist", SHA256, calculator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Path != "app.tar.gz" || manifest.Files[0].Hash != fmt.Sprintf("%x", sha256.Sum256([]byte("app"))) {
+		t.Errorf("unexpected manifest files: %+v", manifest.Files)
+	}
+
+	var out strings.Builder
+	if err := WriteMarkdownChecksums(&out, []string{"dist"}, calculator); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "| `docs/README.md` | 6 B |") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// Cache warming settings: a few files are read at once so the disk can order
+// its seeks, and only so far ahead of hashing that they are still cached
+// when their turn comes
+const (
+	warmWorkers   = 8
+	warmAhead     = 128
+	warmReadLimit = 8 << 20
+)
+
+// cacheWarmer pulls files into the page cache ahead of hashing, which keeps a
+// spinning disk busy while many small files are hashed one after another
+type cacheWarmer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	runs    []*warmRun
+	stopped bool
+}
+
+// warmRun is a list of files being warmed in the order they will be hashed
+type warmRun struct {
+	index map[string]int
+	next  int // Position after the last file hashed
+}
+
+// newCacheWarmer creates a warmer; start hands it the files to read
+func newCacheWarmer() *cacheWarmer {
+	w := &cacheWarmer{}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// start warms files in the background, staying at most warmAhead files in
+// front of the last one hashed. Files hashing has already passed are skipped.
+func (w *cacheWarmer) start(files []string) {
+	if w == nil || len(files) == 0 {
+		return
+	}
+	run := &warmRun{index: make(map[string]int, len(files))}
+	for i, path := range files {
+		run.index[path] = i
+	}
+	w.mu.Lock()
+	w.runs = append(w.runs, run)
+	w.mu.Unlock()
+
+	jobs := make(chan string)
+	for range warmWorkers {
+		go func() {
+			for path := range jobs {
+				warmFile(path)
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		defer w.remove(run)
+		for i, path := range files {
+			w.mu.Lock()
+			for i >= run.next+warmAhead && !w.stopped {
+				w.cond.Wait()
+			}
+			stopped, passed := w.stopped, i < run.next
+			w.mu.Unlock()
+			if stopped {
+				return
+			}
+			if !passed {
+				jobs <- path
+			}
+		}
+	}()
+}
+
+// done records that path is being hashed, letting the warmer move ahead
+func (w *cacheWarmer) done(path string) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, run := range w.runs {
+		if i, ok := run.index[path]; ok && i >= run.next {
+			run.next = i + 1
+			w.cond.Broadcast()
+		}
+	}
+}
+
+// stop ends warming, for runs that finish or fail before their last file
+func (w *cacheWarmer) stop() {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	w.stopped = true
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// remove forgets a run whose files have all been handed out
+func (w *cacheWarmer) remove(run *warmRun) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, r := range w.runs {
+		if r == run {
+			w.runs = append(w.runs[:i], w.runs[i+1:]...)
+			return
+		}
+	}
+}
+
+// warmFile has the start of a file read into the page cache, by readahead
+// advice where the kernel takes it and by reading it otherwise; tests replace it
+var warmFile = func(path string) {
+	acquireFile()
+	defer releaseFile()
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	if !prefetchPages(f, warmReadLimit) {
+		io.CopyN(io.Discard, f, warmReadLimit)
+	}
+}
+
+// statSizes stats files on workers goroutines at once, which lets a disk or
+// network share serve several metadata lookups per seek or round trip
+func statSizes(files []string, workers int) ([]int64, error) {
+	sizes := make([]int64, len(files))
+	errs := make([]error, len(files))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range max(workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				info, err := os.Stat(files[i])
+				if err != nil {
+					errs[i] = err
+					continue
+				}
+				sizes[i] = info.Size()
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sizes, nil
+}
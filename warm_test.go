@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCacheWarmerStaysAhead(t *testing.T) {
+	var mu sync.Mutex
+	warmed := map[string]bool{}
+	original := warmFile
+	warmFile = func(path string) {
+		mu.Lock()
+		warmed[path] = true
+		mu.Unlock()
+	}
+	defer func() { warmFile = original }()
+	count := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(warmed)
+	}
+	waitFor := func(n int) {
+		deadline := time.Now().Add(5 * time.Second)
+		for count() < n && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	files := make([]string, 3*warmAhead)
+	for i := range files {
+		files[i] = fmt.Sprintf("file%03d", i)
+	}
+	w := newCacheWarmer()
+	defer w.stop()
+	w.start(files)
+	waitFor(warmAhead)
+	time.Sleep(20 * time.Millisecond)
+	if n := count(); n != warmAhead {
+		t.Fatalf("Warmed %d files before any was hashed, want %d", n, warmAhead)
+	}
+
+	// Hashing far ahead skips the files it passed
+	w.done(files[2*warmAhead])
+	waitFor(2 * warmAhead)
+	time.Sleep(20 * time.Millisecond)
+	if n := count(); n != 2*warmAhead-1 {
+		t.Errorf("Warmed %d files, want %d", n, 2*warmAhead-1)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if warmed[files[warmAhead]] || !warmed[files[2*warmAhead+1]] {
+		t.Error("Warmer should jump to the file after the one hashed")
+	}
+}
+
+func TestStatSizes(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for i := range 20 {
+		path := filepath.Join(dir, fmt.Sprintf("f%02d", i))
+		os.WriteFile(path, make([]byte, i), 0644)
+		files = append(files, path)
+	}
+	sizes, err := statSizes(files, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, size := range sizes {
+		if size != int64(i) {
+			t.Errorf("Size of %s = %d, want %d", files[i], size, i)
+		}
+	}
+	if _, err := statSizes(append(files, filepath.Join(dir, "gone")), 4); !os.IsNotExist(err) {
+		t.Errorf("Missing file gave %v, want not-exist error", err)
+	}
+}
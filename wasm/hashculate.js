@@ -0,0 +1,70 @@
+// Hashculate WebAssembly bindings: streaming File/Blob hashing with progress.
+//
+//   import { load, hashBlob } from "./hashculate.js";
+//   await load();
+//   const { size, hashes } = await hashBlob(file, {
+//     algorithms: ["sha256", "md5"],
+//     onProgress: (fraction) => console.log(Math.round(fraction * 100) + "%"),
+//   });
+
+const DEFAULT_CHUNK_SIZE = 4 * 1024 * 1024; // 4MB, like the CLI
+
+let ready = null;
+
+// load starts the Go runtime once. wasm_exec.js ships with Go in
+// $(go env GOROOT)/lib/wasm and must come from the Go release that built the module.
+export function load({ wasmURL = new URL("hashculate.wasm", import.meta.url), execURL = new URL("wasm_exec.js", import.meta.url) } = {}) {
+  if (!ready) {
+    ready = (async () => {
+      if (!globalThis.Go) {
+        await import(execURL);
+      }
+      const go = new globalThis.Go();
+      const source = await fetch(wasmURL);
+      const { instance } = await WebAssembly.instantiateStreaming(source, go.importObject);
+      go.run(instance);
+      return globalThis.hashculate;
+    })();
+  }
+  return ready;
+}
+
+// createStream returns a hasher fed with update(Uint8Array) and finished with digests()
+export async function createStream(algorithms = ["sha256"], size = -1) {
+  const api = await load();
+  const stream = api.newStream(algorithms, size);
+  if (stream instanceof Error) {
+    throw stream;
+  }
+  return stream;
+}
+
+// hashBlob hashes a File or Blob chunk by chunk, so large files are never held in memory
+export async function hashBlob(blob, { algorithms = ["sha256"], chunkSize = DEFAULT_CHUNK_SIZE, onProgress } = {}) {
+  const stream = await createStream(algorithms, blob.size);
+  for (let offset = 0; offset < blob.size; offset += chunkSize) {
+    const chunk = await blob.slice(offset, offset + chunkSize).arrayBuffer();
+    stream.update(new Uint8Array(chunk));
+    if (onProgress) {
+      onProgress(Math.min(offset + chunkSize, blob.size) / blob.size);
+    }
+  }
+  return { size: blob.size, hashes: stream.digests() };
+}
+
+// hashStream hashes a ReadableStream such as a fetch() response body
+export async function hashStream(readable, { algorithms = ["sha256"], size = -1, onProgress } = {}) {
+  const stream = await createStream(algorithms, size);
+  const reader = readable.getReader();
+  for (;;) {
+    const { done, value } = await reader.read();
+    if (done) {
+      break;
+    }
+    const written = stream.update(value);
+    if (onProgress && size > 0) {
+      onProgress(written / size);
+    }
+  }
+  return { size: stream.written(), hashes: stream.digests() };
+}
@@ -0,0 +1,73 @@
+//go:build js && wasm
+
+// Command wasm exposes the hasher package to JavaScript as globalThis.hashculate.
+// Build it with GOOS=js GOARCH=wasm and load it through hashculate.js.
+package main
+
+import (
+	"syscall/js"
+
+	"hashculate/hasher"
+)
+
+// newStream implements hashculate.newStream(algorithms, size), returning an
+// object with update(Uint8Array), written() and digests()
+func newStream(this js.Value, args []js.Value) any {
+	if len(args) < 1 {
+		return jsError("newStream(algorithms, size) needs an algorithm list")
+	}
+	var algorithms []hasher.Algorithm
+	for i := 0; i < args[0].Length(); i++ {
+		alg, err := hasher.Parse(args[0].Index(i).String())
+		if err != nil {
+			return jsError(err.Error())
+		}
+		algorithms = append(algorithms, alg)
+	}
+	size := int64(-1)
+	if len(args) > 1 && args[1].Type() == js.TypeNumber {
+		size = int64(args[1].Float())
+	}
+	stream, err := hasher.NewStream(algorithms, size, nil)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	var buffer []byte
+	object := js.Global().Get("Object").New()
+	object.Set("update", js.FuncOf(func(this js.Value, args []js.Value) any {
+		chunk := args[0]
+		if cap(buffer) < chunk.Length() {
+			buffer = make([]byte, chunk.Length())
+		}
+		buffer = buffer[:chunk.Length()]
+		js.CopyBytesToGo(buffer, chunk)
+		stream.Write(buffer)
+		return stream.Written()
+	}))
+	object.Set("written", js.FuncOf(func(this js.Value, args []js.Value) any {
+		return stream.Written()
+	}))
+	object.Set("digests", js.FuncOf(func(this js.Value, args []js.Value) any {
+		result := js.Global().Get("Object").New()
+		for _, digest := range stream.Digests() {
+			result.Set(string(digest.Algorithm), digest.Hash)
+		}
+		return result
+	}))
+	return object
+}
+
+// jsError returns a JavaScript Error for the wrapper to throw
+func jsError(message string) js.Value {
+	return js.Global().Get("Error").New(message)
+}
+
+func main() {
+	api := js.Global().Get("Object").New()
+	api.Set("newStream", js.FuncOf(newStream))
+	api.Set("algorithms", js.ValueOf([]any{"md5", "sha1", "sha256", "sha512", "cidv1"}))
+	js.Global().Set("hashculate", api)
+	// Keep the Go runtime alive for calls from JavaScript
+	select {}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ChainReport is a verification report kept in a chain record
+type ChainReport struct {
+	Title     string           `json:"title"`
+	Manifest  string           `json:"manifest,omitempty"`
+	Root      string           `json:"root,omitempty"`
+	Generated string           `json:"generated,omitempty"`
+	Failed    int              `json:"failed"`
+	Rows      []ChainReportRow `json:"rows"`
+}
+
+// ChainReportRow is one verified file of a chain report
+type ChainReportRow struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Expected  string `json:"expected,omitempty"`
+	Actual    string `json:"actual,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// newChainReport converts a verification report for a chain record
+func newChainReport(report VerificationReport) *ChainReport {
+	chained := &ChainReport{Title: report.Title, Manifest: report.Manifest, Root: report.Root, Rows: []ChainReportRow{}}
+	if !report.Generated.IsZero() {
+		chained.Generated = report.Generated.UTC().Format(time.RFC3339)
+	}
+	for _, row := range report.Rows {
+		if row.Failed() {
+			chained.Failed++
+		}
+		chained.Rows = append(chained.Rows, ChainReportRow(row))
+	}
+	return chained
+}
+
+// writeWORMReport appends a verification report to a chain log, or stores it
+// as the next object of an s3:// chain
+func writeWORMReport(target string, report VerificationReport) error {
+	return appendChain(target, &ChainRecord{Report: newChainReport(report)}, "")
+}
+
+// s3ChainTarget is an s3://bucket/prefix/ chain with its Object Lock retention
+type s3ChainTarget struct {
+	bucket *cloudBucket
+	prefix string
+	mode   string // COMPLIANCE or GOVERNANCE, empty for the bucket's default retention
+	retain time.Duration
+}
+
+// openS3Chain parses s3://bucket/prefix/?mode=compliance&retain=2555d
+func openS3Chain(target string) (*s3ChainTarget, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain target %q", target)
+	}
+	query := u.Query()
+	u.RawQuery = ""
+	bucket, prefix, err := openCloudBucket(u.String(), "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if bucket.provider != "s3" {
+		return nil, fmt.Errorf("chain target %s: only s3:// buckets are supported", target)
+	}
+	chain := &s3ChainTarget{bucket: bucket, prefix: prefix}
+	if retain := query.Get("retain"); retain != "" {
+		if chain.retain, err = parseRetentionAge(retain); err != nil || chain.retain == 0 {
+			return nil, fmt.Errorf("chain target %s: invalid retain %q (e.g. 2555d)", target, retain)
+		}
+		chain.mode = strings.ToUpper(query.Get("mode"))
+		if chain.mode == "" {
+			chain.mode = "COMPLIANCE"
+		}
+		if chain.mode != "COMPLIANCE" && chain.mode != "GOVERNANCE" {
+			return nil, fmt.Errorf("chain target %s: mode must be compliance or governance", target)
+		}
+	} else if query.Get("mode") != "" {
+		return nil, fmt.Errorf("chain target %s: mode needs retain", target)
+	}
+	return chain, nil
+}
+
+// recordKeys lists the record objects of the chain in sequence order
+func (c *s3ChainTarget) recordKeys() ([]string, error) {
+	objects, err := c.bucket.List(c.prefix)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, object := range objects {
+		if name := strings.TrimPrefix(object.Key, c.prefix); !strings.Contains(name, "/") && strings.HasSuffix(name, ".json") {
+			keys = append(keys, object.Key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// record downloads one record object
+func (c *s3ChainTarget) record(key string) (ChainRecord, error) {
+	var record ChainRecord
+	body, err := c.bucket.Open(key)
+	if err != nil {
+		return record, err
+	}
+	defer body.Close()
+	if err := json.NewDecoder(body).Decode(&record); err != nil {
+		return record, fmt.Errorf("chain object %s: %w", key, err)
+	}
+	return record, nil
+}
+
+// readS3Chain downloads every record of an s3:// chain
+func readS3Chain(target string) ([]ChainRecord, error) {
+	chain, err := openS3Chain(target)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := chain.recordKeys()
+	if err != nil {
+		return nil, err
+	}
+	var records []ChainRecord
+	for _, key := range keys {
+		record, err := chain.record(key)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// last returns the last record of the chain, or nil for an empty chain.
+// Only the last record is checked before linking to it, as Object Lock keeps
+// the earlier ones from being changed; verify-chain checks the whole chain.
+func (c *s3ChainTarget) last() (*ChainRecord, error) {
+	keys, err := c.recordKeys()
+	if err != nil || len(keys) == 0 {
+		return nil, err
+	}
+	last, err := c.record(keys[len(keys)-1])
+	if err != nil {
+		return nil, err
+	}
+	if digest, err := last.computeDigest(); err != nil || digest != last.Digest || last.Seq != int64(len(keys)) {
+		return nil, fmt.Errorf("refusing to extend broken chain: %s does not match its digest or position", keys[len(keys)-1])
+	}
+	return &last, nil
+}
+
+// put uploads a record as the object named by its sequence number, with the
+// chain's retention. Object Lock uploads need a Content-MD5, and If-None-Match
+// keeps a concurrent writer from replacing the object.
+func (c *s3ChainTarget) put(record *ChainRecord, data []byte) error {
+	key := fmt.Sprintf("%s%012d.json", c.prefix, record.Seq)
+	u := c.bucket.base
+	u.Path += key
+	req, err := http.NewRequest("PUT", u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	md5sum := md5.Sum(data)
+	sha256sum := sha256.Sum256(data)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5sum[:]))
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sha256sum[:]))
+	req.Header.Set("If-None-Match", "*")
+	if c.mode != "" {
+		recorded, _ := time.Parse(time.RFC3339, record.Time)
+		req.Header.Set("X-Amz-Object-Lock-Mode", c.mode)
+		req.Header.Set("X-Amz-Object-Lock-Retain-Until-Date", recorded.Add(c.retain).Format(time.RFC3339))
+	}
+	c.bucket.creds.signV4(req, c.bucket.region, time.Now())
+	resp, err := c.bucket.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to store chain record: %s returned %s: %s", u.Redacted(), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
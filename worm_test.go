@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWORMReportLog(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("alpha"), 0644)
+	logPath := filepath.Join(dir, "evidence.log")
+	report, _, err := splitReportArgs([]string{"-report", "worm", logPath, "-report", "html", filepath.Join(dir, "report.html")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := []ReportRow{{Path: "a.txt", Status: "ok"}, {Path: "b.txt", Status: "missing"}}
+	for range 2 {
+		if err := report.write(VerificationReport{Title: "Verification of dist", Rows: rows}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "report.html")); err != nil {
+		t.Errorf("HTML report not written with the worm report: %v", err)
+	}
+	if count, err := VerifyChain(logPath); err != nil || count != 2 {
+		t.Fatalf("VerifyChain = %d, %v; want 2 records", count, err)
+	}
+	records, _ := readChain(logPath)
+	if got := records[1].Report; got == nil || got.Failed != 1 || len(got.Rows) != 2 || got.Rows[1].Status != "missing" {
+		t.Errorf("Report = %+v, want 2 rows with 1 failed", got)
+	}
+
+	// Rewriting a report breaks the chain
+	data, _ := os.ReadFile(logPath)
+	os.WriteFile(logPath, []byte(strings.Replace(string(data), `"missing"`, `"ok"`, 1)), 0644)
+	if _, err := VerifyChain(logPath); err == nil {
+		t.Error("Expected an edited report to fail verification")
+	}
+}
+
+func TestWORMReportS3(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string]string{}
+	var lockHeaders []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		key := strings.TrimPrefix(r.URL.Path, "/audit/")
+		switch {
+		case r.Method == "PUT":
+			body, _ := io.ReadAll(r.Body)
+			sum := md5.Sum(body)
+			if r.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+				http.Error(w, "BadDigest", http.StatusBadRequest)
+				return
+			}
+			if _, exists := objects[key]; exists && r.Header.Get("If-None-Match") == "*" {
+				http.Error(w, "PreconditionFailed", http.StatusPreconditionFailed)
+				return
+			}
+			objects[key] = string(body)
+			lockHeaders = append(lockHeaders, r.Header.Get("X-Amz-Object-Lock-Mode"))
+		case key != "":
+			fmt.Fprint(w, objects[key])
+		default:
+			var keys []string
+			for k := range objects {
+				if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+					keys = append(keys, k)
+				}
+			}
+			sort.Strings(keys)
+			fmt.Fprint(w, `<ListBucketResult><IsTruncated>false</IsTruncated>`)
+			for _, k := range keys {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2024-01-02T03:04:05.000Z</LastModified></Contents>`, k, len(objects[k]))
+			}
+			fmt.Fprint(w, `</ListBucketResult>`)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", server.URL)
+
+	target := "s3://audit/reports/?mode=governance&retain=2555d"
+	for range 3 {
+		if err := writeWORMReport(target, VerificationReport{Title: "Nightly", Generated: time.Now(), Rows: []ReportRow{{Path: "a", Status: "ok"}}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := objects["reports/000000000003.json"]; !ok || len(objects) != 3 {
+		t.Errorf("Objects = %v, want reports 1 to 3", objects)
+	}
+	if strings.Join(lockHeaders, ",") != "GOVERNANCE,GOVERNANCE,GOVERNANCE" {
+		t.Errorf("Object Lock modes = %v", lockHeaders)
+	}
+	if count, err := VerifyChain(target); err != nil || count != 3 {
+		t.Errorf("VerifyChain = %d, %v; want 3 records", count, err)
+	}
+
+	if _, err := openS3Chain("s3://audit/reports/?mode=forever&retain=1d"); err == nil {
+		t.Error("Expected an unknown retention mode to be rejected")
+	}
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a significant line of a YAML document
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// yamlParser parses the block subset of YAML used by hashculate's config
+// files: nested mappings and sequences, plain and quoted scalars, flow
+// sequences and comments. Anchors, multi-line scalars and multiple documents
+// are not supported.
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// decodeYAML parses a YAML document into v using its JSON field tags
+func decodeYAML(data []byte, v any) error {
+	value, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(encoded, v)
+}
+
+// parseYAML parses a YAML document into maps, slices and scalars
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		text := strings.TrimRight(stripYAMLComment(raw), " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(text, " "), "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(text) - len(trimmed), text: trimmed})
+	}
+	if len(p.lines) == 0 {
+		return map[string]any{}, nil
+	}
+	value, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].number)
+	}
+	return value, nil
+}
+
+// stripYAMLComment removes a trailing comment outside of quotes
+func stripYAMLComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// block parses the mapping or sequence starting at the current line
+func (p *yamlParser) block(indent int) (any, error) {
+	if isYAMLSequenceItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// sequence parses "- item" lines at indent
+func (p *yamlParser) sequence(indent int) (any, error) {
+	items := []any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent || !isYAMLSequenceItem(line.text) {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(line.text, "-"))
+		switch {
+		case rest == "":
+			p.pos++
+			if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			value, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		case yamlKeyValue(rest):
+			// A mapping starting on the item line continues at the item's content indent
+			p.lines[p.pos] = yamlLine{number: line.number, indent: indent + len(line.text) - len(rest), text: rest}
+			value, err := p.mapping(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		default:
+			value, err := yamlScalar(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+			p.pos++
+		}
+	}
+	return items, nil
+}
+
+// yamlKeyValue reports whether text starts a "key: value" pair
+func yamlKeyValue(text string) bool {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") || strings.HasPrefix(text, "[") {
+		return false
+	}
+	i := strings.Index(text, ":")
+	return i > 0 && (i == len(text)-1 || text[i+1] == ' ')
+}
+
+// mapping parses "key: value" lines at indent
+func (p *yamlParser) mapping(indent int) (any, error) {
+	values := map[string]any{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", line.number)
+		}
+		if isYAMLSequenceItem(line.text) {
+			break
+		}
+		if !yamlKeyValue(line.text) {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		i := strings.Index(line.text, ":")
+		key := strings.Trim(strings.TrimSpace(line.text[:i]), `"'`)
+		rest := strings.TrimSpace(line.text[i+1:])
+		if _, dup := values[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.number, key)
+		}
+		p.pos++
+		if rest != "" {
+			value, err := yamlScalar(rest, line.number)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+			continue
+		}
+		// Nested block, which may be a sequence at the same indent as the key
+		if p.pos < len(p.lines) && (p.lines[p.pos].indent > indent ||
+			(p.lines[p.pos].indent == indent && isYAMLSequenceItem(p.lines[p.pos].text))) {
+			value, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = value
+		} else {
+			values[key] = nil
+		}
+	}
+	return values, nil
+}
+
+// yamlScalar parses a scalar or flow sequence
+func yamlScalar(text string, line int) (any, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid quoted string", line)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("line %d: invalid quoted string", line)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", line)
+		}
+		items := []any{}
+		inner := strings.TrimSpace(text[1 : len(text)-1])
+		if inner == "" {
+			return items, nil
+		}
+		for _, item := range strings.Split(inner, ",") {
+			value, err := yamlScalar(strings.TrimSpace(item), line)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	}
+	switch text {
+	case "true", "True":
+		return true, nil
+	case "false", "False":
+		return false, nil
+	case "null", "~":
+		return nil, nil
+	}
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	return text, nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	doc := `# monitor config
+database: /var/lib/fim.json   # baseline
+interval: 30s
+paths:
+  - /etc
+  - "/srv/my data"
+ignore: ['*.swp', "*.tmp"]
+groups:
+- name: binaries
+  algorithms: [sha256, sha512]
+  paths:
+    - /usr/bin
+- name: 'it''s config'
+  enabled: true
+  depth: 3
+empty:
+`
+	got, err := parseYAML([]byte(doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := map[string]any{
+		"database": "/var/lib/fim.json",
+		"interval": "30s",
+		"paths":    []any{"/etc", "/srv/my data"},
+		"ignore":   []any{"*.swp", "*.tmp"},
+		"groups": []any{
+			map[string]any{"name": "binaries", "algorithms": []any{"sha256", "sha512"}, "paths": []any{"/usr/bin"}},
+			map[string]any{"name": "it's config", "enabled": true, "depth": int64(3)},
+		},
+		"empty": nil,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parsed\n%#v\nwant\n%#v", got, want)
+	}
+
+	for _, bad := range []string{"key: value\n  indented: wrong", "just text", "a: 1\na: 2", `a: "unterminated`} {
+		if _, err := parseYAML([]byte(bad)); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}